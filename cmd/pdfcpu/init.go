@@ -42,6 +42,21 @@ func initCommandMap() {
 		permissionsCmdMap.Register(k, v)
 	}
 
+	revisionsCmdMap := NewCommandMap()
+	for k, v := range map[string]Command{
+		"list":    {handleListRevisionsCommand, nil, "", ""},
+		"extract": {handleExtractRevisionCommand, nil, "", ""},
+	} {
+		revisionsCmdMap.Register(k, v)
+	}
+
+	signaturesCmdMap := NewCommandMap()
+	for k, v := range map[string]Command{
+		"verify": {handleVerifySignaturesCommand, nil, "", ""},
+	} {
+		signaturesCmdMap.Register(k, v)
+	}
+
 	pagesCmdMap := NewCommandMap()
 	for k, v := range map[string]Command{
 		"insert": {handleInsertPagesCommand, nil, "", ""},
@@ -77,6 +92,7 @@ func initCommandMap() {
 		"decrypt":     {handleDecryptCommand, nil, usageDecrypt, usageLongDecrypt},
 		"encrypt":     {handleEncryptCommand, nil, usageEncrypt, usageLongEncrypt},
 		"extract":     {handleExtractCommand, nil, usageExtract, usageLongExtract},
+		"grep":        {handleGrepCommand, nil, usageGrep, usageLongGrep},
 		"grid":        {handleGridCommand, nil, usageGrid, usageLongGrid},
 		"help":        {printHelp, nil, "", ""},
 		"info":        {handleInfoCommand, nil, usageInfo, usageLongInfo},
@@ -88,6 +104,10 @@ func initCommandMap() {
 		"pages":       {nil, pagesCmdMap, usagePages, usageLongPages},
 		"paper":       {printPaperSizes, nil, usagePaper, usageLongPaper},
 		"permissions": {nil, permissionsCmdMap, usagePerm, usageLongPerm},
+		"redact":      {handleRedactCommand, nil, usageRedact, usageLongRedact},
+		"revisions":   {nil, revisionsCmdMap, usageRevisions, usageLongRevisions},
+		"sign":        {handleSignCommand, nil, usageSign, usageLongSign},
+		"signatures":  {nil, signaturesCmdMap, usageSignatures, usageLongSignatures},
 		"rotate":      {handleRotateCommand, nil, usageRotate, usageLongRotate},
 		"split":       {handleSplitCommand, nil, usageSplit, usageLongSplit},
 		"stamp":       {nil, stampCmdMap, usageStamp, usageLongStamp},
@@ -134,6 +154,28 @@ func initFlags() {
 
 	flag.StringVar(&upw, "upw", "", "user password")
 	flag.StringVar(&opw, "opw", "", "owner password")
+
+	certUsage := "encrypt: comma separated list of recipient certificates; decrypt, sign: PEM or PKCS#12 file with certificate and private key"
+	flag.StringVar(&cert, "cert", "", certUsage)
+	flag.StringVar(&certpw, "certpw", "", "decrypt, sign: password for the private key")
+
+	flag.StringVar(&trust, "trust", "", "signatures verify: PEM file with trusted root certificates")
+
+	flag.BoolVar(&incremental, "incr", false, "append changes as incremental update")
+
+	flag.BoolVar(&linearize, "lin", false, "optimize: write a linearized file for Fast Web View")
+	flag.BoolVar(&recompress, "recompress", false, "optimize: re-encode streams using the best Flate compression")
+	flag.BoolVar(&optimizeImages, "img", false, "optimize: downsample and re-encode images")
+	flag.BoolVar(&unusedResources, "unused", false, "optimize: remove page resources not referenced by any content")
+	flag.IntVar(&dpi, "dpi", 150, "optimize: target resolution for image downsampling, 0 keeps the resolution")
+	flag.IntVar(&jpegQuality, "jpeg", 0, "optimize: JPEG quality (1..100) for re-encoding images, 0 keeps the encoding")
+
+	flag.BoolVar(&pretty, "pretty", false, "extract content: parse page content and pretty print operators")
+	flag.BoolVar(&jsonOutput, "json", false, "extract text: also write text runs with bounding box, font and size as JSON; grep: print hits as JSON")
+
+	flag.BoolVar(&deterministic, "det", false, "reproducible output: content derived file ID, no timestamps")
+
+	flag.BoolVar(&lazy, "lazy", false, "info, attachments list: load objects on first access and skip validation")
 }
 
 func initLogging(verbose, veryVerbose bool) {
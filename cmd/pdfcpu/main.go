@@ -29,8 +29,14 @@ import (
 var (
 	fileStats, mode, selectedPages string
 	upw, opw, key, perm, units     string
+	cert, certpw, trust            string
 	verbose, veryVerbose           bool
-	quiet                          bool
+	quiet, incremental, linearize  bool
+	deterministic, recompress      bool
+	optimizeImages, pretty         bool
+	unusedResources, lazy          bool
+	jsonOutput                     bool
+	dpi, jpegQuality               int
 	needStackTrace                 = true
 	cmdMap                         CommandMap
 )
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"os"
@@ -115,6 +116,12 @@ func handleOptimizeCommand(conf *pdfcpu.Configuration) {
 	}
 
 	conf.StatsFileName = fileStats
+	conf.Linearize = linearize
+	conf.Recompress = recompress
+	conf.OptimizeImages = optimizeImages
+	conf.RemoveUnusedResources = unusedResources
+	conf.ImageDPI = dpi
+	conf.JPEGQuality = jpegQuality
 	if len(fileStats) > 0 {
 		fmt.Fprintf(os.Stdout, "stats will be appended to %s\n", fileStats)
 	}
@@ -168,7 +175,7 @@ func handleMergeCommand(conf *pdfcpu.Configuration) {
 
 func extractModeCompletion(modePrefix string) string {
 	var modeStr string
-	for _, mode := range []string{"image", "font", "page", "content", "meta"} {
+	for _, mode := range []string{"image", "font", "page", "content", "text", "meta"} {
 		if !strings.HasPrefix(mode, modePrefix) {
 			continue
 		}
@@ -197,6 +204,9 @@ func handleExtractCommand(conf *pdfcpu.Configuration) {
 		os.Exit(1)
 	}
 
+	conf.PrettyPrintContent = pretty
+	conf.TextRunsJSON = jsonOutput
+
 	var cmd *cli.Command
 
 	switch mode {
@@ -213,6 +223,9 @@ func handleExtractCommand(conf *pdfcpu.Configuration) {
 	case "content":
 		cmd = cli.ExtractContentCommand(inFile, outDir, pages, conf)
 
+	case "text":
+		cmd = cli.ExtractTextCommand(inFile, outDir, pages, conf)
+
 	case "meta":
 		cmd = cli.ExtractMetadataCommand(inFile, outDir, conf)
 
@@ -225,6 +238,30 @@ func handleExtractCommand(conf *pdfcpu.Configuration) {
 	process(cmd)
 }
 
+func handleGrepCommand(conf *pdfcpu.Configuration) {
+	if len(flag.Args()) < 2 {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageGrep)
+		os.Exit(1)
+	}
+
+	pattern := flag.Arg(0)
+
+	filesIn := flag.Args()[1:]
+	for _, inFile := range filesIn {
+		ensurePdfExtension(inFile)
+	}
+
+	pages, err := api.ParsePageSelection(selectedPages)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "problem with flag selectedPages: %v\n", err)
+		os.Exit(1)
+	}
+
+	conf.GrepJSON = jsonOutput
+
+	process(cli.GrepCommand(pattern, filesIn, pages, conf))
+}
+
 func handleTrimCommand(conf *pdfcpu.Configuration) {
 	if len(flag.Args()) == 0 || len(flag.Args()) > 2 || selectedPages == "" {
 		fmt.Fprintf(os.Stderr, "%s\n\n", usageTrim)
@@ -257,6 +294,7 @@ func handleListAttachmentsCommand(conf *pdfcpu.Configuration) {
 
 	inFile := flag.Arg(0)
 	ensurePdfExtension(inFile)
+	setupLazyLoad(conf)
 	process(cli.ListAttachmentsCommand(inFile, conf))
 }
 
@@ -340,6 +378,98 @@ func handleListPermissionsCommand(conf *pdfcpu.Configuration) {
 	process(cli.ListPermissionsCommand(inFile, conf))
 }
 
+func handleListRevisionsCommand(conf *pdfcpu.Configuration) {
+	if len(flag.Args()) != 1 || selectedPages != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", usageRevisionsList)
+		os.Exit(1)
+	}
+
+	inFile := flag.Arg(0)
+	ensurePdfExtension(inFile)
+
+	process(cli.ListRevisionsCommand(inFile, conf))
+}
+
+func handleExtractRevisionCommand(conf *pdfcpu.Configuration) {
+	if len(flag.Args()) != 3 || selectedPages != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", usageRevisionsExtract)
+		os.Exit(1)
+	}
+
+	inFile := flag.Arg(0)
+	ensurePdfExtension(inFile)
+
+	revision, err := strconv.Atoi(flag.Arg(1))
+	if err != nil || revision < 1 {
+		fmt.Fprintln(os.Stderr, "revisions: revision is a numeric value >= 1")
+		os.Exit(1)
+	}
+
+	outFile := flag.Arg(2)
+	ensurePdfExtension(outFile)
+
+	process(cli.ExtractRevisionCommand(inFile, outFile, revision, conf))
+}
+
+func handleVerifySignaturesCommand(conf *pdfcpu.Configuration) {
+	if len(flag.Args()) != 1 || selectedPages != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", usageSignaturesVerify)
+		os.Exit(1)
+	}
+
+	inFile := flag.Arg(0)
+	ensurePdfExtension(inFile)
+
+	if trust != "" {
+		certs, err := pdfcpu.ReadCertificates(trust)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		conf.TrustedCerts = x509.NewCertPool()
+		for _, c := range certs {
+			conf.TrustedCerts.AddCert(c)
+		}
+	}
+
+	process(cli.VerifySignaturesCommand(inFile, conf))
+}
+
+func handleSignCommand(conf *pdfcpu.Configuration) {
+	if len(flag.Args()) < 1 || len(flag.Args()) > 3 || cert == "" || selectedPages != "" {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageSign)
+		os.Exit(1)
+	}
+
+	sp, err := pdfcpu.NewSignParams(cert, certpw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+
+	if len(args) == 3 || len(args) == 2 && !hasPdfExtension(args[0]) {
+		// pdfcpu sign description inFile [outFile]
+		if err = pdfcpu.ParseSignDetails(args[0], sp); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		args = args[1:]
+	}
+
+	inFile := args[0]
+	ensurePdfExtension(inFile)
+
+	outFile := ""
+	if len(args) == 2 {
+		outFile = args[1]
+		ensurePdfExtension(outFile)
+	}
+
+	process(cli.SignCommand(inFile, outFile, sp, conf))
+}
+
 func permCompletion(permPrefix string) string {
 	var permStr string
 
@@ -391,6 +521,15 @@ func handleDecryptCommand(conf *pdfcpu.Configuration) {
 		ensurePdfExtension(outFile)
 	}
 
+	if cert != "" {
+		c, k, err := pdfcpu.ReadKeyPair(cert, certpw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		conf.DecryptCert, conf.DecryptKey = c, k
+	}
+
 	process(cli.DecryptCommand(inFile, outFile, conf))
 }
 
@@ -439,7 +578,7 @@ func handleEncryptCommand(conf *pdfcpu.Configuration) {
 		os.Exit(1)
 	}
 
-	if conf.OwnerPW == "" {
+	if conf.OwnerPW == "" && cert == "" {
 		fmt.Fprintln(os.Stderr, "missing non-empty owner password!")
 		fmt.Fprintf(os.Stderr, "%s\n\n", usageEncrypt)
 		os.Exit(1)
@@ -456,6 +595,10 @@ func handleEncryptCommand(conf *pdfcpu.Configuration) {
 		conf.Permissions = pdfcpu.PermissionsAll
 	}
 
+	if cert != "" {
+		conf.Recipients = parseRecipients(cert, conf.Permissions)
+	}
+
 	inFile := flag.Arg(0)
 	ensurePdfExtension(inFile)
 
@@ -468,6 +611,36 @@ func handleEncryptCommand(conf *pdfcpu.Configuration) {
 	process(cli.EncryptCommand(inFile, outFile, conf))
 }
 
+// parseRecipients parses a comma separated list of certificate files each optionally followed by :none or :all.
+func parseRecipients(s string, defaultPermissions int16) (rr []pdfcpu.Recipient) {
+
+	for _, fn := range strings.Split(s, ",") {
+
+		p := defaultPermissions
+
+		if i := strings.LastIndex(fn, ":"); i > 0 {
+			switch fn[i+1:] {
+			case "none":
+				p, fn = pdfcpu.PermissionsNone, fn[:i]
+			case "all":
+				p, fn = pdfcpu.PermissionsAll, fn[:i]
+			}
+		}
+
+		certs, err := pdfcpu.ReadCertificates(fn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		for _, c := range certs {
+			rr = append(rr, pdfcpu.Recipient{Cert: c, Permissions: p})
+		}
+	}
+
+	return rr
+}
+
 func handleChangeUserPasswordCommand(conf *pdfcpu.Configuration) {
 	if len(flag.Args()) != 3 {
 		fmt.Fprintf(os.Stderr, "%s\n\n", usageChangeUserPW)
@@ -942,5 +1115,50 @@ func handleInfoCommand(conf *pdfcpu.Configuration) {
 		conf.Units = pdfcpu.MILLIMETRES
 	}
 
+	setupLazyLoad(conf)
 	process(cli.InfoCommand(inFile, conf))
 }
+
+// setupLazyLoad configures loading objects on first access if requested.
+func setupLazyLoad(conf *pdfcpu.Configuration) {
+	if lazy {
+		// Validation would load all objects.
+		conf.LazyLoad, conf.ValidationMode = true, pdfcpu.ValidationNone
+	}
+}
+
+func handleRedactCommand(conf *pdfcpu.Configuration) {
+	if len(flag.Args()) < 1 || len(flag.Args()) > 3 {
+		fmt.Fprintf(os.Stderr, "%s\n\n", usageRedact)
+		os.Exit(1)
+	}
+
+	rp := &pdfcpu.RedactParams{}
+	args := flag.Args()
+
+	if len(args) == 3 || len(args) == 2 && !hasPdfExtension(args[0]) {
+		// pdfcpu redact description inFile [outFile]
+		if err := pdfcpu.ParseRedactDetails(args[0], rp); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		args = args[1:]
+	}
+
+	inFile := args[0]
+	ensurePdfExtension(inFile)
+
+	outFile := ""
+	if len(args) == 2 {
+		outFile = args[1]
+		ensurePdfExtension(outFile)
+	}
+
+	pages, err := api.ParsePageSelection(selectedPages)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "problem with flag selectedPages: %v\n", err)
+		os.Exit(1)
+	}
+
+	process(cli.RedactCommand(inFile, outFile, pages, rp, conf))
+}
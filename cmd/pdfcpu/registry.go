@@ -59,17 +59,20 @@ func (m CommandMap) Register(cmdStr string, cmd Command) {
 // executes the resulting command.
 func (m CommandMap) Handle(cmdPrefix string, command string, conf *pdfcpu.Configuration) (string, error) {
 
-	var cmdStr string
-
-	// Support command completion.
-	for k := range m {
-		if !strings.HasPrefix(k, cmdPrefix) {
-			continue
-		}
-		if len(cmdStr) > 0 {
-			return command, errAmbiguousCmd
+	cmdStr := cmdPrefix
+
+	// Support command completion unless there is an exact match, eg. sign vs. signatures.
+	if _, ok := m[cmdPrefix]; !ok {
+		cmdStr = ""
+		for k := range m {
+			if !strings.HasPrefix(k, cmdPrefix) {
+				continue
+			}
+			if len(cmdStr) > 0 {
+				return command, errAmbiguousCmd
+			}
+			cmdStr = k
 		}
-		cmdStr = k
 	}
 
 	if cmdStr == "" {
@@ -80,6 +83,11 @@ func (m CommandMap) Handle(cmdPrefix string, command string, conf *pdfcpu.Config
 
 	conf.OwnerPW = opw
 	conf.UserPW = upw
+	conf.Incremental = incremental
+	conf.Deterministic = deterministic
+
+	// Input files stay open while a command is processed.
+	conf.StreamsOnDemand = true
 
 	if m[cmdStr].handler != nil {
 		m[cmdStr].handler(conf)
@@ -31,6 +31,7 @@ The commands are:
    decrypt     remove password protection
    encrypt     set password protection		
    extract     extract images, fonts, content, pages, metadata
+   grep        search the text of PDFs for a regular expression
    grid        rearrange pages or images for enhanced browsing experience
    import      import/convert images to PDF
    info        print file info
@@ -40,16 +41,23 @@ The commands are:
    pages       insert, remove selected pages
    paper       print list of supported paper sizes
    permissions list, set user access permissions
+   redact      remove the text, graphics and images of marked areas
+   revisions   list, extract revisions created by incremental updates
    rotate      rotate pages
+   sign        apply a digital signature
+   signatures  verify digital signatures
    split       split multi-page PDF into several PDFs according to split span
    stamp       add, remove, update text, image or PDF stamps for selected pages
    trim        create trimmed version of selected pages
-   validate    validate PDF against PDF 32000-1:2008 (PDF 1.7)
+   validate    validate PDF against PDF 32000-1:2008 (PDF 1.7) or PDF 32000-2 (PDF 2.0)
    version     print version
    watermark   add, remove, update text, image or PDF watermarks for selected pages
 
    Completion supported for all commands.
    One letter Unix style abbreviations supported for flags and command parameters.
+   Use -incr with commands modifying a PDF to append the changes as incremental update
+   leaving the original revision and any signatures intact.
+   Use -det for reproducible output: same input, same command, same bytes.
 
 Use "pdfcpu help [command]" for more information about a command.`
 
@@ -66,10 +74,11 @@ verbose, v ... turn on logging
 		
 The validation modes are:
 
- strict ... (default) validates against PDF 32000-1:2008 (PDF 1.7)
-relaxed ... like strict but doesn't complain about common seen spec violations.`
+ strict ... (default) validates against PDF 32000-1:2008 (PDF 1.7) or PDF 32000-2 (PDF 2.0)
+relaxed ... like strict but doesn't complain about common seen spec violations
+            and tolerates entries deprecated in PDF 2.0.`
 
-	usageOptimize     = "usage: pdfcpu optimize [-v(erbose)|vv] [-q(uiet)] [-stats csvFile] [-upw userpw] [-opw ownerpw] inFile [outFile]"
+	usageOptimize     = "usage: pdfcpu optimize [-v(erbose)|vv] [-q(uiet)] [-stats csvFile] [-lin] [-recompress] [-unused] [-img [-dpi n] [-jpeg quality]] [-upw userpw] [-opw ownerpw] inFile [outFile]"
 	usageLongOptimize = `Read inFile, remove redundant page resources like embedded fonts and images and write the result to outFile.
 
 verbose, v ... turn on logging
@@ -77,6 +86,15 @@ verbose, v ... turn on logging
   quiet, q ... disable output
      stats ... appends a stats line to a csv file with information about the usage of root and page entries.
                useful for batch optimization and debugging PDFs.
+       lin ... write a linearized file for Fast Web View (no object streams, encrypted files are not supported)
+recompress ... decode streams and re-encode them using the best Flate compression, drop ASCII filters
+               and merge multiple page content streams. Streams only get replaced if they shrink.
+    unused ... remove fonts, images, forms, graphics states, color spaces, patterns and shadings
+               not referenced by the content of any page, annotation appearance, form, pattern or Type3 font.
+       img ... optimize images: downsample images exceeding dpi on any page, re-encode 8 bit RGB and gray images
+               as JPEG and convert RGB images using gray colors only to DeviceGray. Images only get replaced if they shrink.
+       dpi ... target resolution for image downsampling (default: 150, 0 keeps the resolution)
+      jpeg ... JPEG quality 1..100 for image re-encoding (default: 0 keeps the encoding)
        upw ... user password
        opw ... owner password
     inFile ... input pdf file
@@ -120,13 +138,15 @@ verbose, v ... turn on logging
 
 e.g. -3,5,7- or 4-7,!6 or 1-,!5 or odd,n1`
 
-	usageExtract     = "usage: pdfcpu extract [-v(erbose)|vv] [-q(uiet)] -mode image|font|content|page|meta [-pages selectedPages] [-upw userpw] [-opw ownerpw] inFile outDir"
-	usageLongExtract = `Export inFile's images, fonts, content or pages into outDir.
+	usageExtract     = "usage: pdfcpu extract [-v(erbose)|vv] [-q(uiet)] -mode image|font|content|text|page|meta [-pretty] [-json] [-pages selectedPages] [-upw userpw] [-opw ownerpw] inFile outDir"
+	usageLongExtract = `Export inFile's images, fonts, content, text or pages into outDir.
 
 verbose, v ... turn on logging
         vv ... verbose logging
   quiet, q ... disable output
       mode ... extraction mode
+    pretty ... content mode: one file per page listing parsed operators, nested sections indented
+      json ... text mode: also write text runs with bounding box, font and size per page
      pages ... selected pages
        upw ... user password
        opw ... owner password
@@ -137,10 +157,30 @@ verbose, v ... turn on logging
 
   image ... extract images
    font ... extract font files (supported font types: TrueType)
-content ... extract raw page content
+content ... extract raw page content, parsed and indented with -pretty
+   text ... extract page text
    page ... extract single page PDFs
    meta ... extract all metadata (page selection does not apply)
    
+` + usagePageSelection
+
+	usageGrep     = "usage: pdfcpu grep [-v(erbose)|vv] [-q(uiet)] [-json] [-pages selectedPages] [-upw userpw] [-opw ownerpw] regexp inFile..."
+	usageLongGrep = `Search the text of selected pages of one or more PDFs for a regular expression.
+Print one line per match: inFile:page: snippet
+
+verbose, v ... turn on logging
+        vv ... verbose logging
+  quiet, q ... disable output
+      json ... print one JSON object per match including the bounding boxes of the matched text
+     pages ... selected pages
+       upw ... user password
+       opw ... owner password
+    regexp ... Go regular expression, use (?i) for case insensitive search
+    inFile ... input pdf file
+
+Lines of a page are separated by \n, use \s+ to match text broken across lines.
+Files that cannot be searched get reported after all other files have been searched.
+
 ` + usagePageSelection
 
 	usageTrim     = "usage: pdfcpu trim [-v(erbose)|vv] [-q(uiet)] -pages selectedPages [-upw userpw] [-opw ownerpw] inFile [outFile]"
@@ -157,7 +197,7 @@ verbose, v ... turn on logging
    
 ` + usagePageSelection
 
-	usageAttachList    = "pdfcpu attachments list    [-v(erbose)|vv] [-q(uiet)] [-upw userpw] [-opw ownerpw] inFile"
+	usageAttachList    = "pdfcpu attachments list    [-v(erbose)|vv] [-q(uiet)] [-lazy] [-upw userpw] [-opw ownerpw] inFile"
 	usageAttachAdd     = "pdfcpu attachments add     [-v(erbose)|vv] [-q(uiet)] [-upw userpw] [-opw ownerpw] inFile file..."
 	usageAttachRemove  = "pdfcpu attachments remove  [-v(erbose)|vv] [-q(uiet)] [-upw userpw] [-opw ownerpw] inFile [file...]"
 	usageAttachExtract = "pdfcpu attachments extract [-v(erbose)|vv] [-q(uiet)] [-upw userpw] [-opw ownerpw] inFile outDir [file...]"
@@ -172,6 +212,7 @@ verbose, v ... turn on logging
 verbose, v ... turn on logging
         vv ... verbose logging
   quiet, q ... disable output
+      lazy ... list: load objects on first access and skip validation
        upw ... user password
        opw ... owner password
     inFile ... input pdf file
@@ -193,8 +234,124 @@ verbose, v ... turn on logging
        opw ... owner password
     inFile ... input pdf file`
 
-	usageEncrypt     = "usage: pdfcpu encrypt [-v(erbose)|vv] [-q(uiet)] [-mode rc4|aes] [-key 40|128|256] [perm none|all] [-upw userpw] -opw ownerpw inFile [outFile]"
-	usageLongEncrypt = `Setup password protection based on user and owner password.
+	usageRevisionsList    = "pdfcpu revisions list    [-v(erbose)|vv] [-q(uiet)] inFile"
+	usageRevisionsExtract = "pdfcpu revisions extract [-v(erbose)|vv] [-q(uiet)] inFile revision outFile"
+
+	usageRevisions = "usage: " + usageRevisionsList +
+		"\n       " + usageRevisionsExtract
+
+	usageLongRevisions = `Inspect the incremental updates of a PDF file.
+
+verbose, v ... turn on logging
+        vv ... verbose logging
+  quiet, q ... disable output
+    inFile ... input pdf file
+  revision ... revision number, 1 is the original document
+   outFile ... output pdf file
+
+list prints the added, changed and deleted objects of each revision.
+extract writes inFile exactly as it was at revision.`
+
+	usageRedact     = "usage: pdfcpu redact [-v(erbose)|vv] [-q(uiet)] [-pages selectedPages] [-upw userpw] [-opw ownerpw] [description] inFile [outFile]"
+	usageLongRedact = `Apply the Redact annotations of selected pages along with additional areas and text matches.
+The text, graphics and image samples within the redacted areas get removed from the page content
+and the XObjects involved, the overlays get painted and the Redact annotations get removed.
+The result is never written as incremental update since the previous revision would keep the removed content.
+
+ verbose, v ... turn on logging
+         vv ... verbose logging
+   quiet, q ... disable output
+      pages ... selected pages
+        upw ... user password
+        opw ... owner password
+description ... rect, color, pattern
+     inFile ... input pdf file
+    outFile ... output pdf file
+
+    <description> is a comma separated configuration string containing:
+
+    optional entries:
+
+        (defaults: co:0 0 0)
+
+    rect:     area to be redacted on all selected pages in user units eg. '36 36 236 96', may be repeated
+    color:    fill color of the areas given by rect and pattern eg. '1 0 0'
+    pattern:  Go regular expression matching text to be redacted, has to be the last entry
+
+    Glyphs get removed if their center lies within an area.
+    Structure elements enclosing removed text lose their replacement and alternate text,
+    thumbnails of redacted pages get removed.
+    Text matching pattern also gets removed from the document info,
+    XMP metadata of the document containing matching text gets dropped.
+    Shadings, other annotations, bookmarks and metadata of pages or objects are left untouched.
+
+    e.g. 'rect:100 700 300 720, pattern:(?i)confidential'
+         'co:1 1 1, pat:\d{3}-\d{2}-\d{4}'
+
+` + usagePageSelection
+
+	usageSign     = "usage: pdfcpu sign [-v(erbose)|vv] [-q(uiet)] -cert certFile [-certpw password] [description] inFile [outFile]"
+	usageLongSign = `Apply an approval or certification signature.
+The signature gets appended as incremental update which keeps existing signatures valid.
+
+ verbose, v ... turn on logging
+         vv ... verbose logging
+   quiet, q ... disable output
+       cert ... PKCS#12 or PEM file with the signer's certificate and private key
+     certpw ... password for the private key
+description ... field, page, position, reason, location, contact, certify, format, tsa
+     inFile ... input pdf file
+    outFile ... output pdf file
+
+    <description> is a comma separated configuration string containing:
+
+    optional entries:
+
+        (defaults: fi:Signature<n>, pa:1, fo:pkcs7, invisible)
+
+    field:    name of the signature field to create or to sign
+    page:     page of a new signature widget
+    position: rectangle of a visible signature in user units eg. '36 36 236 96'
+    reason:   reason for signing
+    location: location of signing
+    contact:  contact information of the signer
+    certify:  apply a certification signature with DocMDP access permissions:
+                  1 ... no changes allowed
+                  2 ... form filling and signing allowed
+                  3 ... form filling, signing and annotating allowed
+    format:   pkcs7 (adbe.pkcs7.detached) or cades (ETSI.CAdES.detached)
+    tsa:      URL of a RFC 3161 timestamp authority
+
+    An existing empty signature field keeps its widget.
+
+    e.g. 'pos:36 36 236 96, reason:Approved, tsa:http://timestamp.example.com'
+         'fi:Signature1, certify:2'`
+
+	usageSignaturesVerify = "pdfcpu signatures verify [-v(erbose)|vv] [-q(uiet)] [-trust certFile] [-upw userpw] [-opw ownerpw] inFile"
+
+	usageSignatures = "usage: " + usageSignaturesVerify
+
+	usageLongSignatures = `Verify the digital signatures of a PDF file.
+
+verbose, v ... turn on logging
+        vv ... verbose logging
+  quiet, q ... disable output
+     trust ... PEM file with trusted root certificates (default: system trust store)
+       upw ... user password
+       opw ... owner password
+    inFile ... input pdf file
+
+verify checks for each signature field:
+  - the byte range covers the whole revision except for the signature value
+  - the digest and the signature of the PKCS#7/CMS signature
+  - the signer's certificate chain against the trusted root certificates
+and reports signer, signing time, DocMDP permissions
+and whether the document has been modified after signing.
+Fails if any signature is invalid.`
+
+	usageEncrypt     = "usage: pdfcpu encrypt [-v(erbose)|vv] [-q(uiet)] [-mode rc4|aes] [-key 40|128|256] [perm none|all] ([-upw userpw] -opw ownerpw | -cert certFile[:none|all],...) inFile [outFile]"
+	usageLongEncrypt = `Setup password protection based on user and owner password
+or encrypt for recipients based on their certificates.
 
 verbose, v ... turn on logging
         vv ... verbose logging
@@ -204,10 +361,12 @@ verbose, v ... turn on logging
       perm ... user access permissions
        upw ... user password
        opw ... owner password (must not be empty!)
+      cert ... comma separated list of PEM encoded recipient certificates,
+               each optionally followed by the recipient's permissions :none or :all
     inFile ... input pdf file
    outFile ... output pdf file`
 
-	usageDecrypt     = "usage: pdfcpu decrypt [-v(erbose)|vv] [-q(uiet)] [-upw userpw] [-opw ownerpw] inFile [outFile]"
+	usageDecrypt     = "usage: pdfcpu decrypt [-v(erbose)|vv] [-q(uiet)] [-upw userpw] [-opw ownerpw] [-cert keyFile [-certpw pw]] inFile [outFile]"
 	usageLongDecrypt = `Remove password protection and reset permissions.
 
 verbose, v ... turn on logging
@@ -215,6 +374,8 @@ verbose, v ... turn on logging
   quiet, q ... disable output
        upw ... user password
        opw ... owner password
+      cert ... PEM or PKCS#12 file holding your certificate and private key
+    certpw ... password protecting keyFile
     inFile ... input pdf file
    outFile ... output pdf file`
 
@@ -588,10 +749,11 @@ Examples: "pdfcpu grid out.pdf 1 10 in.pdf"
 	usagePaper     = "usage: pdfcpu paper"
 	usageLongPaper = "Print a list of supported paper sizes."
 
-	usageInfo     = "usage: pdfcpu info [-u(nits)] [-upw userpw] [-opw ownerpw] inFile"
+	usageInfo     = "usage: pdfcpu info [-u(nits)] [-lazy] [-upw userpw] [-opw ownerpw] inFile"
 	usageLongInfo = `Print info about a PDF file.
    
 units, u ... paper size display unit
+    lazy ... load objects on first access and skip validation
      upw ... user password
      opw ... owner password
   inFile ... input pdf file
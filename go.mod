@@ -6,5 +6,7 @@ require (
 	github.com/hhrutter/lzw v0.0.0-20190827003112-58b82c5a41cc
 	github.com/hhrutter/tiff v0.0.0-20190827003322-d08e2ad45835
 	github.com/pkg/errors v0.8.1
+	golang.org/x/crypto v0.0.0-20190820162420-60c769a6c586
 	golang.org/x/image v0.0.0-20190823064033-3a9bac650e44
+	golang.org/x/text v0.3.2
 )
@@ -65,6 +65,7 @@ func logOperationStats(ctx *pdf.Context, op string, durRead, durVal, durOpt, dur
 }
 
 // ReadContext uses an io.Readseeker to build an internal structure holding its cross reference table aka the Context.
+// rs may be closed right away unless conf asks for StreamsOnDemand or LazyLoad, see pdf.Read.
 func ReadContext(rs io.ReadSeeker, conf *pdf.Configuration) (*pdf.Context, error) {
 	return pdf.Read(rs, conf)
 }
@@ -83,15 +84,33 @@ func ReadContextFile(inFile string) (*pdf.Context, error) {
 	if err = validate.XRefTable(ctx.XRefTable); err != nil {
 		return nil, err
 	}
+	// f is about to be closed.
+	if err = ctx.LoadStreams(); err != nil {
+		return nil, err
+	}
 	return ctx, nil
 }
 
 // PageCount returns inFile's page count.
+// Only the objects leading to the page tree root get loaded, inFile is not validated.
 func PageCount(inFile string) (int, error) {
-	ctx, err := ReadContextFile(inFile)
+	f, err := os.Open(inFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	conf := pdf.NewDefaultConfiguration()
+	conf.LazyLoad = true
+	conf.ValidationMode = pdf.ValidationNone
+
+	ctx, err := ReadContext(f, conf)
 	if err != nil {
 		return 0, err
 	}
+	if err = ctx.EnsurePageCount(); err != nil {
+		return 0, err
+	}
 	return ctx.PageCount, nil
 }
 
@@ -136,8 +155,25 @@ func OptimizeContext(ctx *pdf.Context) error {
 
 // WriteContext writes a PDF context to w.
 func WriteContext(ctx *pdf.Context, w io.Writer) error {
-	ctx.Write.Writer = bufio.NewWriter(w)
-	return pdf.Write(ctx)
+	cw := &countingWriter{w: w}
+	ctx.Write.Writer = bufio.NewWriter(cw)
+	if err := pdf.Write(ctx); err != nil {
+		return err
+	}
+	ctx.Write.FileSize = cw.n
+	return nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
 }
 
 func readAndValidate(rs io.ReadSeeker, conf *pdf.Configuration, from1 time.Time) (ctx *pdf.Context, dur1, dur2 float64, err error) {
@@ -249,6 +285,10 @@ func ValidateFile(inFile string, conf *pdf.Configuration) error {
 }
 
 // Optimize reads a PDF stream from rs and writes the optimized PDF stream to w.
+// Set conf.Linearize for a linearized PDF stream suitable for Fast Web View
+// and conf.Recompress for re-encoding streams using the best Flate compression.
+// Set conf.RemoveUnusedResources for getting rid of page resources not referenced by any content.
+// Set conf.OptimizeImages for downsampling images to conf.ImageDPI and JPEG re-encoding using conf.JPEGQuality.
 func Optimize(rs io.ReadSeeker, w io.Writer, conf *pdf.Configuration) error {
 	if conf == nil {
 		conf = pdf.NewDefaultConfiguration()
@@ -332,7 +372,7 @@ func OptimizeFile(inFile, outFile string, conf *pdf.Configuration) (err error) {
 }
 
 // EncryptFile encrypts inFile and writes the result to outFile.
-// A configuration containing the current passwords is required.
+// A configuration containing the current passwords or the recipients of the document is required.
 func EncryptFile(inFile, outFile string, conf *pdf.Configuration) error {
 	if conf == nil {
 		return errors.New("pdfcpu: missing configuration for encryption")
@@ -342,7 +382,7 @@ func EncryptFile(inFile, outFile string, conf *pdf.Configuration) error {
 }
 
 // DecryptFile decrypts inFile and writes the result to outFile.
-// A configuration containing the current passwords is required.
+// A configuration containing the current passwords or a recipient's certificate and private key is required.
 func DecryptFile(inFile, outFile string, conf *pdf.Configuration) error {
 	if conf == nil {
 		return errors.New("pdfcpu: missing configuration for decryption")
@@ -1464,7 +1504,16 @@ func Info(rs io.ReadSeeker, conf *pdf.Configuration) ([]string, error) {
 	if conf == nil {
 		conf = pdf.NewDefaultConfiguration()
 	}
-	ctx, _, _, _, err := readValidateAndOptimize(rs, conf, time.Now())
+	var (
+		ctx *pdf.Context
+		err error
+	)
+	if conf.LazyLoad {
+		// Optimization would load all objects.
+		ctx, _, _, err = readAndValidate(rs, conf, time.Now())
+	} else {
+		ctx, _, _, _, err = readValidateAndOptimize(rs, conf, time.Now())
+	}
 	if err != nil {
 		return nil, err
 	}
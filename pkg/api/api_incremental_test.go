@@ -0,0 +1,188 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pdf "github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+func incrementalConfiguration() *pdf.Configuration {
+	conf := pdf.NewDefaultConfiguration()
+	conf.Incremental = true
+	return conf
+}
+
+// checkRevisions ensures fileName is made up of orig followed by want-1 incremental updates.
+func checkRevisions(t *testing.T, msg, fileName string, orig []byte, want int) {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if !bytes.HasPrefix(b, orig) {
+		t.Fatalf("%s: original revision modified\n", msg)
+	}
+
+	revs, err := pdf.Revisions(bytes.NewReader(b), pdf.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if len(revs) != want {
+		t.Fatalf("%s: revisions want:%d got:%d\n", msg, want, len(revs))
+	}
+
+	// The last update ends with an eol following %%EOF.
+	if c := b[len(b)-1]; want > 1 && (revs[want-1].EOFOffset != int64(len(b)) || c != '\n' && c != '\r') {
+		t.Fatalf("%s: unterminated revision\n", msg)
+	}
+
+	if err := ValidateFile(fileName, nil); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+}
+
+func TestIncrementalAttachments(t *testing.T) {
+	msg := "TestIncrementalAttachments"
+	fileName := filepath.Join(outDir, "Acroforms2.pdf")
+
+	if err := copyFile(filepath.Join(inDir, "Acroforms2.pdf"), fileName); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	orig, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	files := []string{filepath.Join(resDir, "test.wav")}
+	if err := AddAttachmentsFile(fileName, "", files, incrementalConfiguration()); err != nil {
+		t.Fatalf("%s add attachments: %v\n", msg, err)
+	}
+	checkRevisions(t, msg, fileName, orig, 2)
+	listAttachments(t, msg, fileName, 1)
+
+	if err := RemoveAttachmentsFile(fileName, "", nil, incrementalConfiguration()); err != nil {
+		t.Fatalf("%s remove attachments: %v\n", msg, err)
+	}
+	checkRevisions(t, msg, fileName, orig, 3)
+	listAttachments(t, msg, fileName, 0)
+}
+
+func TestIncrementalRemovePages(t *testing.T) {
+	msg := "TestIncrementalRemovePages"
+	inFile := filepath.Join(inDir, "CenterOfWhy.pdf")
+	outFile := filepath.Join(outDir, "CenterOfWhy.pdf")
+
+	orig, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	n1, err := PageCount(inFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	if err := RemovePagesFile(inFile, outFile, []string{"2-3"}, incrementalConfiguration()); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	checkRevisions(t, msg, outFile, orig, 2)
+
+	n2, err := PageCount(outFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if n2 != n1-2 {
+		t.Fatalf("%s: pageCount want:%d got:%d\n", msg, n1-2, n2)
+	}
+
+	if err := TrimFile(outFile, "", []string{"1"}, incrementalConfiguration()); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	checkRevisions(t, msg, outFile, orig, 3)
+
+	if n2, err = PageCount(outFile); err != nil || n2 != 1 {
+		t.Fatalf("%s: pageCount want:1 got:%d %v\n", msg, n2, err)
+	}
+}
+
+func TestIncrementalPermissions(t *testing.T) {
+	msg := "TestIncrementalPermissions"
+	fileName := filepath.Join(outDir, "testImage.pdf")
+
+	if err := copyFile(filepath.Join(inDir, "testImage.pdf"), fileName); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	conf := pdf.NewAESConfiguration("upw", "opw", 256)
+	if err := EncryptFile(fileName, "", conf); err != nil {
+		t.Fatalf("%s encrypt: %v\n", msg, err)
+	}
+
+	orig, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	// Password changes would leave the original revision accessible using the old password.
+	conf = incrementalConfiguration()
+	conf.UserPW, conf.OwnerPW = "upw", "opw"
+	if err := ChangeUserPasswordFile(fileName, "", "upw", "upwNew", conf); err == nil {
+		t.Fatalf("%s: changed user password incrementally\n", msg)
+	}
+
+	// New permissions result in a new encryption key and a rewrite of all objects.
+	conf = incrementalConfiguration()
+	conf.UserPW, conf.OwnerPW = "upw", "opw"
+	conf.Permissions = pdf.PermissionsAll
+	if err := SetPermissionsFile(fileName, "", conf); err != nil {
+		t.Fatalf("%s set permissions: %v\n", msg, err)
+	}
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if !bytes.HasPrefix(b, orig) {
+		t.Fatalf("%s: original revision modified\n", msg)
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	defer f.Close()
+
+	conf = pdf.NewDefaultConfiguration()
+	conf.UserPW, conf.OwnerPW = "upw", "opw"
+	ctx, err := ReadContext(f, conf)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if ctx.E.P != int(pdf.PermissionsAll) {
+		t.Fatalf("%s: permissions want:%d got:%d\n", msg, pdf.PermissionsAll, ctx.E.P)
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -118,6 +120,44 @@ func TestPageDimensions(t *testing.T) {
 	}
 }
 
+func TestLazyInfo(t *testing.T) {
+	msg := "TestLazyInfo"
+	for _, fn := range []string{"Acroforms2.pdf", "annotTest.pdf", "testImage.pdf"} {
+		inFile := filepath.Join(inDir, fn)
+
+		want, err := InfoFile(inFile, nil)
+		if err != nil {
+			t.Fatalf("%s %s: %v\n", msg, fn, err)
+		}
+
+		conf := pdf.NewDefaultConfiguration()
+		conf.LazyLoad = true
+		conf.ValidationMode = pdf.ValidationNone
+
+		got, err := InfoFile(inFile, conf)
+		if err != nil {
+			t.Fatalf("%s %s: %v\n", msg, fn, err)
+		}
+
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("%s %s: info mismatch\n%s\n%s\n", msg, fn, strings.Join(want, "\n"), strings.Join(got, "\n"))
+		}
+
+		ctx, err := ReadContextFile(inFile)
+		if err != nil {
+			t.Fatalf("%s %s: %v\n", msg, fn, err)
+		}
+
+		n, err := PageCount(inFile)
+		if err != nil {
+			t.Fatalf("%s %s: %v\n", msg, fn, err)
+		}
+		if n != ctx.PageCount {
+			t.Fatalf("%s %s: pageCount want:%d got:%d\n", msg, fn, ctx.PageCount, n)
+		}
+	}
+}
+
 func TestValidate(t *testing.T) {
 	msg := "TestValidate"
 	inFile := filepath.Join(inDir, "Acroforms2.pdf")
@@ -145,6 +185,115 @@ func TestOptimize(t *testing.T) {
 	if err := OptimizeFile(inFile, "", nil); err != nil {
 		t.Fatalf("%s: %v\n", msg, err)
 	}
+
+	// Create a linearized version of inFile for Fast Web View.
+	conf := pdf.NewDefaultConfiguration()
+	conf.Linearize = true
+	if err := OptimizeFile(inFile, "", conf); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if err := ValidateFile(inFile, nil); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	// Recompress all streams and append a stats line.
+	statsFile := filepath.Join(outDir, "stats.csv")
+	os.Remove(statsFile)
+	conf = pdf.NewDefaultConfiguration()
+	conf.Recompress = true
+	conf.StatsFileName = statsFile
+	outFile = filepath.Join(outDir, "networkProgr.pdf")
+	if err := OptimizeFile(filepath.Join(inDir, "networkProgr.pdf"), outFile, conf); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if err := ValidateFile(outFile, nil); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	fi, err := os.Stat(outFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	b, err := ioutil.ReadFile(statsFile)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if !bytes.Contains(b, []byte(fmt.Sprintf(";%d;FlateDecode:", fi.Size()))) {
+		t.Fatalf("%s: missing recompression stats\n%s", msg, b)
+	}
+
+	// Remove page resources not referenced by any content.
+	conf = pdf.NewDefaultConfiguration()
+	conf.RemoveUnusedResources = true
+	outFile = filepath.Join(outDir, "go.pdf")
+	if err := OptimizeFile(filepath.Join(inDir, "go.pdf"), outFile, conf); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if err := ValidateFile(outFile, nil); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+
+	// Downsample images to 96 dpi and re-encode them as JPEG.
+	conf = pdf.NewDefaultConfiguration()
+	conf.OptimizeImages = true
+	conf.ImageDPI = 96
+	conf.JPEGQuality = 75
+	outFile = filepath.Join(outDir, "testImage.pdf")
+	if err := OptimizeFile(filepath.Join(inDir, "testImage.pdf"), outFile, conf); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if err := ValidateFile(outFile, nil); err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	msg := "TestDeterministic"
+
+	for _, fileName := range []string{"Acroforms2.pdf", "CenterOfWhy.pdf", "testImage.pdf"} {
+		inFile := filepath.Join(inDir, fileName)
+
+		for _, cmd := range []struct {
+			name string
+			f    func(rs io.ReadSeeker, w io.Writer, conf *pdf.Configuration) error
+		}{
+			{"optimize", Optimize},
+			{"rotate", func(rs io.ReadSeeker, w io.Writer, conf *pdf.Configuration) error {
+				return Rotate(rs, w, 90, nil, conf)
+			}},
+			{"stamp", func(rs io.ReadSeeker, w io.Writer, conf *pdf.Configuration) error {
+				wm, err := pdf.ParseWatermarkDetails("Demo", true)
+				if err != nil {
+					return err
+				}
+				return AddWatermarks(rs, w, nil, wm, conf)
+			}},
+		} {
+
+			var want []byte
+
+			for i := 0; i < 3; i++ {
+				f, err := os.Open(inFile)
+				if err != nil {
+					t.Fatalf("%s: %v\n", msg, err)
+				}
+
+				conf := pdf.NewDefaultConfiguration()
+				conf.Deterministic = true
+
+				var buf bytes.Buffer
+				err = cmd.f(f, &buf, conf)
+				f.Close()
+				if err != nil {
+					t.Fatalf("%s %s %s: %v\n", msg, cmd.name, fileName, err)
+				}
+
+				if i > 0 && !bytes.Equal(buf.Bytes(), want) {
+					t.Fatalf("%s %s %s: output not reproducible\n", msg, cmd.name, fileName)
+				}
+				want = buf.Bytes()
+			}
+		}
+	}
 }
 
 func TestTrim(t *testing.T) {
@@ -755,6 +904,176 @@ func TestExtractContentCommand(t *testing.T) {
 	}
 }
 
+func TestExtractPrettyContent(t *testing.T) {
+	msg := "TestExtractPrettyContent"
+
+	// Extract parsed content of page 1 into outDir.
+	conf := pdf.NewDefaultConfiguration()
+	conf.PrettyPrintContent = true
+	for _, fn := range []string{"testImage.pdf", "networkProgr.pdf", "go.pdf"} {
+		inFile := filepath.Join(inDir, fn)
+		if err := ExtractContentFile(inFile, outDir, []string{"1"}, conf); err != nil {
+			t.Fatalf("%s %s: %v\n", msg, inFile, err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(outDir, "1_content.txt"))
+		if err != nil {
+			t.Fatalf("%s %s: %v\n", msg, inFile, err)
+		}
+		if len(b) == 0 {
+			t.Fatalf("%s %s: no operators\n", msg, inFile)
+		}
+	}
+}
+
+func TestExtractTextCommand(t *testing.T) {
+	msg := "TestExtractTextCommand"
+
+	// Extract text and text runs of page 1 into outDir.
+	conf := pdf.NewDefaultConfiguration()
+	conf.TextRunsJSON = true
+	inFile := filepath.Join(inDir, "go.pdf")
+	if err := ExtractTextFile(inFile, outDir, []string{"1"}, conf); err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(outDir, "1_text.txt"))
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+	if !strings.Contains(string(b), "Go Programming Language") {
+		t.Fatalf("%s %s: unexpected text: %s\n", msg, inFile, b)
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(outDir, "1_text.json"))
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+	var page struct {
+		Page int
+		Runs []struct {
+			Text string
+			BBox []float64
+		}
+	}
+	if err = json.Unmarshal(b, &page); err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+	if page.Page != 1 || len(page.Runs) == 0 || len(page.Runs[0].BBox) != 4 {
+		t.Fatalf("%s %s: unexpected text runs: %s\n", msg, inFile, b)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	msg := "TestSearch"
+
+	inFile := filepath.Join(inDir, "go.pdf")
+	f, err := os.Open(inFile)
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+	defer f.Close()
+
+	hits, err := Search(f, "Go", []string{"2"}, nil)
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+	if len(hits) == 0 {
+		t.Fatalf("%s %s: no hits\n", msg, inFile)
+	}
+	for _, h := range hits {
+		if h.Page != 2 || h.Match != "Go" || len(h.Rects) == 0 {
+			t.Fatalf("%s %s: unexpected hit: %+v\n", msg, inFile, h)
+		}
+	}
+
+	// Search with JSON output.
+	conf := pdf.NewDefaultConfiguration()
+	conf.GrepJSON = true
+	list, err := SearchFile(inFile, "(?i)programming language", []string{"1"}, conf)
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("%s %s: want 1 hit, got %d\n", msg, inFile, len(list))
+	}
+	var hit struct {
+		File  string
+		Page  int
+		Rects [][]float64
+	}
+	if err = json.Unmarshal([]byte(list[0]), &hit); err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+	if hit.File != inFile || hit.Page != 1 || len(hit.Rects) != 1 || len(hit.Rects[0]) != 4 {
+		t.Fatalf("%s %s: unexpected hit: %s\n", msg, inFile, list[0])
+	}
+
+	if _, err = SearchFile(inFile, "(", nil, nil); err == nil {
+		t.Fatalf("%s %s: invalid pattern accepted\n", msg, inFile)
+	}
+}
+
+func TestApplyRedactions(t *testing.T) {
+	msg := "TestApplyRedactions"
+
+	// Apply the Redact annotation of the annotation demo.
+	inFile := filepath.Join(outDir, "redactDemo.pdf")
+	xRefTable, err := pdf.CreateAnnotationDemoXRef()
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	createAndValidate(t, xRefTable, inFile, msg)
+
+	outFile := filepath.Join(outDir, "redactDemoOut.pdf")
+	if err = ApplyRedactionsFile(inFile, outFile, nil, nil, nil); err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+
+	ctx, err := ReadContextFile(outFile)
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, outFile, err)
+	}
+	d, _, err := ctx.PageDict(1)
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, outFile, err)
+	}
+	annots, err := ctx.DereferenceArray(d["Annots"])
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, outFile, err)
+	}
+	for _, o := range annots {
+		ad, err := ctx.DereferenceDict(o)
+		if err != nil {
+			t.Fatalf("%s %s: %v\n", msg, outFile, err)
+		}
+		if st := ad.Subtype(); st != nil && *st == "Redact" {
+			t.Fatalf("%s %s: Redact annotation not removed\n", msg, outFile)
+		}
+	}
+
+	// Redact text matches.
+	inFile = filepath.Join(inDir, "go.pdf")
+	f, err := os.Open(inFile)
+	if err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	rp := &pdf.RedactParams{Pattern: `(?i)programming\s+language`}
+	if err = ApplyRedactions(f, &buf, []string{"1-2"}, rp, nil); err != nil {
+		t.Fatalf("%s %s: %v\n", msg, inFile, err)
+	}
+
+	hits, err := Search(bytes.NewReader(buf.Bytes()), rp.Pattern, nil, nil)
+	if err != nil {
+		t.Fatalf("%s: %v\n", msg, err)
+	}
+	if len(hits) != 0 {
+		t.Fatalf("%s: want no hits, got %+v\n", msg, hits)
+	}
+}
+
 func TestExtractPagesCommand(t *testing.T) {
 	msg := "TestExtractPagesCommand"
 
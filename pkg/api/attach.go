@@ -31,8 +31,19 @@ func ListAttachments(rs io.ReadSeeker, conf *pdf.Configuration) ([]string, error
 		conf = pdf.NewDefaultConfiguration()
 	}
 
+	var (
+		ctx                     *pdf.Context
+		durRead, durVal, durOpt float64
+		err                     error
+	)
+
 	fromStart := time.Now()
-	ctx, durRead, durVal, durOpt, err := readValidateAndOptimize(rs, conf, fromStart)
+	if conf.LazyLoad {
+		// Optimization would load all objects.
+		ctx, durRead, durVal, err = readAndValidate(rs, conf, fromStart)
+	} else {
+		ctx, durRead, durVal, durOpt, err = readValidateAndOptimize(rs, conf, fromStart)
+	}
 	if err != nil {
 		return nil, err
 	}
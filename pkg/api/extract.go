@@ -17,14 +17,17 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"time"
 
+	"github.com/pdfcpu/pdfcpu/pkg/content"
 	"github.com/pdfcpu/pdfcpu/pkg/log"
 	pdf "github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
 	"github.com/pkg/errors"
@@ -169,19 +172,11 @@ func doExtractFonts(ctx *pdf.Context, selectedPages pdf.IntSet) error {
 
 				visited[objNr] = true
 
-				fo, err := pdf.ExtractFontData(ctx, objNr)
-				if err != nil {
-					return err
-				}
-
-				if fo == nil {
-					continue
-				}
+				fo := ctx.Optimize.FontObjects[objNr]
 
-				fileName := fmt.Sprintf("%s/%s_%d_%d.%s", ctx.Write.DirName, fo.ResourceNames[0], p, objNr, fo.Extension)
+				fileName := fmt.Sprintf("%s/%s_%d_%d", ctx.Write.DirName, fo.ResourceNames[0], p, objNr)
 
-				err = ioutil.WriteFile(fileName, fo.Data, os.ModePerm)
-				if err != nil {
+				if _, err := pdf.WriteFontData(ctx, fileName, objNr); err != nil {
 					return err
 				}
 
@@ -257,12 +252,10 @@ func writeSinglePagePDF(ctx *pdf.Context, pageNr int, outDir string) error {
 }
 
 func writeSinglePagePDFs(ctx *pdf.Context, selectedPages pdf.IntSet, outDir string) error {
-	for i, v := range selectedPages {
-		if v {
-			err := writeSinglePagePDF(ctx, i, outDir)
-			if err != nil {
-				return err
-			}
+	for _, i := range sortedPages(selectedPages) {
+		err := writeSinglePagePDF(ctx, i, outDir)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -377,6 +370,39 @@ func contentObjNrs(ctx *pdf.Context, page int) ([]int, error) {
 	return objNrs, nil
 }
 
+// writePrettyContent writes the parsed operators of a page, see content.PrettyPrint.
+func writePrettyContent(ctx *pdf.Context, p int) error {
+
+	d, _, err := ctx.PageDict(p)
+	if err != nil || d == nil {
+		return err
+	}
+
+	b, err := ctx.PageContent(d)
+	if err != nil {
+		return err
+	}
+
+	ops, err := content.Parse(b)
+	if err != nil {
+		return errors.Wrapf(err, "page %d", p)
+	}
+
+	fileName := fmt.Sprintf("%s/%d_content.txt", ctx.Write.DirName, p)
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	if err = content.PrettyPrint(f, ops); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
 func doExtractContent(ctx *pdf.Context, selectedPages pdf.IntSet) error {
 
 	visited := pdf.IntSet{}
@@ -387,6 +413,13 @@ func doExtractContent(ctx *pdf.Context, selectedPages pdf.IntSet) error {
 
 			log.Info.Printf("writing content for page %d\n", p)
 
+			if ctx.PrettyPrintContent {
+				if err := writePrettyContent(ctx, p); err != nil {
+					return err
+				}
+				continue
+			}
+
 			objNrs, err := contentObjNrs(ctx, p)
 			if err != nil {
 				return err
@@ -404,19 +437,9 @@ func doExtractContent(ctx *pdf.Context, selectedPages pdf.IntSet) error {
 
 				visited[objNr] = true
 
-				b, err := pdf.ExtractStreamData(ctx, objNr)
-				if err != nil {
-					return err
-				}
-
-				if b == nil {
-					continue
-				}
-
 				fileName := fmt.Sprintf("%s/%d_%d.txt", ctx.Write.DirName, p, objNr)
 
-				err = ioutil.WriteFile(fileName, b, os.ModePerm)
-				if err != nil {
+				if err := pdf.WriteStreamData(ctx, fileName, objNr); err != nil {
 					return err
 				}
 
@@ -479,22 +502,18 @@ func extractMetadataStream(ctx *pdf.Context, obj pdf.Object, objNr int, dt strin
 
 	ir, _ := obj.(pdf.IndirectRef)
 	sObjNr := ir.ObjectNumber.Value()
-	b, err := pdf.ExtractStreamData(ctx, sObjNr)
-	if err != nil {
-		return err
-	}
-
-	if b == nil {
-		return nil
-	}
 
 	fileName := fmt.Sprintf("%s/%d_%s.txt", ctx.Write.DirName, objNr, dt)
 
-	return ioutil.WriteFile(fileName, b, os.ModePerm)
+	return pdf.WriteStreamData(ctx, fileName, sObjNr)
 }
 
 func doExtractMetadata(ctx *pdf.Context, selectedPages pdf.IntSet) error {
 
+	if err := ctx.LoadObjects(); err != nil {
+		return err
+	}
+
 	for k, v := range ctx.XRefTable.Table {
 		if v.Free || v.Compressed {
 			continue
@@ -586,3 +605,113 @@ func ExtractMetadataFile(inFile, outDir string, selectedPages []string, conf *pd
 	log.CLI.Printf("extracting metadata from %s into %s/ ...\n", inFile, outDir)
 	return ExtractMetadata(f, outDir, selectedPages, conf)
 }
+
+// textRun is the JSON representation of a text run.
+type textRun struct {
+	Text string     `json:"text"`
+	Font string     `json:"font"`
+	Size float64    `json:"size"`
+	BBox [4]float64 `json:"bbox"`
+}
+
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+func writeTextRunsJSON(ctx *pdf.Context, pt pdf.PageText) error {
+
+	runs := make([]textRun, len(pt.Runs))
+	for i, r := range pt.Runs {
+		runs[i] = textRun{
+			Text: r.Text,
+			Font: r.Font,
+			Size: round(r.Size),
+			BBox: [4]float64{round(r.BBox.LL.X), round(r.BBox.LL.Y), round(r.BBox.UR.X), round(r.BBox.UR.Y)},
+		}
+	}
+
+	b, err := json.MarshalIndent(struct {
+		Page int       `json:"page"`
+		Runs []textRun `json:"runs"`
+	}{pt.Page, runs}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s/%d_text.json", ctx.Write.DirName, pt.Page)
+
+	return ioutil.WriteFile(fileName, b, os.ModePerm)
+}
+
+func doExtractText(ctx *pdf.Context, selectedPages pdf.IntSet) error {
+
+	pp, err := pdf.ExtractPageText(ctx, sortedPages(selectedPages))
+	if err != nil {
+		return err
+	}
+
+	for _, pt := range pp {
+
+		log.Info.Printf("writing text for page %d\n", pt.Page)
+
+		fileName := fmt.Sprintf("%s/%d_text.txt", ctx.Write.DirName, pt.Page)
+
+		if err = ioutil.WriteFile(fileName, []byte(pt.Text), os.ModePerm); err != nil {
+			return err
+		}
+
+		if ctx.TextRunsJSON {
+			if err = writeTextRunsJSON(ctx, pt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ExtractText writes the text of selected pages of rs into outDir, one file per page.
+func ExtractText(rs io.ReadSeeker, outDir string, selectedPages []string, conf *pdf.Configuration) error {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+
+	fromStart := time.Now()
+	ctx, durRead, durVal, durOpt, err := readValidateAndOptimize(rs, conf, fromStart)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.EnsurePageCount(); err != nil {
+		return err
+	}
+
+	fromWrite := time.Now()
+	pages, err := pagesForPageSelection(ctx.PageCount, selectedPages, true)
+	if err != nil {
+		return err
+	}
+
+	ctx.Write.DirName = outDir
+	if err = doExtractText(ctx, pages); err != nil {
+		return err
+	}
+
+	durWrite := time.Since(fromWrite).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	pdf.TimingStats("write text", durRead, durVal, durOpt, durWrite, durTotal)
+
+	return nil
+}
+
+// ExtractTextFile writes the text of selected pages of inFile into outDir, one file per page.
+func ExtractTextFile(inFile, outDir string, selectedPages []string, conf *pdf.Configuration) error {
+	f, err := os.Open(inFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	log.CLI.Printf("extracting text from %s into %s/ ...\n", inFile, outDir)
+	return ExtractText(f, outDir, selectedPages, conf)
+}
@@ -0,0 +1,115 @@
+/*
+	Copyright 2019 The pdfcpu Authors.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"io"
+	"os"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	pdf "github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pkg/errors"
+)
+
+// Revisions returns all revisions of rs starting with the original document.
+func Revisions(rs io.ReadSeeker, conf *pdf.Configuration) ([]*pdf.Revision, error) {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	return pdf.Revisions(rs, conf)
+}
+
+// ListRevisions returns a list of all revisions of rs including added, changed and deleted objects.
+func ListRevisions(rs io.ReadSeeker, conf *pdf.Configuration) ([]string, error) {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.LISTREVISIONS
+
+	revs, err := pdf.Revisions(rs, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return pdf.RevisionList(revs), nil
+}
+
+// ListRevisionsFile returns a list of all revisions of inFile.
+func ListRevisionsFile(inFile string, conf *pdf.Configuration) ([]string, error) {
+	f, err := os.Open(inFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ListRevisions(f, conf)
+}
+
+// ExtractRevision writes the document read from rs exactly as it was at revision nr to w.
+func ExtractRevision(rs io.ReadSeeker, w io.Writer, nr int, conf *pdf.Configuration) error {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.EXTRACTREVISION
+
+	revs, err := pdf.Revisions(rs, conf)
+	if err != nil {
+		return err
+	}
+
+	if nr < 1 || nr > len(revs) {
+		return errors.Errorf("pdfcpu: extract revision: %d out of range 1-%d", nr, len(revs))
+	}
+
+	if _, err = rs.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(w, rs, revs[nr-1].EOFOffset)
+
+	return err
+}
+
+// ExtractRevisionFile writes inFile exactly as it was at revision nr to outFile.
+func ExtractRevisionFile(inFile, outFile string, nr int, conf *pdf.Configuration) (err error) {
+	var f1, f2 *os.File
+
+	if outFile == "" || outFile == inFile {
+		return errors.New("pdfcpu: extract revision: please provide an outFile different from inFile")
+	}
+
+	if f1, err = os.Open(inFile); err != nil {
+		return err
+	}
+	defer f1.Close()
+
+	log.CLI.Printf("writing %s...\n", outFile)
+
+	if f2, err = os.Create(outFile); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			f2.Close()
+			os.Remove(outFile)
+			return
+		}
+		err = f2.Close()
+	}()
+
+	return ExtractRevision(f1, f2, nr, conf)
+}
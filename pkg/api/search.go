@@ -0,0 +1,131 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	pdf "github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pkg/errors"
+)
+
+// Search returns all matches of the regular expression pattern in the text of the selected pages of rs.
+// Lines of a page are separated by "\n", use (?i) for case insensitive searches.
+func Search(rs io.ReadSeeker, pattern string, selectedPages []string, conf *pdf.Configuration) ([]pdf.SearchHit, error) {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.GREP
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: search")
+	}
+
+	fromStart := time.Now()
+	ctx, durRead, durVal, durOpt, err := readValidateAndOptimize(rs, conf, fromStart)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, err
+	}
+
+	fromSearch := time.Now()
+	// Unlike other commands do not log the selected pages of each file.
+	pages := pdf.IntSet{}
+	for i := 1; i <= ctx.PageCount; i++ {
+		pages[i] = true
+	}
+	if len(selectedPages) > 0 {
+		if pages, err = selectPages(ctx.PageCount, selectedPages); err != nil {
+			return nil, err
+		}
+	}
+
+	hits, err := pdf.SearchText(ctx, re, sortedPages(pages))
+	if err != nil {
+		return nil, err
+	}
+
+	durSearch := time.Since(fromSearch).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	pdf.TimingStats("search", durRead, durVal, durOpt, durSearch, durTotal)
+
+	return hits, nil
+}
+
+// searchHit is the JSON representation of a search hit.
+type searchHit struct {
+	File    string       `json:"file"`
+	Page    int          `json:"page"`
+	Match   string       `json:"match"`
+	Snippet string       `json:"snippet"`
+	Rects   [][4]float64 `json:"rects"`
+}
+
+func searchHitJSON(inFile string, h pdf.SearchHit) (string, error) {
+
+	sh := searchHit{File: inFile, Page: h.Page, Match: h.Match, Snippet: h.Snippet, Rects: [][4]float64{}}
+	for _, r := range h.Rects {
+		sh.Rects = append(sh.Rects, [4]float64{round(r.LL.X), round(r.LL.Y), round(r.UR.X), round(r.UR.Y)})
+	}
+
+	b, err := json.Marshal(sh)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// SearchFile searches the selected pages of inFile and returns one line per hit.
+// A line is either "inFile:page: snippet" or a JSON object including the hit rectangles if conf.GrepJSON is set.
+func SearchFile(inFile, pattern string, selectedPages []string, conf *pdf.Configuration) ([]string, error) {
+	f, err := os.Open(inFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hits, err := Search(f, pattern, selectedPages, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []string
+
+	for _, h := range hits {
+		s := fmt.Sprintf("%s:%d: %s", inFile, h.Page, h.Snippet)
+		if conf != nil && conf.GrepJSON {
+			if s, err = searchHitJSON(inFile, h); err != nil {
+				return nil, err
+			}
+		}
+		list = append(list, s)
+	}
+
+	return list, nil
+}
@@ -201,6 +201,27 @@ func sortedPages(selectedPages pdf.IntSet) []int {
 // selectedPages returns a set of used page numbers.
 // key==page# => key 0 unused!
 func selectedPages(pageCount int, pageSelection []string) (pdf.IntSet, error) {
+	selectedPages, err := selectPages(pageCount, pageSelection)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	for _, i := range sortedPages(selectedPages) {
+		fmt.Fprintf(&b, "%d,", i)
+	}
+
+	s := b.String()
+	if len(s) > 1 {
+		s = s[:len(s)-1]
+	}
+	log.CLI.Printf("pages: %s\n", s)
+
+	return selectedPages, nil
+}
+
+// selectPages returns a set of used page numbers without logging them.
+func selectPages(pageCount int, pageSelection []string) (pdf.IntSet, error) {
 	selectedPages := pdf.IntSet{}
 
 	for _, v := range pageSelection {
@@ -270,17 +291,6 @@ func selectedPages(pageCount int, pageSelection []string) (pdf.IntSet, error) {
 
 	}
 
-	var b strings.Builder
-	for _, i := range sortedPages(selectedPages) {
-		fmt.Fprintf(&b, "%d,", i)
-	}
-
-	s := b.String()
-	if len(s) > 1 {
-		s = s[:len(s)-1]
-	}
-	log.CLI.Printf("pages: %s\n", s)
-
 	return selectedPages, nil
 }
 
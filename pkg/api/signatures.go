@@ -0,0 +1,164 @@
+/*
+	Copyright 2019 The pdfcpu Authors.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	pdf "github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pkg/errors"
+)
+
+// VerifySignatures verifies the signatures of all signature fields of rs.
+// Signer certificates are verified against conf.TrustedCerts or the system's trust store.
+func VerifySignatures(rs io.ReadSeeker, conf *pdf.Configuration) ([]*pdf.SignatureStatus, error) {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.VERIFYSIGNATURES
+
+	fromStart := time.Now()
+	ctx, durRead, durVal, err := readAndValidate(rs, conf, fromStart)
+	if err != nil {
+		return nil, err
+	}
+
+	fromVerify := time.Now()
+	sigs, err := pdf.VerifySignatures(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	durVerify := time.Since(fromVerify).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	pdf.TimingStats("verify signatures", durRead, durVal, 0, durVerify, durTotal)
+
+	return sigs, nil
+}
+
+// VerifySignaturesFile verifies the signatures of inFile and returns a report.
+// If any signature is invalid the report is returned together with an error.
+func VerifySignaturesFile(inFile string, conf *pdf.Configuration) ([]string, error) {
+	f, err := os.Open(inFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sigs, err := VerifySignatures(f, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var invalid int
+	for _, s := range sigs {
+		if !s.Valid() {
+			invalid++
+		}
+	}
+
+	list := pdf.SignatureList(sigs)
+
+	if invalid > 0 {
+		return list, errors.Errorf("pdfcpu: %s: %d of %d signatures invalid", inFile, invalid, len(sigs))
+	}
+
+	return list, nil
+}
+
+// Sign reads a PDF stream from rs, signs it using sp and writes the result to w.
+// The signature gets appended as incremental update which keeps existing signatures valid.
+func Sign(rs io.ReadSeeker, w io.Writer, sp *pdf.SignParams, conf *pdf.Configuration) error {
+	if sp == nil {
+		return errors.New("pdfcpu: missing signing parameters")
+	}
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.SIGN
+
+	fromStart := time.Now()
+	ctx, durRead, durVal, err := readAndValidate(rs, conf, fromStart)
+	if err != nil {
+		return err
+	}
+
+	fromWrite := time.Now()
+	ctx.Write.Writer = bufio.NewWriter(w)
+
+	if err = pdf.Sign(ctx, sp); err != nil {
+		return err
+	}
+
+	durWrite := time.Since(fromWrite).Seconds()
+	durTotal := time.Since(fromStart).Seconds()
+	log.Stats.Printf("XRefTable:\n%s\n", ctx)
+	pdf.TimingStats("sign", durRead, durVal, 0, durWrite, durTotal)
+
+	return nil
+}
+
+// SignFile signs inFile using sp and writes the result to outFile.
+// If outFile is not provided then inFile gets overwritten
+// which leads to the same result as when inFile equals outFile.
+func SignFile(inFile, outFile string, sp *pdf.SignParams, conf *pdf.Configuration) (err error) {
+	var f1, f2 *os.File
+
+	if f1, err = os.Open(inFile); err != nil {
+		return err
+	}
+
+	tmpFile := inFile + ".tmp"
+	if outFile != "" && inFile != outFile {
+		tmpFile = outFile
+		log.CLI.Printf("writing %s...\n", outFile)
+	} else {
+		log.CLI.Printf("writing %s...\n", inFile)
+	}
+
+	if f2, err = os.Create(tmpFile); err != nil {
+		f1.Close()
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			f2.Close()
+			f1.Close()
+			if outFile == "" || inFile == outFile {
+				os.Remove(tmpFile)
+			}
+			return
+		}
+		if err = f2.Close(); err != nil {
+			return
+		}
+		if err = f1.Close(); err != nil {
+			return
+		}
+		if outFile == "" || inFile == outFile {
+			err = os.Rename(tmpFile, inFile)
+		}
+	}()
+
+	return Sign(f1, f2, sp, conf)
+}
@@ -18,7 +18,12 @@ limitations under the License.
 package cli
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
 	pdf "github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
 	"github.com/pkg/errors"
 )
@@ -146,6 +151,40 @@ func ExtractContent(cmd *Command) ([]string, error) {
 	return nil, api.ExtractContentFile(*cmd.InFile, *cmd.OutDir, cmd.PageSelection, cmd.Conf)
 }
 
+// ExtractText writes the text of selected pages of inFile into outDir.
+func ExtractText(cmd *Command) ([]string, error) {
+	return nil, api.ExtractTextFile(*cmd.InFile, *cmd.OutDir, cmd.PageSelection, cmd.Conf)
+}
+
+// Grep searches the selected pages of inFiles for a regular expression and returns one line per hit.
+// Files that cannot be searched are skipped and reported once all files have been searched.
+func Grep(cmd *Command) ([]string, error) {
+	if _, err := regexp.Compile(cmd.Pattern); err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: grep")
+	}
+
+	var out, failed []string
+
+	for _, inFile := range cmd.InFiles {
+		list, err := api.SearchFile(inFile, cmd.Pattern, cmd.PageSelection, cmd.Conf)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", inFile, err))
+			continue
+		}
+		out = append(out, list...)
+	}
+
+	if len(failed) > 0 {
+		// Report the hits before failing.
+		for _, s := range out {
+			log.CLI.Println(s)
+		}
+		return nil, errors.Errorf("pdfcpu: grep: %d of %d files not searched:\n%s", len(failed), len(cmd.InFiles), strings.Join(failed, "\n"))
+	}
+
+	return out, nil
+}
+
 // ExtractMetadata dumps all metadata dict entries for inFile into outDir.
 func ExtractMetadata(cmd *Command) ([]string, error) {
 	return nil, api.ExtractMetadataFile(*cmd.InFile, *cmd.OutDir, cmd.PageSelection, cmd.Conf)
@@ -175,3 +214,36 @@ func ExtractAttachments(cmd *Command) ([]string, error) {
 func Info(cmd *Command) ([]string, error) {
 	return api.InfoFile(*cmd.InFile, cmd.Conf)
 }
+
+// ListRevisions returns a list of all revisions of inFile.
+func ListRevisions(cmd *Command) ([]string, error) {
+	return api.ListRevisionsFile(*cmd.InFile, cmd.Conf)
+}
+
+// ExtractRevision writes inFile as it was at a specific revision to outFile.
+func ExtractRevision(cmd *Command) ([]string, error) {
+	return nil, api.ExtractRevisionFile(*cmd.InFile, *cmd.OutFile, cmd.Revision, cmd.Conf)
+}
+
+// VerifySignatures verifies all signatures of inFile and returns a report.
+func VerifySignatures(cmd *Command) ([]string, error) {
+	out, err := api.VerifySignaturesFile(*cmd.InFile, cmd.Conf)
+	if err != nil && out != nil {
+		// Report the details before failing.
+		for _, s := range out {
+			log.CLI.Println(s)
+		}
+		return nil, err
+	}
+	return out, err
+}
+
+// Sign signs inFile and writes the result to outFile.
+func Sign(cmd *Command) ([]string, error) {
+	return nil, api.SignFile(*cmd.InFile, *cmd.OutFile, cmd.Sign, cmd.Conf)
+}
+
+// Redact applies the redactions of the selected pages of inFile and writes the result to outFile.
+func Redact(cmd *Command) ([]string, error) {
+	return nil, api.ApplyRedactionsFile(*cmd.InFile, *cmd.OutFile, cmd.PageSelection, cmd.Redact, cmd.Conf)
+}
@@ -25,21 +25,25 @@ import (
 
 // Command represents an execution context.
 type Command struct {
-	Mode          pdf.CommandMode    // VALIDATE  OPTIMIZE  SPLIT  MERGE  EXTRACT  TRIM  LISTATT ADDATT REMATT EXTATT  ENCRYPT  DECRYPT  CHANGEUPW  CHANGEOPW LISTP ADDP  WATERMARK  IMPORT  INSERTP REMOVEP ROTATE  NUP
-	InFile        *string            //    *         *        *      -       *      *      *       *       *      *       *        *         *          *       *     *       *         -       *       *       *     -
-	InFiles       []string           //    -         -        -      *       -      -      -       *       *      *       -        -         -          -       -     -       -         *       -       -       -     *
-	InDir         *string            //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -
-	OutFile       *string            //    -         *        -      *       -      *      -       -       -      -       *        *         *          *       -     -       *         *       *       *       -     *
-	OutDir        *string            //    -         -        *      -       *      -      -       -       -      *       -        -         -          -       -     -       -         -       -       -       -     -
-	PageSelection []string           //    -         -        -      -       *      *      -       -       -      -       -        -         -          -       -     -       *         -       *       *       -     *
-	Conf          *pdf.Configuration //    *         *        *      *       *      *      *       *       *      *       *        *         *          *       *     *       *         *       *       *       *     *
-	PWOld         *string            //    -         -        -      -       -      -      -       -       -      -       -        -         *          *       -     -       -         -       -       -       -     -
-	PWNew         *string            //    -         -        -      -       -      -      -       -       -      -       -        -         *          *       -     -       -         -       -       -       -     -
-	Watermark     *pdf.Watermark     //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -
-	Span          int                //    -         -        *      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -
-	Import        *pdf.Import        //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         *       -       -       -     -
-	Rotation      int                //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       *     -
-	NUp           *pdf.NUp           //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     *
+	Mode          pdf.CommandMode    // VALIDATE  OPTIMIZE  SPLIT  MERGE  EXTRACT  TRIM  LISTATT ADDATT REMATT EXTATT  ENCRYPT  DECRYPT  CHANGEUPW  CHANGEOPW LISTP ADDP  WATERMARK  IMPORT  INSERTP REMOVEP ROTATE  NUP  LISTREV  EXTREV  VERIFYSIG  SIGN  GREP  REDACT
+	InFile        *string            //    *         *        *      -       *      *      *       *       *      *       *        *         *          *       *     *       *         -       *       *       *     -      *        *        *        *     -      *
+	InFiles       []string           //    -         -        -      *       -      -      -       *       *      *       -        -         -          -       -     -       -         *       -       -       -     *      -        -        -        -     *      -
+	InDir         *string            //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -      -        -        -        -     -      -
+	OutFile       *string            //    -         *        -      *       -      *      -       -       -      -       *        *         *          *       -     -       *         *       *       *       -     *      -        *        -        *     -      *
+	OutDir        *string            //    -         -        *      -       *      -      -       -       -      *       -        -         -          -       -     -       -         -       -       -       -     -      -        -        -        -     -      -
+	PageSelection []string           //    -         -        -      -       *      *      -       -       -      -       -        -         -          -       -     -       *         -       *       *       -     *      -        -        -        -     *      *
+	Conf          *pdf.Configuration //    *         *        *      *       *      *      *       *       *      *       *        *         *          *       *     *       *         *       *       *       *     *      *        *        *        *     *      *
+	PWOld         *string            //    -         -        -      -       -      -      -       -       -      -       -        -         *          *       -     -       -         -       -       -       -     -      -        -        -        -     -      -
+	PWNew         *string            //    -         -        -      -       -      -      -       -       -      -       -        -         *          *       -     -       -         -       -       -       -     -      -        -        -        -     -      -
+	Watermark     *pdf.Watermark     //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -      -        -        -        -     -      -
+	Span          int                //    -         -        *      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -      -        -        -        -     -      -
+	Import        *pdf.Import        //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         *       -       -       -     -      -        -        -        -     -      -
+	Rotation      int                //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       *     -      -        -        -        -     -      -
+	NUp           *pdf.NUp           //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     *      -        -        -        -     -      -
+	Revision      int                //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -      -        *        -        -     -      -
+	Sign          *pdf.SignParams    //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -      -        -        -        *     -      -
+	Pattern       string             //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -      -        -        -        -     *      -
+	Redact        *pdf.RedactParams  //    -         -        -      -       -      -      -       -       -      -       -        -         -          -       -     -       -         -       -       -       -     -      -        -        -        -     -      *
 	Input         io.ReadSeeker
 	Inputs        []io.ReadSeeker
 	Output        io.Writer
@@ -74,6 +78,13 @@ var cmdMap = map[pdf.CommandMode]func(cmd *Command) ([]string, error){
 	pdf.ROTATE:             Rotate,
 	pdf.NUP:                NUp,
 	pdf.INFO:               Info,
+	pdf.LISTREVISIONS:      processRevisions,
+	pdf.EXTRACTREVISION:    processRevisions,
+	pdf.VERIFYSIGNATURES:   processSignatures,
+	pdf.SIGN:               processSignatures,
+	pdf.EXTRACTTEXT:        ExtractText,
+	pdf.GREP:               Grep,
+	pdf.REDACT:             Redact,
 }
 
 // Process executes a pdfcpu command.
@@ -204,6 +215,20 @@ func ExtractContentCommand(inFile string, outDir string, pageSelection []string,
 		Conf:          conf}
 }
 
+// ExtractTextCommand creates a new command to extract page text.
+func ExtractTextCommand(inFile string, outDir string, pageSelection []string, conf *pdf.Configuration) *Command {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.EXTRACTTEXT
+	return &Command{
+		Mode:          pdf.EXTRACTTEXT,
+		InFile:        &inFile,
+		OutDir:        &outDir,
+		PageSelection: pageSelection,
+		Conf:          conf}
+}
+
 // ExtractMetadataCommand creates a new command to extract metadata streams.
 func ExtractMetadataCommand(inFile string, outDir string, conf *pdf.Configuration) *Command {
 	if conf == nil {
@@ -529,3 +554,110 @@ func InfoCommand(inFile string, conf *pdf.Configuration) *Command {
 		InFile: &inFile,
 		Conf:   conf}
 }
+
+// ListRevisionsCommand creates a new command to list the revisions of inFile.
+func ListRevisionsCommand(inFile string, conf *pdf.Configuration) *Command {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.LISTREVISIONS
+	return &Command{
+		Mode:   pdf.LISTREVISIONS,
+		InFile: &inFile,
+		Conf:   conf}
+}
+
+// ExtractRevisionCommand creates a new command to extract inFile as it was at revision.
+func ExtractRevisionCommand(inFile, outFile string, revision int, conf *pdf.Configuration) *Command {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.EXTRACTREVISION
+	return &Command{
+		Mode:     pdf.EXTRACTREVISION,
+		InFile:   &inFile,
+		OutFile:  &outFile,
+		Revision: revision,
+		Conf:     conf}
+}
+
+func processRevisions(cmd *Command) (out []string, err error) {
+	switch cmd.Mode {
+
+	case pdf.LISTREVISIONS:
+		return ListRevisions(cmd)
+
+	case pdf.EXTRACTREVISION:
+		return ExtractRevision(cmd)
+	}
+
+	return nil, nil
+}
+
+// VerifySignaturesCommand creates a new command to verify the signatures of inFile.
+func VerifySignaturesCommand(inFile string, conf *pdf.Configuration) *Command {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.VERIFYSIGNATURES
+	return &Command{
+		Mode:   pdf.VERIFYSIGNATURES,
+		InFile: &inFile,
+		Conf:   conf}
+}
+
+// SignCommand creates a new command to sign inFile.
+func SignCommand(inFile, outFile string, sp *pdf.SignParams, conf *pdf.Configuration) *Command {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.SIGN
+	return &Command{
+		Mode:    pdf.SIGN,
+		InFile:  &inFile,
+		OutFile: &outFile,
+		Sign:    sp,
+		Conf:    conf}
+}
+
+func processSignatures(cmd *Command) (out []string, err error) {
+	switch cmd.Mode {
+
+	case pdf.VERIFYSIGNATURES:
+		return VerifySignatures(cmd)
+
+	case pdf.SIGN:
+		return Sign(cmd)
+	}
+
+	return nil, nil
+}
+
+// GrepCommand creates a new command to search the text of files for a regular expression.
+func GrepCommand(pattern string, inFiles []string, pageSelection []string, conf *pdf.Configuration) *Command {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.GREP
+	return &Command{
+		Mode:          pdf.GREP,
+		InFiles:       inFiles,
+		PageSelection: pageSelection,
+		Pattern:       pattern,
+		Conf:          conf}
+}
+
+// RedactCommand creates a new command to apply redactions to the selected pages of inFile.
+func RedactCommand(inFile, outFile string, pageSelection []string, rp *pdf.RedactParams, conf *pdf.Configuration) *Command {
+	if conf == nil {
+		conf = pdf.NewDefaultConfiguration()
+	}
+	conf.Cmd = pdf.REDACT
+	return &Command{
+		Mode:          pdf.REDACT,
+		InFile:        &inFile,
+		OutFile:       &outFile,
+		PageSelection: pageSelection,
+		Redact:        rp,
+		Conf:          conf}
+}
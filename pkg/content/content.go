@@ -0,0 +1,291 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package content parses decoded PDF content streams into operations and serializes them back to bytes.
+//
+// See 7.8.2 Content Streams, 8.9.7 Inline Images and Annex A Operator Summary.
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operand represents an operand of a content stream operator.
+type Operand interface {
+	// PDFString returns the content stream syntax of an operand.
+	PDFString() string
+}
+
+// Integer represents an integer operand.
+type Integer int
+
+// PDFString returns the content stream syntax of i.
+func (i Integer) PDFString() string {
+	return strconv.Itoa(int(i))
+}
+
+// Real represents a real operand.
+type Real float64
+
+// PDFString returns the content stream syntax of f.
+func (f Real) PDFString() string {
+	// Content streams do not support exponential notation.
+	s := strconv.FormatFloat(float64(f), 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		// Keep the operand type.
+		s += ".0"
+	}
+	return s
+}
+
+// Boolean represents a boolean operand.
+type Boolean bool
+
+// PDFString returns the content stream syntax of b.
+func (b Boolean) PDFString() string {
+	return strconv.FormatBool(bool(b))
+}
+
+// Null represents the null operand.
+type Null struct{}
+
+// PDFString returns the content stream syntax of null.
+func (Null) PDFString() string {
+	return "null"
+}
+
+// Name represents a name operand without its leading slash and with #xx escape sequences resolved.
+type Name string
+
+// PDFString returns the content stream syntax of n.
+func (n Name) PDFString() string {
+
+	var sb strings.Builder
+	sb.WriteByte('/')
+
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c < '!' || c > '~' || c == '#' || delimiter(c) {
+			fmt.Fprintf(&sb, "#%02X", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+
+	return sb.String()
+}
+
+// LiteralString represents a string operand written as literal string, escape sequences are resolved.
+type LiteralString string
+
+// PDFString returns the content stream syntax of s.
+func (s LiteralString) PDFString() string {
+
+	var sb strings.Builder
+	sb.WriteByte('(')
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', ')', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+// HexString represents a string operand written as hexadecimal string, holding the decoded bytes.
+type HexString string
+
+// PDFString returns the content stream syntax of s.
+func (s HexString) PDFString() string {
+	return fmt.Sprintf("<%X>", string(s))
+}
+
+// Array represents an array operand.
+type Array []Operand
+
+// PDFString returns the content stream syntax of a.
+func (a Array) PDFString() string {
+
+	ss := make([]string, len(a))
+	for i, o := range a {
+		ss[i] = o.PDFString()
+	}
+
+	return "[" + strings.Join(ss, " ") + "]"
+}
+
+// Dict represents a dict operand, eg. the property list of a marked content operator.
+type Dict map[string]Operand
+
+func (d Dict) sortedKeys() []string {
+
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (d Dict) entries() string {
+
+	ss := make([]string, 0, len(d))
+	for _, k := range d.sortedKeys() {
+		ss = append(ss, Name(k).PDFString()+" "+d[k].PDFString())
+	}
+
+	return strings.Join(ss, " ")
+}
+
+// PDFString returns the content stream syntax of d.
+func (d Dict) PDFString() string {
+	return "<<" + d.entries() + ">>"
+}
+
+// InlineImage is the sole operand of a BI operation
+// representing the inline image dict and data enclosed by the operators BI, ID and EI.
+type InlineImage struct {
+	Dict Dict
+	Data []byte
+}
+
+// PDFString returns the content stream syntax of an inline image excluding the BI operator.
+func (im InlineImage) PDFString() string {
+	return im.Dict.entries() + " ID " + string(im.Data) + "\nEI"
+}
+
+// Numbers returns the values of numeric operands.
+func Numbers(operands []Operand) ([]float64, bool) {
+
+	f := make([]float64, len(operands))
+
+	for i, o := range operands {
+		switch o := o.(type) {
+		case Integer:
+			f[i] = float64(o)
+		case Real:
+			f[i] = float64(o)
+		default:
+			return nil, false
+		}
+	}
+
+	return f, true
+}
+
+// Operation represents an operator along with its operands.
+type Operation struct {
+	Operator string
+	Operands []Operand
+}
+
+// InlineImage returns the inline image of a BI operation.
+func (op Operation) InlineImage() *InlineImage {
+
+	if op.Operator != "BI" || len(op.Operands) != 1 {
+		return nil
+	}
+
+	im, ok := op.Operands[0].(InlineImage)
+	if !ok {
+		return nil
+	}
+
+	return &im
+}
+
+// String returns the content stream syntax of op.
+func (op Operation) String() string {
+
+	if im := op.InlineImage(); im != nil {
+		return "BI " + im.PDFString()
+	}
+
+	var sb strings.Builder
+
+	for _, o := range op.Operands {
+		sb.WriteString(o.PDFString())
+		sb.WriteByte(' ')
+	}
+
+	sb.WriteString(op.Operator)
+
+	return sb.String()
+}
+
+// Bytes serializes ops into a content stream, one operation per line.
+func Bytes(ops []Operation) []byte {
+
+	var buf bytes.Buffer
+
+	for _, op := range ops {
+		buf.WriteString(op.String())
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// Operators opening and closing nested sections of a content stream.
+var (
+	sectionBegin = map[string]bool{"q": true, "BT": true, "BMC": true, "BDC": true, "BX": true}
+	sectionEnd   = map[string]bool{"Q": true, "ET": true, "EMC": true, "EX": true}
+)
+
+// PrettyPrint writes ops to w in a human readable form, one operation per line.
+// Graphics state, text object, marked content and compatibility sections are indented
+// and inline image data is summarized.
+func PrettyPrint(w io.Writer, ops []Operation) error {
+
+	depth := 0
+
+	for _, op := range ops {
+
+		if sectionEnd[op.Operator] && depth > 0 {
+			depth--
+		}
+
+		s := op.String()
+		if im := op.InlineImage(); im != nil {
+			s = fmt.Sprintf("BI %s ID <%d bytes> EI", im.Dict.entries(), len(im.Data))
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth), s); err != nil {
+			return err
+		}
+
+		if sectionBegin[op.Operator] {
+			depth++
+		}
+	}
+
+	return nil
+}
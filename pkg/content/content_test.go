@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package content
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testContent = `q 1 0 0 1 10 20 cm BT /F1 12 Tf [(a]b) -20.5 (c\)d\101)] TJ ET
+BI /W 2 /H 1 /BPC 8 /CS /G ID ab
+EI
+BI /W 4 /H 4 /F /AHx ID 00ff 00EI> EI
+/Span <</MCID 0 /Alt (x(y)z) /A [1 [true null]]>> BDC <414 24> Tj EMC % comment Do
+/Na#20me#23 gs 200 0 0 100 0 0 cm /Im1 Do Q`
+
+func TestParse(t *testing.T) {
+
+	ops, err := Parse([]byte(testContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, op := range ops {
+		got = append(got, op.Operator)
+	}
+
+	want := []string{"q", "cm", "BT", "Tf", "TJ", "ET", "BI", "BI", "BDC", "Tj", "EMC", "gs", "cm", "Do", "Q"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want:%v got:%v", want, got)
+	}
+
+	tj := Array{LiteralString("a]b"), Real(-20.5), LiteralString("c)dA")}
+	if !reflect.DeepEqual(ops[4].Operands, []Operand{tj}) {
+		t.Fatalf("TJ: got %v", ops[4].Operands)
+	}
+
+	if im := ops[6].InlineImage(); im == nil || string(im.Data) != "ab" || im.Dict["CS"] != Name("G") {
+		t.Fatalf("inline image: got %v", ops[6].Operands)
+	}
+
+	// Filtered image data is terminated by the first EI surrounded by whitespace.
+	if im := ops[7].InlineImage(); im == nil || string(im.Data) != "00ff 00EI>" {
+		t.Fatalf("filtered inline image: got %v", ops[7].Operands)
+	}
+
+	d := Dict{"MCID": Integer(0), "Alt": LiteralString("x(y)z"), "A": Array{Integer(1), Array{Boolean(true), Null{}}}}
+	if !reflect.DeepEqual(ops[8].Operands, []Operand{Name("Span"), d}) {
+		t.Fatalf("BDC: got %v", ops[8].Operands)
+	}
+
+	if ops[9].Operands[0] != HexString("AB@") {
+		t.Fatalf("Tj: got %v", ops[9].Operands)
+	}
+
+	if ops[11].Operands[0] != Name("Na me#") {
+		t.Fatalf("gs: got %v", ops[11].Operands)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	ops, err := Parse([]byte(testContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := Bytes(ops)
+
+	ops1, err := Parse(b)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, b)
+	}
+
+	if !reflect.DeepEqual(ops, ops1) {
+		t.Fatalf("round trip mismatch:\n%s", b)
+	}
+
+	if b1 := Bytes(ops1); !bytes.Equal(b, b1) {
+		t.Fatalf("serialization not stable:\n%s\n%s", b, b1)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+
+	for _, s := range []string{
+		"(abc Tj",
+		"[1 2 re",
+		"<<MCID 0>> BDC",
+		"<4G> Tj",
+		"/Span <</MCID>> BDC",
+		"1 0 0",
+		"BI /W 1 /H 1 /F /Fl ID abc",
+		") Tj",
+	} {
+		if _, err := Parse([]byte(s)); err == nil {
+			t.Fatalf("%q: expected error", s)
+		}
+	}
+}
+
+func TestPrettyPrint(t *testing.T) {
+
+	ops, err := Parse([]byte(testContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	if err = PrettyPrint(&sb, ops); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != len(ops) {
+		t.Fatalf("want %d lines, got:\n%s", len(ops), sb.String())
+	}
+
+	for i, want := range map[int]string{
+		0:  "q",
+		3:  "    /F1 12 Tf",
+		6:  "  BI /BPC 8 /CS /G /H 1 /W 2 ID <2 bytes> EI",
+		9:  "    <414240> Tj",
+		14: "Q",
+	} {
+		if lines[i] != want {
+			t.Fatalf("line %d: want:%q got:%q", i, want, lines[i])
+		}
+	}
+}
@@ -0,0 +1,526 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package content
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+func whitespace(c byte) bool {
+	return c == 0x00 || c == 0x09 || c == 0x0A || c == 0x0C || c == 0x0D || c == 0x20
+}
+
+func delimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func regular(c byte) bool {
+	return !whitespace(c) && !delimiter(c)
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// parser tokenizes a decoded content stream.
+type parser struct {
+	b   []byte
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("pdfcpu: content: offset %d: "+format, append([]interface{}{p.pos}, args...)...)
+}
+
+// skipWhitespace skips whitespace and comments.
+func (p *parser) skipWhitespace() {
+
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		if c == '%' {
+			for p.pos < len(p.b) && p.b[p.pos] != 0x0A && p.b[p.pos] != 0x0D {
+				p.pos++
+			}
+			continue
+		}
+		if !whitespace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+// keyword returns the sequence of regular characters at the current position.
+func (p *parser) keyword() string {
+
+	i := p.pos
+	for p.pos < len(p.b) && regular(p.b[p.pos]) {
+		p.pos++
+	}
+
+	return string(p.b[i:p.pos])
+}
+
+func (p *parser) parseName() (Name, error) {
+
+	// Skip '/'.
+	p.pos++
+
+	s := p.keyword()
+	if bytes.IndexByte([]byte(s), '#') < 0 {
+		return Name(s), nil
+	}
+
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '#' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", p.errorf("corrupt name: %s", s)
+		}
+		h, ok1 := hexValue(s[i+1])
+		l, ok2 := hexValue(s[i+2])
+		if !ok1 || !ok2 {
+			return "", p.errorf("corrupt name: %s", s)
+		}
+		b = append(b, h<<4|l)
+		i += 2
+	}
+
+	return Name(b), nil
+}
+
+func (p *parser) parseLiteralString() (LiteralString, error) {
+
+	// Skip '('.
+	p.pos++
+
+	var b []byte
+	depth := 1
+
+	for p.pos < len(p.b) {
+
+		c := p.b[p.pos]
+		p.pos++
+
+		switch c {
+
+		case '(':
+			depth++
+
+		case ')':
+			depth--
+			if depth == 0 {
+				return LiteralString(b), nil
+			}
+
+		case 0x0D:
+			// An unescaped end-of-line marker is treated as line feed.
+			if p.pos < len(p.b) && p.b[p.pos] == 0x0A {
+				p.pos++
+			}
+			c = 0x0A
+
+		case '\\':
+			if p.pos == len(p.b) {
+				continue
+			}
+			c = p.b[p.pos]
+			p.pos++
+
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case 0x0D, 0x0A:
+				// Line continuation.
+				if c == 0x0D && p.pos < len(p.b) && p.b[p.pos] == 0x0A {
+					p.pos++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := c - '0'
+					for i := 0; i < 2 && p.pos < len(p.b) && p.b[p.pos] >= '0' && p.b[p.pos] <= '7'; i++ {
+						v = v<<3 | (p.b[p.pos] - '0')
+						p.pos++
+					}
+					c = v
+				}
+			}
+		}
+
+		b = append(b, c)
+	}
+
+	return "", p.errorf("unterminated literal string")
+}
+
+func (p *parser) parseHexString() (HexString, error) {
+
+	// Skip '<'.
+	p.pos++
+
+	var b []byte
+	var v byte
+	odd := false
+
+	for p.pos < len(p.b) {
+
+		c := p.b[p.pos]
+		p.pos++
+
+		if c == '>' {
+			if odd {
+				b = append(b, v<<4)
+			}
+			return HexString(b), nil
+		}
+
+		if whitespace(c) {
+			continue
+		}
+
+		h, ok := hexValue(c)
+		if !ok {
+			return "", p.errorf("corrupt hex string")
+		}
+
+		if odd {
+			b = append(b, v<<4|h)
+		} else {
+			v = h
+		}
+		odd = !odd
+	}
+
+	return "", p.errorf("unterminated hex string")
+}
+
+func (p *parser) parseArray() (Array, error) {
+
+	// Skip '['.
+	p.pos++
+
+	a := Array{}
+
+	for {
+		p.skipWhitespace()
+		if p.pos == len(p.b) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.b[p.pos] == ']' {
+			p.pos++
+			return a, nil
+		}
+		o, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if o == nil {
+			return nil, p.errorf("unexpected operator in array: %s", p.keyword())
+		}
+		a = append(a, o)
+	}
+}
+
+// parseDictEntries parses name/value pairs up to ">>" or, for inline images, up to the keyword ID.
+func (p *parser) parseDictEntries(inlineImage bool) (Dict, error) {
+
+	d := Dict{}
+
+	for {
+		p.skipWhitespace()
+		if p.pos == len(p.b) {
+			return nil, p.errorf("unterminated dict")
+		}
+
+		if inlineImage {
+			if regular(p.b[p.pos]) {
+				if kw := p.keyword(); kw != "ID" {
+					return nil, p.errorf("unexpected keyword in inline image dict: %s", kw)
+				}
+				return d, nil
+			}
+		} else if bytes.HasPrefix(p.b[p.pos:], []byte(">>")) {
+			p.pos += 2
+			return d, nil
+		}
+
+		if p.b[p.pos] != '/' {
+			return nil, p.errorf("dict key must be a name")
+		}
+		k, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipWhitespace()
+		if p.pos == len(p.b) {
+			return nil, p.errorf("unterminated dict")
+		}
+		v, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, p.errorf("unexpected operator in dict: %s", p.keyword())
+		}
+
+		d[string(k)] = v
+	}
+}
+
+func (p *parser) parseNumber(s string) (Operand, error) {
+
+	if bytes.IndexByte([]byte(s), '.') < 0 {
+		if i, err := strconv.Atoi(s); err == nil {
+			return Integer(i), nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, p.errorf("corrupt number: %s", s)
+	}
+
+	return Real(f), nil
+}
+
+// parseOperand parses the operand at the current position.
+func (p *parser) parseOperand() (Operand, error) {
+
+	switch c := p.b[p.pos]; c {
+
+	case '/':
+		return p.parseName()
+
+	case '(':
+		return p.parseLiteralString()
+
+	case '[':
+		return p.parseArray()
+
+	case '<':
+		if bytes.HasPrefix(p.b[p.pos:], []byte("<<")) {
+			p.pos += 2
+			return p.parseDictEntries(false)
+		}
+		return p.parseHexString()
+	}
+
+	if !regular(p.b[p.pos]) {
+		return nil, p.errorf("unexpected delimiter: %c", p.b[p.pos])
+	}
+
+	i := p.pos
+	s := p.keyword()
+
+	switch s {
+	case "true":
+		return Boolean(true), nil
+	case "false":
+		return Boolean(false), nil
+	case "null":
+		return Null{}, nil
+	}
+
+	if c := s[0]; c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.' {
+		return p.parseNumber(s)
+	}
+
+	// Not an operand but an operator.
+	p.pos = i
+	return nil, nil
+}
+
+func intEntry(d Dict, keys ...string) (int, bool) {
+	for _, k := range keys {
+		if i, ok := d[k].(Integer); ok {
+			return int(i), true
+		}
+	}
+	return 0, false
+}
+
+func entry(d Dict, keys ...string) Operand {
+	for _, k := range keys {
+		if o, ok := d[k]; ok {
+			return o
+		}
+	}
+	return nil
+}
+
+// inlineImageDataLength returns the length of the image data of an inline image if it can be derived from its dict.
+func inlineImageDataLength(d Dict) (int, bool) {
+
+	if l, ok := intEntry(d, "L", "Length"); ok {
+		return l, true
+	}
+
+	if entry(d, "F", "Filter") != nil {
+		return 0, false
+	}
+
+	w, ok1 := intEntry(d, "W", "Width")
+	h, ok2 := intEntry(d, "H", "Height")
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+
+	bpc, comps := 1, 1
+
+	if im, ok := entry(d, "IM", "ImageMask").(Boolean); !ok || !bool(im) {
+
+		if bpc, ok = intEntry(d, "BPC", "BitsPerComponent"); !ok {
+			return 0, false
+		}
+
+		cs := entry(d, "CS", "ColorSpace")
+		if a, ok := cs.(Array); ok && len(a) > 0 {
+			cs = a[0]
+		}
+
+		switch cs {
+		case Name("G"), Name("DeviceGray"), Name("I"), Name("Indexed"):
+			comps = 1
+		case Name("RGB"), Name("DeviceRGB"):
+			comps = 3
+		case Name("CMYK"), Name("DeviceCMYK"):
+			comps = 4
+		default:
+			// Color spaces referring to page resources.
+			return 0, false
+		}
+	}
+
+	return (w*comps*bpc + 7) / 8 * h, true
+}
+
+// endOfInlineImage reports whether the keyword EI follows at position i.
+func (p *parser) endOfInlineImage(i int) bool {
+	return bytes.HasPrefix(p.b[i:], []byte("EI")) && (i+2 == len(p.b) || !regular(p.b[i+2]))
+}
+
+func (p *parser) parseInlineImage() (InlineImage, error) {
+
+	d, err := p.parseDictEntries(true)
+	if err != nil {
+		return InlineImage{}, err
+	}
+
+	// A single whitespace character follows ID.
+	if p.pos < len(p.b) && whitespace(p.b[p.pos]) {
+		p.pos++
+	}
+
+	start := p.pos
+
+	if l, ok := inlineImageDataLength(d); ok && start+l <= len(p.b) {
+		p.pos = start + l
+		p.skipWhitespace()
+		if p.pos < len(p.b) && p.endOfInlineImage(p.pos) {
+			data := p.b[start : start+l]
+			p.pos += 2
+			return InlineImage{Dict: d, Data: data}, nil
+		}
+	}
+
+	// Search for EI preceded by whitespace.
+	for i := start; i < len(p.b); i++ {
+		if (i == start || whitespace(p.b[i-1])) && p.endOfInlineImage(i) {
+			end := i
+			if end > start {
+				end--
+			}
+			p.pos = i + 2
+			return InlineImage{Dict: d, Data: p.b[start:end]}, nil
+		}
+	}
+
+	p.pos = start
+	return InlineImage{}, p.errorf("unterminated inline image")
+}
+
+// Parse parses a decoded content stream into a list of operations.
+func Parse(b []byte) ([]Operation, error) {
+
+	p := &parser{b: b}
+
+	var ops []Operation
+	var operands []Operand
+
+	for {
+		p.skipWhitespace()
+		if p.pos == len(p.b) {
+			break
+		}
+
+		o, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		if o != nil {
+			operands = append(operands, o)
+			continue
+		}
+
+		op := Operation{Operator: p.keyword(), Operands: operands}
+		operands = nil
+
+		if op.Operator == "BI" {
+			if len(op.Operands) > 0 {
+				return nil, p.errorf("unexpected operands for BI")
+			}
+			im, err := p.parseInlineImage()
+			if err != nil {
+				return nil, err
+			}
+			op.Operands = []Operand{im}
+		}
+
+		ops = append(ops, op)
+	}
+
+	if len(operands) > 0 {
+		return nil, p.errorf("missing operator for %d trailing operands", len(operands))
+	}
+
+	return ops, nil
+}
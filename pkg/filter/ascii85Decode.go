@@ -17,10 +17,9 @@ limitations under the License.
 package filter
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/ascii85"
 	"io"
-	"io/ioutil"
 
 	"github.com/pkg/errors"
 )
@@ -32,45 +31,68 @@ type ascii85Decode struct {
 const eodASCII85 = "~>"
 
 // Encode implements encoding for an ASCII85Decode filter.
-func (f ascii85Decode) Encode(r io.Reader) (*bytes.Buffer, error) {
+func (f ascii85Decode) Encode(r io.Reader, w io.Writer) error {
 
-	p, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
+	encoder := ascii85.NewEncoder(w)
+
+	if _, err := io.Copy(encoder, r); err != nil {
+		return err
 	}
 
-	buf := &bytes.Buffer{}
-	encoder := ascii85.NewEncoder(buf)
-	encoder.Write(p)
-	encoder.Close()
+	if err := encoder.Close(); err != nil {
+		return err
+	}
 
 	// Add eod sequence
-	buf.WriteString(eodASCII85)
+	_, err := io.WriteString(w, eodASCII85)
 
-	return buf, nil
+	return err
 }
 
 // Decode implements decoding for an ASCII85Decode filter.
-func (f ascii85Decode) Decode(r io.Reader) (*bytes.Buffer, error) {
+func (f ascii85Decode) Decode(r io.Reader, w io.Writer) error {
 
-	p, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
-	}
+	decoder := ascii85.NewDecoder(&ascii85EODReader{r: bufio.NewReader(r)})
 
-	if !bytes.HasSuffix(p, []byte(eodASCII85)) {
-		return nil, errors.New("pdfcpu: Decode: missing eod marker")
-	}
+	_, err := io.Copy(w, decoder)
 
-	// Strip eod sequence: "~>"
-	p = p[:len(p)-2]
+	return err
+}
+
+// ascii85EODReader reads up to the eod sequence "~>".
+type ascii85EODReader struct {
+	r   *bufio.Reader
+	eod bool
+}
 
-	decoder := ascii85.NewDecoder(bytes.NewReader(p))
+func (er *ascii85EODReader) Read(p []byte) (int, error) {
+
+	n := 0
+
+	for n < len(p) && !er.eod {
+
+		c, err := er.r.ReadByte()
+		if err == io.EOF {
+			return n, errors.New("pdfcpu: Decode: missing eod marker")
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if c == eodASCII85[0] {
+			if next, err := er.r.Peek(1); err == nil && next[0] == eodASCII85[1] {
+				er.eod = true
+				break
+			}
+		}
+
+		p[n] = c
+		n++
+	}
 
-	buf, err := ioutil.ReadAll(decoder)
-	if err != nil {
-		return nil, err
+	if er.eod && n == 0 {
+		return 0, io.EOF
 	}
 
-	return bytes.NewBuffer(buf), nil
+	return n, nil
 }
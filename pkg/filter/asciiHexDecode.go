@@ -17,10 +17,10 @@ limitations under the License.
 package filter
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/hex"
 	"io"
-	"io/ioutil"
 )
 
 type asciiHexDecode struct {
@@ -30,53 +30,67 @@ type asciiHexDecode struct {
 const eodHexDecode = '>'
 
 // Encode implements encoding for an ASCIIHexDecode filter.
-func (f asciiHexDecode) Encode(r io.Reader) (*bytes.Buffer, error) {
+func (f asciiHexDecode) Encode(r io.Reader, w io.Writer) error {
 
-	bb, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
+	if _, err := io.Copy(hex.NewEncoder(w), r); err != nil {
+		return err
 	}
 
-	dst := make([]byte, hex.EncodedLen(len(bb)))
-	hex.Encode(dst, bb)
-
 	// eod marker
-	dst = append(dst, eodHexDecode)
+	_, err := w.Write([]byte{eodHexDecode})
 
-	return bytes.NewBuffer(dst), nil
+	return err
 }
 
 // Decode implements decoding for an ASCIIHexDecode filter.
-func (f asciiHexDecode) Decode(r io.Reader) (*bytes.Buffer, error) {
+func (f asciiHexDecode) Decode(r io.Reader, w io.Writer) error {
 
-	bb, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
-	}
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
 
-	var p []byte
+	// The high nibble of the current byte or -1.
+	hi := -1
 
-	// Remove any white space and cut off on eod
-	for i := 0; i < len(bb); i++ {
-		if bb[i] == eodHexDecode {
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF || c == eodHexDecode {
+			// Cut off on eod
 			break
 		}
-		if !bytes.ContainsRune([]byte{0x09, 0x0A, 0x0C, 0x0D, 0x20}, rune(bb[i])) {
-			p = append(p, bb[i])
+		if err != nil {
+			return err
 		}
-	}
 
-	// if len == odd add "0"
-	if len(p)%2 == 1 {
-		p = append(p, '0')
-	}
+		// Skip white space
+		if bytes.IndexByte([]byte{0x09, 0x0A, 0x0C, 0x0D, 0x20}, c) >= 0 {
+			continue
+		}
 
-	dst := make([]byte, hex.DecodedLen(len(p)))
+		var v int
+		switch {
+		case '0' <= c && c <= '9':
+			v = int(c - '0')
+		case 'a' <= c && c <= 'f':
+			v = int(c-'a') + 10
+		case 'A' <= c && c <= 'F':
+			v = int(c-'A') + 10
+		default:
+			return hex.InvalidByteError(c)
+		}
+
+		if hi < 0 {
+			hi = v
+			continue
+		}
 
-	_, err = hex.Decode(dst, p)
-	if err != nil {
-		return nil, err
+		bw.WriteByte(byte(hi<<4 | v))
+		hi = -1
+	}
+
+	// if len == odd add "0"
+	if hi >= 0 {
+		bw.WriteByte(byte(hi << 4))
 	}
 
-	return bytes.NewBuffer(dst), nil
+	return bw.Flush()
 }
@@ -0,0 +1,572 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// This is a CCITT codec for bilevel images as described in ITU-T Recommendations T.4 and T.6.
+// It covers Group 3 one-dimensional (K=0), Group 3 two-dimensional (K>0) and Group 4 (K<0) coding.
+//
+// Decoding Group 4 is left to golang.org/x/image/ccitt which does not support K>0.
+// Encoding is not supported by golang.org/x/image/ccitt at all.
+
+const (
+	ccittWhite = 0
+	ccittBlack = 1
+)
+
+const ccittMaxCodeLength = 13
+
+var (
+	errCCITTEOD         = errors.New("pdfcpu: ccitt: unexpected end of data")
+	errCCITTInvalidCode = errors.New("pdfcpu: ccitt: invalid code")
+)
+
+// ccittDecodeTable maps bit length and code bits to a code value.
+type ccittDecodeTable map[uint32]uint32
+
+func newCCITTDecodeTable(codes []ccittCode) ccittDecodeTable {
+	t := ccittDecodeTable{}
+	for _, c := range codes {
+		t[ccittKey(len(c.str), bitsFor(c.str))] = c.val
+	}
+	return t
+}
+
+func ccittKey(nBits int, bits uint32) uint32 {
+	return uint32(nBits)<<16 | bits
+}
+
+func bitsFor(s string) uint32 {
+	var bits uint32
+	for _, c := range s {
+		bits <<= 1
+		if c == '1' {
+			bits |= 1
+		}
+	}
+	return bits
+}
+
+// ccittBitString is a variable length bit code.
+type ccittBitString struct {
+	bits  uint32
+	nBits int
+}
+
+// ccittEncodeTable maps code values to bit strings.
+type ccittEncodeTable map[uint32]ccittBitString
+
+func newCCITTEncodeTable(codes []ccittCode) ccittEncodeTable {
+	t := ccittEncodeTable{}
+	for _, c := range codes {
+		t[c.val] = ccittBitString{bitsFor(c.str), len(c.str)}
+	}
+	return t
+}
+
+var (
+	ccittModeDecodeTable  = newCCITTDecodeTable(ccittModeCodes)
+	ccittWhiteDecodeTable = newCCITTDecodeTable(ccittWhiteCodes)
+	ccittBlackDecodeTable = newCCITTDecodeTable(ccittBlackCodes)
+
+	ccittModeEncodeTable  = newCCITTEncodeTable(ccittModeCodes)
+	ccittWhiteEncodeTable = newCCITTEncodeTable(ccittWhiteCodes)
+	ccittBlackEncodeTable = newCCITTEncodeTable(ccittBlackCodes)
+)
+
+// ccittVerticalModes maps vertical modes to their a1b1 distance.
+var ccittVerticalModes = map[uint32]int{
+	ccittModeV0:  0,
+	ccittModeVR1: 1,
+	ccittModeVR2: 2,
+	ccittModeVR3: 3,
+	ccittModeVL1: -1,
+	ccittModeVL2: -2,
+	ccittModeVL3: -3,
+}
+
+// findChange returns the position of the first changing element at or after from.
+// The imaginary element left of the first element is white.
+func findChange(line []byte, from int) int {
+	for i := from; i < len(line); i++ {
+		prev := byte(ccittWhite)
+		if i > 0 {
+			prev = line[i-1]
+		}
+		if line[i] != prev {
+			return i
+		}
+	}
+	return len(line)
+}
+
+// findB1B2 returns the changing elements b1 and b2 of the reference line for reference element a0 of given color.
+func findB1B2(ref []byte, a0 int, color byte) (int, int) {
+	b1 := findChange(ref, a0+1)
+	if b1 < len(ref) && ref[b1] == color {
+		b1 = findChange(ref, b1+1)
+	}
+	return b1, findChange(ref, b1+1)
+}
+
+func fill(line []byte, from, to int, color byte) {
+	for i := from; i < to; i++ {
+		line[i] = color
+	}
+}
+
+type ccittBitReader struct {
+	p   []byte
+	pos int // bit position
+}
+
+func (br *ccittBitReader) eod() bool {
+	return br.pos >= len(br.p)*8
+}
+
+// peek returns the next n bits. Bits beyond the end of data are 0.
+func (br *ccittBitReader) peek(n int) uint32 {
+	var bits uint32
+	for i := br.pos; i < br.pos+n; i++ {
+		bits <<= 1
+		if i/8 < len(br.p) && br.p[i/8]&(0x80>>uint(i%8)) > 0 {
+			bits |= 1
+		}
+	}
+	return bits
+}
+
+func (br *ccittBitReader) skip(n int) {
+	br.pos += n
+}
+
+func (br *ccittBitReader) align() {
+	br.pos = (br.pos + 7) &^ 7
+}
+
+func (br *ccittBitReader) decode(t ccittDecodeTable) (uint32, error) {
+	for n := 1; n <= ccittMaxCodeLength; n++ {
+		if br.pos+n > len(br.p)*8 {
+			return 0, errCCITTEOD
+		}
+		if v, ok := t[ccittKey(n, br.peek(n))]; ok {
+			br.skip(n)
+			return v, nil
+		}
+	}
+	return 0, errCCITTInvalidCode
+}
+
+type ccittBitWriter struct {
+	bytes.Buffer
+	cur   byte
+	nBits int // bits used in cur
+}
+
+func (bw *ccittBitWriter) write(bs ccittBitString) {
+	for i := bs.nBits - 1; i >= 0; i-- {
+		bw.cur <<= 1
+		bw.cur |= byte(bs.bits>>uint(i)) & 1
+		bw.nBits++
+		if bw.nBits == 8 {
+			bw.WriteByte(bw.cur)
+			bw.cur, bw.nBits = 0, 0
+		}
+	}
+}
+
+// align pads with 0 bits up to the next byte boundary.
+func (bw *ccittBitWriter) align() {
+	if bw.nBits > 0 {
+		bw.write(ccittBitString{0, 8 - bw.nBits})
+	}
+}
+
+func (bw *ccittBitWriter) flush() []byte {
+	bw.align()
+	return bw.Bytes()
+}
+
+// ccittParms represents the CCITTFaxDecode filter parameters relevant for coding.
+type ccittParms struct {
+	k         int
+	columns   int
+	rows      int // 0 means unknown.
+	eol       bool
+	byteAlign bool
+	eob       bool
+	blackIs1  bool
+}
+
+type ccittDecoder struct {
+	ccittParms
+	br       ccittBitReader
+	ref, cur []byte // one byte per pixel
+}
+
+// startRow consumes fill bits, alignment and EOLs in front of a row.
+// It returns true at the end of data including RTC and EOFB.
+func (d *ccittDecoder) startRow() bool {
+
+	if d.byteAlign && (d.k < 0 || !d.eol) {
+		d.br.align()
+	}
+
+	// Runs of 12 or more 0 bits are fill.
+	for !d.br.eod() && d.br.peek(12) == 0 {
+		d.br.skip(1)
+	}
+
+	if d.br.eod() {
+		return true
+	}
+
+	if d.br.peek(12) != 1 {
+		return false
+	}
+
+	// EOL
+	d.br.skip(12)
+
+	// A second EOL signals end of data (RTC or EOFB).
+	if d.k > 0 {
+		return d.br.peek(13) == 1<<12|1
+	}
+
+	return d.br.peek(12) == 1
+}
+
+func (d *ccittDecoder) decodeRun(color byte) (int, error) {
+
+	t := ccittWhiteDecodeTable
+	if color == ccittBlack {
+		t = ccittBlackDecodeTable
+	}
+
+	r := 0
+	for {
+		v, err := d.br.decode(t)
+		if err != nil {
+			return 0, err
+		}
+		r += int(v)
+		if v < 64 {
+			// Terminating code.
+			return r, nil
+		}
+	}
+}
+
+func (d *ccittDecoder) decodeRow1D() error {
+
+	color := byte(ccittWhite)
+
+	for a0 := 0; a0 < d.columns; {
+		r, err := d.decodeRun(color)
+		if err != nil {
+			return err
+		}
+		if a0+r > d.columns {
+			return errors.New("pdfcpu: ccitt: run length overflows width")
+		}
+		fill(d.cur, a0, a0+r, color)
+		a0 += r
+		color = 1 - color
+	}
+
+	return nil
+}
+
+func (d *ccittDecoder) decodeRow2D() error {
+
+	color := byte(ccittWhite)
+
+	for a0 := -1; a0 < d.columns; {
+
+		mode, err := d.br.decode(ccittModeDecodeTable)
+		if err != nil {
+			return err
+		}
+
+		start := a0
+		if start < 0 {
+			start = 0
+		}
+
+		b1, b2 := findB1B2(d.ref, a0, color)
+
+		switch mode {
+
+		case ccittModePass:
+			fill(d.cur, start, b2, color)
+			a0 = b2
+
+		case ccittModeH:
+			r1, err := d.decodeRun(color)
+			if err != nil {
+				return err
+			}
+			r2, err := d.decodeRun(1 - color)
+			if err != nil {
+				return err
+			}
+			if start+r1+r2 > d.columns {
+				return errors.New("pdfcpu: ccitt: run length overflows width")
+			}
+			fill(d.cur, start, start+r1, color)
+			fill(d.cur, start+r1, start+r1+r2, 1-color)
+			a0 = start + r1 + r2
+
+		case ccittModeV0, ccittModeVR1, ccittModeVR2, ccittModeVR3, ccittModeVL1, ccittModeVL2, ccittModeVL3:
+			a1 := b1 + ccittVerticalModes[mode]
+			if a1 < start || a1 > d.columns {
+				return errors.New("pdfcpu: ccitt: invalid offset")
+			}
+			fill(d.cur, start, a1, color)
+			a0 = a1
+			color = 1 - color
+
+		default:
+			return errors.Errorf("pdfcpu: ccitt: unsupported mode %d", mode)
+		}
+	}
+
+	return nil
+}
+
+func (d *ccittDecoder) writeRow(b *bytes.Buffer) {
+
+	row := make([]byte, (d.columns+7)/8)
+
+	for i, pix := range d.cur {
+		white := pix == ccittWhite
+		if white != d.blackIs1 {
+			row[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+
+	b.Write(row)
+}
+
+func (d *ccittDecoder) decode() (*bytes.Buffer, error) {
+
+	var b bytes.Buffer
+
+	d.ref = make([]byte, d.columns)
+	d.cur = make([]byte, d.columns)
+
+	row := 0
+
+	for ; d.rows <= 0 || row < d.rows; row++ {
+
+		if d.startRow() {
+			break
+		}
+
+		twoD := d.k < 0
+		if d.k > 0 {
+			// The tag bit following EOL signals the coding of the next row.
+			twoD = d.br.peek(1) == 0
+			d.br.skip(1)
+		}
+
+		var err error
+		if twoD {
+			err = d.decodeRow2D()
+		} else {
+			err = d.decodeRow1D()
+		}
+
+		if err != nil {
+			if row == 0 {
+				return nil, err
+			}
+			// Be lenient with damaged or truncated data.
+			log.Info.Printf("ccittDecode: row %d: %v\n", row, err)
+			break
+		}
+
+		d.writeRow(&b)
+
+		d.ref, d.cur = d.cur, d.ref
+	}
+
+	// Pad missing rows with white.
+	for fill(d.cur, 0, d.columns, ccittWhite); row < d.rows; row++ {
+		d.writeRow(&b)
+	}
+
+	return &b, nil
+}
+
+type ccittEncoder struct {
+	ccittParms
+	bw ccittBitWriter
+}
+
+func (e *ccittEncoder) writeMode(mode uint32) {
+	e.bw.write(ccittModeEncodeTable[mode])
+}
+
+func (e *ccittEncoder) writeRun(r int, color byte) {
+
+	t := ccittWhiteEncodeTable
+	if color == ccittBlack {
+		t = ccittBlackEncodeTable
+	}
+
+	for r >= 2560 {
+		e.bw.write(t[2560])
+		r -= 2560
+	}
+
+	if r >= 64 {
+		e.bw.write(t[uint32(r/64*64)])
+	}
+
+	e.bw.write(t[uint32(r%64)])
+}
+
+func (e *ccittEncoder) writeEOL() {
+	if e.byteAlign {
+		// Fill so that the EOL ends on a byte boundary.
+		e.bw.write(ccittBitString{0, (8 - (e.bw.nBits+12)%8) % 8})
+	}
+	e.writeMode(ccittModeEOL)
+}
+
+func (e *ccittEncoder) encodeRow1D(cur []byte) {
+
+	color := byte(ccittWhite)
+
+	// A row starting with black begins with a white run of length 0.
+	for a0 := 0; a0 < len(cur); {
+		a1 := a0
+		for a1 < len(cur) && cur[a1] == color {
+			a1++
+		}
+		e.writeRun(a1-a0, color)
+		a0 = a1
+		color = 1 - color
+	}
+}
+
+func (e *ccittEncoder) encodeRow2D(ref, cur []byte) {
+
+	color := byte(ccittWhite)
+
+	for a0 := -1; a0 < len(cur); {
+
+		start := a0
+		if start < 0 {
+			start = 0
+		}
+
+		a1 := findChange(cur, a0+1)
+		b1, b2 := findB1B2(ref, a0, color)
+
+		if b2 < a1 {
+			e.writeMode(ccittModePass)
+			a0 = b2
+			continue
+		}
+
+		if d := a1 - b1; d >= -3 && d <= 3 {
+			for mode, v := range ccittVerticalModes {
+				if v == d {
+					e.writeMode(mode)
+					break
+				}
+			}
+			a0 = a1
+			color = 1 - color
+			continue
+		}
+
+		a2 := findChange(cur, a1+1)
+		e.writeMode(ccittModeH)
+		e.writeRun(a1-start, color)
+		e.writeRun(a2-a1, 1-color)
+		a0 = a2
+	}
+}
+
+// encode encodes rows of pixels with one byte per pixel.
+func (e *ccittEncoder) encode(rows [][]byte) []byte {
+
+	ref := make([]byte, e.columns)
+
+	for i, cur := range rows {
+
+		if e.k < 0 {
+			if e.byteAlign {
+				e.bw.align()
+			}
+			e.encodeRow2D(ref, cur)
+			ref = cur
+			continue
+		}
+
+		if e.eol {
+			e.writeEOL()
+		} else if e.byteAlign {
+			e.bw.align()
+		}
+
+		oneD := e.k == 0 || i%e.k == 0
+		if e.k > 0 {
+			// Tag bit: 1 for one-dimensional coding of this row.
+			tag := uint32(0)
+			if oneD {
+				tag = 1
+			}
+			e.bw.write(ccittBitString{tag, 1})
+		}
+
+		if oneD {
+			e.encodeRow1D(cur)
+		} else {
+			e.encodeRow2D(ref, cur)
+		}
+
+		ref = cur
+	}
+
+	if e.eob {
+		if e.k < 0 {
+			// EOFB
+			e.writeMode(ccittModeEOL)
+			e.writeMode(ccittModeEOL)
+		} else {
+			// RTC
+			for i := 0; i < 6; i++ {
+				e.writeEOL()
+				if e.k > 0 {
+					e.bw.write(ccittBitString{1, 1})
+				}
+			}
+		}
+	}
+
+	return e.bw.flush()
+}
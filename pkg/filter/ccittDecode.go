@@ -17,8 +17,8 @@ limitations under the License.
 package filter
 
 import (
-	"bytes"
 	"io"
+	"io/ioutil"
 
 	"github.com/pdfcpu/pdfcpu/pkg/log"
 	"github.com/pkg/errors"
@@ -29,65 +29,114 @@ type ccittDecode struct {
 	baseFilter
 }
 
-// Encode implements encoding for an CCITTDecode filter.
-func (f ccittDecode) Encode(r io.Reader) (*bytes.Buffer, error) {
-	// TODO
-	return nil, nil
-}
-
-// Decode implements decoding for a CCITTDecode filter.
-func (f ccittDecode) Decode(r io.Reader) (*bytes.Buffer, error) {
-
-	log.Trace.Println("DecodeCCITT begin")
-
-	var ok bool
+// parameters returns the coding parameters for this filter.
+func (f ccittDecode) parameters() ccittParms {
 
 	// <0 : Pure two-dimensional encoding (Group 4)
 	// =0 : Pure one-dimensional encoding (Group 3, 1-D)
 	// >0 : Mixed one- and two-dimensional encoding (Group 3, 2-D)
-	k := 0
-	k, ok = f.parms["K"]
-	if ok && k > 0 {
-		return nil, errors.New("pdfcpu: filter CCITTFax k > 0 currently unsupported")
+	p := ccittParms{k: f.parms["K"], columns: 1728, eob: true}
+
+	if col, ok := f.parms["Columns"]; ok {
+		p.columns = col
+	}
+
+	p.rows = f.parms["Rows"]
+	p.eol = f.parms["EndOfLine"] == 1
+	p.byteAlign = f.parms["EncodedByteAlign"] == 1
+	p.blackIs1 = f.parms["BlackIs1"] == 1
+
+	if v, ok := f.parms["EndOfBlock"]; ok && v == 0 {
+		p.eob = false
+	}
+
+	return p
+}
+
+// Encode implements encoding for an CCITTDecode filter.
+func (f ccittDecode) Encode(r io.Reader, w io.Writer) error {
+
+	log.Trace.Println("EncodeCCITT begin")
+
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
 	}
 
-	cols := 1728
-	col, ok := f.parms["Columns"]
-	if ok {
-		cols = col
+	parms := f.parameters()
+	if parms.columns <= 0 {
+		return errors.New("pdfcpu: ccitt: invalid \"Columns\"")
 	}
 
-	rows, ok := f.parms["Rows"]
-	if !ok {
-		return nil, errors.New("pdfcpu: ccitt: missing DecodeParam \"Rows\"")
+	// Each row of the 1 bit per pixel input is byte aligned.
+	rowSize := (parms.columns + 7) / 8
+
+	rows := parms.rows
+	if rows <= 0 {
+		rows = len(p) / rowSize
 	}
 
-	blackIs1 := false
-	v, ok := f.parms["BlackIs1"]
-	if ok && v == 1 {
-		blackIs1 = true
+	if len(p) < rows*rowSize {
+		return errors.Errorf("pdfcpu: ccitt: expected %d bytes, got %d", rows*rowSize, len(p))
 	}
 
-	encodedByteAlign := false
-	v, ok = f.parms["EncodedByteAlign"]
-	if ok && v == 1 {
-		encodedByteAlign = true
+	pix := make([][]byte, rows)
+	for y := range pix {
+		pix[y] = make([]byte, parms.columns)
+		for x := range pix[y] {
+			bit := p[y*rowSize+x/8]&(0x80>>uint(x%8)) > 0
+			if bit == parms.blackIs1 {
+				pix[y][x] = ccittBlack
+			}
+		}
 	}
 
-	opts := &ccitt.Options{Invert: blackIs1, Align: encodedByteAlign}
+	e := ccittEncoder{ccittParms: parms}
+
+	n, err := w.Write(e.encode(pix))
+
+	log.Trace.Printf("EncodeCCITT end: %d bytes written\n", n)
+
+	return err
+}
+
+// Decode implements decoding for a CCITTDecode filter.
+func (f ccittDecode) Decode(r io.Reader, w io.Writer) error {
+
+	log.Trace.Println("DecodeCCITT begin")
+
+	parms := f.parameters()
+
+	if parms.k >= 0 {
+		// golang.org/x/image/ccitt does not support mixed one- and two-dimensional encoding
+		// and insists on EOLs for Group 3.
+		p, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		d := ccittDecoder{ccittParms: parms, br: ccittBitReader{p: p}}
+		b, err := d.decode()
+		if err != nil {
+			return err
+		}
+		log.Trace.Printf("DecodeCCITT: decoded %d bytes.\n", b.Len())
+		_, err = b.WriteTo(w)
+		return err
+	}
 
-	mode := ccitt.Group3
-	if k < 0 {
-		mode = ccitt.Group4
+	if parms.rows <= 0 {
+		return errors.New("pdfcpu: ccitt: missing DecodeParam \"Rows\"")
 	}
-	rd := ccitt.NewReader(r, ccitt.MSB, mode, cols, rows, opts)
 
-	var b bytes.Buffer
-	written, err := io.Copy(&b, rd)
+	opts := &ccitt.Options{Invert: parms.blackIs1, Align: parms.byteAlign}
+
+	rd := ccitt.NewReader(r, ccitt.MSB, ccitt.Group4, parms.columns, parms.rows, opts)
+
+	written, err := io.Copy(w, rd)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	log.Trace.Printf("DecodeCCITT: decoded %d bytes.\n", written)
 
-	return &b, nil
+	return nil
 }
@@ -0,0 +1,155 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/image/ccitt"
+)
+
+// bilevel returns a packed 1 bit per pixel test image with byte aligned rows where 0 means black.
+func bilevel(w, h int) []byte {
+	rowSize := (w + 7) / 8
+	p := bytes.Repeat([]byte{0xFF}, rowSize*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Some blocks, diagonals and noise.
+			black := (x/7+y/5)%3 == 0 || x == y || x+y == w || (x*x+y*31)%97 == 0
+			if y > h/2 && x > w/2 {
+				black = true
+			}
+			if black {
+				p[y*rowSize+x/8] &^= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return p
+}
+
+// comparePixels compares packed bilevel images of width w ignoring the row padding bits.
+func comparePixels(t *testing.T, a, b []byte, w int) {
+	t.Helper()
+
+	rowSize := (w + 7) / 8
+	if len(a) != len(b) {
+		t.Fatalf("length mismatch %d != %d", len(a), len(b))
+	}
+
+	for i := range a {
+		x := i % rowSize * 8
+		for j := 0; j < 8 && x+j < w; j++ {
+			m := byte(0x80) >> uint(j)
+			if a[i]&m != b[i]&m {
+				t.Fatalf("mismatch at row %d column %d", i/rowSize, x+j)
+			}
+		}
+	}
+}
+
+func TestCCITTEncodeDecode(t *testing.T) {
+
+	const w, h = 221, 67
+
+	raw := bilevel(w, h)
+
+	for _, parms := range []map[string]int{
+		{"K": -1},
+		{"K": -1, "EncodedByteAlign": 1},
+		{"K": -1, "BlackIs1": 1},
+		{"K": 0},
+		{"K": 0, "EndOfLine": 1},
+		{"K": 0, "EndOfLine": 1, "EncodedByteAlign": 1},
+		{"K": 0, "EndOfBlock": 0},
+		{"K": 1},
+		{"K": 4},
+		{"K": 4, "EndOfLine": 1},
+		{"K": 4, "EncodedByteAlign": 1},
+		{"K": 4, "EndOfLine": 1, "EncodedByteAlign": 1, "BlackIs1": 1},
+		{"K": 1000, "EndOfBlock": 0},
+	} {
+		parms["Columns"] = w
+		parms["Rows"] = h
+
+		f := ccittDecode{baseFilter{parms}}
+
+		enc := new(bytes.Buffer)
+		err := f.Encode(bytes.NewReader(raw), enc)
+		if err != nil {
+			t.Fatalf("%v: encode: %v\n", parms, err)
+		}
+
+		dec := new(bytes.Buffer)
+		err = f.Decode(enc, dec)
+		if err != nil {
+			t.Fatalf("%v: decode: %v\n", parms, err)
+		}
+
+		comparePixels(t, dec.Bytes(), raw, w)
+	}
+}
+
+func TestCCITTDecodeWithoutRows(t *testing.T) {
+
+	const w, h = 64, 20
+
+	raw := bilevel(w, h)
+
+	f := ccittDecode{baseFilter{map[string]int{"K": 2, "Columns": w, "Rows": h}}}
+
+	enc := new(bytes.Buffer)
+	err := f.Encode(bytes.NewReader(raw), enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decoding stops at RTC.
+	f = ccittDecode{baseFilter{map[string]int{"K": 2, "Columns": w}}}
+
+	dec := new(bytes.Buffer)
+	err = f.Decode(enc, dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comparePixels(t, dec.Bytes(), raw, w)
+}
+
+// Cross check the Group 3 encoder against golang.org/x/image/ccitt.
+func TestCCITTGroup3Compatibility(t *testing.T) {
+
+	const w, h = 100, 33
+
+	raw := bilevel(w, h)
+
+	f := ccittDecode{baseFilter{map[string]int{"K": 0, "EndOfLine": 1, "Columns": w, "Rows": h}}}
+
+	enc := new(bytes.Buffer)
+	err := f.Encode(bytes.NewReader(raw), enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := ioutil.ReadAll(ccitt.NewReader(enc, ccitt.MSB, ccitt.Group3, w, h, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comparePixels(t, dec, raw, w)
+}
@@ -0,0 +1,491 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// The DCTDecode filter decodes into interleaved 8 bit component samples, one byte per component.
+// Encoding expects the same layout and needs the optional parameters "Columns" and "Rows"
+// for the image dimensions. The number of color components is derived from the input length.
+//
+// Adobe CMYK JPEGs store inverted component values. Decode returns the stored values like any other
+// PDF processor does. Producers usually compensate for this using the image dict entry: Decode [1 0 1 0 1 0 1 0].
+
+// JPEG markers of interest.
+const (
+	jpegSOI   = 0xD8
+	jpegEOI   = 0xD9
+	jpegSOS   = 0xDA
+	jpegDQT   = 0xDB
+	jpegDHT   = 0xC4
+	jpegAPP14 = 0xEE
+	jpegRST0  = 0xD0
+	jpegRST7  = 0xD7
+	jpegTEM   = 0x01
+)
+
+// Adobe APP14 color transform codes.
+const (
+	adobeTransformNone  = 0
+	adobeTransformYCbCr = 1
+	adobeTransformYCCK  = 2
+)
+
+type dctDecode struct {
+	baseFilter
+}
+
+// jpegHeader holds the parts of a JPEG header relevant for color transformation.
+type jpegHeader struct {
+	soi            int    // offset of the SOI marker.
+	comps          []byte // component ids.
+	adobe          bool   // true if an Adobe APP14 marker is present.
+	adobeTransform int    // Adobe color transform code.
+}
+
+func isSOFMarker(m byte) bool {
+	// SOF0..SOF15 excluding DHT, JPG and DAC.
+	return m >= 0xC0 && m <= 0xCF && m != jpegDHT && m != 0xC8 && m != 0xCC
+}
+
+func parseJPEGHeader(p []byte) (*jpegHeader, error) {
+
+	i := bytes.Index(p, []byte{0xFF, jpegSOI})
+	if i < 0 {
+		return nil, errors.New("pdfcpu: filter DCTDecode: missing SOI marker")
+	}
+
+	h := &jpegHeader{soi: i}
+
+	for i += 2; i < len(p)-1; {
+
+		if p[i] != 0xFF {
+			return nil, errors.Errorf("pdfcpu: filter DCTDecode: corrupt marker at offset %d", i)
+		}
+
+		m := p[i+1]
+		i += 2
+
+		if m == 0xFF {
+			// Fill byte.
+			i--
+			continue
+		}
+
+		if m == jpegTEM || m >= jpegRST0 && m <= jpegRST7 {
+			// Standalone markers.
+			continue
+		}
+
+		if m == jpegEOI || m == jpegSOS {
+			break
+		}
+
+		if i+2 > len(p) {
+			break
+		}
+
+		n := int(p[i])<<8 + int(p[i+1])
+		if n < 2 || i+n > len(p) {
+			return nil, errors.Errorf("pdfcpu: filter DCTDecode: corrupt segment length at offset %d", i)
+		}
+
+		seg := p[i+2 : i+n]
+
+		switch {
+
+		case isSOFMarker(m):
+			if len(seg) < 6 {
+				return nil, errors.New("pdfcpu: filter DCTDecode: corrupt SOF segment")
+			}
+			nComp := int(seg[5])
+			if len(seg) < 6+3*nComp {
+				return nil, errors.New("pdfcpu: filter DCTDecode: corrupt SOF segment")
+			}
+			for j := 0; j < nComp; j++ {
+				h.comps = append(h.comps, seg[6+3*j])
+			}
+
+		case m == jpegAPP14:
+			if len(seg) >= 12 && string(seg[:5]) == "Adobe" {
+				h.adobe = true
+				h.adobeTransform = int(seg[11])
+			}
+
+		}
+
+		i += n
+	}
+
+	if len(h.comps) == 0 {
+		return nil, errors.New("pdfcpu: filter DCTDecode: missing SOF marker")
+	}
+
+	return h, nil
+}
+
+// adobeSegment returns an Adobe APP14 marker segment for the color transform code t.
+func adobeSegment(t int) []byte {
+	return []byte{
+		0xFF, jpegAPP14, 0x00, 0x0E,
+		'A', 'd', 'o', 'b', 'e',
+		0x00, 0x64, // version
+		0x00, 0x00, // flags0
+		0x00, 0x00, // flags1
+		byte(t),
+	}
+}
+
+// colorTransform returns true if the decoded samples need a YCbCr/YCCK to RGB/CMYK conversion.
+func (f dctDecode) colorTransform(h *jpegHeader) bool {
+
+	// An Adobe marker takes precedence over the ColorTransform decode parameter.
+	if h.adobe {
+		return h.adobeTransform != adobeTransformNone
+	}
+
+	if ct, ok := f.parms["ColorTransform"]; ok {
+		return ct != 0
+	}
+
+	if len(h.comps) != 3 {
+		return false
+	}
+
+	// Some producers write RGB JPEGs and mark this by component ids only.
+	return !(h.comps[0] == 'R' && h.comps[1] == 'G' && h.comps[2] == 'B')
+}
+
+func writeYCbCrSamples(w io.ByteWriter, img *image.YCbCr, transform bool) {
+
+	b := img.Bounds()
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			yi, ci := img.YOffset(x, y), img.COffset(x, y)
+			c1, c2, c3 := img.Y[yi], img.Cb[ci], img.Cr[ci]
+			if transform {
+				c1, c2, c3 = color.YCbCrToRGB(c1, c2, c3)
+			}
+			w.WriteByte(c1)
+			w.WriteByte(c2)
+			w.WriteByte(c3)
+		}
+	}
+}
+
+func writeRGBASamples(w io.ByteWriter, img *image.RGBA, transform bool) {
+
+	b := img.Bounds()
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			c1, c2, c3 := img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+			if transform {
+				c1, c2, c3 = color.YCbCrToRGB(c1, c2, c3)
+			}
+			w.WriteByte(c1)
+			w.WriteByte(c2)
+			w.WriteByte(c3)
+		}
+	}
+}
+
+func writeCMYKSamples(w io.ByteWriter, img *image.CMYK) {
+
+	b := img.Bounds()
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := img.PixOffset(b.Min.X, y)
+		for _, v := range img.Pix[i : i+4*b.Dx()] {
+			// image/jpeg undoes the Adobe inversion, we want the stored values.
+			w.WriteByte(0xFF - v)
+		}
+	}
+}
+
+func writeGraySamples(w io.Writer, img *image.Gray) {
+
+	b := img.Bounds()
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := img.PixOffset(b.Min.X, y)
+		w.Write(img.Pix[i : i+b.Dx()])
+	}
+}
+
+// Decode implements decoding for a DCTDecode filter.
+func (f dctDecode) Decode(r io.Reader, w io.Writer) error {
+
+	log.Trace.Println("DecodeDCT begin")
+
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	h, err := parseJPEGHeader(p)
+	if err != nil {
+		return err
+	}
+
+	transform := f.colorTransform(h)
+
+	// Skip any junk in front of SOI.
+	p = p[h.soi:]
+
+	if !h.adobe && len(h.comps) == 4 {
+		// image/jpeg relies on the Adobe marker for decoding 4 component images.
+		t := adobeTransformNone
+		if transform {
+			t = adobeTransformYCCK
+		}
+		q := append([]byte{0xFF, jpegSOI}, adobeSegment(t)...)
+		p = append(q, p[2:]...)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(p))
+	if err != nil {
+		return errors.Wrap(err, "pdfcpu: filter DCTDecode")
+	}
+
+	var b bytes.Buffer
+
+	switch img := img.(type) {
+
+	case *image.Gray:
+		writeGraySamples(&b, img)
+
+	case *image.YCbCr:
+		// image/jpeg returns the raw samples for YCbCr images.
+		writeYCbCrSamples(&b, img, transform)
+
+	case *image.RGBA:
+		// image/jpeg did not apply any color transformation.
+		writeRGBASamples(&b, img, transform)
+
+	case *image.CMYK:
+		writeCMYKSamples(&b, img)
+
+	default:
+		return errors.Errorf("pdfcpu: filter DCTDecode: unexpected image type %T", img)
+	}
+
+	log.Trace.Printf("DecodeDCT: decoded %d bytes.\n", b.Len())
+
+	_, err = b.WriteTo(w)
+	return err
+}
+
+func (f dctDecode) dimensions(n int) (w, h, colors int, err error) {
+
+	w, ok := f.parms["Columns"]
+	if !ok || w <= 0 {
+		return 0, 0, 0, errors.New("pdfcpu: filter DCTDecode: missing parameter \"Columns\"")
+	}
+
+	h, ok = f.parms["Rows"]
+	if !ok || h <= 0 {
+		return 0, 0, 0, errors.New("pdfcpu: filter DCTDecode: missing parameter \"Rows\"")
+	}
+
+	colors = n / (w * h)
+	if colors*w*h != n || !intMemberOf(colors, []int{1, 3, 4}) {
+		return 0, 0, 0, errors.Errorf("pdfcpu: filter DCTDecode: %d bytes do not fit a %dx%d image", n, w, h)
+	}
+
+	return w, h, colors, nil
+}
+
+func (f dctDecode) quality() int {
+
+	q, ok := f.parms["Quality"]
+	if !ok || q < 1 || q > 100 {
+		q = jpeg.DefaultQuality
+	}
+
+	return q
+}
+
+// segment returns marker segment i of a JPEG created by image/jpeg and the offset following it.
+func segment(p []byte, i int) (m byte, seg []byte, next int, err error) {
+
+	if i+4 > len(p) || p[i] != 0xFF {
+		return 0, nil, 0, errors.New("pdfcpu: filter DCTDecode: corrupt jpeg")
+	}
+
+	m = p[i+1]
+	n := int(p[i+2])<<8 + int(p[i+3])
+	if i+2+n > len(p) {
+		return 0, nil, 0, errors.New("pdfcpu: filter DCTDecode: corrupt jpeg")
+	}
+
+	return m, p[i : i+2+n], i + 2 + n, nil
+}
+
+// encodePlanes creates a baseline JPEG using one non interleaved scan per color component.
+// This way we get full control over the color transformation and can support 4 color components
+// while still relying on image/jpeg for the actual compression.
+func (f dctDecode) encodePlanes(w io.Writer, planes [][]byte, width, height, transform int) error {
+
+	var tables [][]byte
+	scans := make([][]byte, len(planes))
+
+	for c, plane := range planes {
+
+		img := &image.Gray{Pix: plane, Stride: width, Rect: image.Rect(0, 0, width, height)}
+
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: f.quality()}); err != nil {
+			return err
+		}
+		p := b.Bytes()
+
+		// image/jpeg writes: SOI DQT SOF0 DHT SOS <data> EOI
+		for i := 2; i < len(p); {
+			m, seg, next, err := segment(p, i)
+			if err != nil {
+				return err
+			}
+			if c == 0 && (m == jpegDQT || m == jpegDHT) {
+				tables = append(tables, seg)
+			}
+			if m == jpegSOS {
+				scans[c] = p[next : len(p)-2]
+				break
+			}
+			i = next
+		}
+
+		if scans[c] == nil {
+			return errors.New("pdfcpu: filter DCTDecode: missing scan")
+		}
+	}
+
+	n := len(planes)
+
+	// SOI, APP14
+	w.Write([]byte{0xFF, jpegSOI})
+	w.Write(adobeSegment(transform))
+
+	// DQT
+	w.Write(tables[0])
+
+	// SOF0: baseline, 8 bit precision, no subsampling, all components use quantization table 0.
+	l := 8 + 3*n
+	sof := []byte{0xFF, 0xC0, byte(l >> 8), byte(l), 8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(n)}
+	for c := 0; c < n; c++ {
+		sof = append(sof, byte(c+1), 0x11, 0x00)
+	}
+	w.Write(sof)
+
+	// DHT
+	for _, t := range tables[1:] {
+		w.Write(t)
+	}
+
+	// One SOS per component using Huffman tables 0.
+	for c := 0; c < n; c++ {
+		w.Write([]byte{0xFF, jpegSOS, 0x00, 0x08, 0x01, byte(c + 1), 0x00, 0x00, 0x3F, 0x00})
+		w.Write(scans[c])
+	}
+
+	// EOI
+	_, err := w.Write([]byte{0xFF, jpegEOI})
+
+	return err
+}
+
+// Encode implements encoding for a DCTDecode filter.
+func (f dctDecode) Encode(r io.Reader, w io.Writer) error {
+
+	log.Trace.Println("EncodeDCT begin")
+
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	width, height, colors, err := f.dimensions(len(p))
+	if err != nil {
+		return err
+	}
+
+	ct, ok := f.parms["ColorTransform"]
+	if !ok {
+		ct = 0
+		if colors == 3 {
+			ct = 1
+		}
+	}
+
+	var b bytes.Buffer
+
+	switch {
+
+	case colors == 1:
+		img := &image.Gray{Pix: p, Stride: width, Rect: image.Rect(0, 0, width, height)}
+		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: f.quality()})
+
+	case colors == 3 && ct == 1:
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for i, j := 0, 0; i < len(p); i, j = i+3, j+4 {
+			img.Pix[j], img.Pix[j+1], img.Pix[j+2], img.Pix[j+3] = p[i], p[i+1], p[i+2], 0xFF
+		}
+		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: f.quality()})
+
+	default:
+		planes := make([][]byte, colors)
+		for c := range planes {
+			planes[c] = make([]byte, width*height)
+		}
+		for i, j := 0, 0; i < len(p); i, j = i+colors, j+1 {
+			for c := 0; c < colors; c++ {
+				planes[c][j] = p[i+c]
+			}
+			if colors == 4 && ct == 1 {
+				// CMYK -> YCCK
+				planes[0][j], planes[1][j], planes[2][j] = color.RGBToYCbCr(0xFF-p[i], 0xFF-p[i+1], 0xFF-p[i+2])
+			}
+		}
+		t := adobeTransformNone
+		if colors == 4 && ct == 1 {
+			t = adobeTransformYCCK
+		}
+		err = f.encodePlanes(&b, planes, width, height, t)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Trace.Printf("EncodeDCT end: %d bytes written\n", b.Len())
+
+	_, err = b.WriteTo(w)
+	return err
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// gradient returns interleaved samples of a smooth w x h test image with n color components.
+func gradient(w, h, n int) []byte {
+	p := make([]byte, 0, w*h*n)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for c := 0; c < n; c++ {
+				p = append(p, byte((x*(c+1)+y*(n-c))*255/((w+h)*n)))
+			}
+		}
+	}
+	return p
+}
+
+func TestDCTEncodeDecode(t *testing.T) {
+
+	const w, h = 48, 32
+
+	for _, tt := range []struct {
+		colors int
+		parms  map[string]int
+	}{
+		{1, map[string]int{}},
+		{3, map[string]int{}},
+		{3, map[string]int{"ColorTransform": 0}},
+		{4, map[string]int{}},
+		{4, map[string]int{"ColorTransform": 1}},
+	} {
+		raw := gradient(w, h, tt.colors)
+
+		tt.parms["Columns"] = w
+		tt.parms["Rows"] = h
+		tt.parms["Quality"] = 100
+
+		f := dctDecode{baseFilter{tt.parms}}
+
+		enc := new(bytes.Buffer)
+		err := f.Encode(bytes.NewReader(raw), enc)
+		if err != nil {
+			t.Fatalf("colors=%d %v: encode: %v\n", tt.colors, tt.parms, err)
+		}
+
+		// Decoding does not need any parameters.
+		f = dctDecode{baseFilter{map[string]int{}}}
+
+		dec := new(bytes.Buffer)
+		err = f.Decode(enc, dec)
+		if err != nil {
+			t.Fatalf("colors=%d %v: decode: %v\n", tt.colors, tt.parms, err)
+		}
+
+		d := dec.Bytes()
+		if len(d) != len(raw) {
+			t.Fatalf("colors=%d %v: length mismatch %d != %d", tt.colors, tt.parms, len(d), len(raw))
+		}
+
+		// DCT is lossy.
+		for i := range d {
+			if diff := int(d[i]) - int(raw[i]); diff > 8 || diff < -8 {
+				t.Fatalf("colors=%d %v: mismatch at %d: 0x%02x != 0x%02x", tt.colors, tt.parms, i, d[i], raw[i])
+			}
+		}
+	}
+}
+
+func TestDCTMissingDimensions(t *testing.T) {
+
+	f := dctDecode{baseFilter{map[string]int{}}}
+
+	if err := f.Encode(bytes.NewReader(gradient(8, 8, 1)), ioutil.Discard); err == nil {
+		t.Fatal("expected error for missing Columns/Rows")
+	}
+}
@@ -20,8 +20,9 @@ package filter
 // See 7.4 for a list of defined filter pdfcpu.
 
 import (
-	"bytes"
+	"compress/zlib"
 	"io"
+	"sync"
 
 	"github.com/pdfcpu/pdfcpu/pkg/log"
 	"github.com/pkg/errors"
@@ -46,17 +47,66 @@ var (
 	ErrUnsupportedFilter = errors.New("pdfcpu: filter not supported")
 )
 
-// Filter defines an interface for encoding/decoding buffers.
+// Filter defines an interface for encoding/decoding streams.
+// Filters read their input from r and write their output to w
+// so filter chains may process arbitrarily large streams with bounded memory.
+// Image filters like DCTDecode need to buffer the whole image though.
 type Filter interface {
-	Encode(r io.Reader) (*bytes.Buffer, error)
-	Decode(r io.Reader) (*bytes.Buffer, error)
-	//Encode(r io.Reader, w io.Writer) error
-	//Decode(r io.Reader, w io.Writer) error
+	Encode(r io.Reader, w io.Writer) error
+	Decode(r io.Reader, w io.Writer) error
+}
+
+// Factory returns a new filter for an optional parameter dictionary.
+type Factory func(parms map[string]int) (Filter, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a filter available under filterName, eg. for filters pdfcpu does not implement.
+// Registering a filterName pdfcpu supports replaces the builtin filter.
+// Passing a nil factory removes the registration.
+func Register(filterName string, factory Factory) {
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		delete(registry, filterName)
+		return
+	}
+
+	registry[filterName] = factory
+}
+
+// Registered returns true if a filter has been registered for filterName.
+func Registered(filterName string) bool {
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	_, ok := registry[filterName]
+
+	return ok
+}
+
+func registeredFactory(filterName string) Factory {
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return registry[filterName]
 }
 
 // NewFilter returns a filter for given filterName and an optional parameter dictionary.
+// Registered filters take precedence over builtin filters.
 func NewFilter(filterName string, parms map[string]int) (filter Filter, err error) {
 
+	if factory := registeredFactory(filterName); factory != nil {
+		return factory(parms)
+	}
+
 	switch filterName {
 
 	case ASCII85:
@@ -72,14 +122,20 @@ func NewFilter(filterName string, parms map[string]int) (filter Filter, err erro
 		filter = lzwDecode{baseFilter{parms}}
 
 	case Flate:
-		filter = flate{baseFilter{parms}}
+		filter = flate{baseFilter{parms}, zlib.DefaultCompression}
 
 	case CCITTFax:
 		filter = ccittDecode{baseFilter{parms}}
 
-	// DCT
-	// JBIG2
-	// JPX
+	case DCT:
+		filter = dctDecode{baseFilter{parms}}
+
+	case JBIG2:
+		// See NewJBIG2Filter for the support of JBIG2Globals.
+		filter = jbig2Decode{baseFilter{parms}, nil}
+
+	case JPX:
+		filter = jpxDecode{baseFilter{parms}}
 
 	default:
 		log.Info.Printf("Filter not supported: <%s>", filterName)
@@ -19,6 +19,7 @@ package filter_test
 import (
 	"bufio"
 	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -40,25 +41,29 @@ func encodeDecodeUsingFilterNamed(t *testing.T, filterName string) {
 
 	r := bytes.NewReader([]byte(input))
 
-	b1, err := filter.Encode(r)
+	b1 := new(bytes.Buffer)
+	err = filter.Encode(r, b1)
 	if err != nil {
 		t.Fatalf("Problem encoding 1: %v\n", err)
 	}
 	//t.Logf("encoded 1:  len:%d % X <%s>\n", b1.Len(), b1.Bytes(), b1.Bytes())
 
-	b2, err := filter.Encode(b1)
+	b2 := new(bytes.Buffer)
+	err = filter.Encode(b1, b2)
 	if err != nil {
 		t.Fatalf("Problem encoding 2: %v\n", err)
 	}
 	//t.Logf("encoded 2:  len:%d % X <%s>\n", b2.Len(), b2.Bytes(), b2.Bytes())
 
-	c1, err := filter.Decode(b2)
+	c1 := new(bytes.Buffer)
+	err = filter.Decode(b2, c1)
 	if err != nil {
 		t.Fatalf("Problem decoding 2: %v\n", err)
 	}
 	//t.Logf("decoded 2:  len:%d % X <%s>\n", c1.Len(), c1.Bytes(), c1.Bytes())
 
-	c2, err := filter.Decode(c1)
+	c2 := new(bytes.Buffer)
+	err = filter.Decode(c1, c2)
 	if err != nil {
 		t.Fatalf("Problem decoding 1: %v\n", err)
 	}
@@ -103,12 +108,14 @@ func testFile(t *testing.T, filterName, fileName string) {
 	}
 	defer raw.Close()
 
-	enc, err := f.Encode(bufio.NewReader(raw))
+	enc := new(bytes.Buffer)
+	err = f.Encode(bufio.NewReader(raw), enc)
 	if err != nil {
 		t.Errorf("Problem encoding: %v\n", err)
 	}
 
-	dec, err := f.Decode(enc)
+	dec := new(bytes.Buffer)
+	err = f.Decode(enc, dec)
 	if err != nil {
 		t.Errorf("Problem decoding: %v\n", err)
 	}
@@ -150,3 +157,68 @@ func TestWriter(t *testing.T) {
 		}
 	}
 }
+
+// xorFilter is a custom filter inverting all bits.
+type xorFilter struct{}
+
+func (f xorFilter) Encode(r io.Reader, w io.Writer) error {
+	return f.Decode(r, w)
+}
+
+func (f xorFilter) Decode(r io.Reader, w io.Writer) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	for i := range b {
+		b[i] ^= 0xFF
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func TestRegister(t *testing.T) {
+
+	const name = "XORDecode"
+
+	if _, err := filter.NewFilter(name, nil); err != filter.ErrUnsupportedFilter {
+		t.Fatalf("expected ErrUnsupportedFilter, got: %v", err)
+	}
+
+	factory := func(parms map[string]int) (filter.Filter, error) {
+		return xorFilter{}, nil
+	}
+
+	// Register a custom filter and replace a builtin filter.
+	for _, filterName := range []string{name, filter.Flate} {
+
+		filter.Register(filterName, factory)
+
+		if !filter.Registered(filterName) {
+			t.Fatalf("%s: not registered", filterName)
+		}
+
+		f, err := filter.NewFilter(filterName, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+		if err := f.Decode(bytes.NewReader([]byte{0x00, 0x0F}), &b); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b.Bytes(), []byte{0xFF, 0xF0}) {
+			t.Fatalf("%s: got % X", filterName, b.Bytes())
+		}
+
+		filter.Register(filterName, nil)
+
+		if filter.Registered(filterName) {
+			t.Fatalf("%s: still registered", filterName)
+		}
+	}
+
+	// The builtin filter is back.
+	encodeDecodeUsingFilterNamed(t, filter.Flate)
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+// This file implements the arithmetic decoding procedures of ITU-T T.88 Annex A and E.
+
+type jbig2QeEntry struct {
+	qe         uint32
+	nmps, nlps byte
+	switchMPS  bool
+}
+
+// See Table E.1
+var jbig2QeTable = [47]jbig2QeEntry{
+	{0x5601, 1, 1, true},
+	{0x3401, 2, 6, false},
+	{0x1801, 3, 9, false},
+	{0x0AC1, 4, 12, false},
+	{0x0521, 5, 29, false},
+	{0x0221, 38, 33, false},
+	{0x5601, 7, 6, true},
+	{0x5401, 8, 14, false},
+	{0x4801, 9, 14, false},
+	{0x3801, 10, 14, false},
+	{0x3001, 11, 17, false},
+	{0x2401, 12, 18, false},
+	{0x1C01, 13, 20, false},
+	{0x1601, 29, 21, false},
+	{0x5601, 15, 14, true},
+	{0x5401, 16, 14, false},
+	{0x5101, 17, 15, false},
+	{0x4801, 18, 16, false},
+	{0x3801, 19, 17, false},
+	{0x3401, 20, 18, false},
+	{0x3001, 21, 19, false},
+	{0x2801, 22, 19, false},
+	{0x2401, 23, 20, false},
+	{0x2201, 24, 21, false},
+	{0x1C01, 25, 22, false},
+	{0x1801, 26, 23, false},
+	{0x1601, 27, 24, false},
+	{0x1401, 28, 25, false},
+	{0x1201, 29, 26, false},
+	{0x1101, 30, 27, false},
+	{0x0AC1, 31, 28, false},
+	{0x09C1, 32, 29, false},
+	{0x08A1, 33, 30, false},
+	{0x0521, 34, 31, false},
+	{0x0441, 35, 32, false},
+	{0x02A1, 36, 33, false},
+	{0x0221, 37, 34, false},
+	{0x0141, 38, 35, false},
+	{0x0111, 39, 36, false},
+	{0x0085, 40, 37, false},
+	{0x0049, 41, 38, false},
+	{0x0025, 42, 39, false},
+	{0x0015, 43, 40, false},
+	{0x0009, 44, 41, false},
+	{0x0005, 45, 42, false},
+	{0x0001, 45, 43, false},
+	{0x5601, 46, 46, false},
+}
+
+// jbig2Contexts holds the adaptive probability state of arithmetic coding contexts.
+// Each entry is the index into jbig2QeTable shifted left by one or'ed with the MPS.
+type jbig2Contexts []byte
+
+func newJBIG2Contexts(n int) jbig2Contexts {
+	return make(jbig2Contexts, n)
+}
+
+// jbig2ArithDecoder is the MQ arithmetic decoder.
+type jbig2ArithDecoder struct {
+	p           []byte
+	pos         int
+	chigh, clow uint32
+	a           uint32
+	ct          int
+}
+
+func newJBIG2ArithDecoder(p []byte) *jbig2ArithDecoder {
+
+	d := &jbig2ArithDecoder{p: p}
+
+	// INITDEC
+	d.chigh = uint32(d.byteAt(0))
+	d.byteIn()
+	d.chigh = (d.chigh<<7)&0xFFFF | (d.clow>>9)&0x7F
+	d.clow = (d.clow << 7) & 0xFFFF
+	d.ct -= 7
+	d.a = 0x8000
+
+	return d
+}
+
+// byteAt returns the byte at position i. Data is padded with 0xFF.
+func (d *jbig2ArithDecoder) byteAt(i int) byte {
+	if i < len(d.p) {
+		return d.p[i]
+	}
+	return 0xFF
+}
+
+func (d *jbig2ArithDecoder) byteIn() {
+
+	if d.byteAt(d.pos) == 0xFF {
+		if d.byteAt(d.pos+1) > 0x8F {
+			// Marker code, feed 1 bits.
+			d.clow += 0xFF00
+			d.ct = 8
+			return
+		}
+		d.pos++
+		d.clow += uint32(d.byteAt(d.pos)) << 9
+		d.ct = 7
+	} else {
+		d.pos++
+		d.clow += uint32(d.byteAt(d.pos)) << 8
+		d.ct = 8
+	}
+
+	if d.clow > 0xFFFF {
+		d.chigh += d.clow >> 16
+		d.clow &= 0xFFFF
+	}
+}
+
+// decodeBit decodes a bit using context i of cx.
+func (d *jbig2ArithDecoder) decodeBit(cx jbig2Contexts, i int) int {
+
+	index := cx[i] >> 1
+	mps := int(cx[i] & 1)
+	e := jbig2QeTable[index]
+
+	var bit int
+
+	a := d.a - e.qe
+
+	if d.chigh < e.qe {
+		// LPS exchange
+		if a < e.qe {
+			a = e.qe
+			bit = mps
+			index = e.nmps
+		} else {
+			a = e.qe
+			bit = 1 - mps
+			if e.switchMPS {
+				mps = bit
+			}
+			index = e.nlps
+		}
+	} else {
+		d.chigh -= e.qe
+		if a&0x8000 != 0 {
+			d.a = a
+			return mps
+		}
+		// MPS exchange
+		if a < e.qe {
+			bit = 1 - mps
+			if e.switchMPS {
+				mps = bit
+			}
+			index = e.nlps
+		} else {
+			bit = mps
+			index = e.nmps
+		}
+	}
+
+	// RENORMD
+	for {
+		if d.ct == 0 {
+			d.byteIn()
+		}
+		a <<= 1
+		d.chigh = (d.chigh<<1)&0xFFFF | (d.clow>>15)&1
+		d.clow = (d.clow << 1) & 0xFFFF
+		d.ct--
+		if a&0x8000 != 0 {
+			break
+		}
+	}
+
+	d.a = a
+	cx[i] = index<<1 | byte(mps)
+
+	return bit
+}
+
+// jbig2IntDecoder implements the integer arithmetic decoding procedure IAx (See A.2).
+type jbig2IntDecoder struct {
+	cx jbig2Contexts
+}
+
+func newJBIG2IntDecoder() *jbig2IntDecoder {
+	return &jbig2IntDecoder{cx: newJBIG2Contexts(512)}
+}
+
+// decode returns the decoded value and false for OOB.
+func (id *jbig2IntDecoder) decode(d *jbig2ArithDecoder) (int, bool) {
+
+	prev := 1
+
+	readBit := func() int {
+		bit := d.decodeBit(id.cx, prev)
+		if prev < 256 {
+			prev = prev<<1 | bit
+		} else {
+			prev = (prev<<1|bit)&511 | 256
+		}
+		return bit
+	}
+
+	readBits := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v = v<<1 | readBit()
+		}
+		return v
+	}
+
+	s := readBit()
+
+	var v int
+	switch {
+	case readBit() == 0:
+		v = readBits(2)
+	case readBit() == 0:
+		v = readBits(4) + 4
+	case readBit() == 0:
+		v = readBits(6) + 20
+	case readBit() == 0:
+		v = readBits(8) + 84
+	case readBit() == 0:
+		v = readBits(12) + 340
+	default:
+		v = readBits(32) + 4436
+	}
+
+	if s == 1 {
+		if v == 0 {
+			return 0, false
+		}
+		return -v, true
+	}
+
+	return v, true
+}
+
+// jbig2IDDecoder implements the symbol ID decoding procedure IAID (See A.3).
+type jbig2IDDecoder struct {
+	cx      jbig2Contexts
+	codeLen uint
+}
+
+func newJBIG2IDDecoder(codeLen uint) *jbig2IDDecoder {
+	return &jbig2IDDecoder{cx: newJBIG2Contexts(1 << (codeLen + 1)), codeLen: codeLen}
+}
+
+func (id *jbig2IDDecoder) decode(d *jbig2ArithDecoder) int {
+	prev := 1
+	for i := uint(0); i < id.codeLen; i++ {
+		prev = prev<<1 | d.decodeBit(id.cx, prev)
+	}
+	return prev - 1<<id.codeLen
+}
+
+// jbig2CodeLen returns the number of bits needed to represent n symbol IDs.
+func jbig2CodeLen(n int) uint {
+	l := uint(0)
+	for 1<<l < n {
+		l++
+	}
+	return l
+}
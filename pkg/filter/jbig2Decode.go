@@ -0,0 +1,485 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// This is a JBIG2 decoder for the embedded stream organisation used by PDF (See ITU-T T.88 Annex D.3).
+// It supports arithmetic and MMR coded generic regions, arithmetic coded generic refinement regions,
+// symbol dictionaries and text regions. Huffman coding, pattern dictionaries and halftone regions are not supported.
+
+// JBIG2 segment types (See 7.3)
+const (
+	jbig2SymbolDictionary                  = 0
+	jbig2IntermediateTextRegion            = 4
+	jbig2ImmediateTextRegion               = 6
+	jbig2ImmediateLosslessTextRegion       = 7
+	jbig2PatternDictionary                 = 16
+	jbig2IntermediateHalftoneRegion        = 20
+	jbig2ImmediateHalftoneRegion           = 22
+	jbig2ImmediateLosslessHalftoneRegion   = 23
+	jbig2IntermediateGenericRegion         = 36
+	jbig2ImmediateGenericRegion            = 38
+	jbig2ImmediateLosslessGenericRegion    = 39
+	jbig2IntermediateRefinementRegion      = 40
+	jbig2ImmediateRefinementRegion         = 42
+	jbig2ImmediateLosslessRefinementRegion = 43
+	jbig2PageInformation                   = 48
+	jbig2EndOfPage                         = 49
+	jbig2EndOfStripe                       = 50
+	jbig2EndOfFile                         = 51
+)
+
+type jbig2Decode struct {
+	baseFilter
+	globals []byte
+}
+
+// NewJBIG2Filter returns a JBIG2Decode filter using the global segments of an optional JBIG2Globals stream.
+func NewJBIG2Filter(parms map[string]int, globals []byte) Filter {
+	return jbig2Decode{baseFilter{parms}, globals}
+}
+
+// Encode implements encoding for a JBIG2Decode filter.
+func (f jbig2Decode) Encode(r io.Reader, w io.Writer) error {
+	log.Info.Println("EncodeJBIG2: encoding not supported")
+	return ErrUnsupportedFilter
+}
+
+// Decode implements decoding for a JBIG2Decode filter.
+// The result is a 1 bit per pixel image with byte aligned rows where 0 means black.
+func (f jbig2Decode) Decode(r io.Reader, w io.Writer) error {
+
+	log.Trace.Println("DecodeJBIG2 begin")
+
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	d := jbig2Decoder{results: map[uint32]*jbig2Result{}}
+
+	for _, data := range [][]byte{f.globals, p} {
+
+		segs, err := parseJBIG2Segments(data)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range segs {
+			if err = d.processSegment(s); err != nil {
+				return err
+			}
+			if d.done {
+				break
+			}
+		}
+	}
+
+	if d.page == nil {
+		return errors.New("pdfcpu: jbig2: missing page information")
+	}
+
+	// PDF expects 1 bits for white.
+	p = make([]byte, len(d.page.data))
+	for i, c := range d.page.data {
+		p[i] = ^c
+	}
+
+	log.Trace.Printf("DecodeJBIG2: decoded %d bytes.\n", len(p))
+
+	_, err = w.Write(p)
+	return err
+}
+
+// jbig2Segment represents a JBIG2 segment (See 7.2).
+type jbig2Segment struct {
+	number uint32
+	typ    int
+	refs   []uint32
+	page   uint32
+	data   []byte
+}
+
+// parseJBIG2Segments parses a sequence of segments using the sequential organisation without file header.
+func parseJBIG2Segments(p []byte) ([]*jbig2Segment, error) {
+
+	var segs []*jbig2Segment
+
+	for len(p) > 0 {
+
+		s, n, err := parseJBIG2Segment(p)
+		if err != nil {
+			return nil, err
+		}
+
+		segs = append(segs, s)
+		p = p[n:]
+
+		if s.typ == jbig2EndOfFile {
+			break
+		}
+	}
+
+	return segs, nil
+}
+
+// parseJBIG2Segment parses the segment at the beginning of p and returns the number of bytes consumed.
+func parseJBIG2Segment(p []byte) (*jbig2Segment, int, error) {
+
+	errCorrupt := errors.New("pdfcpu: jbig2: corrupt segment header")
+
+	if len(p) < 6 {
+		return nil, 0, errCorrupt
+	}
+
+	s := &jbig2Segment{number: be32(p), typ: int(p[4] & 0x3F)}
+	pageAssoc4 := p[4]&0x40 > 0
+	i := 5
+
+	// Referred-to segment count and retention flags
+	refCount := int(p[i] >> 5)
+	switch refCount {
+	case 5, 6:
+		return nil, 0, errCorrupt
+	case 7:
+		if len(p) < i+4 {
+			return nil, 0, errCorrupt
+		}
+		refCount = int(be32(p[i:]) & 0x1FFFFFFF)
+		i += 4 + (refCount+8)/8
+	default:
+		i++
+	}
+
+	refSize := 4
+	if s.number <= 256 {
+		refSize = 1
+	} else if s.number <= 65536 {
+		refSize = 2
+	}
+
+	if len(p) < i+refCount*refSize {
+		return nil, 0, errCorrupt
+	}
+
+	for j := 0; j < refCount; j++ {
+		var ref uint32
+		for k := 0; k < refSize; k++ {
+			ref = ref<<8 | uint32(p[i])
+			i++
+		}
+		s.refs = append(s.refs, ref)
+	}
+
+	if pageAssoc4 {
+		if len(p) < i+4 {
+			return nil, 0, errCorrupt
+		}
+		s.page = be32(p[i:])
+		i += 4
+	} else {
+		if len(p) < i+1 {
+			return nil, 0, errCorrupt
+		}
+		s.page = uint32(p[i])
+		i++
+	}
+
+	if len(p) < i+4 {
+		return nil, 0, errCorrupt
+	}
+
+	dataLen := be32(p[i:])
+	i += 4
+
+	if dataLen == 0xFFFFFFFF {
+		// Unknown length of an immediate generic region.
+		n, err := jbig2GenericRegionLength(p[i:])
+		if err != nil {
+			return nil, 0, err
+		}
+		dataLen = uint32(n)
+	}
+
+	if uint32(len(p)-i) < dataLen {
+		return nil, 0, errors.New("pdfcpu: jbig2: truncated segment data")
+	}
+
+	s.data = p[i : i+int(dataLen)]
+
+	return s, i + int(dataLen), nil
+}
+
+// jbig2GenericRegionLength returns the length of immediate generic region data
+// terminated by an end sequence followed by the row count (See 7.2.7).
+func jbig2GenericRegionLength(p []byte) (int, error) {
+
+	if len(p) < 18 {
+		return 0, errors.New("pdfcpu: jbig2: corrupt generic region")
+	}
+
+	end := []byte{0xFF, 0xAC}
+	if p[17]&0x01 > 0 {
+		// MMR
+		end = []byte{0x00, 0x00}
+	}
+
+	i := bytes.Index(p[18:], end)
+	if i < 0 || len(p) < 18+i+6 {
+		return 0, errors.New("pdfcpu: jbig2: missing end of generic region")
+	}
+
+	return 18 + i + 6, nil
+}
+
+// jbig2Result represents the outcome of a processed segment needed by referring segments.
+type jbig2Result struct {
+	dict   *jbig2SymbolDict
+	region *jbig2Bitmap
+}
+
+type jbig2Decoder struct {
+	results map[uint32]*jbig2Result
+	page    *jbig2Bitmap
+
+	// The page height is unknown for striped pages and gets determined by end of stripe segments.
+	pageHeightUnknown bool
+	pageDefPixel      int
+
+	done bool
+}
+
+func (d *jbig2Decoder) referredSymbols(s *jbig2Segment) ([]*jbig2Bitmap, *jbig2SymbolDict) {
+
+	var (
+		syms []*jbig2Bitmap
+		last *jbig2SymbolDict
+	)
+
+	for _, ref := range s.refs {
+		if r, ok := d.results[ref]; ok && r.dict != nil {
+			syms = append(syms, r.dict.exported...)
+			last = r.dict
+		}
+	}
+
+	return syms, last
+}
+
+func (d *jbig2Decoder) processSegment(s *jbig2Segment) error {
+
+	log.Trace.Printf("processSegment: #%d type=%d refs=%v len=%d\n", s.number, s.typ, s.refs, len(s.data))
+
+	switch s.typ {
+
+	case jbig2SymbolDictionary:
+		syms, last := d.referredSymbols(s)
+		dict, err := decodeSymbolDict(s.data, syms, last)
+		if err != nil {
+			return err
+		}
+		d.results[s.number] = &jbig2Result{dict: dict}
+
+	case jbig2IntermediateTextRegion, jbig2ImmediateTextRegion, jbig2ImmediateLosslessTextRegion:
+		syms, _ := d.referredSymbols(s)
+		ri, b, err := decodeTextRegionSegment(s.data, syms)
+		if err != nil {
+			return err
+		}
+		return d.placeRegion(s, ri, b)
+
+	case jbig2IntermediateGenericRegion, jbig2ImmediateGenericRegion, jbig2ImmediateLosslessGenericRegion:
+		ri, b, err := decodeGenericRegionSegment(s.data)
+		if err != nil {
+			return err
+		}
+		return d.placeRegion(s, ri, b)
+
+	case jbig2IntermediateRefinementRegion, jbig2ImmediateRefinementRegion, jbig2ImmediateLosslessRefinementRegion:
+		return d.processRefinementRegion(s)
+
+	case jbig2PatternDictionary, jbig2IntermediateHalftoneRegion, jbig2ImmediateHalftoneRegion, jbig2ImmediateLosslessHalftoneRegion:
+		log.Info.Printf("DecodeJBIG2: skipping unsupported segment type %d\n", s.typ)
+
+	case jbig2PageInformation:
+		return d.processPageInformation(s.data)
+
+	case jbig2EndOfStripe:
+		if len(s.data) < 4 {
+			return errors.New("pdfcpu: jbig2: corrupt end of stripe")
+		}
+		if d.page != nil && d.pageHeightUnknown {
+			d.page.grow(int(be32(s.data))+1, d.pageDefPixel)
+		}
+
+	case jbig2EndOfPage, jbig2EndOfFile:
+		d.done = true
+
+	default:
+		// Profiles, tables, color palettes and extensions do not affect the page bitmap.
+		log.Trace.Printf("processSegment: ignoring segment type %d\n", s.typ)
+	}
+
+	return nil
+}
+
+func (d *jbig2Decoder) processPageInformation(p []byte) error {
+
+	if len(p) < 19 {
+		return errors.New("pdfcpu: jbig2: corrupt page information")
+	}
+
+	w, h := int(be32(p)), be32(p[4:])
+	flags := p[16]
+
+	d.pageDefPixel = int(flags >> 2 & 0x01)
+
+	if h == 0xFFFFFFFF {
+		d.pageHeightUnknown = true
+		h = 0
+	}
+
+	d.page = newJBIG2Bitmap(w, int(h))
+	d.page.fill(d.pageDefPixel)
+
+	return nil
+}
+
+// placeRegion saves an intermediate region for further refinement or combines an immediate region with the page.
+func (d *jbig2Decoder) placeRegion(s *jbig2Segment, ri jbig2RegionInfo, b *jbig2Bitmap) error {
+
+	switch s.typ {
+	case jbig2IntermediateTextRegion, jbig2IntermediateGenericRegion, jbig2IntermediateRefinementRegion:
+		d.results[s.number] = &jbig2Result{region: b}
+		return nil
+	}
+
+	if d.page == nil {
+		return errors.New("pdfcpu: jbig2: missing page information")
+	}
+
+	if d.pageHeightUnknown {
+		d.page.grow(ri.y+b.h, d.pageDefPixel)
+	}
+
+	d.page.compose(b, ri.x, ri.y, ri.op)
+
+	return nil
+}
+
+func decodeGenericRegionSegment(p []byte) (jbig2RegionInfo, *jbig2Bitmap, error) {
+
+	ri, err := parseJBIG2RegionInfo(p)
+	if err != nil {
+		return ri, nil, err
+	}
+
+	unknownHeight := be32(p[4:]) == 0xFFFFFFFF
+	p = p[17:]
+
+	if len(p) < 1 {
+		return ri, nil, errors.New("pdfcpu: jbig2: corrupt generic region")
+	}
+
+	gp := jbig2GenericParms{
+		mmr:      p[0]&0x01 > 0,
+		w:        ri.w,
+		h:        ri.h,
+		template: int(p[0] >> 1 & 0x03),
+		tpgdon:   p[0]&0x08 > 0,
+	}
+	p = p[1:]
+
+	if unknownHeight && len(p) >= 6 {
+		// Unknown height, use the row count following the end sequence.
+		gp.h = int(be32(p[len(p)-4:]))
+		ri.h = gp.h
+	}
+
+	if gp.mmr {
+		b, err := decodeGenericRegionMMR(p, gp.w, gp.h)
+		return ri, b, err
+	}
+
+	n := 4
+	if gp.template > 0 {
+		n = 1
+	}
+
+	if gp.at, err = parseJBIG2ATPixels(p, n); err != nil {
+		return ri, nil, err
+	}
+	p = p[2*n:]
+
+	d := newJBIG2ArithDecoder(p)
+
+	return ri, decodeGenericRegion(d, newJBIG2Contexts(1<<16), gp), nil
+}
+
+func (d *jbig2Decoder) processRefinementRegion(s *jbig2Segment) error {
+
+	ri, err := parseJBIG2RegionInfo(s.data)
+	if err != nil {
+		return err
+	}
+	p := s.data[17:]
+
+	if len(p) < 1 {
+		return errors.New("pdfcpu: jbig2: corrupt refinement region")
+	}
+
+	rp := jbig2RefinementParms{
+		w:        ri.w,
+		h:        ri.h,
+		template: int(p[0] & 0x01),
+		tpgron:   p[0]&0x02 > 0,
+	}
+	p = p[1:]
+
+	if rp.template == 0 {
+		if rp.at, err = parseJBIG2ATPixels(p, 2); err != nil {
+			return err
+		}
+		p = p[4:]
+	}
+
+	// The reference is either a referred intermediate region or the page area of this region.
+	for _, ref := range s.refs {
+		if r, ok := d.results[ref]; ok && r.region != nil {
+			rp.ref = r.region
+		}
+	}
+
+	if rp.ref == nil {
+		if d.page == nil {
+			return errors.New("pdfcpu: jbig2: missing page information")
+		}
+		rp.ref = d.page.region(ri.x, ri.y, ri.w, ri.h)
+	}
+
+	b := decodeRefinementRegion(newJBIG2ArithDecoder(p), newJBIG2Contexts(1<<13), rp)
+
+	return d.placeRegion(s, ri, b)
+}
@@ -0,0 +1,489 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// The arithmetic coder test sequence of T.88 Annex H.2
+var (
+	jbig2ArithTestData = []byte{
+		0x00, 0x02, 0x00, 0x51, 0x00, 0x00, 0x00, 0xC0, 0x03, 0x52, 0x87, 0x2A, 0xAA, 0xAA, 0xAA, 0xAA,
+		0x82, 0xC0, 0x20, 0x00, 0xFC, 0xD7, 0x9E, 0xF6, 0xBF, 0x7F, 0xED, 0x90, 0x4F, 0x46, 0xA3, 0xBF,
+	}
+	jbig2ArithTestCode = []byte{
+		0x84, 0xC7, 0x3B, 0xFC, 0xE1, 0xA1, 0x43, 0x04, 0x02, 0x20, 0x00, 0x00, 0x41, 0x0D, 0xBB, 0x86,
+		0xF4, 0x31, 0x7F, 0xFF, 0x88, 0xFF, 0x37, 0x47, 0x1A, 0xDB, 0x6A, 0xDF, 0xFF, 0xAC,
+	}
+)
+
+// mqEncoder is the MQ arithmetic encoder of T.88 Annex E.2 used to generate test data.
+type mqEncoder struct {
+	a, c uint32
+	ct   int
+	buf  []byte // buf[0] precedes the code.
+}
+
+func newMQEncoder() *mqEncoder {
+	return &mqEncoder{a: 0x8000, ct: 12, buf: []byte{0}}
+}
+
+func (e *mqEncoder) byteOut() {
+	last := len(e.buf) - 1
+	if e.buf[last] != 0xFF {
+		if e.c >= 0x8000000 {
+			// Carry
+			e.buf[last]++
+			e.c &= 0x7FFFFFF
+		}
+	}
+	if e.buf[last] == 0xFF {
+		e.buf = append(e.buf, byte(e.c>>20))
+		e.c &= 0xFFFFF
+		e.ct = 7
+		return
+	}
+	e.buf = append(e.buf, byte(e.c>>19))
+	e.c &= 0x7FFFF
+	e.ct = 8
+}
+
+func (e *mqEncoder) renorm() {
+	for {
+		e.a <<= 1
+		e.c <<= 1
+		e.ct--
+		if e.ct == 0 {
+			e.byteOut()
+		}
+		if e.a&0x8000 != 0 {
+			return
+		}
+	}
+}
+
+func (e *mqEncoder) encodeBit(cx jbig2Contexts, i, bit int) {
+
+	q := jbig2QeTable[cx[i]>>1]
+	mps := int(cx[i] & 1)
+
+	e.a -= q.qe
+
+	if bit == mps {
+		if e.a&0x8000 != 0 {
+			e.c += q.qe
+			return
+		}
+		if e.a < q.qe {
+			e.a = q.qe
+		} else {
+			e.c += q.qe
+		}
+		cx[i] = q.nmps<<1 | byte(mps)
+		e.renorm()
+		return
+	}
+
+	if e.a < q.qe {
+		e.c += q.qe
+	} else {
+		e.a = q.qe
+	}
+	if q.switchMPS {
+		mps = 1 - mps
+	}
+	cx[i] = q.nlps<<1 | byte(mps)
+	e.renorm()
+}
+
+func (e *mqEncoder) flush() []byte {
+	t := e.c + e.a
+	e.c |= 0xFFFF
+	if e.c >= t {
+		e.c -= 0x8000
+	}
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	if e.buf[len(e.buf)-1] != 0xFF {
+		e.buf = append(e.buf, 0xFF)
+	}
+	e.buf = append(e.buf, 0xAC)
+	return e.buf[1:]
+}
+
+// encodeInt encodes v using the integer arithmetic encoding procedure, oob encodes OOB.
+func (e *mqEncoder) encodeInt(id *jbig2IntDecoder, v int, oob bool) {
+
+	prev := 1
+	bit := func(b int) {
+		e.encodeBit(id.cx, prev, b)
+		if prev < 256 {
+			prev = prev<<1 | b
+		} else {
+			prev = (prev<<1|b)&511 | 256
+		}
+	}
+
+	s := 0
+	if v < 0 || oob {
+		s, v = 1, -v
+	}
+	bit(s)
+
+	ranges := []struct{ bits, offset int }{{2, 0}, {4, 4}, {6, 20}, {8, 84}, {12, 340}, {32, 4436}}
+
+	for i, r := range ranges {
+		if i < len(ranges)-1 && v >= r.offset+1<<uint(r.bits) {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			bit(1)
+		}
+		if i < len(ranges)-1 {
+			bit(0)
+		}
+		for j := r.bits - 1; j >= 0; j-- {
+			bit((v - r.offset) >> uint(j) & 1)
+		}
+		return
+	}
+}
+
+func (e *mqEncoder) encodeID(id *jbig2IDDecoder, v int) {
+	prev := 1
+	for i := int(id.codeLen) - 1; i >= 0; i-- {
+		b := v >> uint(i) & 1
+		e.encodeBit(id.cx, prev, b)
+		prev = prev<<1 | b
+	}
+}
+
+func (e *mqEncoder) encodeGenericRegion(cx jbig2Contexts, b *jbig2Bitmap, p jbig2GenericParms) {
+
+	t := p.templatePixels()
+	ltp := 0
+
+	for y := 0; y < b.h; y++ {
+
+		if p.tpgdon {
+			typical := 1
+			for x := 0; x < b.w; x++ {
+				if b.get(x, y) != b.get(x, y-1) {
+					typical = 0
+					break
+				}
+			}
+			e.encodeBit(cx, jbig2GenericSLTPContexts[p.template], ltp^typical)
+			ltp = typical
+			if ltp == 1 {
+				continue
+			}
+		}
+
+		for x := 0; x < b.w; x++ {
+			ctx := 0
+			for i, pt := range t {
+				ctx |= b.get(x+pt.x, y+pt.y) << uint(i)
+			}
+			e.encodeBit(cx, ctx, b.get(x, y))
+		}
+	}
+}
+
+func (e *mqEncoder) encodeRefinementRegion(cx jbig2Contexts, b *jbig2Bitmap, p jbig2RefinementParms) {
+	t := jbig2RefinementTemplates[p.template]
+	for y := 0; y < b.h; y++ {
+		for x := 0; x < b.w; x++ {
+			ctx := 0
+			for i, pt := range t {
+				if pt.ref {
+					ctx |= p.ref.get(x-p.dx+pt.x, y-p.dy+pt.y) << uint(i)
+				} else {
+					ctx |= b.get(x+pt.x, y+pt.y) << uint(i)
+				}
+			}
+			e.encodeBit(cx, ctx, b.get(x, y))
+		}
+	}
+}
+
+func be32Bytes(v int) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// jbig2SegmentBytes returns a segment with a one byte page association.
+func jbig2SegmentBytes(number, typ int, refs []int, data []byte) []byte {
+	b := append(be32Bytes(number), byte(typ), byte(len(refs)<<5))
+	for _, r := range refs {
+		b = append(b, byte(r))
+	}
+	b = append(b, 1)
+	b = append(b, be32Bytes(len(data))...)
+	return append(b, data...)
+}
+
+func jbig2PageInfoBytes(w, h int) []byte {
+	b := append(be32Bytes(w), be32Bytes(h)...)
+	b = append(b, make([]byte, 8)...)
+	return append(b, 0, 0, 0)
+}
+
+func jbig2RegionInfoBytes(w, h, x, y int) []byte {
+	b := append(be32Bytes(w), be32Bytes(h)...)
+	b = append(b, be32Bytes(x)...)
+	b = append(b, be32Bytes(y)...)
+	return append(b, jbig2OpOr)
+}
+
+// testBitmap returns a bitmap with 1 for black using the bilevel test image.
+func testBitmap(w, h int) *jbig2Bitmap {
+	b := newJBIG2Bitmap(w, h)
+	for i, c := range bilevel(w, h) {
+		b.data[i] = ^c
+	}
+	for y := 0; y < h; y++ {
+		// Clear padding.
+		for x := w; x < b.stride*8; x++ {
+			b.data[y*b.stride+x/8] &^= 0x80 >> uint(x%8)
+		}
+	}
+	return b
+}
+
+// checkJBIG2Page decodes data and compares the result with the page bitmap.
+func checkJBIG2Page(t *testing.T, globals, data []byte, page *jbig2Bitmap) {
+	t.Helper()
+
+	f := NewJBIG2Filter(nil, globals)
+
+	b := new(bytes.Buffer)
+	err := f.Decode(bytes.NewReader(data), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]byte, len(page.data))
+	for i, c := range page.data {
+		want[i] = ^c
+	}
+
+	comparePixels(t, b.Bytes(), want, page.w)
+}
+
+func TestJBIG2ArithDecoder(t *testing.T) {
+
+	d := newJBIG2ArithDecoder(jbig2ArithTestCode)
+	cx := newJBIG2Contexts(1)
+
+	for i, c := range jbig2ArithTestData {
+		var v byte
+		for j := 0; j < 8; j++ {
+			v = v<<1 | byte(d.decodeBit(cx, 0))
+		}
+		if v != c {
+			t.Fatalf("mismatch at %d: 0x%02x != 0x%02x", i, v, c)
+		}
+	}
+}
+
+func TestJBIG2ArithEncoder(t *testing.T) {
+
+	e := newMQEncoder()
+	cx := newJBIG2Contexts(1)
+
+	for _, c := range jbig2ArithTestData {
+		for j := 7; j >= 0; j-- {
+			e.encodeBit(cx, 0, int(c>>uint(j))&1)
+		}
+	}
+
+	compare(t, e.flush(), jbig2ArithTestCode)
+}
+
+func TestJBIG2GenericRegion(t *testing.T) {
+
+	const w, h = 133, 71
+
+	page := testBitmap(w, h)
+
+	for _, gp := range []jbig2GenericParms{
+		{template: 0, at: []jbig2Point{{3, -1}, {-3, -1}, {2, -2}, {-2, -2}}},
+		{template: 0, tpgdon: true, at: []jbig2Point{{-5, 0}, {4, -2}, {-7, -1}, {0, -3}}},
+		{template: 1, at: []jbig2Point{{3, -1}}},
+		{template: 2, tpgdon: true, at: []jbig2Point{{2, -1}}},
+		{template: 3, at: []jbig2Point{{-6, -1}}},
+		{mmr: true},
+	} {
+		gp.w, gp.h = w, h
+
+		flags := byte(gp.template << 1)
+		if gp.tpgdon {
+			flags |= 0x08
+		}
+
+		data := append(jbig2RegionInfoBytes(w, h, 0, 0), flags)
+
+		if gp.mmr {
+			data[len(data)-1] |= 0x01
+			rows := make([][]byte, h)
+			for y := range rows {
+				rows[y] = make([]byte, w)
+				for x := range rows[y] {
+					rows[y][x] = byte(page.get(x, y))
+				}
+			}
+			enc := ccittEncoder{ccittParms: ccittParms{k: -1, columns: w}}
+			data = append(data, enc.encode(rows)...)
+		} else {
+			for _, pt := range gp.at {
+				data = append(data, byte(pt.x), byte(pt.y))
+			}
+			e := newMQEncoder()
+			e.encodeGenericRegion(newJBIG2Contexts(1<<16), page, gp)
+			data = append(data, e.flush()...)
+		}
+
+		var p []byte
+		p = append(p, jbig2SegmentBytes(0, jbig2PageInformation, nil, jbig2PageInfoBytes(w, h))...)
+		p = append(p, jbig2SegmentBytes(1, jbig2ImmediateGenericRegion, nil, data)...)
+		p = append(p, jbig2SegmentBytes(2, jbig2EndOfPage, nil, nil)...)
+
+		checkJBIG2Page(t, nil, p, page)
+	}
+}
+
+func TestJBIG2SymbolsAndText(t *testing.T) {
+
+	// Three symbols in two height classes.
+	syms := []*jbig2Bitmap{testBitmap(9, 12), testBitmap(14, 12), testBitmap(11, 17)}
+
+	// Symbol dictionary in the global segments.
+	sd := []byte{0x00, 0x00, 3, 0xFF, 0xFD, 0xFF, 2, 0xFE, 0xFE, 0xFE}
+	sd = append(sd, be32Bytes(3)...)
+	sd = append(sd, be32Bytes(3)...)
+
+	e := newMQEncoder()
+	gb := newJBIG2Contexts(1 << 16)
+	iadh, iadw, iaex := newJBIG2IntDecoder(), newJBIG2IntDecoder(), newJBIG2IntDecoder()
+	gp := jbig2GenericParms{at: []jbig2Point{{3, -1}, {-3, -1}, {2, -2}, {-2, -2}}}
+
+	e.encodeInt(iadh, 12, false)
+	e.encodeInt(iadw, 9, false)
+	e.encodeGenericRegion(gb, syms[0], gp)
+	e.encodeInt(iadw, 5, false)
+	e.encodeGenericRegion(gb, syms[1], gp)
+	e.encodeInt(iadw, 0, true)
+	e.encodeInt(iadh, 5, false)
+	e.encodeInt(iadw, 11, false)
+	e.encodeGenericRegion(gb, syms[2], gp)
+	e.encodeInt(iadw, 0, true)
+	e.encodeInt(iaex, 0, false)
+	e.encodeInt(iaex, 3, false)
+
+	globals := jbig2SegmentBytes(0, jbig2SymbolDictionary, nil, append(sd, e.flush()...))
+
+	// Text region with refinement template 1 using symbol instances given by their top left corner.
+	const w, h = 80, 50
+
+	type instance struct {
+		id, s  int
+		refine bool
+	}
+
+	strips := []struct {
+		t    int
+		inst []instance
+	}{
+		{3, []instance{{0, 2, false}, {1, 12, true}, {2, 30, false}}},
+		{25, []instance{{2, 5, false}, {0, 20, false}}},
+		{33, []instance{{1, 60, false}}},
+	}
+
+	page := newJBIG2Bitmap(w, h)
+
+	e = newMQEncoder()
+	td := newJBIG2TextDecoders(jbig2CodeLen(len(syms)), newJBIG2Contexts(1<<13))
+
+	e.encodeInt(td.iadt, 0, false)
+	stripT, firstS := 0, 0
+	n := 0
+
+	for _, strip := range strips {
+		e.encodeInt(td.iadt, strip.t-stripT, false)
+		stripT = strip.t
+		curS := 0
+		for i, inst := range strip.inst {
+			if i == 0 {
+				e.encodeInt(td.iafs, inst.s-firstS, false)
+				firstS = inst.s
+			} else {
+				e.encodeInt(td.iads, inst.s-curS, false)
+			}
+			e.encodeID(td.iaid, inst.id)
+
+			ib := syms[inst.id]
+			if !inst.refine {
+				e.encodeInt(td.iari, 0, false)
+			} else {
+				// Add a black column to the right.
+				e.encodeInt(td.iari, 1, false)
+				e.encodeInt(td.iardw, 1, false)
+				e.encodeInt(td.iardh, 0, false)
+				e.encodeInt(td.iardx, 0, false)
+				e.encodeInt(td.iardy, 0, false)
+				rb := newJBIG2Bitmap(ib.w+1, ib.h)
+				rb.compose(ib, 0, 0, jbig2OpReplace)
+				for y := 0; y < rb.h; y++ {
+					rb.set(ib.w, y, 1)
+				}
+				e.encodeRefinementRegion(td.gr, rb, jbig2RefinementParms{template: 1, ref: ib})
+				ib = rb
+			}
+
+			page.compose(ib, inst.s, strip.t, jbig2OpOr)
+			curS = inst.s + ib.w - 1
+			n++
+		}
+		e.encodeInt(td.iads, 0, true)
+	}
+
+	// REFCORNER TOPLEFT, SBREFINE, SBRTEMPLATE 1
+	tr := append(jbig2RegionInfoBytes(w, h, 0, 0), 0x80, 0x12)
+	tr = append(tr, be32Bytes(n)...)
+	tr = append(tr, e.flush()...)
+
+	var p []byte
+	p = append(p, jbig2SegmentBytes(1, jbig2PageInformation, nil, jbig2PageInfoBytes(w, h))...)
+	p = append(p, jbig2SegmentBytes(2, jbig2ImmediateTextRegion, []int{0}, tr)...)
+	p = append(p, jbig2SegmentBytes(3, jbig2EndOfPage, nil, nil)...)
+
+	checkJBIG2Page(t, globals, p, page)
+}
+
+func TestJBIG2MissingPageInformation(t *testing.T) {
+
+	f := NewJBIG2Filter(nil, nil)
+
+	if err := f.Decode(bytes.NewReader(jbig2SegmentBytes(0, jbig2EndOfPage, nil, nil)), ioutil.Discard); err == nil {
+		t.Fatal("expected error for missing page information")
+	}
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Combination operators
+const (
+	jbig2OpOr = iota
+	jbig2OpAnd
+	jbig2OpXor
+	jbig2OpXNor
+	jbig2OpReplace
+)
+
+// jbig2Bitmap is a bilevel image with byte aligned rows where 1 means black.
+type jbig2Bitmap struct {
+	w, h   int
+	stride int
+	data   []byte
+}
+
+func newJBIG2Bitmap(w, h int) *jbig2Bitmap {
+	stride := (w + 7) / 8
+	return &jbig2Bitmap{w: w, h: h, stride: stride, data: make([]byte, stride*h)}
+}
+
+// get returns the pixel at x,y. Pixels outside the bitmap are 0.
+func (b *jbig2Bitmap) get(x, y int) int {
+	if x < 0 || y < 0 || x >= b.w || y >= b.h {
+		return 0
+	}
+	return int(b.data[y*b.stride+x/8]>>uint(7-x%8)) & 1
+}
+
+func (b *jbig2Bitmap) set(x, y, v int) {
+	if x < 0 || y < 0 || x >= b.w || y >= b.h {
+		return
+	}
+	m := byte(0x80) >> uint(x%8)
+	if v == 0 {
+		b.data[y*b.stride+x/8] &^= m
+	} else {
+		b.data[y*b.stride+x/8] |= m
+	}
+}
+
+func (b *jbig2Bitmap) fill(v int) {
+	c := byte(0)
+	if v == 1 {
+		c = 0xFF
+	}
+	for i := range b.data {
+		b.data[i] = c
+	}
+}
+
+// grow extends the height of b to h rows filled with v.
+func (b *jbig2Bitmap) grow(h, v int) {
+	if h <= b.h {
+		return
+	}
+	c := byte(0)
+	if v == 1 {
+		c = 0xFF
+	}
+	for i := b.h * b.stride; i < h*b.stride; i++ {
+		b.data = append(b.data, c)
+	}
+	b.h = h
+}
+
+// compose combines src into b at position x,y using the combination operator op.
+func (b *jbig2Bitmap) compose(src *jbig2Bitmap, x, y, op int) {
+
+	for sy := 0; sy < src.h; sy++ {
+		dy := y + sy
+		if dy < 0 || dy >= b.h {
+			continue
+		}
+		for sx := 0; sx < src.w; sx++ {
+			dx := x + sx
+			if dx < 0 || dx >= b.w {
+				continue
+			}
+			s, d := src.get(sx, sy), b.get(dx, dy)
+			switch op {
+			case jbig2OpOr:
+				d |= s
+			case jbig2OpAnd:
+				d &= s
+			case jbig2OpXor:
+				d ^= s
+			case jbig2OpXNor:
+				d = 1 - (d ^ s)
+			default:
+				d = s
+			}
+			b.set(dx, dy, d)
+		}
+	}
+}
+
+// region returns a copy of the w x h area at x,y.
+func (b *jbig2Bitmap) region(x, y, w, h int) *jbig2Bitmap {
+	r := newJBIG2Bitmap(w, h)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			r.set(i, j, b.get(x+i, y+j))
+		}
+	}
+	return r
+}
+
+// jbig2Point is a pixel offset relative to the pixel being decoded.
+type jbig2Point struct {
+	x, y int
+}
+
+// jbig2GenericTemplates lists the template pixels for generic region decoding from least to most significant context bit.
+// Adaptive template pixels are represented by their index into the AT pixels (See 6.2.5.3).
+var jbig2GenericTemplates = [4][]jbig2Point{
+	{{-1, 0}, {-2, 0}, {-3, 0}, {-4, 0}, {0, jbig2ATPixel}, {2, -1}, {1, -1}, {0, -1}, {-1, -1}, {-2, -1}, {1, jbig2ATPixel}, {2, jbig2ATPixel}, {1, -2}, {0, -2}, {-1, -2}, {3, jbig2ATPixel}},
+	{{-1, 0}, {-2, 0}, {-3, 0}, {0, jbig2ATPixel}, {2, -1}, {1, -1}, {0, -1}, {-1, -1}, {-2, -1}, {2, -2}, {1, -2}, {0, -2}, {-1, -2}},
+	{{-1, 0}, {-2, 0}, {0, jbig2ATPixel}, {1, -1}, {0, -1}, {-1, -1}, {-2, -1}, {1, -2}, {0, -2}, {-1, -2}},
+	{{-1, 0}, {-2, 0}, {-3, 0}, {-4, 0}, {0, jbig2ATPixel}, {1, -1}, {0, -1}, {-1, -1}, {-2, -1}, {-3, -1}},
+}
+
+// The marker for adaptive template pixels in the template tables.
+const jbig2ATPixel = 100
+
+// Contexts used for decoding SLTP (See 6.2.5.7).
+var jbig2GenericSLTPContexts = [4]int{0x9B25, 0x0795, 0x00E5, 0x0195}
+
+// jbig2GenericParms represents the parameters of the generic region decoding procedure (See Table 2).
+type jbig2GenericParms struct {
+	mmr      bool
+	w, h     int
+	template int
+	tpgdon   bool
+	at       []jbig2Point
+}
+
+// templatePixels resolves the adaptive template pixels.
+func (p jbig2GenericParms) templatePixels() []jbig2Point {
+	t := make([]jbig2Point, len(jbig2GenericTemplates[p.template]))
+	for i, pt := range jbig2GenericTemplates[p.template] {
+		if pt.y == jbig2ATPixel {
+			pt = p.at[pt.x]
+		}
+		t[i] = pt
+	}
+	return t
+}
+
+// decodeGenericRegion decodes a generic region using arithmetic decoding with contexts cx (See 6.2).
+func decodeGenericRegion(d *jbig2ArithDecoder, cx jbig2Contexts, p jbig2GenericParms) *jbig2Bitmap {
+
+	b := newJBIG2Bitmap(p.w, p.h)
+	t := p.templatePixels()
+
+	ltp := 0
+
+	for y := 0; y < p.h; y++ {
+
+		if p.tpgdon {
+			ltp ^= d.decodeBit(cx, jbig2GenericSLTPContexts[p.template])
+			if ltp == 1 {
+				// Typical prediction: copy the row above.
+				if y > 0 {
+					copy(b.data[y*b.stride:(y+1)*b.stride], b.data[(y-1)*b.stride:y*b.stride])
+				}
+				continue
+			}
+		}
+
+		for x := 0; x < p.w; x++ {
+			ctx := 0
+			for i, pt := range t {
+				ctx |= b.get(x+pt.x, y+pt.y) << uint(i)
+			}
+			if d.decodeBit(cx, ctx) == 1 {
+				b.set(x, y, 1)
+			}
+		}
+	}
+
+	return b
+}
+
+// decodeGenericRegionMMR decodes a generic region using MMR (Group 4) coding.
+func decodeGenericRegionMMR(p []byte, w, h int) (*jbig2Bitmap, error) {
+
+	d := ccittDecoder{
+		ccittParms: ccittParms{k: -1, columns: w, rows: h, blackIs1: true},
+		br:         ccittBitReader{p: p},
+	}
+
+	buf, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	b := newJBIG2Bitmap(w, h)
+	copy(b.data, buf.Bytes())
+
+	return b, nil
+}
+
+// jbig2RefinementTemplates lists the template pixels for generic refinement region decoding
+// from least to most significant context bit. Pixels with ref set are taken from the reference bitmap (See 6.3.5.3).
+var jbig2RefinementTemplates = [2][]struct {
+	jbig2Point
+	ref bool
+}{
+	{
+		{jbig2Point{-1, 0}, false}, {jbig2Point{1, -1}, false}, {jbig2Point{0, -1}, false}, {jbig2Point{0, jbig2ATPixel}, false},
+		{jbig2Point{1, 1}, true}, {jbig2Point{0, 1}, true}, {jbig2Point{-1, 1}, true},
+		{jbig2Point{1, 0}, true}, {jbig2Point{0, 0}, true}, {jbig2Point{-1, 0}, true},
+		{jbig2Point{1, -1}, true}, {jbig2Point{0, -1}, true}, {jbig2Point{1, jbig2ATPixel}, true},
+	},
+	{
+		{jbig2Point{-1, 0}, false}, {jbig2Point{1, -1}, false}, {jbig2Point{0, -1}, false}, {jbig2Point{-1, -1}, false},
+		{jbig2Point{1, 1}, true}, {jbig2Point{0, 1}, true},
+		{jbig2Point{1, 0}, true}, {jbig2Point{0, 0}, true}, {jbig2Point{-1, 0}, true},
+		{jbig2Point{0, -1}, true},
+	},
+}
+
+// Contexts used for decoding SLTP (See 6.3.5.6).
+var jbig2RefinementSLTPContexts = [2]int{0x0100, 0x0080}
+
+// jbig2RefinementParms represents the parameters of the generic refinement region decoding procedure (See Table 6).
+type jbig2RefinementParms struct {
+	w, h     int
+	template int
+	ref      *jbig2Bitmap
+	dx, dy   int
+	tpgron   bool
+	at       []jbig2Point
+}
+
+// decodeRefinementRegion decodes a generic refinement region using contexts cx (See 6.3).
+func decodeRefinementRegion(d *jbig2ArithDecoder, cx jbig2Contexts, p jbig2RefinementParms) *jbig2Bitmap {
+
+	b := newJBIG2Bitmap(p.w, p.h)
+
+	t := jbig2RefinementTemplates[p.template]
+	pts := make([]jbig2Point, len(t))
+	for i, pt := range t {
+		if pt.y == jbig2ATPixel {
+			pt.jbig2Point = p.at[pt.x]
+		}
+		pts[i] = pt.jbig2Point
+	}
+
+	decodePixel := func(x, y int) {
+		ctx := 0
+		for i, pt := range pts {
+			var v int
+			if t[i].ref {
+				v = p.ref.get(x-p.dx+pt.x, y-p.dy+pt.y)
+			} else {
+				v = b.get(x+pt.x, y+pt.y)
+			}
+			ctx |= v << uint(i)
+		}
+		if d.decodeBit(cx, ctx) == 1 {
+			b.set(x, y, 1)
+		}
+	}
+
+	// typical returns the pixel value if the 3x3 reference neighborhood is uniform.
+	typical := func(x, y int) (int, bool) {
+		rx, ry := x-p.dx, y-p.dy
+		v := p.ref.get(rx, ry)
+		for j := -1; j <= 1; j++ {
+			for i := -1; i <= 1; i++ {
+				if p.ref.get(rx+i, ry+j) != v {
+					return 0, false
+				}
+			}
+		}
+		return v, true
+	}
+
+	ltp := 0
+
+	for y := 0; y < p.h; y++ {
+
+		if p.tpgron {
+			ltp ^= d.decodeBit(cx, jbig2RefinementSLTPContexts[p.template])
+		}
+
+		for x := 0; x < p.w; x++ {
+			if ltp == 1 {
+				if v, ok := typical(x, y); ok {
+					b.set(x, y, v)
+					continue
+				}
+			}
+			decodePixel(x, y)
+		}
+	}
+
+	return b
+}
+
+// jbig2RegionInfo represents a region segment information field (See 7.4.1).
+type jbig2RegionInfo struct {
+	w, h, x, y int
+	op         int
+}
+
+func parseJBIG2RegionInfo(p []byte) (jbig2RegionInfo, error) {
+
+	if len(p) < 17 {
+		return jbig2RegionInfo{}, errors.New("pdfcpu: jbig2: corrupt region segment information")
+	}
+
+	return jbig2RegionInfo{
+		w:  int(be32(p[0:])),
+		h:  int(be32(p[4:])),
+		x:  int(be32(p[8:])),
+		y:  int(be32(p[12:])),
+		op: int(p[16] & 0x07),
+	}, nil
+}
+
+func be32(p []byte) uint32 {
+	return uint32(p[0])<<24 | uint32(p[1])<<16 | uint32(p[2])<<8 | uint32(p[3])
+}
+
+// parseJBIG2ATPixels parses n AT pixels represented by signed bytes.
+func parseJBIG2ATPixels(p []byte, n int) ([]jbig2Point, error) {
+
+	if len(p) < 2*n {
+		return nil, errors.New("pdfcpu: jbig2: corrupt AT pixels")
+	}
+
+	at := make([]jbig2Point, n)
+	for i := range at {
+		at[i] = jbig2Point{int(int8(p[2*i])), int(int8(p[2*i+1]))}
+	}
+
+	return at, nil
+}
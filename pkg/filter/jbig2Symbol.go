@@ -0,0 +1,485 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Reference corners
+const (
+	jbig2CornerBottomLeft = iota
+	jbig2CornerTopLeft
+	jbig2CornerBottomRight
+	jbig2CornerTopRight
+)
+
+var errJBIG2Huffman = errors.New("pdfcpu: jbig2: huffman coding not supported")
+
+// jbig2TextDecoders holds the integer decoders used by the text region decoding procedure.
+// Symbol dictionaries using refinement/aggregate coding share them with their embedded text regions.
+type jbig2TextDecoders struct {
+	iadt, iafs, iads, iait           *jbig2IntDecoder
+	iari, iardw, iardh, iardx, iardy *jbig2IntDecoder
+	iaid                             *jbig2IDDecoder
+	gr                               jbig2Contexts
+}
+
+func newJBIG2TextDecoders(symCodeLen uint, gr jbig2Contexts) *jbig2TextDecoders {
+	return &jbig2TextDecoders{
+		iadt:  newJBIG2IntDecoder(),
+		iafs:  newJBIG2IntDecoder(),
+		iads:  newJBIG2IntDecoder(),
+		iait:  newJBIG2IntDecoder(),
+		iari:  newJBIG2IntDecoder(),
+		iardw: newJBIG2IntDecoder(),
+		iardh: newJBIG2IntDecoder(),
+		iardx: newJBIG2IntDecoder(),
+		iardy: newJBIG2IntDecoder(),
+		iaid:  newJBIG2IDDecoder(symCodeLen),
+		gr:    gr,
+	}
+}
+
+// jbig2TextParms represents the parameters of the text region decoding procedure (See Table 9).
+type jbig2TextParms struct {
+	w, h         int
+	numInstances int
+	strips       int
+	syms         []*jbig2Bitmap
+	defPixel     int
+	combOp       int
+	transposed   bool
+	refCorner    int
+	dsOffset     int
+	refine       bool
+	rTemplate    int
+	rAT          []jbig2Point
+}
+
+func decodeInt(d *jbig2ArithDecoder, id *jbig2IntDecoder) (int, error) {
+	v, ok := id.decode(d)
+	if !ok {
+		return 0, errors.New("pdfcpu: jbig2: unexpected OOB")
+	}
+	return v, nil
+}
+
+// decodeTextRegion decodes a text region using arithmetic coding (See 6.4).
+func decodeTextRegion(d *jbig2ArithDecoder, td *jbig2TextDecoders, p jbig2TextParms) (*jbig2Bitmap, error) {
+
+	b := newJBIG2Bitmap(p.w, p.h)
+	b.fill(p.defPixel)
+
+	dt, err := decodeInt(d, td.iadt)
+	if err != nil {
+		return nil, err
+	}
+	stripT := -dt * p.strips
+	firstS := 0
+
+	for n := 0; n < p.numInstances; {
+
+		dt, err := decodeInt(d, td.iadt)
+		if err != nil {
+			return nil, err
+		}
+		stripT += dt * p.strips
+
+		curS := 0
+
+		for first := true; ; first = false {
+
+			if first {
+				dfs, err := decodeInt(d, td.iafs)
+				if err != nil {
+					return nil, err
+				}
+				firstS += dfs
+				curS = firstS
+			} else {
+				ids, ok := td.iads.decode(d)
+				if !ok {
+					// End of strip.
+					break
+				}
+				if n == p.numInstances {
+					return nil, errors.New("pdfcpu: jbig2: too many symbol instances")
+				}
+				curS += ids + p.dsOffset
+			}
+
+			curT := 0
+			if p.strips > 1 {
+				if curT, err = decodeInt(d, td.iait); err != nil {
+					return nil, err
+				}
+			}
+			t := stripT + curT
+
+			id := td.iaid.decode(d)
+			if id < 0 || id >= len(p.syms) {
+				return nil, errors.Errorf("pdfcpu: jbig2: invalid symbol id %d", id)
+			}
+
+			ib := p.syms[id]
+
+			ri := 0
+			if p.refine {
+				if ri, err = decodeInt(d, td.iari); err != nil {
+					return nil, err
+				}
+			}
+
+			if ri != 0 {
+				if ib, err = refineSymbol(d, td, ib, p); err != nil {
+					return nil, err
+				}
+			}
+
+			if !p.transposed && p.refCorner > jbig2CornerTopLeft {
+				curS += ib.w - 1
+			} else if p.transposed && p.refCorner&1 == 0 {
+				curS += ib.h - 1
+			}
+
+			s := curS
+
+			var x, y int
+			if p.transposed {
+				x, y = t, s
+			} else {
+				x, y = s, t
+			}
+			if p.refCorner&1 == 0 {
+				// Bottom
+				y -= ib.h - 1
+			}
+			if p.refCorner > jbig2CornerTopLeft {
+				// Right
+				x -= ib.w - 1
+			}
+
+			b.compose(ib, x, y, p.combOp)
+
+			if !p.transposed && p.refCorner < jbig2CornerBottomRight {
+				curS += ib.w - 1
+			} else if p.transposed && p.refCorner&1 == 1 {
+				curS += ib.h - 1
+			}
+
+			n++
+		}
+	}
+
+	return b, nil
+}
+
+// refineSymbol decodes a refined symbol instance bitmap (See 6.4.11.3).
+func refineSymbol(d *jbig2ArithDecoder, td *jbig2TextDecoders, ibo *jbig2Bitmap, p jbig2TextParms) (*jbig2Bitmap, error) {
+
+	var v [4]int
+
+	for i, id := range []*jbig2IntDecoder{td.iardw, td.iardh, td.iardx, td.iardy} {
+		var err error
+		if v[i], err = decodeInt(d, id); err != nil {
+			return nil, err
+		}
+	}
+
+	rdw, rdh, rdx, rdy := v[0], v[1], v[2], v[3]
+
+	w, h := ibo.w+rdw, ibo.h+rdh
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("pdfcpu: jbig2: invalid refinement size")
+	}
+
+	return decodeRefinementRegion(d, td.gr, jbig2RefinementParms{
+		w:        w,
+		h:        h,
+		template: p.rTemplate,
+		ref:      ibo,
+		dx:       rdw>>1 + rdx,
+		dy:       rdh>>1 + rdy,
+		at:       p.rAT,
+	}), nil
+}
+
+// jbig2SymbolDict represents the result of a symbol dictionary segment.
+type jbig2SymbolDict struct {
+	exported []*jbig2Bitmap
+
+	// The arithmetic coding statistics retained for following symbol dictionaries.
+	gb, gr jbig2Contexts
+}
+
+// decodeSymbolDict decodes a symbol dictionary segment given the input symbols
+// and optionally the coding statistics of a preceding symbol dictionary (See 7.4.2).
+func decodeSymbolDict(p []byte, inSyms []*jbig2Bitmap, last *jbig2SymbolDict) (*jbig2SymbolDict, error) {
+
+	if len(p) < 2 {
+		return nil, errors.New("pdfcpu: jbig2: corrupt symbol dictionary")
+	}
+
+	flags := int(p[0])<<8 | int(p[1])
+	p = p[2:]
+
+	huff := flags&0x01 > 0
+	refAgg := flags&0x02 > 0
+	ctxUsed := flags&0x100 > 0
+	ctxRetained := flags&0x200 > 0
+	template := flags >> 10 & 0x03
+	rTemplate := flags >> 12 & 0x01
+
+	if huff {
+		return nil, errJBIG2Huffman
+	}
+
+	n := 4
+	if template > 0 {
+		n = 1
+	}
+
+	at, err := parseJBIG2ATPixels(p, n)
+	if err != nil {
+		return nil, err
+	}
+	p = p[2*n:]
+
+	var rAT []jbig2Point
+	if refAgg && rTemplate == 0 {
+		if rAT, err = parseJBIG2ATPixels(p, 2); err != nil {
+			return nil, err
+		}
+		p = p[4:]
+	}
+
+	if len(p) < 8 {
+		return nil, errors.New("pdfcpu: jbig2: corrupt symbol dictionary")
+	}
+
+	numExSyms := int(be32(p))
+	numNewSyms := int(be32(p[4:]))
+	p = p[8:]
+
+	gb := newJBIG2Contexts(1 << 16)
+	gr := newJBIG2Contexts(1 << 13)
+
+	if ctxUsed && last != nil && last.gb != nil {
+		copy(gb, last.gb)
+		copy(gr, last.gr)
+	}
+
+	d := newJBIG2ArithDecoder(p)
+
+	iadh := newJBIG2IntDecoder()
+	iadw := newJBIG2IntDecoder()
+	iaex := newJBIG2IntDecoder()
+	iaai := newJBIG2IntDecoder()
+
+	numSyms := len(inSyms) + numNewSyms
+	td := newJBIG2TextDecoders(jbig2CodeLen(numSyms), gr)
+
+	syms := make([]*jbig2Bitmap, len(inSyms), numSyms)
+	copy(syms, inSyms)
+
+	hcHeight := 0
+
+	for len(syms) < numSyms {
+
+		dh, err := decodeInt(d, iadh)
+		if err != nil {
+			return nil, err
+		}
+
+		hcHeight += dh
+		if hcHeight <= 0 {
+			return nil, errors.New("pdfcpu: jbig2: invalid symbol height")
+		}
+
+		symWidth := 0
+
+		for {
+
+			dw, ok := iadw.decode(d)
+			if !ok {
+				// End of height class.
+				break
+			}
+
+			if len(syms) == numSyms {
+				return nil, errors.New("pdfcpu: jbig2: too many symbols")
+			}
+
+			symWidth += dw
+			if symWidth <= 0 {
+				return nil, errors.New("pdfcpu: jbig2: invalid symbol width")
+			}
+
+			if !refAgg {
+				syms = append(syms, decodeGenericRegion(d, gb, jbig2GenericParms{w: symWidth, h: hcHeight, template: template, at: at}))
+				continue
+			}
+
+			sym, err := decodeAggregateSymbol(d, iaai, td, syms, symWidth, hcHeight, rTemplate, rAT)
+			if err != nil {
+				return nil, err
+			}
+
+			syms = append(syms, sym)
+		}
+	}
+
+	// Exported symbols (See 6.5.10)
+	sd := &jbig2SymbolDict{}
+
+	export := false
+	for i := 0; i < numSyms; {
+		runLength, err := decodeInt(d, iaex)
+		if err != nil {
+			return nil, err
+		}
+		if runLength < 0 || i+runLength > numSyms {
+			return nil, errors.New("pdfcpu: jbig2: invalid export run length")
+		}
+		if export {
+			sd.exported = append(sd.exported, syms[i:i+runLength]...)
+		}
+		i += runLength
+		export = !export
+	}
+
+	if len(sd.exported) != numExSyms {
+		return nil, errors.Errorf("pdfcpu: jbig2: expected %d exported symbols, got %d", numExSyms, len(sd.exported))
+	}
+
+	if ctxRetained {
+		sd.gb, sd.gr = gb, gr
+	}
+
+	return sd, nil
+}
+
+// decodeAggregateSymbol decodes a symbol bitmap using refinement/aggregate coding (See 6.5.8.2).
+func decodeAggregateSymbol(d *jbig2ArithDecoder, iaai *jbig2IntDecoder, td *jbig2TextDecoders, syms []*jbig2Bitmap, w, h, rTemplate int, rAT []jbig2Point) (*jbig2Bitmap, error) {
+
+	numInst, err := decodeInt(d, iaai)
+	if err != nil {
+		return nil, err
+	}
+
+	if numInst > 1 {
+		return decodeTextRegion(d, td, jbig2TextParms{
+			w:            w,
+			h:            h,
+			numInstances: numInst,
+			strips:       1,
+			syms:         syms,
+			combOp:       jbig2OpOr,
+			refCorner:    jbig2CornerTopLeft,
+			refine:       true,
+			rTemplate:    rTemplate,
+			rAT:          rAT,
+		})
+	}
+
+	id := td.iaid.decode(d)
+	if id < 0 || id >= len(syms) {
+		return nil, errors.Errorf("pdfcpu: jbig2: invalid symbol id %d", id)
+	}
+
+	rdx, err := decodeInt(d, td.iardx)
+	if err != nil {
+		return nil, err
+	}
+
+	rdy, err := decodeInt(d, td.iardy)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRefinementRegion(d, td.gr, jbig2RefinementParms{
+		w:        w,
+		h:        h,
+		template: rTemplate,
+		ref:      syms[id],
+		dx:       rdx,
+		dy:       rdy,
+		at:       rAT,
+	}), nil
+}
+
+// decodeTextRegionSegment decodes the data of a text region segment using the symbols of the referred symbol dictionaries (See 7.4.3).
+func decodeTextRegionSegment(p []byte, syms []*jbig2Bitmap) (jbig2RegionInfo, *jbig2Bitmap, error) {
+
+	ri, err := parseJBIG2RegionInfo(p)
+	if err != nil {
+		return ri, nil, err
+	}
+	p = p[17:]
+
+	if len(p) < 2 {
+		return ri, nil, errors.New("pdfcpu: jbig2: corrupt text region")
+	}
+
+	flags := int(p[0])<<8 | int(p[1])
+	p = p[2:]
+
+	if flags&0x01 > 0 {
+		return ri, nil, errJBIG2Huffman
+	}
+
+	tp := jbig2TextParms{
+		w:          ri.w,
+		h:          ri.h,
+		syms:       syms,
+		refine:     flags&0x02 > 0,
+		strips:     1 << uint(flags>>2&0x03),
+		refCorner:  flags >> 4 & 0x03,
+		transposed: flags&0x40 > 0,
+		combOp:     flags >> 7 & 0x03,
+		defPixel:   flags >> 9 & 0x01,
+		dsOffset:   flags >> 10 & 0x1F,
+		rTemplate:  flags >> 15 & 0x01,
+	}
+
+	if tp.dsOffset > 0x0F {
+		// 5 bit signed integer
+		tp.dsOffset -= 0x20
+	}
+
+	if tp.refine && tp.rTemplate == 0 {
+		if tp.rAT, err = parseJBIG2ATPixels(p, 2); err != nil {
+			return ri, nil, err
+		}
+		p = p[4:]
+	}
+
+	if len(p) < 4 {
+		return ri, nil, errors.New("pdfcpu: jbig2: corrupt text region")
+	}
+
+	tp.numInstances = int(be32(p))
+	p = p[4:]
+
+	d := newJBIG2ArithDecoder(p)
+	td := newJBIG2TextDecoders(jbig2CodeLen(len(syms)), newJBIG2Contexts(1<<13))
+
+	b, err := decodeTextRegion(d, td, tp)
+
+	return ri, b, err
+}
@@ -0,0 +1,454 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+// This file implements the code-block decoding of JPEG 2000 (See ITU-T T.800 Annex D).
+// The MQ arithmetic decoder of JPEG 2000 is the one used by JBIG2 (See jbig2Arith.go).
+
+// Sub-band orientations
+const (
+	jpxLL = iota
+	jpxHL
+	jpxLH
+	jpxHH
+)
+
+// Context labels (See Table D.7)
+const (
+	jpxCtxSC      = 9
+	jpxCtxMR      = 14
+	jpxCtxRL      = 17
+	jpxCtxUniform = 18
+	jpxNumCtx     = 19
+)
+
+// Coding pass types
+const (
+	jpxSignificancePass = iota
+	jpxRefinementPass
+	jpxCleanupPass
+)
+
+// Sample states
+const (
+	jpxSig     = 0x01 // significant
+	jpxNeg     = 0x02 // negative sign
+	jpxVisit   = 0x04 // coded in the significance propagation pass of the current bit-plane
+	jpxRefined = 0x08 // magnitude refinement has taken place
+)
+
+// jpxRawDecoder reads the uncoded bits of coding passes using the selective arithmetic coding bypass.
+type jpxRawDecoder struct {
+	p   []byte
+	pos int
+	c   byte
+	ct  uint
+}
+
+func (d *jpxRawDecoder) decodeBit() int {
+	if d.ct == 0 {
+		b := byte(0xFF)
+		if d.pos < len(d.p) {
+			b = d.p[d.pos]
+		}
+		if d.c == 0xFF {
+			// Skip the stuffed bit following 0xFF.
+			if b > 0x8F {
+				d.c, d.ct = 0xFF, 8
+			} else {
+				d.c, d.ct = b, 7
+				d.pos++
+			}
+		} else {
+			d.c, d.ct = b, 8
+			d.pos++
+		}
+	}
+	d.ct--
+	return int(d.c>>d.ct) & 1
+}
+
+// jpxBlockDecoder decodes the coding passes of code-blocks.
+type jpxBlockDecoder struct {
+	w, h   int
+	stride int
+	band   int
+	style  int
+	flags  []byte  // sample states with a border of one sample
+	mag    []int32 // sample magnitudes
+	cx     jbig2Contexts
+	mq     *jbig2ArithDecoder
+	raw    *jpxRawDecoder
+}
+
+func (d *jpxBlockDecoder) resetContexts() {
+	for i := range d.cx {
+		d.cx[i] = 0
+	}
+	// Initial states (See Table D.7)
+	d.cx[0] = 4 << 1
+	d.cx[jpxCtxRL] = 3 << 1
+	d.cx[jpxCtxUniform] = 46 << 1
+}
+
+func (d *jpxBlockDecoder) decodeBit(ctx int) int {
+	if d.raw != nil {
+		return d.raw.decodeBit()
+	}
+	return d.mq.decodeBit(d.cx, ctx)
+}
+
+// neighbours returns the number of significant horizontal, vertical and diagonal neighbours of sample j.
+// The samples below are ignored for vertically causal context formation.
+func (d *jpxBlockDecoder) neighbours(j int, causal bool) (h, v, dg int) {
+	f, s := d.flags, d.stride
+	h = int(f[j-1]&jpxSig + f[j+1]&jpxSig)
+	v = int(f[j-s] & jpxSig)
+	dg = int(f[j-s-1]&jpxSig + f[j-s+1]&jpxSig)
+	if !causal {
+		v += int(f[j+s] & jpxSig)
+		dg += int(f[j+s-1]&jpxSig + f[j+s+1]&jpxSig)
+	}
+	return h, v, dg
+}
+
+// jpxZCContext returns the zero coding context (See Table D.1).
+func jpxZCContext(h, v, d, band int) int {
+
+	switch band {
+
+	case jpxHL:
+		h, v = v, h
+
+	case jpxHH:
+		hv := h + v
+		switch d {
+		case 0:
+			if hv > 2 {
+				return 2
+			}
+			return hv
+		case 1:
+			if hv > 2 {
+				return 5
+			}
+			return 3 + hv
+		case 2:
+			if hv > 0 {
+				return 7
+			}
+			return 6
+		}
+		return 8
+	}
+
+	switch h {
+	case 0:
+		if v > 0 {
+			return 2 + v
+		}
+		if d > 1 {
+			return 2
+		}
+		return d
+	case 1:
+		if v > 0 {
+			return 7
+		}
+		if d > 0 {
+			return 6
+		}
+		return 5
+	}
+
+	return 8
+}
+
+// signContribution returns the contribution of sample j to sign context formation.
+func (d *jpxBlockDecoder) signContribution(j int) int {
+	switch d.flags[j] & (jpxSig | jpxNeg) {
+	case jpxSig:
+		return 1
+	case jpxSig | jpxNeg:
+		return -1
+	}
+	return 0
+}
+
+// signContext returns the sign coding context and the XOR bit for sample j (See Table D.3).
+func (d *jpxBlockDecoder) signContext(j int, causal bool) (int, int) {
+
+	h := d.signContribution(j-1) + d.signContribution(j+1)
+	v := d.signContribution(j - d.stride)
+	if !causal {
+		v += d.signContribution(j + d.stride)
+	}
+	h, v = jpxClamp(h), jpxClamp(v)
+
+	xor := 0
+	if h < 0 || h == 0 && v < 0 {
+		h, v, xor = -h, -v, 1
+	}
+
+	if h == 0 {
+		return jpxCtxSC + v, xor
+	}
+
+	return jpxCtxSC + 3 + v, xor
+}
+
+// decodeSign decodes the sign of sample j which just became significant at bit-plane p.
+func (d *jpxBlockDecoder) decodeSign(j, i int, p uint, causal bool) {
+
+	var s int
+
+	if d.raw != nil {
+		s = d.raw.decodeBit()
+	} else {
+		ctx, xor := d.signContext(j, causal)
+		s = d.mq.decodeBit(d.cx, ctx) ^ xor
+	}
+
+	d.flags[j] |= jpxSig
+	if s == 1 {
+		d.flags[j] |= jpxNeg
+	}
+	d.mag[i] |= 1 << p
+}
+
+func jpxClamp(v int) int {
+	if v > 1 {
+		return 1
+	}
+	if v < -1 {
+		return -1
+	}
+	return v
+}
+
+// forEach calls fn for all samples in stripe order.
+func (d *jpxBlockDecoder) forEach(fn func(x, y, j, i int, causal bool)) {
+	vsc := d.style&jpxVertCausal != 0
+	for y0 := 0; y0 < d.h; y0 += 4 {
+		for x := 0; x < d.w; x++ {
+			for y := y0; y < y0+4 && y < d.h; y++ {
+				fn(x, y, (y+1)*d.stride+x+1, y*d.w+x, vsc && y&3 == 3)
+			}
+		}
+	}
+}
+
+// significancePass decodes a significance propagation pass for bit-plane p (See D.3.1).
+func (d *jpxBlockDecoder) significancePass(p uint) {
+	d.forEach(func(x, y, j, i int, causal bool) {
+		if d.flags[j]&jpxSig != 0 {
+			return
+		}
+		h, v, dg := d.neighbours(j, causal)
+		if h+v+dg == 0 {
+			return
+		}
+		d.flags[j] |= jpxVisit
+		if d.decodeBit(jpxZCContext(h, v, dg, d.band)) == 1 {
+			d.decodeSign(j, i, p, causal)
+		}
+	})
+}
+
+// refinementPass decodes a magnitude refinement pass for bit-plane p (See D.3.3).
+func (d *jpxBlockDecoder) refinementPass(p uint) {
+	d.forEach(func(x, y, j, i int, causal bool) {
+		if d.flags[j]&(jpxSig|jpxVisit) != jpxSig {
+			return
+		}
+		ctx := jpxCtxMR + 2
+		if d.flags[j]&jpxRefined == 0 {
+			ctx = jpxCtxMR
+			if h, v, dg := d.neighbours(j, causal); h+v+dg > 0 {
+				ctx++
+			}
+		}
+		d.mag[i] |= int32(d.decodeBit(ctx)) << p
+		d.flags[j] |= jpxRefined
+	})
+}
+
+// cleanupPass decodes a cleanup pass for bit-plane p (See D.3.4).
+func (d *jpxBlockDecoder) cleanupPass(p uint) {
+
+	vsc := d.style&jpxVertCausal != 0
+
+	for y0 := 0; y0 < d.h; y0 += 4 {
+		for x := 0; x < d.w; x++ {
+
+			y := y0
+
+			if y0+4 <= d.h && d.runMode(x, y0, vsc) {
+				if d.mq.decodeBit(d.cx, jpxCtxRL) == 0 {
+					continue
+				}
+				y += d.mq.decodeBit(d.cx, jpxCtxUniform) << 1
+				y += d.mq.decodeBit(d.cx, jpxCtxUniform)
+				d.decodeSign((y+1)*d.stride+x+1, y*d.w+x, p, vsc && y&3 == 3)
+				y++
+			}
+
+			for ; y < y0+4 && y < d.h; y++ {
+				j := (y+1)*d.stride + x + 1
+				if d.flags[j]&(jpxSig|jpxVisit) != 0 {
+					continue
+				}
+				causal := vsc && y&3 == 3
+				h, v, dg := d.neighbours(j, causal)
+				if d.mq.decodeBit(d.cx, jpxZCContext(h, v, dg, d.band)) == 1 {
+					d.decodeSign(j, y*d.w+x, p, causal)
+				}
+			}
+		}
+	}
+
+	for i := range d.flags {
+		d.flags[i] &^= jpxVisit
+	}
+
+	if d.style&jpxSegSymbols != 0 {
+		for i := 0; i < 4; i++ {
+			d.mq.decodeBit(d.cx, jpxCtxUniform)
+		}
+	}
+}
+
+// runMode returns true if the four samples of a stripe column are insignificant and have insignificant neighbours.
+func (d *jpxBlockDecoder) runMode(x, y0 int, vsc bool) bool {
+	for y := y0; y < y0+4; y++ {
+		j := (y+1)*d.stride + x + 1
+		if d.flags[j]&(jpxSig|jpxVisit) != 0 {
+			return false
+		}
+		if h, v, dg := d.neighbours(j, vsc && y&3 == 3); h+v+dg > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isRawPass returns true if pass is not arithmetically coded due to the selective arithmetic coding bypass.
+func jpxIsRawPass(style, pass int) bool {
+	return style&jpxBypass != 0 && pass >= 10 && pass%3 != 0
+}
+
+// decode decodes the coding passes of a code-block into coefficient values.
+// planes is the number of magnitude bit-planes of the sub-band minus the missing most significant bit-planes.
+func (d *jpxBlockDecoder) decode(cb *jpxCodeBlock, planes int, out func(x, y int, v int32)) {
+
+	d.w, d.h = cb.x1-cb.x0, cb.y1-cb.y0
+	d.stride = d.w + 2
+
+	n := d.w * d.h
+	if cap(d.mag) < n {
+		d.mag = make([]int32, n)
+	}
+	d.mag = d.mag[:n]
+	for i := range d.mag {
+		d.mag[i] = 0
+	}
+
+	m := d.stride * (d.h + 2)
+	if cap(d.flags) < m {
+		d.flags = make([]byte, m)
+	}
+	d.flags = d.flags[:m]
+	for i := range d.flags {
+		d.flags[i] = 0
+	}
+
+	if d.cx == nil {
+		d.cx = newJBIG2Contexts(jpxNumCtx)
+	}
+	d.resetContexts()
+
+	if planes <= 0 {
+		return
+	}
+
+	p := planes - 1
+	typ := jpxCleanupPass
+	pass := 0
+
+	for _, seg := range cb.segs {
+
+		d.mq, d.raw = nil, nil
+		if jpxIsRawPass(d.style, pass) {
+			d.raw = &jpxRawDecoder{p: seg.data}
+		} else {
+			d.mq = newJBIG2ArithDecoder(seg.data)
+		}
+
+		for k := 0; k < seg.passes && p >= 0; k++ {
+
+			switch typ {
+			case jpxSignificancePass:
+				d.significancePass(uint(p))
+			case jpxRefinementPass:
+				d.refinementPass(uint(p))
+			case jpxCleanupPass:
+				d.cleanupPass(uint(p))
+			}
+
+			if d.style&jpxReset != 0 {
+				d.resetContexts()
+			}
+
+			if typ == jpxCleanupPass {
+				if p == 0 {
+					p = -1
+					break
+				}
+				p--
+			}
+			typ = (typ + 1) % 3
+			pass++
+		}
+	}
+
+	// The bit-plane of the last decoded pass.
+	last := p
+	if typ == jpxSignificancePass {
+		last++
+	}
+	if last < 0 {
+		last = 0
+	}
+
+	for y := 0; y < d.h; y++ {
+		for x := 0; x < d.w; x++ {
+			i := y*d.w + x
+			v := d.mag[i]
+			if v == 0 {
+				continue
+			}
+			if last > 0 {
+				// Reconstruct at the middle of the quantization interval.
+				v |= 1 << uint(last-1)
+			}
+			if d.flags[(y+1)*d.stride+x+1]&jpxNeg != 0 {
+				v = -v
+			}
+			out(x, y, v)
+		}
+	}
+}
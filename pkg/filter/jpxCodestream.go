@@ -0,0 +1,615 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// This file implements the parsing of JPEG 2000 codestreams (See ITU-T T.800 Annex A).
+
+// Codestream markers (See Table A.2)
+const (
+	jpxSOC = 0xFF4F
+	jpxSIZ = 0xFF51
+	jpxCOD = 0xFF52
+	jpxCOC = 0xFF53
+	jpxTLM = 0xFF55
+	jpxPLM = 0xFF57
+	jpxPLT = 0xFF58
+	jpxQCD = 0xFF5C
+	jpxQCC = 0xFF5D
+	jpxRGN = 0xFF5E
+	jpxPOC = 0xFF5F
+	jpxPPM = 0xFF60
+	jpxPPT = 0xFF61
+	jpxCRG = 0xFF63
+	jpxCOM = 0xFF64
+	jpxSOT = 0xFF90
+	jpxSOP = 0xFF91
+	jpxEPH = 0xFF92
+	jpxSOD = 0xFF93
+	jpxEOC = 0xFFD9
+)
+
+// Progression orders (See Table A.16)
+const (
+	jpxLRCP = iota
+	jpxRLCP
+	jpxRPCL
+	jpxPCRL
+	jpxCPRL
+)
+
+// Code-block styles (See Table A.19)
+const (
+	jpxBypass     = 0x01
+	jpxReset      = 0x02
+	jpxTermAll    = 0x04
+	jpxVertCausal = 0x08
+	jpxPredTerm   = 0x10
+	jpxSegSymbols = 0x20
+)
+
+// Quantization styles (See Table A.28)
+const (
+	jpxQuantNone = iota
+	jpxQuantDerived
+	jpxQuantExpounded
+)
+
+var errJPXCorrupt = errors.New("pdfcpu: jpx: corrupt codestream")
+
+// jpxComponent represents the SIZ parameters of an image component.
+type jpxComponent struct {
+	prec   int // bit depth
+	signed bool
+	dx, dy int // sub-sampling
+}
+
+// jpxSize represents the image and tile size parameters.
+type jpxSize struct {
+	x0, y0, x1, y1       int // image area on the reference grid
+	tw, th, tx0, ty0     int // tile size and tiling origin
+	comps                []jpxComponent
+	numXTiles, numYTiles int
+}
+
+// jpxCodingStyle represents the component specific coding style parameters of a COD or COC marker segment.
+type jpxCodingStyle struct {
+	levels     int  // number of decomposition levels
+	cbw, cbh   uint // code-block width and height exponents
+	style      int  // code-block style
+	reversible bool // 5-3 reversible filter or 9-7 irreversible filter
+	ppx, ppy   []uint
+}
+
+// jpxCodingParms represents the coding style parameters applying to all components.
+type jpxCodingParms struct {
+	sop, eph bool
+	prog     int
+	layers   int
+	mct      bool
+}
+
+// jpxQuant represents the parameters of a QCD or QCC marker segment.
+type jpxQuant struct {
+	style int
+	guard int
+	eps   []int
+	mu    []int
+}
+
+// jpxProgChange represents a progression order change.
+type jpxProgChange struct {
+	rs, re int // resolution levels
+	cs, ce int // components
+	lye    int // layer end
+	prog   int
+}
+
+// jpxParms holds the coding parameters of the main header or a tile header.
+type jpxParms struct {
+	cod  *jpxCodingParms
+	cs   *jpxCodingStyle
+	coc  map[int]*jpxCodingStyle
+	qcd  *jpxQuant
+	qcc  map[int]*jpxQuant
+	roi  map[int]int
+	pocs []jpxProgChange
+}
+
+func newJPXParms() jpxParms {
+	return jpxParms{
+		coc: map[int]*jpxCodingStyle{},
+		qcc: map[int]*jpxQuant{},
+		roi: map[int]int{},
+	}
+}
+
+// jpxTileData collects the tile-parts of a tile.
+type jpxTileData struct {
+	index   int
+	parms   jpxParms
+	data    []byte // concatenated tile-part bodies
+	headers []byte // packed packet headers taken from PPM or PPT
+	packed  bool
+}
+
+// jpxCodestream represents a parsed codestream.
+type jpxCodestream struct {
+	siz   jpxSize
+	main  jpxParms
+	tiles []*jpxTileData
+}
+
+func be16(p []byte) int {
+	return int(p[0])<<8 | int(p[1])
+}
+
+// codingStyle returns the coding style for component c of tile t.
+func (c *jpxCodestream) codingStyle(t *jpxTileData, comp int) *jpxCodingStyle {
+	if cs, ok := t.parms.coc[comp]; ok {
+		return cs
+	}
+	if t.parms.cs != nil {
+		return t.parms.cs
+	}
+	if cs, ok := c.main.coc[comp]; ok {
+		return cs
+	}
+	return c.main.cs
+}
+
+// quantization returns the quantization parameters for component c of tile t.
+func (c *jpxCodestream) quantization(t *jpxTileData, comp int) *jpxQuant {
+	if q, ok := t.parms.qcc[comp]; ok {
+		return q
+	}
+	if t.parms.qcd != nil {
+		return t.parms.qcd
+	}
+	if q, ok := c.main.qcc[comp]; ok {
+		return q
+	}
+	return c.main.qcd
+}
+
+// roiShift returns the region of interest shift for component c of tile t.
+func (c *jpxCodestream) roiShift(t *jpxTileData, comp int) int {
+	if s, ok := t.parms.roi[comp]; ok {
+		return s
+	}
+	return c.main.roi[comp]
+}
+
+func (c *jpxCodestream) cod(t *jpxTileData) *jpxCodingParms {
+	if t.parms.cod != nil {
+		return t.parms.cod
+	}
+	return c.main.cod
+}
+
+func (c *jpxCodestream) pocs(t *jpxTileData) []jpxProgChange {
+	if len(t.parms.pocs) > 0 {
+		return t.parms.pocs
+	}
+	return c.main.pocs
+}
+
+// parseJPXCodestream parses the marker segments of a codestream and collects the tile-part data.
+func parseJPXCodestream(p []byte) (*jpxCodestream, error) {
+
+	if len(p) < 4 || be16(p) != jpxSOC || be16(p[2:]) != jpxSIZ {
+		return nil, errors.New("pdfcpu: jpx: missing SOC/SIZ marker")
+	}
+
+	c := &jpxCodestream{main: newJPXParms()}
+
+	// Packed packet headers of all tile-parts.
+	var ppm []byte
+
+	pos := 2
+
+	// Main header
+	for {
+		m, seg, err := jpxMarkerSegment(p, pos)
+		if err != nil {
+			return nil, err
+		}
+
+		if m == jpxSOT {
+			break
+		}
+
+		switch m {
+
+		case jpxSIZ:
+			err = c.parseSIZ(seg)
+
+		case jpxPPM:
+			// Zppm is implied by the marker order.
+			if len(seg) > 1 {
+				ppm = append(ppm, seg[1:]...)
+			}
+
+		default:
+			err = c.main.parse(m, seg, len(c.siz.comps))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		pos += 2 + len(seg) + 2
+	}
+
+	if len(c.siz.comps) == 0 || c.main.cod == nil || c.main.qcd == nil {
+		return nil, errors.New("pdfcpu: jpx: missing SIZ, COD or QCD marker")
+	}
+
+	c.tiles = make([]*jpxTileData, c.siz.numXTiles*c.siz.numYTiles)
+
+	// Tile-parts
+	for pos+2 <= len(p) && be16(p[pos:]) == jpxSOT {
+
+		m, seg, err := jpxMarkerSegment(p, pos)
+		if err != nil {
+			return nil, err
+		}
+		if len(seg) < 8 {
+			return nil, errJPXCorrupt
+		}
+
+		i := be16(seg)
+		psot := int(be32(seg[2:]))
+
+		if i >= len(c.tiles) {
+			return nil, errors.Errorf("pdfcpu: jpx: invalid tile index %d", i)
+		}
+
+		end := pos + psot
+		if psot == 0 || end > len(p) {
+			// The last tile-part extends to the EOC marker.
+			end = len(p)
+			if end-pos > 2 && be16(p[end-2:]) == jpxEOC {
+				end -= 2
+			}
+		}
+
+		t := c.tiles[i]
+		if t == nil {
+			t = &jpxTileData{index: i, parms: newJPXParms()}
+			c.tiles[i] = t
+		}
+
+		pos += 2 + len(seg) + 2
+
+		// Tile-part header
+		for m != jpxSOD {
+
+			m, seg, err = jpxMarkerSegment(p, pos)
+			if err != nil {
+				return nil, err
+			}
+
+			switch m {
+
+			case jpxSOD:
+				pos += 2
+				continue
+
+			case jpxPPT:
+				if len(seg) > 1 {
+					t.headers = append(t.headers, seg[1:]...)
+				}
+				t.packed = true
+
+			default:
+				if err = t.parms.parse(m, seg, len(c.siz.comps)); err != nil {
+					return nil, err
+				}
+			}
+
+			pos += 2 + len(seg) + 2
+		}
+
+		if pos > end {
+			return nil, errJPXCorrupt
+		}
+
+		t.data = append(t.data, p[pos:end]...)
+
+		if ppm != nil {
+			// Nppm followed by the packet headers of this tile-part.
+			if len(ppm) < 4 {
+				return nil, errJPXCorrupt
+			}
+			n := int(be32(ppm))
+			if 4+n > len(ppm) {
+				return nil, errJPXCorrupt
+			}
+			t.headers = append(t.headers, ppm[4:4+n]...)
+			t.packed = true
+			ppm = ppm[4+n:]
+		}
+
+		pos = end
+	}
+
+	return c, nil
+}
+
+// jpxMarkerSegment returns the marker at pos and its parameters.
+func jpxMarkerSegment(p []byte, pos int) (int, []byte, error) {
+
+	if pos+2 > len(p) {
+		return 0, nil, errors.New("pdfcpu: jpx: unexpected end of codestream")
+	}
+
+	m := be16(p[pos:])
+	if m>>8 != 0xFF {
+		return 0, nil, errors.Errorf("pdfcpu: jpx: missing marker at offset %d", pos)
+	}
+
+	if m == jpxSOD || m == jpxEOC {
+		return m, nil, nil
+	}
+
+	if pos+4 > len(p) {
+		return 0, nil, errJPXCorrupt
+	}
+
+	l := be16(p[pos+2:])
+	if l < 2 || pos+2+l > len(p) {
+		return 0, nil, errors.Errorf("pdfcpu: jpx: corrupt marker segment 0x%04X", m)
+	}
+
+	return m, p[pos+4 : pos+2+l], nil
+}
+
+func (c *jpxCodestream) parseSIZ(p []byte) error {
+
+	if len(p) < 36 {
+		return errJPXCorrupt
+	}
+
+	s := &c.siz
+	s.x1, s.y1 = int(be32(p[2:])), int(be32(p[6:]))
+	s.x0, s.y0 = int(be32(p[10:])), int(be32(p[14:]))
+	s.tw, s.th = int(be32(p[18:])), int(be32(p[22:]))
+	s.tx0, s.ty0 = int(be32(p[26:])), int(be32(p[30:]))
+
+	n := be16(p[34:])
+	if n == 0 || len(p) < 36+3*n {
+		return errJPXCorrupt
+	}
+
+	if s.x1 <= s.x0 || s.y1 <= s.y0 || s.tw <= 0 || s.th <= 0 || s.tx0 > s.x0 || s.ty0 > s.y0 {
+		return errors.New("pdfcpu: jpx: invalid image or tile size")
+	}
+
+	for i := 0; i < n; i++ {
+		b := p[36+3*i:]
+		comp := jpxComponent{
+			prec:   int(b[0]&0x7F) + 1,
+			signed: b[0]&0x80 != 0,
+			dx:     int(b[1]),
+			dy:     int(b[2]),
+		}
+		if comp.dx == 0 || comp.dy == 0 || comp.prec > 16 {
+			return errors.New("pdfcpu: jpx: unsupported component parameters")
+		}
+		s.comps = append(s.comps, comp)
+	}
+
+	s.numXTiles = jpxCeilDiv(s.x1-s.tx0, s.tw)
+	s.numYTiles = jpxCeilDiv(s.y1-s.ty0, s.th)
+
+	return nil
+}
+
+// parse parses a marker segment of a main or tile-part header.
+func (parms *jpxParms) parse(m int, p []byte, numComps int) error {
+
+	// Component indices are 16 bit values if there are more than 256 components.
+	compIndex := func(p []byte) (int, []byte, error) {
+		if numComps < 257 {
+			if len(p) < 1 {
+				return 0, nil, errJPXCorrupt
+			}
+			return int(p[0]), p[1:], nil
+		}
+		if len(p) < 2 {
+			return 0, nil, errJPXCorrupt
+		}
+		return be16(p), p[2:], nil
+	}
+
+	switch m {
+
+	case jpxCOD:
+		if len(p) < 5 {
+			return errJPXCorrupt
+		}
+		parms.cod = &jpxCodingParms{
+			sop:    p[0]&0x02 != 0,
+			eph:    p[0]&0x04 != 0,
+			prog:   int(p[1]),
+			layers: be16(p[2:]),
+			mct:    p[4] == 1,
+		}
+		cs, err := parseJPXCodingStyle(p[5:], p[0]&0x01 != 0)
+		if err != nil {
+			return err
+		}
+		parms.cs = cs
+
+	case jpxCOC:
+		c, p, err := compIndex(p)
+		if err != nil {
+			return err
+		}
+		if len(p) < 1 {
+			return errJPXCorrupt
+		}
+		cs, err := parseJPXCodingStyle(p[1:], p[0]&0x01 != 0)
+		if err != nil {
+			return err
+		}
+		parms.coc[c] = cs
+
+	case jpxQCD:
+		q, err := parseJPXQuant(p)
+		if err != nil {
+			return err
+		}
+		parms.qcd = q
+
+	case jpxQCC:
+		c, p, err := compIndex(p)
+		if err != nil {
+			return err
+		}
+		q, err := parseJPXQuant(p)
+		if err != nil {
+			return err
+		}
+		parms.qcc[c] = q
+
+	case jpxRGN:
+		c, p, err := compIndex(p)
+		if err != nil {
+			return err
+		}
+		if len(p) < 2 {
+			return errJPXCorrupt
+		}
+		// Only the implicit ROI style (Maxshift) is defined.
+		parms.roi[c] = int(p[1])
+
+	case jpxPOC:
+		parms.pocs = nil
+		n := 7
+		if numComps >= 257 {
+			n = 9
+		}
+		for ; len(p) >= n; p = p[n:] {
+			poc := jpxProgChange{rs: int(p[0])}
+			q := p[1:]
+			poc.cs, q, _ = compIndex(q)
+			poc.lye = be16(q)
+			poc.re = int(q[2])
+			poc.ce, q, _ = compIndex(q[3:])
+			poc.prog = int(q[0])
+			if poc.ce == 0 {
+				poc.ce = 256
+			}
+			parms.pocs = append(parms.pocs, poc)
+		}
+
+	case jpxTLM, jpxPLM, jpxPLT, jpxCRG, jpxCOM:
+		// Informational only.
+
+	default:
+		log.Debug.Printf("jpx: ignoring marker 0x%04X\n", m)
+	}
+
+	return nil
+}
+
+// parseJPXCodingStyle parses the SPcod or SPcoc parameters.
+func parseJPXCodingStyle(p []byte, precincts bool) (*jpxCodingStyle, error) {
+
+	if len(p) < 5 {
+		return nil, errJPXCorrupt
+	}
+
+	cs := &jpxCodingStyle{
+		levels:     int(p[0]),
+		cbw:        uint(p[1]&0x0F) + 2,
+		cbh:        uint(p[2]&0x0F) + 2,
+		style:      int(p[3]),
+		reversible: p[4] == 1,
+	}
+
+	if cs.levels > 32 || cs.cbw > 10 || cs.cbh > 10 || cs.cbw+cs.cbh > 12 {
+		return nil, errors.New("pdfcpu: jpx: invalid coding style")
+	}
+
+	for r := 0; r <= cs.levels; r++ {
+		ppx, ppy := uint(15), uint(15)
+		if precincts {
+			if len(p) < 6+r {
+				return nil, errJPXCorrupt
+			}
+			ppx, ppy = uint(p[5+r]&0x0F), uint(p[5+r]>>4)
+		}
+		cs.ppx = append(cs.ppx, ppx)
+		cs.ppy = append(cs.ppy, ppy)
+	}
+
+	return cs, nil
+}
+
+// parseJPXQuant parses the Sqcd/SPqcd or Sqcc/SPqcc parameters.
+func parseJPXQuant(p []byte) (*jpxQuant, error) {
+
+	if len(p) < 1 {
+		return nil, errJPXCorrupt
+	}
+
+	q := &jpxQuant{style: int(p[0] & 0x1F), guard: int(p[0] >> 5)}
+	p = p[1:]
+
+	switch q.style {
+
+	case jpxQuantNone:
+		for _, b := range p {
+			q.eps = append(q.eps, int(b>>3))
+			q.mu = append(q.mu, 0)
+		}
+
+	case jpxQuantDerived, jpxQuantExpounded:
+		for ; len(p) >= 2; p = p[2:] {
+			v := be16(p)
+			q.eps = append(q.eps, v>>11)
+			q.mu = append(q.mu, v&0x7FF)
+		}
+
+	default:
+		return nil, errors.Errorf("pdfcpu: jpx: invalid quantization style %d", q.style)
+	}
+
+	if len(q.eps) == 0 {
+		return nil, errJPXCorrupt
+	}
+
+	return q, nil
+}
+
+func jpxFloorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
+
+func jpxCeilDiv(a, b int) int {
+	return -jpxFloorDiv(-a, b)
+}
@@ -0,0 +1,474 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"image/color"
+	"io"
+	"io/ioutil"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// This is a JPEG 2000 decoder for JP2/JPX files and raw codestreams as used by PDF (See ITU-T T.800).
+// It supports all progression orders, precincts, code-block styles, tiles, packed packet headers,
+// the reversible and irreversible wavelet transformations, the multiple component transformation and ROI maxshift.
+// The JP2 header supplies the color space (enumerated or ICC), palettes and channel definitions like opacity.
+
+// JP2 color spaces of interest (See ITU-T T.800 Table I.10)
+const (
+	jp2CMYK = 12
+	jp2Gray = 17
+	jp2SYCC = 18
+)
+
+// JP2 channel types (See ITU-T T.800 Table I.16)
+const (
+	jp2ColorChannel         = 0
+	jp2OpacityChannel       = 1
+	jp2PremultipliedOpacity = 2
+)
+
+var jp2Signature = []byte{0x00, 0x00, 0x00, 0x0C, 'j', 'P', ' ', ' ', 0x0D, 0x0A, 0x87, 0x0A}
+
+type jpxDecode struct {
+	baseFilter
+}
+
+// JPXImage represents a decoded JPEG 2000 image.
+type JPXImage struct {
+	Width, Height int
+	Colors        int    // number of color components: 1 (gray), 3 (RGB) or 4 (CMYK)
+	ICCProfile    []byte // embedded ICC profile or nil
+	Data          []byte // interleaved 8 bit color samples
+	Alpha         []byte // 8 bit opacity samples or nil
+}
+
+// Encode implements encoding for a JPXDecode filter.
+func (f jpxDecode) Encode(r io.Reader, w io.Writer) error {
+	log.Info.Println("EncodeJPX: encoding not supported")
+	return ErrUnsupportedFilter
+}
+
+// Decode implements decoding for a JPXDecode filter.
+// The result are the interleaved 8 bit color samples of the image.
+// Use DecodeJPX for access to the color space and any opacity channel.
+func (f jpxDecode) Decode(r io.Reader, w io.Writer) error {
+
+	log.Trace.Println("DecodeJPX begin")
+
+	img, err := DecodeJPX(r)
+	if err != nil {
+		return err
+	}
+
+	log.Trace.Println("DecodeJPX end")
+
+	_, err = w.Write(img.Data)
+	return err
+}
+
+// jp2Header holds the image properties of a JP2 header box of interest.
+type jp2Header struct {
+	enumCS  int
+	icc     []byte
+	palette *jp2Palette
+	cmap    []jp2Mapping
+	cdef    []jp2Channel
+}
+
+// jp2Palette represents a palette box.
+type jp2Palette struct {
+	prec    []int
+	entries [][]int // entries per column
+}
+
+// jp2Mapping represents a component mapping.
+type jp2Mapping struct {
+	comp    int
+	palette bool
+	col     int
+}
+
+// jp2Channel represents a channel definition.
+type jp2Channel struct {
+	index, typ, assoc int
+}
+
+// jp2Boxes calls fn for each box in p.
+func jp2Boxes(p []byte, fn func(typ string, data []byte) error) error {
+
+	for len(p) > 0 {
+
+		if len(p) < 8 {
+			return errors.New("pdfcpu: jpx: corrupt box")
+		}
+
+		l, typ, hl := int(be32(p)), string(p[4:8]), 8
+
+		switch l {
+		case 0:
+			l = len(p)
+		case 1:
+			if len(p) < 16 || be32(p[8:]) != 0 {
+				return errors.New("pdfcpu: jpx: unsupported box length")
+			}
+			l, hl = int(be32(p[12:])), 16
+		}
+
+		if l < hl || l > len(p) {
+			return errors.Errorf("pdfcpu: jpx: corrupt box %q", typ)
+		}
+
+		if err := fn(typ, p[hl:l]); err != nil {
+			return err
+		}
+
+		p = p[l:]
+	}
+
+	return nil
+}
+
+// parseJP2 returns the JP2 header properties and the first codestream.
+func parseJP2(p []byte) (*jp2Header, []byte, error) {
+
+	h := &jp2Header{}
+	var cs []byte
+
+	err := jp2Boxes(p, func(typ string, data []byte) error {
+
+		switch typ {
+
+		case "jp2h":
+			return jp2Boxes(data, h.parseBox)
+
+		case "jp2c":
+			if cs == nil {
+				cs = data
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cs == nil {
+		return nil, nil, errors.New("pdfcpu: jpx: missing codestream")
+	}
+
+	return h, cs, nil
+}
+
+// parseBox parses a box of a JP2 header box.
+func (h *jp2Header) parseBox(typ string, p []byte) error {
+
+	switch typ {
+
+	case "colr":
+		if len(p) < 3 || h.enumCS != 0 || h.icc != nil {
+			// Use the first color specification.
+			break
+		}
+		switch p[0] {
+		case 1:
+			if len(p) >= 7 {
+				h.enumCS = int(be32(p[3:]))
+			}
+		case 2, 3:
+			h.icc = p[3:]
+		}
+
+	case "pclr":
+		if len(p) < 3 {
+			return errors.New("pdfcpu: jpx: corrupt palette box")
+		}
+		n, nc := be16(p), int(p[2])
+		pal := &jp2Palette{entries: make([][]int, nc)}
+		q := p[3:]
+		if len(q) < nc {
+			return errors.New("pdfcpu: jpx: corrupt palette box")
+		}
+		size := 0
+		for i := 0; i < nc; i++ {
+			prec := int(q[i]&0x7F) + 1
+			pal.prec = append(pal.prec, prec)
+			size += (prec + 7) / 8
+		}
+		q = q[nc:]
+		if len(q) < n*size {
+			return errors.New("pdfcpu: jpx: corrupt palette box")
+		}
+		for e := 0; e < n; e++ {
+			for i, prec := range pal.prec {
+				v := 0
+				for k := 0; k < (prec+7)/8; k++ {
+					v = v<<8 | int(q[0])
+					q = q[1:]
+				}
+				pal.entries[i] = append(pal.entries[i], v)
+			}
+		}
+		h.palette = pal
+
+	case "cmap":
+		for ; len(p) >= 4; p = p[4:] {
+			h.cmap = append(h.cmap, jp2Mapping{comp: be16(p), palette: p[2] == 1, col: int(p[3])})
+		}
+
+	case "cdef":
+		if len(p) < 2 {
+			return errors.New("pdfcpu: jpx: corrupt channel definition box")
+		}
+		n := be16(p)
+		for p = p[2:]; n > 0 && len(p) >= 6; n, p = n-1, p[6:] {
+			h.cdef = append(h.cdef, jp2Channel{index: be16(p), typ: be16(p[2:]), assoc: be16(p[4:])})
+		}
+	}
+
+	return nil
+}
+
+// jpxChannel is an image channel with samples on a sub-sampled grid.
+type jpxChannel struct {
+	data   []uint16
+	prec   int
+	dx, dy int
+}
+
+// DecodeJPX decodes a JPEG 2000 image given as JP2/JPX file or raw codestream.
+func DecodeJPX(r io.Reader) (*JPXImage, error) {
+
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &jp2Header{}
+
+	if bytes.HasPrefix(p, jp2Signature) {
+		if h, p, err = parseJP2(p); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := parseJPXCodestream(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s := c.siz
+
+	planes := make([][]uint16, len(s.comps))
+	for i, comp := range s.comps {
+		w := jpxCeilDiv(s.x1, comp.dx) - jpxCeilDiv(s.x0, comp.dx)
+		ht := jpxCeilDiv(s.y1, comp.dy) - jpxCeilDiv(s.y0, comp.dy)
+		planes[i] = make([]uint16, w*ht)
+	}
+
+	for _, td := range c.tiles {
+		if td == nil {
+			continue
+		}
+		if err := c.decodeTile(td, planes); err != nil {
+			return nil, err
+		}
+	}
+
+	var chs []jpxChannel
+	for i, comp := range s.comps {
+		chs = append(chs, jpxChannel{planes[i], comp.prec, comp.dx, comp.dy})
+	}
+
+	chs, err = h.mapComponents(chs)
+	if err != nil {
+		return nil, err
+	}
+
+	colors, alpha := h.channels(chs)
+
+	img := &JPXImage{
+		Width:      s.x1 - s.x0,
+		Height:     s.y1 - s.y0,
+		Colors:     len(colors),
+		ICCProfile: h.icc,
+	}
+
+	// Convert to 8 bit samples on the reference grid.
+	samples := func(ch jpxChannel) []byte {
+		return ch.samples(s.x0, s.y0, s.x1, s.y1)
+	}
+
+	cp := make([][]byte, len(colors))
+	for i, ch := range colors {
+		cp[i] = samples(ch)
+	}
+
+	if h.enumCS == jp2SYCC && len(cp) == 3 {
+		for i := range cp[0] {
+			cp[0][i], cp[1][i], cp[2][i] = color.YCbCrToRGB(cp[0][i], cp[1][i], cp[2][i])
+		}
+	}
+
+	img.Data = make([]byte, 0, len(cp)*img.Width*img.Height)
+	for i := 0; i < img.Width*img.Height; i++ {
+		for _, p := range cp {
+			img.Data = append(img.Data, p[i])
+		}
+	}
+
+	if alpha != nil {
+		img.Alpha = samples(*alpha)
+	}
+
+	return img, nil
+}
+
+// mapComponents applies the component mapping and palette of the JP2 header.
+func (h *jp2Header) mapComponents(comps []jpxChannel) ([]jpxChannel, error) {
+
+	if h.cmap == nil {
+		return comps, nil
+	}
+
+	var chs []jpxChannel
+
+	for _, m := range h.cmap {
+
+		if m.comp >= len(comps) {
+			return nil, errors.New("pdfcpu: jpx: invalid component mapping")
+		}
+
+		c := comps[m.comp]
+
+		if !m.palette {
+			chs = append(chs, c)
+			continue
+		}
+
+		if h.palette == nil || m.col >= len(h.palette.entries) || len(h.palette.entries[m.col]) == 0 {
+			return nil, errors.New("pdfcpu: jpx: missing palette")
+		}
+
+		entries := h.palette.entries[m.col]
+		ch := jpxChannel{data: make([]uint16, len(c.data)), prec: h.palette.prec[m.col], dx: c.dx, dy: c.dy}
+		for i, v := range c.data {
+			if int(v) >= len(entries) {
+				v = uint16(len(entries) - 1)
+			}
+			ch.data[i] = uint16(entries[v])
+		}
+		chs = append(chs, ch)
+	}
+
+	return chs, nil
+}
+
+// numColors returns the number of color components of the color specification or 0 if unknown.
+func (h *jp2Header) numColors() int {
+
+	switch h.enumCS {
+	case jp2Gray:
+		return 1
+	case jp2CMYK:
+		return 4
+	case 0:
+	default:
+		return 3
+	}
+
+	// The data color space of an ICC profile header.
+	if len(h.icc) >= 20 {
+		switch string(h.icc[16:20]) {
+		case "GRAY":
+			return 1
+		case "CMYK":
+			return 4
+		default:
+			return 3
+		}
+	}
+
+	return 0
+}
+
+// channels returns the color channels in order and the opacity channel if there is one.
+func (h *jp2Header) channels(chs []jpxChannel) ([]jpxChannel, *jpxChannel) {
+
+	if h.cdef == nil {
+		n := h.numColors()
+		if n == 0 && len(chs) == 2 {
+			// Gray with opacity
+			n = 1
+		}
+		if n > 0 && len(chs) > n {
+			return chs[:n], &chs[n]
+		}
+		return chs, nil
+	}
+
+	var colors []jpxChannel
+	var alpha *jpxChannel
+
+	// Colors are ordered by association.
+	for assoc := 1; assoc <= len(chs); assoc++ {
+		for _, c := range h.cdef {
+			if c.typ == jp2ColorChannel && c.assoc == assoc && c.index < len(chs) {
+				colors = append(colors, chs[c.index])
+			}
+		}
+	}
+
+	for _, c := range h.cdef {
+		if (c.typ == jp2OpacityChannel || c.typ == jp2PremultipliedOpacity) && c.index < len(chs) {
+			alpha = &chs[c.index]
+			break
+		}
+	}
+
+	return colors, alpha
+}
+
+// samples returns the 8 bit samples of ch for the image area x0,y0,x1,y1 of the reference grid.
+func (ch jpxChannel) samples(x0, y0, x1, y1 int) []byte {
+
+	cx0, cy0 := jpxCeilDiv(x0, ch.dx), jpxCeilDiv(y0, ch.dy)
+	cw := jpxCeilDiv(x1, ch.dx) - cx0
+
+	max := 1<<uint(ch.prec) - 1
+
+	b := make([]byte, 0, (x1-x0)*(y1-y0))
+
+	for y := y0; y < y1; y++ {
+		cy := jpxMax(y/ch.dy-cy0, 0)
+		for x := x0; x < x1; x++ {
+			cx := jpxMax(x/ch.dx-cx0, 0)
+			v := int(ch.data[cy*cw+cx])
+			if ch.prec != 8 {
+				v = (v*255 + max/2) / max
+			}
+			b = append(b, byte(v))
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,1152 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// The tests below use a simple JPEG 2000 encoder following ITU-T T.800 to generate test data.
+
+// jpxTestParms are the coding parameters of a test codestream.
+type jpxTestParms struct {
+	x0, y0, x1, y1   int
+	tw, th, tx0, ty0 int
+	comps            []jpxComponent
+	levels           int
+	cbw, cbh         uint
+	style            int
+	reversible       bool
+	precincts        []byte // ppx | ppy<<4 per resolution level or nil
+	prog             int
+	layers           int
+	mct              bool
+	sop, eph         bool
+	quant            int
+	guard            int
+	eps0             int // quantization exponent offset
+	roi              int // maxshift of component 0
+	pocs             []jpxProgChange
+	packed           bool // packet headers in PPT marker segments
+	split            bool // two tile-parts per tile
+}
+
+// jpxBitWriter writes bits with a stuffed 0 bit following each 0xFF.
+type jpxBitWriter struct {
+	bits []byte
+}
+
+func (w *jpxBitWriter) writeBit(b int) {
+	w.bits = append(w.bits, byte(b))
+}
+
+func (w *jpxBitWriter) writeBits(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit(v >> uint(i) & 1)
+	}
+}
+
+func (w *jpxBitWriter) bytes() []byte {
+	var p []byte
+	for bits := w.bits; len(bits) > 0; {
+		n := 8
+		if len(p) > 0 && p[len(p)-1] == 0xFF {
+			n = 7
+		}
+		var c byte
+		for i := 0; i < n; i++ {
+			c <<= 1
+			if i < len(bits) {
+				c |= bits[i]
+			}
+		}
+		if n > len(bits) {
+			n = len(bits)
+		}
+		bits = bits[n:]
+		p = append(p, c)
+	}
+	return p
+}
+
+// jpxTagEncoder is the encoding side of a tag tree.
+type jpxTagEncoder struct {
+	parent, value, low []int
+	known              []bool
+}
+
+func newJPXTagEncoder(w, h int, values []int) *jpxTagEncoder {
+
+	t := &jpxTagEncoder{}
+	for _, n := range newJPXTagTree(w, h).nodes {
+		t.parent = append(t.parent, n.parent)
+		t.value = append(t.value, jpxTagUnknown)
+	}
+	t.low = make([]int, len(t.parent))
+	t.known = make([]bool, len(t.parent))
+
+	for i, v := range values {
+		for k := i; k >= 0; k = t.parent[k] {
+			if v < t.value[k] {
+				t.value[k] = v
+			}
+		}
+	}
+
+	return t
+}
+
+func (t *jpxTagEncoder) encode(w *jpxBitWriter, leaf, threshold int) {
+
+	var path []int
+	for i := leaf; i >= 0; i = t.parent[i] {
+		path = append(path, i)
+	}
+
+	low := 0
+
+	for k := len(path) - 1; k >= 0; k-- {
+		n := path[k]
+		if low > t.low[n] {
+			t.low[n] = low
+		} else {
+			low = t.low[n]
+		}
+		for low < threshold {
+			if low >= t.value[n] {
+				if !t.known[n] {
+					w.writeBit(1)
+					t.known[n] = true
+				}
+				break
+			}
+			w.writeBit(0)
+			low++
+		}
+		t.low[n] = low
+	}
+}
+
+// jpxBlockEncoder encodes code-blocks sharing the context formation of the decoder.
+type jpxBlockEncoder struct {
+	jpxBlockDecoder
+	coef []int32
+	mqe  *mqEncoder
+	rawe *jpxBitWriter
+}
+
+func (e *jpxBlockEncoder) bit(i int, p uint) int {
+	v := e.coef[i]
+	if v < 0 {
+		v = -v
+	}
+	return int(v>>p) & 1
+}
+
+func (e *jpxBlockEncoder) encodeBit(ctx, bit int) {
+	if e.rawe != nil {
+		e.rawe.writeBit(bit)
+		return
+	}
+	e.mqe.encodeBit(e.cx, ctx, bit)
+}
+
+func (e *jpxBlockEncoder) encodeSign(j, i int, causal bool) {
+	s := 0
+	if e.coef[i] < 0 {
+		s = 1
+	}
+	if e.rawe != nil {
+		e.rawe.writeBit(s)
+	} else {
+		ctx, xor := e.signContext(j, causal)
+		e.mqe.encodeBit(e.cx, ctx, s^xor)
+	}
+	e.flags[j] |= jpxSig
+	if s == 1 {
+		e.flags[j] |= jpxNeg
+	}
+}
+
+func (e *jpxBlockEncoder) significancePass(p uint) {
+	e.forEach(func(x, y, j, i int, causal bool) {
+		if e.flags[j]&jpxSig != 0 {
+			return
+		}
+		h, v, dg := e.neighbours(j, causal)
+		if h+v+dg == 0 {
+			return
+		}
+		e.flags[j] |= jpxVisit
+		b := e.bit(i, p)
+		e.encodeBit(jpxZCContext(h, v, dg, e.band), b)
+		if b == 1 {
+			e.encodeSign(j, i, causal)
+		}
+	})
+}
+
+func (e *jpxBlockEncoder) refinementPass(p uint) {
+	e.forEach(func(x, y, j, i int, causal bool) {
+		if e.flags[j]&(jpxSig|jpxVisit) != jpxSig {
+			return
+		}
+		ctx := jpxCtxMR + 2
+		if e.flags[j]&jpxRefined == 0 {
+			ctx = jpxCtxMR
+			if h, v, dg := e.neighbours(j, causal); h+v+dg > 0 {
+				ctx++
+			}
+		}
+		e.encodeBit(ctx, e.bit(i, p))
+		e.flags[j] |= jpxRefined
+	})
+}
+
+func (e *jpxBlockEncoder) cleanupPass(p uint) {
+
+	vsc := e.style&jpxVertCausal != 0
+
+	for y0 := 0; y0 < e.h; y0 += 4 {
+		for x := 0; x < e.w; x++ {
+
+			y := y0
+
+			if y0+4 <= e.h && e.runMode(x, y0, vsc) {
+				for y < y0+4 && e.bit(y*e.w+x, p) == 0 {
+					y++
+				}
+				if y == y0+4 {
+					e.mqe.encodeBit(e.cx, jpxCtxRL, 0)
+					continue
+				}
+				e.mqe.encodeBit(e.cx, jpxCtxRL, 1)
+				e.mqe.encodeBit(e.cx, jpxCtxUniform, (y-y0)>>1)
+				e.mqe.encodeBit(e.cx, jpxCtxUniform, (y-y0)&1)
+				e.encodeSign((y+1)*e.stride+x+1, y*e.w+x, vsc && y&3 == 3)
+				y++
+			}
+
+			for ; y < y0+4 && y < e.h; y++ {
+				j := (y+1)*e.stride + x + 1
+				if e.flags[j]&(jpxSig|jpxVisit) != 0 {
+					continue
+				}
+				causal := vsc && y&3 == 3
+				h, v, dg := e.neighbours(j, causal)
+				b := e.bit(y*e.w+x, p)
+				e.mqe.encodeBit(e.cx, jpxZCContext(h, v, dg, e.band), b)
+				if b == 1 {
+					e.encodeSign(j, y*e.w+x, causal)
+				}
+			}
+		}
+	}
+
+	for i := range e.flags {
+		e.flags[i] &^= jpxVisit
+	}
+
+	if e.style&jpxSegSymbols != 0 {
+		for _, b := range []int{1, 0, 1, 0} {
+			e.mqe.encodeBit(e.cx, jpxCtxUniform, b)
+		}
+	}
+}
+
+// jpxEncBlock is an encoded code-block.
+type jpxEncBlock struct {
+	zero     int
+	passes   int
+	segs     [][]byte
+	layers   []int // number of passes per layer
+	included bool
+	lblock   int
+	done     int // passes written so far
+}
+
+// encode encodes the coefficients of a w x h code-block with planes magnitude bit-planes.
+func (e *jpxBlockEncoder) encode(t *testing.T, coef []int32, w, h, planes, layers int) *jpxEncBlock {
+
+	e.w, e.h, e.stride, e.coef = w, h, w+2, coef
+	e.flags = make([]byte, e.stride*(h+2))
+	e.cx = newJBIG2Contexts(jpxNumCtx)
+	e.resetContexts()
+
+	var max int32
+	for _, v := range coef {
+		if v < 0 {
+			v = -v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	nbits := 0
+	for max>>uint(nbits) > 0 {
+		nbits++
+	}
+	if nbits > planes {
+		t.Fatalf("jpx test encoder: coefficient needs %d bits, only %d bit-planes", nbits, planes)
+	}
+
+	eb := &jpxEncBlock{zero: planes - nbits}
+	if nbits > 0 {
+		eb.passes = 3*nbits - 2
+	}
+
+	finish := func() {
+		switch {
+		case e.mqe != nil:
+			p := e.mqe.flush()
+			// Strip the JBIG2 end marker, a trailing 0xFF is implied.
+			p = p[:len(p)-1]
+			if p[len(p)-1] == 0xFF {
+				p = p[:len(p)-1]
+			}
+			eb.segs = append(eb.segs, p)
+		case e.rawe != nil:
+			eb.segs = append(eb.segs, e.rawe.bytes())
+		}
+		e.mqe, e.rawe = nil, nil
+	}
+
+	p, typ, segPasses := nbits-1, jpxCleanupPass, 0
+
+	for pass := 0; pass < eb.passes; pass++ {
+
+		if e.mqe == nil && e.rawe == nil {
+			if jpxIsRawPass(e.style, pass) {
+				e.rawe = &jpxBitWriter{}
+			} else {
+				e.mqe = newMQEncoder()
+			}
+		}
+
+		switch typ {
+		case jpxSignificancePass:
+			e.significancePass(uint(p))
+		case jpxRefinementPass:
+			e.refinementPass(uint(p))
+		case jpxCleanupPass:
+			e.cleanupPass(uint(p))
+			p--
+		}
+
+		if e.style&jpxReset != 0 {
+			e.resetContexts()
+		}
+
+		segPasses++
+		if segPasses == jpxMaxPasses(e.style, len(eb.segs)) {
+			finish()
+			segPasses = 0
+		}
+
+		typ = (typ + 1) % 3
+	}
+
+	finish()
+
+	for l := 0; l < layers; l++ {
+		eb.layers = append(eb.layers, eb.passes*(l+1)/layers-eb.passes*l/layers)
+	}
+
+	return eb
+}
+
+// writeCodeBlocks writes the packet header entries of layer l for the code-blocks of pb and returns their data.
+func (eb *jpxEncBlock) write(w *jpxBitWriter, l, i int, pb *jpxPrecinctBand, incl, zero *jpxTagEncoder) []byte {
+
+	k := eb.layers[l]
+
+	if !eb.included {
+		incl.encode(w, i, l+1)
+	} else if k > 0 {
+		w.writeBit(1)
+	} else {
+		w.writeBit(0)
+	}
+
+	if k == 0 {
+		return nil
+	}
+
+	if !eb.included {
+		for z := 1; ; z++ {
+			zero.encode(w, i, z)
+			if eb.zero < z {
+				break
+			}
+		}
+		eb.included, eb.lblock = true, 3
+	}
+
+	switch {
+	case k == 1:
+		w.writeBits(0, 1)
+	case k == 2:
+		w.writeBits(2, 2)
+	case k <= 5:
+		w.writeBits(3, 2)
+		w.writeBits(k-3, 2)
+	case k <= 36:
+		w.writeBits(0xF, 4)
+		w.writeBits(k-6, 5)
+	default:
+		w.writeBits(0x1FF, 9)
+		w.writeBits(k-37, 7)
+	}
+
+	// Segment parts: the segment data goes with its last coding pass.
+	type part struct{ passes, length int }
+	var parts []part
+	var data []byte
+
+	segStart := 0
+	for s, seg := range eb.segs {
+		segEnd := segStart + jpxMaxPasses(pb.band.style, s)
+		if segEnd > eb.passes {
+			segEnd = eb.passes
+		}
+		a, b := jpxMax(segStart, eb.done), jpxMin(segEnd, eb.done+k)
+		if a < b {
+			pt := part{passes: b - a}
+			if b == segEnd {
+				pt.length = len(seg)
+				data = append(data, seg...)
+			}
+			parts = append(parts, pt)
+		}
+		segStart = segEnd
+	}
+
+	lblock := eb.lblock
+	for _, pt := range parts {
+		for pt.length >= 1<<uint(lblock+jpxFloorLog2(pt.passes)) {
+			lblock++
+		}
+	}
+	for ; eb.lblock < lblock; eb.lblock++ {
+		w.writeBit(1)
+	}
+	w.writeBit(0)
+
+	for _, pt := range parts {
+		w.writeBits(pt.length, eb.lblock+jpxFloorLog2(pt.passes))
+	}
+
+	eb.done += k
+
+	return data
+}
+
+func be16Bytes(v int) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func jpxSegmentBytes(m int, data ...[]byte) []byte {
+	p := bytes.Join(data, nil)
+	return bytes.Join([][]byte{be16Bytes(m), be16Bytes(len(p) + 2), p}, nil)
+}
+
+// header returns the main header of the codestream.
+func (tp *jpxTestParms) header() []byte {
+
+	var b bytes.Buffer
+
+	b.Write(be16Bytes(jpxSOC))
+
+	siz := [][]byte{be16Bytes(0)}
+	for _, v := range []int{tp.x1, tp.y1, tp.x0, tp.y0, tp.tw, tp.th, tp.tx0, tp.ty0} {
+		siz = append(siz, be32Bytes(v))
+	}
+	siz = append(siz, be16Bytes(len(tp.comps)))
+	for _, c := range tp.comps {
+		s := byte(c.prec - 1)
+		if c.signed {
+			s |= 0x80
+		}
+		siz = append(siz, []byte{s, byte(c.dx), byte(c.dy)})
+	}
+	b.Write(jpxSegmentBytes(jpxSIZ, siz...))
+
+	scod := byte(0)
+	if tp.precincts != nil {
+		scod |= 0x01
+	}
+	if tp.sop {
+		scod |= 0x02
+	}
+	if tp.eph {
+		scod |= 0x04
+	}
+	mct, transform := byte(0), byte(0)
+	if tp.mct {
+		mct = 1
+	}
+	if tp.reversible {
+		transform = 1
+	}
+	b.Write(jpxSegmentBytes(jpxCOD,
+		[]byte{scod, byte(tp.prog)}, be16Bytes(tp.layers),
+		[]byte{mct, byte(tp.levels), byte(tp.cbw - 2), byte(tp.cbh - 2), byte(tp.style), transform},
+		tp.precincts))
+
+	// Exponents per sub-band
+	prec := tp.comps[0].prec
+	qcd := [][]byte{{byte(tp.quant | tp.guard<<5)}}
+	for i := 0; i <= 3*tp.levels; i++ {
+		gain := 0
+		if i > 0 {
+			gain = []int{0, 1, 1, 2}[(i-1)%3+1]
+		}
+		eps := prec + gain + tp.eps0
+		switch tp.quant {
+		case jpxQuantNone:
+			qcd = append(qcd, []byte{byte(eps << 3)})
+		case jpxQuantDerived:
+			if i == 0 {
+				qcd = append(qcd, be16Bytes(eps<<11|0x100))
+			}
+		case jpxQuantExpounded:
+			qcd = append(qcd, be16Bytes(eps<<11|i*40))
+		}
+	}
+	b.Write(jpxSegmentBytes(jpxQCD, qcd...))
+
+	if tp.roi > 0 {
+		b.Write(jpxSegmentBytes(jpxRGN, []byte{0, 0, byte(tp.roi)}))
+	}
+
+	if tp.pocs != nil {
+		var poc [][]byte
+		for _, p := range tp.pocs {
+			poc = append(poc, []byte{byte(p.rs), byte(p.cs)}, be16Bytes(p.lye), []byte{byte(p.re), byte(p.ce), byte(p.prog)})
+		}
+		b.Write(jpxSegmentBytes(jpxPOC, poc...))
+	}
+
+	return b.Bytes()
+}
+
+func jpxTilePartBytes(i, tp, tn int, headers [][]byte, body []byte) []byte {
+	var ppt []byte
+	if headers != nil {
+		ppt = jpxSegmentBytes(jpxPPT, []byte{byte(tp)}, bytes.Join(headers, nil))
+	}
+	n := 14 + len(ppt) + len(body)
+	sot := jpxSegmentBytes(jpxSOT, be16Bytes(i), be32Bytes(n), []byte{byte(tp), byte(tn)})
+	return bytes.Join([][]byte{sot, ppt, be16Bytes(jpxSOD), body}, nil)
+}
+
+// jpxForward1D performs the 1D sub-band decomposition of x starting at coordinate i0 (See F.4.8).
+func jpxForward1D(x []float64, i0 int, reversible bool) {
+
+	n := len(x)
+
+	if n == 1 {
+		if i0&1 == 1 {
+			x[0] *= 2
+		}
+		return
+	}
+
+	at := func(i int) float64 {
+		for i < 0 || i >= n {
+			if i < 0 {
+				i = -i
+			}
+			if i >= n {
+				i = 2*(n-1) - i
+			}
+		}
+		return x[i]
+	}
+
+	lift := func(odd int, f func(l, r float64) float64) {
+		for i := 0; i < n; i++ {
+			if (i0+i)&1 == odd {
+				x[i] += f(at(i-1), at(i+1))
+			}
+		}
+	}
+
+	if reversible {
+		lift(1, func(l, r float64) float64 { return -math.Floor((l + r) / 2) })
+		lift(0, func(l, r float64) float64 { return math.Floor((l + r + 2) / 4) })
+		return
+	}
+
+	lift(1, func(l, r float64) float64 { return jpxAlpha * (l + r) })
+	lift(0, func(l, r float64) float64 { return jpxBeta * (l + r) })
+	lift(1, func(l, r float64) float64 { return jpxGamma * (l + r) })
+	lift(0, func(l, r float64) float64 { return jpxDelta * (l + r) })
+
+	for i := range x {
+		if (i0+i)&1 == 1 {
+			x[i] *= jpxK
+		} else {
+			x[i] /= jpxK
+		}
+	}
+}
+
+// forwardDWT decomposes the tile-component samples a into quantized sub-band coefficients.
+func (tc *jpxTileComp) forwardDWT(a []float64, roi int) map[*jpxBand][]int32 {
+
+	coefs := map[*jpxBand][]int32{}
+
+	quantize := func(b *jpxBand, x, y int, v float64) {
+		c, ok := coefs[b]
+		if !ok {
+			c = make([]int32, (b.x1-b.x0)*(b.y1-b.y0))
+			coefs[b] = c
+		}
+		q := int32(math.Floor(math.Abs(v) / float64(b.delta)))
+		if v < 0 {
+			q = -q
+		}
+		c[(y-b.y0)*(b.x1-b.x0)+x-b.x0] = q << uint(roi)
+	}
+
+	for r := len(tc.res) - 1; r >= 0; r-- {
+
+		res := tc.res[r]
+		w, h := res.x1-res.x0, res.y1-res.y0
+
+		if r == 0 {
+			for i, v := range a {
+				quantize(res.bands[0], res.x0+i%w, res.y0+i/w, v)
+			}
+			break
+		}
+
+		col := make([]float64, h)
+		for x := 0; x < w; x++ {
+			for y := range col {
+				col[y] = a[y*w+x]
+			}
+			jpxForward1D(col, res.y0, tc.reversible)
+			for y, v := range col {
+				a[y*w+x] = v
+			}
+		}
+		for y := 0; y < h; y++ {
+			jpxForward1D(a[y*w:(y+1)*w], res.x0, tc.reversible)
+		}
+
+		lr := tc.res[r-1]
+		lw := lr.x1 - lr.x0
+		ll := make([]float64, lw*(lr.y1-lr.y0))
+
+		for i, v := range a {
+			x, y := res.x0+i%w, res.y0+i/w
+			if typ := x&1 | (y&1)<<1; typ != jpxLL {
+				quantize(res.bands[typ-1], x>>1, y>>1, v)
+				continue
+			}
+			ll[(y>>1-lr.y0)*lw+x>>1-lr.x0] = v
+		}
+
+		a = ll
+	}
+
+	return coefs
+}
+
+// encodeJPX returns a codestream for the component planes.
+func encodeJPX(t *testing.T, tp jpxTestParms, planes [][]int) []byte {
+
+	t.Helper()
+
+	hdr := tp.header()
+
+	// Parse a codestream of empty tiles for the tile structure.
+	p := append([]byte(nil), hdr...)
+	numTiles := jpxCeilDiv(tp.x1-tp.tx0, tp.tw) * jpxCeilDiv(tp.y1-tp.ty0, tp.th)
+	for i := 0; i < numTiles; i++ {
+		p = append(p, jpxTilePartBytes(i, 0, 1, nil, nil)...)
+	}
+	c, err := parseJPXCodestream(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := append([]byte(nil), hdr...)
+
+	for _, td := range c.tiles {
+
+		tile, err := c.newTile(td)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Tile-component samples
+		samples := make([][]float64, len(tile.comps))
+		for i, tc := range tile.comps {
+			comp := c.siz.comps[i]
+			cx0, cy0 := jpxCeilDiv(tp.x0, comp.dx), jpxCeilDiv(tp.y0, comp.dy)
+			cw := jpxCeilDiv(tp.x1, comp.dx) - cx0
+			shift := 1 << uint(comp.prec-1)
+			if comp.signed {
+				shift = 0
+			}
+			for y := tc.y0; y < tc.y1; y++ {
+				for x := tc.x0; x < tc.x1; x++ {
+					samples[i] = append(samples[i], float64(planes[i][(y-cy0)*cw+x-cx0]-shift))
+				}
+			}
+		}
+
+		if tp.mct {
+			s0, s1, s2 := samples[0], samples[1], samples[2]
+			for i := range s0 {
+				r, g, b := s0[i], s1[i], s2[i]
+				if tp.reversible {
+					s0[i], s1[i], s2[i] = math.Floor((r+2*g+b)/4), b-g, r-g
+					continue
+				}
+				s0[i] = 0.299*r + 0.587*g + 0.114*b
+				s1[i] = -0.16875*r - 0.33126*g + 0.5*b
+				s2[i] = 0.5*r - 0.41869*g - 0.08131*b
+			}
+		}
+
+		blocks := map[*jpxCodeBlock]*jpxEncBlock{}
+		var e jpxBlockEncoder
+
+		for i, tc := range tile.comps {
+			roi := 0
+			if i == 0 {
+				roi = tp.roi
+			}
+			coefs := tc.forwardDWT(samples[i], roi)
+			for _, res := range tc.res {
+				for _, pbs := range res.precincts {
+					for _, pb := range pbs {
+						if pb == nil {
+							continue
+						}
+						b := pb.band
+						e.band, e.style = b.typ, b.style
+						for _, cb := range pb.blocks {
+							w, h := cb.x1-cb.x0, cb.y1-cb.y0
+							coef := make([]int32, 0, w*h)
+							for y := cb.y0; y < cb.y1; y++ {
+								for x := cb.x0; x < cb.x1; x++ {
+									coef = append(coef, coefs[b][(y-b.y0)*(b.x1-b.x0)+x-b.x0])
+								}
+							}
+							blocks[cb] = e.encode(t, coef, w, h, b.planes, tp.layers)
+						}
+					}
+				}
+			}
+		}
+
+		pp, err := tile.packets()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tags := map[*jpxPrecinctBand][2]*jpxTagEncoder{}
+
+		var headers, bodies [][]byte
+
+		for n, pk := range pp {
+
+			w := &jpxBitWriter{}
+			var data []byte
+
+			pbs := tile.comps[pk.c].res[pk.r].precincts[pk.p]
+
+			empty := true
+			for _, pb := range pbs {
+				if pb == nil {
+					continue
+				}
+				for _, cb := range pb.blocks {
+					if blocks[cb].layers[pk.l] > 0 {
+						empty = false
+					}
+				}
+			}
+
+			w.writeBit(0)
+			if !empty {
+				w.bits[0] = 1
+				for _, pb := range pbs {
+					if pb == nil {
+						continue
+					}
+					tt, ok := tags[pb]
+					if !ok {
+						var incl, zero []int
+						for _, cb := range pb.blocks {
+							eb := blocks[cb]
+							l := 0
+							for l < tp.layers && eb.layers[l] == 0 {
+								l++
+							}
+							incl = append(incl, l)
+							zero = append(zero, eb.zero)
+						}
+						tt = [2]*jpxTagEncoder{newJPXTagEncoder(pb.w, pb.h, incl), newJPXTagEncoder(pb.w, pb.h, zero)}
+						tags[pb] = tt
+					}
+					for i, cb := range pb.blocks {
+						data = append(data, blocks[cb].write(w, pk.l, i, pb, tt[0], tt[1])...)
+					}
+				}
+			}
+
+			header := w.bytes()
+			if header[len(header)-1] == 0xFF {
+				header = append(header, 0)
+			}
+			if tp.eph {
+				header = append(header, be16Bytes(jpxEPH)...)
+			}
+
+			var body []byte
+			if tp.sop {
+				body = jpxSegmentBytes(jpxSOP, be16Bytes(n))
+			}
+			if !tp.packed {
+				body = append(body, header...)
+			}
+			body = append(body, data...)
+
+			headers = append(headers, header)
+			bodies = append(bodies, body)
+		}
+
+		parts := [][2]int{{0, len(pp)}}
+		if tp.split && len(pp) > 1 {
+			parts = [][2]int{{0, len(pp) / 2}, {len(pp) / 2, len(pp)}}
+		}
+
+		for k, pt := range parts {
+			var hdrs [][]byte
+			if tp.packed {
+				hdrs = headers[pt[0]:pt[1]]
+			}
+			cs = append(cs, jpxTilePartBytes(td.index, k, len(parts), hdrs, bytes.Join(bodies[pt[0]:pt[1]], nil))...)
+		}
+	}
+
+	return append(cs, be16Bytes(jpxEOC)...)
+}
+
+func jp2Box(typ string, data ...[]byte) []byte {
+	p := bytes.Join(data, nil)
+	return bytes.Join([][]byte{be32Bytes(len(p) + 8), []byte(typ), p}, nil)
+}
+
+// jp2File wraps a codestream into a JP2 file using the boxes of the JP2 header.
+func jp2File(tp jpxTestParms, cs []byte, boxes ...[]byte) []byte {
+	ihdr := jp2Box("ihdr", be32Bytes(tp.y1-tp.y0), be32Bytes(tp.x1-tp.x0), be16Bytes(len(tp.comps)), []byte{byte(tp.comps[0].prec - 1), 7, 0, 0})
+	return bytes.Join([][]byte{
+		jp2Signature,
+		jp2Box("ftyp", []byte("jp2 "), be32Bytes(0), []byte("jp2 ")),
+		jp2Box("jp2h", append([][]byte{ihdr}, boxes...)...),
+		jp2Box("jp2c", cs),
+	}, nil)
+}
+
+func jp2ColrBox(cs int) []byte {
+	return jp2Box("colr", []byte{1, 0, 0}, be32Bytes(cs))
+}
+
+// jpxTestPlanes returns component planes filled by fn.
+func jpxTestPlanes(tp jpxTestParms, fn func(c, x, y int) int) [][]int {
+	var planes [][]int
+	for i, comp := range tp.comps {
+		cx0, cy0 := jpxCeilDiv(tp.x0, comp.dx), jpxCeilDiv(tp.y0, comp.dy)
+		cx1, cy1 := jpxCeilDiv(tp.x1, comp.dx), jpxCeilDiv(tp.y1, comp.dy)
+		var plane []int
+		max := 1<<uint(comp.prec) - 1
+		for y := cy0; y < cy1; y++ {
+			for x := cx0; x < cx1; x++ {
+				v := fn(i, x, y)
+				if v < 0 {
+					v = 0
+				}
+				if v > max {
+					v = max
+				}
+				plane = append(plane, v)
+			}
+		}
+		planes = append(planes, plane)
+	}
+	return planes
+}
+
+// jpxTestSamples returns the 8 bit samples of component plane i on the reference grid.
+func jpxTestSamples(tp jpxTestParms, planes [][]int, i int) []byte {
+	comp := tp.comps[i]
+	cx0, cy0 := jpxCeilDiv(tp.x0, comp.dx), jpxCeilDiv(tp.y0, comp.dy)
+	cw := jpxCeilDiv(tp.x1, comp.dx) - cx0
+	max := 1<<uint(comp.prec) - 1
+	var p []byte
+	for y := tp.y0; y < tp.y1; y++ {
+		for x := tp.x0; x < tp.x1; x++ {
+			// Samples at the left and top image edges may fall before the first component sample.
+			v := planes[i][jpxMax(y/comp.dy-cy0, 0)*cw+jpxMax(x/comp.dx-cx0, 0)]
+			p = append(p, byte((v*255+max/2)/max))
+		}
+	}
+	return p
+}
+
+// jpxInterleaved returns the interleaved 8 bit samples of the component planes.
+func jpxInterleaved(tp jpxTestParms, planes [][]int, comps ...int) []byte {
+	var cp [][]byte
+	for _, i := range comps {
+		cp = append(cp, jpxTestSamples(tp, planes, i))
+	}
+	var p []byte
+	for i := range cp[0] {
+		for _, c := range cp {
+			p = append(p, c[i])
+		}
+	}
+	return p
+}
+
+func checkJPXSamples(t *testing.T, got, want []byte, tol int) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("jpx: got %d samples, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if d := int(got[i]) - int(want[i]); d > tol || d < -tol {
+			t.Fatalf("jpx: sample %d: got %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func decodeJPXTest(t *testing.T, p []byte, w, h, colors int) *JPXImage {
+	t.Helper()
+	img, err := DecodeJPX(bytes.NewReader(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != w || img.Height != h || img.Colors != colors {
+		t.Fatalf("jpx: got %dx%d with %d colors, want %dx%d with %d colors", img.Width, img.Height, img.Colors, w, h, colors)
+	}
+	return img
+}
+
+func jpxComps(n, prec, dx, dy int) []jpxComponent {
+	var cc []jpxComponent
+	for i := 0; i < n; i++ {
+		cc = append(cc, jpxComponent{prec: prec, dx: dx, dy: dy})
+	}
+	return cc
+}
+
+// jpxNoise returns a test pattern containing high frequencies.
+func jpxNoise(c, x, y int) int {
+	return (x*7 + y*13 + c*50 + (x*y)%17 + (x^y)*3) % 256
+}
+
+func TestJPXReversible(t *testing.T) {
+
+	for _, tt := range []struct {
+		name string
+		tp   jpxTestParms
+	}{
+		{"gray", jpxTestParms{
+			x0: 3, y0: 2, x1: 64, y1: 49, tw: 64, th: 49,
+			comps: jpxComps(1, 8, 1, 1), levels: 3, cbw: 4, cbh: 4,
+			prog: jpxLRCP, layers: 1, guard: 2}},
+		{"rgb tiles precincts layers", jpxTestParms{
+			x0: 5, y0: 3, x1: 70, y1: 52, tw: 24, th: 24, tx0: 2, ty0: 1,
+			comps: jpxComps(3, 8, 1, 1), levels: 2, cbw: 3, cbh: 3,
+			precincts: []byte{0x33, 0x44, 0x44}, prog: jpxRLCP, layers: 3,
+			mct: true, sop: true, eph: true, guard: 2, style: jpxTermAll | jpxReset}},
+		{"bypass packed headers", jpxTestParms{
+			x1: 40, y1: 40, tw: 20, th: 20,
+			comps: jpxComps(1, 12, 1, 1), levels: 2, cbw: 3, cbh: 4,
+			prog: jpxRPCL, layers: 2, guard: 2, style: jpxBypass | jpxVertCausal | jpxSegSymbols,
+			packed: true, split: true, eph: true}},
+		{"subsampled", jpxTestParms{
+			x0: 1, y0: 1, x1: 45, y1: 38, tw: 45, th: 38,
+			comps:  []jpxComponent{{prec: 8, dx: 1, dy: 1}, {prec: 8, dx: 2, dy: 2}, {prec: 8, dx: 2, dy: 1}},
+			levels: 3, cbw: 2, cbh: 2, precincts: []byte{0x22, 0x33, 0x33, 0x44},
+			prog: jpxPCRL, layers: 2, guard: 2, split: true}},
+		{"cprl", jpxTestParms{
+			x1: 33, y1: 17, tw: 16, th: 16,
+			comps: jpxComps(3, 8, 1, 1), levels: 1, cbw: 2, cbh: 5,
+			precincts: []byte{0x11, 0x22},
+			prog:      jpxCPRL, layers: 4, guard: 3, style: jpxBypass | jpxTermAll}},
+		{"poc roi", jpxTestParms{
+			x1: 30, y1: 30, tw: 30, th: 30,
+			comps: jpxComps(3, 8, 1, 1), levels: 2, cbw: 4, cbh: 4,
+			prog: jpxLRCP, layers: 2, guard: 2, roi: 9,
+			pocs: []jpxProgChange{{rs: 0, re: 2, cs: 0, ce: 3, lye: 1, prog: jpxRLCP}, {rs: 0, re: 3, cs: 0, ce: 3, lye: 2, prog: jpxCPRL}}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := tt.tp
+			tp.reversible = true
+			max := 1<<uint(tp.comps[0].prec) - 1
+			planes := jpxTestPlanes(tp, func(c, x, y int) int { return jpxNoise(c, x, y) * max / 255 })
+			cs := encodeJPX(t, tp, planes)
+
+			// Without JP2 header all components are colors.
+			var comps []int
+			for i := range tp.comps {
+				comps = append(comps, i)
+			}
+			img := decodeJPXTest(t, cs, tp.x1-tp.x0, tp.y1-tp.y0, len(tp.comps))
+			checkJPXSamples(t, img.Data, jpxInterleaved(tp, planes, comps...), 0)
+		})
+	}
+}
+
+func TestJPXIrreversible(t *testing.T) {
+
+	smooth := func(c, x, y int) int {
+		return 128 + int(100*math.Sin(float64(x+c*10)/5)*math.Cos(float64(y)/7))
+	}
+
+	for _, tt := range []struct {
+		name string
+		tp   jpxTestParms
+		tol  int
+	}{
+		{"derived", jpxTestParms{
+			x1: 50, y1: 41, tw: 50, th: 41,
+			comps: jpxComps(3, 8, 1, 1), levels: 2, cbw: 4, cbh: 4,
+			prog: jpxPCRL, layers: 2, mct: true, quant: jpxQuantDerived, guard: 2, eps0: 3}, 4},
+		{"expounded", jpxTestParms{
+			x0: 7, y0: 9, x1: 57, y1: 50, tw: 32, th: 32, tx0: 5, ty0: 5,
+			comps: jpxComps(1, 8, 1, 1), levels: 3, cbw: 3, cbh: 3,
+			prog: jpxRPCL, layers: 1, quant: jpxQuantExpounded, guard: 2, eps0: 2,
+			style: jpxTermAll | jpxVertCausal}, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := tt.tp
+			planes := jpxTestPlanes(tp, smooth)
+			cs := encodeJPX(t, tp, planes)
+			img := decodeJPXTest(t, cs, tp.x1-tp.x0, tp.y1-tp.y0, len(tp.comps))
+			var comps []int
+			for i := range tp.comps {
+				comps = append(comps, i)
+			}
+			checkJPXSamples(t, img.Data, jpxInterleaved(tp, planes, comps...), tt.tol)
+		})
+	}
+}
+
+func TestJPXTruncated(t *testing.T) {
+
+	tp := jpxTestParms{
+		x1: 32, y1: 32, tw: 32, th: 32,
+		comps: jpxComps(1, 8, 1, 1), levels: 2, cbw: 4, cbh: 4,
+		prog: jpxLRCP, layers: 2, guard: 2, reversible: true}
+
+	cs := encodeJPX(t, tp, jpxTestPlanes(tp, jpxNoise))
+
+	// Decode what we've got.
+	decodeJPXTest(t, cs[:len(cs)-100], 32, 32, 1)
+}
+
+func TestJP2(t *testing.T) {
+
+	gray := jpxTestParms{
+		x1: 21, y1: 13, tw: 21, th: 13,
+		comps: jpxComps(2, 8, 1, 1), levels: 1, cbw: 4, cbh: 4,
+		prog: jpxLRCP, layers: 1, guard: 2, reversible: true}
+
+	planes := jpxTestPlanes(gray, jpxNoise)
+	cs := encodeJPX(t, gray, planes)
+
+	t.Run("gray alpha", func(t *testing.T) {
+		cdef := jp2Box("cdef", be16Bytes(2), be16Bytes(0), be16Bytes(1), be16Bytes(0), be16Bytes(1), be16Bytes(0), be16Bytes(1))
+		img := decodeJPXTest(t, jp2File(gray, cs, jp2ColrBox(jp2Gray), cdef), 21, 13, 1)
+		checkJPXSamples(t, img.Alpha, jpxTestSamples(gray, planes, 0), 0)
+		checkJPXSamples(t, img.Data, jpxTestSamples(gray, planes, 1), 0)
+	})
+
+	t.Run("implied alpha", func(t *testing.T) {
+		img := decodeJPXTest(t, jp2File(gray, cs, jp2ColrBox(jp2Gray)), 21, 13, 1)
+		checkJPXSamples(t, img.Data, jpxTestSamples(gray, planes, 0), 0)
+		checkJPXSamples(t, img.Alpha, jpxTestSamples(gray, planes, 1), 0)
+	})
+
+	t.Run("palette", func(t *testing.T) {
+		pclr := [][]byte{be16Bytes(256), {3, 7, 7, 7}}
+		for i := 0; i < 256; i++ {
+			pclr = append(pclr, []byte{byte(i), byte(255 - i), byte(i / 2)})
+		}
+		var cmap [][]byte
+		for i := 0; i < 3; i++ {
+			cmap = append(cmap, be16Bytes(0), []byte{1, byte(i)})
+		}
+		img := decodeJPXTest(t, jp2File(gray, cs, jp2ColrBox(16), jp2Box("pclr", pclr...), jp2Box("cmap", cmap...)), 21, 13, 3)
+		var want []byte
+		for _, v := range jpxTestSamples(gray, planes, 0) {
+			want = append(want, v, 255-v, v/2)
+		}
+		checkJPXSamples(t, img.Data, want, 0)
+	})
+
+	t.Run("sYCC", func(t *testing.T) {
+		tp := jpxTestParms{
+			x1: 36, y1: 20, tw: 36, th: 20,
+			comps:  []jpxComponent{{prec: 8, dx: 1, dy: 1}, {prec: 8, dx: 2, dy: 2}, {prec: 8, dx: 2, dy: 2}},
+			levels: 2, cbw: 4, cbh: 4, prog: jpxLRCP, layers: 1, guard: 2, reversible: true}
+		planes := jpxTestPlanes(tp, jpxNoise)
+		img := decodeJPXTest(t, jp2File(tp, encodeJPX(t, tp, planes), jp2ColrBox(jp2SYCC)), 36, 20, 3)
+		want := jpxInterleaved(tp, planes, 0, 1, 2)
+		for i := 0; i < len(want); i += 3 {
+			want[i], want[i+1], want[i+2] = color.YCbCrToRGB(want[i], want[i+1], want[i+2])
+		}
+		checkJPXSamples(t, img.Data, want, 0)
+	})
+}
+
+func TestJPXDecodeFilter(t *testing.T) {
+
+	tp := jpxTestParms{
+		x1: 16, y1: 16, tw: 16, th: 16,
+		comps: jpxComps(3, 8, 1, 1), levels: 2, cbw: 4, cbh: 4,
+		prog: jpxLRCP, layers: 1, guard: 2, reversible: true, mct: true}
+
+	planes := jpxTestPlanes(tp, jpxNoise)
+
+	f, err := NewFilter(JPX, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := new(bytes.Buffer)
+	err = f.Decode(bytes.NewReader(encodeJPX(t, tp, planes)), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkJPXSamples(t, b.Bytes(), jpxInterleaved(tp, planes, 0, 1, 2), 0)
+}
@@ -0,0 +1,500 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the packet decoding of JPEG 2000 (See ITU-T T.800 Annex B).
+
+var errJPXTruncated = errors.New("pdfcpu: jpx: truncated packet data")
+
+// jpxBitReader reads packet headers (See B.10.1).
+type jpxBitReader struct {
+	p   []byte
+	pos int
+	c   byte
+	ct  uint
+}
+
+func (br *jpxBitReader) readBit() (int, error) {
+	if br.ct == 0 {
+		if br.pos >= len(br.p) {
+			return 0, errJPXTruncated
+		}
+		// A byte following 0xFF has a stuffed 0 bit.
+		br.ct = 8
+		if br.c == 0xFF {
+			br.ct = 7
+		}
+		br.c = br.p[br.pos]
+		br.pos++
+	}
+	br.ct--
+	return int(br.c>>br.ct) & 1, nil
+}
+
+func (br *jpxBitReader) readBits(n int) (int, error) {
+	v := 0
+	for i := 0; i < n; i++ {
+		b, err := br.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+	return v, nil
+}
+
+// align skips the remaining bits of the current byte.
+func (br *jpxBitReader) align() {
+	if br.c == 0xFF && br.pos < len(br.p) {
+		// Skip the byte holding the stuffed bit.
+		br.pos++
+	}
+	br.c, br.ct = 0, 0
+}
+
+// skipMarker skips marker m at the current position if present.
+func (br *jpxBitReader) skipMarker(m, n int) {
+	if br.pos+2 <= len(br.p) && be16(br.p[br.pos:]) == m {
+		br.pos += n
+	}
+}
+
+// jpxTagTree is a tag tree (See B.10.2).
+type jpxTagTree struct {
+	nodes []jpxTagNode
+}
+
+type jpxTagNode struct {
+	parent int
+	value  int
+	low    int
+}
+
+const jpxTagUnknown = 1 << 30
+
+func newJPXTagTree(w, h int) *jpxTagTree {
+
+	t := &jpxTagTree{}
+
+	// Levels from leaves to root.
+	type level struct{ w, h, offset int }
+	var levels []level
+
+	for n := 0; ; {
+		levels = append(levels, level{w, h, n})
+		n += w * h
+		if w == 1 && h == 1 {
+			break
+		}
+		w, h = (w+1)/2, (h+1)/2
+	}
+
+	for i, l := range levels {
+		for y := 0; y < l.h; y++ {
+			for x := 0; x < l.w; x++ {
+				parent := -1
+				if i+1 < len(levels) {
+					p := levels[i+1]
+					parent = p.offset + (y/2)*p.w + x/2
+				}
+				t.nodes = append(t.nodes, jpxTagNode{parent: parent, value: jpxTagUnknown})
+			}
+		}
+	}
+
+	return t
+}
+
+// decode decodes leaf up to threshold and returns true if the leaf value is below threshold.
+func (t *jpxTagTree) decode(br *jpxBitReader, leaf, threshold int) (bool, error) {
+
+	var path []int
+	for i := leaf; i >= 0; i = t.nodes[i].parent {
+		path = append(path, i)
+	}
+
+	low := 0
+
+	for k := len(path) - 1; k >= 0; k-- {
+		n := &t.nodes[path[k]]
+		if low > n.low {
+			n.low = low
+		} else {
+			low = n.low
+		}
+		for low < threshold && low < n.value {
+			b, err := br.readBit()
+			if err != nil {
+				return false, err
+			}
+			if b == 1 {
+				n.value = low
+			} else {
+				low++
+			}
+		}
+		n.low = low
+	}
+
+	return t.nodes[leaf].value < threshold, nil
+}
+
+// jpxSegment is a codeword segment of a code-block.
+type jpxSegment struct {
+	data      []byte
+	passes    int
+	maxPasses int
+}
+
+// jpxCodeBlock represents a code-block within a sub-band.
+type jpxCodeBlock struct {
+	x0, y0, x1, y1 int // in sub-band coordinates
+	included       bool
+	lblock         int
+	zeroPlanes     int
+	passes         int
+	segs           []*jpxSegment
+}
+
+// jpxPrecinctBand holds the code-blocks of a sub-band falling into a precinct.
+type jpxPrecinctBand struct {
+	band       *jpxBand
+	w, h       int // number of code-blocks
+	blocks     []*jpxCodeBlock
+	incl, zero *jpxTagTree
+}
+
+// jpxMaxPasses returns the maximum number of coding passes of code-block segment i.
+func jpxMaxPasses(style, i int) int {
+	switch {
+	case style&jpxTermAll != 0:
+		return 1
+	case style&jpxBypass != 0:
+		if i == 0 {
+			return 10
+		}
+		if i%2 == 1 {
+			return 2
+		}
+		return 1
+	}
+	return 1 << 30
+}
+
+// readNumPasses reads the number of coding passes (See Table B.4).
+func (br *jpxBitReader) readNumPasses() (int, error) {
+
+	for _, c := range []struct{ bits, limit, offset int }{{1, 1, 1}, {1, 1, 2}, {2, 3, 3}, {5, 31, 6}, {7, 128, 37}} {
+		v, err := br.readBits(c.bits)
+		if err != nil {
+			return 0, err
+		}
+		if v < c.limit {
+			return c.offset + v, nil
+		}
+	}
+
+	return 0, errors.New("pdfcpu: jpx: invalid number of coding passes")
+}
+
+func jpxFloorLog2(n int) int {
+	l := 0
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
+
+// jpxSegmentPart is the contribution of a packet to a code-block segment.
+type jpxSegmentPart struct {
+	seg    *jpxSegment
+	length int
+}
+
+// readPacket reads the packet of layer l for precinct pbs.
+func (t *jpxTile) readPacket(l int, pbs []*jpxPrecinctBand) error {
+
+	if t.cod.sop {
+		t.body.skipMarker(jpxSOP, 6)
+	}
+
+	hdr := t.hdr
+
+	nonEmpty, err := hdr.readBit()
+	if err != nil {
+		return err
+	}
+
+	var parts []jpxSegmentPart
+
+	if nonEmpty == 1 {
+		for _, pb := range pbs {
+			if pb == nil {
+				continue
+			}
+			p, err := pb.readCodeBlocks(hdr, l, pb.band.style)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, p...)
+		}
+	}
+
+	hdr.align()
+
+	if t.cod.eph {
+		hdr.skipMarker(jpxEPH, 2)
+	}
+
+	// Packet body
+	body := t.body
+	for _, p := range parts {
+		if body.pos+p.length > len(body.p) {
+			return errJPXTruncated
+		}
+		p.seg.data = append(p.seg.data, body.p[body.pos:body.pos+p.length]...)
+		body.pos += p.length
+	}
+
+	return nil
+}
+
+// readCodeBlocks reads the packet header entries of the code-blocks of a precinct band.
+func (pb *jpxPrecinctBand) readCodeBlocks(br *jpxBitReader, l, style int) ([]jpxSegmentPart, error) {
+
+	var parts []jpxSegmentPart
+
+	for i, cb := range pb.blocks {
+
+		// Inclusion
+		var included bool
+		var err error
+		if cb.included {
+			b, err := br.readBit()
+			if err != nil {
+				return nil, err
+			}
+			included = b == 1
+		} else {
+			included, err = pb.incl.decode(br, i, l+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !included {
+			continue
+		}
+
+		if !cb.included {
+			// Missing most significant bit-planes
+			for z := 1; ; z++ {
+				ok, err := pb.zero.decode(br, i, z)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					break
+				}
+				if z > 64 {
+					return nil, errors.New("pdfcpu: jpx: invalid number of zero bit-planes")
+				}
+			}
+			cb.zeroPlanes = pb.zero.nodes[i].value
+			cb.included = true
+			cb.lblock = 3
+		}
+
+		n, err := br.readNumPasses()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			b, err := br.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if b == 0 {
+				break
+			}
+			cb.lblock++
+		}
+
+		// Distribute the new coding passes over codeword segments.
+		for n > 0 {
+			var seg *jpxSegment
+			if k := len(cb.segs); k > 0 && cb.segs[k-1].passes < cb.segs[k-1].maxPasses {
+				seg = cb.segs[k-1]
+			} else {
+				seg = &jpxSegment{maxPasses: jpxMaxPasses(style, len(cb.segs))}
+				cb.segs = append(cb.segs, seg)
+			}
+
+			k := seg.maxPasses - seg.passes
+			if k > n {
+				k = n
+			}
+
+			length, err := br.readBits(cb.lblock + jpxFloorLog2(k))
+			if err != nil {
+				return nil, err
+			}
+
+			seg.passes += k
+			cb.passes += k
+			n -= k
+
+			parts = append(parts, jpxSegmentPart{seg, length})
+		}
+	}
+
+	return parts, nil
+}
+
+// jpxPacket identifies a packet by layer, resolution level, component and precinct.
+type jpxPacket struct {
+	l, r, c, p int
+}
+
+// jpxPrecinctPos identifies a precinct and its position on the reference grid.
+type jpxPrecinctPos struct {
+	r, c, p int
+	x, y    int
+}
+
+// packets returns the packets of the tile in progression order (See B.12).
+func (t *jpxTile) packets() ([]jpxPacket, error) {
+
+	pocs := t.pocs
+	if len(pocs) == 0 {
+		pocs = []jpxProgChange{{rs: 0, re: 33, cs: 0, ce: len(t.comps), lye: t.cod.layers, prog: t.cod.prog}}
+	}
+
+	// The next layer of each precinct.
+	next := map[[3]int]int{}
+
+	var pp []jpxPacket
+
+	for _, poc := range pocs {
+
+		ce, re, lye := poc.ce, poc.re, poc.lye
+		if ce > len(t.comps) {
+			ce = len(t.comps)
+		}
+		if lye > t.cod.layers {
+			lye = t.cod.layers
+		}
+
+		var prec []jpxPrecinctPos
+		for c := poc.cs; c < ce; c++ {
+			tc := t.comps[c]
+			for r := poc.rs; r < re && r < len(tc.res); r++ {
+				res := tc.res[r]
+				for p := 0; p < res.npx*res.npy; p++ {
+					x, y := t.precinctPos(tc, res, p)
+					prec = append(prec, jpxPrecinctPos{r, c, p, x, y})
+				}
+			}
+		}
+
+		less := func(a, b jpxPrecinctPos, keys string) bool {
+			for _, k := range keys {
+				var u, v int
+				switch k {
+				case 'r':
+					u, v = a.r, b.r
+				case 'c':
+					u, v = a.c, b.c
+				case 'y':
+					u, v = a.y, b.y
+				case 'x':
+					u, v = a.x, b.x
+				case 'p':
+					u, v = a.p, b.p
+				}
+				if u != v {
+					return u < v
+				}
+			}
+			return false
+		}
+
+		emit := func(l int, q jpxPrecinctPos) {
+			k := [3]int{q.r, q.c, q.p}
+			if next[k] == l {
+				pp = append(pp, jpxPacket{l, q.r, q.c, q.p})
+				next[k]++
+			}
+		}
+
+		var keys string
+
+		switch poc.prog {
+
+		case jpxLRCP:
+			sort.SliceStable(prec, func(i, j int) bool { return less(prec[i], prec[j], "rcp") })
+			for l := 0; l < lye; l++ {
+				for _, q := range prec {
+					emit(l, q)
+				}
+			}
+			continue
+
+		case jpxRLCP:
+			sort.SliceStable(prec, func(i, j int) bool { return less(prec[i], prec[j], "rcp") })
+			for i, j := 0, 0; i < len(prec); i = j {
+				for j = i; j < len(prec) && prec[j].r == prec[i].r; j++ {
+				}
+				for l := 0; l < lye; l++ {
+					for _, q := range prec[i:j] {
+						emit(l, q)
+					}
+				}
+			}
+			continue
+
+		case jpxRPCL:
+			keys = "ryxcp"
+
+		case jpxPCRL:
+			keys = "yxcrp"
+
+		case jpxCPRL:
+			keys = "cyxrp"
+
+		default:
+			return nil, errors.Errorf("pdfcpu: jpx: invalid progression order %d", poc.prog)
+		}
+
+		sort.SliceStable(prec, func(i, j int) bool { return less(prec[i], prec[j], keys) })
+		for _, q := range prec {
+			for l := 0; l < lye; l++ {
+				emit(l, q)
+			}
+		}
+	}
+
+	return pp, nil
+}
@@ -0,0 +1,578 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// This file implements the reconstruction of JPEG 2000 tiles
+// including dequantization (See Annex E), the inverse wavelet transformation (See Annex F)
+// and the inverse multiple component transformation (See Annex G).
+
+// jpxBand represents a sub-band of a tile-component.
+type jpxBand struct {
+	typ            int
+	x0, y0, x1, y1 int
+	style          int     // code-block style
+	planes         int     // number of magnitude bit-planes
+	roi            int     // region of interest shift
+	delta          float32 // quantization step size
+	data           []float32
+}
+
+// jpxResolution represents a resolution level of a tile-component.
+type jpxResolution struct {
+	x0, y0, x1, y1 int
+	levelNo        int // number of remaining decomposition levels
+	ppx, ppy       uint
+	npx, npy       int
+	bands          []*jpxBand
+	precincts      [][]*jpxPrecinctBand // code-blocks per precinct and sub-band
+}
+
+// jpxTileComp represents a tile-component.
+type jpxTileComp struct {
+	x0, y0, x1, y1 int
+	dx, dy         int
+	reversible     bool
+	res            []*jpxResolution
+	data           []float32
+}
+
+// jpxTile represents a tile being decoded.
+type jpxTile struct {
+	x0, y0, x1, y1 int
+	cod            *jpxCodingParms
+	pocs           []jpxProgChange
+	comps          []*jpxTileComp
+	hdr, body      *jpxBitReader
+}
+
+func jpxMin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func jpxMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// newTile sets up the tile structure down to the code-blocks.
+func (c *jpxCodestream) newTile(td *jpxTileData) (*jpxTile, error) {
+
+	s := c.siz
+	p, q := td.index%s.numXTiles, td.index/s.numXTiles
+
+	t := &jpxTile{
+		x0:   jpxMax(s.tx0+p*s.tw, s.x0),
+		y0:   jpxMax(s.ty0+q*s.th, s.y0),
+		x1:   jpxMin(s.tx0+(p+1)*s.tw, s.x1),
+		y1:   jpxMin(s.ty0+(q+1)*s.th, s.y1),
+		cod:  c.cod(td),
+		pocs: c.pocs(td),
+		body: &jpxBitReader{p: td.data},
+	}
+
+	t.hdr = t.body
+	if td.packed {
+		t.hdr = &jpxBitReader{p: td.headers}
+	}
+
+	for i, comp := range s.comps {
+
+		cs := c.codingStyle(td, i)
+		qs := c.quantization(td, i)
+
+		tc := &jpxTileComp{
+			x0:         jpxCeilDiv(t.x0, comp.dx),
+			y0:         jpxCeilDiv(t.y0, comp.dy),
+			x1:         jpxCeilDiv(t.x1, comp.dx),
+			y1:         jpxCeilDiv(t.y1, comp.dy),
+			dx:         comp.dx,
+			dy:         comp.dy,
+			reversible: cs.reversible,
+		}
+
+		for r := 0; r <= cs.levels; r++ {
+			res, err := newJPXResolution(tc, cs, qs, comp.prec, c.roiShift(td, i), r)
+			if err != nil {
+				return nil, err
+			}
+			tc.res = append(tc.res, res)
+		}
+
+		t.comps = append(t.comps, tc)
+	}
+
+	return t, nil
+}
+
+func newJPXResolution(tc *jpxTileComp, cs *jpxCodingStyle, qs *jpxQuant, prec, roi, r int) (*jpxResolution, error) {
+
+	n := cs.levels - r
+
+	res := &jpxResolution{
+		x0:      jpxCeilDiv(tc.x0, 1<<uint(n)),
+		y0:      jpxCeilDiv(tc.y0, 1<<uint(n)),
+		x1:      jpxCeilDiv(tc.x1, 1<<uint(n)),
+		y1:      jpxCeilDiv(tc.y1, 1<<uint(n)),
+		levelNo: n,
+		ppx:     cs.ppx[r],
+		ppy:     cs.ppy[r],
+	}
+
+	if r > 0 && (res.ppx == 0 || res.ppy == 0) {
+		return nil, errors.New("pdfcpu: jpx: invalid precinct size")
+	}
+
+	if res.x1 > res.x0 && res.y1 > res.y0 {
+		res.npx = jpxCeilDiv(res.x1, 1<<res.ppx) - res.x0>>res.ppx
+		res.npy = jpxCeilDiv(res.y1, 1<<res.ppy) - res.y0>>res.ppy
+	}
+
+	types := []int{jpxHL, jpxLH, jpxHH}
+	nb := n + 1
+	if r == 0 {
+		types = []int{jpxLL}
+		nb = n
+	}
+
+	for _, typ := range types {
+		b, err := newJPXBand(tc, cs, qs, prec, roi, r, nb, typ)
+		if err != nil {
+			return nil, err
+		}
+		res.bands = append(res.bands, b)
+	}
+
+	// Code-block size exponents
+	xcb, ycb := cs.cbw, cs.cbh
+	bpx, bpy := res.ppx, res.ppy
+	if r > 0 {
+		bpx, bpy = bpx-1, bpy-1
+	}
+	if xcb > bpx {
+		xcb = bpx
+	}
+	if ycb > bpy {
+		ycb = bpy
+	}
+
+	for p := 0; p < res.npx*res.npy; p++ {
+
+		// Precinct origin in sub-band coordinates
+		x := (res.x0>>res.ppx + p%res.npx) << res.ppx
+		y := (res.y0>>res.ppy + p/res.npx) << res.ppy
+		if r > 0 {
+			x, y = x>>1, y>>1
+		}
+
+		var pbs []*jpxPrecinctBand
+		for _, b := range res.bands {
+			pbs = append(pbs, newJPXPrecinctBand(b, x, y, 1<<bpx, 1<<bpy, xcb, ycb))
+		}
+		res.precincts = append(res.precincts, pbs)
+	}
+
+	return res, nil
+}
+
+func newJPXBand(tc *jpxTileComp, cs *jpxCodingStyle, qs *jpxQuant, prec, roi, r, nb, typ int) (*jpxBand, error) {
+
+	xo, yo := 0, 0
+	if typ&1 != 0 {
+		xo = 1 << uint(nb-1)
+	}
+	if typ&2 != 0 {
+		yo = 1 << uint(nb-1)
+	}
+
+	b := &jpxBand{
+		typ:   typ,
+		x0:    jpxCeilDiv(tc.x0-xo, 1<<uint(nb)),
+		y0:    jpxCeilDiv(tc.y0-yo, 1<<uint(nb)),
+		x1:    jpxCeilDiv(tc.x1-xo, 1<<uint(nb)),
+		y1:    jpxCeilDiv(tc.y1-yo, 1<<uint(nb)),
+		style: cs.style,
+		roi:   roi,
+		delta: 1,
+	}
+
+	b.data = make([]float32, (b.x1-b.x0)*(b.y1-b.y0))
+
+	// Quantization (See E.1)
+	var eps, mu int
+
+	if qs.style == jpxQuantDerived {
+		eps, mu = qs.eps[0]-cs.levels+nb, qs.mu[0]
+	} else {
+		i := 0
+		if r > 0 {
+			i = 3*(r-1) + typ
+		}
+		if i >= len(qs.eps) {
+			return nil, errors.New("pdfcpu: jpx: missing quantization parameters")
+		}
+		eps, mu = qs.eps[i], qs.mu[i]
+	}
+
+	b.planes = qs.guard + eps - 1 + roi
+
+	if !cs.reversible {
+		// The nominal dynamic range depends on the sub-band gain.
+		gain := []int{0, 1, 1, 2}[typ]
+		b.delta = float32(math.Ldexp(1+float64(mu)/2048, prec+gain-eps))
+	}
+
+	return b, nil
+}
+
+// newJPXPrecinctBand returns the code-blocks of band b within the precinct at x,y of size w,h
+// or nil if there are none.
+func newJPXPrecinctBand(b *jpxBand, x, y, w, h int, xcb, ycb uint) *jpxPrecinctBand {
+
+	x0, y0 := jpxMax(x, b.x0), jpxMax(y, b.y0)
+	x1, y1 := jpxMin(x+w, b.x1), jpxMin(y+h, b.y1)
+
+	if x0 >= x1 || y0 >= y1 {
+		return nil
+	}
+
+	cbx0, cby0 := x0>>xcb, y0>>ycb
+	cbx1, cby1 := jpxCeilDiv(x1, 1<<xcb), jpxCeilDiv(y1, 1<<ycb)
+
+	pb := &jpxPrecinctBand{band: b, w: cbx1 - cbx0, h: cby1 - cby0}
+
+	for cy := cby0; cy < cby1; cy++ {
+		for cx := cbx0; cx < cbx1; cx++ {
+			pb.blocks = append(pb.blocks, &jpxCodeBlock{
+				x0: jpxMax(cx<<xcb, x0),
+				y0: jpxMax(cy<<ycb, y0),
+				x1: jpxMin((cx+1)<<xcb, x1),
+				y1: jpxMin((cy+1)<<ycb, y1),
+			})
+		}
+	}
+
+	pb.incl = newJPXTagTree(pb.w, pb.h)
+	pb.zero = newJPXTagTree(pb.w, pb.h)
+
+	return pb
+}
+
+// precinctPos returns the position of precinct p of a tile-component resolution on the reference grid.
+func (t *jpxTile) precinctPos(tc *jpxTileComp, res *jpxResolution, p int) (int, int) {
+	x := (res.x0>>res.ppx + p%res.npx) << res.ppx << uint(res.levelNo) * tc.dx
+	y := (res.y0>>res.ppy + p/res.npx) << res.ppy << uint(res.levelNo) * tc.dy
+	return jpxMax(x, t.x0), jpxMax(y, t.y0)
+}
+
+// decodeTile decodes a tile and stores the component samples in planes.
+func (c *jpxCodestream) decodeTile(td *jpxTileData, planes [][]uint16) error {
+
+	t, err := c.newTile(td)
+	if err != nil {
+		return err
+	}
+
+	pp, err := t.packets()
+	if err != nil {
+		return err
+	}
+
+	for _, pk := range pp {
+		res := t.comps[pk.c].res[pk.r]
+		if err := t.readPacket(pk.l, res.precincts[pk.p]); err != nil {
+			if err != errJPXTruncated {
+				return err
+			}
+			// Decode what we've got.
+			log.Debug.Printf("jpx: tile %d: %v\n", td.index, err)
+			break
+		}
+	}
+
+	for _, tc := range t.comps {
+		tc.decodeCodeBlocks()
+		tc.data = tc.inverseDWT()
+	}
+
+	if t.cod.mct && len(t.comps) >= 3 {
+		if err := t.inverseMCT(); err != nil {
+			return err
+		}
+	}
+
+	for i, tc := range t.comps {
+		tc.store(c.siz, c.siz.comps[i], planes[i])
+	}
+
+	return nil
+}
+
+// decodeCodeBlocks decodes all code-blocks of tc into dequantized sub-band coefficients.
+func (tc *jpxTileComp) decodeCodeBlocks() {
+
+	var d jpxBlockDecoder
+
+	for _, res := range tc.res {
+		for _, pbs := range res.precincts {
+			for _, pb := range pbs {
+				if pb == nil {
+					continue
+				}
+
+				b := pb.band
+				w := b.x1 - b.x0
+				d.band, d.style = b.typ, b.style
+
+				for _, cb := range pb.blocks {
+
+					off := (cb.y0-b.y0)*w + cb.x0 - b.x0
+
+					d.decode(cb, b.planes-cb.zeroPlanes, func(x, y int, v int32) {
+						if b.roi > 0 {
+							// Scale down the coefficients of the region of interest (See H.1).
+							m := v
+							if m < 0 {
+								m = -m
+							}
+							if m >= 1<<uint(b.roi) {
+								v >>= uint(b.roi)
+							}
+						}
+						b.data[off+y*w+x] = float32(v) * b.delta
+					})
+				}
+			}
+		}
+	}
+}
+
+// Symmetric extension of signals needs no more than 4 samples on each side.
+const jpxPad = 4
+
+// The lifting parameters of the irreversible 9-7 filter (See Table F.4).
+const (
+	jpxAlpha = -1.586134342059924
+	jpxBeta  = -0.052980118572961
+	jpxGamma = 0.882911075530934
+	jpxDelta = 0.443506852043971
+	jpxK     = 1.230174104914001
+)
+
+// inverseDWT reconstructs the tile-component samples from the sub-bands (See F.3).
+func (tc *jpxTileComp) inverseDWT() []float32 {
+
+	a := tc.res[0].bands[0].data
+
+	for r := 1; r < len(tc.res); r++ {
+		a = jpxInterleave(a, tc.res[r])
+		jpx2DSynthesis(a, tc.res[r], tc.reversible)
+	}
+
+	return a
+}
+
+// jpxInterleave interleaves the lower resolution ll and the sub-bands of resolution level res (See F.3.3).
+func jpxInterleave(ll []float32, res *jpxResolution) []float32 {
+
+	u0, v0 := res.x0, res.y0
+	w, h := res.x1-u0, res.y1-v0
+
+	a := make([]float32, w*h)
+
+	place := func(src []float32, x0, y0, x1, y1, xo, yo int) {
+		bw := x1 - x0
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				a[(2*y+yo-v0)*w+2*x+xo-u0] = src[(y-y0)*bw+x-x0]
+			}
+		}
+	}
+
+	place(ll, jpxCeilDiv(u0, 2), jpxCeilDiv(v0, 2), jpxCeilDiv(res.x1, 2), jpxCeilDiv(res.y1, 2), 0, 0)
+
+	for _, b := range res.bands {
+		place(b.data, b.x0, b.y0, b.x1, b.y1, b.typ&1, b.typ>>1)
+	}
+
+	return a
+}
+
+// jpx2DSynthesis performs the horizontal and vertical 1D sub-band reconstructions of a resolution level (See F.3.2).
+func jpx2DSynthesis(a []float32, res *jpxResolution, reversible bool) {
+
+	w, h := res.x1-res.x0, res.y1-res.y0
+	if w == 0 || h == 0 {
+		return
+	}
+
+	buf := make([]float32, jpxMax(w, h)+2*jpxPad)
+
+	for y := 0; y < h; y++ {
+		row := a[y*w : (y+1)*w]
+		copy(buf[jpxPad:], row)
+		jpx1DSynthesis(buf[:w+2*jpxPad], res.x0, reversible)
+		copy(row, buf[jpxPad:])
+	}
+
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			buf[jpxPad+y] = a[y*w+x]
+		}
+		jpx1DSynthesis(buf[:h+2*jpxPad], res.y0, reversible)
+		for y := 0; y < h; y++ {
+			a[y*w+x] = buf[jpxPad+y]
+		}
+	}
+}
+
+// jpx1DSynthesis performs the 1D sub-band reconstruction of the interleaved signal in buf
+// starting at coordinate i0 and padded by jpxPad samples on each side (See F.3.6).
+func jpx1DSynthesis(buf []float32, i0 int, reversible bool) {
+
+	n := len(buf) - 2*jpxPad
+	x := buf[jpxPad : jpxPad+n]
+
+	if n == 1 {
+		if i0&1 == 1 {
+			if reversible {
+				x[0] = float32(int32(x[0]) / 2)
+			} else {
+				x[0] /= 2
+			}
+		}
+		return
+	}
+
+	// Periodic symmetric extension (See F.3.7)
+	mirror := func(i int) int {
+		for i < 0 || i >= n {
+			if i < 0 {
+				i = -i
+			}
+			if i >= n {
+				i = 2*(n-1) - i
+			}
+		}
+		return i
+	}
+
+	for k := 1; k <= jpxPad; k++ {
+		buf[jpxPad-k] = x[mirror(-k)]
+		buf[jpxPad+n-1+k] = x[mirror(n-1+k)]
+	}
+
+	// buf[j] holds the sample at coordinate i0-jpxPad+j.
+	even, odd := i0&1, 1-i0&1
+	m := len(buf)
+
+	// lift updates the samples starting at buf[start] using their neighbours.
+	lift := func(start int, f func(l, r float32) float32) {
+		if start == 0 {
+			start = 2
+		}
+		for j := start; j < m-1; j += 2 {
+			buf[j] += f(buf[j-1], buf[j+1])
+		}
+	}
+
+	if reversible {
+		// See F.3.8.1
+		lift(even, func(l, r float32) float32 { return -float32(math.Floor(float64(l+r+2) / 4)) })
+		lift(odd, func(l, r float32) float32 { return float32(math.Floor(float64(l+r) / 2)) })
+		return
+	}
+
+	// See F.3.8.2
+	for j := even; j < m; j += 2 {
+		buf[j] *= jpxK
+	}
+	for j := odd; j < m; j += 2 {
+		buf[j] *= 1 / jpxK
+	}
+
+	for _, s := range []struct {
+		start int
+		c     float32
+	}{{even, jpxDelta}, {odd, jpxGamma}, {even, jpxBeta}, {odd, jpxAlpha}} {
+		c := s.c
+		lift(s.start, func(l, r float32) float32 { return -c * (l + r) })
+	}
+}
+
+// inverseMCT applies the inverse multiple component transformation to the first three components (See G.2 and G.3).
+func (t *jpxTile) inverseMCT() error {
+
+	c0, c1, c2 := t.comps[0], t.comps[1], t.comps[2]
+
+	if len(c0.data) != len(c1.data) || len(c0.data) != len(c2.data) {
+		return errors.New("pdfcpu: jpx: multiple component transformation of components with different sizes")
+	}
+
+	for i := range c0.data {
+		y0, y1, y2 := c0.data[i], c1.data[i], c2.data[i]
+		if c0.reversible {
+			g := y0 - float32(math.Floor(float64(y1+y2)/4))
+			c0.data[i], c1.data[i], c2.data[i] = y2+g, g, y1+g
+			continue
+		}
+		c0.data[i] = y0 + 1.402*y2
+		c1.data[i] = y0 - 0.34413*y1 - 0.71414*y2
+		c2.data[i] = y0 + 1.772*y1
+	}
+
+	return nil
+}
+
+// store applies the DC level shift and stores the samples of tc in the component plane.
+// Signed samples are shifted as well so that all planes hold unsigned values.
+func (tc *jpxTileComp) store(siz jpxSize, comp jpxComponent, plane []uint16) {
+
+	cx0, cy0 := jpxCeilDiv(siz.x0, comp.dx), jpxCeilDiv(siz.y0, comp.dy)
+	cw := jpxCeilDiv(siz.x1, comp.dx) - cx0
+
+	shift := float32(int(1) << uint(comp.prec-1))
+	max := float32(int(1)<<uint(comp.prec) - 1)
+	w := tc.x1 - tc.x0
+
+	for y := tc.y0; y < tc.y1; y++ {
+		for x := tc.x0; x < tc.x1; x++ {
+			v := tc.data[(y-tc.y0)*w+x-tc.x0] + shift
+			if !tc.reversible {
+				v = float32(math.Floor(float64(v) + 0.5))
+			}
+			if v < 0 {
+				v = 0
+			}
+			if v > max {
+				v = max
+			}
+			plane[(y-cy0)*cw+x-cx0] = uint16(v)
+		}
+	}
+}
@@ -17,12 +17,10 @@ limitations under the License.
 package filter
 
 import (
-	"bytes"
 	"io"
 
 	"github.com/hhrutter/lzw"
 	"github.com/pdfcpu/pdfcpu/pkg/log"
-	"github.com/pkg/errors"
 )
 
 type lzwDecode struct {
@@ -30,39 +28,32 @@ type lzwDecode struct {
 }
 
 // Encode implements encoding for an LZWDecode filter.
-func (f lzwDecode) Encode(r io.Reader) (*bytes.Buffer, error) {
+func (f lzwDecode) Encode(r io.Reader, w io.Writer) error {
 
 	log.Trace.Println("EncodeLZW begin")
 
-	var b bytes.Buffer
-
 	ec, ok := f.parms["EarlyChange"]
 	if !ok {
 		ec = 1
 	}
 
-	wc := lzw.NewWriter(&b, ec == 1)
-	defer wc.Close()
+	wc := lzw.NewWriter(w, ec == 1)
 
-	written, err := io.Copy(wc, r)
-	if err != nil {
-		return nil, err
+	// Optional decode parameters need preprocessing.
+	if err := f.encodePreProcess(r, wc); err != nil {
+		return err
 	}
-	log.Trace.Printf("EncodeLZW end: %d bytes written\n", written)
 
-	return &b, nil
+	log.Trace.Println("EncodeLZW end")
+
+	return wc.Close()
 }
 
 // Decode implements decoding for an LZWDecode filter.
-func (f lzwDecode) Decode(r io.Reader) (*bytes.Buffer, error) {
+func (f lzwDecode) Decode(r io.Reader, w io.Writer) error {
 
 	log.Trace.Println("DecodeLZW begin")
 
-	p, found := f.parms["Predictor"]
-	if found && p > 1 {
-		return nil, errors.Errorf("DecodeLZW: unsupported predictor %d", p)
-	}
-
 	ec, ok := f.parms["EarlyChange"]
 	if !ok {
 		ec = 1
@@ -71,12 +62,6 @@ func (f lzwDecode) Decode(r io.Reader) (*bytes.Buffer, error) {
 	rc := lzw.NewReader(r, ec == 1)
 	defer rc.Close()
 
-	var b bytes.Buffer
-	written, err := io.Copy(&b, rc)
-	if err != nil {
-		return nil, err
-	}
-	log.Trace.Printf("DecodeLZW: decoded %d bytes.\n", written)
-
-	return &b, nil
+	// Optional decode parameters need postprocessing.
+	return f.decodePostProcess(rc, w)
 }
@@ -0,0 +1,462 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Predictors are supported by the filters FlateDecode and LZWDecode.
+
+// Portions of this code are based on ideas of image/png: reader.go:readImagePass
+// PNG is documented here: www.w3.org/TR/PNG-Filters.html
+
+// PDF allows a prediction step prior to compression applying TIFF or PNG prediction.
+// Predictor algorithm.
+const (
+	PredictorNo      = 1  // No prediction.
+	PredictorTIFF    = 2  // Use TIFF prediction for all rows.
+	PredictorNone    = 10 // Use PNGNone for all rows.
+	PredictorSub     = 11 // Use PNGSub for all rows.
+	PredictorUp      = 12 // Use PNGUp for all rows.
+	PredictorAverage = 13 // Use PNGAverage for all rows.
+	PredictorPaeth   = 14 // Use PNGPaeth for all rows.
+	PredictorOptimum = 15 // Use the optimum PNG prediction for each row.
+)
+
+// For predictor > 2 PNG filters (see RFC 2083) get applied and the first byte of each pixelrow defines
+// the prediction algorithm used for all pixels of this row.
+const (
+	PNGNone    = 0x00
+	PNGSub     = 0x01
+	PNGUp      = 0x02
+	PNGAverage = 0x03
+	PNGPaeth   = 0x04
+)
+
+func intMemberOf(i int, list []int) bool {
+	for _, v := range list {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Each prediction value implies (a) certain row filter(s).
+func validateRowFilter(f, p int) error {
+
+	switch p {
+
+	case PredictorNone:
+		if !intMemberOf(f, []int{PNGNone, PNGSub, PNGUp, PNGAverage, PNGPaeth}) {
+			return errors.Errorf("pdfcpu: validateRowFilter: PredictorOptimum, unexpected row filter #%02x", f)
+		}
+		// if f != PNGNone {
+		// 	return errors.Errorf("validateRowFilter: expected row filter #%02x, got: #%02x", PNGNone, f)
+		// }
+
+	case PredictorSub:
+		if f != PNGSub {
+			return errors.Errorf("pdfcpu: validateRowFilter: expected row filter #%02x, got: #%02x", PNGSub, f)
+		}
+
+	case PredictorUp:
+		if f != PNGUp {
+			return errors.Errorf("pdfcpu: validateRowFilter: expected row filter #%02x, got: #%02x", PNGUp, f)
+		}
+
+	case PredictorAverage:
+		if f != PNGAverage {
+			return errors.Errorf("pdfcpu: validateRowFilter: expected row filter #%02x, got: #%02x", PNGAverage, f)
+		}
+
+	case PredictorPaeth:
+		if f != PNGPaeth {
+			return errors.Errorf("pdfcpu: validateRowFilter: expected row filter #%02x, got: #%02x", PNGPaeth, f)
+		}
+
+	case PredictorOptimum:
+		if !intMemberOf(f, []int{PNGNone, PNGSub, PNGUp, PNGAverage, PNGPaeth}) {
+			return errors.Errorf("pdfcpu: validateRowFilter: PredictorOptimum, unexpected row filter #%02x", f)
+		}
+
+	default:
+		return errors.Errorf("pdfcpu: validateRowFilter: unexpected predictor #%02x", p)
+
+	}
+
+	return nil
+}
+
+// sample returns the i-th bpc bit sample of row.
+func sample(row []byte, i, bpc int) int {
+
+	switch bpc {
+	case 8:
+		return int(row[i])
+	case 16:
+		return int(row[2*i])<<8 + int(row[2*i+1])
+	}
+
+	bit := i * bpc
+	shift := uint(8 - bpc - bit%8)
+	return int(row[bit/8]>>shift) & (1<<uint(bpc) - 1)
+}
+
+// setSample sets the i-th bpc bit sample of row to v.
+func setSample(row []byte, i, bpc, v int) {
+
+	switch bpc {
+	case 8:
+		row[i] = byte(v)
+		return
+	case 16:
+		row[2*i], row[2*i+1] = byte(v>>8), byte(v)
+		return
+	}
+
+	bit := i * bpc
+	shift := uint(8 - bpc - bit%8)
+	mask := byte(1<<uint(bpc)-1) << shift
+	row[bit/8] = row[bit/8]&^mask | byte(v)<<shift&mask
+}
+
+// tiffRow applies TIFF prediction (decode) or its inverse (encode) to a row of samples.
+func tiffRow(row []byte, colors, bpc int, encode bool) {
+
+	n := len(row) * 8 / bpc
+	max := 1 << uint(bpc)
+
+	if encode {
+		// Process right to left so we can work in place.
+		for i := n - 1; i >= colors; i-- {
+			setSample(row, i, bpc, (sample(row, i, bpc)-sample(row, i-colors, bpc)+max)%max)
+		}
+		return
+	}
+
+	for i := colors; i < n; i++ {
+		setSample(row, i, bpc, (sample(row, i, bpc)+sample(row, i-colors, bpc))%max)
+	}
+}
+
+func processRow(pr, cr []byte, p, colors, bpc, bytesPerPixel int) ([]byte, error) {
+
+	//fmt.Printf("pr(%v) =\n%s\n", &pr, hex.Dump(pr))
+	//fmt.Printf("cr(%v) =\n%s\n", &cr, hex.Dump(cr))
+
+	if p == PredictorTIFF {
+		tiffRow(cr, colors, bpc, false)
+		return cr, nil
+	}
+
+	// Apply the filter.
+	cdat := cr[1:]
+	pdat := pr[1:]
+
+	// Get row filter from 1st byte
+	f := int(cr[0])
+
+	err := validateRowFilter(f, p)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f {
+
+	case PNGNone:
+		// No operation.
+
+	case PNGSub:
+		for i := bytesPerPixel; i < len(cdat); i++ {
+			cdat[i] += cdat[i-bytesPerPixel]
+		}
+
+	case PNGUp:
+		for i, p := range pdat {
+			cdat[i] += p
+		}
+
+	case PNGAverage:
+		// The average of the two neighboring pixels (left and above).
+		// Raw(x) - floor((Raw(x-bpp)+Prior(x))/2)
+		for i := 0; i < bytesPerPixel; i++ {
+			cdat[i] += pdat[i] / 2
+		}
+		for i := bytesPerPixel; i < len(cdat); i++ {
+			cdat[i] += uint8((int(cdat[i-bytesPerPixel]) + int(pdat[i])) / 2)
+		}
+
+	case PNGPaeth:
+		filterPaeth(cdat, pdat, bytesPerPixel)
+
+	}
+
+	return cdat, nil
+}
+
+// filterRow writes the PNG row filter f applied to the raw row cdat with previous raw row pdat into out.
+// out[0] receives the row filter byte.
+func filterRow(out, cdat, pdat []byte, f, bytesPerPixel int) {
+
+	out[0] = byte(f)
+	o := out[1:]
+
+	left := func(i int) byte {
+		if i < bytesPerPixel {
+			return 0
+		}
+		return cdat[i-bytesPerPixel]
+	}
+
+	upperLeft := func(i int) byte {
+		if i < bytesPerPixel {
+			return 0
+		}
+		return pdat[i-bytesPerPixel]
+	}
+
+	for i := range cdat {
+		switch f {
+		case PNGNone:
+			o[i] = cdat[i]
+		case PNGSub:
+			o[i] = cdat[i] - left(i)
+		case PNGUp:
+			o[i] = cdat[i] - pdat[i]
+		case PNGAverage:
+			o[i] = cdat[i] - uint8((int(left(i))+int(pdat[i]))/2)
+		case PNGPaeth:
+			o[i] = cdat[i] - paeth(left(i), pdat[i], upperLeft(i))
+		}
+	}
+}
+
+// rowCost returns the sum of absolute values of the filtered row interpreted as signed bytes.
+// This is the heuristic suggested by the PNG specification for choosing a row filter.
+func rowCost(row []byte) int {
+	c := 0
+	for _, b := range row {
+		c += abs(int(int8(b)))
+	}
+	return c
+}
+
+func (f baseFilter) parameters() (colors, bpc, columns int, err error) {
+
+	// Colors, int
+	// The number of interleaved colour components per sample.
+	// Valid values are 1 to 4 (PDF 1.0) and 1 or greater (PDF 1.3). Default value: 1.
+	// Used by PredictorTIFF only.
+	colors, found := f.parms["Colors"]
+	if !found {
+		colors = 1
+	} else if colors == 0 {
+		return 0, 0, 0, errors.Errorf("pdfcpu: filter predictor: \"Colors\" must be > 0")
+	}
+
+	// BitsPerComponent, int
+	// The number of bits used to represent each colour component in a sample.
+	// Valid values are 1, 2, 4, 8, and (PDF 1.5) 16. Default value: 8.
+	// Used by PredictorTIFF only.
+	bpc, found = f.parms["BitsPerComponent"]
+	if !found {
+		bpc = 8
+	} else if !intMemberOf(bpc, []int{1, 2, 4, 8, 16}) {
+		return 0, 0, 0, errors.Errorf("pdfcpu: filter predictor: Unexpected \"BitsPerComponent\": %d", bpc)
+	}
+
+	// Columns, int
+	// The number of samples in each row. Default value: 1.
+	columns, found = f.parms["Columns"]
+	if !found {
+		columns = 1
+	}
+
+	return colors, bpc, columns, nil
+}
+
+func (f baseFilter) predictor() (int, error) {
+
+	predictor, found := f.parms["Predictor"]
+	if !found {
+		return PredictorNo, nil
+	}
+
+	if !intMemberOf(
+		predictor,
+		[]int{PredictorNo,
+			PredictorTIFF,
+			PredictorNone,
+			PredictorSub,
+			PredictorUp,
+			PredictorAverage,
+			PredictorPaeth,
+			PredictorOptimum,
+		}) {
+		return 0, errors.Errorf("pdfcpu: filter: undefined \"Predictor\" %d", predictor)
+	}
+
+	return predictor, nil
+}
+
+// decodePostProcess reverses the prediction step after decompression and writes the result to w.
+func (f baseFilter) decodePostProcess(r io.Reader, w io.Writer) error {
+
+	predictor, err := f.predictor()
+	if err != nil {
+		return err
+	}
+
+	if predictor == PredictorNo {
+		_, err = io.Copy(w, r)
+		return err
+	}
+
+	colors, bpc, columns, err := f.parameters()
+	if err != nil {
+		return err
+	}
+
+	bytesPerPixel := (bpc*colors + 7) / 8
+
+	rowSize := (bpc*colors*columns + 7) / 8
+	if predictor != PredictorTIFF {
+		// PNG prediction uses a row filter byte prefixing the pixelbytes of a row.
+		rowSize++
+	}
+
+	// cr and pr are the bytes for the current and previous row.
+	cr := make([]byte, rowSize)
+	pr := make([]byte, rowSize)
+
+	for {
+
+		// Read decompressed bytes for one pixel row.
+		n, err := io.ReadFull(r, cr)
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			// eof
+			if n == 0 {
+				break
+			}
+		}
+
+		if n != rowSize {
+			return errors.Errorf("pdfcpu: filter: predictor read error, expected %d bytes, got: %d", rowSize, n)
+		}
+
+		d, err1 := processRow(pr, cr, predictor, colors, bpc, bytesPerPixel)
+		if err1 != nil {
+			return err1
+		}
+
+		if _, err1 = w.Write(d); err1 != nil {
+			return err1
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		// Swap byte slices.
+		pr, cr = cr, pr
+	}
+
+	return nil
+}
+
+// encodePreProcess applies the prediction step prior to compression and writes the result to w.
+func (f baseFilter) encodePreProcess(r io.Reader, w io.Writer) error {
+
+	predictor, err := f.predictor()
+	if err != nil {
+		return err
+	}
+
+	if predictor == PredictorNo {
+		_, err = io.Copy(w, r)
+		return err
+	}
+
+	colors, bpc, columns, err := f.parameters()
+	if err != nil {
+		return err
+	}
+
+	bytesPerPixel := (bpc*colors + 7) / 8
+	rowSize := (bpc*colors*columns + 7) / 8
+
+	// cr and pr are the raw bytes for the current and previous row.
+	cr := make([]byte, rowSize)
+	pr := make([]byte, rowSize)
+
+	// out is the filtered row including the PNG row filter byte, best is the best filtered row for PredictorOptimum.
+	out := make([]byte, rowSize+1)
+	best := make([]byte, rowSize+1)
+
+	for {
+
+		n, err := io.ReadFull(r, cr)
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			return errors.Errorf("pdfcpu: filter: predictor read error, expected %d bytes, got: %d", rowSize, n)
+		}
+
+		switch predictor {
+
+		case PredictorTIFF:
+			copy(out, cr)
+			tiffRow(out[:rowSize], colors, bpc, true)
+			_, err = w.Write(out[:rowSize])
+
+		case PredictorOptimum:
+			min := -1
+			for f := PNGNone; f <= PNGPaeth; f++ {
+				filterRow(out, cr, pr, f, bytesPerPixel)
+				if c := rowCost(out[1:]); min < 0 || c < min {
+					min = c
+					best, out = out, best
+				}
+			}
+			_, err = w.Write(best)
+
+		default:
+			filterRow(out, cr, pr, predictor-PredictorNone, bytesPerPixel)
+			_, err = w.Write(out)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Swap byte slices.
+		pr, cr = cr, pr
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPredictors(t *testing.T) {
+
+	const columns, rows = 37, 11
+
+	predictors := []int{
+		PredictorTIFF,
+		PredictorNone,
+		PredictorSub,
+		PredictorUp,
+		PredictorAverage,
+		PredictorPaeth,
+		PredictorOptimum,
+	}
+
+	for _, filterName := range []string{Flate, LZW} {
+		for _, p := range predictors {
+			for _, bpc := range []int{1, 2, 4, 8, 16} {
+				for _, colors := range []int{1, 3, 4} {
+
+					parms := map[string]int{
+						"Predictor":        p,
+						"Colors":           colors,
+						"BitsPerComponent": bpc,
+						"Columns":          columns,
+					}
+
+					f, err := NewFilter(filterName, parms)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					rowSize := (bpc*colors*columns + 7) / 8
+					raw := make([]byte, rowSize*rows)
+					for i := range raw {
+						raw[i] = byte(i*i/7 + i%13)
+					}
+
+					enc := new(bytes.Buffer)
+					err = f.Encode(bytes.NewReader(raw), enc)
+					if err != nil {
+						t.Fatalf("%s predictor=%d bpc=%d colors=%d: encode: %v\n", filterName, p, bpc, colors, err)
+					}
+
+					dec := new(bytes.Buffer)
+					err = f.Decode(enc, dec)
+					if err != nil {
+						t.Fatalf("%s predictor=%d bpc=%d colors=%d: decode: %v\n", filterName, p, bpc, colors, err)
+					}
+
+					if !bytes.Equal(raw, dec.Bytes()) {
+						t.Fatalf("%s predictor=%d bpc=%d colors=%d: original content != decoded content", filterName, p, bpc, colors)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPredictorTIFFDecode(t *testing.T) {
+
+	// 2 RGB pixels, the second one stores differences.
+	f := baseFilter{map[string]int{"Predictor": PredictorTIFF, "Colors": 3, "Columns": 2}}
+
+	var b bytes.Buffer
+	if err := f.decodePostProcess(bytes.NewReader([]byte{10, 20, 30, 1, 2, 0xFF}), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	compare(t, b.Bytes(), []byte{10, 20, 30, 11, 22, 29})
+}
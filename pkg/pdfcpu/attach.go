@@ -17,7 +17,6 @@ limitations under the License.
 package pdfcpu
 
 import (
-	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -26,7 +25,8 @@ import (
 	"github.com/pkg/errors"
 )
 
-func decodedFileSpecStreamDict(xRefTable *XRefTable, fileName string, o Object) (*StreamDict, error) {
+// fileSpecStreamDict returns the embedded file stream dict of a file spec if its content can be decoded.
+func fileSpecStreamDict(xRefTable *XRefTable, fileName string, o Object) (*StreamDict, error) {
 
 	d, err := xRefTable.DereferenceDict(o)
 	if err != nil {
@@ -57,11 +57,7 @@ func decodedFileSpecStreamDict(xRefTable *XRefTable, fileName string, o Object)
 
 	fpl := sd.FilterPipeline
 
-	if fpl == nil {
-
-		sd.Content = sd.Raw
-
-	} else {
+	if fpl != nil {
 
 		// Ignore filter chains with length > 1
 		if len(fpl) > 1 {
@@ -69,18 +65,12 @@ func decodedFileSpecStreamDict(xRefTable *XRefTable, fileName string, o Object)
 			return nil, nil
 		}
 
-		// Only FlateDecode supported.
-		if fpl[0].Name != filter.Flate {
+		// Only FlateDecode and registered filters supported.
+		if fpl[0].Name != filter.Flate && !filter.Registered(fpl[0].Name) {
 			log.Debug.Printf("writeFile: ignore %s, %s filter unsupported.\n", fileName, fpl[0].Name)
 			return nil, nil
 		}
 
-		// Decode streamDict for supported filters only.
-		err = decodeStream(sd)
-		if err != nil {
-			return nil, err
-		}
-
 	}
 
 	return sd, nil
@@ -94,8 +84,8 @@ func extractAttachedFiles(ctx *Context, files StringSet) error {
 
 		log.Debug.Printf("writeFile begin: %s\n", path)
 
-		sd, err := decodedFileSpecStreamDict(xRefTable, fileName, o)
-		if err != nil {
+		sd, err := fileSpecStreamDict(xRefTable, fileName, o)
+		if err != nil || sd == nil {
 			return err
 		}
 
@@ -103,11 +93,21 @@ func extractAttachedFiles(ctx *Context, files StringSet) error {
 
 		// TODO Refactor into returning only stream object numbers for files to be extracted.
 		// No writing to file in library!
-		err = ioutil.WriteFile(path, sd.Content, os.ModePerm)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 		if err != nil {
 			return err
 		}
 
+		// Decode straight into the file.
+		if err = writeDecodedStreamContent(sd, f); err != nil {
+			f.Close()
+			return err
+		}
+
+		if err = f.Close(); err != nil {
+			return err
+		}
+
 		log.Debug.Printf("writeFile end: %s \n", path)
 
 		return nil
@@ -0,0 +1,288 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/content"
+	"github.com/pkg/errors"
+)
+
+// cMapRange maps the character codes lo..hi of n bytes to CIDs or unicode.
+type cMapRange struct {
+	lo, hi uint32
+	n      int
+	cid    int      // CID of lo.
+	dst    []byte   // UTF-16BE of lo, incremented for subsequent codes.
+	dsts   []string // Text for each code of the range.
+}
+
+// cMap represents an embedded or predefined CMap (9.7.5) or a ToUnicode CMap (9.10.3).
+type cMap struct {
+	codespace []cMapRange
+	cids      []cMapRange
+	unicode   []cMapRange
+}
+
+// identityCMap represents the predefined CMaps Identity-H and Identity-V.
+var identityCMap = &cMap{
+	codespace: []cMapRange{{lo: 0, hi: 0xFFFF, n: 2}},
+	cids:      []cMapRange{{lo: 0, hi: 0xFFFF, n: 2}},
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+// utf16BEText decodes UTF-16BE, an odd trailing byte is ignored.
+func utf16BEText(b []byte) string {
+
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+
+	return string(utf16.Decode(u))
+}
+
+func find(rr []cMapRange, v uint32, n int) *cMapRange {
+	for i := len(rr) - 1; i >= 0; i-- {
+		if r := &rr[i]; r.n == n && r.lo <= v && v <= r.hi {
+			return r
+		}
+	}
+	return nil
+}
+
+// codeLength returns the length of the character code at the start of b.
+func (m *cMap) codeLength(b []byte) int {
+
+	for n := 1; n <= 4 && n <= len(b); n++ {
+		if find(m.codespace, codeValue(b[:n]), n) != nil {
+			return n
+		}
+	}
+
+	// Consume as many bytes as the shortest code.
+	n := 4
+	for _, r := range m.codespace {
+		if r.n < n {
+			n = r.n
+		}
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+
+	return n
+}
+
+// cid returns the CID for a character code.
+func (m *cMap) cid(code []byte) (int, bool) {
+
+	v := codeValue(code)
+
+	r := find(m.cids, v, len(code))
+	if r == nil {
+		return 0, false
+	}
+
+	return r.cid + int(v-r.lo), true
+}
+
+// text returns the unicode text for a character code.
+func (m *cMap) text(code []byte) (string, bool) {
+
+	v := codeValue(code)
+
+	r := find(m.unicode, v, len(code))
+	if r == nil {
+		return "", false
+	}
+
+	if r.dsts != nil {
+		return r.dsts[v-r.lo], true
+	}
+
+	dst := append([]byte(nil), r.dst...)
+	if i := len(dst) - 2; i >= 0 {
+		// Increment the last UTF-16 code unit.
+		u := (uint16(dst[i])<<8 | uint16(dst[i+1])) + uint16(v-r.lo)
+		dst[i], dst[i+1] = byte(u>>8), byte(u)
+	}
+
+	return utf16BEText(dst), true
+}
+
+func cMapCode(o content.Operand) ([]byte, bool) {
+	s, ok := o.(content.HexString)
+	if !ok || len(s) == 0 || len(s) > 4 {
+		return nil, false
+	}
+	return []byte(s), true
+}
+
+func cMapText(o content.Operand) (string, bool) {
+	switch o := o.(type) {
+	case content.HexString:
+		return utf16BEText([]byte(o)), true
+	case content.Name:
+		return glyphText(string(o)), true
+	}
+	return "", false
+}
+
+// cMapRanges collects the entries of a begincodespacerange, begincidrange, begincidchar, beginbfrange or beginbfchar section.
+func cMapRanges(operands []content.Operand, isRange, isUnicode bool) ([]cMapRange, error) {
+
+	k := 2
+	if isRange {
+		k = 3
+	}
+
+	var rr []cMapRange
+
+	for i := 0; i+k <= len(operands); i += k {
+
+		lo, ok := cMapCode(operands[i])
+		if !ok {
+			return nil, errors.New("pdfcpu: cmap: corrupt source code")
+		}
+
+		hi := lo
+		if isRange {
+			if hi, ok = cMapCode(operands[i+1]); !ok || len(hi) != len(lo) {
+				return nil, errors.New("pdfcpu: cmap: corrupt source code range")
+			}
+		}
+
+		r := cMapRange{lo: codeValue(lo), hi: codeValue(hi), n: len(lo)}
+		if r.hi < r.lo {
+			continue
+		}
+
+		dst := operands[i+k-1]
+
+		switch {
+
+		case !isUnicode:
+			cid, ok := dst.(content.Integer)
+			if !ok {
+				return nil, errors.New("pdfcpu: cmap: corrupt CID")
+			}
+			r.cid = int(cid)
+
+		default:
+			if a, ok := dst.(content.Array); ok {
+				for _, o := range a {
+					s, _ := cMapText(o)
+					r.dsts = append(r.dsts, s)
+				}
+				if len(r.dsts) == 0 {
+					continue
+				}
+				if len(r.dsts) < int(r.hi-r.lo)+1 {
+					r.hi = r.lo + uint32(len(r.dsts)) - 1
+				}
+				break
+			}
+			if hs, ok := dst.(content.HexString); ok {
+				r.dst = []byte(hs)
+				break
+			}
+			s, ok := cMapText(dst)
+			if !ok {
+				return nil, errors.New("pdfcpu: cmap: corrupt destination")
+			}
+			r.dsts = []string{s}
+			r.hi = r.lo
+		}
+
+		rr = append(rr, r)
+	}
+
+	return rr, nil
+}
+
+// parseCMap parses the content of an embedded CMap or ToUnicode CMap stream.
+func parseCMap(b []byte) (*cMap, error) {
+
+	ops, err := content.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &cMap{}
+
+	for _, op := range ops {
+
+		var rr []cMapRange
+
+		switch op.Operator {
+
+		case "endcodespacerange":
+			for i := 0; i+1 < len(op.Operands); i += 2 {
+				lo, ok1 := cMapCode(op.Operands[i])
+				hi, ok2 := cMapCode(op.Operands[i+1])
+				if !ok1 || !ok2 || len(lo) != len(hi) {
+					return nil, errors.New("pdfcpu: cmap: corrupt codespace range")
+				}
+				m.codespace = append(m.codespace, cMapRange{lo: codeValue(lo), hi: codeValue(hi), n: len(lo)})
+			}
+
+		case "endcidchar", "endcidrange":
+			if rr, err = cMapRanges(op.Operands, op.Operator == "endcidrange", false); err != nil {
+				return nil, err
+			}
+			m.cids = append(m.cids, rr...)
+
+		case "endbfchar", "endbfrange":
+			if rr, err = cMapRanges(op.Operands, op.Operator == "endbfrange", true); err != nil {
+				return nil, err
+			}
+			m.unicode = append(m.unicode, rr...)
+
+		case "usecmap":
+			if len(op.Operands) != 1 {
+				continue
+			}
+			if n, ok := op.Operands[0].(content.Name); ok && strings.HasPrefix(string(n), "Identity-") {
+				m.codespace = append(m.codespace, identityCMap.codespace...)
+				m.cids = append(append([]cMapRange(nil), identityCMap.cids...), m.cids...)
+			}
+		}
+	}
+
+	if len(m.codespace) == 0 {
+		// ToUnicode CMaps sometimes lack codespace ranges.
+		seen := map[int]bool{}
+		for _, r := range m.unicode {
+			if !seen[r.n] {
+				seen[r.n] = true
+				m.codespace = append(m.codespace, cMapRange{lo: 0, hi: 1<<(8*uint(r.n)) - 1, n: r.n})
+			}
+		}
+	}
+
+	return m, nil
+}
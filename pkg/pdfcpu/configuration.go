@@ -16,8 +16,13 @@ limitations under the License.
 
 package pdfcpu
 
+import (
+	"crypto"
+	"crypto/x509"
+)
+
 const (
-	// ValidationStrict ensures 100% compliance with the spec (PDF 32000-1:2008).
+	// ValidationStrict ensures 100% compliance with the spec (PDF 32000-1:2008 and PDF 32000-2 for PDF 2.0).
 	ValidationStrict int = iota
 
 	// ValidationRelaxed ensures PDF compliance based on frequently encountered validation errors.
@@ -73,6 +78,13 @@ const (
 	ROTATE
 	NUP
 	INFO
+	LISTREVISIONS
+	EXTRACTREVISION
+	VERIFYSIGNATURES
+	SIGN
+	EXTRACTTEXT
+	GREP
+	REDACT
 )
 
 // Configuration of a Context.
@@ -84,6 +96,16 @@ type Configuration struct {
 	// Enables decoding of all streams (fontfiles, images..) for logging purposes.
 	DecodeAllStreams bool
 
+	// Defers parsing of objects until first access.
+	// The io.ReadSeeker handed to Read needs to stay open as long as the context is in use.
+	// Combined with ValidationNone cheap operations like page count or info are fast even for huge files.
+	LazyLoad bool
+
+	// Reads stream content from the io.ReadSeeker handed to Read on first use instead of loading all streams upfront.
+	// Keeps memory bounded for huge files but rs needs to stay open as long as the context is in use.
+	// Implied by LazyLoad.
+	StreamsOnDemand bool
+
 	// Validate against ISO-32000: strict or relaxed
 	ValidationMode int
 
@@ -99,6 +121,50 @@ type Configuration struct {
 	// Switches between xRefSection (<=V1.4) and objectStream/xRefStream (>=V1.5) writing.
 	WriteXRefStream bool
 
+	// Appends new and changed objects as an incremental update (7.5.6) to the unmodified original
+	// instead of rewriting the whole file. This keeps existing signatures valid.
+	// Earlier revisions remain part of the file, removed content stays recoverable.
+	// Ignored by commands writing new files like optimize, split or extract.
+	Incremental bool
+
+	// Writes a linearized file (Annex F) allowing viewers to display the first page
+	// before the whole file is downloaded (aka Fast Web View).
+	// Implies classic xref sections and no object streams, not available for encrypted files.
+	Linearize bool
+
+	// Lets optimize decode and re-encode streams using the best Flate compression, drop ASCII filters
+	// and merge multiple page content streams. Streams are only replaced if this saves space.
+	Recompress bool
+
+	// Lets optimize downsample images exceeding ImageDPI on any page, re-encode images as JPEG if JPEGQuality > 0
+	// and convert RGB images using gray colors only to DeviceGray. Images are only replaced if this saves space.
+	OptimizeImages bool
+
+	// Lets optimize remove Font, XObject, ExtGState, ColorSpace, Pattern and Shading resources
+	// not referenced by the content of any page, annotation appearance, form XObject, tiling pattern or Type3 font.
+	RemoveUnusedResources bool
+
+	// Target resolution for image downsampling, 0 keeps the image resolution.
+	ImageDPI int
+
+	// JPEG quality (1..100) for re-encoding 8 bit RGB and gray images, 0 keeps the image encoding.
+	JPEGQuality int
+
+	// Lets extract content parse the content of each page and write its operators
+	// one per line with indented nesting instead of dumping raw content streams.
+	PrettyPrintContent bool
+
+	// Lets extract text also write the text runs of each page along with their bounding box, font and font size as JSON.
+	TextRunsJSON bool
+
+	// Lets grep report its hits including their bounding boxes as JSON, one object per line.
+	GrepJSON bool
+
+	// Produces reproducible output: running the same command on the same input results in identical bytes.
+	// The file ID is derived from content and no timestamps are injected into the document info dict.
+	// Encrypted output is never reproducible because security handlers rely on random salts and initialization vectors.
+	Deterministic bool
+
 	// Turns on stats collection.
 	// TODO Decision - unused.
 	CollectStats bool
@@ -120,11 +186,25 @@ type Configuration struct {
 	EncryptUsingAES bool
 
 	// AES:40,128,256 RC4:40,128
+	// AES-256 uses the standard security handler revision 6 (PDF 2.0).
 	EncryptKeyLength int
 
 	// Supplied user access permissions, see Table 22
 	Permissions int16
 
+	// Recipients of a document encrypted using the public-key security handler.
+	// Each recipient may have its own user access permissions, see Table 24.
+	Recipients []Recipient
+
+	// Supplied certificate and private key for decrypting a document encrypted using the public-key security handler.
+	// The certificate is optional and used to identify the matching recipient.
+	DecryptCert *x509.Certificate
+	DecryptKey  crypto.PrivateKey
+
+	// Trusted root certificates for signature verification.
+	// nil means the system trust store.
+	TrustedCerts *x509.CertPool
+
 	// Command being executed.
 	Cmd CommandMode
 
@@ -141,6 +221,7 @@ func NewDefaultConfiguration() *Configuration {
 	return &Configuration{
 		Reader15:          true,
 		DecodeAllStreams:  false,
+		LazyLoad:          false,
 		ValidationMode:    ValidationRelaxed,
 		Eol:               EolLF,
 		WriteObjectStream: true,
@@ -150,6 +231,7 @@ func NewDefaultConfiguration() *Configuration {
 		EncryptKeyLength:  256,
 		Permissions:       PermissionsNone,
 		MaxDepth:          64,
+		ImageDPI:          150,
 	}
 }
 
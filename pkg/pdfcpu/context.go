@@ -180,6 +180,11 @@ func (ctx *Context) convertToUnits(d Dim) Dim {
 
 // InfoDigest returns info about ctx.
 func (ctx *Context) InfoDigest() ([]string, error) {
+	if !ctx.Valid {
+		if err := ctx.collectInfo(); err != nil {
+			return nil, err
+		}
+	}
 	var ss []string
 	v := ctx.HeaderVersion
 	if ctx.RootVersion != nil {
@@ -288,6 +293,7 @@ type ReadContext struct {
 	ObjectStreams       IntSet // All object numbers of any object streams found which need to be decoded.
 	UsingXRefStreams    bool   // File is using xref streams.
 	XRefStreams         IntSet // All object numbers of any xref streams found.
+	Repaired            bool   // The cross reference table has been rebuilt by scanning the file.
 }
 
 func newReadContext(rs io.ReadSeeker) *ReadContext {
@@ -404,6 +410,17 @@ type OptimizationContext struct {
 
 	DuplicateInfoObjects IntSet // Possible result of manual info dict modification.
 	NonReferencedObjs    []int  // Objects that are not referenced.
+
+	// Stream recompression section
+	Recompressed         map[string]*FilterSavings // Recompression savings by original filter pipeline.
+	MergedContentStreams int                       // Number of pages whose content streams got merged.
+
+	// Image optimization section
+	ImageSavings FilterSavings // Downsampled or re-encoded images.
+
+	// Unused resources section
+	UnusedResources    int    // Number of removed resource dict entries.
+	UnusedResourceObjs IntSet // The set of objects that represents the union of the object graphs of all removed resources.
 }
 
 func newOptimizationContext() *OptimizationContext {
@@ -416,6 +433,8 @@ func newOptimizationContext() *OptimizationContext {
 		DuplicateImages:      map[int]*StreamDict{},
 		DuplicateImageObjs:   IntSet{},
 		DuplicateInfoObjects: IntSet{},
+		Recompressed:         map[string]*FilterSavings{},
+		UnusedResourceObjs:   IntSet{},
 	}
 }
 
@@ -424,6 +443,11 @@ func (oc *OptimizationContext) IsDuplicateFontObject(i int) bool {
 	return oc.DuplicateFontObjs[i]
 }
 
+// IsUnusedResourceObject returns true if object #i is part of a removed unused resource.
+func (oc *OptimizationContext) IsUnusedResourceObject(i int) bool {
+	return oc.UnusedResourceObjs[i]
+}
+
 // DuplicateFontObjectsString returns a formatted string and the number of objs.
 func (oc *OptimizationContext) DuplicateFontObjectsString() (int, string) {
 
@@ -443,6 +467,25 @@ func (oc *OptimizationContext) DuplicateFontObjectsString() (int, string) {
 	return len(dupFonts), strings.Join(dupFonts, ",")
 }
 
+// UnusedResourceObjectsString returns a formatted string and the number of objs.
+func (oc *OptimizationContext) UnusedResourceObjectsString() (int, string) {
+
+	var objs []int
+	for k := range oc.UnusedResourceObjs {
+		if oc.UnusedResourceObjs[k] {
+			objs = append(objs, k)
+		}
+	}
+	sort.Ints(objs)
+
+	var ss []string
+	for _, i := range objs {
+		ss = append(ss, fmt.Sprintf("%d", i))
+	}
+
+	return len(ss), strings.Join(ss, ",")
+}
+
 // IsDuplicateImageObject returns true if object #i is a duplicate image object.
 func (oc *OptimizationContext) IsDuplicateImageObject(i int) bool {
 	return oc.DuplicateImageObjs[i]
@@ -676,6 +719,8 @@ type WriteContext struct {
 	WriteToObjectStream bool          // if true start to embed objects into object streams and obey ObjectStreamMaxObjects.
 	CurrentObjStream    *int          // if not nil, any new non-stream-object gets added to the object stream with this object number.
 	Eol                 string        // end of line char sequence
+	PrevXRefOffset      *int64        // if not nil, offset of the previous xref section of an incremental update.
+	FreedObjs           IntSet        // objects freed by an incremental update.
 }
 
 // NewWriteContext returns a new WriteContext.
@@ -26,10 +26,13 @@ import (
 	"crypto/rand"
 	"crypto/rc4"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
+	"sort"
 	"strconv"
 	"time"
 
@@ -56,6 +59,9 @@ var (
 		EXTRACTPAGES:       {1, 0},
 		EXTRACTCONTENT:     {1, 0},
 		EXTRACTMETADATA:    {1, 0},
+		EXTRACTTEXT:        {1, 0},
+		GREP:               {1, 0},
+		REDACT:             {0, 1},
 		TRIM:               {0, 1},
 		LISTATTACHMENTS:    {0, 0},
 		EXTRACTATTACHMENTS: {1, 0},
@@ -79,12 +85,12 @@ func newEncryptDict(needAES bool, keyLength int, permissions int16) Dict {
 
 	if keyLength >= 128 {
 		d.Insert("Length", Integer(keyLength))
-		i := 4
+		r, v := 4, 4
 		if keyLength == 256 {
-			i = 5
+			r, v = 6, 5
 		}
-		d.Insert("R", Integer(i))
-		d.Insert("V", Integer(i))
+		d.Insert("R", Integer(r))
+		d.Insert("V", Integer(v))
 	} else {
 		d.Insert("R", Integer(2))
 		d.Insert("V", Integer(1))
@@ -184,7 +190,7 @@ func encKey(userpw string, e *Enc) (key []byte) {
 // validateUserPassword validates the user password aka document open password.
 func validateUserPassword(ctx *Context) (ok bool, err error) {
 
-	if ctx.E.R == 5 {
+	if ctx.E.R >= 5 {
 		return validateUserPasswordAES256(ctx)
 	}
 
@@ -362,7 +368,93 @@ func validationSalt(bb []byte) []byte {
 }
 
 func keySalt(bb []byte) []byte {
-	return bb[40:]
+	return bb[40:48]
+}
+
+// passwordAES256 returns the UTF-8 representation of pw processed with SASLprep and truncated to 127 bytes.
+func passwordAES256(pw string) ([]byte, error) {
+
+	s, err := saslPrep(pw)
+	if err != nil {
+		return nil, err
+	}
+
+	b := []byte(s)
+	if len(b) > 127 {
+		b = b[:127]
+	}
+
+	return b, nil
+}
+
+// hashAES256 computes the hash of a password for AES-256 encryption (Algorithm 2.B).
+// u is the 48 byte U string when processing the owner password and nil for the user password.
+func hashAES256(pw, salt, u []byte, r int) []byte {
+
+	h := sha256.New()
+	h.Write(pw)
+	h.Write(salt)
+	h.Write(u)
+	k := h.Sum(nil)
+
+	if r == 5 {
+		return k
+	}
+
+	// Revision 6
+	for i := 0; ; i++ {
+
+		// a)
+		k1 := append(append(append([]byte(nil), pw...), k...), u...)
+		k1 = bytes.Repeat(k1, 64)
+
+		// b)
+		cb, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(cb, k[16:32]).CryptBlocks(e, k1)
+
+		// c)
+		var sum int
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+
+		var h hash.Hash
+		switch sum % 3 {
+		case 0:
+			h = sha256.New()
+		case 1:
+			h = sha512.New384()
+		case 2:
+			h = sha512.New()
+		}
+		h.Write(e)
+		k = h.Sum(nil)
+
+		// e)
+		if i >= 63 && int(e[len(e)-1]) <= i-31 {
+			break
+		}
+	}
+
+	return k[:32]
+}
+
+// decryptFileEncKey decrypts the encrypted file encryption key ekey (OE or UE).
+func decryptFileEncKey(ekey, key []byte) ([]byte, error) {
+
+	cb, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, 16)
+	k := make([]byte, 32)
+
+	mode := cipher.NewCBCDecrypter(cb, iv)
+	mode.CryptBlocks(k, ekey)
+
+	return k, nil
 }
 
 func validateOwnerPasswordAES256(ctx *Context) (ok bool, err error) {
@@ -371,69 +463,49 @@ func validateOwnerPasswordAES256(ctx *Context) (ok bool, err error) {
 		return false, nil
 	}
 
-	// TODO Process PW with SASLPrep profile (RFC 4013) of stringprep (RFC 3454).
-	opw := []byte(ctx.OwnerPW)
-	if len(opw) > 127 {
-		opw = opw[:127]
+	opw, err := passwordAES256(ctx.OwnerPW)
+	if err != nil {
+		return false, err
 	}
-	//fmt.Printf("opw <%s> isValidUTF8String: %t\n", opw, utf8.Valid(opw))
 
 	// Algorithm 3.2a 3.
-	b := append(opw, validationSalt(ctx.E.O)...)
-	b = append(b, ctx.E.U...)
-	s := sha256.Sum256(b)
+	s := hashAES256(opw, validationSalt(ctx.E.O), ctx.E.U[:48], ctx.E.R)
 
-	if !bytes.HasPrefix(ctx.E.O, s[:]) {
+	if !bytes.HasPrefix(ctx.E.O, s) {
 		return false, nil
 	}
 
-	b = append(opw, keySalt(ctx.E.O)...)
-	b = append(b, ctx.E.U...)
-	key := sha256.Sum256(b)
+	key := hashAES256(opw, keySalt(ctx.E.O), ctx.E.U[:48], ctx.E.R)
 
-	cb, err := aes.NewCipher(key[:])
+	ctx.EncKey, err = decryptFileEncKey(ctx.E.OE, key)
 	if err != nil {
 		return false, err
 	}
 
-	iv := make([]byte, 16)
-	ctx.EncKey = make([]byte, 32)
-
-	mode := cipher.NewCBCDecrypter(cb, iv)
-	mode.CryptBlocks(ctx.EncKey, ctx.E.OE)
-
 	return true, nil
 }
 
 func validateUserPasswordAES256(ctx *Context) (ok bool, err error) {
 
-	// TODO Process PW with SASLPrep profile (RFC 4013) of stringprep (RFC 3454).
-	upw := []byte(ctx.UserPW)
-	if len(upw) > 127 {
-		upw = upw[:127]
+	upw, err := passwordAES256(ctx.UserPW)
+	if err != nil {
+		return false, err
 	}
-	//fmt.Printf("upw <%s> isValidUTF8String: %t\n", upw, utf8.Valid(upw))
 
 	// Algorithm 3.2a 4,
-	s := sha256.Sum256(append(upw, validationSalt(ctx.E.U)...))
+	s := hashAES256(upw, validationSalt(ctx.E.U), nil, ctx.E.R)
 
-	if !bytes.HasPrefix(ctx.E.U, s[:]) {
+	if !bytes.HasPrefix(ctx.E.U, s) {
 		return false, nil
 	}
 
-	key := sha256.Sum256(append(upw, keySalt(ctx.E.U)...))
+	key := hashAES256(upw, keySalt(ctx.E.U), nil, ctx.E.R)
 
-	cb, err := aes.NewCipher(key[:])
+	ctx.EncKey, err = decryptFileEncKey(ctx.E.UE, key)
 	if err != nil {
 		return false, err
 	}
 
-	iv := make([]byte, 16)
-	ctx.EncKey = make([]byte, 32)
-
-	mode := cipher.NewCBCDecrypter(cb, iv)
-	mode.CryptBlocks(ctx.EncKey, ctx.E.UE)
-
 	return true, nil
 }
 
@@ -442,7 +514,7 @@ func validateOwnerPassword(ctx *Context) (ok bool, err error) {
 
 	e := ctx.E
 
-	if e.R == 5 {
+	if e.R >= 5 {
 		return validateOwnerPasswordAES256(ctx)
 	}
 
@@ -515,8 +587,9 @@ func supportedCFEntry(d Dict) (bool, error) {
 		return false, errors.New("pdfcpu: supportedCFEntry: invalid entry \"AuthEvent\"")
 	}
 
+	// The standard security handler expresses the key length in bytes, public-key security handlers use bits.
 	l := d.IntEntry("Length")
-	if l != nil && (*l < 5 || *l > 16) && *l != 32 {
+	if l != nil && (*l < 5 || *l > 16) && *l != 32 && (*l < 40 || *l > 128 || *l%8 > 0) && *l != 256 {
 		return false, errors.New("pdfcpu: supportedCFEntry: invalid entry \"Length\"")
 	}
 
@@ -552,7 +625,7 @@ func validatePermissions(ctx *Context) (bool, error) {
 
 	// Algorithm 3.2a 5.
 
-	if ctx.E.R != 5 {
+	if ctx.E.R < 5 {
 		return true, nil
 	}
 
@@ -575,7 +648,7 @@ func writePermissions(ctx *Context, d Dict) error {
 
 	// Algorithm 3.10
 
-	if ctx.E.R != 5 {
+	if ctx.E.R < 5 {
 		return nil
 	}
 
@@ -778,11 +851,8 @@ func length(d Dict) (int, error) {
 func getR(d Dict) (int, error) {
 
 	r := d.IntEntry("R")
-	if r == nil || *r < 2 || *r > 5 {
-		if *r > 5 {
-			return 0, errors.New("pdfcpu: PDF 2.0 encryption not supported")
-		}
-		return 0, errors.New("pdfcpu: encryption: \"R\" must be 2,3,4,5")
+	if r == nil || *r < 2 || *r > 6 {
+		return 0, errors.New("pdfcpu: encryption: \"R\" must be 2,3,4,5,6")
 	}
 
 	return *r, nil
@@ -904,8 +974,12 @@ func supportedEncryption(ctx *Context, d Dict) (*Enc, error) {
 		return nil, err
 	}
 
+	if r >= 5 && (len(o) != 48 || len(u) != 48) {
+		return nil, errors.New("pdfcpu: unsupported encryption: \"O\" and \"U\" must be 48 bytes long for AES-256")
+	}
+
 	var oe, ue, perms []byte
-	if r == 5 {
+	if r >= 5 {
 		oe, ue, perms, err = validateAES256Parameters(d)
 		if err != nil {
 			return nil, err
@@ -972,7 +1046,7 @@ func encryptBytes(b []byte, objNr, genNr int, encKey []byte, needAES bool, r int
 
 	if needAES {
 		k := encKey
-		if r != 5 {
+		if r < 5 {
 			k = decryptKey(objNr, genNr, encKey, needAES)
 		}
 		bb, err := encryptAESBytes(b, k)
@@ -1006,7 +1080,7 @@ func decryptBytes(b []byte, objNr, genNr int, encKey []byte, needAES bool, r int
 
 	if needAES {
 		k := encKey
-		if r != 5 {
+		if r < 5 {
 			k = decryptKey(objNr, genNr, encKey, needAES)
 		}
 		bb, err := decryptAESBytes(b, k)
@@ -1190,7 +1264,7 @@ func decryptDeepObject(objIn Object, objNr, genNr int, key []byte, needAES bool,
 func encryptStream(buf []byte, objNr, genNr int, encKey []byte, needAES bool, r int) ([]byte, error) {
 
 	k := encKey
-	if r != 5 {
+	if r < 5 {
 		k = decryptKey(objNr, genNr, encKey, needAES)
 	}
 
@@ -1201,19 +1275,204 @@ func encryptStream(buf []byte, objNr, genNr int, encKey []byte, needAES bool, r
 	return applyRC4Bytes(buf, k)
 }
 
-// decryptStream decrypts a stream buffer using RC4 or AES.
-func decryptStream(buf []byte, objNr, genNr int, encKey []byte, needAES bool, r int) ([]byte, error) {
+// decryptStreamReader returns a reader decrypting r using RC4 or AES.
+func decryptStreamReader(r io.Reader, objNr, genNr int, encKey []byte, needAES bool, rev int) (io.Reader, error) {
 
 	k := encKey
-	if r != 5 {
+	if rev < 5 {
 		k = decryptKey(objNr, genNr, encKey, needAES)
 	}
 
 	if needAES {
-		return decryptAESBytes(buf, k)
+		return newAESDecryptReader(r, k)
 	}
 
-	return applyRC4Bytes(buf, k)
+	c, err := rc4.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cipher.StreamReader{S: c, R: r}, nil
+}
+
+// aesDecryptReader decrypts an AES-CBC encrypted stream whose first block is the initialization vector.
+type aesDecryptReader struct {
+	r    io.Reader
+	mode cipher.BlockMode
+	in   []byte // Ciphertext chunk.
+	out  []byte // Decrypted bytes not yet consumed.
+	last []byte // The last decrypted block held back for padding removal.
+	eof  bool
+}
+
+func newAESDecryptReader(r io.Reader, key []byte) (*aesDecryptReader, error) {
+
+	cb, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(r, iv); err != nil {
+		return nil, errors.New("pdfcpu: decryptAESBytes: Ciphertext too short")
+	}
+
+	return &aesDecryptReader{
+		r:    r,
+		mode: cipher.NewCBCDecrypter(cb, iv),
+		in:   make([]byte, 256*aes.BlockSize),
+	}, nil
+}
+
+func (ar *aesDecryptReader) fill() error {
+
+	n, err := io.ReadFull(ar.r, ar.in)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	if n%aes.BlockSize > 0 {
+		return errors.New("pdfcpu: decryptAESBytes: Ciphertext not a multiple of block size")
+	}
+
+	data := ar.in[:n]
+	ar.mode.CryptBlocks(data, data)
+
+	// Prepend the previously held back block.
+	ar.out = append(append(ar.out[:0], ar.last...), data...)
+
+	if err == nil {
+		// Hold back the last block.
+		l := len(ar.out) - aes.BlockSize
+		ar.last = append(ar.last[:0], ar.out[l:]...)
+		ar.out = ar.out[:l]
+		return nil
+	}
+
+	ar.eof = true
+	ar.last = nil
+
+	// Remove padding.
+	// Note: For some reason not all AES ciphertexts are padded.
+	if l := len(ar.out); l > 0 && ar.out[l-1] <= 0x10 {
+		ar.out = ar.out[:l-int(ar.out[l-1])]
+	}
+
+	return nil
+}
+
+func (ar *aesDecryptReader) Read(p []byte) (int, error) {
+
+	for len(ar.out) == 0 {
+		if ar.eof {
+			return 0, io.EOF
+		}
+		if err := ar.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, ar.out)
+	ar.out = ar.out[n:]
+
+	return n, nil
+}
+
+// encryptStreamWriter returns a writer encrypting to w using RC4 or AES.
+// Closing the writer flushes the final AES block.
+func encryptStreamWriter(w io.Writer, objNr, genNr int, encKey []byte, needAES bool, r int) (io.WriteCloser, error) {
+
+	k := encKey
+	if r < 5 {
+		k = decryptKey(objNr, genNr, encKey, needAES)
+	}
+
+	if needAES {
+		return newAESEncryptWriter(w, k)
+	}
+
+	c, err := rc4.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return nopWriteCloser{&cipher.StreamWriter{S: c, W: w}}, nil
+}
+
+// encryptedStreamLength returns the length of n bytes of stream content after encryption.
+func encryptedStreamLength(n int64, needAES bool) int64 {
+
+	if !needAES {
+		return n
+	}
+
+	// The initialization vector followed by the padded content, see encryptAESBytes.
+	return aes.BlockSize + (n/aes.BlockSize+1)*aes.BlockSize
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// aesEncryptWriter encrypts using AES-CBC with a leading random initialization vector like encryptAESBytes.
+type aesEncryptWriter struct {
+	w    io.Writer
+	mode cipher.BlockMode
+	buf  []byte // Plaintext not yet encrypted.
+}
+
+func newAESEncryptWriter(w io.Writer, key []byte) (*aesEncryptWriter, error) {
+
+	cb, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(iv); err != nil {
+		return nil, err
+	}
+
+	return &aesEncryptWriter{w: w, mode: cipher.NewCBCEncrypter(cb, iv)}, nil
+}
+
+func (aw *aesEncryptWriter) Write(p []byte) (int, error) {
+
+	aw.buf = append(aw.buf, p...)
+
+	n := len(aw.buf) - len(aw.buf)%aes.BlockSize
+	if n == 0 {
+		return len(p), nil
+	}
+
+	aw.mode.CryptBlocks(aw.buf[:n], aw.buf[:n])
+	if _, err := aw.w.Write(aw.buf[:n]); err != nil {
+		return 0, err
+	}
+
+	aw.buf = append(aw.buf[:0], aw.buf[n:]...)
+
+	return len(p), nil
+}
+
+// Close pads and encrypts the remaining plaintext.
+func (aw *aesEncryptWriter) Close() error {
+
+	c := aes.BlockSize - len(aw.buf)
+	b := append(aw.buf, bytes.Repeat([]byte{byte(c)}, c)...)
+
+	aw.mode.CryptBlocks(b, b)
+	_, err := aw.w.Write(b)
+
+	return err
 }
 
 func applyRC4Bytes(buf, key []byte) ([]byte, error) {
@@ -1316,6 +1575,20 @@ func fileID(ctx *Context) (HexLiteral, error) {
 
 	h := md5.New()
 
+	if ctx.Deterministic {
+		// Reproducible output calls for an identifier derived from content only.
+		objNrs := make([]int, 0, len(ctx.Table))
+		for objNr := range ctx.Table {
+			objNrs = append(objNrs, objNr)
+		}
+		sort.Ints(objNrs)
+		for _, objNr := range objNrs {
+			fp := ctx.Table[objNr].fingerprint()
+			h.Write(fp[:])
+		}
+		return HexLiteral(hex.EncodeToString(h.Sum(nil))), nil
+	}
+
 	// Current timestamp.
 	h.Write([]byte(time.Now().String()))
 
@@ -1363,120 +1636,74 @@ func decryptHexLiteral(hl HexLiteral, objNr, genNr int, key []byte, needAES bool
 	return decryptBytes(bb, objNr, genNr, key, needAES, r)
 }
 
-func calcFileEncKeyFromUE(ctx *Context) (k []byte, err error) {
+// encryptFileEncKey encrypts the file encryption key using key.
+func encryptFileEncKey(fileEncKey, key []byte) ([]byte, error) {
 
-	upw := []byte(ctx.OwnerPW)
-	key := sha256.Sum256(append(upw, keySalt(ctx.E.U)...))
-
-	cb, err := aes.NewCipher(key[:])
+	cb, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
 
 	iv := make([]byte, 16)
-	k = make([]byte, 32)
+	ekey := make([]byte, 32)
 
-	mode := cipher.NewCBCDecrypter(cb, iv)
-	mode.CryptBlocks(k, ctx.E.UE)
+	mode := cipher.NewCBCEncrypter(cb, iv)
+	mode.CryptBlocks(ekey, fileEncKey)
 
-	return k, nil
+	return ekey, nil
 }
 
-func calcFileEncKeyFromOE(ctx *Context) (k []byte, err error) {
-
-	opw := []byte(ctx.OwnerPW)
-	b := append(opw, keySalt(ctx.E.O)...)
-	b = append(b, ctx.E.U...)
-	key := sha256.Sum256(b)
+func calcOAndUAES256(ctx *Context, d Dict) (err error) {
 
-	cb, err := aes.NewCipher(key[:])
+	upw, err := passwordAES256(ctx.UserPW)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	iv := make([]byte, 16)
-	k = make([]byte, 32)
-
-	mode := cipher.NewCBCDecrypter(cb, iv)
-	mode.CryptBlocks(k, ctx.E.OE)
-
-	return k, nil
-}
-
-func calcFileEncKey(ctx *Context, d Dict) (err error) {
-
-	// Calc Random UE (32 bytes)
-	ue := make([]byte, 32)
-	_, err = io.ReadFull(rand.Reader, ue)
+	opw, err := passwordAES256(ctx.OwnerPW)
 	if err != nil {
 		return err
 	}
 
-	ctx.E.UE = ue
-	d.Update("UE", HexLiteral(hex.EncodeToString(ctx.E.UE)))
-
-	// Calc file encryption key.
-	ctx.EncKey, err = calcFileEncKeyFromUE(ctx)
-
-	return err
-}
-
-func calcOAndUAES256(ctx *Context, d Dict) (err error) {
-
-	// 1) Calc U.
-	b := make([]byte, 16)
-	_, err = io.ReadFull(rand.Reader, b)
+	// Random file encryption key.
+	ctx.EncKey = make([]byte, 32)
+	_, err = io.ReadFull(rand.Reader, ctx.EncKey)
 	if err != nil {
 		return err
 	}
 
-	u := append(make([]byte, 32), b...)
-	upw := []byte(ctx.UserPW)
-	h := sha256.Sum256(append(upw, validationSalt(u)...))
-	ctx.E.U = append(h[:], b...)
-	d.Update("U", HexLiteral(hex.EncodeToString(ctx.E.U)))
-
-	// 2) Calc O (depends on U).
-	b = make([]byte, 16)
+	// 1) Calc U and UE.
+	b := make([]byte, 16)
 	_, err = io.ReadFull(rand.Reader, b)
 	if err != nil {
 		return err
 	}
 
-	o := append(make([]byte, 32), b...)
-	opw := []byte(ctx.OwnerPW)
-	c := append(opw, validationSalt(o)...)
-	h = sha256.Sum256(append(c, ctx.E.U...))
-	ctx.E.O = append(h[:], b...)
-	d.Update("O", HexLiteral(hex.EncodeToString(ctx.E.O)))
+	u := append(make([]byte, 32), b...)
+	ctx.E.U = append(hashAES256(upw, validationSalt(u), nil, ctx.E.R), b...)
+	d.Update("U", HexLiteral(hex.EncodeToString(ctx.E.U)))
 
-	err = calcFileEncKey(ctx, d)
+	ctx.E.UE, err = encryptFileEncKey(ctx.EncKey, hashAES256(upw, keySalt(u), nil, ctx.E.R))
 	if err != nil {
 		return err
 	}
+	d.Update("UE", HexLiteral(hex.EncodeToString(ctx.E.UE)))
 
-	// Encrypt file encryption key into UE.
-	h = sha256.Sum256(append(upw, keySalt(u)...))
-	cb, err := aes.NewCipher(h[:])
+	// 2) Calc O and OE (depends on U).
+	b = make([]byte, 16)
+	_, err = io.ReadFull(rand.Reader, b)
 	if err != nil {
 		return err
 	}
 
-	iv := make([]byte, 16)
-	mode := cipher.NewCBCEncrypter(cb, iv)
-	mode.CryptBlocks(ctx.E.UE, ctx.EncKey)
-	d.Update("UE", HexLiteral(hex.EncodeToString(ctx.E.UE)))
+	o := append(make([]byte, 32), b...)
+	ctx.E.O = append(hashAES256(opw, validationSalt(o), ctx.E.U, ctx.E.R), b...)
+	d.Update("O", HexLiteral(hex.EncodeToString(ctx.E.O)))
 
-	// Encrypt file encryption key into OE.
-	c = append(opw, keySalt(o)...)
-	h = sha256.Sum256(append(c, ctx.E.U...))
-	cb, err = aes.NewCipher(h[:])
+	ctx.E.OE, err = encryptFileEncKey(ctx.EncKey, hashAES256(opw, keySalt(o), ctx.E.U, ctx.E.R))
 	if err != nil {
 		return err
 	}
-
-	mode = cipher.NewCBCEncrypter(cb, iv)
-	mode.CryptBlocks(ctx.E.OE, ctx.EncKey)
 	d.Update("OE", HexLiteral(hex.EncodeToString(ctx.E.OE)))
 
 	return nil
@@ -1484,7 +1711,7 @@ func calcOAndUAES256(ctx *Context, d Dict) (err error) {
 
 func calcOAndU(ctx *Context, d Dict) (err error) {
 
-	if ctx.E.R == 5 {
+	if ctx.E.R >= 5 {
 		return calcOAndUAES256(ctx, d)
 	}
 
@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSASLPrep(t *testing.T) {
+
+	// See RFC 4013 3. Examples
+	for _, tt := range []struct {
+		in, want string
+		fail     bool
+	}{
+		{"I­X", "IX", false},
+		{"user", "user", false},
+		{"USER", "USER", false},
+		{"ª", "a", false},
+		{"Ⅸ", "IX", false},
+		{"a b", "a b", false},
+		{"\u0007", "", true},
+		{"ا1", "", true},
+		{"ا1ب", "ا1ب", false},
+	} {
+		got, err := saslPrep(tt.in)
+		if (err != nil) != tt.fail {
+			t.Errorf("saslPrep(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("saslPrep(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHashAES256(t *testing.T) {
+
+	salt := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	u := make([]byte, 48)
+	for i := range u {
+		u[i] = byte(i)
+	}
+
+	for _, tt := range []struct {
+		pw, salt, u []byte
+		want        string
+	}{
+		{[]byte("user"), salt, nil, "731758c09c8b0160a34721d18bdd24220abada0070aa3f05b8103fd5b8d05f17"},
+		{[]byte("Pässwörd"), u[8:16], u, "9d78fa7066ee175b0da10bd9247490489dc166e2ec7be3905cd0268544939727"},
+	} {
+		if got := hex.EncodeToString(hashAES256(tt.pw, tt.salt, tt.u, 6)); got != tt.want {
+			t.Errorf("hashAES256(%s) = %s, want %s", tt.pw, got, tt.want)
+		}
+	}
+}
+
+func encryptAES256(t *testing.T, b []byte, upw, opw string) []byte {
+	t.Helper()
+
+	conf := NewAESConfiguration(upw, opw, 256)
+	conf.Cmd = ENCRYPT
+
+	ctx, err := Read(bytes.NewReader(b), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	ctx.Write.Writer = bufio.NewWriter(&buf)
+
+	if err = Write(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestEncryptAES256(t *testing.T) {
+
+	b, err := ioutil.ReadFile(filepath.Join("..", "testdata", "testImage.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Passwords are normalized using SASLprep.
+	enc := encryptAES256(t, b, "Pässwörd", "Ⅸowner")
+
+	for _, tt := range []struct {
+		upw, opw string
+		fail     bool
+	}{
+		{"Pässwörd", "", false},
+		{"Pa\u0308sswo\u0308rd", "", false},
+		{"", "IXowner", false},
+		{"Passwort", "", true},
+		{"", "owner", true},
+	} {
+
+		conf := NewAESConfiguration(tt.upw, tt.opw, 256)
+
+		ctx, err := Read(bytes.NewReader(enc), conf)
+		if (err != nil) != tt.fail {
+			t.Fatalf("upw:%q opw:%q: unexpected result: %v", tt.upw, tt.opw, err)
+		}
+		if tt.fail {
+			continue
+		}
+
+		if ctx.E.R != 6 || ctx.E.V != 5 {
+			t.Fatalf("got R=%d V=%d, want R=6 V=5", ctx.E.R, ctx.E.V)
+		}
+
+		// Decrypted strings are readable.
+		d, err := ctx.DereferenceDict(*ctx.Info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, err := ctx.DereferenceText(d["CreationDate"]); err != nil || !strings.HasPrefix(s, "D:") {
+			t.Fatalf("invalid creation date: %s %v", s, err)
+		}
+
+		if err = ctx.LoadObjects(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -377,18 +377,22 @@ func (d *Dict) Increment(key string) error {
 	return d.IncrementBy(key, 1)
 }
 
-func (d Dict) indentedString(level int) string {
-
-	logstr := []string{"<<\n"}
-	tabstr := strings.Repeat("\t", level)
-
-	var keys []string
+// sortedKeys returns the keys of d in lexical order.
+func (d Dict) sortedKeys() []string {
+	keys := make([]string, 0, len(d))
 	for k := range d {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
+	return keys
+}
+
+func (d Dict) indentedString(level int) string {
 
-	for _, k := range keys {
+	logstr := []string{"<<\n"}
+	tabstr := strings.Repeat("\t", level)
+
+	for _, k := range d.sortedKeys() {
 
 		v := d[k]
 
@@ -419,13 +423,7 @@ func (d Dict) PDFString() string {
 	logstr := []string{} //make([]string, 20)
 	logstr = append(logstr, "<<")
 
-	var keys []string
-	for k := range d {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	for _, k := range keys {
+	for _, k := range d.sortedKeys() {
 
 		v := d[k]
 
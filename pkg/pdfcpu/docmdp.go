@@ -0,0 +1,375 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+// Functions checking the modifications of a certified document against its DocMDP access permissions (12.8.2.2).
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// Object categories relevant for DocMDP.
+const (
+	mdpOther = iota
+	mdpXRef
+	mdpSig
+	mdpField
+	mdpAcroForm
+	mdpDSS
+	mdpAnnot
+	mdpForm
+	mdpCatalog
+	mdpPage
+	mdpMetadata
+)
+
+// The catalog entries that may change when filling in forms or signing.
+var mdpCatalogKeys = map[string]bool{"AcroForm": true, "DSS": true, "Extensions": true, "Metadata": true}
+
+// The page entries that may change when adding widgets or annotations.
+var mdpPageKeys = map[string]bool{"Annots": true}
+
+func mdpCategory(o Object) int {
+
+	var d Dict
+
+	switch o := o.(type) {
+	case Dict:
+		d = o
+	case StreamDict:
+		d = o.Dict
+	case ObjectStreamDict:
+		return mdpXRef
+	case XRefStreamDict:
+		return mdpXRef
+	default:
+		return mdpOther
+	}
+
+	if t := d.Type(); t != nil {
+		switch *t {
+		case "XRef", "ObjStm":
+			return mdpXRef
+		case "Sig", "DocTimeStamp":
+			return mdpSig
+		case "Catalog":
+			return mdpCatalog
+		case "Page":
+			return mdpPage
+		case "Metadata":
+			return mdpMetadata
+		}
+	}
+
+	if st := d.Subtype(); st != nil {
+		switch *st {
+		case "Widget":
+			return mdpField
+		case "Form":
+			return mdpForm
+		}
+	}
+
+	switch {
+	case d["FT"] != nil || d["T"] != nil && (d["Kids"] != nil || d["Parent"] != nil):
+		return mdpField
+	case d["Fields"] != nil:
+		return mdpAcroForm
+	case d["VRI"] != nil || d["Certs"] != nil || d["OCSPs"] != nil || d["CRLs"] != nil:
+		return mdpDSS
+	case d.Type() != nil && *d.Type() == "Annot" || d.Subtype() != nil && d["Rect"] != nil:
+		return mdpAnnot
+	}
+
+	return mdpOther
+}
+
+// onlyKeysChanged returns true if d0 and d1 differ in entries of keys only.
+// Indirect references are compared by object number, their targets are checked on their own.
+func onlyKeysChanged(d0, d1 Dict, keys map[string]bool) bool {
+
+	for k, v := range d1 {
+		if keys[k] {
+			continue
+		}
+		v0, found := d0[k]
+		if !found {
+			return false
+		}
+		if v == nil || v0 == nil {
+			if v != v0 {
+				return false
+			}
+			continue
+		}
+		if v0.PDFString() != v.PDFString() {
+			return false
+		}
+	}
+
+	for k := range d0 {
+		if _, found := d1[k]; !found && !keys[k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mdpScope collects the indirect arrays and appearance streams of the current revision
+// which may change along with form fields and annotations.
+type mdpScope struct {
+	p           int    // DocMDP access permissions.
+	arrays      IntSet // Annots, Fields and Kids arrays.
+	appearances IntSet // Appearance streams of modifiable annotations.
+}
+
+func (s *mdpScope) addAppearances(ctx *Context, d Dict) {
+
+	ap, err := ctx.DereferenceDict(d["AP"])
+	if err != nil || ap == nil {
+		return
+	}
+
+	for _, k := range []string{"N", "R", "D"} {
+
+		o := ap[k]
+		if ir, ok := o.(IndirectRef); ok {
+			s.appearances[ir.ObjectNumber.Value()] = true
+			if o, err = ctx.Dereference(ir); err != nil {
+				continue
+			}
+		}
+
+		// A subdictionary of appearance states.
+		if d1, ok := o.(Dict); ok {
+			for _, v := range d1 {
+				if ir, ok := v.(IndirectRef); ok {
+					s.appearances[ir.ObjectNumber.Value()] = true
+				}
+			}
+		}
+	}
+}
+
+func (s *mdpScope) addFields(ctx *Context, o Object, visited IntSet) {
+
+	if ir, ok := o.(IndirectRef); ok {
+		if visited[ir.ObjectNumber.Value()] {
+			return
+		}
+		visited[ir.ObjectNumber.Value()] = true
+		s.arrays[ir.ObjectNumber.Value()] = true
+	}
+
+	a, err := ctx.DereferenceArray(o)
+	if err != nil {
+		return
+	}
+
+	for _, o := range a {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil || d == nil {
+			continue
+		}
+		s.addAppearances(ctx, d)
+		if kids, found := d.Find("Kids"); found {
+			s.addFields(ctx, kids, visited)
+		}
+	}
+}
+
+func newMDPScope(ctx *Context, p int) (*mdpScope, error) {
+
+	s := &mdpScope{p: p, arrays: IntSet{}, appearances: IntSet{}}
+
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, err
+	}
+
+	for i := 1; i <= ctx.PageCount; i++ {
+
+		d, _, err := ctx.PageDict(i)
+		if err != nil {
+			return nil, err
+		}
+
+		o, found := d.Find("Annots")
+		if !found {
+			continue
+		}
+
+		if ir, ok := o.(IndirectRef); ok {
+			s.arrays[ir.ObjectNumber.Value()] = true
+		}
+
+		a, err := ctx.DereferenceArray(o)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range a {
+			d, err := ctx.DereferenceDict(o)
+			if err != nil || d == nil {
+				continue
+			}
+			if mdpCategory(d) == mdpField || p == 3 {
+				s.addAppearances(ctx, d)
+			}
+		}
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	if d, err := ctx.DereferenceDict(rootDict["AcroForm"]); err == nil && d != nil {
+		s.addFields(ctx, d["Fields"], IntSet{})
+	}
+
+	return s, nil
+}
+
+// permitted returns true if changing obj#objNr from o0 to o1 is covered by the DocMDP access permissions.
+// o0 is nil for new objects, o1 is nil for deleted objects.
+func (s *mdpScope) permitted(objNr int, o0, o1 Object) bool {
+
+	if o0 == nil && o1 == nil {
+		return true
+	}
+
+	if o1 == nil {
+		// Only annotations and object streams may be deleted.
+		return mdpCategory(o0) == mdpXRef || s.p == 3 && mdpCategory(o0) == mdpAnnot
+	}
+
+	c := mdpCategory(o1)
+
+	if o0 == nil {
+		// New objects only matter once referenced by changed objects
+		// except for annotations which are also referenced by pages.
+		return c != mdpAnnot || s.p == 3
+	}
+
+	if c != mdpCategory(o0) {
+		return false
+	}
+
+	switch c {
+
+	case mdpXRef, mdpSig, mdpField, mdpAcroForm, mdpDSS, mdpMetadata:
+		return true
+
+	case mdpAnnot:
+		return s.p == 3
+
+	case mdpForm:
+		return s.appearances[objNr]
+
+	case mdpCatalog:
+		return onlyKeysChanged(o0.(Dict), o1.(Dict), mdpCatalogKeys)
+
+	case mdpPage:
+		return onlyKeysChanged(o0.(Dict), o1.(Dict), mdpPageKeys)
+
+	}
+
+	if _, ok := o1.(Array); ok {
+		return s.arrays[objNr]
+	}
+
+	return false
+}
+
+// revisionReader returns a reader for the first n bytes of rs.
+func revisionReader(rs io.ReadSeeker, n int64) (io.ReadSeeker, error) {
+
+	if ra, ok := rs.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, 0, n), nil
+	}
+
+	b, err := readRange(rs, 0, n)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// docMDPViolations returns the objects modified after revision nr in a way not permitted by the DocMDP access permissions p.
+func docMDPViolations(ctx *Context, revs []*Revision, nr, p int) ([]int, error) {
+
+	rs, err := revisionReader(ctx.Read.rs, revs[nr-1].EOFOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := *ctx.Configuration
+	ctx0, err := Read(rs, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newMDPScope(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := IntSet{}
+	for _, rev := range revs[nr:] {
+		for _, objNrs := range [][]int{rev.Added, rev.Changed, rev.Deleted} {
+			for _, objNr := range objNrs {
+				modified[objNr] = true
+			}
+		}
+	}
+
+	var objNrs []int
+
+	for objNr := range modified {
+
+		var o0, o1 Object
+
+		if e, found := ctx0.Find(objNr); found && !e.Free {
+			if o0, err = ctx0.FindObject(objNr); err != nil {
+				return nil, err
+			}
+		}
+
+		if e, found := ctx.Find(objNr); found && !e.Free {
+			if o1, err = ctx.FindObject(objNr); err != nil {
+				return nil, err
+			}
+		}
+
+		// The Info dict is no part of the document content.
+		if ctx.Info != nil && objNr == ctx.Info.ObjectNumber.Value() {
+			continue
+		}
+
+		if !s.permitted(objNr, o0, o1) {
+			objNrs = append(objNrs, objNr)
+		}
+	}
+
+	sort.Ints(objNrs)
+
+	return objNrs, nil
+}
@@ -18,6 +18,7 @@ package pdfcpu
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"strings"
 
@@ -106,11 +107,22 @@ func equalStreamDicts(sd1, sd2 *StreamDict, xRefTable *XRefTable) (bool, error)
 		return false, nil
 	}
 
-	if sd1.Raw == nil || sd2 == nil {
+	if sd2 == nil {
 		return false, errors.New("pdfcpu: equalStreamDicts: stream dict not loaded")
 	}
 
-	return bytes.Equal(sd1.Raw, sd2.Raw), nil
+	// Compare digests so stream content does not need to be loaded.
+	h1, h2 := sha256.New(), sha256.New()
+
+	if _, err = sd1.copyRaw(h1); err != nil {
+		return false, err
+	}
+
+	if _, err = sd2.copyRaw(h2); err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(h1.Sum(nil), h2.Sum(nil)), nil
 }
 
 func equalFontNames(v1, v2 Object, xRefTable *XRefTable) (bool, error) {
@@ -17,6 +17,7 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"os"
 	"strings"
 
 	"github.com/pdfcpu/pdfcpu/pkg/filter"
@@ -25,8 +26,9 @@ import (
 )
 
 // ExtractImageData extracts image data for objNr.
-// Supported imgTypes: FlateDecode, DCTDecode, JPXDecode
-// TODO: Implementation and usage of these filters: DCTDecode and JPXDecode.
+// Supported imgTypes: FlateDecode, CCITTFaxDecode, JBIG2Decode, DCTDecode, JPXDecode and any registered filter (See filter.Register).
+// The image filter is the last filter of a filter pipeline eg. [/FlateDecode /DCTDecode].
+// JPXDecode images are decoded when written (See WriteImage).
 // TODO: Should an error be returned instead of nil, nil when filters are not supported?
 func ExtractImageData(ctx *Context, objNr int) (*ImageObject, error) {
 
@@ -45,17 +47,11 @@ func ExtractImageData(ctx *Context, objNr int) (*ImageObject, error) {
 	}
 	filters := strings.Join(s, ",")
 
-	// Ignore filter chains with length > 1
-	if len(fpl) > 1 {
-		log.Info.Printf("extractImageData: ignore obj# %d, more than 1 filter:%s\n", objNr, filters)
-		return nil, nil
-	}
-
-	f := fpl[0].Name
+	f := fpl[len(fpl)-1].Name
 
-	// We do not extract imageMasks with the exception of CCITTDecoded images
+	// We do not extract imageMasks with the exception of CCITT and JBIG2 decoded images
 	if im := imageDict.BooleanEntry("ImageMask"); im != nil && *im {
-		if f != filter.CCITTFax {
+		if f != filter.CCITTFax && f != filter.JBIG2 {
 			log.Info.Printf("extractImageData: ignore obj# %d, imageMask\n", objNr)
 			return nil, nil
 		}
@@ -73,28 +69,33 @@ func ExtractImageData(ctx *Context, objNr int) (*ImageObject, error) {
 		return nil, nil
 	}
 
-	// CCITTDecoded images sometimes don't have a ColorSpace attribute.
-	if f == filter.CCITTFax {
+	// CCITT and JBIG2 decoded images sometimes don't have a ColorSpace attribute.
+	if f == filter.CCITTFax || f == filter.JBIG2 {
 		_, err := ctx.DereferenceDictEntry(imageDict.Dict, "ColorSpace")
 		if err != nil {
 			imageDict.InsertName("ColorSpace", DeviceGrayCS)
 		}
 	}
 
-	switch f {
+	switch {
 
-	case filter.Flate, filter.CCITTFax:
+	case f == filter.JPX && !filter.Registered(filter.JPX):
+		// Decoding also takes care of any preceding filters and SMaskInData.
+
+	case f == filter.Flate, f == filter.CCITTFax, f == filter.JBIG2, f == filter.DCT, filter.Registered(f):
 		// If color space is CMYK then write .tif else write .png
-		err := decodeStream(imageDict)
+		err := resolveJBIG2Globals(ctx.XRefTable, imageDict)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeStream(imageDict)
+		if err == filter.ErrUnsupportedFilter {
+			log.Debug.Printf("extractImageData: ignore obj# %d filter %s unsupported\n", objNr, filters)
+			return nil, nil
+		}
 		if err != nil {
 			return nil, err
 		}
-
-	case filter.DCT:
-		//imageObj.Extension = "jpg"
-
-	case filter.JPX:
-		//imageObj.Extension = "jpx"
 
 	default:
 		log.Debug.Printf("extractImageData: ignore obj# %d filter %s unsupported\n", objNr, filters)
@@ -104,32 +105,32 @@ func ExtractImageData(ctx *Context, objNr int) (*ImageObject, error) {
 	return imageObj, nil
 }
 
-// ExtractFontData extracts font data (the "fontfile") for objNr.
-// Supported fontTypes: TrueType
-func ExtractFontData(ctx *Context, objNr int) (*FontObject, error) {
+// fontFile returns the font object for objNr along with the stream dict of its font file
+// or nil if there is no supported font file.
+func fontFile(ctx *Context, objNr int) (*FontObject, *StreamDict, error) {
 
 	fontObject := ctx.Optimize.FontObjects[objNr]
 
 	// Only embedded fonts have binary data.
 	if !fontObject.Embedded() {
 		log.Debug.Printf("extractFontData: ignoring obj#%d - non embedded font: %s\n", objNr, fontObject.FontName)
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	d, err := fontDescriptor(ctx.XRefTable, fontObject.FontDict, objNr)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if d == nil {
 		log.Debug.Printf("extractFontData: ignoring obj#%d - no fontDescriptor available for font: %s\n", objNr, fontObject.FontName)
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	ir := fontDescriptorFontFileIndirectObjectRef(d)
 	if ir == nil {
 		log.Debug.Printf("extractFontData: ignoring obj#%d - no font file available for font: %s\n", objNr, fontObject.FontName)
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	fontType := fontObject.SubType()
@@ -142,32 +143,64 @@ func ExtractFontData(ctx *Context, objNr int) (*FontObject, error) {
 		// This is just me guessing..
 		sd, err := ctx.DereferenceStreamDict(*ir)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if sd == nil {
-			return nil, errors.Errorf("extractFontData: corrupt font obj#%d for font: %s\n", objNr, fontObject.FontName)
-		}
-
-		// Decode streamDict if used filter is supported only.
-		err = decodeStream(sd)
-		if err == filter.ErrUnsupportedFilter {
-			return nil, nil
-		}
-		if err != nil {
-			return nil, err
+			return nil, nil, errors.Errorf("extractFontData: corrupt font obj#%d for font: %s\n", objNr, fontObject.FontName)
 		}
 
-		fontObject.Data = sd.Content
 		fontObject.Extension = "ttf"
 
+		return fontObject, sd, nil
+
 	default:
 		log.Info.Printf("extractFontData: ignoring obj#%d - unsupported fonttype %s -  font: %s\n", objNr, fontType, fontObject.FontName)
+		return nil, nil, nil
+	}
+}
+
+// ExtractFontData extracts font data (the "fontfile") for objNr.
+// Supported fontTypes: TrueType
+func ExtractFontData(ctx *Context, objNr int) (*FontObject, error) {
+
+	fontObject, sd, err := fontFile(ctx, objNr)
+	if err != nil || sd == nil {
+		return nil, err
+	}
+
+	// Decode streamDict if used filter is supported only.
+	err = decodeStream(sd)
+	if err == filter.ErrUnsupportedFilter {
 		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	fontObject.Data = sd.Content
 
 	return fontObject, nil
 }
 
+// WriteFontData writes the font file for objNr to filename plus extension without loading it into memory.
+// It returns the name of the written file or "" if there is no supported font file (see ExtractFontData).
+func WriteFontData(ctx *Context, filename string, objNr int) (string, error) {
+
+	fontObject, sd, err := fontFile(ctx, objNr)
+	if err != nil || sd == nil {
+		return "", err
+	}
+
+	filename += "." + fontObject.Extension
+
+	ok, err := writeStreamFile(filename, sd)
+	if !ok {
+		return "", err
+	}
+
+	return filename, err
+}
+
 // ExtractStreamData extracts the content of a stream dict for a specific objNr.
 func ExtractStreamData(ctx *Context, objNr int) (data []byte, err error) {
 
@@ -194,6 +227,64 @@ func ExtractStreamData(ctx *Context, objNr int) (data []byte, err error) {
 	return sd.Content, nil
 }
 
+// WriteStreamData writes the content of the stream dict for objNr to filename without loading it into memory.
+// No file gets written for empty streams or unsupported filters (see ExtractStreamData).
+func WriteStreamData(ctx *Context, filename string, objNr int) error {
+
+	o, err := ctx.FindObject(objNr)
+	if err != nil {
+		return err
+	}
+
+	sd, err := ctx.DereferenceStreamDict(o)
+	if err != nil || sd == nil {
+		return err
+	}
+
+	_, err = writeStreamFile(filename, sd)
+
+	return err
+}
+
+// lazyFile creates its file on first write.
+type lazyFile struct {
+	name string
+	f    *os.File
+}
+
+func (lf *lazyFile) Write(p []byte) (int, error) {
+
+	if lf.f == nil {
+		f, err := os.Create(lf.name)
+		if err != nil {
+			return 0, err
+		}
+		lf.f = f
+	}
+
+	return lf.f.Write(p)
+}
+
+// writeStreamFile decodes sd into filename and returns true if a file has been written.
+func writeStreamFile(filename string, sd *StreamDict) (bool, error) {
+
+	lf := &lazyFile{name: filename}
+
+	err := writeDecodedStreamContent(sd, lf)
+
+	if lf.f != nil {
+		if err1 := lf.f.Close(); err == nil {
+			err = err1
+		}
+	}
+
+	if err == filter.ErrUnsupportedFilter {
+		return false, nil
+	}
+
+	return lf.f != nil, err
+}
+
 // TextData extracts text out of the page content for objNr.
 // func TextData(ctx *Context, objNr int) (data []byte, err error) {
 // 	// TODO
@@ -59,53 +59,115 @@ func parmsForFilter(d Dict) map[string]int {
 	return m
 }
 
-// encodeStream encodes stream dict data by applying its filter pipeline.
-func encodeStream(sd *StreamDict) error {
+// filterStage applies a single filter reading from r and writing to w.
+type filterStage func(r io.Reader, w io.Writer) error
 
-	log.Trace.Printf("encodeStream begin")
+// runFilterChain pipes r through all stages and writes the result to w.
+// Consecutive stages are connected by pipes so no stage needs to hold the complete stream in memory.
+func runFilterChain(r io.Reader, w io.Writer, stages []filterStage) error {
 
-	// No filter specified, nothing to encode.
-	if sd.FilterPipeline == nil {
-		log.Trace.Println("encodeStream: returning uncompressed stream.")
-		sd.Raw = sd.Content
-		streamLength := int64(len(sd.Raw))
-		sd.StreamLength = &streamLength
+	if len(stages) == 1 {
+		return stages[0](r, w)
+	}
 
-		sd.Update("Length", Integer(streamLength))
-		return nil
+	pr, pw := io.Pipe()
+
+	errc := make(chan error, 1)
+
+	go func() {
+		err := stages[0](r, pw)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+
+	err := runFilterChain(pr, w, stages[1:])
+
+	// Unblock the upstream stage in case the downstream stages finished early.
+	pr.CloseWithError(io.ErrClosedPipe)
+
+	err1 := <-errc
+
+	if err != nil {
+		return err
 	}
 
-	var b io.Reader
-	b = bytes.NewReader(sd.Content)
+	if err1 != io.ErrClosedPipe {
+		return err1
+	}
 
-	var c *bytes.Buffer
+	return nil
+}
 
-	// Apply each filter in the pipeline to result of preceding filter.
-	for _, f := range sd.FilterPipeline {
+// encodeFilter returns the filter needed for encoding f.
+func encodeFilter(sd *StreamDict, f PDFFilter) (filter.Filter, error) {
 
-		if f.DecodeParms != nil {
-			log.Trace.Printf("encodeStream: encoding filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
-		} else {
-			log.Trace.Printf("encodeStream: encoding filter:%s\n", f.Name)
-		}
+	if f.DecodeParms != nil {
+		log.Trace.Printf("encodeStream: encoding filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
+	} else {
+		log.Trace.Printf("encodeStream: encoding filter:%s\n", f.Name)
+	}
 
-		// make parms map[string]int
-		parms := parmsForFilter(f.DecodeParms)
+	// make parms map[string]int
+	parms := parmsForFilter(f.DecodeParms)
 
-		fi, err := filter.NewFilter(f.Name, parms)
-		if err != nil {
-			return err
+	if f.Name == filter.DCT {
+		// The DCT encoder needs the image dimensions.
+		if w := sd.IntEntry("Width"); w != nil {
+			parms["Columns"] = *w
+		}
+		if h := sd.IntEntry("Height"); h != nil {
+			parms["Rows"] = *h
 		}
+	}
 
-		c, err = fi.Encode(b)
+	return filter.NewFilter(f.Name, parms)
+}
+
+// encodeStreamTo encodes r by applying the filter pipeline of sd and writes the result to w.
+func encodeStreamTo(sd *StreamDict, r io.Reader, w io.Writer) error {
+
+	if sd.FilterPipeline == nil {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	stages := make([]filterStage, len(sd.FilterPipeline))
+
+	// Apply each filter in the pipeline to result of preceding filter.
+	for i, f := range sd.FilterPipeline {
+		fi, err := encodeFilter(sd, f)
 		if err != nil {
 			return err
 		}
+		stages[i] = fi.Encode
+	}
+
+	return runFilterChain(r, w, stages)
+}
+
+// encodeStream encodes stream dict data by applying its filter pipeline.
+func encodeStream(sd *StreamDict) error {
+
+	log.Trace.Printf("encodeStream begin")
+
+	// No filter specified, nothing to encode.
+	if sd.FilterPipeline == nil {
+		log.Trace.Println("encodeStream: returning uncompressed stream.")
+		sd.Raw, sd.source = sd.Content, nil
+		streamLength := int64(len(sd.Raw))
+		sd.StreamLength = &streamLength
+
+		sd.Update("Length", Integer(streamLength))
+		return nil
+	}
+
+	var b bytes.Buffer
 
-		b = c
+	if err := encodeStreamTo(sd, bytes.NewReader(sd.Content), &b); err != nil {
+		return err
 	}
 
-	sd.Raw = c.Bytes()
+	sd.Raw, sd.source = b.Bytes(), nil
 
 	streamLength := int64(len(sd.Raw))
 	sd.StreamLength = &streamLength
@@ -116,75 +178,155 @@ func encodeStream(sd *StreamDict) error {
 	return nil
 }
 
-// decodeStream decodes streamDict data by applying its filter pipeline.
-func decodeStream(sd *StreamDict) error {
+// jbig2Globals returns the decoded content of the JBIG2Globals stream of a JBIG2Decode filter.
+func jbig2Globals(d Dict) ([]byte, error) {
 
-	log.Trace.Printf("decodeStream begin \n%s\n", sd)
+	o, found := d.Find("JBIG2Globals")
+	if !found {
+		return nil, nil
+	}
 
-	if sd.Content != nil {
-		// This stream has already been decoded.
-		return nil
+	sd, ok := o.(StreamDict)
+	if !ok {
+		// See resolveJBIG2Globals.
+		log.Info.Println("decodeStream: unresolved JBIG2Globals")
+		return nil, filter.ErrUnsupportedFilter
 	}
 
-	// No filter specified, nothing to decode.
-	if sd.FilterPipeline == nil {
-		sd.Content = sd.Raw
-		log.Trace.Printf("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(sd.Content))
-		return nil
+	if err := decodeStream(&sd); err != nil {
+		return nil, err
 	}
 
-	var b io.Reader
-	b = bytes.NewReader(sd.Raw)
+	return sd.Content, nil
+}
 
-	//fmt.Printf("decodedStream before:\n%s\n", hex.Dump(sd.Raw))
+// resolveJBIG2Globals replaces JBIG2Globals stream references
+// in the decode parameters of sd's filter pipeline with their stream dicts.
+func resolveJBIG2Globals(xRefTable *XRefTable, sd *StreamDict) error {
 
-	var c *bytes.Buffer
+	for i, f := range sd.FilterPipeline {
 
-	// Apply each filter in the pipeline to result of preceding filter.
-	for _, f := range sd.FilterPipeline {
+		if f.Name != filter.JBIG2 || f.DecodeParms == nil {
+			continue
+		}
 
-		if f.DecodeParms != nil {
-			log.Trace.Printf("decodeStream: decoding filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
-		} else {
-			log.Trace.Printf("decodeStream: decoding filter:%s\n", f.Name)
+		o, found := f.DecodeParms.Find("JBIG2Globals")
+		if !found {
+			continue
 		}
 
-		// make parms map[string]int
-		parms := parmsForFilter(f.DecodeParms)
-
-		if f.Name == filter.CCITTFax {
-			// x/image/ccitt needs the optional decode parameter "Rows"
-			// if not available we supply the image "Height".
-			_, ok := parms["Rows"]
-			if !ok {
-				ip := sd.IntEntry("Height")
-				if ip == nil {
-					return errors.New("pdfcpu: ccitt: \"Height\" required")
-				}
-				parms["Rows"] = *ip
-			}
+		if _, ok := o.(StreamDict); ok {
+			continue
 		}
 
-		fi, err := filter.NewFilter(f.Name, parms)
+		globals, err := xRefTable.DereferenceStreamDict(o)
 		if err != nil {
 			return err
 		}
+		if globals == nil {
+			continue
+		}
+
+		// Leave the stream dict's DecodeParms untouched.
+		d := Dict{}
+		for k, v := range f.DecodeParms {
+			d[k] = v
+		}
+		d["JBIG2Globals"] = *globals
 
-		c, err = fi.Decode(b)
+		sd.FilterPipeline[i].DecodeParms = d
+	}
+
+	return nil
+}
+
+// decodeFilter returns the filter needed for decoding f.
+func decodeFilter(sd *StreamDict, f PDFFilter) (filter.Filter, error) {
+
+	if f.DecodeParms != nil {
+		log.Trace.Printf("decodeStream: decoding filter:%s\ndecodeParms:%s\n", f.Name, f.DecodeParms)
+	} else {
+		log.Trace.Printf("decodeStream: decoding filter:%s\n", f.Name)
+	}
+
+	// make parms map[string]int
+	parms := parmsForFilter(f.DecodeParms)
+
+	if f.Name == filter.CCITTFax {
+		// x/image/ccitt needs the optional decode parameter "Rows"
+		// if not available we supply the image "Height".
+		_, ok := parms["Rows"]
+		if !ok {
+			ip := sd.IntEntry("Height")
+			if ip == nil {
+				return nil, errors.New("pdfcpu: ccitt: \"Height\" required")
+			}
+			parms["Rows"] = *ip
+		}
+	}
+
+	if f.Name == filter.JBIG2 && !filter.Registered(filter.JBIG2) {
+		globals, err := jbig2Globals(f.DecodeParms)
+		if err != nil {
+			return nil, err
+		}
+		return filter.NewJBIG2Filter(parms, globals), nil
+	}
+
+	return filter.NewFilter(f.Name, parms)
+}
+
+// decodeStreamTo decodes r by applying the filter pipeline of sd and writes the result to w.
+func decodeStreamTo(sd *StreamDict, r io.Reader, w io.Writer) error {
+
+	if sd.FilterPipeline == nil {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	stages := make([]filterStage, len(sd.FilterPipeline))
+
+	// Apply each filter in the pipeline to result of preceding filter.
+	for i, f := range sd.FilterPipeline {
+		fi, err := decodeFilter(sd, f)
 		if err != nil {
 			return err
 		}
+		stages[i] = fi.Decode
+	}
+
+	return runFilterChain(r, w, stages)
+}
+
+// decodeStream decodes streamDict data by applying its filter pipeline.
+func decodeStream(sd *StreamDict) error {
 
-		//fmt.Printf("decodedStream after:%s\n%s\n", f.Name, hex.Dump(c.Bytes()))
+	log.Trace.Printf("decodeStream begin \n%s\n", sd)
 
-		b = c
+	if sd.Content != nil {
+		// This stream has already been decoded.
+		return nil
 	}
 
-	sd.Content = c.Bytes()
+	// No filter specified, nothing to decode.
+	if sd.FilterPipeline == nil {
+		if err := sd.loadRaw(); err != nil {
+			return err
+		}
+		sd.Content = sd.Raw
+		log.Trace.Printf("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(sd.Content))
+		return nil
+	}
+
+	var b bytes.Buffer
+
+	if err := writeDecodedStreamContent(sd, &b); err != nil {
+		return err
+	}
 
-	log.Trace.Printf("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(c.Bytes()))
+	sd.Content = b.Bytes()
 
-	//log.Trace.Printf("decodeStream end")
+	log.Trace.Printf("decodedStream returning %d(#%02x)bytes: \n%s\n", len(sd.Content), len(sd.Content), hex.Dump(sd.Content))
 
 	return nil
 }
@@ -0,0 +1,281 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+)
+
+func testStreamContent() []byte {
+	var b bytes.Buffer
+	for i := 0; i < 20000; i++ {
+		b.WriteString("BT /F1 12 Tf 72 712 Td (Hello, Gopher!) Tj ET\n")
+		b.WriteByte(byte(i))
+	}
+	return b.Bytes()
+}
+
+func TestFilterChain(t *testing.T) {
+
+	content := testStreamContent()
+
+	sd := NewStreamDict(Dict{}, 0, nil, nil, []PDFFilter{{Name: filter.Flate}, {Name: filter.ASCII85}, {Name: filter.ASCIIHex}})
+	sd.Content = content
+
+	if err := encodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	if *sd.StreamLength != int64(len(sd.Raw)) {
+		t.Fatalf("stream length %d != %d", *sd.StreamLength, len(sd.Raw))
+	}
+
+	// The filter pipeline lists the encoding order.
+	sd1 := NewStreamDict(Dict{}, 0, nil, nil, []PDFFilter{{Name: filter.ASCIIHex}, {Name: filter.ASCII85}, {Name: filter.Flate}})
+	sd1.Raw = sd.Raw
+
+	if err := decodeStream(&sd1); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(sd1.Content, content) {
+		t.Fatal("original content != decoded content")
+	}
+}
+
+func TestFilterChainError(t *testing.T) {
+
+	sd := NewStreamDict(Dict{}, 0, nil, nil, []PDFFilter{{Name: filter.ASCIIHex}, {Name: filter.Flate}})
+
+	// Invalid hex digits in the first stage.
+	if err := decodeStreamTo(&sd, bytes.NewReader([]byte("78 9c zz")), ioutil.Discard); err == nil {
+		t.Fatal("expected error for invalid hex digit")
+	}
+
+	// The second stage stops at its eod marker.
+	sd = NewStreamDict(Dict{}, 0, nil, nil, []PDFFilter{{Name: filter.ASCIIHex}, {Name: filter.RunLength}})
+
+	input := append([]byte("0041 80"), bytes.Repeat([]byte("42"), 100000)...)
+
+	var b bytes.Buffer
+	if err := decodeStreamTo(&sd, bytes.NewReader(input), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != "A" {
+		t.Fatalf("got %q, want \"A\"", b.String())
+	}
+}
+
+func TestAESDecryptReader(t *testing.T) {
+
+	key := []byte("0123456789abcdef")
+
+	for _, l := range []int{0, 1, 15, 16, 17, 4095, 4096, 4097, 10000} {
+
+		content := testStreamContent()[:l]
+
+		enc, err := encryptAESBytes(append([]byte(nil), content...), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := decryptStreamReader(bytes.NewReader(enc), 0, 0, key, true, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(dec, content) {
+			t.Fatalf("len=%d: original content != decrypted content", l)
+		}
+	}
+}
+
+func TestWriteDecodedStreamContent(t *testing.T) {
+
+	content := testStreamContent()
+
+	sd := NewStreamDict(Dict{}, 0, nil, nil, []PDFFilter{{Name: filter.Flate}})
+	sd.Content = content
+
+	if err := encodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a file holding the encrypted stream at offset 7.
+	key := []byte("secret")
+
+	enc, err := encryptStream(append([]byte(nil), sd.Raw...), 5, 0, key, false, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := append([]byte("stream\n"), enc...)
+	file = append(file, []byte("\nendstream")...)
+
+	ctx := &Context{XRefTable: &XRefTable{EncKey: key, E: &Enc{R: 2}}, Read: newReadContext(bytes.NewReader(file))}
+
+	l := int64(len(enc))
+	sd1 := NewStreamDict(Dict{}, 7, &l, nil, []PDFFilter{{Name: filter.Flate}})
+
+	if err := setStreamSource(ctx, &sd1, 5, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := writeDecodedStreamContent(&sd1, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b.Bytes(), content) {
+		t.Fatal("original content != decoded content")
+	}
+
+	if sd1.Raw != nil || sd1.Content != nil {
+		t.Fatal("stream content should not be buffered")
+	}
+
+	// Copy the stream re-encrypting it using AES.
+	key1 := []byte("0123456789abcdef")
+	encrypt := func(w io.Writer) (io.WriteCloser, error) {
+		return encryptStreamWriter(w, 5, 0, key1, true, 5)
+	}
+
+	b.Reset()
+	n, err := writeStreamContent(&b, sd1, encrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := encryptedStreamLength(int64(len(sd.Raw)), true); n != want || int64(b.Len()) != want {
+		t.Fatalf("encrypted length: want %d, got %d", want, n)
+	}
+
+	raw, err := decryptAESBytes(b.Bytes(), key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(raw, sd.Raw) {
+		t.Fatal("original stream != re-encrypted stream")
+	}
+}
+
+func TestAESEncryptWriter(t *testing.T) {
+
+	key := []byte("0123456789abcdef")
+
+	for _, l := range []int{0, 1, 15, 16, 17, 4096, 10000} {
+
+		content := testStreamContent()[:l]
+
+		var b bytes.Buffer
+
+		w, err := encryptStreamWriter(&b, 0, 0, key, true, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Write in odd sized chunks.
+		for p := content; len(p) > 0; {
+			i := 7
+			if i > len(p) {
+				i = len(p)
+			}
+			if _, err = w.Write(p[:i]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[i:]
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if int64(b.Len()) != encryptedStreamLength(int64(l), true) {
+			t.Fatalf("len=%d: unexpected encrypted length %d", l, b.Len())
+		}
+
+		dec, err := decryptAESBytes(b.Bytes(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(dec, content) {
+			t.Fatalf("len=%d: original content != decrypted content", l)
+		}
+	}
+}
+
+// xorFilter is a custom filter inverting all bits.
+type xorFilter struct{}
+
+func (f xorFilter) Encode(r io.Reader, w io.Writer) error {
+	return f.Decode(r, w)
+}
+
+func (f xorFilter) Decode(r io.Reader, w io.Writer) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	for i := range b {
+		b[i] ^= 0xFF
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func TestRegisteredFilter(t *testing.T) {
+
+	const name = "XORDecode"
+
+	filter.Register(name, func(parms map[string]int) (filter.Filter, error) {
+		return xorFilter{}, nil
+	})
+	defer filter.Register(name, nil)
+
+	content := testStreamContent()
+
+	sd := NewStreamDict(Dict{}, 0, nil, nil, []PDFFilter{{Name: filter.Flate}, {Name: name}})
+	sd.Content = content
+
+	if err := encodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	sd1 := NewStreamDict(Dict{}, 0, nil, nil, []PDFFilter{{Name: name}, {Name: filter.Flate}})
+	sd1.Raw = sd.Raw
+
+	if err := saveDecodedStreamContent(&sd1); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(sd1.Content, content) {
+		t.Fatal("original content != decoded content")
+	}
+}
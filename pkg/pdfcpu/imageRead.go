@@ -26,6 +26,28 @@ import (
 	"github.com/pkg/errors"
 )
 
+// pngUpDecodeParms returns the decode parameters for PNG Up prediction of image samples.
+func pngUpDecodeParms(colors, bpc, columns int) Dict {
+	return Dict(
+		map[string]Object{
+			"Colors":           Integer(colors),
+			"BitsPerComponent": Integer(bpc),
+			"Columns":          Integer(columns),
+			"Predictor":        Integer(filter.PredictorUp),
+		},
+	)
+}
+
+func colorComponents(cs string) int {
+	switch cs {
+	case DeviceRGBCS:
+		return 3
+	case DeviceCMYKCS:
+		return 4
+	}
+	return 1
+}
+
 func createSMaskObject(xRefTable *XRefTable, buf []byte, w, h int) (*IndirectRef, error) {
 
 	sd := &StreamDict{
@@ -40,9 +62,10 @@ func createSMaskObject(xRefTable *XRefTable, buf []byte, w, h int) (*IndirectRef
 			},
 		),
 		Content:        buf,
-		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: pngUpDecodeParms(1, 8, w)}}}
 
 	sd.InsertName("Filter", filter.Flate)
+	sd.Insert("DecodeParms", sd.FilterPipeline[0].DecodeParms)
 
 	err := encodeStream(sd)
 	if err != nil {
@@ -76,9 +99,10 @@ func createFlateImageObject(xRefTable *XRefTable, buf, sm []byte, w, h, bpc int,
 			},
 		),
 		Content:        buf,
-		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: pngUpDecodeParms(colorComponents(cs), bpc, w)}}}
 
 	sd.InsertName("Filter", filter.Flate)
+	sd.Insert("DecodeParms", sd.FilterPipeline[0].DecodeParms)
 
 	if softMaskIndRef != nil {
 		sd.Insert("SMask", *softMaskIndRef)
@@ -147,6 +171,77 @@ func createDCTImageObject(xRefTable *XRefTable, buf, sm []byte, w, h int, cs str
 	return sd, nil
 }
 
+func createCCITTImageObject(xRefTable *XRefTable, buf []byte, w, h int) (*StreamDict, error) {
+
+	sd := &StreamDict{
+		Dict: Dict(
+			map[string]Object{
+				"Type":             Name("XObject"),
+				"Subtype":          Name("Image"),
+				"Width":            Integer(w),
+				"Height":           Integer(h),
+				"BitsPerComponent": Integer(1),
+				"ColorSpace":       Name(DeviceGrayCS),
+			},
+		),
+		Content: buf,
+		FilterPipeline: []PDFFilter{{
+			Name: filter.CCITTFax,
+			DecodeParms: Dict(
+				map[string]Object{
+					"K":       Integer(-1),
+					"Columns": Integer(w),
+					"Rows":    Integer(h),
+				},
+			)}},
+	}
+
+	sd.InsertName("Filter", filter.CCITTFax)
+	sd.Insert("DecodeParms", sd.FilterPipeline[0].DecodeParms)
+
+	err := encodeStream(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return sd, nil
+}
+
+// bilevelImageBuf returns the packed 1 bit per pixel samples of a gray or paletted image
+// made up of opaque black and white pixels only, else nil.
+func bilevelImageBuf(img image.Image) []byte {
+
+	switch img.(type) {
+	case *image.Gray, *image.Paletted:
+	default:
+		return nil
+	}
+
+	w := img.Bounds().Dx()
+	h := img.Bounds().Dy()
+	rowSize := (w + 7) / 8
+
+	buf := make([]byte, rowSize*h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(img.Bounds().Min.X+x, img.Bounds().Min.Y+y)
+			if _, _, _, a := c.RGBA(); a != 0xffff {
+				return nil
+			}
+			switch color.GrayModel.Convert(c).(color.Gray).Y {
+			case 0x00:
+			case 0xFF:
+				buf[y*rowSize+x/8] |= 0x80 >> uint(x%8)
+			default:
+				return nil
+			}
+		}
+	}
+
+	return buf
+}
+
 func writeRGBAImageBuf(img image.Image) []byte {
 
 	w := img.Bounds().Dx()
@@ -294,6 +389,11 @@ func imgToImageDict(xRefTable *XRefTable, img image.Image) (*StreamDict, error)
 	w := img.Bounds().Dx()
 	h := img.Bounds().Dy()
 
+	// Black and white scans compress best using CCITT Group 4.
+	if buf := bilevelImageBuf(img); buf != nil {
+		return createCCITTImageObject(xRefTable, buf, w, h)
+	}
+
 	var buf []byte
 	var sm []byte
 	var cs string
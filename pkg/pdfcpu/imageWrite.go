@@ -17,10 +17,11 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"bytes"
 	"image"
 	"image/color"
 	"image/png"
-	"io/ioutil"
+	"io"
 	"os"
 
 	"github.com/hhrutter/tiff"
@@ -87,7 +88,11 @@ func decodeArr(a Array) []colValRange {
 
 func pdfImage(xRefTable *XRefTable, sd *StreamDict, objNr int) (*PDFImage, error) {
 
-	bpc := *sd.IntEntry("BitsPerComponent")
+	// Image masks may omit BitsPerComponent.
+	bpc := 1
+	if i := sd.IntEntry("BitsPerComponent"); i != nil {
+		bpc = *i
+	}
 	//if bpc == 16 {
 	//	return nil, ErrUnsupported16BPC
 	//}
@@ -181,23 +186,13 @@ func streamBytes(sd *StreamDict) ([]byte, error) {
 		return sd.Content, nil
 	}
 
-	// Ignore filter chains with length > 1
-	if len(fpl) > 1 {
-		log.Info.Printf("streamBytes: more than 1 filter\n")
+	err := decodeStream(sd)
+	if err == filter.ErrUnsupportedFilter {
+		log.Debug.Printf("streamBytes: unsupported filter pipeline: %v\n", fpl)
 		return nil, nil
 	}
-
-	switch fpl[0].Name {
-
-	case filter.Flate:
-		err := decodeStream(sd)
-		if err != nil {
-			return nil, err
-		}
-
-	default:
-		log.Debug.Printf("streamBytes: filter not \"Flate\": %s\n", fpl[0].Name)
-		return nil, nil
+	if err != nil {
+		return nil, err
 	}
 
 	return sd.Content, nil
@@ -252,13 +247,18 @@ func softMask(xRefTable *XRefTable, d *StreamDict, w, h, objNr int) ([]byte, err
 func writeImgToJPG(filename string, sd *StreamDict) (string, error) {
 
 	filename += ".jpg"
-	return filename, ioutil.WriteFile(filename, sd.Raw, os.ModePerm)
-}
 
-func writeImgToJPX(filename string, sd *StreamDict) (string, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = sd.copyRaw(f); err != nil {
+		f.Close()
+		return "", err
+	}
 
-	filename += ".jpx"
-	return filename, ioutil.WriteFile(filename, sd.Raw, os.ModePerm)
+	return filename, f.Close()
 }
 
 func writeImgToTIFF(filename string, img *image.CMYK) (string, error) {
@@ -323,9 +323,17 @@ func writeDeviceGrayToPNG(filename string, im *PDFImage) (string, error) {
 		return "", errors.Errorf("writeDeviceGrayToPNG: objNr=%d corrupt image object %v\n", im.objNr, *im.sd)
 	}
 
+	if im.bpc == 1 {
+		return writeBilevelToPNG(filename, im)
+	}
+
+	if im.softMask != nil && im.bpc == 8 {
+		return writeGrayAlphaToPNG(filename, im)
+	}
+
 	img := image.NewGray(image.Rect(0, 0, im.w, im.h))
 
-	// TODO support softmask.
+	// TODO support softmask for bpc < 8.
 	i := 0
 	for y := 0; y < im.h; y++ {
 		for x := 0; x < im.w; {
@@ -345,6 +353,50 @@ func writeDeviceGrayToPNG(filename string, im *PDFImage) (string, error) {
 	return writeImgToPNG(filename, img)
 }
 
+// writeGrayAlphaToPNG writes an 8 bit DeviceGray image with soft mask.
+func writeGrayAlphaToPNG(filename string, im *PDFImage) (string, error) {
+
+	b := im.sd.Content
+
+	img := image.NewNRGBA(image.Rect(0, 0, im.w, im.h))
+
+	for y := 0; y < im.h; y++ {
+		for x := 0; x < im.w; x++ {
+			i := y*im.w + x
+			v := decodePixelColorValue(b[i], im.bpc, 0, im.decode)
+			img.Set(x, y, color.NRGBA{R: v, G: v, B: v, A: im.softMask[i]})
+		}
+	}
+
+	return writeImgToPNG(filename, img)
+}
+
+// writeBilevelToPNG writes a 1 bit DeviceGray image as 1 bit PNG.
+func writeBilevelToPNG(filename string, im *PDFImage) (string, error) {
+
+	b := im.sd.Content
+	rowSize := (im.w + 7) / 8
+
+	if len(b) < rowSize*im.h {
+		return "", errors.Errorf("writeBilevelToPNG: objNr=%d corrupt image object %v\n", im.objNr, *im.sd)
+	}
+
+	// A 0 bit means black unless Decode is [1 0].
+	inv := len(im.decode) > 0 && im.decode[0].inv
+
+	img := image.NewPaletted(image.Rect(0, 0, im.w, im.h), color.Palette{color.Gray{Y: 0x00}, color.Gray{Y: 0xFF}})
+
+	for y := 0; y < im.h; y++ {
+		for x := 0; x < im.w; x++ {
+			if (b[y*rowSize+x/8]&(0x80>>uint(x%8)) > 0) != inv {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	return writeImgToPNG(filename, img)
+}
+
 func writeDeviceRGBToPNG(filename string, im *PDFImage) (string, error) {
 
 	b := im.sd.Content
@@ -644,7 +696,7 @@ func writeIndexed(xRefTable *XRefTable, filename string, im *PDFImage, cs Array)
 	return "", nil
 }
 
-func writeFlateEncodedImage(xRefTable *XRefTable, filename string, sd *StreamDict, objNr int) (string, error) {
+func writeDecodedImage(xRefTable *XRefTable, filename string, sd *StreamDict, objNr int) (string, error) {
 
 	pdfImage, err := pdfImage(xRefTable, sd, objNr)
 	if err != nil {
@@ -656,7 +708,15 @@ func writeFlateEncodedImage(xRefTable *XRefTable, filename string, sd *StreamDic
 		return "", err
 	}
 
-	var fn string
+	return writePDFImage(xRefTable, filename, pdfImage, o)
+}
+
+func writePDFImage(xRefTable *XRefTable, filename string, im *PDFImage, o Object) (string, error) {
+
+	var (
+		fn  string
+		err error
+	)
 
 	switch cs := o.(type) {
 
@@ -664,16 +724,16 @@ func writeFlateEncodedImage(xRefTable *XRefTable, filename string, sd *StreamDic
 		switch cs {
 
 		case DeviceGrayCS:
-			fn, err = writeDeviceGrayToPNG(filename, pdfImage)
+			fn, err = writeDeviceGrayToPNG(filename, im)
 
 		case DeviceRGBCS:
-			fn, err = writeDeviceRGBToPNG(filename, pdfImage)
+			fn, err = writeDeviceRGBToPNG(filename, im)
 
 		case DeviceCMYKCS:
-			fn, err = writeDeviceCMYKToTIFF(filename, pdfImage)
+			fn, err = writeDeviceCMYKToTIFF(filename, im)
 
 		default:
-			log.Info.Printf("writeFlateEncodedImage: objNr=%d, unsupported name colorspace %s\n", objNr, cs.String())
+			log.Info.Printf("writePDFImage: objNr=%d, unsupported name colorspace %s\n", im.objNr, cs.String())
 			err = ErrUnsupportedColorSpace
 		}
 
@@ -683,16 +743,16 @@ func writeFlateEncodedImage(xRefTable *XRefTable, filename string, sd *StreamDic
 		switch csn {
 
 		case CalRGBCS:
-			fn, err = writeCalRGBToPNG(filename, pdfImage)
+			fn, err = writeCalRGBToPNG(filename, im)
 
 		case ICCBasedCS:
-			fn, err = writeICCBased(xRefTable, filename, pdfImage, cs)
+			fn, err = writeICCBased(xRefTable, filename, im, cs)
 
 		case IndexedCS:
-			fn, err = writeIndexed(xRefTable, filename, pdfImage, cs)
+			fn, err = writeIndexed(xRefTable, filename, im, cs)
 
 		default:
-			log.Info.Printf("writeFlateEncodedImage: objNr=%d, unsupported array colorspace %s\n", objNr, csn)
+			log.Info.Printf("writePDFImage: objNr=%d, unsupported array colorspace %s\n", im.objNr, csn)
 			err = ErrUnsupportedColorSpace
 
 		}
@@ -702,29 +762,102 @@ func writeFlateEncodedImage(xRefTable *XRefTable, filename string, sd *StreamDic
 	return fn, err
 }
 
+// writeJPXImage decodes a JPEG 2000 image and writes it as PNG or TIFF.
+func writeJPXImage(xRefTable *XRefTable, filename string, sd *StreamDict, objNr int) (string, error) {
+
+	var (
+		r   io.Reader
+		err error
+	)
+
+	// Apply any filters preceding JPXDecode.
+	if fpl := sd.FilterPipeline; len(fpl) > 1 {
+		sd1 := *sd
+		sd1.FilterPipeline, sd1.Content = fpl[:len(fpl)-1], nil
+		if err = decodeStream(&sd1); err != nil {
+			return "", err
+		}
+		r = bytes.NewReader(sd1.Content)
+	} else if r, err = sd.rawReader(); err != nil {
+		return "", err
+	}
+
+	img, err := filter.DecodeJPX(r)
+	if err != nil {
+		return "", err
+	}
+
+	sd.Content = img.Data
+
+	pdfImage, err := pdfImage(xRefTable, sd, objNr)
+	if err != nil {
+		return "", err
+	}
+
+	// JPXDecode delivers 8 bit samples and Decode applies to image masks only.
+	pdfImage.bpc, pdfImage.w, pdfImage.h, pdfImage.decode = 8, img.Width, img.Height, nil
+
+	// SMaskInData: the opacity channel of the JPEG 2000 data is the soft mask.
+	if i := sd.IntEntry("SMaskInData"); i != nil && *i > 0 && pdfImage.softMask == nil {
+		pdfImage.softMask = img.Alpha
+	}
+
+	// A color space specified by the image dictionary overrides the one of the JPEG 2000 data.
+	o, found := sd.Find("ColorSpace")
+	if found && o != nil {
+		if o, err = xRefTable.Dereference(o); err != nil {
+			return "", err
+		}
+	} else {
+		switch img.Colors {
+		case 1:
+			o = Name(DeviceGrayCS)
+		case 3:
+			o = Name(DeviceRGBCS)
+		case 4:
+			o = Name(DeviceCMYKCS)
+		default:
+			log.Info.Printf("writeJPXImage: objNr=%d, unsupported number of color components: %d\n", objNr, img.Colors)
+			return "", ErrUnsupportedColorSpace
+		}
+	}
+
+	return writePDFImage(xRefTable, filename, pdfImage, o)
+}
+
 // WriteImage writes a PDF image object to disk.
 func WriteImage(xRefTable *XRefTable, filename string, sd *StreamDict, objNr int) (fileName string, err error) {
 
-	switch sd.FilterPipeline[0].Name {
+	fpl := sd.FilterPipeline
 
-	case filter.Flate, filter.CCITTFax:
-		// If color space is CMYK then write .tif else write .png
-		fn, err := writeFlateEncodedImage(xRefTable, filename, sd, objNr)
-		if err != nil {
-			if err == ErrUnsupportedColorSpace {
-				log.Info.Printf("Image obj#%d uses an unsupported color space. Please see the logfile for details.\n", objNr)
-				err = nil
-			}
-		}
-		return fn, err
+	f := fpl[len(fpl)-1].Name
+
+	switch {
 
-	case filter.DCT:
+	case f == filter.DCT && len(fpl) == 1:
 		return writeImgToJPG(filename, sd)
 
-	case filter.JPX:
-		return writeImgToJPX(filename, sd)
+	case f == filter.JPX && !filter.Registered(filter.JPX):
+		fileName, err = writeJPXImage(xRefTable, filename, sd, objNr)
+		return fileName, unsupportedColorSpace(err, objNr)
+
+	case f == filter.Flate, f == filter.CCITTFax, f == filter.JBIG2, f == filter.DCT, filter.Registered(f):
+		// Chained filters like [/FlateDecode /DCTDecode] have no jpg representation.
+		// Registered filters are expected to deliver the samples as described by the image dict.
+		// If color space is CMYK then write .tif else write .png
+		fileName, err = writeDecodedImage(xRefTable, filename, sd, objNr)
+		return fileName, unsupportedColorSpace(err, objNr)
 
 	}
 
 	return "", nil
 }
+
+// unsupportedColorSpace logs and ignores ErrUnsupportedColorSpace.
+func unsupportedColorSpace(err error, objNr int) error {
+	if err == ErrUnsupportedColorSpace {
+		log.Info.Printf("Image obj#%d uses an unsupported color space. Please see the logfile for details.\n", objNr)
+		return nil
+	}
+	return err
+}
@@ -496,3 +496,47 @@ func TestReadWriteJPEG(t *testing.T) {
 		fmt.Printf("fileName: %s\n", fn)
 	}
 }
+
+func TestJBIG2Globals(t *testing.T) {
+
+	// A page information segment for a 16x2 page.
+	globals := StreamDict{
+		Dict: NewDict(),
+		Raw: []byte{
+			0x00, 0x00, 0x00, 0x00, 0x30, 0x00, 0x01, 0x00, 0x00, 0x00, 0x13,
+			0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x02,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		},
+	}
+
+	indRef, err := xRefTable.IndRefForNewObject(globals)
+	if err != nil {
+		t.Fatalf("err: %v\n", err)
+	}
+
+	decodeParms := Dict(map[string]Object{"JBIG2Globals": *indRef})
+
+	// An end of page segment relying on the page information of the globals.
+	sd := &StreamDict{
+		Dict:           NewDict(),
+		Raw:            []byte{0x00, 0x00, 0x00, 0x01, 0x31, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00},
+		FilterPipeline: []PDFFilter{{Name: filter.JBIG2, DecodeParms: decodeParms}},
+	}
+
+	if err := resolveJBIG2Globals(xRefTable, sd); err != nil {
+		t.Fatalf("err: %v\n", err)
+	}
+
+	if _, ok := decodeParms["JBIG2Globals"].(IndirectRef); !ok {
+		t.Fatal("decode parameters of stream dict modified")
+	}
+
+	if err := decodeStream(sd); err != nil {
+		t.Fatalf("err: %v\n", err)
+	}
+
+	// A blank page.
+	if !bytes.Equal(sd.Content, []byte{0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Fatalf("unexpected content: %v", sd.Content)
+	}
+}
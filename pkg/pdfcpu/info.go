@@ -81,6 +81,54 @@ func handleInfoDict(ctx *Context, d Dict) (err error) {
 	return nil
 }
 
+// collectInfo records the page count, document info and tagging of a context not validated, eg. loaded lazily.
+func (ctx *Context) collectInfo() error {
+
+	if err := ctx.EnsurePageCount(); err != nil {
+		return err
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+
+	if d, err := ctx.DereferenceDict(rootDict["MarkInfo"]); err == nil && d != nil {
+		marked, suspects := d.BooleanEntry("Marked"), d.BooleanEntry("Suspects")
+		ctx.Tagged = marked != nil && *marked && (suspects == nil || !*suspects)
+	}
+
+	if ctx.Info == nil {
+		return nil
+	}
+
+	d, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || d == nil {
+		return err
+	}
+
+	for k, s := range map[string]*string{
+		"Title":        &ctx.Title,
+		"Author":       &ctx.Author,
+		"Subject":      &ctx.Subject,
+		"Keywords":     &ctx.Keywords,
+		"Creator":      &ctx.Creator,
+		"Producer":     &ctx.Producer,
+		"CreationDate": &ctx.CreationDate,
+		"ModDate":      &ctx.ModDate,
+	} {
+		o, found := d.Find(k)
+		if !found {
+			continue
+		}
+		if *s, err = ctx.DereferenceText(o); err != nil {
+			log.Info.Printf("collectInfo: skipping corrupt info entry %s: %v\n", k, err)
+		}
+	}
+
+	return nil
+}
+
 func ensureInfoDict(ctx *Context) error {
 
 	// => 14.3.3 Document Information Dictionary
@@ -100,12 +148,19 @@ func ensureInfoDict(ctx *Context) error {
 
 	v := "pdfcpu " + VersionStr
 
+	// PDF 2.0 deprecates all entries except CreationDate and ModDate.
+	v20 := ctx.Version() == V20
+
 	if ctx.Info == nil {
 
 		d := NewDict()
-		d.InsertString("Producer", v)
-		d.InsertString("CreationDate", now)
-		d.InsertString("ModDate", now)
+		if !v20 {
+			d.InsertString("Producer", v)
+		}
+		if !ctx.Deterministic {
+			d.InsertString("CreationDate", now)
+			d.InsertString("ModDate", now)
+		}
 
 		ir, err := ctx.IndRefForNewObject(d)
 		if err != nil {
@@ -127,9 +182,13 @@ func ensureInfoDict(ctx *Context) error {
 		return err
 	}
 
-	d.Update("CreationDate", StringLiteral(now))
-	d.Update("ModDate", StringLiteral(now))
-	d.Update("Producer", StringLiteral(v))
+	if !ctx.Deterministic {
+		d.Update("CreationDate", StringLiteral(now))
+		d.Update("ModDate", StringLiteral(now))
+	}
+	if !v20 {
+		d.Update("Producer", StringLiteral(v))
+	}
 
 	return nil
 }
@@ -17,6 +17,8 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"sort"
+
 	"github.com/pdfcpu/pdfcpu/pkg/log"
 )
 
@@ -111,7 +113,13 @@ func lookupTable(keys IntSet, i int) map[int]int {
 
 	m := map[int]int{}
 
+	objNrs := make([]int, 0, len(keys))
 	for k := range keys {
+		objNrs = append(objNrs, k)
+	}
+	sort.Ints(objNrs)
+
+	for _, k := range objNrs {
 		m[k] = i
 		i++
 	}
@@ -291,6 +299,12 @@ func mergeDuplicateObjNumberIntSets(ctxSource, ctxDest *Context) {
 // MergeXRefTables merges Context ctxSource into ctxDest by appending its page tree.
 func MergeXRefTables(ctxSource, ctxDest *Context) (err error) {
 
+	for _, ctx := range []*Context{ctxSource, ctxDest} {
+		if err = ctx.LoadObjects(); err != nil {
+			return err
+		}
+	}
+
 	// Sweep over ctxSource cross ref table and ensure valid object numbers in ctxDest's space.
 	patchSourceObjectNumbers(ctxSource, ctxDest)
 
@@ -237,7 +237,9 @@ func optimizeFontResourcesDict(ctx *Context, rDict Dict, pageNumber, pageObjNumb
 	pageFonts := pageFonts(ctx, pageNumber)
 
 	// Iterate over font resource dict.
-	for rName, v := range rDict {
+	for _, rName := range rDict.sortedKeys() {
+
+		v := rDict[rName]
 
 		indRef, ok := v.(IndirectRef)
 		if !ok {
@@ -376,7 +378,9 @@ func optimizeXObjectResourcesDict(ctx *Context, rDict Dict, pageNumber, pageObjN
 	pageImages := pageImages(ctx, pageNumber)
 
 	// Iterate over XObject resource dict.
-	for rName, v := range rDict {
+	for _, rName := range rDict.sortedKeys() {
+
+		v := rDict[rName]
 
 		indRef, ok := v.(IndirectRef)
 		if !ok {
@@ -1074,12 +1078,37 @@ func OptimizeXRefTable(ctx *Context) error {
 
 	log.Optimize.Println("optimizeXRefTable begin")
 
+	if err := ctx.LoadObjects(); err != nil {
+		return err
+	}
+
+	// Get rid of unused resources before processing fonts and images.
+	if ctx.RemoveUnusedResources {
+		if err := removeUnusedResources(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Downsample and re-encode images before getting rid of duplicates.
+	if ctx.OptimizeImages {
+		if err := optimizeImages(ctx); err != nil {
+			return err
+		}
+	}
+
 	// Get rid of duplicate embedded fonts and images.
 	err := optimizeFontAndImages(ctx)
 	if err != nil {
 		return err
 	}
 
+	// Re-encode streams using the best Flate compression.
+	if ctx.Recompress {
+		if err = recompressStreams(ctx); err != nil {
+			return err
+		}
+	}
+
 	// Calculate memory usage of binary content for stats.
 	err = calcBinarySizes(ctx)
 	if err != nil {
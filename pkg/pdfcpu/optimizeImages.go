@@ -0,0 +1,555 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/content"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// imageExtent is the largest size in user space units an image gets rendered with.
+type imageExtent struct {
+	w, h float64
+}
+
+func (e *imageExtent) update(m matrix) {
+	e.w = math.Max(e.w, math.Hypot(m[0][0], m[0][1]))
+	e.h = math.Max(e.h, math.Hypot(m[1][0], m[1][1]))
+}
+
+// imageScanner collects the extents of all images drawn by content streams.
+type imageScanner struct {
+	xRefTable *XRefTable
+	extents   map[int]*imageExtent
+	forms     IntSet // Form XObjects currently being scanned.
+}
+
+func (s *imageScanner) doXObject(resources Dict, name string, ctm matrix) error {
+
+	d, err := s.xRefTable.DereferenceDict(resources["XObject"])
+	if err != nil || d == nil {
+		return err
+	}
+
+	ir, ok := d[name].(IndirectRef)
+	if !ok {
+		return nil
+	}
+	objNr := ir.ObjectNumber.Value()
+
+	sd, err := s.xRefTable.DereferenceStreamDict(ir)
+	if err != nil || sd == nil {
+		return err
+	}
+
+	if st := sd.Subtype(); st != nil && *st == "Image" {
+		e, ok := s.extents[objNr]
+		if !ok {
+			e = &imageExtent{}
+			s.extents[objNr] = e
+		}
+		e.update(ctm)
+		return nil
+	}
+
+	if st := sd.Subtype(); st == nil || *st != "Form" || s.forms[objNr] {
+		return nil
+	}
+
+	m := identMatrix
+	if a := sd.ArrayEntry("Matrix"); len(a) == 6 {
+		for i, o := range a {
+			f, err := s.xRefTable.DereferenceNumber(o)
+			if err != nil {
+				return err
+			}
+			m[i/2][i%2] = f
+		}
+	}
+
+	formResources, err := s.xRefTable.DereferenceDict(sd.Dict["Resources"])
+	if err != nil {
+		return err
+	}
+	if formResources == nil {
+		formResources = resources
+	}
+
+	if err = decodeStream(sd); err != nil {
+		log.Info.Printf("imageScanner: skipping form obj#%d: %v\n", objNr, err)
+		return nil
+	}
+
+	s.forms[objNr] = true
+	defer delete(s.forms, objNr)
+
+	return s.scan(sd.Content, formResources, m.multiply(ctm))
+}
+
+func (s *imageScanner) keepResolution(resources Dict) error {
+
+	d, err := s.xRefTable.DereferenceDict(resources["XObject"])
+	if err != nil || d == nil {
+		return err
+	}
+
+	inf := math.Inf(1)
+	for name := range d {
+		if err = s.doXObject(resources, name, matrix{{inf, 0, 0}, {0, inf, 0}, {0, 0, 1}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *imageScanner) scan(b []byte, resources Dict, ctm matrix) error {
+
+	ops, err := content.Parse(b)
+	if err != nil {
+		log.Info.Printf("imageScanner: skipping content: %v\n", err)
+		// Images available to unparsable content keep their resolution.
+		return s.keepResolution(resources)
+	}
+
+	var stack []matrix
+
+	for _, op := range ops {
+
+		switch op.Operator {
+
+		case "q":
+			stack = append(stack, ctm)
+
+		case "Q":
+			if len(stack) > 0 {
+				ctm, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+
+		case "cm":
+			f, ok := content.Numbers(op.Operands)
+			if !ok || len(f) != 6 {
+				continue
+			}
+			m := identMatrix
+			for i := range f {
+				m[i/2][i%2] = f[i]
+			}
+			ctm = m.multiply(ctm)
+
+		case "Do":
+			if len(op.Operands) != 1 {
+				continue
+			}
+			if name, ok := op.Operands[0].(content.Name); ok {
+				if err = s.doXObject(resources, string(name), ctm); err != nil {
+					return err
+				}
+			}
+
+		}
+	}
+
+	return nil
+}
+
+// imageExtents returns the largest extent in user space units for each image used on a page.
+func imageExtents(ctx *Context) (map[int]*imageExtent, error) {
+
+	ir, err := ctx.Pages()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := ctx.DereferenceDict(*ir)
+	if err != nil {
+		return nil, err
+	}
+
+	pageCount := root.IntEntry("Count")
+	if pageCount == nil {
+		return nil, errors.New("pdfcpu: imageExtents: missing \"Count\" in page root dict")
+	}
+
+	s := &imageScanner{xRefTable: ctx.XRefTable, extents: map[int]*imageExtent{}, forms: IntSet{}}
+
+	for i := 1; i <= *pageCount; i++ {
+
+		d, inhPAttrs, err := ctx.PageDict(i)
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			continue
+		}
+
+		b, err := ctx.PageContent(d)
+		if err != nil {
+			log.Info.Printf("imageExtents: skipping page %d: %v\n", i, err)
+			continue
+		}
+
+		if err = s.scan(b, inhPAttrs.resources, identMatrix); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.extents, nil
+}
+
+// imageColorComponents returns the number of color components for supported image color spaces.
+func imageColorComponents(xRefTable *XRefTable, o Object) (int, error) {
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil || o == nil {
+		return 0, err
+	}
+
+	switch cs := o.(type) {
+
+	case Name:
+		switch cs {
+		case DeviceGrayCS:
+			return 1, nil
+		case DeviceRGBCS:
+			return 3, nil
+		}
+
+	case Array:
+		if len(cs) != 2 {
+			return 0, nil
+		}
+		if n, ok := cs[0].(Name); !ok || n != ICCBasedCS {
+			return 0, nil
+		}
+		sd, err := xRefTable.DereferenceStreamDict(cs[1])
+		if err != nil || sd == nil {
+			return 0, err
+		}
+		if n := sd.IntEntry("N"); n != nil && (*n == 1 || *n == 3) {
+			return *n, nil
+		}
+
+	}
+
+	return 0, nil
+}
+
+// optimizableImage returns the number of color components of an 8 bit RGB or gray image
+// that may be resampled and re-encoded.
+func optimizableImage(xRefTable *XRefTable, sd *StreamDict) (int, error) {
+
+	if im := sd.BooleanEntry("ImageMask"); im != nil && *im {
+		return 0, nil
+	}
+
+	if bpc := sd.IntEntry("BitsPerComponent"); bpc == nil || *bpc != 8 {
+		return 0, nil
+	}
+
+	// Resampled or lossy compressed pixels break color key masking.
+	mask, err := xRefTable.Dereference(sd.Dict["Mask"])
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := mask.(Array); ok {
+		return 0, nil
+	}
+
+	for _, f := range sd.FilterPipeline {
+		if !recompressibleFilters[f.Name] && f.Name != filter.DCT {
+			return 0, nil
+		}
+	}
+
+	return imageColorComponents(xRefTable, sd.Dict["ColorSpace"])
+}
+
+// grayImage returns the samples of a gray RGB image as single component samples.
+func grayImage(p []byte) []byte {
+
+	q := make([]byte, len(p)/3)
+
+	for i, j := 0, 0; i < len(p); i, j = i+3, j+1 {
+		if p[i] != p[i+1] || p[i] != p[i+2] {
+			return nil
+		}
+		q[j] = p[i]
+	}
+
+	return q
+}
+
+// downsample resamples a w x h image with n color components to nw x nh by averaging.
+func downsample(p []byte, w, h, n, nw, nh int) []byte {
+
+	q := make([]byte, nw*nh*n)
+	sum := make([]int, n)
+
+	for y := 0; y < nh; y++ {
+		y0, y1 := y*h/nh, (y+1)*h/nh
+		for x := 0; x < nw; x++ {
+			x0, x1 := x*w/nw, (x+1)*w/nw
+			for c := range sum {
+				sum[c] = 0
+			}
+			for sy := y0; sy < y1; sy++ {
+				for i := (sy*w + x0) * n; i < (sy*w+x1)*n; i += n {
+					for c := range sum {
+						sum[c] += int(p[i+c])
+					}
+				}
+			}
+			cnt := (y1 - y0) * (x1 - x0)
+			for c := range sum {
+				q[(y*nw+x)*n+c] = byte((sum[c] + cnt/2) / cnt)
+			}
+		}
+	}
+
+	return q
+}
+
+// imageResult is the outcome of optimizing an image.
+type imageResult struct {
+	raw           []byte
+	fpl           []PDFFilter
+	width, height int
+	gray          bool
+}
+
+func encodeDCT(p []byte, w, h, quality int) ([]byte, error) {
+
+	f, err := filter.NewFilter(filter.DCT, map[string]int{"Columns": w, "Rows": h, "Quality": quality})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = f.Encode(bytes.NewReader(p), &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// optimizeImage downsamples the image sd to fit dpi for extent e, converts gray RGB images to DeviceGray and re-encodes the result.
+// Returns nil if this does not save any space.
+func optimizeImage(ctx *Context, sd StreamDict, n int, e *imageExtent) (*imageResult, error) {
+
+	w, h := sd.IntEntry("Width"), sd.IntEntry("Height")
+	if w == nil || h == nil || *w <= 0 || *h <= 0 {
+		return nil, nil
+	}
+
+	sd.Content = nil
+	if err := decodeStream(&sd); err != nil {
+		return nil, err
+	}
+
+	p := sd.Content
+	if len(p) < *w**h*n {
+		return nil, errors.Errorf("pdfcpu: optimizeImage: corrupt image, want %d bytes, got %d", *w**h*n, len(p))
+	}
+	p = p[:*w**h*n]
+
+	res := &imageResult{width: *w, height: *h}
+
+	// Gray conversion needs an unmodified Decode array.
+	if n == 3 && sd.ArrayEntry("Decode") == nil {
+		if cs, ok := sd.Find("ColorSpace"); ok && cs == Name(DeviceRGBCS) {
+			if q := grayImage(p); q != nil {
+				p, n, res.gray = q, 1, true
+			}
+		}
+	}
+
+	if e != nil && ctx.ImageDPI > 0 {
+		// The number of pixels needed to render the image at ImageDPI.
+		s := math.Max(e.w/72*float64(ctx.ImageDPI)/float64(*w), e.h/72*float64(ctx.ImageDPI)/float64(*h))
+		if s < 1 {
+			nw := int(math.Max(1, math.Round(float64(*w)*s)))
+			nh := int(math.Max(1, math.Round(float64(*h)*s)))
+			p = downsample(p, *w, *h, n, nw, nh)
+			res.width, res.height = nw, nh
+		}
+	}
+
+	// JPEG images stay JPEG images.
+	dct := ctx.JPEGQuality > 0
+	for _, f := range sd.FilterPipeline {
+		if f.Name == filter.DCT {
+			dct = true
+		}
+	}
+
+	var err error
+
+	if dct {
+		quality := ctx.JPEGQuality
+		if quality == 0 {
+			quality = 75
+		}
+		res.raw, err = encodeDCT(p, res.width, res.height, quality)
+		res.fpl = []PDFFilter{{Name: filter.DCT}}
+	} else {
+		res.raw, err = encodeFlate(p, nil)
+		res.fpl = []PDFFilter{{Name: filter.Flate}}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := sd.rawLength()
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(res.raw)) >= l {
+		return nil, nil
+	}
+
+	return res, nil
+}
+
+func (res *imageResult) apply(sd *StreamDict) {
+
+	setFilterPipeline(sd, res.fpl)
+
+	sd.Raw, sd.source = res.raw, nil
+	sd.Content = nil
+	streamLength := int64(len(sd.Raw))
+	sd.StreamLength = &streamLength
+	sd.StreamLengthObjNr = nil
+	sd.Update("Length", Integer(streamLength))
+
+	sd.Update("Width", Integer(res.width))
+	sd.Update("Height", Integer(res.height))
+
+	if res.gray {
+		sd.Update("ColorSpace", Name(DeviceGrayCS))
+	}
+}
+
+// imageKey identifies images with identical content, see handleDuplicateImageObject.
+func imageKey(sd *StreamDict) (string, error) {
+
+	h := sha256.New()
+	if _, err := sd.copyRaw(h); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x %v %v %v %s", h.Sum(nil), sd.Dict["Width"], sd.Dict["Height"], sd.Dict["ColorSpace"], pipelineName(sd.FilterPipeline)), nil
+}
+
+// optimizeImages downsamples images exceeding ImageDPI on any page, optionally re-encodes images as JPEG
+// and converts RGB images using gray colors only to DeviceGray.
+// Images with identical content are processed once for the largest extent so duplicates stay duplicates.
+func optimizeImages(ctx *Context) error {
+
+	log.Optimize.Println("optimizeImages begin")
+
+	extents, err := imageExtents(ctx)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string][]int{}
+	var keys []string
+
+	var objNrs []int
+	for objNr, entry := range ctx.Table {
+		if entry.Free || entry.Compressed {
+			continue
+		}
+		if sd, ok := entry.Object.(StreamDict); ok && sd.Subtype() != nil && *sd.Subtype() == "Image" {
+			objNrs = append(objNrs, objNr)
+		}
+	}
+	sort.Ints(objNrs)
+
+	for _, objNr := range objNrs {
+		sd := ctx.Table[objNr].Object.(StreamDict)
+		k, err := imageKey(&sd)
+		if err != nil {
+			return err
+		}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], objNr)
+	}
+
+	for _, k := range keys {
+
+		objNrs := groups[k]
+		sd := ctx.Table[objNrs[0]].Object.(StreamDict)
+
+		n, err := optimizableImage(ctx.XRefTable, &sd)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+
+		// Images not placed on any page keep their resolution.
+		var e *imageExtent
+		for _, objNr := range objNrs {
+			if e1, ok := extents[objNr]; ok {
+				if e == nil {
+					e = &imageExtent{}
+				}
+				e.w, e.h = math.Max(e.w, e1.w), math.Max(e.h, e1.h)
+			}
+		}
+
+		res, err := optimizeImage(ctx, sd, n, e)
+		if err != nil {
+			log.Info.Printf("optimizeImages: skipping obj#%d: %v\n", objNrs[0], err)
+			continue
+		}
+		if res == nil {
+			continue
+		}
+
+		for _, objNr := range objNrs {
+			entry := ctx.Table[objNr]
+			sd := entry.Object.(StreamDict)
+			l, err := sd.rawLength()
+			if err != nil {
+				return err
+			}
+			ctx.Optimize.ImageSavings.Streams++
+			ctx.Optimize.ImageSavings.Saved += l - int64(len(res.raw))
+			res.apply(&sd)
+			entry.Object = sd
+		}
+	}
+
+	log.Optimize.Println("optimizeImages end")
+
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownsample(t *testing.T) {
+
+	// 4x2 RGB
+	p := []byte{
+		0, 0, 0, 10, 10, 10, 100, 0, 0, 200, 0, 0,
+		20, 20, 20, 30, 30, 30, 0, 100, 0, 0, 200, 0,
+	}
+
+	got := downsample(p, 4, 2, 3, 2, 1)
+	want := []byte{15, 15, 15, 75, 75, 0}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("want:%v got:%v", want, got)
+	}
+
+	if q := grayImage(p[:6]); !bytes.Equal(q, []byte{0, 10}) {
+		t.Fatalf("grayImage: got:%v", q)
+	}
+
+	if q := grayImage(p); q != nil {
+		t.Fatal("grayImage: color image reported as gray")
+	}
+}
+
+func TestOptimizeImages(t *testing.T) {
+
+	f, err := os.Open(filepath.Join("..", "testdata", "testImage.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, err := Read(f, NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ctx.LoadObjects(); err != nil {
+		t.Fatal(err)
+	}
+
+	extents, err := imageExtents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extents) == 0 {
+		t.Fatal("no images found")
+	}
+
+	// Register a copy of an image drawn on page 1 as unused duplicate.
+	_, inhPAttrs, err := ctx.PageDict(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xo, err := ctx.DereferenceDict(inhPAttrs.resources["XObject"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range xo.sortedKeys() {
+		ir := xo[k].(IndirectRef)
+		if _, ok := extents[ir.ObjectNumber.Value()]; !ok {
+			continue
+		}
+		sd := ctx.Table[ir.ObjectNumber.Value()].Object.(StreamDict)
+		d := NewDict()
+		for k, v := range sd.Dict {
+			d[k] = v
+		}
+		sd.Dict = d
+		dup, err := ctx.IndRefForNewObject(sd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xo.Insert("ImDup", *dup)
+		break
+	}
+
+	ctx.OptimizeImages = true
+	ctx.ImageDPI = 72
+	ctx.JPEGQuality = 60
+
+	if err = OptimizeXRefTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if ctx.Optimize.ImageSavings.Streams == 0 {
+		t.Fatal("no image optimized")
+	}
+
+	if len(ctx.Optimize.DuplicateImages) != 1 {
+		t.Fatalf("duplicate images: want:1 got:%d", len(ctx.Optimize.DuplicateImages))
+	}
+
+	for objNr, e := range extents {
+
+		sd := ctx.Table[objNr].Object.(StreamDict)
+		if len(sd.FilterPipeline) == 0 || sd.FilterPipeline[0].Name != "DCTDecode" {
+			continue
+		}
+
+		// At 72 dpi one pixel per user space unit.
+		w, h := *sd.IntEntry("Width"), *sd.IntEntry("Height")
+		if w > int(math.Ceil(e.w))+1 || h > int(math.Ceil(e.h))+1 {
+			t.Fatalf("obj#%d: %dx%d exceeds %.0fx%.0f", objNr, w, h, e.w, e.h)
+		}
+
+		b, err := decodedContent(sd)
+		if err != nil {
+			t.Fatalf("obj#%d: %v", objNr, err)
+		}
+		if len(b) != w*h*3 && len(b) != w*h {
+			t.Fatalf("obj#%d: unexpected decoded length %d for %dx%d", objNr, len(b), w, h)
+		}
+	}
+}
@@ -0,0 +1,853 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+// Functions dealing with PKCS#7 (CMS, RFC 5652) structures.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidAES128CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC    = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+
+	oidSignedData     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidTimeStampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidSigningCertV2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+var errNotRecipient = errors.New("pdfcpu: pkcs7: not a recipient")
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional"` // [0] IMPLICIT
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RecipientIdentifier    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// identifies returns true if the recipient or signer identifier rid identifies cert.
+func identifies(rid asn1.RawValue, cert *x509.Certificate) bool {
+
+	if rid.Class == asn1.ClassContextSpecific && rid.Tag == 0 {
+		// subjectKeyIdentifier
+		return len(cert.SubjectKeyId) > 0 && bytes.Equal(rid.Bytes, cert.SubjectKeyId)
+	}
+
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(rid.FullBytes, &ias); err != nil {
+		return false
+	}
+
+	return bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) && ias.SerialNumber.Cmp(cert.SerialNumber) == 0
+}
+
+func pkcs7Pad(b []byte, blockSize int) []byte {
+	n := blockSize - len(b)%blockSize
+	return append(b, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func pkcs7Unpad(b []byte, blockSize int) ([]byte, error) {
+	if len(b) == 0 || len(b)%blockSize > 0 {
+		return nil, errors.New("pdfcpu: pkcs7: invalid padding")
+	}
+	n := int(b[len(b)-1])
+	if n == 0 || n > blockSize || n > len(b) {
+		return nil, errors.New("pdfcpu: pkcs7: invalid padding")
+	}
+	return b[:len(b)-n], nil
+}
+
+func contentCipher(alg pkix.AlgorithmIdentifier, key []byte) (cipher.Block, error) {
+
+	switch {
+
+	case alg.Algorithm.Equal(oidAES128CBC), alg.Algorithm.Equal(oidAES192CBC), alg.Algorithm.Equal(oidAES256CBC):
+		return aes.NewCipher(key)
+
+	case alg.Algorithm.Equal(oidDESEDE3CBC):
+		return des.NewTripleDESCipher(key)
+
+	}
+
+	return nil, errors.Errorf("pdfcpu: pkcs7: unsupported content encryption algorithm %s", alg.Algorithm)
+}
+
+// envelope encrypts content for certs and returns the DER encoded CMS EnvelopedData.
+// The content is encrypted with AES-256 and the content encryption key is transported using RSA.
+func envelope(content []byte, certs []*x509.Certificate) ([]byte, error) {
+
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	cb, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := pkcs7Pad(append([]byte(nil), content...), aes.BlockSize)
+	cipher.NewCBCEncrypter(cb, iv).CryptBlocks(ciphertext, ciphertext)
+
+	params, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	ed := envelopedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType: oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidAES256CBC,
+				Parameters: asn1.RawValue{FullBytes: params},
+			},
+			EncryptedContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: ciphertext},
+		},
+	}
+
+	for _, cert := range certs {
+
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("pdfcpu: pkcs7: unsupported public key for %s, need RSA", cert.Subject)
+		}
+
+		ek, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, err
+		}
+
+		rid, err := asn1.Marshal(issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: cert.SerialNumber,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ri := keyTransRecipientInfo{
+			RecipientIdentifier: asn1.RawValue{FullBytes: rid},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidRSAEncryption,
+				Parameters: asn1.NullRawValue,
+			},
+			EncryptedKey: ek,
+		}
+
+		b, err := asn1.Marshal(ri)
+		if err != nil {
+			return nil, err
+		}
+
+		ed.RecipientInfos = append(ed.RecipientInfos, asn1.RawValue{FullBytes: b})
+	}
+
+	b, err := asn1.Marshal(ed)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+// openEnvelope decrypts the DER encoded CMS EnvelopedData b using key.
+// If cert is not nil only the recipient info identifying cert is taken into account.
+func openEnvelope(b []byte, cert *x509.Certificate, key crypto.PrivateKey) ([]byte, error) {
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(b, &ci); err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid content info")
+	}
+
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, errors.Errorf("pdfcpu: pkcs7: unexpected content type %s", ci.ContentType)
+	}
+
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid enveloped data")
+	}
+
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("pdfcpu: pkcs7: unsupported private key, need RSA")
+	}
+
+	var cek []byte
+
+	for _, rv := range ed.RecipientInfos {
+
+		// Only key transport is supported.
+		if rv.Class != asn1.ClassUniversal || rv.Tag != asn1.TagSequence {
+			continue
+		}
+
+		var ri keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(rv.FullBytes, &ri); err != nil {
+			continue
+		}
+
+		if !ri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAEncryption) {
+			continue
+		}
+
+		if cert != nil && !identifies(ri.RecipientIdentifier, cert) {
+			continue
+		}
+
+		k, err := rsa.DecryptPKCS1v15(nil, priv, ri.EncryptedKey)
+		if err == nil {
+			cek = k
+			break
+		}
+	}
+
+	if cek == nil {
+		return nil, errNotRecipient
+	}
+
+	eci := ed.EncryptedContentInfo
+
+	cb, err := contentCipher(eci.ContentEncryptionAlgorithm, cek)
+	if err != nil {
+		return nil, err
+	}
+
+	var iv []byte
+	if _, err = asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil || len(iv) != cb.BlockSize() {
+		return nil, errors.New("pdfcpu: pkcs7: invalid initialization vector")
+	}
+
+	ciphertext := eci.EncryptedContent.Bytes
+	if eci.EncryptedContent.IsCompound {
+		// Constructed octet string.
+		ciphertext = nil
+		for rest := eci.EncryptedContent.Bytes; len(rest) > 0; {
+			var seg []byte
+			if rest, err = asn1.Unmarshal(rest, &seg); err != nil {
+				return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid encrypted content")
+			}
+			ciphertext = append(ciphertext, seg...)
+		}
+	}
+
+	if len(ciphertext) == 0 || len(ciphertext)%cb.BlockSize() > 0 {
+		return nil, errors.New("pdfcpu: pkcs7: invalid encrypted content")
+	}
+
+	content := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(cb, iv).CryptBlocks(content, ciphertext)
+
+	return pkcs7Unpad(content, cb.BlockSize())
+}
+
+// rawContent captures an optional implicitly tagged element.
+type rawContent struct {
+	Raw asn1.RawContent
+}
+
+// bytes returns the contents octets of rc.
+func (rc rawContent) bytes() ([]byte, error) {
+	var rv asn1.RawValue
+	if _, err := asn1.Unmarshal(rc.Raw, &rv); err != nil {
+		return nil, err
+	}
+	return rv.Bytes, nil
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     rawContent   `asn1:"optional,tag:0"`
+	CRLs             rawContent   `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SignerIdentifier   asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        rawContent `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      rawContent `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// cmsSignature is the result of verifying the signature of a CMS SignedData structure.
+type cmsSignature struct {
+	Signer      *x509.Certificate   // The signer's certificate.
+	Certs       []*x509.Certificate // All certificates included.
+	SigningTime *time.Time          // The signing time attribute.
+	Timestamp   *time.Time          // The time of an embedded signature timestamp token.
+	TSA         *cmsSignature       // The signature of the timestamp token, still to be trusted.
+	EContent    []byte              // The encapsulated content for non detached signatures.
+}
+
+func hashFor(alg asn1.ObjectIdentifier) (crypto.Hash, error) {
+
+	switch {
+
+	case alg.Equal(oidSHA1), alg.Equal(oidSHA1WithRSA), alg.Equal(oidECDSAWithSHA1):
+		return crypto.SHA1, nil
+
+	case alg.Equal(oidSHA256), alg.Equal(oidSHA256WithRSA), alg.Equal(oidECDSAWithSHA256):
+		return crypto.SHA256, nil
+
+	case alg.Equal(oidSHA384), alg.Equal(oidSHA384WithRSA), alg.Equal(oidECDSAWithSHA384):
+		return crypto.SHA384, nil
+
+	case alg.Equal(oidSHA512), alg.Equal(oidSHA512WithRSA), alg.Equal(oidECDSAWithSHA512):
+		return crypto.SHA512, nil
+
+	}
+
+	return 0, errors.Errorf("pdfcpu: pkcs7: unsupported digest algorithm %s", alg)
+}
+
+// octets returns the value of a possibly constructed octet string.
+func octets(b []byte) ([]byte, error) {
+
+	var rv asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &rv); err != nil {
+		return nil, err
+	}
+
+	if !rv.IsCompound {
+		return rv.Bytes, nil
+	}
+
+	var bb []byte
+	for rest := rv.Bytes; len(rest) > 0; {
+		var seg []byte
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &seg); err != nil {
+			return nil, err
+		}
+		bb = append(bb, seg...)
+	}
+
+	return bb, nil
+}
+
+func verifyRawSignature(pub crypto.PublicKey, h crypto.Hash, digest, sig []byte) error {
+
+	switch pub := pub.(type) {
+
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, h, digest, sig)
+
+	case *ecdsa.PublicKey:
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+			return err
+		}
+		if !ecdsa.Verify(pub, digest, rs.R, rs.S) {
+			return errors.New("ecdsa verification failure")
+		}
+		return nil
+
+	}
+
+	return errors.New("unsupported public key algorithm")
+}
+
+func parseAttributes(rc rawContent) ([]attribute, error) {
+
+	if len(rc.Raw) == 0 {
+		return nil, nil
+	}
+
+	// Replace the implicit tag by the SET OF tag.
+	b := append([]byte{0x31}, rc.Raw[1:]...)
+
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(b, &attrs, "set"); err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
+
+func attributeValue(attrs []attribute, oid asn1.ObjectIdentifier) *asn1.RawValue {
+	for _, a := range attrs {
+		if a.Type.Equal(oid) && len(a.Values) > 0 {
+			return &a.Values[0]
+		}
+	}
+	return nil
+}
+
+// verifySignedData verifies the CMS SignedData structure b.
+// The signed content is read from detached if present, which rules out any encapsulated content.
+func verifySignedData(b []byte, detached io.Reader) (*cmsSignature, error) {
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(b, &ci); err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid content info")
+	}
+
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.Errorf("pdfcpu: pkcs7: unexpected content type %s", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid signed data")
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, errors.Errorf("pdfcpu: pkcs7: expected 1 signer, got %d", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+
+	cs := &cmsSignature{}
+
+	if len(sd.Certificates.Raw) > 0 {
+		b, err := sd.Certificates.bytes()
+		if err != nil {
+			return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid certificates")
+		}
+		if cs.Certs, err = x509.ParseCertificates(b); err != nil {
+			return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid certificates")
+		}
+	}
+
+	for _, c := range cs.Certs {
+		if identifies(si.SignerIdentifier, c) {
+			cs.Signer = c
+			break
+		}
+	}
+
+	if cs.Signer == nil {
+		return nil, errors.New("pdfcpu: pkcs7: missing signer certificate")
+	}
+
+	h, err := hashFor(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sd.EncapContentInfo.EContent.FullBytes) > 0 {
+		if cs.EContent, err = octets(sd.EncapContentInfo.EContent.Bytes); err != nil {
+			return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid encapsulated content")
+		}
+	}
+
+	// Digest the content.
+	hc := h.New()
+	switch {
+
+	case detached != nil:
+		// The signature must not cover anything but the detached content.
+		if len(cs.EContent) > 0 {
+			return nil, errors.New("pdfcpu: pkcs7: unexpected encapsulated content for detached signature")
+		}
+		if _, err := io.Copy(hc, detached); err != nil {
+			return nil, err
+		}
+
+	case len(cs.EContent) > 0:
+		hc.Write(cs.EContent)
+
+	default:
+		return nil, errors.New("pdfcpu: pkcs7: missing content")
+	}
+	digest := hc.Sum(nil)
+
+	attrs, err := parseAttributes(si.SignedAttrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid signed attributes")
+	}
+
+	if attrs != nil {
+
+		v := attributeValue(attrs, oidMessageDigest)
+		if v == nil {
+			return nil, errors.New("pdfcpu: pkcs7: missing message digest attribute")
+		}
+
+		var md []byte
+		if _, err := asn1.Unmarshal(v.FullBytes, &md); err != nil || !bytes.Equal(md, digest) {
+			return nil, errors.New("pdfcpu: pkcs7: message digest mismatch")
+		}
+
+		if v := attributeValue(attrs, oidSigningTime); v != nil {
+			var t time.Time
+			if _, err := asn1.Unmarshal(v.FullBytes, &t); err == nil {
+				cs.SigningTime = &t
+			}
+		}
+
+		// The signature is calculated over the DER encoded signed attributes.
+		hc = h.New()
+		hc.Write([]byte{0x31})
+		hc.Write(si.SignedAttrs.Raw[1:])
+		digest = hc.Sum(nil)
+	}
+
+	if err = verifyRawSignature(cs.Signer.PublicKey, h, digest, si.Signature); err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: pkcs7: invalid signature")
+	}
+
+	// A signature timestamp token covers the signature value.
+	if attrs, err = parseAttributes(si.UnsignedAttrs); err == nil {
+		if v := attributeValue(attrs, oidTimeStampToken); v != nil {
+			if tsa, err := verifyTimestampToken(v.FullBytes, si.Signature); err == nil {
+				cs.Timestamp, cs.TSA = tsa.Timestamp, tsa
+			}
+		}
+	}
+
+	return cs, nil
+}
+
+// verifyTimestampToken verifies the signature of the RFC 3161 timestamp token b for data.
+// The certificate chain of the timestamp authority is left to the caller.
+func verifyTimestampToken(b []byte, data []byte) (*cmsSignature, error) {
+
+	cs, err := verifySignedData(b, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := checkTSTInfo(cs.EContent, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	cs.Timestamp = &t
+
+	return cs, nil
+}
+
+// checkTSTInfo checks if the message imprint of the timestamp info b matches data and returns the timestamp.
+func checkTSTInfo(b []byte, data io.Reader) (time.Time, error) {
+
+	var tst tstInfo
+	if _, err := asn1.Unmarshal(b, &tst); err != nil {
+		return time.Time{}, errors.Wrap(err, "pdfcpu: pkcs7: invalid timestamp info")
+	}
+
+	h, err := hashFor(tst.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	hc := h.New()
+	if _, err = io.Copy(hc, data); err != nil {
+		return time.Time{}, err
+	}
+
+	if !bytes.Equal(hc.Sum(nil), tst.MessageImprint.HashedMessage) {
+		return time.Time{}, errors.New("pdfcpu: pkcs7: timestamp message imprint mismatch")
+	}
+
+	return tst.GenTime, nil
+}
+
+// essCertIDv2 identifies a signing certificate by its SHA-256 hash (RFC 5035).
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// signOptions control the creation of a CMS SignedData structure.
+type signOptions struct {
+	EContentType asn1.ObjectIdentifier            // Encapsulate content of this type, nil for a detached signature.
+	SigningTime  *time.Time                       // Add a signing time attribute.
+	CAdES        bool                             // Add a signing certificate v2 attribute as required by CAdES.
+	Timestamp    func(sig []byte) ([]byte, error) // Returns a timestamp token for the signature value.
+}
+
+// encodeAttributes returns the DER encoded SET OF attrs using the implicit tag.
+func encodeAttributes(attrs []attribute, tag int) ([]byte, error) {
+
+	bb := make([][]byte, len(attrs))
+	for i, a := range attrs {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		bb[i] = b
+	}
+
+	// DER requires the elements of a SET OF to be sorted by their encodings.
+	sort.Slice(bb, func(i, j int) bool { return bytes.Compare(bb[i], bb[j]) < 0 })
+
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: bytes.Join(bb, nil)})
+}
+
+func newAttribute(oid asn1.ObjectIdentifier, v interface{}) (attribute, error) {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return attribute{}, err
+	}
+	return attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: b}}}, nil
+}
+
+func signatureAlgorithm(key crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+
+	switch key.Public().(type) {
+
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+
+	}
+
+	return pkix.AlgorithmIdentifier{}, errors.New("pdfcpu: pkcs7: unsupported private key, need RSA or ECDSA")
+}
+
+// signData signs content with key using SHA-256 and returns the DER encoded CMS SignedData.
+// cert is the signer's certificate, chain holds additional certificates to be included.
+func signData(content []byte, cert *x509.Certificate, chain []*x509.Certificate, key crypto.Signer, opts signOptions) ([]byte, error) {
+
+	sigAlg, err := signatureAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+
+	eContentType := oidData
+	if opts.EContentType != nil {
+		eContentType = opts.EContentType
+	}
+
+	digest := sha256.Sum256(content)
+
+	attrs := make([]attribute, 0, 4)
+
+	for _, v := range []struct {
+		oid asn1.ObjectIdentifier
+		val interface{}
+	}{
+		{oidContentType, eContentType},
+		{oidMessageDigest, digest[:]},
+	} {
+		a, err := newAttribute(v.oid, v.val)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, a)
+	}
+
+	if opts.SigningTime != nil {
+		a, err := newAttribute(oidSigningTime, opts.SigningTime.UTC())
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, a)
+	}
+
+	if opts.CAdES {
+		h := sha256.Sum256(cert.Raw)
+		a, err := newAttribute(oidSigningCertV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: h[:]}}})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, a)
+	}
+
+	signedAttrs, err := encodeAttributes(attrs, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is calculated over the DER encoded SET OF signed attributes.
+	digest = sha256.Sum256(append([]byte{0x31}, signedAttrs[1:]...))
+
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: pkcs7")
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+
+	si := signerInfo{
+		Version:            1,
+		SignerIdentifier:   asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    digestAlg,
+		SignedAttrs:        rawContent{Raw: signedAttrs},
+		SignatureAlgorithm: sigAlg,
+		Signature:          sig,
+	}
+
+	if opts.Timestamp != nil {
+		token, err := opts.Timestamp(sig)
+		if err != nil {
+			return nil, err
+		}
+		a := attribute{Type: oidTimeStampToken, Values: []asn1.RawValue{{FullBytes: token}}}
+		b, err := encodeAttributes([]attribute{a}, 1)
+		if err != nil {
+			return nil, err
+		}
+		si.UnsignedAttrs = rawContent{Raw: b}
+	}
+
+	var certs []byte
+	for _, c := range append([]*x509.Certificate{cert}, chain...) {
+		certs = append(certs, c.Raw...)
+	}
+
+	rawCerts, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs})
+	if err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		EncapContentInfo: encapContentInfo{EContentType: eContentType},
+		Certificates:     rawContent{Raw: rawCerts},
+		SignerInfos:      []signerInfo{si},
+	}
+
+	if opts.EContentType != nil {
+		if !eContentType.Equal(oidData) {
+			sd.Version = 3
+		}
+		b, err := asn1.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}); err != nil {
+			return nil, err
+		}
+		sd.EncapContentInfo.EContent = asn1.RawValue{FullBytes: b}
+	}
+
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
@@ -0,0 +1,528 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+// Functions dealing with the public-key security handler (7.6.5).
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"hash"
+	"io/ioutil"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pkcs12"
+)
+
+const (
+	filterPubSec      = "Adobe.PubSec"
+	pubSecCryptFilter = "DefaultCryptFilter"
+	pubSecSeedLength  = 20
+)
+
+// Recipient represents the holder of a certificate a document gets encrypted for.
+type Recipient struct {
+	Cert        *x509.Certificate
+	Permissions int16 // user access permissions, see Table 24
+}
+
+// ReadCertificates returns all certificates of the PEM encoded file fileName.
+func ReadCertificates(fileName string) ([]*x509.Certificate, error) {
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pdfcpu: %s", fileName)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.Errorf("pdfcpu: %s: no certificate found", fileName)
+	}
+
+	return certs, nil
+}
+
+func parsePrivateKey(block *pem.Block, password string) (crypto.PrivateKey, error) {
+
+	b := block.Bytes
+
+	if x509.IsEncryptedPEMBlock(block) {
+		var err error
+		if b, err = x509.DecryptPEMBlock(block, []byte(password)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Don't rely on the block type, PKCS#12 archives yield PKCS#1 keys as "PRIVATE KEY".
+	if key, err := x509.ParsePKCS8PrivateKey(b); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(b); err == nil {
+		return key, nil
+	}
+
+	return x509.ParseECPrivateKey(b)
+}
+
+func publicKeyMatches(cert *x509.Certificate, key crypto.PrivateKey) bool {
+
+	switch k := key.(type) {
+
+	case *rsa.PrivateKey:
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		return ok && pub.N.Cmp(k.N) == 0 && pub.E == k.E
+
+	case *ecdsa.PrivateKey:
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		return ok && pub.X.Cmp(k.X) == 0 && pub.Y.Cmp(k.Y) == 0
+
+	}
+
+	return false
+}
+
+func readKeyPair(fileName, password string) ([]*x509.Certificate, crypto.PrivateKey, error) {
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var blocks []*pem.Block
+
+	if !bytes.Contains(b, []byte("-----BEGIN")) {
+		// PKCS#12
+		if blocks, err = pkcs12.ToPEM(b, password); err != nil {
+			return nil, nil, errors.Wrapf(err, "pdfcpu: %s", fileName)
+		}
+	} else {
+		for {
+			var block *pem.Block
+			if block, b = pem.Decode(b); block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+	}
+
+	var (
+		certs []*x509.Certificate
+		key   crypto.PrivateKey
+	)
+
+	for _, block := range blocks {
+
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "pdfcpu: %s", fileName)
+			}
+			certs = append(certs, cert)
+			continue
+		}
+
+		if key == nil && bytes.HasSuffix([]byte(block.Type), []byte("PRIVATE KEY")) {
+			if key, err = parsePrivateKey(block, password); err != nil {
+				return nil, nil, errors.Wrapf(err, "pdfcpu: %s", fileName)
+			}
+		}
+	}
+
+	if key == nil {
+		return nil, nil, errors.Errorf("pdfcpu: %s: no private key found", fileName)
+	}
+
+	return certs, key, nil
+}
+
+// ReadKeyPair returns the private key and its certificate contained in fileName.
+// fileName is either PEM encoded or a PKCS#12 archive (.p12, .pfx) protected by password.
+func ReadKeyPair(fileName, password string) (*x509.Certificate, crypto.PrivateKey, error) {
+
+	certs, key, err := readKeyPair(fileName, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(certs) == 0 {
+		// The recipient gets identified by trying the key.
+		return nil, key, nil
+	}
+
+	for _, cert := range certs {
+		if publicKeyMatches(cert, key) {
+			return cert, key, nil
+		}
+	}
+
+	return nil, nil, errors.Errorf("pdfcpu: %s: no certificate matching the private key", fileName)
+}
+
+// NewPubSecConfiguration returns a default configuration for AES encryption using the public-key security handler.
+func NewPubSecConfiguration(recipients []Recipient, keyLength int) *Configuration {
+	c := NewAESConfiguration("", "", keyLength)
+	c.Recipients = recipients
+	return c
+}
+
+func pubSecKey(seed []byte, recipients [][]byte, encryptMetadata bool, v, l int) []byte {
+
+	// Algorithm 7.6.5.3 Public-key encryption algorithms
+
+	var h hash.Hash = sha1.New()
+	if v == 5 {
+		h = sha256.New()
+	}
+
+	h.Write(seed)
+
+	for _, r := range recipients {
+		h.Write(r)
+	}
+
+	if !encryptMetadata {
+		h.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+
+	key := h.Sum(nil)
+	if n := l / 8; n < len(key) {
+		key = key[:n]
+	}
+
+	return key
+}
+
+func stringBytes(o Object) ([]byte, error) {
+
+	switch o := o.(type) {
+
+	case StringLiteral:
+		return Unescape(o.Value())
+
+	case HexLiteral:
+		return o.Bytes()
+
+	}
+
+	return nil, errors.New("pdfcpu: expected string literal or hex literal")
+}
+
+// cryptFilterLength returns the key length in bits of crypt filter d.
+func cryptFilterLength(d Dict, defaultLength int) int {
+
+	l := d.IntEntry("Length")
+	if l == nil {
+		return defaultLength
+	}
+
+	// Some writers express the key length in bytes.
+	if *l <= 32 {
+		return *l * 8
+	}
+
+	return *l
+}
+
+// supportedPubSecEncryption returns the used encryption and the recipients taken into account for key calculation.
+func supportedPubSecEncryption(ctx *Context, d Dict) (*Enc, [][]byte, error) {
+
+	// SubFilter
+	sf := d.NameEntry("SubFilter")
+	if sf == nil || *sf != "adbe.pkcs7.s3" && *sf != "adbe.pkcs7.s4" && *sf != "adbe.pkcs7.s5" {
+		return nil, nil, errors.New("pdfcpu: unsupported encryption: \"SubFilter\" must be one of adbe.pkcs7.s3, adbe.pkcs7.s4, adbe.pkcs7.s5")
+	}
+
+	// V
+	v, err := checkV(ctx, d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Length
+	l, err := length(d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The dict holding Recipients and EncryptMetadata.
+	rd := d
+
+	if *v >= 4 {
+
+		stmf := d.NameEntry("StmF")
+		if stmf == nil || *stmf == "Identity" {
+			return nil, nil, errors.New("pdfcpu: unsupported encryption: missing crypt filter for streams")
+		}
+
+		cf := d.DictEntry("CF").DictEntry(*stmf)
+		if cf == nil {
+			return nil, nil, errors.Errorf("pdfcpu: unsupported encryption: entry \"%s\" missing in \"CF\"", *stmf)
+		}
+
+		if *sf == "adbe.pkcs7.s5" {
+			rd = cf
+		}
+
+		l = cryptFilterLength(cf, 128)
+		if *v == 5 {
+			l = 256
+		}
+	}
+
+	a := rd.ArrayEntry("Recipients")
+	if len(a) == 0 {
+		return nil, nil, errors.New("pdfcpu: unsupported encryption: required entry \"Recipients\" missing")
+	}
+
+	var recipients [][]byte
+
+	for _, o := range a {
+
+		o, err = ctx.Dereference(o)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		b, err := stringBytes(o)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "pdfcpu: unsupported encryption: invalid entry \"Recipients\"")
+		}
+
+		recipients = append(recipients, b)
+	}
+
+	// EncryptMetadata
+	encMeta := true
+	if emd := rd.BooleanEntry("EncryptMetadata"); emd != nil {
+		encMeta = *emd
+	}
+
+	// There is no R for public-key security handlers.
+	// R reflects the standard security handler revision using the same algorithms for object keys and permissions.
+	r := 4
+	if *v == 5 {
+		r = 6
+	} else if *v < 4 {
+		r = 3
+	}
+
+	return &Enc{L: l, R: r, V: *v, Emd: encMeta}, recipients, nil
+}
+
+func setupPubSecEncryptionKey(ctx *Context, d Dict) (err error) {
+
+	if ctx.DecryptKey == nil {
+		return errors.New("pdfcpu: please provide your certificate and private key with -cert")
+	}
+
+	var recipients [][]byte
+
+	ctx.E, recipients, err = supportedPubSecEncryption(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+
+	for _, r := range recipients {
+		if b, err = openEnvelope(r, ctx.DecryptCert, ctx.DecryptKey); err != errNotRecipient {
+			break
+		}
+	}
+
+	if err == errNotRecipient {
+		return errors.New("pdfcpu: the supplied certificate is not a recipient of this document")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(b) != pubSecSeedLength+4 {
+		return errors.New("pdfcpu: unsupported encryption: invalid recipient data")
+	}
+
+	ctx.E.P = int(int32(binary.BigEndian.Uint32(b[pubSecSeedLength:])))
+	ctx.EncKey = pubSecKey(b[:pubSecSeedLength], recipients, ctx.E.Emd, ctx.E.V, ctx.E.L)
+
+	// Double check minimum permissions for pdfcpu processing.
+	if !hasNeededPermissions(ctx.Cmd, ctx.E) {
+		return errors.New("pdfcpu: insufficient access permissions")
+	}
+
+	return nil
+}
+
+// newPubSecEncryptDict creates a new EncryptDict using the public-key security handler.
+func newPubSecEncryptDict(needAES bool, keyLength int, recipients [][]byte) Dict {
+
+	d := NewDict()
+
+	d.Insert("Filter", Name(filterPubSec))
+	d.Insert("SubFilter", Name("adbe.pkcs7.s5"))
+
+	v := 4
+	if keyLength == 256 {
+		v = 5
+	}
+	d.Insert("V", Integer(v))
+	d.Insert("Length", Integer(keyLength))
+
+	d.Insert("StmF", Name(pubSecCryptFilter))
+	d.Insert("StrF", Name(pubSecCryptFilter))
+
+	d1 := NewDict()
+	d1.Insert("AuthEvent", Name("DocOpen"))
+
+	if needAES {
+		n := "AESV2"
+		if keyLength == 256 {
+			n = "AESV3"
+		}
+		d1.Insert("CFM", Name(n))
+	} else {
+		d1.Insert("CFM", Name("V2"))
+	}
+
+	// Public-key security handlers express the key length in bits.
+	d1.Insert("Length", Integer(keyLength))
+
+	a := Array{}
+	for _, r := range recipients {
+		a = append(a, NewHexLiteral(r))
+	}
+	d1.Insert("Recipients", a)
+	d1.Insert("EncryptMetadata", Boolean(true))
+
+	d2 := NewDict()
+	d2.Insert(pubSecCryptFilter, d1)
+
+	d.Insert("CF", d2)
+
+	return d
+}
+
+// recipientData returns one PKCS#7 enveloped seed for each distinct set of permissions in rr.
+func recipientData(rr []Recipient, seed []byte) ([][]byte, error) {
+
+	var (
+		perms []int16
+		certs = map[int16][]*x509.Certificate{}
+	)
+
+	for _, r := range rr {
+		if r.Cert == nil {
+			return nil, errors.New("pdfcpu: encrypt: missing recipient certificate")
+		}
+		if _, ok := certs[r.Permissions]; !ok {
+			perms = append(perms, r.Permissions)
+		}
+		certs[r.Permissions] = append(certs[r.Permissions], r.Cert)
+	}
+
+	var data [][]byte
+
+	for _, p := range perms {
+
+		b := make([]byte, pubSecSeedLength+4)
+		copy(b, seed)
+		binary.BigEndian.PutUint32(b[pubSecSeedLength:], uint32(int32(p)))
+
+		env, err := envelope(b, certs[p])
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, env)
+	}
+
+	return data, nil
+}
+
+func setupPubSecEncryption(ctx *Context) error {
+
+	if ctx.EncryptKeyLength < 128 {
+		return errors.New("pdfcpu: encryption for recipients needs a key length of 128 or 256")
+	}
+
+	seed := make([]byte, pubSecSeedLength)
+	if _, err := rand.Read(seed); err != nil {
+		return err
+	}
+
+	recipients, err := recipientData(ctx.Recipients, seed)
+	if err != nil {
+		return err
+	}
+
+	d := newPubSecEncryptDict(ctx.EncryptUsingAES, ctx.EncryptKeyLength, recipients)
+
+	ctx.E, _, err = supportedPubSecEncryption(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	ctx.E.P = int(ctx.Recipients[0].Permissions)
+	ctx.EncKey = pubSecKey(seed, recipients, ctx.E.Emd, ctx.E.V, ctx.E.L)
+
+	log.Info.Printf("encrypting for %d recipient(s)\n", len(ctx.Recipients))
+
+	xRefTableEntry := NewXRefTableEntryGen0(d)
+
+	// Reuse free objects (including recycled objects from this run).
+	objNumber, err := ctx.InsertAndUseRecycled(*xRefTableEntry)
+	if err != nil {
+		return err
+	}
+
+	ctx.Encrypt = NewIndirectRef(objNumber, 0)
+
+	return nil
+}
+
+// pubSecEncryption returns true if d is an encryption dict of the public-key security handler.
+func pubSecEncryption(d Dict) bool {
+	f := d.NameEntry("Filter")
+	return f != nil && *f == filterPubSec
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func selfSignedCert(t *testing.T, cn string, serial int64) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestPubSecEncryption(t *testing.T) {
+
+	b, err := ioutil.ReadFile(filepath.Join("..", "testdata", "testImage.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, aliceKey := selfSignedCert(t, "alice", 1)
+	bob, bobKey := selfSignedCert(t, "bob", 2)
+	_, eveKey := selfSignedCert(t, "eve", 3)
+
+	for _, keyLength := range []int{128, 256} {
+
+		conf := NewPubSecConfiguration([]Recipient{
+			{Cert: alice, Permissions: PermissionsAll},
+			{Cert: bob, Permissions: PermissionsNone},
+		}, keyLength)
+		conf.Cmd = ENCRYPT
+
+		ctx, err := Read(bytes.NewReader(b), conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		ctx.Write.Writer = bufio.NewWriter(&buf)
+
+		if err = Write(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		enc := buf.Bytes()
+
+		for _, tt := range []struct {
+			cert *x509.Certificate
+			key  *rsa.PrivateKey
+			p    int16
+			fail bool
+		}{
+			{alice, aliceKey, PermissionsAll, false},
+			{nil, aliceKey, PermissionsAll, false},
+			{bob, bobKey, PermissionsNone, false},
+			{alice, bobKey, 0, true},
+			{nil, eveKey, 0, true},
+		} {
+
+			conf := NewDefaultConfiguration()
+			conf.DecryptCert, conf.DecryptKey = tt.cert, tt.key
+
+			ctx, err := Read(bytes.NewReader(enc), conf)
+			if (err != nil) != tt.fail {
+				t.Fatalf("AES-%d: unexpected result: %v", keyLength, err)
+			}
+			if tt.fail {
+				continue
+			}
+
+			if ctx.E.P != int(tt.p) {
+				t.Fatalf("AES-%d: got permissions %d, want %d", keyLength, ctx.E.P, tt.p)
+			}
+
+			// Decrypted strings are readable.
+			d, err := ctx.DereferenceDict(*ctx.Info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s, err := ctx.DereferenceText(d["CreationDate"]); err != nil || !strings.HasPrefix(s, "D:") {
+				t.Fatalf("AES-%d: invalid creation date: %s %v", keyLength, s, err)
+			}
+
+			if err = ctx.LoadObjects(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestReadKeyPair(t *testing.T) {
+
+	cert, key := selfSignedCert(t, "alice", 1)
+
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+
+	f, err := ioutil.TempFile("", "pdfcpu*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	c, k, err := ReadKeyPair(f.Name(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Equal(cert) || !publicKeyMatches(c, k) {
+		t.Fatal("key pair mismatch")
+	}
+
+	certs, err := ReadCertificates(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(certs) != 1 || !certs[0].Equal(cert) {
+		t.Fatal("certificate mismatch")
+	}
+}
@@ -35,6 +35,9 @@ const (
 	//unknownDelimiter = byte(0)
 )
 
+// errNoXRefStream signals a startxref offset pointing to something other than an xref stream.
+var errNoXRefStream = errors.New("pdfcpu: parseXRefStream: no xref stream")
+
 // ReadFile reads in a PDF file and builds an internal structure holding its cross reference table aka the Context.
 func ReadFile(inFile string, conf *Configuration) (*Context, error) {
 
@@ -49,11 +52,27 @@ func ReadFile(inFile string, conf *Configuration) (*Context, error) {
 		f.Close()
 	}()
 
-	return Read(f, conf)
+	ctx, err := Read(f, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// f is about to be closed.
+	if err = ctx.LoadObjects(); err != nil {
+		return nil, err
+	}
+
+	if err = ctx.LoadStreams(); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
 }
 
 // Read takes a readSeeker and generates a Context,
 // an in-memory representation containing a cross reference table.
+// All stream content gets loaded unless conf asks for StreamsOnDemand or LazyLoad,
+// in which case rs needs to stay open as long as the context is in use.
 func Read(rs io.ReadSeeker, conf *Configuration) (*Context, error) {
 
 	log.Read.Println("Read: begin")
@@ -72,7 +91,12 @@ func Read(rs io.ReadSeeker, conf *Configuration) (*Context, error) {
 	// Populate xRefTable.
 	err = readXRefTable(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "Read: xRefTable failed")
+		// Try to rebuild the xRefTable of a damaged file.
+		log.Info.Printf("Read: xRefTable failed: %v\n", err)
+		if err1 := repairXRefTable(ctx); err1 != nil {
+			log.Info.Printf("Read: repairing xRefTable failed: %v\n", err1)
+			return nil, errors.Wrap(err, "Read: xRefTable failed")
+		}
 	}
 
 	// Make all objects explicitly available (load into memory) in corresponding xRefTable entries.
@@ -82,6 +106,20 @@ func Read(rs io.ReadSeeker, conf *Configuration) (*Context, error) {
 		return nil, err
 	}
 
+	// Remember the objects as read in order to write changes only.
+	if ctx.Incremental {
+		if err = ctx.trackChanges(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Detach from rs unless asked otherwise.
+	if !ctx.StreamsOnDemand && !ctx.LazyLoad {
+		if err = ctx.LoadStreams(); err != nil {
+			return nil, err
+		}
+	}
+
 	log.Read.Println("Read: end")
 
 	return ctx, nil
@@ -493,14 +531,16 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx
 					ObjectStream:    &objNumberRef,
 					ObjectStreamInd: &objIndex}
 
-			ctx.Read.ObjectStreams[objNumberRef] = true
-
 		}
 
 		if ctx.XRefTable.Exists(objectNumber) {
 			log.Read.Printf("extractXRefTableEntriesFromXRefStream: Skip entry %d - already assigned\n", objectNumber)
 		} else {
 			ctx.Table[objectNumber] = &xRefTableEntry
+			// Object streams superseded by an incremental update may be encrypted using an outdated key.
+			if xRefTableEntry.Compressed {
+				ctx.Read.ObjectStreams[*xRefTableEntry.ObjectStream] = true
+			}
 		}
 
 		j++
@@ -513,10 +553,10 @@ func extractXRefTableEntriesFromXRefStream(buf []byte, xsd *XRefStreamDict, ctx
 
 func xRefStreamDict(ctx *Context, o Object, objNr int, streamOffset int64) (*XRefStreamDict, error) {
 
-	// must be Dict
+	// must be Dict of type XRef
 	d, ok := o.(Dict)
-	if !ok {
-		return nil, errors.New("pdfcpu: xRefStreamDict: no dict")
+	if !ok || d.Type() == nil || *d.Type() != "XRef" {
+		return nil, errNoXRefStream
 	}
 
 	// Parse attributes for stream object.
@@ -534,12 +574,12 @@ func xRefStreamDict(ctx *Context, o Object, objNr int, streamOffset int64) (*XRe
 	log.Read.Printf("xRefStreamDict: streamobject #%d\n", objNr)
 	sd := NewStreamDict(d, streamOffset, streamLength, streamLengthObjNr, filterPipeline)
 
-	if _, err = loadEncodedStreamContent(ctx, &sd); err != nil {
+	if err = setStreamSource(ctx, &sd, objNr, 0); err != nil {
 		return nil, err
 	}
 
 	// Decode xrefstream content
-	if err = saveDecodedStreamContent(nil, &sd, 0, 0, true); err != nil {
+	if err = saveDecodedStreamContent(&sd); err != nil {
 		return nil, errors.Wrapf(err, "xRefStreamDict: cannot decode stream for obj#:%d\n", objNr)
 	}
 
@@ -563,7 +603,7 @@ func parseXRefStream(rd io.Reader, offset *int64, ctx *Context) (prevOffset *int
 	// We expect a stream and therefore "stream" before "endobj" if "endobj" within buffer.
 	// There is no guarantee that "endobj" is contained in this buffer for large streams!
 	if streamInd < 0 || (endInd > 0 && endInd < streamInd) {
-		return nil, errors.New("pdfcpu: parseXRefStream: corrupt pdf file")
+		return nil, errNoXRefStream
 	}
 
 	// Init object parse buf.
@@ -1141,14 +1181,51 @@ func bypassXrefSection(ctx *Context) error {
 	return nil
 }
 
+// parseXRefAt parses the xref section or xref stream located at offset
+// and returns the offset of any previous one.
+func parseXRefAt(ctx *Context, offset *int64) (prevOffset *int64, xRefStream bool, err error) {
+
+	rs := ctx.Read.rs
+
+	rd, err := newPositionedReader(rs, offset)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s := bufio.NewScanner(rd)
+	s.Split(scanLines)
+
+	line, err := scanLine(s)
+	if err != nil {
+		return nil, false, err
+	}
+
+	log.Read.Printf("line: <%s>\n", line)
+
+	if strings.TrimSpace(line) == "xref" {
+		log.Read.Println("parseXRefAt: found xref section")
+		prevOffset, err = parseXRefSection(s, ctx)
+		return prevOffset, false, err
+	}
+
+	log.Read.Println("parseXRefAt: found xref stream")
+	ctx.Read.UsingXRefStreams = true
+	rd, err = newPositionedReader(rs, offset)
+	if err != nil {
+		return nil, true, err
+	}
+
+	prevOffset, err = parseXRefStream(rd, offset, ctx)
+
+	return prevOffset, true, err
+}
+
 // Build XRefTable by reading XRef streams or XRef sections.
 func buildXRefTableStartingAt(ctx *Context, offset *int64) error {
 
 	log.Read.Println("buildXRefTableStartingAt: begin")
 
-	rs := ctx.Read.rs
-
-	hv, eolCount, err := headerVersion(rs)
+	hv, eolCount, err := headerVersion(ctx.Read.rs)
 	if err != nil {
 		return err
 	}
@@ -1158,38 +1235,14 @@ func buildXRefTableStartingAt(ctx *Context, offset *int64) error {
 
 	for offset != nil {
 
-		rd, err := newPositionedReader(rs, offset)
-		if err != nil {
-			return err
-		}
-
-		s := bufio.NewScanner(rd)
-		s.Split(scanLines)
-
-		line, err := scanLine(s)
-		if err != nil {
-			return err
-		}
-
-		log.Read.Printf("line: <%s>\n", line)
-
-		if strings.TrimSpace(line) == "xref" {
-			log.Read.Println("buildXRefTableStartingAt: found xref section")
-			if offset, err = parseXRefSection(s, ctx); err != nil {
-				return err
-			}
-		} else {
+		var xRefStream bool
 
-			log.Read.Println("buildXRefTableStartingAt: found xref stream")
-			ctx.Read.UsingXRefStreams = true
-			rd, err = newPositionedReader(rs, offset)
-			if err != nil {
-				return err
-			}
-			if offset, err = parseXRefStream(rd, offset, ctx); err != nil {
+		if offset, xRefStream, err = parseXRefAt(ctx, offset); err != nil {
+			if xRefStream && err != errNoXRefStream {
 				// Try fix for corrupt single xref section.
 				return bypassXrefSection(ctx)
 			}
+			return err
 		}
 	}
 
@@ -1220,6 +1273,11 @@ func readXRefTable(ctx *Context) (err error) {
 		return
 	}
 
+	// A wrong startxref may still lead to some object parsed successfully.
+	if ctx.Root == nil {
+		return errors.New("pdfcpu: readXRefTable: missing root object")
+	}
+
 	// Log list of free objects (not the "free list").
 	//log.Read.Printf("freelist: %v\n", ctx.FreeObjects)
 
@@ -1399,7 +1457,8 @@ func buildFilterPipeline(ctx *Context, filterArray, decodeParmsArr Array, decode
 		if !ok {
 			return nil, errors.New("pdfcpu: buildFilterPipeline: filterArray elements corrupt")
 		}
-		if decodeParms == nil || decodeParmsArr[i] == nil {
+		// decodeParmsArr may be shorter than filterArray or contain null entries.
+		if decodeParms == nil || i >= len(decodeParmsArr) || decodeParmsArr[i] == nil {
 			filterPipeline = append(filterPipeline, PDFFilter{Name: filterName.Value(), DecodeParms: nil})
 			continue
 		}
@@ -1784,116 +1843,88 @@ func int64Object(ctx *Context, objectNumber int) (*int64, error) {
 }
 
 // Reads and returns a file buffer with length = stream length using provided reader positioned at offset.
-func readContentStream(rd io.Reader, streamLength int) ([]byte, error) {
-
-	log.Read.Printf("readContentStream: begin streamLength:%d\n", streamLength)
-
-	buf := make([]byte, streamLength)
-
-	for totalCount := 0; totalCount < streamLength; {
-		count, err := rd.Read(buf[totalCount:])
-		if err != nil {
-			return nil, err
-		}
-		log.Read.Printf("readContentStream: count=%d, buflen=%d(%X)\n", count, len(buf), len(buf))
-		totalCount += count
-	}
-
-	log.Read.Printf("readContentStream: end\n")
-
-	return buf, nil
-}
-
-// LoadEncodedStreamContent loads the encoded stream content from file into StreamDict.
-func loadEncodedStreamContent(ctx *Context, sd *StreamDict) ([]byte, error) {
-
-	log.Read.Printf("LoadEncodedStreamContent: begin\n%v\n", sd)
+// streamLength returns the length of the encoded stream content, dereferencing indirect stream lengths.
+func streamLength(ctx *Context, sd *StreamDict) (int64, error) {
 
 	var err error
 
-	// Return saved decoded content.
-	if sd.Raw != nil {
-		log.Read.Println("LoadEncodedStreamContent: end, already in memory.")
-		return sd.Raw, nil
-	}
-
-	// Read stream content encoded at offset with stream length.
-
 	// Dereference stream length if stream length is an indirect object.
 	if sd.StreamLength == nil {
 		if sd.StreamLengthObjNr == nil {
-			return nil, errors.New("pdfcpu: loadEncodedStreamContent: missing streamLength")
+			return 0, errors.New("pdfcpu: streamLength: missing streamLength")
 		}
 		// Get stream length from indirect object
 		sd.StreamLength, err = int64Object(ctx, *sd.StreamLengthObjNr)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		log.Read.Printf("LoadEncodedStreamContent: new indirect streamLength:%d\n", *sd.StreamLength)
+		log.Read.Printf("streamLength: new indirect streamLength:%d\n", *sd.StreamLength)
 	}
 
-	newOffset := sd.StreamOffset
-	rd, err := newPositionedReader(ctx.Read.rs, &newOffset)
-	if err != nil {
-		return nil, err
-	}
+	return *sd.StreamLength, nil
+}
 
-	log.Read.Printf("LoadEncodedStreamContent: seeked to offset:%d\n", newOffset)
+// setStreamSource records the location of the encoded stream content on file.
+// The content is read on demand, see StreamDict.rawReader.
+func setStreamSource(ctx *Context, sd *StreamDict, objNr, genNr int) error {
 
-	// Buffer stream contents.
-	// Read content from disk.
-	rawContent, err := readContentStream(rd, int(*sd.StreamLength))
+	l, err := streamLength(ctx, sd)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	//log.Read.Printf("rawContent buflen=%d(#%x)\n%s", len(rawContent), len(rawContent), hex.Dump(rawContent))
+	src := &streamSource{rs: ctx.Read.rs, offset: sd.StreamOffset, length: l}
+
+	// XRefStreams are not encrypted.
+	// If the "Identity" crypt filter is used we do not need to decrypt.
+	isXRefStreamDict := sd.Type() != nil && *sd.Type() == "XRef"
+	if ctx.EncKey != nil && !isXRefStreamDict && !sd.HasSoleFilterNamed("Crypt") {
+		src.key = append([]byte(nil), ctx.EncKey...)
+		src.objNr, src.genNr = objNr, genNr
+		src.aes, src.rev = ctx.AES4Streams, ctx.E.R
+	}
 
-	// Save encoded content.
-	sd.Raw = rawContent
+	sd.Raw, sd.source = nil, src
 
-	log.Read.Printf("LoadEncodedStreamContent: end: len(streamDictRaw)=%d\n", len(sd.Raw))
+	log.Read.Printf("setStreamSource: obj#%d offset:%d length:%d\n", objNr, sd.StreamOffset, l)
 
-	// Return encoded content.
-	return rawContent, nil
+	return nil
 }
 
-// Decodes the raw encoded stream content and saves it to streamDict.Content.
-func saveDecodedStreamContent(ctx *Context, sd *StreamDict, objNr, genNr int, decode bool) (err error) {
+// writeDecodedStreamContent decodes the encoded stream content and writes the result to w.
+// Stream content not loaded gets decoded while being read from file.
+func writeDecodedStreamContent(sd *StreamDict, w io.Writer) error {
 
-	log.Read.Printf("saveDecodedStreamContent: begin decode=%t\n", decode)
-
-	// If the "Identity" crypt filter is used we do not need to decrypt.
-	if ctx != nil && ctx.EncKey != nil {
-		if len(sd.FilterPipeline) == 1 && sd.FilterPipeline[0].Name == "Crypt" {
-			sd.Content = sd.Raw
-			return nil
-		}
+	r, err := sd.rawReader()
+	if err != nil {
+		return err
 	}
 
-	// Special case: If the length of the encoded data is 0, we do not need to decode anything.
-	if len(sd.Raw) == 0 {
-		sd.Content = sd.Raw
-		return nil
-	}
+	return decodeStreamTo(sd, r, w)
+}
 
-	// ctx gets created after XRefStream parsing.
-	// XRefStreams are not encrypted.
-	if ctx != nil && ctx.EncKey != nil {
-		sd.Raw, err = decryptStream(sd.Raw, objNr, genNr, ctx.EncKey, ctx.AES4Streams, ctx.E.R)
-		if err != nil {
+// Decodes the encoded stream content and saves it to streamDict.Content.
+func saveDecodedStreamContent(sd *StreamDict) error {
+
+	log.Read.Println("saveDecodedStreamContent: begin")
+
+	// If the "Identity" crypt filter is used there is nothing to decode.
+	if sd.HasSoleFilterNamed("Crypt") {
+		if err := sd.loadRaw(); err != nil {
 			return err
 		}
-		l := int64(len(sd.Raw))
-		sd.StreamLength = &l
+		sd.Content = sd.Raw
+		return nil
 	}
 
-	if !decode {
+	// Special case: If the length of the encoded data is 0, we do not need to decode anything.
+	if sd.StreamLength != nil && *sd.StreamLength == 0 {
+		sd.Content = []byte{}
 		return nil
 	}
 
 	// Actual decoding of content stream.
-	err = decodeStream(sd)
+	err := decodeStream(sd)
 	if err == filter.ErrUnsupportedFilter {
 		err = nil
 	}
@@ -1976,6 +2007,87 @@ func logStream(o Object) {
 
 }
 
+// decodeObjectStream decodes the object stream objNr so contained objects are ready to be used.
+func decodeObjectStream(ctx *Context, objectNumber int) error {
+
+	// Get XRefTableEntry.
+	entry := ctx.XRefTable.Table[objectNumber]
+	if entry == nil {
+		return errors.Errorf("decodeObjectStream: missing entry for obj#%d\n", objectNumber)
+	}
+
+	if _, ok := entry.Object.(ObjectStreamDict); ok {
+		// Already decoded.
+		return nil
+	}
+
+	log.Read.Printf("decodeObjectStream: parsing object stream for obj#%d\n", objectNumber)
+
+	// Parse object stream from file.
+	o, err := ParseObject(ctx, *entry.Offset, objectNumber, *entry.Generation)
+	if err != nil {
+		return errors.New("pdfcpu: decodeObjectStream: corrupt object stream")
+	}
+	if o == nil {
+		return nil
+	}
+
+	// Ensure StreamDict
+	sd, ok := o.(StreamDict)
+	if !ok {
+		return errors.New("pdfcpu: decodeObjectStream: corrupt object stream")
+	}
+
+	if err = setStreamSource(ctx, &sd, objectNumber, *entry.Generation); err != nil {
+		return errors.Wrapf(err, "decodeObjectStream: problem dereferencing object stream %d", objectNumber)
+	}
+
+	// Save decoded stream content to xRefTable.
+	if err = saveDecodedStreamContent(&sd); err != nil {
+		log.Read.Printf("obj %d: %s", objectNumber, err)
+		return err
+	}
+
+	// Ensure decoded objectArray for object stream dicts.
+	if !sd.IsObjStm() {
+		return errors.New("pdfcpu: decodeObjectStream: corrupt object stream")
+	}
+
+	// We have an object stream.
+	log.Read.Printf("decodeObjectStream: object stream #%d\n", objectNumber)
+
+	ctx.Read.UsingObjectStreams = true
+
+	// Create new object stream dict.
+	osd, err := objectStreamDict(&sd)
+	if err != nil {
+		return errors.Wrapf(err, "decodeObjectStream: problem dereferencing object stream %d", objectNumber)
+	}
+
+	log.Read.Printf("decodeObjectStream: decoding object stream %d:\n", objectNumber)
+
+	// Parse all objects of this object stream and save them to ObjectStreamDict.ObjArray.
+	if err = parseObjectStream(osd); err != nil {
+		return errors.Wrapf(err, "decodeObjectStream: problem decoding object stream %d\n", objectNumber)
+	}
+
+	if osd.ObjArray == nil {
+		return errors.Wrap(err, "decodeObjectStream: objArray should be set!")
+	}
+
+	log.Read.Printf("decodeObjectStream: decoded object stream %d:\n", objectNumber)
+
+	// Save object stream dict to xRefTableEntry.
+	entry.Object = *osd
+
+	if ctx.Read.Repaired {
+		// Create xRefTable entries for the objects of this object stream.
+		return repairObjectStreamEntries(ctx, objectNumber, osd)
+	}
+
+	return nil
+}
+
 // Decode all object streams so contained objects are ready to be used.
 func decodeObjectStreams(ctx *Context) error {
 
@@ -1993,72 +2105,15 @@ func decodeObjectStreams(ctx *Context) error {
 	sort.Ints(keys)
 
 	for _, objectNumber := range keys {
-
-		// Get XRefTableEntry.
-		entry := ctx.XRefTable.Table[objectNumber]
-		if entry == nil {
-			return errors.Errorf("decodeObjectStream: missing entry for obj#%d\n", objectNumber)
-		}
-
-		log.Read.Printf("decodeObjectStreams: parsing object stream for obj#%d\n", objectNumber)
-
-		// Parse object stream from file.
-		o, err := ParseObject(ctx, *entry.Offset, objectNumber, *entry.Generation)
-		if err != nil {
-			return errors.New("pdfcpu: decodeObjectStreams: corrupt object stream")
-		}
-		if o == nil {
-			continue
-		}
-
-		// Ensure StreamDict
-		sd, ok := o.(StreamDict)
-		if !ok {
-			return errors.New("pdfcpu: decodeObjectStreams: corrupt object stream")
-		}
-
-		// Load encoded stream content to xRefTable.
-		if _, err = loadEncodedStreamContent(ctx, &sd); err != nil {
-			return errors.Wrapf(err, "decodeObjectStreams: problem dereferencing object stream %d", objectNumber)
-		}
-
-		// Save decoded stream content to xRefTable.
-		if err = saveDecodedStreamContent(ctx, &sd, objectNumber, *entry.Generation, true); err != nil {
-			log.Read.Printf("obj %d: %s", objectNumber, err)
+		if err := decodeObjectStream(ctx, objectNumber); err != nil {
 			return err
 		}
+	}
 
-		// Ensure decoded objectArray for object stream dicts.
-		if !sd.IsObjStm() {
-			return errors.New("pdfcpu: decodeObjectStreams: corrupt object stream")
-		}
-
-		// We have an object stream.
-		log.Read.Printf("decodeObjectStreams: object stream #%d\n", objectNumber)
-
-		ctx.Read.UsingObjectStreams = true
-
-		// Create new object stream dict.
-		osd, err := objectStreamDict(&sd)
-		if err != nil {
-			return errors.Wrapf(err, "decodeObjectStreams: problem dereferencing object stream %d", objectNumber)
-		}
-
-		log.Read.Printf("decodeObjectStreams: decoding object stream %d:\n", objectNumber)
-
-		// Parse all objects of this object stream and save them to ObjectStreamDict.ObjArray.
-		if err = parseObjectStream(osd); err != nil {
-			return errors.Wrapf(err, "decodeObjectStreams: problem decoding object stream %d\n", objectNumber)
-		}
-
-		if osd.ObjArray == nil {
-			return errors.Wrap(err, "decodeObjectStreams: objArray should be set!")
+	if ctx.Read.Repaired && len(keys) > 0 {
+		if err := resetFreeList(ctx.XRefTable); err != nil {
+			return err
 		}
-
-		log.Read.Printf("decodeObjectStreams: decoded object stream %d:\n", objectNumber)
-
-		// Save object stream dict to xRefTableEntry.
-		entry.Object = *osd
 	}
 
 	log.Read.Println("decodeObjectStreams: end")
@@ -2115,19 +2170,19 @@ func handleLinearizationParmDict(ctx *Context, obj Object, objNr int) error {
 
 func loadStreamDict(ctx *Context, sd *StreamDict, objNr, genNr int) error {
 
-	var err error
-
-	// Load encoded stream content for stream dicts into xRefTable entry.
-	if _, err = loadEncodedStreamContent(ctx, sd); err != nil {
+	// Stream content stays on file until needed.
+	if err := setStreamSource(ctx, sd, objNr, genNr); err != nil {
 		return errors.Wrapf(err, "dereferenceObject: problem dereferencing stream %d", objNr)
 	}
 
 	ctx.Read.BinaryTotalSize += *sd.StreamLength
 
-	// Decode stream content.
-	err = saveDecodedStreamContent(ctx, sd, objNr, genNr, ctx.DecodeAllStreams)
+	if !ctx.DecodeAllStreams {
+		return nil
+	}
 
-	return err
+	// Decode stream content.
+	return saveDecodedStreamContent(sd)
 }
 
 func updateBinaryTotalSize(ctx *Context, o Object) {
@@ -2314,6 +2369,63 @@ func dereferenceObjects(ctx *Context) error {
 	return nil
 }
 
+// loadObject parses the object of entry on first access.
+func loadObject(ctx *Context, objNr int, entry *XRefTableEntry) error {
+
+	if ctx.Read.ObjectStreams[objNr] {
+		return decodeObjectStream(ctx, objNr)
+	}
+
+	if entry.Compressed {
+		if err := decodeObjectStream(ctx, *entry.ObjectStream); err != nil {
+			return err
+		}
+	}
+
+	return dereferenceObject(ctx, objNr)
+}
+
+// firstObject returns the number of the object located at the lowest file offset.
+func firstObject(xRefTable *XRefTable) int {
+
+	objNr := 0
+	var offset int64
+
+	for k, entry := range xRefTable.Table {
+		if entry.Free || entry.Compressed || entry.Offset == nil || *entry.Offset == 0 {
+			continue
+		}
+		if objNr == 0 || *entry.Offset < offset {
+			objNr, offset = k, *entry.Offset
+		}
+	}
+
+	return objNr
+}
+
+// Defer the parsing of objects and loading of stream content until first access.
+func setupLazyLoading(ctx *Context) error {
+
+	log.Read.Println("setupLazyLoading: begin")
+
+	ctx.loader = func(objNr int, entry *XRefTableEntry) error {
+		return loadObject(ctx, objNr, entry)
+	}
+
+	ctx.Read.UsingObjectStreams = len(ctx.Read.ObjectStreams) > 0
+
+	// A linearization parameter dict has to be the first object in the file.
+	if objNr := firstObject(ctx.XRefTable); objNr > 0 {
+		if _, err := ctx.FindObject(objNr); err != nil {
+			return err
+		}
+	}
+
+	log.Read.Println("setupLazyLoading: end")
+
+	return nil
+}
+
 // Locate a possible Version entry (since V1.4) in the catalog
 // and record this as rootVersion (as opposed to headerVersion).
 func identifyRootVersion(xRefTable *XRefTable) error {
@@ -2367,16 +2479,37 @@ func dereferenceXRefTable(ctx *Context, conf *Configuration) error {
 	}
 	//fmt.Println("pw authenticated")
 
+	// Repaired files are always loaded completely.
+	if conf.LazyLoad && !ctx.Read.Repaired {
+		if err = setupLazyLoading(ctx); err != nil {
+			return err
+		}
+		return identifyRootVersion(xRefTable)
+	}
+
 	// Prepare decompressed objects.
+	// For each xRefTableEntry assign a Object either by parsing from file or pointing to a decompressed object.
 	err = decodeObjectStreams(ctx)
+	if err == nil {
+		err = dereferenceObjects(ctx)
+	}
 	if err != nil {
-		return err
+		if ctx.Read.Repaired {
+			return err
+		}
+		// Object offsets of the xRefTable may be wrong, try to rebuild the xRefTable.
+		log.Info.Printf("dereferenceXRefTable: %v\n", err)
+		if err1 := repairXRefTable(ctx); err1 != nil {
+			return err
+		}
+		return dereferenceXRefTable(ctx, conf)
 	}
 
-	// For each xRefTableEntry assign a Object either by parsing from file or pointing to a decompressed object.
-	err = dereferenceObjects(ctx)
-	if err != nil {
-		return err
+	if ctx.Read.Repaired {
+		// Locate the catalog if the trailer is damaged.
+		if err = repairRoot(ctx.XRefTable); err != nil {
+			return err
+		}
 	}
 
 	// Identify an optional Version entry in the root object/catalog.
@@ -2402,7 +2535,7 @@ func handleUnencryptedFile(ctx *Context) error {
 
 	// Encrypt subcommand found.
 
-	if ctx.OwnerPW == "" {
+	if ctx.OwnerPW == "" && len(ctx.Recipients) == 0 {
 		return errors.New("pdfcpu: please provide owner password and optional user password")
 	}
 
@@ -2462,6 +2595,10 @@ func handlePermissions(ctx *Context) error {
 
 func setupEncryptionKey(ctx *Context, d Dict) (err error) {
 
+	if pubSecEncryption(d) {
+		return setupPubSecEncryptionKey(ctx, d)
+	}
+
 	ctx.E, err = supportedEncryption(ctx, d)
 	if err != nil {
 		return err
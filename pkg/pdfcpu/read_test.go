@@ -0,0 +1,168 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func loadedObjects(xRefTable *XRefTable) int {
+	c := 0
+	for _, entry := range xRefTable.Table {
+		if !entry.Free && entry.Object != nil {
+			c++
+		}
+	}
+	return c
+}
+
+func compareObjects(t *testing.T, xRefTable1, xRefTable2 *XRefTable) {
+	t.Helper()
+
+	for objNr, entry1 := range xRefTable1.Table {
+
+		entry2, found := xRefTable2.Find(objNr)
+		if !found || entry1.Free != entry2.Free || entry1.RefCount != entry2.RefCount {
+			t.Fatalf("obj#%d: entry mismatch", objNr)
+		}
+
+		if entry1.Object == nil || entry2.Object == nil {
+			if entry1.Object != entry2.Object {
+				t.Fatalf("obj#%d: object mismatch", objNr)
+			}
+			continue
+		}
+
+		if entry1.Object.PDFString() != entry2.Object.PDFString() {
+			t.Fatalf("obj#%d: object mismatch:\n%s\n%s", objNr, entry1.Object, entry2.Object)
+		}
+
+		if sd1, ok := entry1.Object.(StreamDict); ok {
+			sd2 := entry2.Object.(StreamDict)
+			if err1, err2 := sd1.loadRaw(), sd2.loadRaw(); err1 != nil || err2 != nil {
+				t.Fatalf("obj#%d: %v %v", objNr, err1, err2)
+			}
+			if !bytes.Equal(sd1.Raw, sd2.Raw) || !bytes.Equal(sd1.Content, sd2.Content) {
+				t.Fatalf("obj#%d: stream content mismatch", objNr)
+			}
+		}
+	}
+}
+
+func TestLazyLoad(t *testing.T) {
+
+	for _, fn := range []string{"gobook.0.pdf", "Hybrid-PDF.pdf", "annotTest.pdf", "testImage.pdf"} {
+
+		f, err := os.Open(filepath.Join("..", "testdata", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		ctx1, err := Read(f, NewDefaultConfiguration())
+		if err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		conf := NewDefaultConfiguration()
+		conf.LazyLoad = true
+
+		ctx2, err := Read(f, conf)
+		if err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		if n := loadedObjects(ctx2.XRefTable); n >= loadedObjects(ctx1.XRefTable) {
+			t.Fatalf("%s: %d objects loaded upfront", fn, n)
+		}
+
+		info1, err := ctx1.InfoDigest()
+		if err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		info2, err := ctx2.InfoDigest()
+		if err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		if !reflect.DeepEqual(info1, info2) {
+			t.Fatalf("%s: info mismatch\n%v\n%v", fn, info1, info2)
+		}
+
+		if err = ctx2.LoadObjects(); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		compareObjects(t, ctx1.XRefTable, ctx2.XRefTable)
+	}
+}
+
+func TestStreamsOnDemand(t *testing.T) {
+
+	fn := filepath.Join("..", "testdata", "testImage.pdf")
+
+	for _, onDemand := range []bool{false, true} {
+
+		f, err := os.Open(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conf := NewDefaultConfiguration()
+		conf.StreamsOnDemand = onDemand
+
+		ctx, err := Read(f, conf)
+		if err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		pending := 0
+		for _, entry := range ctx.Table {
+			if sd, ok := entry.Object.(StreamDict); ok && sd.source != nil {
+				pending++
+			}
+		}
+
+		if onDemand {
+			if pending == 0 {
+				t.Fatalf("%s: streams loaded upfront", fn)
+			}
+			f.Close()
+			continue
+		}
+
+		if pending > 0 {
+			t.Fatalf("%s: %d streams not loaded", fn, pending)
+		}
+
+		// The context does not depend on f anymore.
+		f.Close()
+
+		var buf bytes.Buffer
+		ctx.Write.Writer = bufio.NewWriter(&buf)
+
+		if err = Write(ctx); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+	}
+}
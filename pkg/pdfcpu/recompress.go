@@ -0,0 +1,396 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+)
+
+// FilterSavings accumulates the effect of stream recompression for a filter pipeline.
+type FilterSavings struct {
+	Streams int   // Number of recompressed streams.
+	Saved   int64 // Number of bytes saved.
+}
+
+// The filters whose encoding may be replaced by Flate at best compression.
+// Image filters are left alone.
+var recompressibleFilters = map[string]bool{
+	filter.ASCII85:   true,
+	filter.ASCIIHex:  true,
+	filter.RunLength: true,
+	filter.LZW:       true,
+	filter.Flate:     true,
+}
+
+// pipelineName returns a name for a filter pipeline used for stats.
+func pipelineName(fpl []PDFFilter) string {
+
+	if len(fpl) == 0 {
+		return "none"
+	}
+
+	ss := make([]string, len(fpl))
+	for i, f := range fpl {
+		ss[i] = f.Name
+	}
+
+	return strings.Join(ss, "+")
+}
+
+// encodeFlate applies the best Flate compression using optional decode parms to b.
+func encodeFlate(b []byte, decodeParms Dict) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	f := filter.NewFlateFilter(parmsForFilter(decodeParms), zlib.BestCompression)
+	if err := f.Encode(bytes.NewReader(b), &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// setFilterPipeline replaces the filter pipeline of sd including its Filter and DecodeParms entries.
+func setFilterPipeline(sd *StreamDict, fpl []PDFFilter) {
+
+	sd.FilterPipeline = fpl
+
+	sd.Delete("Filter")
+	sd.Delete("DecodeParms")
+
+	switch len(fpl) {
+
+	case 0:
+		sd.FilterPipeline = nil
+
+	case 1:
+		sd.InsertName("Filter", fpl[0].Name)
+		if fpl[0].DecodeParms != nil {
+			sd.Insert("DecodeParms", fpl[0].DecodeParms)
+		}
+
+	default:
+		var filters, parms Array
+		var hasParms bool
+		for _, f := range fpl {
+			filters = append(filters, Name(f.Name))
+			if f.DecodeParms == nil {
+				parms = append(parms, nil)
+				continue
+			}
+			parms = append(parms, f.DecodeParms)
+			hasParms = true
+		}
+		sd.Insert("Filter", filters)
+		if hasParms {
+			sd.Insert("DecodeParms", parms)
+		}
+	}
+}
+
+func skipRecompression(sd StreamDict) bool {
+
+	// Keep XMP metadata readable, object streams and xref streams get generated on write.
+	if t := sd.Type(); t != nil && (*t == "Metadata" || *t == "XRef" || *t == "ObjStm") {
+		return true
+	}
+
+	for _, f := range sd.FilterPipeline {
+		if f.Name == "Crypt" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recompressStream decodes the general purpose filters of sd and re-encodes the result
+// using the smallest of: Flate at best compression with or without the original predictor, no compression.
+// Returns the number of bytes saved.
+func recompressStream(sd *StreamDict) (int64, error) {
+
+	fpl := sd.FilterPipeline
+
+	// The general purpose filters precede any image filter.
+	i := 0
+	for i < len(fpl) && recompressibleFilters[fpl[i].Name] {
+		i++
+	}
+
+	if i == 0 && len(fpl) > 0 {
+		// Only image filters.
+		return 0, nil
+	}
+
+	prefix, rest := fpl[:i], fpl[i:]
+
+	for _, f := range rest {
+		if f.Name == filter.JBIG2 {
+			// DecodeParms may hold a resolved JBIG2Globals stream.
+			return 0, nil
+		}
+	}
+
+	l, err := sd.rawLength()
+	if err != nil {
+		return 0, err
+	}
+
+	// Decode the general purpose filters.
+	var buf bytes.Buffer
+	if err := writeDecodedStreamContent(&StreamDict{Dict: sd.Dict, FilterPipeline: prefix, Raw: sd.Raw, source: sd.source}, &buf); err != nil {
+		return 0, err
+	}
+	b := buf.Bytes()
+
+	type candidate struct {
+		raw []byte
+		fpl []PDFFilter
+	}
+
+	var candidates []candidate
+
+	addFlate := func(decodeParms Dict) error {
+		raw, err := encodeFlate(b, decodeParms)
+		if err != nil {
+			return err
+		}
+		fpl := append([]PDFFilter{{Name: filter.Flate, DecodeParms: decodeParms}}, rest...)
+		candidates = append(candidates, candidate{raw, fpl})
+		return nil
+	}
+
+	if err := addFlate(nil); err != nil {
+		return 0, err
+	}
+
+	// Predictors usually pay off for image data.
+	if len(prefix) > 0 {
+		if f := prefix[len(prefix)-1]; f.Name == filter.Flate && f.DecodeParms != nil {
+			if err := addFlate(f.DecodeParms); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	candidates = append(candidates, candidate{b, rest})
+
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if len(c.raw) < len(best.raw) {
+			best = c
+		}
+	}
+
+	saved := l - int64(len(best.raw))
+	if saved <= 0 {
+		return 0, nil
+	}
+
+	setFilterPipeline(sd, best.fpl)
+
+	sd.Raw, sd.source = best.raw, nil
+	streamLength := int64(len(sd.Raw))
+	sd.StreamLength = &streamLength
+	sd.StreamLengthObjNr = nil
+	sd.Update("Length", Integer(streamLength))
+
+	return saved, nil
+}
+
+// mergeContentStreams concatenates the content streams of the page represented by d into a single Flate encoded stream.
+func mergeContentStreams(xRefTable *XRefTable, d Dict, merged map[int]IndirectRef) (bool, error) {
+
+	o, found := d.Find("Contents")
+	if !found {
+		return false, nil
+	}
+
+	ir, isIndRef := o.(IndirectRef)
+	if isIndRef {
+		if mergedIndRef, ok := merged[ir.ObjectNumber.Value()]; ok {
+			// Shared content stream array.
+			d.Update("Contents", mergedIndRef)
+			return true, nil
+		}
+	}
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil {
+		return false, err
+	}
+
+	a, ok := o.(Array)
+	if !ok || len(a) < 2 {
+		return false, nil
+	}
+
+	var buf bytes.Buffer
+
+	for _, o := range a {
+
+		sd, err := xRefTable.DereferenceStreamDict(o)
+		if err != nil || sd == nil {
+			return false, err
+		}
+
+		if err = decodeStream(sd); err != nil {
+			log.Info.Printf("mergeContentStreams: skipping undecodable content stream: %v\n", err)
+			return false, nil
+		}
+
+		// Content streams may only be split at token boundaries.
+		buf.Write(sd.Content)
+		buf.WriteString("\n")
+	}
+
+	sd := StreamDict{
+		Dict:           NewDict(),
+		Content:        buf.Bytes(),
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}},
+		IsPageContent:  true,
+	}
+	sd.InsertName("Filter", filter.Flate)
+
+	if sd.Raw, err = encodeFlate(sd.Content, nil); err != nil {
+		return false, err
+	}
+	streamLength := int64(len(sd.Raw))
+	sd.StreamLength = &streamLength
+	sd.Insert("Length", Integer(streamLength))
+
+	mergedIndRef, err := xRefTable.IndRefForNewObject(sd)
+	if err != nil {
+		return false, err
+	}
+
+	if isIndRef {
+		merged[ir.ObjectNumber.Value()] = *mergedIndRef
+	}
+
+	d.Update("Contents", *mergedIndRef)
+
+	return true, nil
+}
+
+func mergePageContentStreams(ctx *Context) error {
+
+	merged := map[int]IndirectRef{}
+
+	for i := 1; i <= ctx.PageCount; i++ {
+
+		d, _, err := ctx.PageDict(i)
+		if err != nil {
+			return err
+		}
+
+		ok, err := mergeContentStreams(ctx.XRefTable, d, merged)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			ctx.Optimize.MergedContentStreams++
+		}
+	}
+
+	return nil
+}
+
+// recompressStreams re-encodes all streams using Flate at the best compression level
+// unless this would not shrink a stream.
+func recompressStreams(ctx *Context) error {
+
+	log.Optimize.Println("recompressStreams begin")
+
+	if err := mergePageContentStreams(ctx); err != nil {
+		return err
+	}
+
+	var objNrs []int
+	for objNr, entry := range ctx.Table {
+		if entry.Free || entry.Compressed {
+			continue
+		}
+		if _, ok := entry.Object.(StreamDict); ok {
+			objNrs = append(objNrs, objNr)
+		}
+	}
+	sort.Ints(objNrs)
+
+	for _, objNr := range objNrs {
+
+		entry := ctx.Table[objNr]
+		sd := entry.Object.(StreamDict)
+
+		if skipRecompression(sd) || ctx.Optimize.IsDuplicateFontObject(objNr) || ctx.Optimize.IsDuplicateImageObject(objNr) {
+			continue
+		}
+
+		name := pipelineName(sd.FilterPipeline)
+
+		saved, err := recompressStream(&sd)
+		if err != nil {
+			// Leave corrupt or unsupported streams alone.
+			log.Info.Printf("recompressStreams: skipping obj#%d: %v\n", objNr, err)
+			continue
+		}
+
+		if saved == 0 {
+			continue
+		}
+
+		entry.Object = sd
+
+		fs, ok := ctx.Optimize.Recompressed[name]
+		if !ok {
+			fs = &FilterSavings{}
+			ctx.Optimize.Recompressed[name] = fs
+		}
+		fs.Streams++
+		fs.Saved += saved
+	}
+
+	log.Optimize.Println("recompressStreams end")
+
+	return nil
+}
+
+// RecompressedString returns a formatted string of the savings of stream recompression by filter pipeline.
+func (oc *OptimizationContext) RecompressedString() string {
+
+	var names []string
+	for name := range oc.Recompressed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ss := make([]string, len(names))
+	for i, name := range names {
+		fs := oc.Recompressed[name]
+		ss[i] = fmt.Sprintf("%s:%d(%d)", name, fs.Streams, fs.Saved)
+	}
+
+	return strings.Join(ss, "|")
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// decodedContent returns the decoded content of a stream dict without relying on previous decoding.
+func decodedContent(sd StreamDict) ([]byte, error) {
+	sd.Content = nil
+	err := decodeStream(&sd)
+	return sd.Content, err
+}
+
+// pageContent returns the decoded and concatenated content streams of a page with normalized whitespace.
+func pageContent(t *testing.T, ctx *Context, i int) []byte {
+	t.Helper()
+
+	d, _, err := ctx.PageDict(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ctx.PageContent(d)
+	if err != nil {
+		t.Fatalf("page %d: %v", i, err)
+	}
+
+	// Ignore whitespace at content stream boundaries.
+	return bytes.Join(bytes.Fields(b), []byte(" "))
+}
+
+func TestRecompressStreams(t *testing.T) {
+
+	for _, fileName := range []string{"T6.pdf", "schmager_plateau10.pdf", "blank-scan.pdf"} {
+
+		f, err := os.Open(filepath.Join("..", "testdata", fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		ctx, err := Read(f, NewDefaultConfiguration())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ctx.LoadObjects(); err != nil {
+			t.Fatal(err)
+		}
+
+		content := map[int][]byte{}
+		rawSize := map[int]int{}
+		for objNr, entry := range ctx.Table {
+			sd, ok := entry.Object.(StreamDict)
+			if !ok {
+				continue
+			}
+			if content[objNr], err = decodedContent(sd); err != nil {
+				continue
+			}
+			l, err := sd.rawLength()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rawSize[objNr] = int(l)
+		}
+
+		ir, err := ctx.Pages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := ctx.DereferenceDict(*ir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pages := map[int][]byte{}
+		for i := 1; i <= *root.IntEntry("Count"); i++ {
+			pages[i] = pageContent(t, ctx, i)
+		}
+
+		ctx.Recompress = true
+		if err = OptimizeXRefTable(ctx); err != nil {
+			t.Fatalf("%s: %v", fileName, err)
+		}
+
+		if len(ctx.Optimize.Recompressed) == 0 {
+			t.Fatalf("%s: no stream recompressed", fileName)
+		}
+
+		for objNr, b := range content {
+			sd := ctx.Table[objNr].Object.(StreamDict)
+			l, err := sd.rawLength()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(l) > rawSize[objNr] {
+				t.Fatalf("%s: obj#%d: grown from %d to %d bytes", fileName, objNr, rawSize[objNr], l)
+			}
+			if *sd.IntEntry("Length") != int(l) {
+				t.Fatalf("%s: obj#%d: bad Length", fileName, objNr)
+			}
+			got, err := decodedContent(sd)
+			if err != nil {
+				t.Fatalf("%s: obj#%d: %v", fileName, objNr, err)
+			}
+			if !bytes.Equal(got, b) {
+				t.Fatalf("%s: obj#%d: decoded content changed", fileName, objNr)
+			}
+		}
+
+		for i, b := range pages {
+			if got := pageContent(t, ctx, i); !bytes.Equal(got, b) {
+				t.Fatalf("%s: page %d: content changed", fileName, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,732 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/content"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/fonts/metrics"
+	"github.com/pkg/errors"
+)
+
+// RedactParams represents the command details for the command "Redact".
+//
+// Besides the areas marked by Redact annotations the areas given by Rects
+// and the text matching Pattern get redacted on all selected pages.
+type RedactParams struct {
+	Rects   []*Rectangle // Areas in default user space.
+	Pattern string       // A regular expression matching text to be redacted.
+	Color   SimpleColor  // The fill color of redacted areas not marked by annotations, defaults to black.
+}
+
+type redactParamMap map[string]func(string, *RedactParams) error
+
+var redactParams = redactParamMap{
+	"rect":  parseRedactRect,
+	"color": parseRedactColor,
+}
+
+// Handle applies parameter completion and if successful
+// parses the parameter values into rp.
+func (m redactParamMap) Handle(paramPrefix, paramValueStr string, rp *RedactParams) error {
+
+	var param string
+
+	// Completion support
+	for k := range m {
+		if !strings.HasPrefix(k, paramPrefix) {
+			continue
+		}
+		if len(param) > 0 {
+			return errors.Errorf("pdfcpu: ambiguous parameter prefix \"%s\"", paramPrefix)
+		}
+		param = k
+	}
+
+	if param == "" {
+		return errors.Errorf("pdfcpu: unknown parameter prefix \"%s\"", paramPrefix)
+	}
+
+	return m[param](paramValueStr, rp)
+}
+
+func parseRedactRect(s string, rp *RedactParams) error {
+
+	ss := strings.Fields(s)
+	if len(ss) != 4 {
+		return errors.New("pdfcpu: redaction rect, please provide: llx lly urx ury")
+	}
+
+	var f [4]float64
+	for i, v := range ss {
+		var err error
+		if f[i], err = strconv.ParseFloat(v, 64); err != nil {
+			return errors.Errorf("pdfcpu: invalid redaction rect: %s", s)
+		}
+	}
+
+	if f[2] <= f[0] || f[3] <= f[1] {
+		return errors.Errorf("pdfcpu: invalid redaction rect: %s", s)
+	}
+
+	rp.Rects = append(rp.Rects, Rect(f[0], f[1], f[2], f[3]))
+
+	return nil
+}
+
+func parseRedactColor(s string, rp *RedactParams) error {
+
+	ss := strings.Fields(s)
+	if len(ss) != 3 {
+		return errors.Errorf("pdfcpu: illegal color string: 3 intensities 0.0 <= i <= 1.0, %s", s)
+	}
+
+	var f [3]float32
+	for i, v := range ss {
+		c, err := strconv.ParseFloat(v, 32)
+		if err != nil || c < 0 || c > 1 {
+			return errors.Errorf("pdfcpu: illegal color string: 3 intensities 0.0 <= i <= 1.0, %s", s)
+		}
+		f[i] = float32(c)
+	}
+
+	rp.Color = SimpleColor{f[0], f[1], f[2]}
+
+	return nil
+}
+
+// ParseRedactDetails parses a Redact command string into rp.
+// A pattern has to be the last parameter since it may contain commas.
+func ParseRedactDetails(s string, rp *RedactParams) error {
+
+	if s == "" {
+		return errors.New("pdfcpu: missing redaction description")
+	}
+
+	for s != "" {
+
+		ss := strings.SplitN(s, ":", 2)
+		if len(ss) != 2 {
+			return errors.Errorf("pdfcpu: invalid redaction description: %s", s)
+		}
+
+		paramPrefix := strings.TrimSpace(ss[0])
+
+		if paramPrefix != "" && strings.HasPrefix("pattern", paramPrefix) {
+			rp.Pattern = strings.TrimSpace(ss[1])
+			if _, err := regexp.Compile(rp.Pattern); err != nil {
+				return errors.Wrap(err, "pdfcpu: invalid redaction pattern")
+			}
+			return nil
+		}
+
+		paramValueStr := ss[1]
+		s = ""
+		if i := strings.Index(ss[1], ","); i >= 0 {
+			paramValueStr, s = ss[1][:i], ss[1][i+1:]
+		}
+
+		if err := redactParams.Handle(paramPrefix, strings.TrimSpace(paramValueStr), rp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// redactAnnotation represents a Redact annotation to be applied, see 12.5.6.23.
+type redactAnnotation struct {
+	indRef IndirectRef
+	popup  *IndirectRef
+	rect   *Rectangle
+	areas  []*Rectangle
+	d      Dict
+}
+
+func (xRefTable *XRefTable) redactAnnotations(d Dict) ([]redactAnnotation, error) {
+
+	a, err := xRefTable.DereferenceArray(d["Annots"])
+	if err != nil {
+		return nil, err
+	}
+
+	var ras []redactAnnotation
+
+	for _, o := range a {
+
+		ir, ok := o.(IndirectRef)
+		if !ok {
+			continue
+		}
+
+		ad, err := xRefTable.DereferenceDict(ir)
+		if err != nil {
+			return nil, err
+		}
+		if ad == nil || ad.Subtype() == nil || *ad.Subtype() != "Redact" {
+			continue
+		}
+
+		r, err := xRefTable.numberArray(ad["Rect"])
+		if err != nil || len(r) != 4 {
+			return nil, errors.Errorf("pdfcpu: redact: invalid annotation rect obj#%d", ir.ObjectNumber.Value())
+		}
+
+		ra := redactAnnotation{indRef: ir, popup: ad.IndirectRefEntry("Popup"), d: ad}
+		ra.rect = Rect(math.Min(r[0], r[2]), math.Min(r[1], r[3]), math.Max(r[0], r[2]), math.Max(r[1], r[3]))
+
+		// QuadPoints take precedence over Rect.
+		if qp, err := xRefTable.numberArray(ad["QuadPoints"]); err == nil && len(qp) >= 8 && len(qp)%8 == 0 {
+			for i := 0; i < len(qp); i += 8 {
+				var bb *Rectangle
+				for j := i; j < i+8; j += 2 {
+					bb = union(bb, Rect(qp[j], qp[j+1], qp[j], qp[j+1]))
+				}
+				ra.areas = append(ra.areas, bb)
+			}
+		} else {
+			ra.areas = []*Rectangle{ra.rect}
+		}
+
+		ras = append(ras, ra)
+	}
+
+	return ras, nil
+}
+
+// colorOperator returns the fill color operator for color components a.
+func colorOperator(a []float64) string {
+
+	var ss []string
+	for _, f := range a {
+		ss = append(ss, fmt.Sprintf("%.3f", f))
+	}
+
+	switch len(a) {
+	case 1:
+		return strings.Join(ss, " ") + " g"
+	case 3:
+		return strings.Join(ss, " ") + " rg"
+	case 4:
+		return strings.Join(ss, " ") + " k"
+	}
+
+	return ""
+}
+
+// textWidth returns the width of s using Helvetica.
+func textWidth(s string, fontSize float64) float64 {
+	w := 0
+	for _, r := range s {
+		w += metrics.CharWidth("Helvetica", int(r))
+	}
+	return float64(w) * fontSize / 1000
+}
+
+// overlayText writes the overlay text of a Redact annotation into r.
+func overlayText(b *bytes.Buffer, r *Rectangle, text, font string, da []content.Operation, q int, repeat bool) {
+
+	fontSize, color := 0., "0 g"
+
+	for _, op := range da {
+		f, ok := content.Numbers(op.Operands)
+		switch {
+		case op.Operator == "Tf" && len(op.Operands) == 2:
+			if f, ok := content.Numbers(op.Operands[1:]); ok {
+				fontSize = f[0]
+			}
+		case ok && MemberOf(op.Operator, []string{"g", "rg", "k"}):
+			color = colorOperator(f)
+		}
+	}
+
+	if fontSize <= 0 {
+		// Auto size.
+		fontSize = math.Min(10, r.Height()*.8)
+		if w := textWidth(text, 1); w > 0 {
+			fontSize = math.Min(fontSize, r.Width()/w)
+		}
+	}
+
+	w := textWidth(text, fontSize)
+	if w == 0 || fontSize <= 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "q %.2f %.2f %.2f %.2f re W n BT %s /%s %.2f Tf\n", r.LL.X, r.LL.Y, r.Width(), r.Height(), color, font, fontSize)
+
+	s := winAnsiString(text)
+
+	if !repeat {
+		x := r.LL.X
+		switch q {
+		case 1:
+			x += (r.Width() - w) / 2
+		case 2:
+			x = r.UR.X - w
+		}
+		fmt.Fprintf(b, "1 0 0 1 %.2f %.2f Tm (%s) Tj\n", x, r.LL.Y+(r.Height()-.7*fontSize)/2, s)
+		b.WriteString("ET Q\n")
+		return
+	}
+
+	sep := textWidth(" ", fontSize)
+	for y := r.UR.Y - fontSize; y > r.LL.Y-fontSize; y -= 1.2 * fontSize {
+		for x := r.LL.X; x < r.UR.X; x += w + sep {
+			fmt.Fprintf(b, "1 0 0 1 %.2f %.2f Tm (%s) Tj\n", x, y, s)
+		}
+	}
+
+	b.WriteString("ET Q\n")
+}
+
+// overlay writes the overlay of a Redact annotation, see 12.5.6.23.
+func (rd *redactor) overlay(b *bytes.Buffer, ra redactAnnotation, rr *redactedResources) error {
+
+	xRefTable := rd.xRefTable
+
+	if ir := ra.d.IndirectRefEntry("RO"); ir != nil {
+
+		sd, err := xRefTable.DereferenceStreamDict(*ir)
+		if err != nil || sd == nil {
+			return err
+		}
+
+		bb, err := xRefTable.numberArray(sd.Dict["BBox"])
+		if err != nil || len(bb) != 4 {
+			return errors.Errorf("pdfcpu: redact: invalid overlay form obj#%d", ir.ObjectNumber.Value())
+		}
+
+		m := identMatrix
+		if a, err := xRefTable.numberArray(sd.Dict["Matrix"]); err == nil && len(a) == 6 {
+			for i, f := range a {
+				m[i/2][i%2] = f
+			}
+		}
+
+		// Map the transformed form bounding box onto the annotation rectangle, see 12.5.5.
+		tbb := m.boundingBox(bb[0], bb[1], bb[2], bb[3])
+		if tbb.Width() == 0 || tbb.Height() == 0 {
+			return nil
+		}
+		sx, sy := ra.rect.Width()/tbb.Width(), ra.rect.Height()/tbb.Height()
+
+		name, err := rr.add(xRefTable, "XObject", "Rdct", *ir)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(b, "q %.4f 0 0 %.4f %.4f %.4f cm /%s Do Q\n", sx, sy, ra.rect.LL.X-tbb.LL.X*sx, ra.rect.LL.Y-tbb.LL.Y*sy, name)
+
+		return nil
+	}
+
+	if ic, err := xRefTable.numberArray(ra.d["IC"]); err == nil {
+		if c := colorOperator(ic); c != "" {
+			fmt.Fprintf(b, "q %s", c)
+			for _, r := range ra.areas {
+				fmt.Fprintf(b, " %.2f %.2f %.2f %.2f re", r.LL.X, r.LL.Y, r.Width(), r.Height())
+			}
+			b.WriteString(" f Q\n")
+		}
+	}
+
+	text, err := xRefTable.DereferenceText(ra.d["OverlayText"])
+	if err != nil || text == "" {
+		return nil
+	}
+
+	var da []content.Operation
+	if s, err := xRefTable.DereferenceStringOrHexLiteral(ra.d["DA"], V10, nil); err == nil {
+		// Ignore a malformed default appearance.
+		da, _ = content.Parse([]byte(s))
+	}
+
+	q := 0
+	if i := ra.d.IntEntry("Q"); i != nil {
+		q = *i
+	}
+
+	repeat := false
+	if r := ra.d.BooleanEntry("Repeat"); r != nil {
+		repeat = *r
+	}
+
+	fontDict := Dict(
+		map[string]Object{
+			"Type":     Name("Font"),
+			"Subtype":  Name("Type1"),
+			"BaseFont": Name("Helvetica"),
+			"Encoding": Name("WinAnsiEncoding"),
+		},
+	)
+
+	font, err := rr.add(xRefTable, "Font", "Rdct", fontDict)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range ra.areas {
+		overlayText(b, r, text, font, da, q, repeat)
+	}
+
+	return nil
+}
+
+// removeAnnotations removes the applied Redact annotations along with their popups from the page dict d.
+func (xRefTable *XRefTable) removeAnnotations(d Dict, ras []redactAnnotation) error {
+
+	a, err := xRefTable.DereferenceArray(d["Annots"])
+	if err != nil {
+		return err
+	}
+
+	removed := map[int]bool{}
+	for _, ra := range ras {
+		removed[ra.indRef.ObjectNumber.Value()] = true
+		if ra.popup != nil {
+			removed[ra.popup.ObjectNumber.Value()] = true
+		}
+	}
+
+	a1 := Array{}
+	for _, o := range a {
+		if ir, ok := o.(IndirectRef); ok && removed[ir.ObjectNumber.Value()] {
+			continue
+		}
+		a1 = append(a1, o)
+	}
+
+	if len(a1) == 0 {
+		d.Delete("Annots")
+		return nil
+	}
+
+	d.Update("Annots", a1)
+
+	return nil
+}
+
+func (rd *redactor) redactPage(d Dict, resources Dict, ras []redactAnnotation, rp *RedactParams) error {
+
+	b, err := rd.xRefTable.PageContent(d)
+	if err != nil {
+		return err
+	}
+
+	rd.ctm, rd.ts, rd.stack, rd.runs = identMatrix, textState{hScale: 1}, nil, nil
+	rd.tm, rd.tlm = identMatrix, identMatrix
+
+	rr := &redactedResources{orig: resources}
+
+	bb, _, err := rd.redactContent(b, rr)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	// Isolate the graphics state of the redacted content from the overlay.
+	buf.WriteString("q\n")
+	buf.Write(bb)
+	buf.WriteString("\nQ\n")
+
+	for _, ra := range ras {
+		if err = rd.overlay(&buf, ra, rr); err != nil {
+			return err
+		}
+	}
+
+	if n := len(rd.areas) - len(areasOf(ras)); n > 0 {
+		c := rp.Color
+		fmt.Fprintf(&buf, "q %.3f %.3f %.3f rg", c.r, c.g, c.b)
+		for _, r := range rd.areas[len(rd.areas)-n:] {
+			fmt.Fprintf(&buf, " %.2f %.2f %.2f %.2f re", r.LL.X, r.LL.Y, r.Width(), r.Height())
+		}
+		buf.WriteString(" f Q\n")
+	}
+
+	sd := StreamDict{
+		Dict:           NewDict(),
+		Content:        buf.Bytes(),
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}},
+		IsPageContent:  true,
+	}
+	sd.InsertName("Filter", filter.Flate)
+
+	if err = encodeStream(&sd); err != nil {
+		return err
+	}
+
+	ir, err := rd.xRefTable.IndRefForNewObject(sd)
+	if err != nil {
+		return err
+	}
+
+	d.Update("Contents", *ir)
+
+	if rr.copy != nil {
+		d.Update("Resources", rr.copy)
+	}
+
+	// The thumbnail image still shows the redacted content.
+	d.Delete("Thumb")
+
+	return rd.xRefTable.removeAnnotations(d, ras)
+}
+
+// redactStructElems removes the text of structure elements enclosing marked content in mcids along with their ancestors, see 14.7.2.
+// Marked content ids are keyed by the object number of the page or form XObject holding the content.
+// redactStructElems returns true if o encloses marked content in mcids.
+func (xRefTable *XRefTable) redactStructElems(o Object, pg *IndirectRef, mcids map[int]IntSet, visited IntSet) (bool, error) {
+
+	if ir, ok := o.(IndirectRef); ok {
+		if visited[ir.ObjectNumber.Value()] {
+			return false, nil
+		}
+		visited[ir.ObjectNumber.Value()] = true
+	}
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil || o == nil {
+		return false, err
+	}
+
+	redacted := func(owner *IndirectRef, mcid *int) bool {
+		return owner != nil && mcid != nil && mcids[owner.ObjectNumber.Value()][*mcid]
+	}
+
+	switch o := o.(type) {
+
+	case Integer:
+		mcid := o.Value()
+		return redacted(pg, &mcid), nil
+
+	case Array:
+		var found bool
+		for _, o1 := range o {
+			ok, err := xRefTable.redactStructElems(o1, pg, mcids, visited)
+			if err != nil {
+				return false, err
+			}
+			found = found || ok
+		}
+		return found, nil
+
+	case Dict:
+		if ir, ok := o["Pg"].(IndirectRef); ok {
+			pg = &ir
+		}
+
+		if t := o.Type(); t != nil {
+			switch *t {
+			case "OBJR":
+				return false, nil
+			case "MCR":
+				if ir, ok := o["Stm"].(IndirectRef); ok {
+					pg = &ir
+				}
+				return redacted(pg, o.IntEntry("MCID")), nil
+			}
+		}
+
+		found, err := xRefTable.redactStructElems(o["K"], pg, mcids, visited)
+		if err != nil || !found {
+			return false, err
+		}
+
+		for _, k := range markedContentTextKeys {
+			o.Delete(k)
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// redactStructTree removes the text of structure elements enclosing marked content in mcids.
+func (xRefTable *XRefTable) redactStructTree(mcids map[int]IntSet) error {
+
+	if len(mcids) == 0 {
+		return nil
+	}
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		return err
+	}
+
+	d, err := xRefTable.DereferenceDict(rootDict["StructTreeRoot"])
+	if err != nil || d == nil {
+		return err
+	}
+
+	_, err = xRefTable.redactStructElems(d["K"], nil, mcids, IntSet{})
+
+	return err
+}
+
+func areasOf(ras []redactAnnotation) []*Rectangle {
+	var rr []*Rectangle
+	for _, ra := range ras {
+		rr = append(rr, ra.areas...)
+	}
+	return rr
+}
+
+// ApplyRedactions removes the content within the areas marked by Redact annotations and rp
+// from the selected pages, paints the overlays and removes the Redact annotations.
+// Content within areas gets removed from content streams as well as from the images and form XObjects involved,
+// see redactor for details. Structure elements enclosing removed text lose their replacement and alternate text,
+// thumbnails of redacted pages get removed. Text matching rp.Pattern also gets removed from the document info dict
+// and the document's XMP metadata gets dropped if it contains matching text.
+// Shadings painted by sh, other annotations, bookmarks and metadata of pages or objects are left untouched.
+// ApplyRedactions returns the number of redacted pages.
+func ApplyRedactions(ctx *Context, selectedPages IntSet, rp *RedactParams) (int, error) {
+
+	if rp == nil {
+		rp = &RedactParams{}
+	}
+
+	var pageNrs []int
+	for i := 1; i <= ctx.PageCount; i++ {
+		if selectedPages == nil || selectedPages[i] {
+			pageNrs = append(pageNrs, i)
+		}
+	}
+
+	var (
+		matches = map[int][]*Rectangle{}
+		re      *regexp.Regexp
+		err     error
+	)
+
+	if rp.Pattern != "" {
+		if re, err = regexp.Compile(rp.Pattern); err != nil {
+			return 0, errors.Wrap(err, "pdfcpu: redact")
+		}
+		hits, err := SearchText(ctx, re, pageNrs)
+		if err != nil {
+			return 0, err
+		}
+		for _, h := range hits {
+			matches[h.Page] = append(matches[h.Page], h.Rects...)
+		}
+	}
+
+	rd := newRedactor(ctx, nil)
+	n := 0
+
+	for _, i := range pageNrs {
+
+		d, inhPAttrs, err := ctx.PageDict(i)
+		if err != nil {
+			return 0, err
+		}
+		if d == nil {
+			continue
+		}
+
+		ras, err := ctx.redactAnnotations(d)
+		if err != nil {
+			return 0, err
+		}
+
+		rd.areas = append(append(areasOf(ras), rp.Rects...), matches[i]...)
+		if len(rd.areas) == 0 {
+			continue
+		}
+
+		log.Info.Printf("redacting page %d: %d areas\n", i, len(rd.areas))
+
+		ir, err := ctx.PageDictIndRef(i)
+		if err != nil {
+			return 0, err
+		}
+		rd.owner = ir.ObjectNumber.Value()
+
+		if err = rd.redactPage(d, inhPAttrs.resources, ras, rp); err != nil {
+			return 0, errors.Wrapf(err, "page %d", i)
+		}
+
+		n++
+	}
+
+	if err := ctx.redactStructTree(rd.mcids); err != nil {
+		return 0, err
+	}
+
+	if re != nil {
+		if err := ctx.redactDocInfo(re); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// redactDocInfo removes text matching re from the document info dict
+// and drops the document's XMP metadata if it contains matching text.
+func (ctx *Context) redactDocInfo(re *regexp.Regexp) error {
+
+	if ctx.Info != nil {
+		d, err := ctx.DereferenceDict(*ctx.Info)
+		if err != nil {
+			return err
+		}
+		for k, v := range d {
+			if k == "CreationDate" || k == "ModDate" {
+				continue
+			}
+			s, err := ctx.DereferenceText(v)
+			if err != nil || !re.MatchString(s) {
+				continue
+			}
+			d.Update(k, textString(re.ReplaceAllString(s, "")))
+		}
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+
+	sd, err := ctx.DereferenceStreamDict(rootDict["Metadata"])
+	if err != nil || sd == nil {
+		return err
+	}
+
+	if err = decodeStream(sd); err != nil {
+		return err
+	}
+
+	if re.Match(sd.Content) {
+		log.Info.Println("redact: removing XMP metadata")
+		rootDict.Delete("Metadata")
+	}
+
+	return nil
+}
@@ -0,0 +1,1269 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/content"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// redactor removes the content within areas of a page from its content stream and the XObjects it paints.
+//
+// Glyphs whose bounding box is centered within an area get removed.
+// Stroked line segments get clipped, stroked curves touching an area and filled subpaths centered within an area get removed,
+// rectangles filled in an axis aligned coordinate system get cut.
+// Images touching an area get replaced by copies with the samples within the area cleared,
+// images which can't be decoded get removed. Form XObjects touching an area get replaced by redacted copies.
+// Marked content enclosing removed glyphs loses its replacement and alternate text.
+type redactor struct {
+	*textScanner
+	ctx   *Context
+	areas []*Rectangle   // In default user space.
+	owner int            // The object number of the page or form XObject whose content is being redacted.
+	mcids map[int]IntSet // Marked content ids of marked content enclosing removed glyphs by owner.
+}
+
+func newRedactor(ctx *Context, areas []*Rectangle) *redactor {
+
+	rd := &redactor{textScanner: newTextScanner(ctx.XRefTable), ctx: ctx, areas: areas, mcids: map[int]IntSet{}}
+	if ctx.Optimize != nil {
+		rd.fontObjects = ctx.Optimize.FontObjects
+	}
+
+	rd.ctm, rd.ts = identMatrix, textState{hScale: 1}
+
+	return rd
+}
+
+func (m matrix) inverse() (matrix, bool) {
+
+	det := m[0][0]*m[1][1] - m[0][1]*m[1][0]
+	if det == 0 {
+		return identMatrix, false
+	}
+
+	return matrix{
+		{m[1][1] / det, -m[0][1] / det, 0},
+		{-m[1][0] / det, m[0][0] / det, 0},
+		{(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det, (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det, 1},
+	}, true
+}
+
+// axisAligned returns true if m maps axis aligned rectangles onto axis aligned rectangles.
+func (m matrix) axisAligned() bool {
+	return m[0][1] == 0 && m[1][0] == 0 || m[0][0] == 0 && m[1][1] == 0
+}
+
+func intersects(r1, r2 *Rectangle) bool {
+	return r1.LL.X < r2.UR.X && r2.LL.X < r1.UR.X && r1.LL.Y < r2.UR.Y && r2.LL.Y < r1.UR.Y
+}
+
+func inside(r *Rectangle, x, y float64) bool {
+	return x >= r.LL.X && x <= r.UR.X && y >= r.LL.Y && y <= r.UR.Y
+}
+
+// touches returns true if bb intersects any area.
+func (rd *redactor) touches(bb *Rectangle) bool {
+	for _, a := range rd.areas {
+		if intersects(bb, a) || inside(a, bb.LL.X, bb.LL.Y) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers returns true if the center of bb lies within any area.
+func (rd *redactor) covers(bb *Rectangle) bool {
+	x, y := (bb.LL.X+bb.UR.X)/2, (bb.LL.Y+bb.UR.Y)/2
+	for _, a := range rd.areas {
+		if inside(a, x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+func number(f float64) content.Operand {
+	f = math.Round(f*1000) / 1000
+	if f == math.Trunc(f) && math.Abs(f) < 1e9 {
+		return content.Integer(f)
+	}
+	return content.Real(f)
+}
+
+// redactText removes the glyphs centered within areas from a text showing operation.
+// Removed glyphs are replaced by TJ position adjustments in order to keep the position of the remaining glyphs.
+func (rd *redactor) redactText(op content.Operation) ([]content.Operation, bool) {
+
+	ts := &rd.ts
+	f := ts.font
+	if f == nil {
+		f = defaultTextFont
+	}
+
+	var (
+		a       content.Array
+		kept    []byte
+		hex     bool
+		removed bool
+	)
+
+	flush := func() {
+		if len(kept) == 0 {
+			return
+		}
+		if hex {
+			a = append(a, content.HexString(kept))
+		} else {
+			a = append(a, content.LiteralString(kept))
+		}
+		kept = nil
+	}
+
+	shift := func(adj float64) {
+		flush()
+		if n := len(a); n > 0 {
+			if prev, ok := content.Numbers(a[n-1:]); ok {
+				a[n-1] = number(prev[0] + adj)
+				return
+			}
+		}
+		a = append(a, number(adj))
+	}
+
+	show := func(b []byte, isHex bool) {
+
+		if len(kept) > 0 && hex != isHex {
+			flush()
+		}
+		hex = isHex
+
+		for len(b) > 0 {
+
+			n := f.codeLength(b)
+			code := b[:n]
+			b = b[n:]
+
+			g, tx := rd.glyph(f, code)
+			rd.tm = translationMatrix(tx*ts.hScale, 0).multiply(rd.tm)
+
+			if !rd.covers(g.bbox) {
+				kept = append(kept, code...)
+				continue
+			}
+
+			removed = true
+			if ts.fontSize != 0 {
+				shift(-tx * 1000 / ts.fontSize)
+			}
+		}
+	}
+
+	var run TextRun
+
+	for _, o := range shownText(op) {
+		switch o := o.(type) {
+		case content.LiteralString:
+			show([]byte(o), false)
+		case content.HexString:
+			show([]byte(o), true)
+		case content.Array:
+			for _, o := range o {
+				switch o := o.(type) {
+				case content.LiteralString:
+					show([]byte(o), false)
+				case content.HexString:
+					show([]byte(o), true)
+				case content.Integer, content.Real:
+					f, _ := content.Numbers([]content.Operand{o})
+					rd.adjust(f[0], &run)
+					shift(f[0])
+				}
+			}
+		}
+	}
+
+	if !removed {
+		return []content.Operation{op}, false
+	}
+
+	flush()
+
+	var ops []content.Operation
+
+	switch op.Operator {
+	case "'":
+		ops = append(ops, content.Operation{Operator: "T*"})
+	case "\"":
+		ops = append(ops,
+			content.Operation{Operator: "Tw", Operands: op.Operands[:1]},
+			content.Operation{Operator: "Tc", Operands: op.Operands[1:2]},
+			content.Operation{Operator: "T*"})
+	}
+
+	if len(a) > 0 {
+		ops = append(ops, content.Operation{Operator: "TJ", Operands: []content.Operand{a}})
+	}
+
+	return ops, true
+}
+
+// pathSegment represents a line, a Bézier curve or the closing line of a subpath.
+type pathSegment struct {
+	op  string    // l, c or h
+	pts []float64 // The current point followed by the control and end points.
+}
+
+// subpath represents a subpath of a path in the coordinate system the path has been constructed in.
+type subpath struct {
+	segs []pathSegment
+	re   []float64 // x, y, width and height if constructed by re.
+}
+
+func parsePath(path []content.Operation) []*subpath {
+
+	var (
+		sps          []*subpath
+		sp           *subpath
+		x0, y0, x, y float64
+	)
+
+	segment := func(op string, pts ...float64) {
+		if sp == nil {
+			sp = &subpath{}
+			sps = append(sps, sp)
+			x0, y0 = x, y
+		}
+		sp.segs = append(sp.segs, pathSegment{op: op, pts: append([]float64{x, y}, pts...)})
+		x, y = pts[len(pts)-2], pts[len(pts)-1]
+	}
+
+	for _, op := range path {
+
+		f, ok := content.Numbers(op.Operands)
+		if !ok {
+			continue
+		}
+
+		switch {
+
+		case op.Operator == "m" && len(f) == 2:
+			sp = &subpath{}
+			sps = append(sps, sp)
+			x0, y0, x, y = f[0], f[1], f[0], f[1]
+
+		case op.Operator == "l" && len(f) == 2:
+			segment("l", f...)
+
+		case op.Operator == "c" && len(f) == 6:
+			segment("c", f...)
+
+		case op.Operator == "v" && len(f) == 4:
+			segment("c", x, y, f[0], f[1], f[2], f[3])
+
+		case op.Operator == "y" && len(f) == 4:
+			segment("c", f[0], f[1], f[2], f[3], f[2], f[3])
+
+		case op.Operator == "h":
+			if sp != nil {
+				segment("h", x0, y0)
+				sp = nil
+			}
+
+		case op.Operator == "re" && len(f) == 4:
+			x, y = f[0], f[1]
+			sp = nil
+			segment("l", f[0]+f[2], f[1])
+			segment("l", f[0]+f[2], f[1]+f[3])
+			segment("l", f[0], f[1]+f[3])
+			segment("h", f[0], f[1])
+			sp.re = f
+			sp = nil
+		}
+	}
+
+	return sps
+}
+
+// boundingBox returns the bounding box of the points of a subpath in user space.
+func (sp *subpath) boundingBox(ctm matrix) *Rectangle {
+
+	var bb *Rectangle
+
+	for _, seg := range sp.segs {
+		for i := 0; i < len(seg.pts); i += 2 {
+			x, y := ctm.transform(seg.pts[i], seg.pts[i+1])
+			bb = union(bb, Rect(x, y, x, y))
+		}
+	}
+
+	return bb
+}
+
+// pathWriter writes path construction operators.
+type pathWriter struct {
+	ops          []content.Operation
+	x, y         float64
+	hasPoint     bool
+	subpathStart int
+}
+
+func (pw *pathWriter) moveTo(x, y float64) {
+	pw.ops = append(pw.ops, content.Operation{Operator: "m", Operands: []content.Operand{number(x), number(y)}})
+	pw.x, pw.y, pw.hasPoint = x, y, true
+	pw.subpathStart = len(pw.ops) - 1
+}
+
+func (pw *pathWriter) ensurePoint(x, y float64) {
+	if !pw.hasPoint || pw.x != x || pw.y != y {
+		pw.moveTo(x, y)
+	}
+}
+
+func (pw *pathWriter) segment(seg pathSegment) {
+
+	pts := seg.pts
+	pw.ensurePoint(pts[0], pts[1])
+
+	op := content.Operation{Operator: seg.op}
+	if seg.op != "h" {
+		for _, f := range pts[2:] {
+			op.Operands = append(op.Operands, number(f))
+		}
+	}
+	pw.ops = append(pw.ops, op)
+
+	pw.x, pw.y = pts[len(pts)-2], pts[len(pts)-1]
+}
+
+func (pw *pathWriter) rect(r *Rectangle) {
+	pw.ops = append(pw.ops, content.Operation{Operator: "re", Operands: []content.Operand{number(r.LL.X), number(r.LL.Y), number(r.Width()), number(r.Height())}})
+	pw.x, pw.y, pw.hasPoint = r.LL.X, r.LL.Y, true
+}
+
+func (pw *pathWriter) subpath(sp *subpath) {
+	if sp.re != nil {
+		pw.ops = append(pw.ops, content.Operation{Operator: "re", Operands: []content.Operand{number(sp.re[0]), number(sp.re[1]), number(sp.re[2]), number(sp.re[3])}})
+		pw.x, pw.y, pw.hasPoint = sp.re[0], sp.re[1], true
+		return
+	}
+	pw.hasPoint = false
+	for _, seg := range sp.segs {
+		pw.segment(seg)
+	}
+}
+
+// subtract returns the parts of r outside of a.
+func subtract(r, a *Rectangle) []*Rectangle {
+
+	if !intersects(r, a) {
+		return []*Rectangle{r}
+	}
+
+	var rr []*Rectangle
+
+	if a.LL.Y > r.LL.Y {
+		rr = append(rr, Rect(r.LL.X, r.LL.Y, r.UR.X, a.LL.Y))
+	}
+	if a.UR.Y < r.UR.Y {
+		rr = append(rr, Rect(r.LL.X, a.UR.Y, r.UR.X, r.UR.Y))
+	}
+
+	y0, y1 := math.Max(r.LL.Y, a.LL.Y), math.Min(r.UR.Y, a.UR.Y)
+	if a.LL.X > r.LL.X {
+		rr = append(rr, Rect(r.LL.X, y0, a.LL.X, y1))
+	}
+	if a.UR.X < r.UR.X {
+		rr = append(rr, Rect(a.UR.X, y0, r.UR.X, y1))
+	}
+
+	return rr
+}
+
+// clipLine returns the parameter interval of the line x0,y0 x1,y1 within r, see Liang-Barsky.
+func clipLine(r *Rectangle, x0, y0, x1, y1 float64) (float64, float64, bool) {
+
+	t0, t1 := 0., 1.
+	dx, dy := x1-x0, y1-y0
+
+	for _, e := range [4][2]float64{{-dx, x0 - r.LL.X}, {dx, r.UR.X - x0}, {-dy, y0 - r.LL.Y}, {dy, r.UR.Y - y0}} {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = math.Max(t0, t)
+		} else {
+			t1 = math.Min(t1, t)
+		}
+		if t0 >= t1 {
+			return 0, 0, false
+		}
+	}
+
+	return t0, t1, true
+}
+
+// visibleParts returns the parameter intervals of a line in user space outside of all areas.
+func (rd *redactor) visibleParts(x0, y0, x1, y1 float64) [][2]float64 {
+
+	var hidden [][2]float64
+	for _, a := range rd.areas {
+		if t0, t1, ok := clipLine(a, x0, y0, x1, y1); ok {
+			hidden = append(hidden, [2]float64{t0, t1})
+		}
+	}
+
+	sort.Slice(hidden, func(i, j int) bool { return hidden[i][0] < hidden[j][0] })
+
+	var visible [][2]float64
+	t := 0.
+	for _, h := range hidden {
+		if h[0] > t {
+			visible = append(visible, [2]float64{t, h[0]})
+		}
+		t = math.Max(t, h[1])
+	}
+	if t < 1 {
+		visible = append(visible, [2]float64{t, 1})
+	}
+
+	return visible
+}
+
+// fillPath writes the subpaths of a filled path not covered by areas.
+func (rd *redactor) fillPath(sps []*subpath) []content.Operation {
+
+	pw := &pathWriter{}
+	inv, invertible := rd.ctm.inverse()
+
+	for _, sp := range sps {
+
+		bb := sp.boundingBox(rd.ctm)
+		if !rd.touches(bb) {
+			pw.subpath(sp)
+			continue
+		}
+
+		if sp.re != nil && rd.ctm.axisAligned() && invertible {
+			rr := []*Rectangle{bb}
+			for _, a := range rd.areas {
+				var rr1 []*Rectangle
+				for _, r := range rr {
+					rr1 = append(rr1, subtract(r, a)...)
+				}
+				rr = rr1
+			}
+			for _, r := range rr {
+				pw.rect(inv.boundingBox(r.LL.X, r.LL.Y, r.UR.X, r.UR.Y))
+			}
+			continue
+		}
+
+		if !rd.covers(bb) {
+			pw.subpath(sp)
+		}
+	}
+
+	return pw.ops
+}
+
+// strokePath writes the segments of a stroked path not covered by areas.
+// Lines get clipped, curves touching an area get removed.
+func (rd *redactor) strokePath(sps []*subpath) []content.Operation {
+
+	pw := &pathWriter{}
+
+	for _, sp := range sps {
+
+		if !rd.touches(sp.boundingBox(rd.ctm)) {
+			pw.subpath(sp)
+			continue
+		}
+
+		pw.hasPoint = false
+
+		for _, seg := range sp.segs {
+
+			pts := seg.pts
+
+			if seg.op == "c" {
+				if !rd.touches((&subpath{segs: []pathSegment{seg}}).boundingBox(rd.ctm)) {
+					pw.segment(seg)
+				}
+				continue
+			}
+
+			x0, y0 := rd.ctm.transform(pts[0], pts[1])
+			x1, y1 := rd.ctm.transform(pts[2], pts[3])
+
+			for _, t := range rd.visibleParts(x0, y0, x1, y1) {
+				dx, dy := pts[2]-pts[0], pts[3]-pts[1]
+				pw.segment(pathSegment{op: "l", pts: []float64{pts[0] + t[0]*dx, pts[1] + t[0]*dy, pts[0] + t[1]*dx, pts[1] + t[1]*dy}})
+			}
+		}
+	}
+
+	return pw.ops
+}
+
+// redactPath removes the parts of a painted path within areas.
+func (rd *redactor) redactPath(path []content.Operation, clip *content.Operation, paint content.Operation) ([]content.Operation, bool) {
+
+	unchanged := append(append([]content.Operation(nil), path...), paint)
+	if clip != nil {
+		unchanged = append(path, *clip, paint)
+	}
+
+	if paint.Operator == "n" || len(path) == 0 {
+		return unchanged, false
+	}
+
+	sps := parsePath(path)
+
+	var bb *Rectangle
+	for _, sp := range sps {
+		bb = union(bb, sp.boundingBox(rd.ctm))
+	}
+	if bb == nil || !rd.touches(bb) {
+		return unchanged, false
+	}
+
+	var ops []content.Operation
+
+	if clip != nil {
+		// Keep the clipping path.
+		ops = append(append(ops, path...), *clip, content.Operation{Operator: "n"})
+	}
+
+	fillOp := ""
+	switch paint.Operator {
+	case "f", "F", "B", "b":
+		fillOp = "f"
+	case "f*", "B*", "b*":
+		fillOp = "f*"
+	}
+
+	if fillOp != "" {
+		if fill := rd.fillPath(sps); len(fill) > 0 {
+			ops = append(append(ops, fill...), content.Operation{Operator: fillOp})
+		}
+	}
+
+	switch paint.Operator {
+	case "s", "b", "b*":
+		// Close the last subpath before stroking.
+		if sp := sps[len(sps)-1]; sp.segs[len(sp.segs)-1].op != "h" {
+			first, last := sp.segs[0].pts, sp.segs[len(sp.segs)-1].pts
+			sp.segs = append(sp.segs, pathSegment{op: "h", pts: []float64{last[len(last)-2], last[len(last)-1], first[0], first[1]}})
+		}
+		fallthrough
+	case "S", "B", "B*":
+		if stroke := rd.strokePath(sps); len(stroke) > 0 {
+			ops = append(append(ops, stroke...), content.Operation{Operator: "S"})
+		}
+	}
+
+	return ops, true
+}
+
+// redactedResources lazily copies a resource dict for registering redacted XObjects and overlay resources.
+type redactedResources struct {
+	orig, copy Dict
+	replaced   []string          // XObjects replaced by redacted copies or removed.
+	props      map[string]string // Names of the copies without text of replaced property lists.
+}
+
+func copyDict(d Dict) Dict {
+	d1 := NewDict()
+	for k, v := range d {
+		d1[k] = v
+	}
+	return d1
+}
+
+// category returns the copy of the resource category cat.
+func (rr *redactedResources) category(xRefTable *XRefTable, cat string) (Dict, error) {
+
+	if rr.copy == nil {
+		rr.copy = copyDict(rr.orig)
+	}
+
+	d, err := xRefTable.DereferenceDict(rr.copy[cat])
+	if err != nil {
+		return nil, err
+	}
+	d = copyDict(d)
+	rr.copy[cat] = d
+
+	return d, nil
+}
+
+// add registers o under a new name in the resource category cat.
+func (rr *redactedResources) add(xRefTable *XRefTable, cat, prefix string, o Object) (string, error) {
+
+	d, err := rr.category(xRefTable, cat)
+	if err != nil {
+		return "", err
+	}
+
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		if _, found := d.Find(name); !found {
+			d.Insert(name, o)
+			return name, nil
+		}
+	}
+}
+
+// prune removes the replaced resources of category cat no longer used in order to get rid of the unredacted originals.
+func (rr *redactedResources) prune(xRefTable *XRefTable, cat string, replaced []string, used map[string]bool) error {
+
+	if len(replaced) == 0 {
+		return nil
+	}
+
+	d, err := rr.category(xRefTable, cat)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range replaced {
+		if !used[name] {
+			d.Delete(name)
+		}
+	}
+
+	return nil
+}
+
+// sampleComponents returns the number of color components of an image, 0 if unknown.
+func sampleComponents(xRefTable *XRefTable, o Object) int {
+
+	o, err := xRefTable.Dereference(o)
+	if err != nil {
+		return 0
+	}
+
+	switch cs := o.(type) {
+
+	case Name:
+		switch cs {
+		case DeviceGrayCS, CalGrayCS, "Indexed", "Separation":
+			return 1
+		case DeviceRGBCS, CalRGBCS, LabCS:
+			return 3
+		case DeviceCMYKCS:
+			return 4
+		}
+
+	case Array:
+		if len(cs) < 2 {
+			return 0
+		}
+		n, _ := cs[0].(Name)
+		switch n {
+		case ICCBasedCS:
+			sd, err := xRefTable.DereferenceStreamDict(cs[1])
+			if err != nil || sd == nil {
+				return 0
+			}
+			if n := sd.IntEntry("N"); n != nil {
+				return *n
+			}
+		case IndexedCS, SeparationCS:
+			return 1
+		case DeviceNCS:
+			if a, err := xRefTable.DereferenceArray(cs[1]); err == nil {
+				return len(a)
+			}
+		default:
+			return sampleComponents(xRefTable, cs[0])
+		}
+	}
+
+	return 0
+}
+
+// clearSamples clears or sets all bits of the samples of the pixels x0..x1, y0..y1 of an image.
+func clearSamples(p []byte, w, n, bpc, x0, y0, x1, y1 int, set bool) {
+
+	rowLen := (w*n*bpc + 7) / 8
+
+	for y := y0; y < y1; y++ {
+		row := p[y*rowLen : (y+1)*rowLen]
+		for bit := x0 * n * bpc; bit < x1*n*bpc; bit++ {
+			if set {
+				row[bit/8] |= 0x80 >> uint(bit%8)
+				continue
+			}
+			row[bit/8] &^= 0x80 >> uint(bit%8)
+		}
+	}
+}
+
+// redactImage returns a copy of an image with the samples within areas cleared
+// or nil if the image can't be decoded.
+func (rd *redactor) redactImage(sd *StreamDict) (*IndirectRef, error) {
+
+	sd1 := *sd
+	sd1.Dict = copyDict(sd.Dict)
+	sd1.Content = nil
+
+	w, h, bpc, n := sd1.IntEntry("Width"), sd1.IntEntry("Height"), sd1.IntEntry("BitsPerComponent"), 0
+
+	// Image masks paint samples of 0 unless decoded inversely.
+	mask := false
+
+	if im := sd1.BooleanEntry("ImageMask"); im != nil && *im {
+		one := 1
+		bpc, n, mask = &one, 1, true
+		if d, err := rd.xRefTable.numberArray(sd1.Dict["Decode"]); err == nil && len(d) == 2 && d[0] == 1 {
+			mask = false
+		}
+	} else {
+		n = sampleComponents(rd.xRefTable, sd1.Dict["ColorSpace"])
+	}
+
+	if w == nil || h == nil || bpc == nil || *w <= 0 || *h <= 0 || n == 0 {
+		return nil, nil
+	}
+
+	if err := decodeStream(&sd1); err != nil {
+		log.Info.Printf("redactImage: %v\n", err)
+		return nil, nil
+	}
+
+	rowLen := (*w*n**bpc + 7) / 8
+	if len(sd1.Content) < rowLen**h {
+		return nil, nil
+	}
+	p := append([]byte(nil), sd1.Content[:rowLen**h]...)
+
+	inv, ok := rd.ctm.inverse()
+	if !ok {
+		return nil, nil
+	}
+
+	for _, a := range rd.areas {
+
+		// The area in image space.
+		r := inv.boundingBox(a.LL.X, a.LL.Y, a.UR.X, a.UR.Y)
+		if r.UR.X <= 0 || r.LL.X >= 1 || r.UR.Y <= 0 || r.LL.Y >= 1 {
+			continue
+		}
+
+		// Sample rows run from top to bottom.
+		x0 := int(math.Max(0, math.Floor(r.LL.X*float64(*w))))
+		x1 := int(math.Min(float64(*w), math.Ceil(r.UR.X*float64(*w))))
+		y0 := int(math.Max(0, math.Floor((1-r.UR.Y)*float64(*h))))
+		y1 := int(math.Min(float64(*h), math.Ceil((1-r.LL.Y)*float64(*h))))
+
+		clearSamples(p, *w, n, *bpc, x0, y0, x1, y1, mask)
+	}
+
+	raw, err := encodeFlate(p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	setFilterPipeline(&sd1, []PDFFilter{{Name: filter.Flate}})
+	sd1.Raw, sd1.Content, sd1.source = raw, nil, nil
+	streamLength := int64(len(raw))
+	sd1.StreamLength, sd1.StreamLengthObjNr = &streamLength, nil
+	sd1.Update("Length", Integer(streamLength))
+	sd1.Update("BitsPerComponent", Integer(*bpc))
+	sd1.Delete("Length1")
+
+	return rd.xRefTable.IndRefForNewObject(sd1)
+}
+
+// Abbreviations used by inline images, see 8.9.7.
+var (
+	inlineImageKeys = map[string]string{
+		"BPC": "BitsPerComponent", "CS": "ColorSpace", "D": "Decode", "DP": "DecodeParms",
+		"F": "Filter", "H": "Height", "IM": "ImageMask", "I": "Interpolate", "W": "Width",
+	}
+	inlineImageNames = map[string]string{
+		"G": "DeviceGray", "RGB": "DeviceRGB", "CMYK": "DeviceCMYK", "I": "Indexed",
+		"AHx": "ASCIIHexDecode", "A85": "ASCII85Decode", "LZW": "LZWDecode", "Fl": "FlateDecode",
+		"RL": "RunLengthDecode", "CCF": "CCITTFaxDecode", "DCT": "DCTDecode",
+	}
+)
+
+// inlineImageObject converts an inline image operand into an object expanding abbreviated names.
+func inlineImageObject(o content.Operand) Object {
+
+	switch o := o.(type) {
+	case content.Integer:
+		return Integer(o)
+	case content.Real:
+		return Float(o)
+	case content.Boolean:
+		return Boolean(o)
+	case content.Name:
+		if n, ok := inlineImageNames[string(o)]; ok {
+			return Name(n)
+		}
+		return Name(o)
+	case content.LiteralString:
+		return NewHexLiteral([]byte(o))
+	case content.HexString:
+		return NewHexLiteral([]byte(o))
+	case content.Array:
+		a := Array{}
+		for _, o := range o {
+			a = append(a, inlineImageObject(o))
+		}
+		return a
+	case content.Dict:
+		d := NewDict()
+		for k, v := range o {
+			d.Insert(k, inlineImageObject(v))
+		}
+		return d
+	}
+
+	return nil
+}
+
+// inlineImageStreamDict converts an inline image into an image XObject.
+func (rd *redactor) inlineImageStreamDict(im *content.InlineImage, resources Dict) (*StreamDict, error) {
+
+	d := NewDict()
+	d.InsertName("Type", "XObject")
+	d.InsertName("Subtype", "Image")
+
+	for k, v := range im.Dict {
+		if k1, ok := inlineImageKeys[k]; ok {
+			k = k1
+		}
+		if k == "L" || k == "Length" {
+			continue
+		}
+		d.Insert(k, inlineImageObject(v))
+	}
+
+	// Color spaces other than the device color spaces refer to the ColorSpace resources.
+	if n, ok := d["ColorSpace"].(Name); ok && !MemberOf(string(n), []string{DeviceGrayCS, DeviceRGBCS, DeviceCMYKCS}) {
+		csd, err := rd.xRefTable.DereferenceDict(resources["ColorSpace"])
+		if err != nil || csd == nil {
+			return nil, errors.Errorf("pdfcpu: redact: unknown inline image color space %s", n)
+		}
+		o, found := csd.Find(string(n))
+		if !found {
+			return nil, errors.Errorf("pdfcpu: redact: unknown inline image color space %s", n)
+		}
+		d.Update("ColorSpace", o)
+	}
+
+	fpl, err := pdfFilterPipeline(rd.ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamDict{Dict: d, Raw: im.Data, FilterPipeline: fpl}, nil
+}
+
+// redactForm returns a redacted copy of a form XObject or nil if the form is unaffected.
+func (rd *redactor) redactForm(ir IndirectRef, sd *StreamDict, resources Dict) (*IndirectRef, error) {
+
+	objNr := ir.ObjectNumber.Value()
+	if rd.forms[objNr] {
+		return nil, nil
+	}
+
+	m := identMatrix
+	if a, err := rd.xRefTable.numberArray(sd.Dict["Matrix"]); err == nil && len(a) == 6 {
+		for i, f := range a {
+			m[i/2][i%2] = f
+		}
+	}
+
+	if bb, err := rd.xRefTable.numberArray(sd.Dict["BBox"]); err == nil && len(bb) == 4 {
+		if !rd.touches(m.multiply(rd.ctm).boundingBox(bb[0], bb[1], bb[2], bb[3])) {
+			return nil, nil
+		}
+	}
+
+	formResources, err := rd.xRefTable.DereferenceDict(sd.Dict["Resources"])
+	if err != nil {
+		return nil, err
+	}
+	if formResources == nil {
+		formResources = resources
+	}
+
+	if err = decodeStream(sd); err != nil {
+		return nil, errors.Wrapf(err, "pdfcpu: redact: form obj#%d", objNr)
+	}
+
+	rd.forms[objNr] = true
+	defer delete(rd.forms, objNr)
+
+	// Structure elements refer to marked content of form XObjects by the original form.
+	defer func(owner int) { rd.owner = owner }(rd.owner)
+	rd.owner = objNr
+
+	// A form XObject is painted within its own q/Q pair.
+	rd.push()
+	defer rd.pop()
+
+	rd.ctm = m.multiply(rd.ctm)
+
+	rr := &redactedResources{orig: formResources}
+
+	b, changed, err := rd.redactContent(sd.Content, rr)
+	if err != nil || !changed {
+		return nil, err
+	}
+
+	sd1 := StreamDict{Dict: copyDict(sd.Dict), Content: b, FilterPipeline: []PDFFilter{{Name: filter.Flate}}}
+	setFilterPipeline(&sd1, sd1.FilterPipeline)
+	sd1.Delete("Length")
+	if rr.copy != nil {
+		sd1.Update("Resources", rr.copy)
+	} else if formResources != nil {
+		sd1.Update("Resources", formResources)
+	}
+
+	if err = encodeStream(&sd1); err != nil {
+		return nil, err
+	}
+
+	return rd.xRefTable.IndRefForNewObject(sd1)
+}
+
+// redactXObject redacts the XObject painted by a Do operation.
+func (rd *redactor) redactXObject(op content.Operation, rr *redactedResources) ([]content.Operation, bool, error) {
+
+	unchanged := []content.Operation{op}
+
+	if len(op.Operands) != 1 {
+		return unchanged, false, nil
+	}
+	name, ok := op.Operands[0].(content.Name)
+	if !ok {
+		return unchanged, false, nil
+	}
+
+	d, err := rd.xRefTable.DereferenceDict(rr.orig["XObject"])
+	if err != nil || d == nil {
+		return unchanged, false, err
+	}
+
+	ir, ok := d[string(name)].(IndirectRef)
+	if !ok {
+		return unchanged, false, nil
+	}
+
+	sd, err := rd.xRefTable.DereferenceStreamDict(ir)
+	if err != nil || sd == nil {
+		return unchanged, false, err
+	}
+
+	var ir1 *IndirectRef
+
+	switch st := sd.Subtype(); {
+
+	case st != nil && *st == "Image":
+		if !rd.touches(rd.ctm.boundingBox(0, 0, 1, 1)) {
+			return unchanged, false, nil
+		}
+		if ir1, err = rd.redactImage(sd); err != nil {
+			return nil, false, err
+		}
+		if ir1 == nil {
+			log.Info.Printf("redact: removing image obj#%d\n", ir.ObjectNumber.Value())
+			rr.replaced = append(rr.replaced, string(name))
+			return nil, true, nil
+		}
+
+	case st != nil && *st == "Form":
+		if ir1, err = rd.redactForm(ir, sd, rr.orig); err != nil || ir1 == nil {
+			return unchanged, false, err
+		}
+
+	default:
+		return unchanged, false, nil
+	}
+
+	rr.replaced = append(rr.replaced, string(name))
+
+	name1, err := rr.add(rd.xRefTable, "XObject", "Rdct", *ir1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return []content.Operation{{Operator: "Do", Operands: []content.Operand{content.Name(name1)}}}, true, nil
+}
+
+// redactInlineImage redacts an inline image by converting it into an image XObject.
+func (rd *redactor) redactInlineImage(op content.Operation, rr *redactedResources) ([]content.Operation, bool, error) {
+
+	im := op.InlineImage()
+	if im == nil || !rd.touches(rd.ctm.boundingBox(0, 0, 1, 1)) {
+		return []content.Operation{op}, false, nil
+	}
+
+	sd, err := rd.inlineImageStreamDict(im, rr.orig)
+	if err != nil {
+		log.Info.Printf("redact: removing inline image: %v\n", err)
+		return nil, true, nil
+	}
+
+	ir, err := rd.redactImage(sd)
+	if err != nil {
+		return nil, false, err
+	}
+	if ir == nil {
+		log.Info.Println("redact: removing inline image")
+		return nil, true, nil
+	}
+
+	name, err := rr.add(rd.xRefTable, "XObject", "Rdct", *ir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return []content.Operation{{Operator: "Do", Operands: []content.Operand{content.Name(name)}}}, true, nil
+}
+
+// Keys of marked content property lists holding text, see 14.9.
+var markedContentTextKeys = []string{"ActualText", "Alt", "E"}
+
+// redactContent removes the content within areas from a content stream.
+// Redacted XObjects get registered with rr.
+func (rd *redactor) redactContent(b []byte, rr *redactedResources) ([]byte, bool, error) {
+
+	ops, err := content.Parse(b)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "pdfcpu: redact")
+	}
+
+	var (
+		out      []content.Operation
+		path     []content.Operation
+		clip     *content.Operation
+		marked   []int        // Indices of open marked content operations.
+		textless map[int]bool // Marked content operations enclosing removed glyphs.
+		changed  bool
+	)
+
+	for _, op := range ops {
+
+		switch op.Operator {
+
+		case "m", "l", "c", "v", "y", "h", "re":
+			path = append(path, op)
+			continue
+
+		case "W", "W*":
+			if path != nil {
+				c := op
+				clip = &c
+				continue
+			}
+
+		case "S", "s", "f", "F", "f*", "B", "B*", "b", "b*", "n":
+			ops1, ch := rd.redactPath(path, clip, op)
+			out, changed, path, clip = append(out, ops1...), changed || ch, nil, nil
+			continue
+		}
+
+		if path != nil {
+			// Unterminated path.
+			out, path = append(out, path...), nil
+			if clip != nil {
+				out, clip = append(out, *clip), nil
+			}
+		}
+
+		rd.apply(op, rr.orig)
+
+		var (
+			ops1 []content.Operation
+			ch   bool
+		)
+
+		switch op.Operator {
+
+		case "BMC", "BDC":
+			marked = append(marked, len(out))
+
+		case "EMC":
+			if len(marked) > 0 {
+				marked = marked[:len(marked)-1]
+			}
+
+		case "Tj", "TJ", "'", "\"":
+			if ops1, ch = rd.redactText(op); ch {
+				if textless == nil {
+					textless = map[int]bool{}
+				}
+				for _, i := range marked {
+					textless[i] = true
+				}
+			}
+
+		case "Do":
+			if ops1, ch, err = rd.redactXObject(op, rr); err != nil {
+				return nil, false, err
+			}
+
+		case "BI":
+			if ops1, ch, err = rd.redactInlineImage(op, rr); err != nil {
+				return nil, false, err
+			}
+		}
+
+		if !ch {
+			out = append(out, op)
+			continue
+		}
+
+		out, changed = append(out, ops1...), true
+	}
+
+	out = append(out, path...)
+
+	painted := map[string]bool{}
+	for _, op := range out {
+		if op.Operator == "Do" && len(op.Operands) == 1 {
+			if n, ok := op.Operands[0].(content.Name); ok {
+				painted[string(n)] = true
+			}
+		}
+	}
+
+	if err = rr.prune(rd.xRefTable, "XObject", rr.replaced, painted); err != nil {
+		return nil, false, err
+	}
+
+	// Marked content enclosing removed glyphs must not reveal their text.
+	for i := range textless {
+
+		if len(out[i].Operands) != 2 {
+			continue
+		}
+
+		switch props := out[i].Operands[1].(type) {
+
+		case content.Dict:
+			if mcid, ok := props["MCID"].(content.Integer); ok {
+				rd.addMCID(int(mcid))
+			}
+			d1 := content.Dict{}
+			for k, v := range props {
+				if !MemberOf(k, markedContentTextKeys) {
+					d1[k] = v
+				}
+			}
+			out[i].Operands = []content.Operand{out[i].Operands[0], d1}
+
+		case content.Name:
+			name, err := rd.redactProperties(string(props), rr)
+			if err != nil {
+				return nil, false, err
+			}
+			out[i].Operands = []content.Operand{out[i].Operands[0], content.Name(name)}
+		}
+	}
+
+	used := map[string]bool{}
+	for _, op := range out {
+		if (op.Operator == "BDC" || op.Operator == "DP") && len(op.Operands) == 2 {
+			if n, ok := op.Operands[1].(content.Name); ok {
+				used[string(n)] = true
+			}
+		}
+	}
+
+	var replaced []string
+	for name := range rr.props {
+		replaced = append(replaced, name)
+	}
+
+	if err = rr.prune(rd.xRefTable, "Properties", replaced, used); err != nil {
+		return nil, false, err
+	}
+
+	return content.Bytes(out), changed, nil
+}
+
+func (rd *redactor) addMCID(mcid int) {
+	if rd.mcids[rd.owner] == nil {
+		rd.mcids[rd.owner] = IntSet{}
+	}
+	rd.mcids[rd.owner][mcid] = true
+}
+
+// redactProperties returns the name of a copy of the property list name without text
+// or name if the property list holds no text.
+func (rd *redactor) redactProperties(name string, rr *redactedResources) (string, error) {
+
+	if name1, ok := rr.props[name]; ok {
+		return name1, nil
+	}
+
+	props, err := rd.xRefTable.DereferenceDict(rr.orig["Properties"])
+	if err != nil || props == nil {
+		return name, err
+	}
+
+	d, err := rd.xRefTable.DereferenceDict(props[name])
+	if err != nil || d == nil {
+		return name, err
+	}
+
+	if mcid := d.IntEntry("MCID"); mcid != nil {
+		rd.addMCID(*mcid)
+	}
+
+	d1 := NewDict()
+	for k, v := range d {
+		if !MemberOf(k, markedContentTextKeys) {
+			d1[k] = v
+		}
+	}
+
+	if len(d1) == len(d) {
+		return name, nil
+	}
+
+	name1, err := rr.add(rd.xRefTable, "Properties", "Rdct", d1)
+	if err != nil {
+		return "", err
+	}
+
+	if rr.props == nil {
+		rr.props = map[string]string{}
+	}
+	rr.props[name] = name1
+
+	return name1, nil
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseRedactDetails(t *testing.T) {
+
+	rp := &RedactParams{}
+	if err := ParseRedactDetails("rect:10 10 50 20, r:0 0 100 100, c:1 0 0, pat:a,b", rp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rp.Rects) != 2 || rp.Rects[1].UR.X != 100 || rp.Color != (SimpleColor{1, 0, 0}) || rp.Pattern != "a,b" {
+		t.Errorf("unexpected redaction params: %+v", rp)
+	}
+
+	for _, s := range []string{"", "rect:1 2 3", "rect:5 5 1 1", "color:2 0 0", "pattern:(", "foo:bar"} {
+		if err := ParseRedactDetails(s, &RedactParams{}); err == nil {
+			t.Errorf("%q: want error", s)
+		}
+	}
+}
+
+func TestRedactContent(t *testing.T) {
+
+	resources := Dict{"Font": Dict{
+		"F1": Dict{
+			"Type":     Name("Font"),
+			"Subtype":  Name("Type1"),
+			"BaseFont": Name("Helvetica"),
+		},
+	}}
+
+	b := []byte(`BT /F1 10 Tf 100 700 Td (Hello Secret World) Tj ET
+		0 0 m 300 0 l S
+		50 50 200 100 re f
+		q 100 0 0 100 300 300 cm BI /W 4 /H 4 /CS /G /BPC 8 ID ABCDEFGHIJKLMNOP EI Q`)
+
+	// "Secret" starts at 125.56 and ends at 154.46.
+	// The lower left quarter of the image gets cleared.
+	areas := []*Rectangle{Rect(125, 690, 155, 715), Rect(100, -10, 150, 120), Rect(290, 290, 350, 350)}
+
+	xRefTable, err := createXRefTableWithRootDict()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := newRedactor(&Context{XRefTable: xRefTable}, areas)
+	rr := &redactedResources{orig: resources}
+
+	bb, changed, err := rd.redactContent(b, rr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("want changed content")
+	}
+
+	got := string(bb)
+
+	for _, want := range []string{
+		"0 0 m 100 0 l 150 0 m 300 0 l S",
+		"50 120 200 30 re 50 50 50 70 re 150 50 100 70 re f",
+		"/Rdct1 Do",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(got), " "), want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+
+	sd, err := xRefTable.DereferenceStreamDict(rr.copy["XObject"].(Dict)["Rdct1"])
+	if err != nil || sd == nil {
+		t.Fatalf("missing redacted image: %v", err)
+	}
+	if err = decodeStream(sd); err != nil {
+		t.Fatal(err)
+	}
+	if want := "ABCDEFGH\x00\x00KL\x00\x00OP"; string(sd.Content) != want {
+		t.Errorf("image: want %q, got %q", want, sd.Content)
+	}
+
+	s := newTextScanner(&XRefTable{})
+	s.ctm, s.ts = identMatrix, textState{hScale: 1}
+
+	if err := s.scan(bb, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	text, _ := layoutText(s.runs)
+	if strings.Contains(text, "Secret") || !strings.Contains(text, "Hello") || !strings.Contains(text, "World") {
+		t.Errorf("unexpected text: %q", text)
+	}
+
+	// The remaining glyphs keep their position.
+	var bbox *Rectangle
+	for _, r := range s.runs {
+		bbox = union(bbox, r.BBox)
+	}
+	if want := 100 + textWidth("Hello Secret World", 10); math.Abs(bbox.UR.X-want) > .01 {
+		t.Errorf("want text to end at %.2f, got %.2f", want, bbox.UR.X)
+	}
+}
+
+func TestApplyRedactions(t *testing.T) {
+
+	ctx, err := ReadFile(filepath.Join("..", "testdata", "go.pdf"), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+
+	rp := &RedactParams{Pattern: `Programming\s+Language`}
+
+	n, err := ApplyRedactions(ctx, IntSet{1: true}, rp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("want 1 redacted page, got %d", n)
+	}
+
+	pp, err := ExtractPageText(ctx, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re := regexp.MustCompile(rp.Pattern)
+
+	if re.MatchString(pp[0].Text) || !strings.Contains(pp[0].Text, "Google's Go") {
+		t.Errorf("page 1: unexpected text %q", pp[0].Text)
+	}
+
+	if !re.MatchString(pp[1].Text) {
+		t.Errorf("page 2: unselected page got redacted")
+	}
+}
+
+// pdfBytes returns a PDF file made up of objs numbered from 1 using a classic xref section.
+// The trailer refers to obj#1 as Root and to any info obj#.
+func pdfBytes(objs []string, info int) []byte {
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root 1 0 R", len(objs)+1)
+	if info > 0 {
+		fmt.Fprintf(&buf, " /Info %d 0 R", info)
+	}
+	fmt.Fprintf(&buf, ">>\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	return buf.Bytes()
+}
+
+func TestRedactedTextNotRecoverable(t *testing.T) {
+
+	content := "/P <</MCID 0>> BDC BT /F1 12 Tf 50 200 Td (Top Secret) Tj ET EMC\n" +
+		"/Span /PL1 BDC BT /F1 12 Tf 50 150 Td (Top Secret) Tj ET EMC\n" +
+		"/P <</MCID 2>> BDC BT /F1 12 Tf 50 100 Td (Public) Tj ET EMC"
+
+	xmp := "<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"><dc:title>Top Secret memo</dc:title></x:xmpmeta>"
+
+	b := pdfBytes([]string{
+		"<</Type/Catalog/Pages 2 0 R/StructTreeRoot 5 0 R/MarkInfo<</Marked true>>/Metadata 13 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1>>",
+		"<</Type/Page/Parent 2 0 R/MediaBox[0 0 300 300]/Contents 4 0 R/Thumb 9 0 R/StructParents 0" +
+			"/Resources<</Font<</F1<</Type/Font/Subtype/Type1/BaseFont/Helvetica>>>>/Properties<</PL1 8 0 R>>>>>>",
+		fmt.Sprintf("<</Length %d>>\nstream\n%s\nendstream", len(content)+1, content),
+		"<</Type/StructTreeRoot/K 6 0 R>>",
+		"<</Type/StructElem/S/Document/P 5 0 R/K[7 0 R 10 0 R 11 0 R]/Alt(Top Secret memo)>>",
+		"<</Type/StructElem/S/P/P 6 0 R/Pg 3 0 R/K 0/ActualText(Top Secret)>>",
+		"<</MCID 1/ActualText(Top Secret)>>",
+		"<</Width 10/Height 1/ColorSpace/DeviceGray/BitsPerComponent 8/Length 11>>\nstream\nTop Secret\n\nendstream",
+		"<</Type/StructElem/S/Span/P 6 0 R/Pg 3 0 R/K<</Type/MCR/MCID 1>>/E(Top Secret)>>",
+		"<</Type/StructElem/S/P/P 6 0 R/Pg 3 0 R/K 2/Alt(Public info)>>",
+		"<</Title(Top Secret memo)/Subject(Quarterly report)>>",
+		fmt.Sprintf("<</Type/Metadata/Subtype/XML/Length %d>>\nstream\n%s\nendstream", len(xmp), xmp),
+	}, 12)
+
+	conf := NewDefaultConfiguration()
+	conf.WriteObjectStream = false
+	conf.WriteXRefStream = false
+
+	ctx, err := Read(bytes.NewReader(b), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ApplyRedactions(ctx, nil, &RedactParams{Pattern: "Top Secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	ctx.Write.Writer = bufio.NewWriter(&buf)
+
+	if err = Write(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b = buf.Bytes()
+
+	if bytes.Contains(b, []byte("Top Secret")) {
+		t.Fatalf("redacted text recoverable from\n%s", b)
+	}
+
+	if bytes.Contains(b, []byte("/Thumb")) {
+		t.Fatal("thumbnail of redacted page left in place")
+	}
+
+	if !bytes.Contains(b, []byte("(Public info)")) {
+		t.Fatal("unredacted structure element lost its alternate text")
+	}
+
+	if !bytes.Contains(b, []byte("(Quarterly report)")) || !bytes.Contains(b, []byte("( memo)")) {
+		t.Fatalf("unredacted document info lost\n%s", b)
+	}
+}
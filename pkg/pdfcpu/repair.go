@@ -0,0 +1,412 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// Cross reference table reconstruction for damaged files.
+//
+// If the cross reference table of a file cannot be read
+// eg. because of a wrong startxref offset, a truncated xref section or a missing trailer,
+// we scan the whole file for object headers "N G obj", trailer dicts and xref streams
+// and rebuild the cross reference table from scratch.
+// Objects contained in object streams are recorded once the object streams have been decoded (See decodeObjectStreams).
+
+const (
+	repairChunkSize = 1 << 20
+	repairOverlap   = 64
+)
+
+// Tokens of interest while scanning a damaged file.
+// Stream data may run right into "endstream".
+var repairTokens = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b|endobj\b|endstream\b|\bstream\b|\btrailer\b`)
+
+// repairObject is an object header found at offset.
+type repairObject struct {
+	objNr, genNr int
+	offset       int64
+}
+
+// repairScan holds the results of scanning a file for objects and trailers.
+type repairScan struct {
+	objs     []repairObject // in file order
+	trailers []int64        // offsets of "trailer" keywords
+}
+
+// scanForObjects scans rs for object headers and trailers skipping stream data.
+func scanForObjects(rs io.ReadSeeker) (*repairScan, error) {
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	rsc := &repairScan{}
+
+	var (
+		buf              []byte
+		base             int64 // file offset of buf[0]
+		inObj, inStream  bool
+		eof              bool
+		chunk            = make([]byte, repairChunkSize)
+		consumed, cutoff int
+	)
+
+	for !eof {
+
+		n, err := io.ReadFull(rs, chunk)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			eof = true
+		} else if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, chunk[:n]...)
+
+		// Tokens near the end of buf may be incomplete unless we are at eof.
+		cutoff = len(buf)
+		if !eof {
+			cutoff -= repairOverlap
+		}
+		consumed = 0
+
+		for _, m := range repairTokens.FindAllSubmatchIndex(buf, -1) {
+
+			if m[0] >= cutoff {
+				break
+			}
+
+			consumed = m[1]
+			token := string(buf[m[0]:m[1]])
+
+			if inStream {
+				if token == "endstream" {
+					inStream = false
+				}
+				continue
+			}
+
+			switch token {
+
+			case "endobj":
+				inObj = false
+
+			case "stream":
+				inStream = inObj
+
+			case "endstream":
+				// Stray endstream.
+
+			case "trailer":
+				rsc.trailers = append(rsc.trailers, base+int64(m[0]))
+
+			default:
+				objNr, err1 := strconv.Atoi(string(buf[m[2]:m[3]]))
+				genNr, err2 := strconv.Atoi(string(buf[m[4]:m[5]]))
+				if err1 != nil || err2 != nil {
+					continue
+				}
+				rsc.objs = append(rsc.objs, repairObject{objNr, genNr, base + int64(m[0])})
+				inObj = true
+			}
+		}
+
+		if consumed < cutoff {
+			consumed = cutoff
+		}
+
+		base += int64(consumed)
+		buf = append(buf[:0], buf[consumed:]...)
+	}
+
+	return rsc, nil
+}
+
+// repairTrailerDict parses the trailer dict following the "trailer" keyword at offset.
+func repairTrailerDict(ctx *Context, offset int64) Dict {
+
+	rd, err := newPositionedReader(ctx.Read.rs, &offset)
+	if err != nil {
+		return nil
+	}
+
+	buf := make([]byte, 16*1024)
+	n, _ := io.ReadFull(rd, buf)
+
+	s := string(buf[len("trailer"):n])
+	if i := strings.Index(s, "startxref"); i > 0 {
+		s = s[:i]
+	}
+
+	o, err := parseObject(&s)
+	if err != nil {
+		log.Info.Printf("repairXRefTable: skipping corrupt trailer at offset %d\n", offset)
+		return nil
+	}
+
+	d, _ := o.(Dict)
+
+	return d
+}
+
+// repairTrailer is a trailer dict or xref stream dict found at offset.
+type repairTrailer struct {
+	offset int64
+	d      Dict
+}
+
+// applyRepairTrailers takes the trailer info from the most recent trailers.
+func applyRepairTrailers(xRefTable *XRefTable, trailers []repairTrailer) {
+
+	sort.Slice(trailers, func(i, j int) bool { return trailers[i].offset < trailers[j].offset })
+
+	for i := len(trailers) - 1; i >= 0; i-- {
+
+		d := trailers[i].d
+
+		if xRefTable.Root == nil {
+			xRefTable.Root = d.IndirectRefEntry("Root")
+		}
+
+		if xRefTable.Info == nil {
+			xRefTable.Info = d.IndirectRefEntry("Info")
+		}
+
+		if xRefTable.ID == nil {
+			xRefTable.ID = d.ArrayEntry("ID")
+		}
+
+		if xRefTable.Encrypt == nil {
+			xRefTable.Encrypt = d.IndirectRefEntry("Encrypt")
+		}
+
+		if size := d.Size(); size != nil && (xRefTable.Size == nil || *size > *xRefTable.Size) {
+			xRefTable.Size = size
+		}
+	}
+}
+
+// resetFreeList turns all missing objects up to xRefTable.Size into free objects and rebuilds the free list.
+func resetFreeList(xRefTable *XRefTable) error {
+
+	for i := 1; i < *xRefTable.Size; i++ {
+		entry, found := xRefTable.Table[i]
+		if !found || entry == nil {
+			g := 0
+			entry = &XRefTableEntry{Free: true, Generation: &g}
+			xRefTable.Table[i] = entry
+		}
+		if entry.Free {
+			zero := int64(0)
+			entry.Offset = &zero
+		}
+	}
+
+	xRefTable.Table[0] = NewFreeHeadXRefTableEntry()
+
+	return xRefTable.EnsureValidFreeList()
+}
+
+// repairObjectEntry creates the cross reference table entry for the most recent readable definition of objNr.
+// Xref streams are not part of the rebuilt cross reference table and are returned as trailer.
+func repairObjectEntry(ctx *Context, objNr int, objs []repairObject) (*repairTrailer, bool) {
+
+	for i := len(objs) - 1; i >= 0; i-- {
+
+		ro := objs[i]
+
+		o, _, _, _, err := object(ctx, ro.offset, objNr, ro.genNr)
+		if err != nil {
+			log.Info.Printf("repairXRefTable: skipping corrupt obj#%d at offset %d\n", objNr, ro.offset)
+			continue
+		}
+
+		if d, ok := o.(Dict); ok && d.Type() != nil {
+			switch *d.Type() {
+			case "XRef":
+				ctx.Read.UsingXRefStreams = true
+				return &repairTrailer{ro.offset, d}, false
+			case "ObjStm":
+				ctx.Read.ObjectStreams[objNr] = true
+			}
+		}
+
+		off, genNr := ro.offset, ro.genNr
+		ctx.Table[objNr] = &XRefTableEntry{Offset: &off, Generation: &genNr}
+
+		return nil, true
+	}
+
+	return nil, false
+}
+
+// repairXRefTable rebuilds the cross reference table by scanning the whole file.
+func repairXRefTable(ctx *Context) error {
+
+	log.Info.Println("repairing cross reference table..")
+
+	// Start from scratch.
+	rs := ctx.Read.rs
+	ctx.XRefTable = newXRefTable(ctx.XRefTable.ValidationMode)
+	ctx.Read = newReadContext(rs)
+	ctx.Read.Repaired = true
+
+	hv, eolCount, err := headerVersion(rs)
+	if err != nil {
+		log.Info.Printf("repairXRefTable: %v, assuming V1.7\n", err)
+		v := V17
+		hv, eolCount = &v, 1
+	}
+	ctx.HeaderVersion = hv
+	ctx.Read.EolCount = eolCount
+
+	rsc, err := scanForObjects(rs)
+	if err != nil {
+		return err
+	}
+
+	// Record all object offsets per object number.
+	// The most recent object definition wins.
+	offsets := map[int][]repairObject{}
+	for _, o := range rsc.objs {
+		offsets[o.objNr] = append(offsets[o.objNr], o)
+	}
+
+	var trailers []repairTrailer
+	for _, off := range rsc.trailers {
+		if d := repairTrailerDict(ctx, off); d != nil {
+			trailers = append(trailers, repairTrailer{off, d})
+		}
+	}
+
+	maxObjNr := 0
+
+	for objNr, objs := range offsets {
+		d, ok := repairObjectEntry(ctx, objNr, objs)
+		if d != nil {
+			trailers = append(trailers, *d)
+		}
+		if ok && objNr > maxObjNr {
+			maxObjNr = objNr
+		}
+	}
+
+	if len(ctx.Table) == 0 && len(ctx.Read.ObjectStreams) == 0 {
+		return errors.New("pdfcpu: repairXRefTable: no objects found")
+	}
+
+	applyRepairTrailers(ctx.XRefTable, trailers)
+
+	if ctx.Size == nil || *ctx.Size <= maxObjNr {
+		size := maxObjNr + 1
+		ctx.Size = &size
+	}
+
+	log.Info.Printf("repairXRefTable: found %d objects, %d trailers\n", len(ctx.Table), len(trailers))
+
+	return resetFreeList(ctx.XRefTable)
+}
+
+// repairObjectStreamEntries creates cross reference table entries for all objects of an object stream
+// unless there is a more recent definition of an object.
+// The free list needs to be reset afterwards.
+func repairObjectStreamEntries(ctx *Context, objStmNr int, osd *ObjectStreamDict) error {
+
+	objStmOffset := *ctx.Table[objStmNr].Offset
+
+	objs := strings.Fields(string(osd.Content[:osd.FirstObjOffset]))
+
+	for i := 0; i+1 < len(objs); i += 2 {
+
+		objNr, err := strconv.Atoi(objs[i])
+		if err != nil {
+			return err
+		}
+
+		// Skip objects defined after this object stream.
+		if entry, found := ctx.Table[objNr]; found && !entry.Free {
+			off := entry.Offset
+			if entry.Compressed {
+				off = ctx.Table[*entry.ObjectStream].Offset
+			}
+			if off != nil && *off > objStmOffset {
+				continue
+			}
+		}
+
+		objStm, ind := objStmNr, i/2
+		ctx.Table[objNr] = &XRefTableEntry{
+			Compressed:      true,
+			ObjectStream:    &objStm,
+			ObjectStreamInd: &ind,
+		}
+
+		if objNr >= *ctx.Size {
+			size := objNr + 1
+			ctx.Size = &size
+		}
+	}
+
+	return nil
+}
+
+// repairRoot ensures a root object pointing to a catalog.
+// If necessary the catalog with a page tree and the highest object number is used.
+func repairRoot(xRefTable *XRefTable) error {
+
+	isCatalog := func(o Object) bool {
+		d, err := xRefTable.DereferenceDict(o)
+		if err != nil || d == nil || d.Type() == nil || *d.Type() != "Catalog" {
+			return false
+		}
+		pages, err := xRefTable.DereferenceDict(d["Pages"])
+		return err == nil && pages != nil
+	}
+
+	if xRefTable.Root != nil && isCatalog(*xRefTable.Root) {
+		return nil
+	}
+
+	rootObjNr := -1
+
+	for objNr, entry := range xRefTable.Table {
+		if entry.Free || objNr < rootObjNr {
+			continue
+		}
+		if isCatalog(entry.Object) {
+			rootObjNr = objNr
+		}
+	}
+
+	if rootObjNr < 0 {
+		return errors.New("pdfcpu: repairXRefTable: no catalog found")
+	}
+
+	log.Info.Printf("repairXRefTable: using catalog obj#%d\n", rootObjNr)
+
+	xRefTable.Root = NewIndirectRef(rootObjNr, *xRefTable.Table[rootObjNr].Generation)
+
+	return nil
+}
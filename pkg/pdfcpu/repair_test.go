@@ -0,0 +1,153 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// wrongStartXRef replaces the offset of the last xref section with off.
+func wrongStartXRef(b []byte, off int) []byte {
+	i := bytes.LastIndex(b, []byte("startxref"))
+	return append(append([]byte(nil), b[:i]...), fmt.Sprintf("startxref\n%d\n%%%%EOF\n", off)...)
+}
+
+// Damage a PDF file in various ways.
+var damages = []struct {
+	name   string
+	damage func([]byte) []byte
+}{
+	{"wrong startxref", func(b []byte) []byte {
+		i := bytes.LastIndex(b, []byte("startxref"))
+		return append(append([]byte(nil), b[:i]...), []byte("startxref\n12345678\n%%EOF\n")...)
+	}},
+	{"startxref pointing into an object", func(b []byte) []byte {
+		return wrongStartXRef(b, 12345)
+	}},
+	{"startxref pointing into the middle", func(b []byte) []byte {
+		return wrongStartXRef(b, len(b)/2)
+	}},
+	{"startxref pointing into the first third", func(b []byte) []byte {
+		return wrongStartXRef(b, len(b)/3)
+	}},
+	{"missing startxref", func(b []byte) []byte {
+		i := bytes.LastIndex(b, []byte("startxref"))
+		return b[:i]
+	}},
+	{"truncated xref", func(b []byte) []byte {
+		i := bytes.LastIndex(b, []byte("startxref"))
+		j := bytes.LastIndex(b[:i], []byte("\nxref"))
+		if j < bytes.LastIndex(b, []byte("endobj")) {
+			// Truncate the final xref stream.
+			return b[:i-40]
+		}
+		return b[:j+30]
+	}},
+	{"wrong object offsets", func(b []byte) []byte {
+		// Insert a comment after the header and fix startxref only.
+		const pad = "% padding\n"
+		i := bytes.IndexByte(b, '\n') + 1
+		j := bytes.LastIndex(b, []byte("startxref"))
+		off, err := strconv.Atoi(strings.Fields(string(b[j+len("startxref"):]))[0])
+		if err != nil {
+			return b
+		}
+		b1 := append([]byte(nil), b[:i]...)
+		b1 = append(b1, pad...)
+		b1 = append(b1, b[i:j]...)
+		return append(b1, fmt.Sprintf("startxref\n%d\n%%%%EOF\n", off+len(pad))...)
+	}},
+	{"missing trailer", func(b []byte) []byte {
+		i := bytes.LastIndex(b, []byte("startxref"))
+		b1 := regexp.MustCompile(`trailer\s*<<`).ReplaceAll(b[:i], []byte("garbage <<"))
+		return regexp.MustCompile(`/Type\s*/XRef`).ReplaceAll(b1, []byte("/Type /Junk"))
+	}},
+}
+
+func readPageCount(t *testing.T, b []byte) (int, bool) {
+	t.Helper()
+
+	ctx, err := Read(bytes.NewReader(b), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+
+	return ctx.PageCount, ctx.Read.Repaired
+}
+
+func TestRepairXRefTable(t *testing.T) {
+
+	for _, fn := range []string{"annotTest.pdf", "Acroforms2.pdf", "Hybrid-PDF.pdf", "testImage.pdf", "go.pdf", "empty.pdf"} {
+
+		b, err := ioutil.ReadFile(filepath.Join("..", "testdata", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, repaired := readPageCount(t, b)
+		if repaired {
+			t.Fatalf("%s: unexpected repair", fn)
+		}
+
+		for _, d := range damages {
+
+			got, repaired := readPageCount(t, d.damage(b))
+
+			if !repaired {
+				t.Fatalf("%s %s: expected repair", fn, d.name)
+			}
+
+			if got != want {
+				t.Fatalf("%s %s: pageCount %d != %d", fn, d.name, got, want)
+			}
+		}
+	}
+}
+
+func TestScanForObjects(t *testing.T) {
+
+	// Object headers within stream data are ignored.
+	b := []byte("%PDF-1.4\n1 0 obj\n<</Length 10>>stream\n2 0 obj Jendstream\nendobj\n3 0\nobj\n<<>>\nendobj\ntrailer\n<</Root 3 0 R>>\n")
+
+	rsc, err := scanForObjects(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rsc.objs) != 2 || rsc.objs[0].objNr != 1 || rsc.objs[1].objNr != 3 {
+		t.Fatalf("unexpected objects: %v", rsc.objs)
+	}
+
+	if rsc.objs[1].offset != int64(bytes.Index(b, []byte("3 0\nobj"))) {
+		t.Fatalf("wrong offset for obj#3: %d", rsc.objs[1].offset)
+	}
+
+	if len(rsc.trailers) != 1 || rsc.trailers[0] != int64(bytes.Index(b, []byte("trailer"))) {
+		t.Fatalf("unexpected trailers: %v", rsc.trailers)
+	}
+}
@@ -0,0 +1,344 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// Revision represents the state of a PDF file as of an incremental update.
+//
+// Revision 1 is the original document.
+// Each incremental update appends objects and a new xref section or xref stream
+// terminated by an %%EOF marker.
+// The bytes up to EOFOffset make up the document as it was at this revision.
+//
+// The xref sections of a linearized file and its first page xref section belong to the same revision.
+type Revision struct {
+	Nr          int
+	XRefOffsets []int64                 // Offsets of the xref sections or streams of this revision.
+	XRefStream  bool                    // The revision is using xref streams.
+	EOFOffset   int64                   // Offset right behind the %%EOF marker terminating this revision.
+	Size        int                     // Size entry of the trailer.
+	Root        *IndirectRef            // Root entry of the trailer.
+	Info        *IndirectRef            // Info entry of the trailer.
+	Encrypt     *IndirectRef            // Encrypt entry of the trailer.
+	Table       map[int]*XRefTableEntry // Xref entries of this revision.
+	Added       []int                   // Objects added by this revision.
+	Changed     []int                   // Objects redefined by this revision.
+	Deleted     []int                   // Objects freed by this revision.
+}
+
+// revisionEnd returns the offset right behind the %%EOF marker following the xref section at offset.
+// A missing %%EOF marker at the end of the file is tolerated.
+func revisionEnd(rs io.ReadSeeker, offset int64) (int64, error) {
+
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var (
+		buf   []byte
+		base  = offset
+		chunk = make([]byte, 4096)
+		eof   bool
+	)
+
+	for !eof {
+
+		n, err := rs.Read(chunk)
+		if err == io.EOF {
+			eof = true
+		} else if err != nil {
+			return 0, err
+		}
+
+		buf = append(buf, chunk[:n]...)
+
+		i := bytes.Index(buf, []byte("startxref"))
+		if i < 0 {
+			// Keep enough for a partial keyword.
+			if len(buf) > 16 {
+				base += int64(len(buf) - 16)
+				buf = append(buf[:0], buf[len(buf)-16:]...)
+			}
+			continue
+		}
+
+		j := bytes.Index(buf[i:], []byte("%%EOF"))
+		if j < 0 {
+			continue
+		}
+
+		end := i + j + len("%%EOF")
+
+		// Include the eol marker.
+		if end+1 >= len(buf) && !eof {
+			continue
+		}
+		if end < len(buf) && buf[end] == 0x0D {
+			end++
+		}
+		if end < len(buf) && buf[end] == 0x0A {
+			end++
+		}
+
+		return base + int64(end), nil
+	}
+
+	log.Info.Printf("revisionEnd: missing %%%%EOF for xref section at offset %d\n", offset)
+
+	return base + int64(len(buf)), nil
+}
+
+// sameLocation returns true if both xref entries point to the same object definition.
+func sameLocation(e1, e2 *XRefTableEntry) bool {
+
+	if e1.Compressed != e2.Compressed {
+		return false
+	}
+
+	if e1.Compressed {
+		return *e1.ObjectStream == *e2.ObjectStream && *e1.ObjectStreamInd == *e2.ObjectStreamInd
+	}
+
+	return *e1.Offset == *e2.Offset && *e1.Generation == *e2.Generation
+}
+
+// classifyRevisionObjects records the objects added, changed and deleted by each revision.
+func classifyRevisionObjects(revs []*Revision) {
+
+	state := map[int]*XRefTableEntry{}
+
+	for _, rev := range revs {
+
+		var keys []int
+		for k := range rev.Table {
+			if k > 0 {
+				keys = append(keys, k)
+			}
+		}
+		sort.Ints(keys)
+
+		for _, objNr := range keys {
+
+			entry := rev.Table[objNr]
+			prev, found := state[objNr]
+
+			switch {
+
+			case entry.Free:
+				if found && !prev.Free {
+					rev.Deleted = append(rev.Deleted, objNr)
+				}
+
+			case !found || prev.Free:
+				rev.Added = append(rev.Added, objNr)
+
+			case !sameLocation(entry, prev):
+				rev.Changed = append(rev.Changed, objNr)
+			}
+
+			state[objNr] = entry
+		}
+	}
+}
+
+// xRefSection is a parsed xref section or xref stream including any hybrid xref stream.
+type xRefSection struct {
+	offset int64
+	end    int64 // see revisionEnd
+	ctx    *Context
+}
+
+// parseXRefSectionAt parses the xref section at offset into a scratch context.
+func parseXRefSectionAt(ctx *Context, offset int64) (*xRefSection, *int64, error) {
+
+	c, err := NewContext(ctx.Read.rs, ctx.Configuration)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.HeaderVersion = ctx.HeaderVersion
+	c.Read.EolCount = ctx.Read.EolCount
+
+	off := offset
+	prevOffset, _, err := parseXRefAt(c, &off)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "pdfcpu: revisions: corrupt xref section at offset %d", offset)
+	}
+
+	end, err := revisionEnd(ctx.Read.rs, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &xRefSection{offset: offset, end: end, ctx: c}, prevOffset, nil
+}
+
+// newRevision merges xref sections into a revision.
+// Entries of more recent sections take precedence.
+func newRevision(secs []*xRefSection) *Revision {
+
+	rev := &Revision{Table: map[int]*XRefTableEntry{}}
+
+	for _, sec := range secs {
+
+		c := sec.ctx
+
+		rev.XRefOffsets = append(rev.XRefOffsets, sec.offset)
+		rev.XRefStream = rev.XRefStream || c.Read.UsingXRefStreams
+
+		if sec.end > rev.EOFOffset {
+			rev.EOFOffset = sec.end
+		}
+
+		if rev.Root == nil {
+			rev.Root = c.Root
+		}
+		if rev.Info == nil {
+			rev.Info = c.Info
+		}
+		if rev.Encrypt == nil {
+			rev.Encrypt = c.Encrypt
+		}
+		if c.Size != nil && *c.Size > rev.Size {
+			rev.Size = *c.Size
+		}
+
+		for objNr, entry := range c.Table {
+			if _, found := rev.Table[objNr]; !found {
+				rev.Table[objNr] = entry
+			}
+		}
+	}
+
+	return rev
+}
+
+// Revisions returns all revisions of a PDF file starting with the original document.
+func Revisions(rs io.ReadSeeker, conf *Configuration) ([]*Revision, error) {
+
+	ctx, err := NewContext(rs, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.HeaderVersion, ctx.Read.EolCount, err = headerVersion(rs); err != nil {
+		return nil, err
+	}
+
+	offset, err := offsetLastXRefSection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Xref sections grouped by revision, most recent revision first.
+	var groups [][]*xRefSection
+	visited := map[int64]bool{}
+
+	for offset != nil {
+
+		if visited[*offset] {
+			return nil, errors.Errorf("pdfcpu: revisions: circular xref section chain at offset %d", *offset)
+		}
+		visited[*offset] = true
+
+		var sec *xRefSection
+		if sec, offset, err = parseXRefSectionAt(ctx, *offset); err != nil {
+			return nil, err
+		}
+
+		// A previous section terminated behind the current revision's first section
+		// belongs to the same revision (eg. the main xref section of a linearized file).
+		if n := len(groups); n > 0 && sec.end >= groups[n-1][0].end {
+			groups[n-1] = append(groups[n-1], sec)
+			continue
+		}
+
+		groups = append(groups, []*xRefSection{sec})
+	}
+
+	revs := make([]*Revision, len(groups))
+
+	for i, secs := range groups {
+		rev := newRevision(secs)
+		rev.Nr = len(groups) - i
+		revs[rev.Nr-1] = rev
+	}
+
+	classifyRevisionObjects(revs)
+
+	return revs, nil
+}
+
+// objNrRanges returns a compact representation of a sorted list of object numbers eg. "1-5,7,9-10".
+func objNrRanges(objNrs []int) string {
+
+	if len(objNrs) == 0 {
+		return "-"
+	}
+
+	var ss []string
+
+	for i := 0; i < len(objNrs); {
+		j := i
+		for j+1 < len(objNrs) && objNrs[j+1] == objNrs[j]+1 {
+			j++
+		}
+		if i == j {
+			ss = append(ss, fmt.Sprintf("%d", objNrs[i]))
+		} else {
+			ss = append(ss, fmt.Sprintf("%d-%d", objNrs[i], objNrs[j]))
+		}
+		i = j + 1
+	}
+
+	return strings.Join(ss, ",")
+}
+
+// RevisionList returns a printable list of revs.
+func RevisionList(revs []*Revision) []string {
+
+	var ss []string
+
+	for _, rev := range revs {
+
+		var offs []string
+		for _, off := range rev.XRefOffsets {
+			offs = append(offs, fmt.Sprintf("%d", off))
+		}
+
+		xref := "xref section"
+		if rev.XRefStream {
+			xref = "xref stream"
+		}
+
+		ss = append(ss, fmt.Sprintf("revision %d: %d bytes, %s at offset %s", rev.Nr, rev.EOFOffset, xref, strings.Join(offs, ",")))
+		ss = append(ss, fmt.Sprintf("%12s: %s", "added", objNrRanges(rev.Added)))
+		ss = append(ss, fmt.Sprintf("%12s: %s", "changed", objNrRanges(rev.Changed)))
+		ss = append(ss, fmt.Sprintf("%12s: %s", "deleted", objNrRanges(rev.Deleted)))
+	}
+
+	return ss
+}
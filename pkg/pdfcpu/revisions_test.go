@@ -0,0 +1,156 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// appendRevision simulates an incremental update of b using a classic xref section.
+func appendRevision(t *testing.T, b []byte, objs map[int]string, free []int) []byte {
+	t.Helper()
+
+	m := regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF`).FindAllSubmatch(b, -1)
+	prev, err := strconv.Atoi(string(m[len(m)-1][1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = regexp.MustCompile(`/Root\s+(\d+\s+\d+\s+R)`).FindAllSubmatch(b, -1)
+	root := string(m[len(m)-1][1])
+
+	ctx, err := Read(bytes.NewReader(b), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := *ctx.Size
+
+	var objNrs []int
+	for objNr := range objs {
+		objNrs = append(objNrs, objNr)
+	}
+	sort.Ints(objNrs)
+
+	var buf bytes.Buffer
+	buf.Write(b)
+
+	offsets := map[int]int{}
+	for _, objNr := range objNrs {
+		offsets[objNr] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", objNr, objs[objNr])
+		if objNr >= size {
+			size = objNr + 1
+		}
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for _, objNr := range objNrs {
+		fmt.Fprintf(&buf, "%d 1\n%010d 00000 n \n", objNr, offsets[objNr])
+	}
+	for _, objNr := range free {
+		fmt.Fprintf(&buf, "%d 1\n0000000000 00001 f \n", objNr)
+	}
+	fmt.Fprintf(&buf, "trailer\n<</Size %d /Root %s /Prev %d>>\nstartxref\n%d\n%%%%EOF\n", size, root, prev, xref)
+
+	return buf.Bytes()
+}
+
+func TestRevisions(t *testing.T) {
+
+	for _, fn := range []string{"Hybrid-PDF.pdf", "annotTest.pdf"} {
+
+		b0, err := ioutil.ReadFile(filepath.Join("..", "testdata", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, err := Read(bytes.NewReader(b0), NewDefaultConfiguration())
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := *ctx.Size
+
+		// Revision 2 adds an object and redefines the root object.
+		rootNr := ctx.Root.ObjectNumber.Value()
+		root, err := ctx.Catalog()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b1 := appendRevision(t, b0, map[int]string{rootNr: root.PDFString(), size: "(Hello)"}, nil)
+
+		// Revision 3 deletes the added object.
+		b2 := appendRevision(t, b1, nil, []int{size})
+
+		revs, err := Revisions(bytes.NewReader(b2), NewDefaultConfiguration())
+		if err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		if len(revs) != 3 {
+			t.Fatalf("%s: got %d revisions, want 3", fn, len(revs))
+		}
+
+		for i, want := range []int{len(b0), len(b1), len(b2)} {
+			if revs[i].Nr != i+1 || revs[i].EOFOffset != int64(want) {
+				t.Fatalf("%s: revision %d ends at %d, want %d", fn, revs[i].Nr, revs[i].EOFOffset, want)
+			}
+		}
+
+		if len(revs[0].Added) == 0 || revs[0].Changed != nil || revs[0].Deleted != nil {
+			t.Fatalf("%s: revision 1: added:%v changed:%v deleted:%v", fn, revs[0].Added, revs[0].Changed, revs[0].Deleted)
+		}
+
+		if !reflect.DeepEqual(revs[1].Added, []int{size}) || !reflect.DeepEqual(revs[1].Changed, []int{rootNr}) || revs[1].Deleted != nil {
+			t.Fatalf("%s: revision 2: added:%v changed:%v deleted:%v", fn, revs[1].Added, revs[1].Changed, revs[1].Deleted)
+		}
+
+		if revs[2].Added != nil || revs[2].Changed != nil || !reflect.DeepEqual(revs[2].Deleted, []int{size}) {
+			t.Fatalf("%s: revision 3: added:%v changed:%v deleted:%v", fn, revs[2].Added, revs[2].Changed, revs[2].Deleted)
+		}
+
+		// The updated file is still readable.
+		if _, err = Read(bytes.NewReader(b2), NewDefaultConfiguration()); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+	}
+}
+
+func TestObjNrRanges(t *testing.T) {
+
+	for _, tt := range []struct {
+		objNrs []int
+		want   string
+	}{
+		{nil, "-"},
+		{[]int{7}, "7"},
+		{[]int{1, 2, 3, 5, 7, 8}, "1-3,5,7-8"},
+	} {
+		if got := objNrRanges(tt.objNrs); got != tt.want {
+			t.Errorf("objNrRanges(%v) = %q, want %q", tt.objNrs, got, tt.want)
+		}
+	}
+}
@@ -35,12 +35,10 @@ func rotatePage(xRefTable *XRefTable, i, j int) error {
 // RotatePages rotates all selected pages by a multiple of 90 degrees.
 func RotatePages(ctx *Context, selectedPages IntSet, rotation int) error {
 
-	for k, v := range selectedPages {
-		if v {
-			err := rotatePage(ctx.XRefTable, k, rotation)
-			if err != nil {
-				return err
-			}
+	for _, k := range sortedSelectedPages(selectedPages) {
+		err := rotatePage(ctx.XRefTable, k, rotation)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,133 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/bidi"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Passwords for AES-256 encryption are processed using the SASLprep profile (RFC 4013) of stringprep (RFC 3454).
+
+type runeRange struct{ lo, hi rune }
+
+func inRanges(r rune, rr []runeRange) bool {
+	for _, v := range rr {
+		if r >= v.lo && r <= v.hi {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// RFC 3454 C.1.2 Non-ASCII space characters
+	nonASCIISpace = []runeRange{
+		{0x00A0, 0x00A0}, {0x1680, 0x1680}, {0x2000, 0x200B}, {0x202F, 0x202F}, {0x205F, 0x205F}, {0x3000, 0x3000},
+	}
+
+	// RFC 3454 B.1 Commonly mapped to nothing
+	mappedToNothing = []runeRange{
+		{0x00AD, 0x00AD}, {0x034F, 0x034F}, {0x1806, 0x1806}, {0x180B, 0x180D}, {0x200B, 0x200D},
+		{0x2060, 0x2060}, {0xFE00, 0xFE0F}, {0xFEFF, 0xFEFF},
+	}
+
+	// RFC 3454 C.2.1, C.2.2, C.3, C.5, C.6, C.7, C.8, C.9
+	prohibited = []runeRange{
+		// C.2.1 ASCII control characters
+		{0x0000, 0x001F}, {0x007F, 0x007F},
+		// C.2.2 Non-ASCII control characters
+		{0x0080, 0x009F}, {0x06DD, 0x06DD}, {0x070F, 0x070F}, {0x180E, 0x180E}, {0x200C, 0x200D},
+		{0x2028, 0x2029}, {0x2060, 0x2063}, {0x206A, 0x206F}, {0xFEFF, 0xFEFF}, {0xFFF9, 0xFFFC},
+		{0x1D173, 0x1D17A},
+		// C.3 Private use
+		{0xE000, 0xF8FF}, {0xF0000, 0xFFFFD}, {0x100000, 0x10FFFD},
+		// C.5 Surrogate codes
+		{0xD800, 0xDFFF},
+		// C.6 Inappropriate for plain text
+		{0xFFF9, 0xFFFD},
+		// C.7 Inappropriate for canonical representation
+		{0x2FF0, 0x2FFB},
+		// C.8 Change display properties or deprecated
+		{0x0340, 0x0341}, {0x200E, 0x200F}, {0x202A, 0x202E},
+		// C.9 Tagging characters
+		{0xE0001, 0xE0001}, {0xE0020, 0xE007F},
+	}
+)
+
+// nonCharacter returns true for code points listed in RFC 3454 C.4
+func nonCharacter(r rune) bool {
+	return r >= 0xFDD0 && r <= 0xFDEF || r&0xFFFE == 0xFFFE
+}
+
+// saslPrep prepares s according to RFC 4013.
+func saslPrep(s string) (string, error) {
+
+	// 2.1 Mapping
+	var sb strings.Builder
+	for _, r := range s {
+		if inRanges(r, nonASCIISpace) {
+			sb.WriteRune(' ')
+			continue
+		}
+		if inRanges(r, mappedToNothing) {
+			continue
+		}
+		sb.WriteRune(r)
+	}
+
+	// 2.2 Normalization
+	s = norm.NFKC.String(sb.String())
+
+	// 2.3 Prohibited Output
+	var hasRandAL, hasL bool
+	for _, r := range s {
+		if inRanges(r, nonASCIISpace) || inRanges(r, prohibited) || nonCharacter(r) {
+			return "", errors.Errorf("pdfcpu: saslPrep: prohibited character %U", r)
+		}
+		switch c := bidiClass(r); c {
+		case bidi.R, bidi.AL:
+			hasRandAL = true
+		case bidi.L:
+			hasL = true
+		}
+	}
+
+	// 2.4 Bidirectional Characters
+	if hasRandAL {
+		if hasL {
+			return "", errors.New("pdfcpu: saslPrep: mixed bidirectional text")
+		}
+		rr := []rune(s)
+		if c := bidiClass(rr[0]); c != bidi.R && c != bidi.AL {
+			return "", errors.New("pdfcpu: saslPrep: invalid bidirectional text")
+		}
+		if c := bidiClass(rr[len(rr)-1]); c != bidi.R && c != bidi.AL {
+			return "", errors.New("pdfcpu: saslPrep: invalid bidirectional text")
+		}
+	}
+
+	return s, nil
+}
+
+func bidiClass(r rune) bidi.Class {
+	p, _ := bidi.LookupRune(r)
+	return p.Class()
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Number of characters surrounding a match in a snippet.
+const snippetContext = 30
+
+// SearchHit represents a match of a text search.
+type SearchHit struct {
+	Page    int
+	Match   string
+	Snippet string       // The match along with surrounding text on a single line.
+	Rects   []*Rectangle // Bounding boxes of the matched text in user space, one per text run involved.
+}
+
+// snippet returns the text surrounding text[start:end] on a single line.
+func snippet(text string, start, end int) string {
+
+	for n := 0; n < snippetContext && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+
+	for n := 0; n < snippetContext && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	return strings.TrimSpace(strings.Join(strings.Fields(text[start:end]), " "))
+}
+
+// rects returns the bounding boxes of the glyphs making up text[start:end] joined by text run.
+func (pt PageText) rects(start, end int) []*Rectangle {
+
+	var rr []*Rectangle
+	run := -1
+
+	for _, sp := range pt.spans {
+		if sp.end <= start || sp.start >= end {
+			continue
+		}
+		if sp.run != run {
+			rr = append(rr, nil)
+			run = sp.run
+		}
+		rr[len(rr)-1] = union(rr[len(rr)-1], sp.bbox)
+	}
+
+	return rr
+}
+
+// Search returns all matches of re in the text of a page.
+// Lines are separated by "\n" and words by " ".
+func (pt PageText) Search(re *regexp.Regexp) []SearchHit {
+
+	var hits []SearchHit
+
+	for _, loc := range re.FindAllStringIndex(pt.Text, -1) {
+		start, end := loc[0], loc[1]
+		if start == end {
+			continue
+		}
+		hits = append(hits, SearchHit{
+			Page:    pt.Page,
+			Match:   pt.Text[start:end],
+			Snippet: snippet(pt.Text, start, end),
+			Rects:   pt.rects(start, end),
+		})
+	}
+
+	return hits
+}
+
+// SearchText returns all matches of re in the text of the selected pages.
+func SearchText(ctx *Context, re *regexp.Regexp, pageNrs []int) ([]SearchHit, error) {
+
+	pp, err := ExtractPageText(ctx, pageNrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []SearchHit
+	for _, pt := range pp {
+		hits = append(hits, pt.Search(re)...)
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,768 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	subFilterPKCS7 = "adbe.pkcs7.detached"
+	subFilterCAdES = "ETSI.CAdES.detached"
+
+	// The ByteRange of a signature gets patched in after writing.
+	byteRangePlaceholder = 9999999999
+
+	// Space reserved for the signature on top of the embedded certificates.
+	signatureReserve = 4096
+
+	// Space reserved for a signature timestamp token.
+	timestampReserve = 8192
+)
+
+// SignParams represents the command details for the command "Sign".
+type SignParams struct {
+	Cert        *x509.Certificate   // The signer's certificate.
+	Chain       []*x509.Certificate // Additional certificates to be embedded, eg. intermediate CAs.
+	Key         crypto.Signer       // The signer's private key.
+	Field       string              // The name of the signature field to be created or reused.
+	PageNr      int                 // The page of the signature widget.
+	Rect        *Rectangle          // The position of a visible signature, nil for an invisible signature.
+	Reason      string
+	Location    string
+	ContactInfo string
+	Certify     int       // If > 0 apply a certification signature using these DocMDP access permissions (1,2,3).
+	CAdES       bool      // Use ETSI.CAdES.detached instead of adbe.pkcs7.detached.
+	TSAURL      string    // The URL of a RFC 3161 timestamp authority.
+	Time        time.Time // The signing time, defaults to now.
+}
+
+type signingParamMap map[string]func(string, *SignParams) error
+
+var signParamMap = signingParamMap{
+	"field":    parseSignField,
+	"page":     parseSignPage,
+	"position": parseSignPosition,
+	"reason":   func(s string, sp *SignParams) error { sp.Reason = s; return nil },
+	"location": func(s string, sp *SignParams) error { sp.Location = s; return nil },
+	"contact":  func(s string, sp *SignParams) error { sp.ContactInfo = s; return nil },
+	"certify":  parseSignCertify,
+	"format":   parseSignFormat,
+	"tsa":      func(s string, sp *SignParams) error { sp.TSAURL = s; return nil },
+}
+
+// Handle applies parameter completion and if successful
+// parses the parameter values into sp.
+func (m signingParamMap) Handle(paramPrefix, paramValueStr string, sp *SignParams) error {
+
+	var param string
+
+	// Completion support
+	for k := range m {
+		if !strings.HasPrefix(k, paramPrefix) {
+			continue
+		}
+		if len(param) > 0 {
+			return errors.Errorf("pdfcpu: ambiguous parameter prefix \"%s\"", paramPrefix)
+		}
+		param = k
+	}
+
+	if param == "" {
+		return errors.Errorf("pdfcpu: unknown parameter prefix \"%s\"", paramPrefix)
+	}
+
+	return m[param](paramValueStr, sp)
+}
+
+func parseSignField(s string, sp *SignParams) error {
+	if s == "" || strings.Contains(s, ".") {
+		return errors.Errorf("pdfcpu: invalid signature field name: \"%s\"", s)
+	}
+	sp.Field = s
+	return nil
+}
+
+func parseSignPage(s string, sp *SignParams) error {
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 {
+		return errors.Errorf("pdfcpu: invalid page number: %s", s)
+	}
+	sp.PageNr = i
+	return nil
+}
+
+func parseSignPosition(s string, sp *SignParams) error {
+
+	ss := strings.Fields(s)
+	if len(ss) != 4 {
+		return errors.New("pdfcpu: signature position, please provide: llx lly urx ury")
+	}
+
+	var f [4]float64
+	for i, v := range ss {
+		var err error
+		if f[i], err = strconv.ParseFloat(v, 64); err != nil {
+			return errors.Errorf("pdfcpu: invalid signature position: %s", s)
+		}
+	}
+
+	if f[2] <= f[0] || f[3] <= f[1] {
+		return errors.Errorf("pdfcpu: invalid signature position: %s", s)
+	}
+
+	sp.Rect = Rect(f[0], f[1], f[2], f[3])
+
+	return nil
+}
+
+func parseSignCertify(s string, sp *SignParams) error {
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 || i > 3 {
+		return errors.New("pdfcpu: certify, please provide the DocMDP access permissions: 1, 2 or 3")
+	}
+	sp.Certify = i
+	return nil
+}
+
+func parseSignFormat(s string, sp *SignParams) error {
+
+	switch strings.ToLower(s) {
+	case "pkcs7":
+		sp.CAdES = false
+	case "cades":
+		sp.CAdES = true
+	default:
+		return errors.New("pdfcpu: signature format, please provide one of: pkcs7, cades")
+	}
+
+	return nil
+}
+
+// ParseSignDetails parses a Sign command string into sp.
+func ParseSignDetails(s string, sp *SignParams) error {
+
+	if s == "" {
+		return errors.New("pdfcpu: missing signature description")
+	}
+
+	for _, s := range strings.Split(s, ",") {
+
+		// Values like URLs may contain colons.
+		ss := strings.SplitN(s, ":", 2)
+		if len(ss) != 2 {
+			return errors.Errorf("pdfcpu: invalid signature description: %s", s)
+		}
+
+		paramPrefix := strings.TrimSpace(ss[0])
+		paramValueStr := strings.TrimSpace(ss[1])
+
+		if err := signParamMap.Handle(paramPrefix, paramValueStr, sp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewSignParams returns the default signing parameters
+// for the certificate and private key contained in the PKCS#12 or PEM file fileName.
+func NewSignParams(fileName, password string) (*SignParams, error) {
+
+	certs, k, err := readKeyPair(fileName, password)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("pdfcpu: %s: unsupported private key", fileName)
+	}
+
+	sp := &SignParams{Key: key, PageNr: 1}
+
+	for _, c := range certs {
+		if sp.Cert == nil && publicKeyMatches(c, k) {
+			sp.Cert = c
+			continue
+		}
+		sp.Chain = append(sp.Chain, c)
+	}
+
+	if sp.Cert == nil {
+		return nil, errors.Errorf("pdfcpu: %s: no certificate matching the private key", fileName)
+	}
+
+	return sp, nil
+}
+
+func (sp *SignParams) validate() error {
+
+	if sp.Cert == nil || sp.Key == nil {
+		return errors.New("pdfcpu: sign: missing certificate or private key")
+	}
+
+	if !publicKeyMatches(sp.Cert, sp.Key) {
+		return errors.New("pdfcpu: sign: certificate and private key don't match")
+	}
+
+	if sp.Certify < 0 || sp.Certify > 3 {
+		return errors.Errorf("pdfcpu: sign: invalid DocMDP access permissions: %d", sp.Certify)
+	}
+
+	if sp.PageNr == 0 {
+		sp.PageNr = 1
+	}
+
+	if sp.Time.IsZero() {
+		sp.Time = time.Now()
+	}
+
+	return nil
+}
+
+// contentsSize returns the number of bytes to be reserved for the signature.
+func (sp *SignParams) contentsSize() int {
+
+	n := signatureReserve + len(sp.Cert.Raw)
+	for _, c := range sp.Chain {
+		n += len(c.Raw)
+	}
+
+	if sp.TSAURL != "" {
+		n += timestampReserve
+	}
+
+	return n
+}
+
+// textString returns s encoded as PDF text string.
+func textString(s string) StringLiteral {
+
+	for _, r := range s {
+		if r > 0x7E {
+			s = EncodeUTF16String(s)
+			break
+		}
+	}
+
+	s1, _ := Escape(s)
+
+	return StringLiteral(*s1)
+}
+
+// winAnsiString returns s encoded for use with a standard font and WinAnsiEncoding.
+func winAnsiString(s string) string {
+
+	var b []byte
+
+	for _, r := range s {
+		c, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok {
+			c = '?'
+		}
+		b = append(b, c)
+	}
+
+	s1, _ := Escape(string(b))
+
+	return *s1
+}
+
+// signatureAppearance creates the appearance stream of a visible signature.
+func signatureAppearance(ctx *Context, sp *SignParams) (*IndirectRef, error) {
+
+	w, h := sp.Rect.Width(), sp.Rect.Height()
+
+	lines := []string{
+		"Digitally signed by " + signerName(sp.Cert),
+		"Date: " + sp.Time.Format("2006.01.02 15:04:05 -07:00"),
+	}
+
+	if sp.Reason != "" {
+		lines = append(lines, "Reason: "+sp.Reason)
+	}
+
+	if sp.Location != "" {
+		lines = append(lines, "Location: "+sp.Location)
+	}
+
+	maxLen := 0
+	for _, l := range lines {
+		if len(l) > maxLen {
+			maxLen = len(l)
+		}
+	}
+
+	// Approximate the average Helvetica glyph width by half the font size.
+	fontSize := 10.
+	if fs := (h - 4) / (1.2 * float64(len(lines))); fs < fontSize {
+		fontSize = fs
+	}
+	if fs := 2 * (w - 4) / float64(maxLen); fs < fontSize {
+		fontSize = fs
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "q 0.5 w 0.25 0.25 %.2f %.2f re S Q\n", w-0.5, h-0.5)
+	fmt.Fprintf(&b, "BT /Helv %.2f Tf %.2f TL 2 %.2f Td\n", fontSize, 1.2*fontSize, h-2)
+	for _, l := range lines {
+		fmt.Fprintf(&b, "(%s) '\n", winAnsiString(l))
+	}
+	b.WriteString("ET")
+
+	fontDict := Dict(
+		map[string]Object{
+			"Type":     Name("Font"),
+			"Subtype":  Name("Type1"),
+			"BaseFont": Name("Helvetica"),
+			"Encoding": Name("WinAnsiEncoding"),
+		},
+	)
+
+	sd := &StreamDict{
+		Dict: Dict(
+			map[string]Object{
+				"Type":      Name("XObject"),
+				"Subtype":   Name("Form"),
+				"BBox":      NewNumberArray(0, 0, w, h),
+				"Resources": Dict(map[string]Object{"Font": Dict(map[string]Object{"Helv": fontDict})}),
+			},
+		),
+		Content:        b.Bytes(),
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}}}
+
+	sd.InsertName("Filter", filter.Flate)
+
+	if err := encodeStream(sd); err != nil {
+		return nil, err
+	}
+
+	objNr, err := ctx.InsertObject(*sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIndirectRef(objNr, 0), nil
+}
+
+// signer collects the objects touched while preparing a document for signing.
+type signer struct {
+	ctx    *Context
+	sp     *SignParams
+	objNrs IntSet
+}
+
+func (s *signer) modified(ir *IndirectRef) {
+	s.objNrs[ir.ObjectNumber.Value()] = true
+}
+
+func (s *signer) insert(o Object) (*IndirectRef, error) {
+
+	objNr, err := s.ctx.InsertObject(o)
+	if err != nil {
+		return nil, err
+	}
+
+	s.objNrs[objNr] = true
+
+	return NewIndirectRef(objNr, 0), nil
+}
+
+// dictEntry returns the dict d[key], creating it if necessary and keeping track of the object containing it.
+func (s *signer) dictEntry(d Dict, key string) (Dict, error) {
+
+	o, found := d.Find(key)
+	if !found || o == nil {
+		d1 := NewDict()
+		d[key] = d1
+		return d1, nil
+	}
+
+	if ir, ok := o.(IndirectRef); ok {
+		s.modified(&ir)
+	}
+
+	return s.ctx.DereferenceDict(o)
+}
+
+// appendEntry appends o to the array d[key] and keeps track of the object containing it.
+func (s *signer) appendEntry(d Dict, key string, o Object) error {
+
+	a0, found := d.Find(key)
+	if !found || a0 == nil {
+		d[key] = Array{o}
+		return nil
+	}
+
+	a, err := s.ctx.DereferenceArray(a0)
+	if err != nil {
+		return err
+	}
+
+	if ir, ok := a0.(IndirectRef); ok {
+		entry, found := s.ctx.FindTableEntryForIndRef(&ir)
+		if !found {
+			return errors.Errorf("pdfcpu: sign: missing obj #%d", ir.ObjectNumber.Value())
+		}
+		entry.Object = append(a, o)
+		s.modified(&ir)
+		return nil
+	}
+
+	d[key] = append(a, o)
+
+	return nil
+}
+
+func (s *signer) signatureDict(placeholder int) Dict {
+
+	sp := s.sp
+
+	subFilter := subFilterPKCS7
+	if sp.CAdES {
+		subFilter = subFilterCAdES
+	}
+
+	d := Dict(
+		map[string]Object{
+			"Type":      Name("Sig"),
+			"Filter":    Name("Adobe.PPKLite"),
+			"SubFilter": Name(subFilter),
+			"ByteRange": NewIntegerArray(0, byteRangePlaceholder, byteRangePlaceholder, byteRangePlaceholder),
+			"Contents":  HexLiteral(strings.Repeat("0", 2*placeholder)),
+			"M":         StringLiteral(DateString(sp.Time)),
+			"Name":      textString(signerName(sp.Cert)),
+		},
+	)
+
+	for k, v := range map[string]string{"Reason": sp.Reason, "Location": sp.Location, "ContactInfo": sp.ContactInfo} {
+		if v != "" {
+			d[k] = textString(v)
+		}
+	}
+
+	if sp.Certify > 0 {
+		d["Reference"] = Array{
+			Dict(
+				map[string]Object{
+					"Type":            Name("SigRef"),
+					"TransformMethod": Name("DocMDP"),
+					"TransformParams": Dict(
+						map[string]Object{
+							"Type": Name("TransformParams"),
+							"P":    Integer(sp.Certify),
+							"V":    Name("1.2"),
+						},
+					),
+				},
+			),
+		}
+	}
+
+	return d
+}
+
+// checkPermissions makes sure the document may be signed.
+func (s *signer) checkPermissions(fields []signatureField) error {
+
+	signed := false
+	for _, f := range fields {
+		if f.v != nil {
+			signed = true
+			break
+		}
+	}
+
+	if s.sp.Certify > 0 && signed {
+		return errors.New("pdfcpu: sign: a certification signature needs to be the first signature")
+	}
+
+	objNr := certificationSignature(s.ctx)
+	if objNr == 0 {
+		return nil
+	}
+
+	d, err := s.ctx.DereferenceDict(*NewIndirectRef(objNr, 0))
+	if err != nil || d == nil {
+		return err
+	}
+
+	if docMDPPermissions(s.ctx, d) == 1 {
+		return errors.New("pdfcpu: sign: document certified, no changes allowed")
+	}
+
+	return nil
+}
+
+func (s *signer) fieldName(fields []signatureField) string {
+
+	if s.sp.Field != "" {
+		return s.sp.Field
+	}
+
+	names := map[string]bool{}
+	for _, f := range fields {
+		names[f.name] = true
+	}
+
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("Signature%d", i)
+		if !names[name] {
+			return name
+		}
+	}
+}
+
+// addWidget creates a new signature field along with its widget annotation.
+func (s *signer) addWidget(acroForm Dict, name string, sigRef *IndirectRef) error {
+
+	ctx, sp := s.ctx, s.sp
+
+	pageRef, err := ctx.PageDictIndRef(sp.PageNr)
+	if err != nil {
+		return err
+	}
+
+	pageDict, err := ctx.DereferenceDict(*pageRef)
+	if err != nil {
+		return err
+	}
+
+	d := Dict(
+		map[string]Object{
+			"FT":      Name("Sig"),
+			"T":       textString(name),
+			"V":       *sigRef,
+			"Type":    Name("Annot"),
+			"Subtype": Name("Widget"),
+			"F":       Integer(132), // Print | Locked
+			"P":       *pageRef,
+			"Rect":    NewIntegerArray(0, 0, 0, 0),
+		},
+	)
+
+	if sp.Rect != nil {
+		d["Rect"] = sp.Rect.Array()
+		apRef, err := signatureAppearance(ctx, sp)
+		if err != nil {
+			return err
+		}
+		s.objNrs[apRef.ObjectNumber.Value()] = true
+		d["AP"] = Dict(map[string]Object{"N": *apRef})
+	}
+
+	fieldRef, err := s.insert(d)
+	if err != nil {
+		return err
+	}
+
+	if err = s.appendEntry(acroForm, "Fields", *fieldRef); err != nil {
+		return err
+	}
+
+	s.modified(pageRef)
+
+	return s.appendEntry(pageDict, "Annots", *fieldRef)
+}
+
+// prepare adds a signature dict with a placeholder for the signature to ctx.
+func (s *signer) prepare() error {
+
+	ctx, sp := s.ctx, s.sp
+
+	fields, err := signatureFields(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = s.checkPermissions(fields); err != nil {
+		return err
+	}
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	s.modified(ctx.Root)
+
+	acroForm, err := s.dictEntry(rootDict, "AcroForm")
+	if err != nil {
+		return err
+	}
+
+	// SignaturesExist | AppendOnly
+	sigFlags := 3
+	if i := acroForm.IntEntry("SigFlags"); i != nil {
+		sigFlags |= *i
+	}
+	acroForm["SigFlags"] = Integer(sigFlags)
+
+	sigRef, err := s.insert(s.signatureDict(sp.contentsSize()))
+	if err != nil {
+		return err
+	}
+
+	if sp.Certify > 0 {
+		perms, err := s.dictEntry(rootDict, "Perms")
+		if err != nil {
+			return err
+		}
+		perms["DocMDP"] = *sigRef
+	}
+
+	name := s.fieldName(fields)
+
+	for _, f := range fields {
+
+		if f.name != name {
+			continue
+		}
+
+		if f.v != nil {
+			return errors.Errorf("pdfcpu: sign: signature field %s already signed", name)
+		}
+
+		if f.ir == nil {
+			return errors.Errorf("pdfcpu: sign: unsupported signature field %s", name)
+		}
+
+		log.Info.Printf("sign: using signature field %s\n", name)
+
+		f.d["V"] = *sigRef
+		s.modified(f.ir)
+
+		return nil
+	}
+
+	log.Info.Printf("sign: creating signature field %s\n", name)
+
+	return s.addWidget(acroForm, name, sigRef)
+}
+
+// sign computes the signature for the file b and fills in the placeholders.
+func (s *signer) sign(b []byte) error {
+
+	sp := s.sp
+
+	contents := []byte("<" + strings.Repeat("0", 2*sp.contentsSize()) + ">")
+	i := bytes.LastIndex(b, contents)
+	if i < 0 {
+		return errors.New("pdfcpu: sign: missing signature placeholder")
+	}
+	j := i + len(contents)
+
+	br := []byte(NewIntegerArray(0, byteRangePlaceholder, byteRangePlaceholder, byteRangePlaceholder).PDFString())
+	k := bytes.LastIndex(b[:i], br)
+	if k < 0 {
+		return errors.New("pdfcpu: sign: missing byte range placeholder")
+	}
+
+	s1 := fmt.Sprintf("[0 %d %d %d", i, j, len(b)-j)
+	copy(b[k:], s1+strings.Repeat(" ", len(br)-len(s1)-1)+"]")
+
+	signed := make([]byte, 0, len(b)-len(contents))
+	signed = append(signed, b[:i]...)
+	signed = append(signed, b[j:]...)
+
+	opts := signOptions{CAdES: sp.CAdES}
+
+	if !sp.CAdES {
+		// PAdES signatures rely on the signing time in the signature dict.
+		opts.SigningTime = &sp.Time
+	}
+
+	if sp.TSAURL != "" {
+		opts.Timestamp = func(sig []byte) ([]byte, error) {
+			return requestTimestamp(sp.TSAURL, sig)
+		}
+	}
+
+	sig, err := signData(signed, sp.Cert, sp.Chain, sp.Key, opts)
+	if err != nil {
+		return err
+	}
+
+	if 2*len(sig) > len(contents)-2 {
+		return errors.Errorf("pdfcpu: sign: signature size %d exceeds reserved space", len(sig))
+	}
+
+	hex.Encode(b[i+1:], sig)
+
+	return nil
+}
+
+// Sign signs ctx using sp and writes the result as incremental update to ctx.Write.
+func Sign(ctx *Context, sp *SignParams) error {
+
+	if err := sp.validate(); err != nil {
+		return err
+	}
+
+	if ctx.Encrypt != nil {
+		return errors.New("pdfcpu: sign: encrypted documents are not supported")
+	}
+
+	s := &signer{ctx: ctx, sp: sp, objNrs: IntSet{}}
+
+	if err := s.prepare(); err != nil {
+		return err
+	}
+
+	var objNrs []int
+	for objNr := range s.objNrs {
+		objNrs = append(objNrs, objNr)
+	}
+
+	w := ctx.Write.Writer
+
+	var buf bytes.Buffer
+	ctx.Write.Writer = bufio.NewWriter(&buf)
+	defer func() { ctx.Write.Writer = w }()
+
+	if err := writeIncrement(ctx, objNrs); err != nil {
+		return err
+	}
+
+	b := buf.Bytes()
+
+	if err := s.sign(b); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+
+	ctx.Write.FileSize = int64(len(b))
+
+	return w.Flush()
+}
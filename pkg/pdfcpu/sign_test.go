@@ -0,0 +1,275 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tsaCert returns a self signed certificate dedicated to timestamping.
+func tsaCert(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(100),
+		Subject:      pkix.Name{CommonName: "pdfcpu Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+// tsaStandIn returns a local RFC 3161 timestamp authority.
+func tsaStandIn(t *testing.T) (*httptest.Server, *x509.Certificate) {
+	t.Helper()
+
+	cert, key := tsaCert(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil || r.Header.Get("Content-Type") != timestampQueryType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		var req timeStampReq
+		if _, err = asn1.Unmarshal(b, &req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		tst, err := asn1.Marshal(tstInfo{
+			Version:        1,
+			Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+			MessageImprint: req.MessageImprint,
+			SerialNumber:   big.NewInt(1),
+			GenTime:        time.Now().UTC().Truncate(time.Second),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := signData(tst, cert, nil, key, signOptions{EContentType: oidTSTInfo})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := asn1.Marshal(timeStampResp{TimeStampToken: asn1.RawValue{FullBytes: token}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(resp)
+	}))
+
+	return ts, cert
+}
+
+func signBytes(t *testing.T, b []byte, sp *SignParams) []byte {
+	t.Helper()
+
+	ctx, err := Read(bytes.NewReader(b), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	ctx.Write.Writer = bufio.NewWriter(&buf)
+
+	if err = Sign(ctx, sp); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func verifyAllSignatures(t *testing.T, b []byte, roots *x509.CertPool) []*SignatureStatus {
+	t.Helper()
+
+	conf := NewDefaultConfiguration()
+	conf.TrustedCerts = roots
+
+	ctx, err := Read(bytes.NewReader(b), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ctx.LoadObjects(); err != nil {
+		t.Fatal(err)
+	}
+
+	sigs, err := VerifySignatures(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sigs
+}
+
+func TestSign(t *testing.T) {
+
+	cert, key := selfSignedCert(t, "pdfcpu Signer", 10)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	tsa, tsaCert := tsaStandIn(t)
+	defer tsa.Close()
+	roots.AddCert(tsaCert)
+
+	for _, tt := range []struct {
+		fileName string
+		desc     string
+		next     string // details of a second signature applied to pdfcpu's own output
+		sigs     int
+	}{
+		// invisible approval signature
+		{"testImage.pdf", "reason:Approved, location:Berlin", "", 1},
+		// xref stream, visible certification signature
+		{"empty.pdf", "field:Approval, position:36 36 236 96, certify:2, format:cades", "", 1},
+		// timestamped signature
+		{"empty.pdf", "tsa:" + tsa.URL, "", 1},
+		// classic xref table, second signature, the existing one needs to stay valid
+		{"signed.pdf", "field:Approval, page:1, position:100 100 300 150", "", 2},
+		// certification signature followed by an approval signature permitted by DocMDP P=2
+		{"testImage.pdf", "certify:2", "field:Approval, position:36 36 236 96", 2},
+	} {
+
+		b, err := ioutil.ReadFile(filepath.Join("..", "testdata", tt.fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sp := &SignParams{Cert: cert, Key: key}
+		if err = ParseSignDetails(tt.desc, sp); err != nil {
+			t.Fatal(err)
+		}
+
+		b1 := signBytes(t, b, sp)
+
+		if !bytes.HasPrefix(b1, b) {
+			t.Fatalf("%s: original revision modified", tt.fileName)
+		}
+
+		if tt.next != "" {
+			b = b1
+			sp = &SignParams{Cert: cert, Key: key}
+			if err = ParseSignDetails(tt.next, sp); err != nil {
+				t.Fatal(err)
+			}
+			if b1 = signBytes(t, b, sp); !bytes.HasPrefix(b1, b) {
+				t.Fatalf("%s: signed revision modified", tt.fileName)
+			}
+		}
+
+		if tt.fileName == "signed.pdf" {
+			certs, err := ReadCertificates(filepath.Join("..", "testdata", "resources", "signerCA.pem"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots.AddCert(certs[0])
+		}
+
+		sigs := verifyAllSignatures(t, b1, roots)
+		if len(sigs) != tt.sigs {
+			t.Fatalf("%s: got %d signatures, want %d", tt.fileName, len(sigs), tt.sigs)
+		}
+
+		for _, s := range sigs {
+			if !s.Valid() || !s.Trusted {
+				t.Fatalf("%s: signature %s invalid: %v", tt.fileName, s.Field, s.Problems)
+			}
+		}
+
+		if tt.next != "" {
+			if s := sigs[0]; !s.Certification || s.Revision != s.Revisions-1 || !s.Modified {
+				t.Fatalf("%s: unexpected certification signature: %+v", tt.fileName, s)
+			}
+		}
+
+		s := sigs[len(sigs)-1]
+		if s.Signer != "pdfcpu Signer" || s.Modified || s.Revision != s.Revisions {
+			t.Fatalf("%s: unexpected signature: %+v", tt.fileName, s)
+		}
+
+		if sp.Certify > 0 && (!s.Certification || s.DocMDP != sp.Certify || s.SubFilter != subFilterCAdES) {
+			t.Fatalf("%s: unexpected certification signature: %+v", tt.fileName, s)
+		}
+
+		if sp.TSAURL != "" && !s.Timestamp {
+			t.Fatalf("%s: missing timestamp: %+v", tt.fileName, s)
+		}
+
+		// Timestamps of an unknown timestamp authority don't count.
+		if sp.TSAURL != "" {
+			roots1 := x509.NewCertPool()
+			roots1.AddCert(cert)
+			s := verifyAllSignatures(t, b1, roots1)[0]
+			if !s.Valid() || s.Timestamp || s.TimestampErr == "" {
+				t.Fatalf("%s: untrusted timestamp: %+v", tt.fileName, s)
+			}
+		}
+
+		if sp.Reason != "" && (s.Reason != sp.Reason || s.Location != sp.Location) {
+			t.Fatalf("%s: unexpected signature: %+v", tt.fileName, s)
+		}
+
+		// Signing the same field twice fails.
+		if sp.Field != "" {
+			ctx, err := Read(bytes.NewReader(b1), NewDefaultConfiguration())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = Sign(ctx, sp); err == nil {
+				t.Fatalf("%s: signed field %s twice", tt.fileName, sp.Field)
+			}
+		}
+	}
+}
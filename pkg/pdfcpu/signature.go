@@ -0,0 +1,677 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+// Functions dealing with digital signatures (12.8).
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// SignatureStatus represents the result of verifying the signature of a signature field.
+type SignatureStatus struct {
+	Field         string     // The fully qualified field name.
+	SubFilter     string     // The signature encoding.
+	Certification bool       // The signature is a certification signature.
+	DocTimestamp  bool       // The signature is a document timestamp.
+	Signer        string     // The signer's common name.
+	SigningTime   *time.Time // The time of signing.
+	Timestamp     bool       // SigningTime was taken from a trusted timestamp.
+	TimestampErr  string     // Why an included timestamp is not trusted.
+	Reason        string
+	Location      string
+	DocMDP        int  // DocMDP access permissions 1-3, 0 if there are none.
+	Revision      int  // The revision covered by the signature, 0 if unknown.
+	Revisions     int  // The total number of revisions.
+	Modified      bool // The document has been modified after signing.
+	Trusted       bool // The signer's certificate chains up to a trusted root.
+	Problems      []string
+}
+
+// Valid returns true if the signature has been verified successfully.
+func (ss *SignatureStatus) Valid() bool {
+	return len(ss.Problems) == 0
+}
+
+func (ss *SignatureStatus) addProblem(format string, args ...interface{}) {
+	ss.Problems = append(ss.Problems, fmt.Sprintf(format, args...))
+}
+
+type signatureField struct {
+	name string
+	v    Object       // The signature dict, nil for unsigned fields.
+	d    Dict         // The field dict.
+	ir   *IndirectRef // The field dict's indirect reference, nil for direct objects.
+}
+
+func collectSignatureFields(ctx *Context, a Array, prefix string, ft *Name, visited map[int]bool, fields *[]signatureField) error {
+
+	for _, o := range a {
+
+		var fieldRef *IndirectRef
+
+		if ir, ok := o.(IndirectRef); ok {
+			if visited[ir.ObjectNumber.Value()] {
+				continue
+			}
+			visited[ir.ObjectNumber.Value()] = true
+			fieldRef = &ir
+		}
+
+		d, err := ctx.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			continue
+		}
+
+		name := prefix
+		if o, found := d.Find("T"); found {
+			t, err := ctx.DereferenceText(o)
+			if err != nil {
+				return err
+			}
+			if name != "" {
+				name += "."
+			}
+			name += t
+		}
+
+		fieldType := ft
+		if n := d.NameEntry("FT"); n != nil {
+			fieldType = (*Name)(n)
+		}
+
+		if o, found := d.Find("Kids"); found {
+			kids, err := ctx.DereferenceArray(o)
+			if err != nil {
+				return err
+			}
+			if err = collectSignatureFields(ctx, kids, name, fieldType, visited, fields); err != nil {
+				return err
+			}
+		}
+
+		if fieldType == nil || *fieldType != "Sig" {
+			continue
+		}
+
+		if v, found := d.Find("V"); found && v != nil {
+			*fields = append(*fields, signatureField{name: name, v: v, d: d, ir: fieldRef})
+			continue
+		}
+
+		// An unsigned signature field.
+		if _, found := d.Find("T"); found {
+			*fields = append(*fields, signatureField{name: name, d: d, ir: fieldRef})
+		}
+	}
+
+	return nil
+}
+
+func signatureFields(ctx *Context) ([]signatureField, error) {
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	o, found := rootDict.Find("AcroForm")
+	if !found {
+		return nil, nil
+	}
+
+	d, err := ctx.DereferenceDict(o)
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	o, found = d.Find("Fields")
+	if !found {
+		return nil, nil
+	}
+
+	a, err := ctx.DereferenceArray(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []signatureField
+	err = collectSignatureFields(ctx, a, "", nil, map[int]bool{}, &fields)
+
+	return fields, err
+}
+
+// certificationSignature returns the object number of the certification signature dict.
+func certificationSignature(ctx *Context) int {
+
+	rootDict, err := ctx.Catalog()
+	if err != nil {
+		return 0
+	}
+
+	d, err := ctx.DereferenceDict(rootDict["Perms"])
+	if err != nil || d == nil {
+		return 0
+	}
+
+	if ir, ok := d["DocMDP"].(IndirectRef); ok {
+		return ir.ObjectNumber.Value()
+	}
+
+	return 0
+}
+
+// docMDPPermissions returns the DocMDP access permissions of the signature dict d.
+func docMDPPermissions(ctx *Context, d Dict) int {
+
+	a, err := ctx.DereferenceArray(d["Reference"])
+	if err != nil {
+		return 0
+	}
+
+	for _, o := range a {
+
+		d1, err := ctx.DereferenceDict(o)
+		if err != nil || d1 == nil {
+			continue
+		}
+
+		if tm := d1.NameEntry("TransformMethod"); tm == nil || *tm != "DocMDP" {
+			continue
+		}
+
+		// The default access permissions are 2.
+		p := 2
+
+		d2, err := ctx.DereferenceDict(d1["TransformParams"])
+		if err == nil && d2 != nil {
+			if i := d2.IntEntry("P"); i != nil && *i >= 1 && *i <= 3 {
+				p = *i
+			}
+		}
+
+		return p
+	}
+
+	return 0
+}
+
+func readRange(rs io.ReadSeeker, off, n int64) ([]byte, error) {
+
+	if _, err := rs.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rs, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func byteRange(ctx *Context, d Dict) ([]int64, error) {
+
+	a, err := ctx.DereferenceArray(d["ByteRange"])
+	if err != nil || len(a) == 0 || len(a)%2 > 0 {
+		return nil, errors.New("missing or invalid ByteRange")
+	}
+
+	br := make([]int64, len(a))
+	for i, o := range a {
+		n, err := ctx.DereferenceInteger(o)
+		if err != nil || n == nil || *n < 0 {
+			return nil, errors.New("invalid ByteRange")
+		}
+		br[i] = int64(*n)
+	}
+
+	return br, nil
+}
+
+// signedBytes checks the byte range br and returns the signed bytes and the signature value.
+// The byte range needs to cover the file up to its end except for the hex string holding the signature value.
+func signedBytes(rs io.ReadSeeker, fileSize int64, br []int64) (signed, contents []byte, err error) {
+
+	if len(br) != 4 || br[0] != 0 || br[2] <= br[1] || br[2]+br[3] > fileSize {
+		return nil, nil, errors.Errorf("invalid ByteRange %v", br)
+	}
+
+	b1, err := readRange(rs, br[0], br[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gap, err := readRange(rs, br[1], br[2]-br[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b2, err := readRange(rs, br[2], br[3])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The gap consists of the hex string holding the signature value.
+	if len(gap) < 2 || gap[0] != '<' || gap[len(gap)-1] != '>' {
+		return nil, nil, errors.New("ByteRange does not exclude exactly the signature value")
+	}
+
+	if contents, err = hex.DecodeString(string(gap[1 : len(gap)-1])); err != nil {
+		return nil, nil, errors.New("corrupt signature value")
+	}
+
+	return append(b1, b2...), contents, nil
+}
+
+func onlyWhitespace(b []byte) bool {
+	return len(bytes.TrimSpace(b)) == 0
+}
+
+// revisionContentEnd returns the offset right behind the %%EOF marker of rev excluding any trailing eol.
+func revisionContentEnd(rs io.ReadSeeker, rev *Revision) int64 {
+
+	off := rev.EOFOffset
+	for i := 0; i < 2 && off > 0; i++ {
+		b, err := readRange(rs, off-1, 1)
+		if err != nil || !onlyWhitespace(b) {
+			break
+		}
+		off--
+	}
+
+	return off
+}
+
+// coveredRevision returns the number of the revision ending at offset and if there are later modifications.
+// A signature may cover a revision up to its %%EOF marker excluding the following eol.
+func coveredRevision(rs io.ReadSeeker, fileSize, offset int64, revs []*Revision) (int, bool) {
+
+	rest, err := readRange(rs, offset, fileSize-offset)
+	modified := err != nil || !onlyWhitespace(rest)
+
+	for _, rev := range revs {
+		end := revisionContentEnd(rs, rev)
+		if end > offset {
+			break
+		}
+		b, err := readRange(rs, end, offset-end)
+		if err == nil && onlyWhitespace(b) {
+			return rev.Nr, modified
+		}
+	}
+
+	return 0, modified
+}
+
+func signerName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+// verifySigner verifies the signer's certificate chain of cs against roots at time t or now if t is nil.
+func verifySigner(cs *cmsSignature, roots *x509.CertPool, usage x509.ExtKeyUsage, t *time.Time) error {
+
+	intermediates := x509.NewCertPool()
+	for _, c := range cs.Certs {
+		intermediates.AddCert(c)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+
+	if t != nil {
+		opts.CurrentTime = *t
+	}
+
+	_, err := cs.Signer.Verify(opts)
+
+	return err
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyTimestamp takes the signing time from the timestamp of cs if issued by a trusted timestamp authority.
+func verifyTimestamp(ss *SignatureStatus, cs *cmsSignature, roots *x509.CertPool) {
+
+	if cs.TSA == nil {
+		return
+	}
+
+	// RFC 3161: The timestamp authority's certificate needs to be dedicated to timestamping.
+	if !hasExtKeyUsage(cs.TSA.Signer, x509.ExtKeyUsageTimeStamping) {
+		ss.TimestampErr = "timestamp authority not trusted: missing timeStamping extended key usage"
+		return
+	}
+
+	// The timestamp authority's certificate needs to be valid at the time of the timestamp.
+	if err := verifySigner(cs.TSA, roots, x509.ExtKeyUsageTimeStamping, cs.Timestamp); err != nil {
+		ss.TimestampErr = fmt.Sprintf("timestamp authority not trusted: %v", err)
+		return
+	}
+
+	ss.SigningTime, ss.Timestamp = cs.Timestamp, true
+}
+
+func verifyCertChain(ss *SignatureStatus, cs *cmsSignature, roots *x509.CertPool) {
+
+	if ss.DocTimestamp {
+		// The signer is the timestamp authority.
+		if !ss.Timestamp {
+			ss.addProblem("%s", ss.TimestampErr)
+			return
+		}
+		ss.Trusted = true
+		return
+	}
+
+	// The certificate needs to be valid at signing time which is only known for trusted timestamps.
+	var t *time.Time
+	if ss.Timestamp {
+		t = ss.SigningTime
+	}
+
+	if err := verifySigner(cs, roots, x509.ExtKeyUsageAny, t); err != nil {
+		ss.addProblem("signer certificate not trusted: %v", err)
+		return
+	}
+
+	ss.Trusted = true
+}
+
+func verifySignatureValue(ss *SignatureStatus, signed, contents []byte) (*cmsSignature, error) {
+
+	switch ss.SubFilter {
+
+	case "adbe.pkcs7.detached", "ETSI.CAdES.detached":
+		return verifySignedData(contents, bytes.NewReader(signed))
+
+	case "adbe.pkcs7.sha1":
+		cs, err := verifySignedData(contents, nil)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha1.Sum(signed)
+		if !bytes.Equal(cs.EContent, digest[:]) {
+			return nil, errors.New("pdfcpu: pkcs7: message digest mismatch")
+		}
+		return cs, nil
+
+	case "ETSI.RFC3161":
+		ss.DocTimestamp = true
+		cs, err := verifySignedData(contents, nil)
+		if err != nil {
+			return nil, err
+		}
+		t, err := checkTSTInfo(cs.EContent, bytes.NewReader(signed))
+		if err != nil {
+			return nil, err
+		}
+		cs.Timestamp, cs.TSA = &t, cs
+		return cs, nil
+
+	}
+
+	return nil, errors.Errorf("unsupported SubFilter %s", ss.SubFilter)
+}
+
+func verifySignature(ctx *Context, f signatureField, fileSize int64, revs []*Revision, roots *x509.CertPool, certSigObjNr int) *SignatureStatus {
+
+	ss := &SignatureStatus{Field: f.name, Revisions: len(revs)}
+
+	d, err := ctx.DereferenceDict(f.v)
+	if err != nil || d == nil {
+		ss.addProblem("missing or invalid signature dict")
+		return ss
+	}
+
+	if ir, ok := f.v.(IndirectRef); ok && ir.ObjectNumber.Value() == certSigObjNr {
+		ss.Certification = true
+	}
+
+	if sf := d.NameEntry("SubFilter"); sf != nil {
+		ss.SubFilter = *sf
+	}
+
+	for k, s := range map[string]*string{"Reason": &ss.Reason, "Location": &ss.Location, "Name": &ss.Signer} {
+		if o, found := d.Find(k); found {
+			*s, _ = ctx.DereferenceText(o)
+		}
+	}
+
+	if o, found := d.Find("M"); found {
+		if s, err := ctx.DereferenceText(o); err == nil {
+			if t, ok := DateTime(s); ok {
+				ss.SigningTime = &t
+			}
+		}
+	}
+
+	ss.DocMDP = docMDPPermissions(ctx, d)
+
+	br, err := byteRange(ctx, d)
+	if err != nil {
+		ss.addProblem("%v", err)
+		return ss
+	}
+
+	rs := ctx.Read.rs
+
+	signed, contents, err := signedBytes(rs, fileSize, br)
+	if err != nil {
+		ss.addProblem("%v", err)
+		return ss
+	}
+
+	ss.Revision, ss.Modified = coveredRevision(rs, fileSize, br[2]+br[3], revs)
+
+	cs, err := verifySignatureValue(ss, signed, contents)
+	if err != nil {
+		ss.addProblem("%v", err)
+		return ss
+	}
+
+	ss.Signer = signerName(cs.Signer)
+
+	if cs.SigningTime != nil {
+		ss.SigningTime = cs.SigningTime
+	} else if ss.DocTimestamp {
+		ss.SigningTime = cs.Timestamp
+	}
+
+	verifyTimestamp(ss, cs, roots)
+
+	verifyCertChain(ss, cs, roots)
+
+	if ss.Certification && ss.DocMDP > 0 && ss.Modified {
+		verifyDocMDP(ctx, ss, revs)
+	}
+
+	return ss
+}
+
+// verifyDocMDP checks the modifications of a certified document against its DocMDP access permissions.
+func verifyDocMDP(ctx *Context, ss *SignatureStatus, revs []*Revision) {
+
+	if ss.DocMDP == 1 {
+		ss.addProblem("document modified although DocMDP permissions don't allow any changes")
+		return
+	}
+
+	if ss.Revision == 0 {
+		ss.addProblem("document modified, changes not verified against DocMDP permissions")
+		return
+	}
+
+	objNrs, err := docMDPViolations(ctx, revs, ss.Revision, ss.DocMDP)
+	if err != nil {
+		ss.addProblem("document modified, changes not verified against DocMDP permissions: %v", err)
+		return
+	}
+
+	if len(objNrs) > 0 {
+		ss.addProblem("document modified beyond DocMDP permissions: obj#%s", objNrRanges(objNrs))
+	}
+}
+
+// VerifySignatures verifies the signatures of all signature fields of ctx.
+// Signer certificates are verified against ctx.TrustedCerts or the system's trust store.
+func VerifySignatures(ctx *Context) ([]*SignatureStatus, error) {
+
+	fields, err := signatureFields(ctx)
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+
+	if ctx.Read.rs == nil {
+		return nil, errors.New("pdfcpu: verify signatures: missing input")
+	}
+
+	fileSize, err := ctx.Read.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	revs, err := Revisions(ctx.Read.rs, ctx.Configuration)
+	if err != nil {
+		log.Info.Printf("verify signatures: unable to determine revisions: %v\n", err)
+		revs = nil
+	}
+
+	roots := ctx.TrustedCerts
+	if roots == nil {
+		if roots, err = x509.SystemCertPool(); err != nil {
+			roots = x509.NewCertPool()
+		}
+	}
+
+	certSigObjNr := certificationSignature(ctx)
+
+	var sigs []*SignatureStatus
+	for _, f := range fields {
+		if f.v != nil {
+			sigs = append(sigs, verifySignature(ctx, f, fileSize, revs, roots, certSigObjNr))
+		}
+	}
+
+	return sigs, nil
+}
+
+var docMDPPermissionsText = map[int]string{
+	1: "no changes allowed",
+	2: "form filling and signing allowed",
+	3: "form filling, signing and annotating allowed",
+}
+
+// SignatureList returns a report of verified signatures.
+func SignatureList(sigs []*SignatureStatus) []string {
+
+	if len(sigs) == 0 {
+		return []string{"no signatures found"}
+	}
+
+	var ss []string
+
+	for i, s := range sigs {
+
+		status := "valid"
+		if !s.Valid() {
+			status = "INVALID"
+		}
+
+		kind := "approval signature"
+		if s.Certification {
+			kind = "certification signature"
+		} else if s.DocTimestamp {
+			kind = "document timestamp"
+		}
+
+		ss = append(ss, fmt.Sprintf("%d: %s (%s): %s", i+1, s.Field, kind, status))
+
+		if s.Signer != "" {
+			ss = append(ss, fmt.Sprintf("   signer:      %s", s.Signer))
+		}
+
+		if s.SigningTime != nil {
+			t := s.SigningTime.Format(time.RFC3339)
+			if s.Timestamp {
+				t += " (timestamp)"
+			}
+			ss = append(ss, fmt.Sprintf("   signed at:   %s", t))
+		}
+
+		if s.TimestampErr != "" && !s.DocTimestamp {
+			ss = append(ss, fmt.Sprintf("   timestamp:   %s", s.TimestampErr))
+		}
+
+		if s.Reason != "" {
+			ss = append(ss, fmt.Sprintf("   reason:      %s", s.Reason))
+		}
+
+		if s.Location != "" {
+			ss = append(ss, fmt.Sprintf("   location:    %s", s.Location))
+		}
+
+		if s.SubFilter != "" {
+			ss = append(ss, fmt.Sprintf("   subFilter:   %s", s.SubFilter))
+		}
+
+		if s.Revision > 0 {
+			ss = append(ss, fmt.Sprintf("   covers:      revision %d of %d", s.Revision, s.Revisions))
+		}
+
+		modified := "no"
+		if s.Modified {
+			modified = "yes"
+		}
+		ss = append(ss, fmt.Sprintf("   modified after signing: %s", modified))
+
+		if s.DocMDP > 0 {
+			ss = append(ss, fmt.Sprintf("   DocMDP:      %d (%s)", s.DocMDP, docMDPPermissionsText[s.DocMDP]))
+		}
+
+		for _, p := range s.Problems {
+			ss = append(ss, fmt.Sprintf("   problem:     %s", p))
+		}
+	}
+
+	return ss
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func verifySignatures(t *testing.T, b []byte, roots *x509.CertPool) *SignatureStatus {
+	t.Helper()
+
+	conf := NewDefaultConfiguration()
+	conf.TrustedCerts = roots
+
+	ctx, err := Read(bytes.NewReader(b), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigs, err := VerifySignatures(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sigs) != 1 {
+		t.Fatalf("got %d signatures, want 1", len(sigs))
+	}
+
+	return sigs[0]
+}
+
+func TestVerifySignatures(t *testing.T) {
+
+	// signed.pdf carries a certification signature created by openssl cms.
+	b, err := ioutil.ReadFile(filepath.Join("..", "testdata", "signed.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := ReadCertificates(filepath.Join("..", "testdata", "resources", "signerCA.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certs[0])
+
+	s := verifySignatures(t, b, roots)
+	if !s.Valid() || !s.Trusted {
+		t.Fatalf("signature invalid: %v", s.Problems)
+	}
+	if s.Field != "Signature1" || s.Signer != "pdfcpu Test Signer" || !s.Certification || s.DocMDP != 2 {
+		t.Fatalf("unexpected signature: %+v", s)
+	}
+	if s.Revision != 1 || s.Modified || s.SigningTime == nil {
+		t.Fatalf("unexpected signature: %+v", s)
+	}
+
+	// Unknown signer.
+	if s = verifySignatures(t, b, x509.NewCertPool()); s.Valid() || s.Trusted {
+		t.Fatal("untrusted signature reported valid")
+	}
+
+	// Modification of signed bytes.
+	b1 := bytes.Replace(b, []byte("(Approved)"), []byte("(Rejected)"), 1)
+	if s = verifySignatures(t, b1, roots); s.Valid() {
+		t.Fatal("tampered signature reported valid")
+	}
+
+	// Incremental update after signing.
+	b2 := appendRevision(t, b, map[int]string{7: "(Hello)"}, nil)
+	s = verifySignatures(t, b2, roots)
+	if !s.Valid() || !s.Modified || s.Revision != 1 || s.Revisions != 2 {
+		t.Fatalf("unexpected signature after update: %+v", s)
+	}
+
+	// DocMDP access permissions 2 allow form filling but neither annotating nor changing page content.
+	catalog := "<</Type/Catalog/Pages 2 0 R/AcroForm<</Fields[4 0 R 7 0 R]/SigFlags 3>>/Perms<</DocMDP 5 0 R>>>>"
+	page := "<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 200]/Resources<</Font<</F1<</Type/Font/Subtype/Type1/BaseFont/Helvetica>>>>>>/Contents 6 0 R/Annots[4 0 R 7 0 R]>>"
+
+	for _, tt := range []struct {
+		desc  string
+		objs  map[int]string
+		valid bool
+	}{
+		{"fill in form",
+			map[int]string{
+				1: catalog,
+				3: page,
+				7: "<</FT/Tx/T(Name)/V(Joe)/Type/Annot/Subtype/Widget/Rect[10 10 100 30]/P 3 0 R>>"},
+			true},
+		{"annotate",
+			map[int]string{
+				3: page,
+				7: "<</Type/Annot/Subtype/Text/Rect[10 10 30 30]/Contents(Rejected)/P 3 0 R>>"},
+			false},
+		{"change content",
+			map[int]string{6: "<</Length 0>>\nstream\n\nendstream"},
+			false},
+	} {
+		s = verifySignatures(t, appendRevision(t, b, tt.objs, nil), roots)
+		if s.Valid() != tt.valid || !s.Modified {
+			t.Fatalf("%s: unexpected signature after update: %+v", tt.desc, s)
+		}
+	}
+}
+
+func TestVerifyDetachedSignatureWithEncapsulatedContent(t *testing.T) {
+
+	b, err := ioutil.ReadFile(filepath.Join("..", "testdata", "testImage.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, key := selfSignedCert(t, "pdfcpu Signer", 10)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	b = signBytes(t, b, &SignParams{Cert: cert, Key: key})
+
+	if s := verifySignatures(t, b, roots); !s.Valid() {
+		t.Fatalf("signature invalid: %v", s.Problems)
+	}
+
+	// Replace the signature value by a signature of arbitrary encapsulated content
+	// that does not cover the signed bytes at all.
+	m := regexp.MustCompile(`/ByteRange\s*\[\s*0\s+(\d+)\s+(\d+)`).FindSubmatch(b)
+	if m == nil {
+		t.Fatal("missing ByteRange")
+	}
+	from, _ := strconv.Atoi(string(m[1]))
+	to, _ := strconv.Atoi(string(m[2]))
+
+	forged, err := signData([]byte("forged"), cert, nil, key, signOptions{EContentType: oidData})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := hex.EncodeToString(forged)
+	if len(contents) > to-from-2 {
+		t.Fatal("forged signature value too long")
+	}
+
+	b1 := append([]byte{}, b...)
+	copy(b1[from+1:to-1], bytes.Repeat([]byte("0"), to-from-2))
+	copy(b1[from+1:], contents)
+
+	if s := verifySignatures(t, b1, roots); s.Valid() {
+		t.Fatal("detached signature with encapsulated content reported valid")
+	}
+}
+
+func TestDateTime(t *testing.T) {
+
+	for _, tt := range []struct {
+		s    string
+		want time.Time
+		ok   bool
+	}{
+		{"D:20190917143000+02'00'", time.Date(2019, 9, 17, 12, 30, 0, 0, time.UTC), true},
+		{"D:20190917143000Z", time.Date(2019, 9, 17, 14, 30, 0, 0, time.UTC), true},
+		{"D:2019", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"D:20190917143000-05'30", time.Date(2019, 9, 17, 20, 0, 0, 0, time.UTC), true},
+		{"Tuesday", time.Time{}, false},
+	} {
+		got, ok := DateTime(tt.s)
+		if ok != tt.ok || ok && !got.Equal(tt.want) {
+			t.Errorf("DateTime(%s) = %v %t, want %v %t", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
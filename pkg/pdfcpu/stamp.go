@@ -1529,11 +1529,9 @@ func AddWatermarks(ctx *Context, selectedPages IntSet, wm *Watermark) error {
 		return err
 	}
 
-	for k, v := range selectedPages {
-		if v {
-			if err := addPageWatermark(xRefTable, k, wm); err != nil {
-				return err
-			}
+	for _, k := range sortedSelectedPages(selectedPages) {
+		if err := addPageWatermark(xRefTable, k, wm); err != nil {
+			return err
 		}
 	}
 
@@ -1842,10 +1840,7 @@ func RemoveWatermarks(ctx *Context, selectedPages IntSet) error {
 
 	var removedSmth bool
 
-	for k, v := range selectedPages {
-		if !v {
-			continue
-		}
+	for _, k := range sortedSelectedPages(selectedPages) {
 
 		ok, err := removePageWatermark(ctx.XRefTable, k)
 		if err != nil {
@@ -17,7 +17,10 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 
 	"github.com/pdfcpu/pdfcpu/pkg/filter"
 	"github.com/pdfcpu/pdfcpu/pkg/log"
@@ -40,6 +43,7 @@ type StreamDict struct {
 	Raw               []byte // Encoded
 	Content           []byte // Decoded
 	IsPageContent     bool
+	source            *streamSource // The encoded content on file unless Raw is loaded.
 }
 
 // NewStreamDict creates a new PDFStreamDict for given PDFDict, stream offset and length.
@@ -53,7 +57,153 @@ func NewStreamDict(d Dict, streamOffset int64, streamLength *int64, streamLength
 		nil,
 		nil,
 		false,
+		nil,
+	}
+}
+
+// streamSource locates the encoded content of a stream on file.
+// Stream content is read on demand so even huge streams never need to be held in memory as a whole.
+type streamSource struct {
+	rs           io.ReadSeeker
+	offset       int64
+	length       int64  // The length on file.
+	key          []byte // The decryption key, nil for unencrypted content.
+	objNr, genNr int
+	aes          bool
+	rev          int
+	rawLength    *int64 // The decrypted length once known.
+}
+
+// reader returns a reader for the decrypted encoded stream content.
+func (src *streamSource) reader() (io.Reader, error) {
+
+	r := io.Reader(&sectionReader{rs: src.rs, off: src.offset, n: src.length})
+
+	if src.key == nil {
+		return r, nil
+	}
+
+	return decryptStreamReader(r, src.objNr, src.genNr, src.key, src.aes, src.rev)
+}
+
+// decryptedLength returns the length of the decrypted encoded stream content.
+func (src *streamSource) decryptedLength() (int64, error) {
+
+	// RC4 preserves the length.
+	if src.key == nil || !src.aes {
+		return src.length, nil
+	}
+
+	if src.rawLength == nil {
+		r, err := src.reader()
+		if err != nil {
+			return 0, err
+		}
+		n, err := io.Copy(ioutil.Discard, r)
+		if err != nil {
+			return 0, err
+		}
+		src.rawLength = &n
+	}
+
+	return *src.rawLength, nil
+}
+
+// sectionReader reads n bytes of rs starting at off regardless of any other reads from rs in between.
+type sectionReader struct {
+	rs  io.ReadSeeker
+	off int64
+	n   int64
+}
+
+func (sr *sectionReader) Read(p []byte) (int, error) {
+
+	if sr.n <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > sr.n {
+		p = p[:sr.n]
+	}
+
+	var (
+		n   int
+		err error
+	)
+
+	if ra, ok := sr.rs.(io.ReaderAt); ok {
+		n, err = ra.ReadAt(p, sr.off)
+	} else if _, err = sr.rs.Seek(sr.off, io.SeekStart); err == nil {
+		n, err = sr.rs.Read(p)
+	}
+
+	sr.off += int64(n)
+	sr.n -= int64(n)
+
+	if err == io.EOF && sr.n > 0 {
+		err = nil
+		if n == 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+
+	return n, err
+}
+
+// rawReader returns a reader for the encoded stream content which gets read from file unless loaded.
+func (sd StreamDict) rawReader() (io.Reader, error) {
+
+	if sd.Raw == nil && sd.source != nil {
+		return sd.source.reader()
 	}
+
+	return bytes.NewReader(sd.Raw), nil
+}
+
+// copyRaw copies the encoded stream content to w.
+func (sd StreamDict) copyRaw(w io.Writer) (int64, error) {
+
+	r, err := sd.rawReader()
+	if err != nil {
+		return 0, err
+	}
+
+	return io.Copy(w, r)
+}
+
+// rawLength returns the length of the encoded stream content.
+func (sd StreamDict) rawLength() (int64, error) {
+
+	if sd.Raw == nil && sd.source != nil {
+		return sd.source.decryptedLength()
+	}
+
+	return int64(len(sd.Raw)), nil
+}
+
+// loadRaw reads the encoded stream content into memory unless already loaded.
+func (sd *StreamDict) loadRaw() error {
+
+	if sd.Raw != nil || sd.source == nil {
+		return nil
+	}
+
+	r, err := sd.source.reader()
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	sd.Raw, sd.source = b, nil
+
+	streamLength := int64(len(sd.Raw))
+	sd.StreamLength = &streamLength
+
+	return nil
 }
 
 // HasSoleFilterNamed returns true if there is exactly one filter defined for a stream dict.
@@ -0,0 +1,591 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"math"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/content"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+)
+
+// TextRun represents the text shown by a single text showing operator.
+type TextRun struct {
+	Text string
+	Font string     // BaseFont of the font in use.
+	Size float64    // Font size in user space units.
+	BBox *Rectangle // Bounding box in user space.
+
+	glyphs []textGlyph
+
+	// Start and end of the baseline in user space.
+	x0, y0, x1, y1 float64
+
+	// Writing direction in user space.
+	dx, dy float64
+}
+
+// textGlyph represents the text and bounding box of a single character code.
+type textGlyph struct {
+	text string
+	bbox *Rectangle
+}
+
+// PageText represents the text of a page in content stream order.
+type PageText struct {
+	Page int
+	Text string
+	Runs []TextRun
+
+	spans []textSpan
+}
+
+func (m matrix) transform(x, y float64) (float64, float64) {
+	return x*m[0][0] + y*m[1][0] + m[2][0], x*m[0][1] + y*m[1][1] + m[2][1]
+}
+
+func translationMatrix(tx, ty float64) matrix {
+	return matrix{{1, 0, 0}, {0, 1, 0}, {tx, ty, 1}}
+}
+
+// boundingBox returns the bounding box of the rectangle llx,lly,urx,ury transformed by m.
+func (m matrix) boundingBox(llx, lly, urx, ury float64) *Rectangle {
+
+	xs, ys := make([]float64, 4), make([]float64, 4)
+	xs[0], ys[0] = m.transform(llx, lly)
+	xs[1], ys[1] = m.transform(urx, lly)
+	xs[2], ys[2] = m.transform(urx, ury)
+	xs[3], ys[3] = m.transform(llx, ury)
+
+	r := Rect(xs[0], ys[0], xs[0], ys[0])
+	for i := 1; i < 4; i++ {
+		r.LL.X, r.LL.Y = math.Min(r.LL.X, xs[i]), math.Min(r.LL.Y, ys[i])
+		r.UR.X, r.UR.Y = math.Max(r.UR.X, xs[i]), math.Max(r.UR.Y, ys[i])
+	}
+
+	return r
+}
+
+func union(r1, r2 *Rectangle) *Rectangle {
+	if r1 == nil {
+		return Rect(r2.LL.X, r2.LL.Y, r2.UR.X, r2.UR.Y)
+	}
+	return Rect(math.Min(r1.LL.X, r2.LL.X), math.Min(r1.LL.Y, r2.LL.Y), math.Max(r1.UR.X, r2.UR.X), math.Max(r1.UR.Y, r2.UR.Y))
+}
+
+// textState represents the text state parameters of the graphics state, see 9.3.
+type textState struct {
+	font      *textFont
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	hScale    float64
+	leading   float64
+	rise      float64
+}
+
+// textScanner runs the text showing operators of content streams through the graphics and text state.
+type textScanner struct {
+	xRefTable   *XRefTable
+	fontObjects map[int]*FontObject // Font dicts resolved by optimize.
+	fonts       map[int]*textFont
+	forms       IntSet // Form XObjects currently being scanned.
+
+	ctm      matrix
+	ts       textState
+	tm, tlm  matrix
+	stack    []textScannerState
+	fontName string
+
+	runs []TextRun
+}
+
+type textScannerState struct {
+	ctm      matrix
+	ts       textState
+	fontName string
+}
+
+func newTextScanner(xRefTable *XRefTable) *textScanner {
+	return &textScanner{xRefTable: xRefTable, fonts: map[int]*textFont{}, forms: IntSet{}}
+}
+
+func (s *textScanner) font(resources Dict, name string) *textFont {
+
+	d, err := s.xRefTable.DereferenceDict(resources["Font"])
+	if err != nil || d == nil {
+		return defaultTextFont
+	}
+
+	o := d[name]
+
+	ir, ok := o.(IndirectRef)
+	if ok {
+		if f, ok := s.fonts[ir.ObjectNumber.Value()]; ok {
+			return f
+		}
+		if fo, ok := s.fontObjects[ir.ObjectNumber.Value()]; ok {
+			o = fo.FontDict
+		}
+	}
+
+	fd, err := s.xRefTable.DereferenceDict(o)
+	if err != nil || fd == nil {
+		log.Info.Printf("textScanner: missing font %s\n", name)
+		return defaultTextFont
+	}
+
+	f, err := s.xRefTable.newTextFont(fd)
+	if err != nil {
+		log.Info.Printf("textScanner: font %s: %v\n", name, err)
+		f = defaultTextFont
+	}
+
+	if ok {
+		s.fonts[ir.ObjectNumber.Value()] = f
+	}
+
+	return f
+}
+
+// glyph returns the text and bounding box of the glyph shown for a character code at the current text position
+// along with its horizontal displacement in unscaled text space units, see 9.4.4.
+func (s *textScanner) glyph(f *textFont, code []byte) (textGlyph, float64) {
+
+	ts := &s.ts
+
+	// Text rendering matrix, see 9.4.4.
+	trm := matrix{{ts.fontSize * ts.hScale, 0, 0}, {0, ts.fontSize, 0}, {0, ts.rise, 1}}.multiply(s.tm).multiply(s.ctm)
+
+	w := f.width(code)
+	g := textGlyph{text: f.text(code), bbox: trm.boundingBox(0, f.descent*f.scale, w, f.ascent*f.scale)}
+
+	tx := w*ts.fontSize + ts.charSpace
+	if len(code) == 1 && code[0] == ' ' {
+		tx += ts.wordSpace
+	}
+
+	return g, tx
+}
+
+// showText shows the character codes of a string and appends the resulting glyphs to run.
+func (s *textScanner) showText(b []byte, run *TextRun) {
+
+	f := s.ts.font
+	if f == nil {
+		f = defaultTextFont
+	}
+
+	for len(b) > 0 {
+
+		if len(run.glyphs) == 0 {
+			// Leading TJ adjustments move the start of the run.
+			run.x0, run.y0 = s.origin()
+		}
+
+		n := f.codeLength(b)
+		g, tx := s.glyph(f, b[:n])
+		b = b[n:]
+
+		run.glyphs = append(run.glyphs, g)
+		s.tm = translationMatrix(tx*s.ts.hScale, 0).multiply(s.tm)
+	}
+}
+
+// origin returns the current position on the baseline in user space.
+func (s *textScanner) origin() (float64, float64) {
+	return matrix{{1, 0, 0}, {0, 1, 0}, {0, s.ts.rise, 1}}.multiply(s.tm).multiply(s.ctm).transform(0, 0)
+}
+
+// adjust applies a TJ position adjustment.
+func (s *textScanner) adjust(f float64, run *TextRun) {
+
+	font, ts := s.ts.font, &s.ts
+	if font == nil {
+		font = defaultTextFont
+	}
+
+	tx := -f / 1000 * ts.fontSize * ts.hScale
+
+	// Treat large gaps as word separators.
+	if f < -250 && len(run.glyphs) > 0 && run.glyphs[len(run.glyphs)-1].text != " " {
+		trm := matrix{{ts.fontSize * ts.hScale, 0, 0}, {0, ts.fontSize, 0}, {0, ts.rise, 1}}.multiply(s.tm).multiply(s.ctm)
+		g := textGlyph{text: " ", bbox: trm.boundingBox(0, font.descent*font.scale, -f/1000, font.ascent*font.scale)}
+		run.glyphs = append(run.glyphs, g)
+	}
+
+	s.tm = translationMatrix(tx, 0).multiply(s.tm)
+}
+
+// show processes a text showing operation and records the text run.
+func (s *textScanner) show(operands []content.Operand) {
+
+	ts := &s.ts
+	run := TextRun{Font: s.fontName}
+
+	if ts.font != nil && ts.font.name != "" {
+		run.Font = ts.font.name
+	}
+
+	m := s.tm.multiply(s.ctm)
+	run.Size = ts.fontSize * math.Hypot(m[1][0], m[1][1])
+	if l := math.Hypot(m[0][0], m[0][1]); l > 0 {
+		run.dx, run.dy = m[0][0]/l, m[0][1]/l
+	}
+
+	for _, o := range operands {
+		switch o := o.(type) {
+		case content.LiteralString:
+			s.showText([]byte(o), &run)
+		case content.HexString:
+			s.showText([]byte(o), &run)
+		case content.Array:
+			for _, o := range o {
+				switch o := o.(type) {
+				case content.LiteralString:
+					s.showText([]byte(o), &run)
+				case content.HexString:
+					s.showText([]byte(o), &run)
+				case content.Integer:
+					s.adjust(float64(o), &run)
+				case content.Real:
+					s.adjust(float64(o), &run)
+				}
+			}
+		}
+	}
+
+	if len(run.glyphs) == 0 {
+		return
+	}
+
+	run.x1, run.y1 = s.origin()
+
+	var sb strings.Builder
+	for _, g := range run.glyphs {
+		sb.WriteString(g.text)
+		run.BBox = union(run.BBox, g.bbox)
+	}
+	run.Text = sb.String()
+
+	s.runs = append(s.runs, run)
+}
+
+func (s *textScanner) nextLine(tx, ty float64) {
+	s.tlm = translationMatrix(tx, ty).multiply(s.tlm)
+	s.tm = s.tlm
+}
+
+func (s *textScanner) doXObject(resources Dict, name string) error {
+
+	d, err := s.xRefTable.DereferenceDict(resources["XObject"])
+	if err != nil || d == nil {
+		return err
+	}
+
+	ir, ok := d[name].(IndirectRef)
+	if !ok {
+		return nil
+	}
+	objNr := ir.ObjectNumber.Value()
+
+	sd, err := s.xRefTable.DereferenceStreamDict(ir)
+	if err != nil || sd == nil {
+		return err
+	}
+
+	if st := sd.Subtype(); st == nil || *st != "Form" || s.forms[objNr] {
+		return nil
+	}
+
+	m := identMatrix
+	if a, err := s.xRefTable.numberArray(sd.Dict["Matrix"]); err == nil && len(a) == 6 {
+		for i, f := range a {
+			m[i/2][i%2] = f
+		}
+	}
+
+	formResources, err := s.xRefTable.DereferenceDict(sd.Dict["Resources"])
+	if err != nil {
+		return err
+	}
+	if formResources == nil {
+		formResources = resources
+	}
+
+	if err = decodeStream(sd); err != nil {
+		log.Info.Printf("textScanner: skipping form obj#%d: %v\n", objNr, err)
+		return nil
+	}
+
+	s.forms[objNr] = true
+	defer delete(s.forms, objNr)
+
+	// A form XObject is painted within its own q/Q pair.
+	s.push()
+	defer s.pop()
+
+	s.ctm = m.multiply(s.ctm)
+
+	return s.scan(sd.Content, formResources)
+}
+
+func (s *textScanner) push() {
+	s.stack = append(s.stack, textScannerState{ctm: s.ctm, ts: s.ts, fontName: s.fontName})
+}
+
+func (s *textScanner) pop() {
+	if len(s.stack) == 0 {
+		return
+	}
+	st := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	s.ctm, s.ts, s.fontName = st.ctm, st.ts, st.fontName
+}
+
+func (s *textScanner) setTextMatrix(f []float64) {
+	m := identMatrix
+	for i := range f {
+		m[i/2][i%2] = f[i]
+	}
+	s.tm, s.tlm = m, m
+}
+
+// apply applies the effect of op on the graphics and text state
+// leaving the showing of text and the painting of XObjects to the caller.
+func (s *textScanner) apply(op content.Operation, resources Dict) {
+
+	ts := &s.ts
+	f, numbers := content.Numbers(op.Operands)
+
+	switch op.Operator {
+
+	case "q":
+		s.push()
+
+	case "Q":
+		s.pop()
+
+	case "cm":
+		if numbers && len(f) == 6 {
+			m := identMatrix
+			for i := range f {
+				m[i/2][i%2] = f[i]
+			}
+			s.ctm = m.multiply(s.ctm)
+		}
+
+	case "BT":
+		s.tm, s.tlm = identMatrix, identMatrix
+
+	case "Tf":
+		if len(op.Operands) != 2 {
+			return
+		}
+		name, ok := op.Operands[0].(content.Name)
+		size, ok1 := content.Numbers(op.Operands[1:])
+		if !ok || !ok1 {
+			return
+		}
+		s.fontName, ts.fontSize = string(name), size[0]
+		ts.font = s.font(resources, string(name))
+
+	case "Tc", "Tw", "Tz", "TL", "Ts":
+		if !numbers || len(f) != 1 {
+			return
+		}
+		switch op.Operator {
+		case "Tc":
+			ts.charSpace = f[0]
+		case "Tw":
+			ts.wordSpace = f[0]
+		case "Tz":
+			ts.hScale = f[0] / 100
+		case "TL":
+			ts.leading = f[0]
+		case "Ts":
+			ts.rise = f[0]
+		}
+
+	case "Td", "TD":
+		if !numbers || len(f) != 2 {
+			return
+		}
+		if op.Operator == "TD" {
+			ts.leading = -f[1]
+		}
+		s.nextLine(f[0], f[1])
+
+	case "Tm":
+		if numbers && len(f) == 6 {
+			s.setTextMatrix(f)
+		}
+
+	case "T*", "'":
+		s.nextLine(0, -ts.leading)
+
+	case "\"":
+		if len(op.Operands) != 3 {
+			return
+		}
+		if f, ok := content.Numbers(op.Operands[:2]); ok {
+			ts.wordSpace, ts.charSpace = f[0], f[1]
+		}
+		s.nextLine(0, -ts.leading)
+	}
+}
+
+// shownText returns the operands of a text showing operation holding the text to be shown.
+func shownText(op content.Operation) []content.Operand {
+	switch op.Operator {
+	case "Tj", "TJ", "'":
+		return op.Operands
+	case "\"":
+		if len(op.Operands) == 3 {
+			return op.Operands[2:]
+		}
+	}
+	return nil
+}
+
+func (s *textScanner) scan(b []byte, resources Dict) error {
+
+	ops, err := content.Parse(b)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+
+		s.apply(op, resources)
+
+		switch op.Operator {
+
+		case "Tj", "TJ", "'", "\"":
+			s.show(shownText(op))
+
+		case "Do":
+			if len(op.Operands) != 1 {
+				continue
+			}
+			if name, ok := op.Operands[0].(content.Name); ok {
+				if err = s.doXObject(resources, string(name)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// textSpan locates the text of a glyph within the text of a page.
+type textSpan struct {
+	start, end int // Byte offsets.
+	run        int // Index of the text run.
+	bbox       *Rectangle
+}
+
+// layoutText joins the text of runs inserting line breaks and spaces according to their positions.
+// The returned spans locate the text of each glyph.
+func layoutText(runs []TextRun) (string, []textSpan) {
+
+	var sb strings.Builder
+	var spans []textSpan
+	var prev *TextRun
+
+	for i := range runs {
+
+		r := &runs[i]
+		if r.Text == "" {
+			continue
+		}
+
+		if prev != nil {
+
+			// Distance from the end of the previous run along and across its writing direction.
+			vx, vy := r.x0-prev.x1, r.y0-prev.y1
+			along := vx*prev.dx + vy*prev.dy
+			across := vx*prev.dy - vy*prev.dx
+
+			size := math.Max(prev.Size, r.Size)
+
+			switch {
+			case math.Abs(across) > size/2 || along < -size:
+				sb.WriteString("\n")
+			case along > size/5 && !strings.HasSuffix(prev.Text, " ") && !strings.HasPrefix(r.Text, " "):
+				sb.WriteString(" ")
+			}
+		}
+
+		for _, g := range r.glyphs {
+			if g.text == "" {
+				continue
+			}
+			start := sb.Len()
+			sb.WriteString(g.text)
+			spans = append(spans, textSpan{start: start, end: sb.Len(), run: i, bbox: g.bbox})
+		}
+
+		prev = r
+	}
+
+	return sb.String(), spans
+}
+
+// ExtractPageText returns the text of the selected pages along with their text runs.
+func ExtractPageText(ctx *Context, pageNrs []int) ([]PageText, error) {
+
+	s := newTextScanner(ctx.XRefTable)
+	if ctx.Optimize != nil {
+		s.fontObjects = ctx.Optimize.FontObjects
+	}
+
+	var pp []PageText
+
+	for _, i := range pageNrs {
+
+		d, inhPAttrs, err := ctx.PageDict(i)
+		if err != nil {
+			return nil, err
+		}
+
+		pt := PageText{Page: i}
+
+		if d != nil {
+
+			b, err := ctx.PageContent(d)
+			if err != nil {
+				return nil, err
+			}
+
+			s.ctm, s.ts, s.stack, s.runs = identMatrix, textState{hScale: 1}, nil, nil
+
+			if err = s.scan(b, inhPAttrs.resources); err != nil {
+				return nil, err
+			}
+
+			pt.Runs = s.runs
+			pt.Text, pt.spans = layoutText(s.runs)
+		}
+
+		pp = append(pp, pt)
+	}
+
+	return pp, nil
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// simpleEncoding maps the single byte codes of a simple font to unicode, "" for undefined codes.
+type simpleEncoding [256]string
+
+// Glyph names of the printable ASCII range 0x20..0x7E.
+var asciiGlyphNames = strings.Fields(`
+	space exclam quotedbl numbersign dollar percent ampersand quotesingle parenleft parenright asterisk plus comma hyphen period slash
+	zero one two three four five six seven eight nine colon semicolon less equal greater question
+	at A B C D E F G H I J K L M N O P Q R S T U V W X Y Z bracketleft backslash bracketright asciicircum underscore
+	grave a b c d e f g h i j k l m n o p q r s t u v w x y z braceleft bar braceright asciitilde`)
+
+// Glyph names of the Latin-1 range 0xA1..0xFF.
+var latin1GlyphNames = strings.Fields(`
+	exclamdown cent sterling currency yen brokenbar section dieresis copyright ordfeminine guillemotleft logicalnot hyphen registered macron
+	degree plusminus twosuperior threesuperior acute mu paragraph periodcentered cedilla onesuperior ordmasculine guillemotright onequarter onehalf threequarters questiondown
+	Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis
+	Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls
+	agrave aacute acircumflex atilde adieresis aring ae ccedilla egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis
+	eth ntilde ograve oacute ocircumflex otilde odieresis divide oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis`)
+
+// Glyph names outside ASCII and Latin-1 used by the standard Latin encodings, see Annex D.
+var extraGlyphNames = map[string]rune{
+	"Euro": 0x20AC, "quotesinglbase": 0x201A, "florin": 0x0192, "quotedblbase": 0x201E, "ellipsis": 0x2026,
+	"dagger": 0x2020, "daggerdbl": 0x2021, "circumflex": 0x02C6, "perthousand": 0x2030, "Scaron": 0x0160,
+	"guilsinglleft": 0x2039, "OE": 0x0152, "Zcaron": 0x017D, "quoteleft": 0x2018, "quoteright": 0x2019,
+	"quotedblleft": 0x201C, "quotedblright": 0x201D, "bullet": 0x2022, "endash": 0x2013, "emdash": 0x2014,
+	"tilde": 0x02DC, "trademark": 0x2122, "scaron": 0x0161, "guilsinglright": 0x203A, "oe": 0x0153,
+	"zcaron": 0x017E, "Ydieresis": 0x0178, "fraction": 0x2044, "fi": 0xFB01, "fl": 0xFB02, "ff": 0xFB00,
+	"ffi": 0xFB03, "ffl": 0xFB04, "dotlessi": 0x0131, "Lslash": 0x0141, "lslash": 0x0142, "breve": 0x02D8,
+	"dotaccent": 0x02D9, "ring": 0x02DA, "hungarumlaut": 0x02DD, "ogonek": 0x02DB, "caron": 0x02C7,
+	"minus": 0x2212, "nbspace": 0x00A0, "sfthyphen": 0x00AD, "nonbreakingspace": 0x00A0, "mu1": 0x00B5,
+}
+
+// Glyph names for StandardEncoding codes differing from ASCII, see Annex D.2.
+var standardEncodingGlyphNames = map[byte]string{
+	0x27: "quoteright", 0x60: "quoteleft",
+	0xA1: "exclamdown", 0xA2: "cent", 0xA3: "sterling", 0xA4: "fraction", 0xA5: "yen", 0xA6: "florin",
+	0xA7: "section", 0xA8: "currency", 0xA9: "quotesingle", 0xAA: "quotedblleft", 0xAB: "guillemotleft",
+	0xAC: "guilsinglleft", 0xAD: "guilsinglright", 0xAE: "fi", 0xAF: "fl", 0xB1: "endash", 0xB2: "dagger",
+	0xB3: "daggerdbl", 0xB4: "periodcentered", 0xB6: "paragraph", 0xB7: "bullet", 0xB8: "quotesinglbase",
+	0xB9: "quotedblbase", 0xBA: "quotedblright", 0xBB: "guillemotright", 0xBC: "ellipsis", 0xBD: "perthousand",
+	0xBF: "questiondown", 0xC1: "grave", 0xC2: "acute", 0xC3: "circumflex", 0xC4: "tilde", 0xC5: "macron",
+	0xC6: "breve", 0xC7: "dotaccent", 0xC8: "dieresis", 0xCA: "ring", 0xCB: "cedilla", 0xCD: "hungarumlaut",
+	0xCE: "ogonek", 0xCF: "caron", 0xD0: "emdash", 0xE1: "AE", 0xE3: "ordfeminine", 0xE8: "Lslash",
+	0xE9: "Oslash", 0xEA: "OE", 0xEB: "ordmasculine", 0xF1: "ae", 0xF5: "dotlessi", 0xF8: "lslash",
+	0xF9: "oslash", 0xFA: "oe", 0xFB: "germandbls",
+}
+
+var (
+	glyphNames = map[string]rune{}
+
+	standardEncoding, winAnsiEncoding, macRomanEncoding simpleEncoding
+)
+
+func init() {
+
+	for i, n := range asciiGlyphNames {
+		glyphNames[n] = rune(0x20 + i)
+	}
+
+	for i, n := range latin1GlyphNames {
+		if _, ok := glyphNames[n]; !ok {
+			glyphNames[n] = rune(0xA1 + i)
+		}
+	}
+
+	for n, r := range extraGlyphNames {
+		glyphNames[n] = r
+	}
+
+	for c := 0x20; c < 0x7F; c++ {
+		standardEncoding[c] = string(rune(c))
+	}
+	for c, n := range standardEncodingGlyphNames {
+		standardEncoding[c] = string(glyphNames[n])
+	}
+
+	for c := 0x20; c <= 0xFF; c++ {
+		if c == 0x7F {
+			continue
+		}
+		if r := charmap.Windows1252.DecodeByte(byte(c)); r != utf8.RuneError {
+			winAnsiEncoding[c] = string(r)
+		}
+		macRomanEncoding[c] = string(charmap.Macintosh.DecodeByte(byte(c)))
+	}
+}
+
+// glyphRune returns the unicode character for a glyph name, see the Adobe Glyph List Specification.
+func glyphRune(name string) (rune, bool) {
+
+	if r, ok := glyphNames[name]; ok {
+		return r, true
+	}
+
+	var hex string
+	switch {
+	case strings.HasPrefix(name, "uni") && len(name) == 7:
+		hex = name[3:]
+	case strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7:
+		hex = name[1:]
+	}
+
+	if hex != "" {
+		if i, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(i)) {
+			return rune(i), true
+		}
+	}
+
+	if utf8.RuneCountInString(name) == 1 {
+		r, _ := utf8.DecodeRuneInString(name)
+		return r, true
+	}
+
+	return 0, false
+}
+
+// glyphText returns the text for a glyph name.
+// Suffixes like in "a.sc" are ignored and ligatures like "f_f_i" are mapped to their components.
+func glyphText(name string) string {
+
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+
+	var sb strings.Builder
+
+	for _, n := range strings.Split(name, "_") {
+		if r, ok := glyphRune(n); ok {
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// baseEncoding returns the predefined simple font encoding for name.
+func baseEncoding(name string) (simpleEncoding, bool) {
+	switch name {
+	case "StandardEncoding":
+		return standardEncoding, true
+	case "WinAnsiEncoding":
+		return winAnsiEncoding, true
+	case "MacRomanEncoding":
+		return macRomanEncoding, true
+	}
+	return simpleEncoding{}, false
+}
@@ -0,0 +1,440 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/fonts/metrics"
+	"github.com/pkg/errors"
+)
+
+// textFont decodes the character codes shown by text showing operators into unicode and glyph widths.
+type textFont struct {
+	name      string
+	composite bool
+
+	// Simple fonts.
+	encoding  simpleEncoding
+	firstChar int
+	widths    []float64
+
+	// Composite fonts.
+	cMap      *cMap
+	ucs2      bool            // Codes are UTF-16BE, see the predefined Uni*-UCS2-* and Uni*-UTF16-* CMaps.
+	cidWidths map[int]float64 // Widths by CID.
+
+	toUnicode    *cMap
+	defaultWidth float64 // MissingWidth for simple fonts, DW for composite fonts.
+
+	// glyph space to text space.
+	scale float64
+
+	// Extent above and below the baseline in glyph space.
+	ascent, descent float64
+}
+
+// defaultTextFont is used for unknown or corrupt fonts.
+var defaultTextFont = &textFont{encoding: standardEncoding, defaultWidth: 500, scale: .001, ascent: 800, descent: -200}
+
+func (xRefTable *XRefTable) numberArray(o Object) ([]float64, error) {
+
+	a, err := xRefTable.DereferenceArray(o)
+	if err != nil || a == nil {
+		return nil, err
+	}
+
+	f := make([]float64, len(a))
+	for i, o := range a {
+		if f[i], err = xRefTable.DereferenceNumber(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (xRefTable *XRefTable) dereferenceNumberEntry(d Dict, key string) (float64, bool) {
+
+	o, found := d.Find(key)
+	if !found {
+		return 0, false
+	}
+
+	f, err := xRefTable.DereferenceNumber(o)
+	if err != nil {
+		return 0, false
+	}
+
+	return f, true
+}
+
+func (xRefTable *XRefTable) cMapForStream(o Object) (*cMap, error) {
+
+	sd, err := xRefTable.DereferenceStreamDict(o)
+	if err != nil || sd == nil {
+		return nil, err
+	}
+
+	if err = decodeStream(sd); err != nil {
+		return nil, err
+	}
+
+	return parseCMap(sd.Content)
+}
+
+// setMetrics sets ascent and descent from a font descriptor.
+func (f *textFont) setMetrics(xRefTable *XRefTable, fd Dict) error {
+
+	f.ascent, f.descent = 800, -200
+
+	if fd == nil {
+		return nil
+	}
+
+	ascent, ok1 := xRefTable.dereferenceNumberEntry(fd, "Ascent")
+	descent, ok2 := xRefTable.dereferenceNumberEntry(fd, "Descent")
+
+	if !ok1 || !ok2 || ascent == descent {
+		bbox, err := xRefTable.numberArray(fd["FontBBox"])
+		if err != nil {
+			return err
+		}
+		if len(bbox) != 4 || bbox[1] == bbox[3] {
+			return nil
+		}
+		descent, ascent = bbox[1], bbox[3]
+	}
+
+	if descent > 0 {
+		descent = -descent
+	}
+
+	f.ascent, f.descent = ascent, descent
+
+	return nil
+}
+
+func (f *textFont) setSimpleEncoding(xRefTable *XRefTable, d Dict, subType string) error {
+
+	f.encoding = standardEncoding
+	if subType == "TrueType" {
+		f.encoding = winAnsiEncoding
+	}
+
+	o, err := xRefTable.Dereference(d["Encoding"])
+	if err != nil || o == nil {
+		return err
+	}
+
+	if n, ok := o.(Name); ok {
+		if enc, ok := baseEncoding(n.Value()); ok {
+			f.encoding = enc
+		}
+		return nil
+	}
+
+	encDict, ok := o.(Dict)
+	if !ok {
+		return errors.New("pdfcpu: textFont: corrupt encoding")
+	}
+
+	if n := encDict.NameEntry("BaseEncoding"); n != nil {
+		if enc, ok := baseEncoding(*n); ok {
+			f.encoding = enc
+		}
+	}
+
+	diffs, err := xRefTable.DereferenceArray(encDict["Differences"])
+	if err != nil {
+		return err
+	}
+
+	code := 0
+	for _, o := range diffs {
+		switch o := o.(type) {
+		case Integer:
+			code = o.Value()
+		case Name:
+			if code >= 0 && code < 256 {
+				f.encoding[code] = glyphText(o.Value())
+			}
+			code++
+		}
+	}
+
+	return nil
+}
+
+func (f *textFont) setSimpleWidths(xRefTable *XRefTable, d, fd Dict) error {
+
+	f.defaultWidth = 500
+	if w, ok := xRefTable.dereferenceNumberEntry(fd, "MissingWidth"); ok {
+		f.defaultWidth = w
+	}
+
+	if fc, ok := xRefTable.dereferenceNumberEntry(d, "FirstChar"); ok {
+		f.firstChar = int(fc)
+	}
+
+	widths, err := xRefTable.numberArray(d["Widths"])
+	if err != nil {
+		return err
+	}
+
+	if widths == nil && f.name != "" && MemberOf(f.name, metrics.FontNames()) {
+		// Widths are optional for the standard 14 fonts.
+		widths = make([]float64, 256)
+		for c := range widths {
+			widths[c] = float64(metrics.CharWidth(f.name, c))
+		}
+		f.firstChar = 0
+	}
+
+	f.widths = widths
+
+	return nil
+}
+
+func (f *textFont) setCompositeEncoding(xRefTable *XRefTable, d Dict) error {
+
+	f.cMap = identityCMap
+
+	o, err := xRefTable.Dereference(d["Encoding"])
+	if err != nil || o == nil {
+		return err
+	}
+
+	switch o := o.(type) {
+
+	case Name:
+		s := o.Value()
+		if strings.HasPrefix(s, "Uni") && (strings.Contains(s, "UCS2") || strings.Contains(s, "UTF16")) {
+			f.ucs2 = true
+		} else if !strings.HasPrefix(s, "Identity-") {
+			log.Info.Printf("textFont: unsupported CMap %s, using Identity-H\n", s)
+		}
+
+	case StreamDict:
+		m, err := xRefTable.cMapForStream(o)
+		if err != nil {
+			return err
+		}
+		if len(m.codespace) > 0 {
+			f.cMap = m
+		}
+	}
+
+	return nil
+}
+
+// setCIDWidths sets the glyph widths of a CIDFont, see 9.7.4.3.
+func (f *textFont) setCIDWidths(xRefTable *XRefTable, df Dict) error {
+
+	f.defaultWidth = 1000
+	if dw, ok := xRefTable.dereferenceNumberEntry(df, "DW"); ok {
+		f.defaultWidth = dw
+	}
+
+	f.cidWidths = map[int]float64{}
+
+	a, err := xRefTable.DereferenceArray(df["W"])
+	if err != nil || a == nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(a); {
+
+		first, err := xRefTable.DereferenceNumber(a[i])
+		if err != nil {
+			return err
+		}
+
+		o, err := xRefTable.Dereference(a[i+1])
+		if err != nil {
+			return err
+		}
+
+		if ws, ok := o.(Array); ok {
+			w, err := xRefTable.numberArray(ws)
+			if err != nil {
+				return err
+			}
+			for j, w := range w {
+				f.cidWidths[int(first)+j] = w
+			}
+			i += 2
+			continue
+		}
+
+		if i+2 >= len(a) {
+			break
+		}
+
+		last, err := xRefTable.DereferenceNumber(a[i+1])
+		if err != nil {
+			return err
+		}
+		w, err := xRefTable.DereferenceNumber(a[i+2])
+		if err != nil {
+			return err
+		}
+		for cid := int(first); cid <= int(last) && cid-int(first) < 0x10000; cid++ {
+			f.cidWidths[cid] = w
+		}
+		i += 3
+	}
+
+	return nil
+}
+
+func (xRefTable *XRefTable) newTextFont(d Dict) (*textFont, error) {
+
+	f := &textFont{scale: .001}
+
+	if n := d.NameEntry("BaseFont"); n != nil {
+		f.name = *n
+	}
+
+	subType := ""
+	if st := d.Subtype(); st != nil {
+		subType = *st
+	}
+
+	if o, found := d.Find("ToUnicode"); found {
+		m, err := xRefTable.cMapForStream(o)
+		if err != nil {
+			log.Info.Printf("textFont %s: ignoring ToUnicode: %v\n", f.name, err)
+		}
+		f.toUnicode = m
+	}
+
+	if subType == "Type0" {
+
+		f.composite = true
+
+		if err := f.setCompositeEncoding(xRefTable, d); err != nil {
+			return nil, err
+		}
+
+		a, err := xRefTable.DereferenceArray(d["DescendantFonts"])
+		if err != nil {
+			return nil, err
+		}
+		if len(a) != 1 {
+			return nil, errors.Errorf("pdfcpu: textFont %s: missing descendant font", f.name)
+		}
+
+		df, err := xRefTable.DereferenceDict(a[0])
+		if err != nil || df == nil {
+			return nil, errors.Errorf("pdfcpu: textFont %s: corrupt descendant font", f.name)
+		}
+
+		if err = f.setCIDWidths(xRefTable, df); err != nil {
+			return nil, err
+		}
+
+		fd, err := xRefTable.DereferenceDict(df["FontDescriptor"])
+		if err != nil {
+			return nil, err
+		}
+
+		return f, f.setMetrics(xRefTable, fd)
+	}
+
+	if err := f.setSimpleEncoding(xRefTable, d, subType); err != nil {
+		return nil, err
+	}
+
+	fd, err := xRefTable.DereferenceDict(d["FontDescriptor"])
+	if err != nil {
+		return nil, err
+	}
+
+	if err = f.setSimpleWidths(xRefTable, d, fd); err != nil {
+		return nil, err
+	}
+
+	if err = f.setMetrics(xRefTable, fd); err != nil {
+		return nil, err
+	}
+
+	if subType == "Type3" {
+		// Glyph space is defined by the font matrix, see 9.6.5.
+		m, err := xRefTable.numberArray(d["FontMatrix"])
+		if err != nil {
+			return nil, err
+		}
+		if len(m) == 6 && m[0] != 0 {
+			f.scale = m[0]
+		}
+		if bbox, err := xRefTable.numberArray(d["FontBBox"]); err == nil && len(bbox) == 4 && bbox[1] != bbox[3] {
+			f.descent, f.ascent = bbox[1], bbox[3]
+		}
+	}
+
+	return f, nil
+}
+
+// codeLength returns the length of the character code at the start of b.
+func (f *textFont) codeLength(b []byte) int {
+	if !f.composite {
+		return 1
+	}
+	return f.cMap.codeLength(b)
+}
+
+// text returns the unicode text for a character code.
+func (f *textFont) text(code []byte) string {
+
+	if f.toUnicode != nil {
+		if s, ok := f.toUnicode.text(code); ok {
+			return s
+		}
+	}
+
+	if !f.composite {
+		return f.encoding[code[0]]
+	}
+
+	if f.ucs2 {
+		return utf16BEText(code)
+	}
+
+	return "�"
+}
+
+// width returns the horizontal displacement of the glyph for a character code in text space for a font size of 1.
+func (f *textFont) width(code []byte) float64 {
+
+	w := f.defaultWidth
+
+	if f.composite {
+		cid, ok := f.cMap.cid(code)
+		if !ok {
+			cid = int(codeValue(code))
+		}
+		if cw, ok := f.cidWidths[cid]; ok {
+			w = cw
+		}
+	} else if i := int(code[0]) - f.firstChar; i >= 0 && i < len(f.widths) {
+		w = f.widths[i]
+	}
+
+	return w * f.scale
+}
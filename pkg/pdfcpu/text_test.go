@@ -0,0 +1,229 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testToUnicodeCMap = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CMapName /Adobe-Identity-UCS def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0003> <0020>
+<0010> <FB01>
+endbfchar
+2 beginbfrange
+<0024> <0026> <0041>
+<0030> <0031> [<0078> <00660069>]
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+func TestParseCMap(t *testing.T) {
+
+	m, err := parseCMap([]byte(testToUnicodeCMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := m.codeLength([]byte{0x00, 0x24, 0x00}); n != 2 {
+		t.Errorf("codeLength: want 2, got %d", n)
+	}
+
+	for _, tt := range []struct {
+		code []byte
+		want string
+	}{
+		{[]byte{0x00, 0x03}, " "},
+		{[]byte{0x00, 0x10}, "ﬁ"},
+		{[]byte{0x00, 0x24}, "A"},
+		{[]byte{0x00, 0x26}, "C"},
+		{[]byte{0x00, 0x30}, "x"},
+		{[]byte{0x00, 0x31}, "fi"},
+	} {
+		s, ok := m.text(tt.code)
+		if !ok || s != tt.want {
+			t.Errorf("text(%X): want %q, got %q %t", tt.code, tt.want, s, ok)
+		}
+	}
+
+	if _, ok := m.text([]byte{0x00, 0x27}); ok {
+		t.Errorf("text(0027): unexpected mapping")
+	}
+}
+
+func TestGlyphText(t *testing.T) {
+
+	for _, tt := range []struct{ name, want string }{
+		{"A", "A"},
+		{"quoteright", "’"},
+		{"fi", "ﬁ"},
+		{"f_f_i", "ffi"},
+		{"a.sc", "a"},
+		{"uni20AC", "€"},
+		{"u1F600", "😀"},
+		{"g123", ""},
+	} {
+		if got := glyphText(tt.name); got != tt.want {
+			t.Errorf("glyphText(%s): want %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestScanText(t *testing.T) {
+
+	toUnicode := StreamDict{Dict: NewDict(), Content: []byte(testToUnicodeCMap)}
+
+	fonts := Dict{
+		"F1": Dict{
+			"Type":     Name("Font"),
+			"Subtype":  Name("Type1"),
+			"BaseFont": Name("Helvetica"),
+			"Encoding": Dict{"Differences": Array{Integer(1), Name("fi")}},
+		},
+		"F2": Dict{
+			"Type":      Name("Font"),
+			"Subtype":   Name("Type0"),
+			"BaseFont":  Name("Embedded"),
+			"Encoding":  Name("Identity-H"),
+			"ToUnicode": toUnicode,
+			"DescendantFonts": Array{Dict{
+				"Type":    Name("Font"),
+				"Subtype": Name("CIDFontType2"),
+				"DW":      Integer(600),
+			}},
+		},
+	}
+
+	b := []byte(`BT /F1 10 Tf 100 700 Td (Hello) Tj [-300 (W) 20 (orld)] TJ 0 -20 Td (\001ne) Tj ET
+		q 2 0 0 2 0 0 cm BT /F2 12 Tf 50 100 Td <002400250026> Tj ET Q`)
+
+	s := newTextScanner(&XRefTable{})
+	s.ctm, s.ts = identMatrix, textState{hScale: 1}
+
+	if err := s.scan(b, Dict{"Font": fonts}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.runs) != 4 {
+		t.Fatalf("want 4 runs, got %d", len(s.runs))
+	}
+
+	want := "Hello World\nﬁne\nABC"
+	if got, _ := layoutText(s.runs); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	r := s.runs[0]
+	if r.Font != "Helvetica" || r.Size != 10 {
+		t.Errorf("run 0: want Helvetica 10, got %s %.2f", r.Font, r.Size)
+	}
+
+	// Helvetica: H=722 e=556 l=222 l=222 o=556, ascent/descent default to 800/-200.
+	bb := r.BBox
+	if math.Abs(bb.LL.X-100) > .01 || math.Abs(bb.UR.X-122.78) > .01 || math.Abs(bb.LL.Y-698) > .01 || math.Abs(bb.UR.Y-708) > .01 {
+		t.Errorf("run 0: unexpected bbox %v", bb)
+	}
+
+	// The CTM doubles font size and position.
+	r = s.runs[3]
+	if r.Size != 24 || math.Abs(r.BBox.LL.X-100) > .01 || math.Abs(r.BBox.UR.X-143.2) > .01 {
+		t.Errorf("run 3: unexpected size %.2f or bbox %v", r.Size, r.BBox)
+	}
+}
+
+func TestExtractPageText(t *testing.T) {
+
+	ctx, err := ReadFile(filepath.Join("..", "testdata", "go.pdf"), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp, err := ExtractPageText(ctx, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pp) != 2 || pp[0].Page != 1 || pp[1].Page != 2 {
+		t.Fatalf("unexpected pages: %v", pp)
+	}
+
+	if !strings.Contains(pp[0].Text, "Go Programming Language") {
+		t.Errorf("page 1: missing title in %q", pp[0].Text)
+	}
+
+	for _, p := range pp {
+		for _, r := range p.Runs {
+			if r.BBox == nil || r.BBox.Width() < 0 || r.BBox.Height() <= 0 {
+				t.Errorf("page %d: run %q: invalid bbox %v", p.Page, r.Text, r.BBox)
+			}
+		}
+	}
+}
+
+func TestSearchPageText(t *testing.T) {
+
+	ctx, err := ReadFile(filepath.Join("..", "testdata", "go.pdf"), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re := regexp.MustCompile(`(?i)programming\s+language`)
+
+	hits, err := SearchText(ctx, re, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 4 {
+		t.Fatalf("want 4 hits, got %d", len(hits))
+	}
+
+	h := hits[0]
+	if h.Page != 1 || h.Match != "Programming Language" || h.Snippet != "Google's Go Programming Language Yossi Gil" {
+		t.Errorf("unexpected hit: %+v", h)
+	}
+
+	if len(h.Rects) != 1 {
+		t.Fatalf("want 1 rect, got %d", len(h.Rects))
+	}
+
+	// The match covers part of the title run only.
+	pp, err := ExtractPageText(ctx, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range pp[0].Runs {
+		if !strings.Contains(r.Text, "Programming") {
+			continue
+		}
+		if !h.Rects[0].FitsWithin(r.BBox) || h.Rects[0].Width() >= r.BBox.Width() {
+			t.Errorf("rect %v not within run bbox %v", h.Rects[0], r.BBox)
+		}
+	}
+}
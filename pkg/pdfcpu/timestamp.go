@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+// Functions dealing with RFC 3161 timestamp authorities.
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	timestampQueryType = "application/timestamp-query"
+	timestampTimeout   = 30 * time.Second
+)
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status int
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// requestTimestamp returns a timestamp token for data issued by the timestamp authority at url.
+func requestTimestamp(url string, data []byte) ([]byte, error) {
+
+	log.Info.Printf("requesting timestamp from %s\n", url)
+
+	h := sha256.Sum256(data)
+
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: h[:],
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{Timeout: timestampTimeout}
+
+	resp, err := client.Post(url, timestampQueryType, bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: timestamp")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("pdfcpu: timestamp: %s: %s", url, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: timestamp")
+	}
+
+	var tsr timeStampResp
+	if _, err = asn1.Unmarshal(b, &tsr); err != nil {
+		return nil, errors.Wrap(err, "pdfcpu: timestamp: invalid response")
+	}
+
+	// 0 = granted, 1 = granted with modifications
+	if tsr.Status.Status > 1 || len(tsr.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.Errorf("pdfcpu: timestamp: request rejected with status %d", tsr.Status.Status)
+	}
+
+	token := tsr.TimeStampToken.FullBytes
+
+	if _, err = verifyTimestampToken(token, data); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pdfcpu/pdfcpu/pkg/types"
@@ -275,6 +276,51 @@ func DateString(t time.Time) string {
 		tz/60/60, tz/60%60)
 }
 
+// DateTime parses a PDF date string (7.9.4) like D:20190917143000+02'00'.
+func DateTime(s string) (time.Time, bool) {
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+
+	// Split off the time zone.
+	tz := ""
+	if i := strings.IndexAny(s, "Z+-"); i >= 0 {
+		s, tz = s[:i], s[i:]
+	}
+
+	if len(s) < 4 || len(s) > 14 || len(s)%2 > 0 {
+		return time.Time{}, false
+	}
+
+	// Fill in defaults for missing fields.
+	s += "0101000000"[len(s)-4:]
+
+	loc := time.UTC
+	if len(tz) >= 3 && tz[0] != 'Z' {
+		tz = strings.Replace(tz, "'", "", -1)
+		h, err1 := strconv.Atoi(tz[1:3])
+		m := 0
+		var err2 error
+		if len(tz) >= 5 {
+			m, err2 = strconv.Atoi(tz[3:5])
+		}
+		if err1 != nil || err2 != nil {
+			return time.Time{}, false
+		}
+		off := h*3600 + m*60
+		if tz[0] == '-' {
+			off = -off
+		}
+		loc = time.FixedZone("", off)
+	}
+
+	t, err := time.ParseInLocation("20060102150405", s, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
 ///////////////////////////////////////////////////////////////////////////////////
 
 // HexLiteral represents a PDF hex literal object.
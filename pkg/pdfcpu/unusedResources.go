@@ -0,0 +1,529 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/content"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+)
+
+// The resource categories subject to removal if unused.
+var prunableResourceCategories = []string{"Font", "XObject", "ExtGState", "ColorSpace", "Pattern", "Shading"}
+
+// Color space resources used implicitly by device color spaces, see 8.6.5.6.
+var defaultColorSpaces = []string{"DefaultGray", "DefaultRGB", "DefaultCMYK"}
+
+// Color space names referring to no color space resource.
+var deviceColorSpaces = []string{DeviceGrayCS, DeviceRGBCS, DeviceCMYKCS, PatternCS, "G", "RGB", "CMYK"}
+
+// resources represents a resource dict along with a key identifying it.
+//
+// Resource dicts and their category dicts may be shared by pages, form XObjects and other content.
+// An indirect dict is identified by its object number, a direct dict by the key of its holder and its entry name.
+type resources struct {
+	d   Dict
+	key string
+}
+
+func resourcesKey(o Object, holderKey string) string {
+	if ir, ok := o.(IndirectRef); ok {
+		return fmt.Sprintf("%d", ir.ObjectNumber.Value())
+	}
+	return holderKey
+}
+
+// resourceUsage collects the resources referenced by the content streams of a document.
+type resourceUsage struct {
+	xRefTable *XRefTable
+	dicts     map[string]Dict      // Resource category dicts by key.
+	cats      map[string]string    // Resource categories by key.
+	used      map[string]StringSet // Names in use by key.
+	keep      map[string]bool      // Category dicts to be left alone.
+	scanned   StringSet            // Content streams scanned by object number and resources key.
+}
+
+func newResourceUsage(xRefTable *XRefTable) *resourceUsage {
+	return &resourceUsage{
+		xRefTable: xRefTable,
+		dicts:     map[string]Dict{},
+		cats:      map[string]string{},
+		used:      map[string]StringSet{},
+		keep:      map[string]bool{},
+		scanned:   StringSet{},
+	}
+}
+
+// resources returns the resources held by a page, a form XObject or a Type3 font or parent if there are none.
+func (ru *resourceUsage) resources(d Dict, holderKey string, parent resources) (resources, error) {
+
+	o, found := d.Find("Resources")
+	if !found {
+		return parent, nil
+	}
+
+	rd, err := ru.xRefTable.DereferenceDict(o)
+	if err != nil || rd == nil {
+		return parent, err
+	}
+
+	return resources{d: rd, key: resourcesKey(o, holderKey+"/Resources")}, nil
+}
+
+// category returns the category dict cat of res along with its key.
+func (ru *resourceUsage) category(res resources, cat string) (Dict, string, error) {
+
+	if res.d == nil {
+		return nil, "", nil
+	}
+
+	o, found := res.d.Find(cat)
+	if !found {
+		return nil, "", nil
+	}
+
+	d, err := ru.xRefTable.DereferenceDict(o)
+	if err != nil || d == nil {
+		return nil, "", err
+	}
+
+	key := resourcesKey(o, res.key+"/"+cat)
+
+	if _, ok := ru.dicts[key]; !ok {
+		ru.dicts[key], ru.cats[key], ru.used[key] = d, cat, StringSet{}
+	}
+
+	return d, key, nil
+}
+
+// register records the category dicts of res as candidates for removing unused entries.
+func (ru *resourceUsage) register(res resources) error {
+
+	for _, cat := range prunableResourceCategories {
+		if _, _, err := ru.category(res, cat); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keepAll protects the category dicts of res, eg. if the content using them can't be analyzed.
+func (ru *resourceUsage) keepAll(res resources) error {
+
+	for _, cat := range prunableResourceCategories {
+		_, key, err := ru.category(res, cat)
+		if err != nil {
+			return err
+		}
+		if key != "" {
+			ru.keep[key] = true
+		}
+	}
+
+	return nil
+}
+
+// use records the use of a named resource and scans the content it refers to.
+func (ru *resourceUsage) use(res resources, cat, name string) error {
+
+	d, key, err := ru.category(res, cat)
+	if err != nil || d == nil {
+		return err
+	}
+
+	ru.used[key][name] = true
+
+	o, found := d.Find(name)
+	if !found {
+		return nil
+	}
+
+	switch cat {
+
+	case "Font":
+		return ru.useFont(o, res)
+
+	case "XObject", "Pattern":
+		// Form XObjects and tiling patterns are content streams.
+		return ru.scanForm(o, res)
+
+	case "ExtGState":
+		gs, err := ru.xRefTable.DereferenceDict(o)
+		if err != nil || gs == nil {
+			return err
+		}
+		// A soft mask is defined by a transparency group XObject.
+		sm, err := ru.xRefTable.DereferenceDict(gs["SMask"])
+		if err != nil || sm == nil {
+			// SMask may also be the name None.
+			return nil
+		}
+		return ru.scanForm(sm["G"], res)
+	}
+
+	return nil
+}
+
+// useFont scans the glyph descriptions of a Type3 font.
+func (ru *resourceUsage) useFont(o Object, parent resources) error {
+
+	fd, err := ru.xRefTable.DereferenceDict(o)
+	if err != nil || fd == nil || fd.Subtype() == nil || *fd.Subtype() != "Type3" {
+		return err
+	}
+
+	holderKey := resourcesKey(o, parent.key+"/Type3")
+
+	res, err := ru.resources(fd, holderKey, parent)
+	if err != nil {
+		return err
+	}
+
+	procs, err := ru.xRefTable.DereferenceDict(fd["CharProcs"])
+	if err != nil || procs == nil {
+		return err
+	}
+
+	for _, o := range procs {
+		if err = ru.scanStream(o, res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanForm scans a content stream holding its own resources like form XObjects and tiling patterns.
+func (ru *resourceUsage) scanForm(o Object, parent resources) error {
+
+	ir, ok := o.(IndirectRef)
+	if !ok {
+		return nil
+	}
+
+	o, err := ru.xRefTable.Dereference(ir)
+	if err != nil {
+		return err
+	}
+
+	// Shading patterns are dicts.
+	sd, ok := o.(StreamDict)
+	if !ok {
+		return nil
+	}
+
+	// Image XObjects have no content, tiling patterns have no subtype.
+	if st := sd.Subtype(); st != nil && *st != "Form" {
+		return nil
+	}
+
+	res, err := ru.resources(sd.Dict, fmt.Sprintf("%d", ir.ObjectNumber.Value()), parent)
+	if err != nil {
+		return err
+	}
+
+	return ru.scanStream(ir, res)
+}
+
+// scanStream scans a content stream using res.
+func (ru *resourceUsage) scanStream(o Object, res resources) error {
+
+	ir, ok := o.(IndirectRef)
+	if !ok {
+		return nil
+	}
+
+	k := fmt.Sprintf("%d %s", ir.ObjectNumber.Value(), res.key)
+	if ru.scanned[k] {
+		return nil
+	}
+	ru.scanned[k] = true
+
+	o, err := ru.xRefTable.Dereference(ir)
+	if err != nil {
+		return err
+	}
+
+	sd, ok := o.(StreamDict)
+	if !ok {
+		return nil
+	}
+
+	if err = decodeStream(&sd); err != nil {
+		log.Info.Printf("unused resources: keeping resources of undecodable obj#%d: %v\n", ir.ObjectNumber.Value(), err)
+		return ru.keepAll(res)
+	}
+
+	return ru.scanContent(sd.Content, res)
+}
+
+// nameOperand returns the name operand at index i.
+func nameOperand(op content.Operation, i int) (string, bool) {
+	if i < 0 || i >= len(op.Operands) {
+		return "", false
+	}
+	n, ok := op.Operands[i].(content.Name)
+	return string(n), ok
+}
+
+// scanContent records the resources referenced by the operators of a content stream.
+func (ru *resourceUsage) scanContent(b []byte, res resources) error {
+
+	if res.d == nil {
+		return nil
+	}
+
+	if err := ru.register(res); err != nil {
+		return err
+	}
+
+	ops, err := content.Parse(b)
+	if err != nil {
+		log.Info.Printf("unused resources: keeping resources of unparsable content: %v\n", err)
+		return ru.keepAll(res)
+	}
+
+	for _, op := range ops {
+
+		cat, i := "", 0
+
+		switch op.Operator {
+		case "Tf":
+			cat = "Font"
+		case "Do":
+			cat = "XObject"
+		case "gs":
+			cat = "ExtGState"
+		case "sh":
+			cat = "Shading"
+		case "cs", "CS":
+			cat = "ColorSpace"
+		case "scn", "SCN":
+			// A pattern name follows the color components if any.
+			cat, i = "Pattern", len(op.Operands)-1
+		case "BI":
+			if im := op.InlineImage(); im != nil {
+				if n, ok := im.Dict["CS"].(content.Name); ok {
+					op = content.Operation{Operands: []content.Operand{n}}
+					cat = "ColorSpace"
+				}
+			}
+		}
+
+		if cat == "" {
+			continue
+		}
+
+		n, ok := nameOperand(op, i)
+		if !ok || cat == "ColorSpace" && MemberOf(n, deviceColorSpaces) {
+			continue
+		}
+
+		if err = ru.use(res, cat, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanAnnotations scans the appearance streams of the annotations of a page.
+func (ru *resourceUsage) scanAnnotations(d Dict, res resources) error {
+
+	annots, err := ru.xRefTable.DereferenceArray(d["Annots"])
+	if err != nil {
+		return err
+	}
+
+	for _, o := range annots {
+
+		ad, err := ru.xRefTable.DereferenceDict(o)
+		if err != nil || ad == nil {
+			return err
+		}
+
+		ap, err := ru.xRefTable.DereferenceDict(ad["AP"])
+		if err != nil || ap == nil {
+			return err
+		}
+
+		for _, k := range []string{"N", "R", "D"} {
+
+			o, found := ap.Find(k)
+			if !found {
+				continue
+			}
+
+			// An appearance is either a stream or a dict of streams by appearance state.
+			if states, err := ru.xRefTable.DereferenceDict(o); err == nil && states != nil {
+				for _, o := range states {
+					if err = ru.scanForm(o, res); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			if err = ru.scanForm(o, res); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// scanPageTree scans the content of all pages of the page tree node ir.
+func (ru *resourceUsage) scanPageTree(ir IndirectRef, parent resources) error {
+
+	d, err := ru.xRefTable.DereferenceDict(ir)
+	if err != nil || d == nil {
+		return err
+	}
+
+	res, err := ru.resources(d, fmt.Sprintf("%d", ir.ObjectNumber.Value()), parent)
+	if err != nil {
+		return err
+	}
+
+	if t := d.Type(); t != nil && *t == "Pages" {
+		for _, o := range d.ArrayEntry("Kids") {
+			if ir, ok := o.(IndirectRef); ok {
+				if err = ru.scanPageTree(ir, res); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	b, err := ru.xRefTable.PageContent(d)
+	if err != nil {
+		log.Info.Printf("unused resources: keeping resources of page obj#%d: %v\n", ir.ObjectNumber.Value(), err)
+		if err = ru.keepAll(res); err != nil {
+			return err
+		}
+	} else if err = ru.scanContent(b, res); err != nil {
+		return err
+	}
+
+	return ru.scanAnnotations(d, res)
+}
+
+// markObjectGraph adds the objects reachable from o to objs.
+func markObjectGraph(xRefTable *XRefTable, o Object, objs IntSet) error {
+
+	switch o := o.(type) {
+
+	case IndirectRef:
+		objNr := o.ObjectNumber.Value()
+		if objs[objNr] {
+			return nil
+		}
+		objs[objNr] = true
+		o1, err := xRefTable.Dereference(o)
+		if err != nil {
+			return err
+		}
+		return markObjectGraph(xRefTable, o1, objs)
+
+	case Dict:
+		for _, v := range o {
+			if err := markObjectGraph(xRefTable, v, objs); err != nil {
+				return err
+			}
+		}
+
+	case StreamDict:
+		return markObjectGraph(xRefTable, o.Dict, objs)
+
+	case Array:
+		for _, v := range o {
+			if err := markObjectGraph(xRefTable, v, objs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeUnusedResources removes all Font, XObject, ExtGState, ColorSpace, Pattern and Shading resources
+// not referenced by the content of any page, annotation appearance, form XObject, tiling pattern or Type3 font.
+// The objects of removed resources get recorded in ctx.Optimize.UnusedResourceObjs and are dropped on writing unless still in use.
+func removeUnusedResources(ctx *Context) error {
+
+	log.Optimize.Println("removeUnusedResources begin")
+
+	ru := newResourceUsage(ctx.XRefTable)
+
+	root, err := ctx.Pages()
+	if err != nil {
+		return err
+	}
+
+	if err = ru.scanPageTree(*root, resources{}); err != nil {
+		return err
+	}
+
+	// Default resources for form fields may share category dicts with pages.
+	if af, err := ctx.DereferenceDict(ctx.RootDict["AcroForm"]); err == nil && af != nil {
+		o, found := af.Find("DR")
+		if dr, err := ctx.DereferenceDict(o); found && err == nil && dr != nil {
+			if err = ru.keepAll(resources{d: dr, key: resourcesKey(o, "AcroForm/DR")}); err != nil {
+				return err
+			}
+		}
+	}
+
+	var keys []string
+	for key := range ru.dicts {
+		if !ru.keep[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+
+		d, cat := ru.dicts[key], ru.cats[key]
+
+		for name, o := range d {
+
+			if ru.used[key][name] || cat == "ColorSpace" && MemberOf(name, defaultColorSpaces) {
+				continue
+			}
+
+			log.Optimize.Printf("removeUnusedResources: removing %s %s from %s\n", cat, name, key)
+
+			d.Delete(name)
+			ctx.Optimize.UnusedResources++
+
+			if err = markObjectGraph(ctx.XRefTable, o, ctx.Optimize.UnusedResourceObjs); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Info.Printf("removed %d unused resources\n", ctx.Optimize.UnusedResources)
+	log.Optimize.Println("removeUnusedResources end")
+
+	return nil
+}
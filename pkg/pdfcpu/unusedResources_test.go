@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"testing"
+)
+
+func createTestStream(xRefTable *XRefTable, d Dict, b string) (*IndirectRef, error) {
+
+	sd := &StreamDict{Dict: d, Content: []byte(b)}
+
+	if err := encodeStream(sd); err != nil {
+		return nil, err
+	}
+
+	return xRefTable.IndRefForNewObject(*sd)
+}
+
+func TestRemoveUnusedResources(t *testing.T) {
+
+	xRefTable, err := createXRefTableWithRootDict()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fonts := Dict{}
+	for _, k := range []string{"F1", "F2", "F3"} {
+		ir, err := createFontDict(xRefTable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fonts[k] = *ir
+	}
+
+	// A form using F2 of the page resources.
+	fm1, err := createTestStream(xRefTable, Dict{"Type": Name("XObject"), "Subtype": Name("Form")}, "BT /F2 8 Tf (a) Tj ET")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unused form using F3.
+	fm2, err := createTestStream(xRefTable, Dict{"Type": Name("XObject"), "Subtype": Name("Form")}, "BT /F3 8 Tf (b) Tj ET")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Image samples are no content.
+	im1, err := createTestStream(xRefTable, Dict{"Type": Name("XObject"), "Subtype": Name("Image")}, "{{{")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resDict := Dict{
+		"Font":       fonts,
+		"XObject":    Dict{"Fm1": *fm1, "Fm2": *fm2, "Im1": *im1},
+		"ExtGState":  Dict{"GS0": Dict{"CA": Float(.5)}},
+		"ColorSpace": Dict{"CS0": Name("DeviceRGB"), "CS1": Name("DeviceGray"), "DefaultRGB": Name("DeviceRGB")},
+	}
+
+	contents, err := createTestStream(xRefTable, Dict{}, "q /CS0 cs 1 0 0 sc BT /F1 12 Tf (c) Tj ET /Fm1 Do Q")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pagesDict := Dict{"Type": Name("Pages"), "Count": Integer(1)}
+	pagesIndRef, err := xRefTable.IndRefForNewObject(pagesDict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pageIndRef, err := xRefTable.IndRefForNewObject(Dict{
+		"Type":      Name("Page"),
+		"Parent":    *pagesIndRef,
+		"MediaBox":  RectForFormat("A4").Array(),
+		"Resources": resDict,
+		"Contents":  *contents,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pagesDict.Insert("Kids", Array{*pageIndRef})
+
+	rootDict, err := xRefTable.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootDict.Insert("Pages", *pagesIndRef)
+
+	f3 := fonts["F3"].(IndirectRef)
+
+	ctx := &Context{XRefTable: xRefTable, Optimize: newOptimizationContext()}
+
+	if err = removeUnusedResources(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		cat, name string
+		used      bool
+	}{
+		{"Font", "F1", true},
+		{"Font", "F2", true},
+		{"Font", "F3", false},
+		{"XObject", "Fm1", true},
+		{"XObject", "Fm2", false},
+		{"XObject", "Im1", false},
+		{"ExtGState", "GS0", false},
+		{"ColorSpace", "CS0", true},
+		{"ColorSpace", "CS1", false},
+		{"ColorSpace", "DefaultRGB", true},
+	} {
+		if _, found := resDict[tt.cat].(Dict).Find(tt.name); found != tt.used {
+			t.Errorf("%s %s: want kept=%t", tt.cat, tt.name, tt.used)
+		}
+	}
+
+	if ctx.Optimize.UnusedResources != 5 {
+		t.Errorf("want 5 removed resources, got %d", ctx.Optimize.UnusedResources)
+	}
+
+	// The objects of removed resources are up for removal.
+	for _, ir := range []IndirectRef{*fm2, f3, *im1} {
+		if !ctx.Optimize.IsUnusedResourceObject(ir.ObjectNumber.Value()) {
+			t.Errorf("obj#%d: want unused", ir.ObjectNumber.Value())
+		}
+	}
+}
@@ -141,6 +141,18 @@ func DecodeUTF16String(s string) (string, error) {
 	return decodeUTF16String([]byte(s))
 }
 
+// EncodeUTF16String encodes s as UTF16BE including the byte order mark.
+func EncodeUTF16String(s string) string {
+
+	b := []byte{0xFE, 0xFF}
+
+	for _, v := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(v>>8), byte(v))
+	}
+
+	return string(b)
+}
+
 // StringLiteralToString returns the best possible string rep for a string literal.
 func StringLiteralToString(s string) (string, error) {
 
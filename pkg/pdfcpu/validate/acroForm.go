@@ -366,7 +366,12 @@ func validateAcroFormXFA(xRefTable *pdf.XRefTable, d pdf.Dict, sinceVersion pdf.
 		return errors.New("pdfcpu: validateAcroFormXFA: needs to be streamDict or array")
 	}
 
-	return xRefTable.ValidateVersion("AcroFormXFA", sinceVersion)
+	if err := xRefTable.ValidateVersion("AcroFormXFA", sinceVersion); err != nil {
+		return err
+	}
+
+	// XFA forms are deprecated since V2.0
+	return validateDeprecated(xRefTable, "AcroFormXFA", pdf.V20)
 }
 
 func validateQ(i int) bool { return i >= 0 && i <= 2 }
@@ -156,20 +156,28 @@ func validateLaunchActionDict(xRefTable *pdf.XRefTable, d pdf.Dict, dictName str
 		return err
 	}
 
-	// Win, optional, dict
+	// Win, optional, dict, deprecated since V2.0
 	d1, err := validateDictEntry(xRefTable, d, dictName, "Win", OPTIONAL, pdf.V10, nil)
 	if err != nil {
 		return err
 	}
 	if d1 != nil {
-		err = validateWinDict(xRefTable, d1)
+		if err = validateWinDict(xRefTable, d1); err != nil {
+			return err
+		}
 	}
 
-	// Mac, optional, undefined dict
+	// Mac, optional, undefined dict, deprecated since V2.0
 
-	// Unix, optional, undefined dict
+	// Unix, optional, undefined dict, deprecated since V2.0
 
-	return err
+	for _, k := range []string{"Win", "Mac", "Unix"} {
+		if err = validateDeprecatedEntry(xRefTable, d, dictName, k, pdf.V20); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func validateDestinationThreadEntry(xRefTable *pdf.XRefTable, d pdf.Dict, dictName, entryName string, required bool, sinceVersion pdf.Version) error {
@@ -767,30 +775,98 @@ func validateGoTo3DViewActionDict(xRefTable *pdf.XRefTable, d pdf.Dict, dictName
 	return err
 }
 
+func validateGoToDpActionDict(xRefTable *pdf.XRefTable, d pdf.Dict, dictName string) error {
+
+	// see 12.6.4.6
+
+	// Dp, required, indirect reference to a document part dict
+	ir, err := validateIndRefEntry(xRefTable, d, dictName, "Dp", REQUIRED, pdf.V20)
+	if err != nil {
+		return err
+	}
+
+	d1, err := xRefTable.DereferenceDict(*ir)
+	if err != nil {
+		return err
+	}
+
+	if d1 == nil {
+		return errors.Errorf("pdfcpu: validateGoToDpActionDict: entry \"Dp\" (obj#%d) is nil", ir.ObjectNumber)
+	}
+
+	_, err = validateNameEntry(xRefTable, d1, "DPartDict", "Type", OPTIONAL, pdf.V20, func(s string) bool { return s == "DPart" })
+
+	return err
+}
+
+func validateRichMediaExecuteActionDict(xRefTable *pdf.XRefTable, d pdf.Dict, dictName string) error {
+
+	// see 13.7.3
+
+	// TA, required, indirect reference to a RichMedia annotation dict
+	_, err := validateIndRefEntry(xRefTable, d, dictName, "TA", REQUIRED, pdf.V20)
+	if err != nil {
+		return err
+	}
+
+	// TI, optional, indirect reference to a RichMediaInstance dict
+	_, err = validateIndRefEntry(xRefTable, d, dictName, "TI", OPTIONAL, pdf.V20)
+	if err != nil {
+		return err
+	}
+
+	// CMD, required, RichMediaCommand dict
+	d1, err := validateDictEntry(xRefTable, d, dictName, "CMD", REQUIRED, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+
+	dictName = "richMediaCommandDict"
+
+	// Type, optional, name
+	_, err = validateNameEntry(xRefTable, d1, dictName, "Type", OPTIONAL, pdf.V20, func(s string) bool { return s == "RichMediaCommand" })
+	if err != nil {
+		return err
+	}
+
+	// C, required, text string
+	_, err = validateStringEntry(xRefTable, d1, dictName, "C", REQUIRED, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+
+	// A, optional, various
+	_, err = validateEntry(xRefTable, d1, dictName, "A", OPTIONAL, pdf.V20)
+
+	return err
+}
+
 func validateActionDictCore(xRefTable *pdf.XRefTable, n *pdf.Name, d pdf.Dict) error {
 
 	for k, v := range map[string]struct {
 		validate     func(xRefTable *pdf.XRefTable, d pdf.Dict, dictName string) error
 		sinceVersion pdf.Version
 	}{
-		"GoTo":        {validateGoToActionDict, pdf.V10},
-		"GoToR":       {validateGoToRActionDict, pdf.V10},
-		"GoToE":       {validateGoToEActionDict, pdf.V16},
-		"Launch":      {validateLaunchActionDict, pdf.V10},
-		"Thread":      {validateThreadActionDict, pdf.V10},
-		"URI":         {validateURIActionDict, pdf.V10},
-		"Sound":       {validateSoundActionDict, pdf.V12},
-		"Movie":       {validateMovieActionDict, pdf.V12},
-		"Hide":        {validateHideActionDict, pdf.V12},
-		"Named":       {validateNamedActionDict, pdf.V12},
-		"SubmitForm":  {validateSubmitFormActionDict, pdf.V10},
-		"ResetForm":   {validateResetFormActionDict, pdf.V12},
-		"ImportData":  {validateImportDataActionDict, pdf.V12},
-		"JavaScript":  {validateJavaScriptActionDict, pdf.V13},
-		"SetOCGState": {validateSetOCGStateActionDict, pdf.V15},
-		"Rendition":   {validateRenditionActionDict, pdf.V15},
-		"Trans":       {validateTransActionDict, pdf.V15},
-		"GoTo3DView":  {validateGoTo3DViewActionDict, pdf.V16},
+		"GoTo":             {validateGoToActionDict, pdf.V10},
+		"GoToR":            {validateGoToRActionDict, pdf.V10},
+		"GoToE":            {validateGoToEActionDict, pdf.V16},
+		"Launch":           {validateLaunchActionDict, pdf.V10},
+		"Thread":           {validateThreadActionDict, pdf.V10},
+		"URI":              {validateURIActionDict, pdf.V10},
+		"Sound":            {validateSoundActionDict, pdf.V12},
+		"Movie":            {validateMovieActionDict, pdf.V12},
+		"Hide":             {validateHideActionDict, pdf.V12},
+		"Named":            {validateNamedActionDict, pdf.V12},
+		"SubmitForm":       {validateSubmitFormActionDict, pdf.V10},
+		"ResetForm":        {validateResetFormActionDict, pdf.V12},
+		"ImportData":       {validateImportDataActionDict, pdf.V12},
+		"JavaScript":       {validateJavaScriptActionDict, pdf.V13},
+		"SetOCGState":      {validateSetOCGStateActionDict, pdf.V15},
+		"Rendition":        {validateRenditionActionDict, pdf.V15},
+		"Trans":            {validateTransActionDict, pdf.V15},
+		"GoTo3DView":       {validateGoTo3DViewActionDict, pdf.V16},
+		"GoToDp":           {validateGoToDpActionDict, pdf.V20},
+		"RichMediaExecute": {validateRichMediaExecuteActionDict, pdf.V20},
 	} {
 		if n.Value() == k {
 
@@ -799,6 +875,13 @@ func validateActionDictCore(xRefTable *pdf.XRefTable, n *pdf.Name, d pdf.Dict) e
 				return err
 			}
 
+			// Movie and sound actions are deprecated since V2.0
+			if k == "Movie" || k == "Sound" {
+				if err = validateDeprecated(xRefTable, k, pdf.V20); err != nil {
+					return err
+				}
+			}
+
 			return v.validate(xRefTable, d, k)
 		}
 	}
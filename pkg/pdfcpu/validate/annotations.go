@@ -587,7 +587,7 @@ func validateEntryIT(xRefTable *pdf.XRefTable, d pdf.Dict, dictName string, requ
 			return s == "PolygonCloud"
 		}
 
-		if xRefTable.Version() == pdf.V17 {
+		if xRefTable.Version() >= pdf.V17 {
 			if pdf.MemberOf(s, []string{"PolygonCloud", "PolyLineDimension", "PolygonDimension"}) {
 				return true
 			}
@@ -1157,6 +1157,180 @@ func validateAnnotationDictRedact(xRefTable *pdf.XRefTable, d pdf.Dict, dictName
 	return err
 }
 
+func validateAnnotationDictProjection(xRefTable *pdf.XRefTable, d pdf.Dict, dictName string) error {
+
+	// see 12.5.6.24
+
+	// A projection annotation is a markup annotation without additional entries.
+	// ExData, optional, dict, since V2.0 may hold a 3D measurement (3DM) or a geospatial (MarkupGeo) external data dict.
+
+	return nil
+}
+
+func validateRichMediaInstanceDict(xRefTable *pdf.XRefTable, d pdf.Dict) error {
+
+	dictName := "richMediaInstanceDict"
+
+	// Type, optional, name
+	_, err := validateNameEntry(xRefTable, d, dictName, "Type", OPTIONAL, pdf.V20, func(s string) bool { return s == "RichMediaInstance" })
+	if err != nil {
+		return err
+	}
+
+	// Subtype, optional, name
+	_, err = validateNameEntry(xRefTable, d, dictName, "Subtype", OPTIONAL, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+
+	// Asset, optional, file specification
+	_, err = validateFileSpecEntry(xRefTable, d, dictName, "Asset", OPTIONAL, pdf.V20)
+
+	return err
+}
+
+func validateRichMediaConfigurationDict(xRefTable *pdf.XRefTable, d pdf.Dict) error {
+
+	dictName := "richMediaConfigurationDict"
+
+	// Type, optional, name
+	_, err := validateNameEntry(xRefTable, d, dictName, "Type", OPTIONAL, pdf.V20, func(s string) bool { return s == "RichMediaConfiguration" })
+	if err != nil {
+		return err
+	}
+
+	// Subtype, optional, name
+	_, err = validateNameEntry(xRefTable, d, dictName, "Subtype", OPTIONAL, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+
+	// Name, optional, text string
+	_, err = validateStringEntry(xRefTable, d, dictName, "Name", OPTIONAL, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+
+	// Instances, optional, array of RichMediaInstance dicts
+	a, err := validateArrayEntry(xRefTable, d, dictName, "Instances", OPTIONAL, pdf.V20, nil)
+	if err != nil || a == nil {
+		return err
+	}
+
+	for _, o := range a {
+
+		d1, err := xRefTable.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+
+		if d1 == nil {
+			continue
+		}
+
+		err = validateRichMediaInstanceDict(xRefTable, d1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateRichMediaContentDict(xRefTable *pdf.XRefTable, d pdf.Dict) error {
+
+	dictName := "richMediaContentDict"
+
+	// Type, optional, name
+	_, err := validateNameEntry(xRefTable, d, dictName, "Type", OPTIONAL, pdf.V20, func(s string) bool { return s == "RichMediaContent" })
+	if err != nil {
+		return err
+	}
+
+	// Assets, optional, name tree of embedded file specifications
+	d1, err := validateDictEntry(xRefTable, d, dictName, "Assets", OPTIONAL, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+	if d1 != nil {
+		_, _, _, err = validateNameTree(xRefTable, "EmbeddedFiles", d1, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Configurations, optional, array of RichMediaConfiguration dicts
+	a, err := validateArrayEntry(xRefTable, d, dictName, "Configurations", OPTIONAL, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range a {
+
+		d1, err := xRefTable.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+
+		if d1 == nil {
+			continue
+		}
+
+		err = validateRichMediaConfigurationDict(xRefTable, d1)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Views, optional, array of 3D view dicts
+	_, err = validateArrayEntry(xRefTable, d, dictName, "Views", OPTIONAL, pdf.V20, nil)
+
+	return err
+}
+
+func validateAnnotationDictRichMedia(xRefTable *pdf.XRefTable, d pdf.Dict, dictName string) error {
+
+	// see 13.7.2
+
+	// RichMediaContent, required, dict
+	d1, err := validateDictEntry(xRefTable, d, dictName, "RichMediaContent", REQUIRED, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+
+	err = validateRichMediaContentDict(xRefTable, d1)
+	if err != nil {
+		return err
+	}
+
+	// RichMediaSettings, optional, dict
+	validateSettings := func(d pdf.Dict) bool {
+
+		dictName := "richMediaSettingsDict"
+
+		// Type, optional, name
+		_, err := validateNameEntry(xRefTable, d, dictName, "Type", OPTIONAL, pdf.V20, func(s string) bool { return s == "RichMediaSettings" })
+		if err != nil {
+			return false
+		}
+
+		// Activation, optional, dict
+		_, err = validateDictEntry(xRefTable, d, dictName, "Activation", OPTIONAL, pdf.V20, nil)
+		if err != nil {
+			return false
+		}
+
+		// Deactivation, optional, dict
+		_, err = validateDictEntry(xRefTable, d, dictName, "Deactivation", OPTIONAL, pdf.V20, nil)
+
+		return err == nil
+	}
+
+	_, err = validateDictEntry(xRefTable, d, dictName, "RichMediaSettings", OPTIONAL, pdf.V20, validateSettings)
+
+	return err
+}
+
 func validateExDataDict(xRefTable *pdf.XRefTable, d pdf.Dict) error {
 
 	dictName := "ExData"
@@ -1166,7 +1340,15 @@ func validateExDataDict(xRefTable *pdf.XRefTable, d pdf.Dict) error {
 		return err
 	}
 
-	_, err = validateNameEntry(xRefTable, d, dictName, "Subtype", REQUIRED, pdf.V10, func(s string) bool { return s == "Markup3D" })
+	// Subtype, required, name
+	validateSubtype := func(s string) bool {
+		if s == "Markup3D" {
+			return true
+		}
+		return xRefTable.Version() >= pdf.V20 && pdf.MemberOf(s, []string{"3DM", "MarkupGeo"})
+	}
+
+	_, err = validateNameEntry(xRefTable, d, dictName, "Subtype", REQUIRED, pdf.V10, validateSubtype)
 
 	return err
 }
@@ -1460,6 +1642,8 @@ func validateAnnotationDictConcrete(xRefTable *pdf.XRefTable, d pdf.Dict, dictNa
 		"Watermark":      {validateAnnotationDictWatermark, pdf.V16, false},
 		"3D":             {validateAnnotationDict3D, pdf.V16, false},
 		"Redact":         {validateAnnotationDictRedact, pdf.V17, true},
+		"Projection":     {validateAnnotationDictProjection, pdf.V20, true},
+		"RichMedia":      {validateAnnotationDictRichMedia, pdf.V20, false},
 	} {
 		if subtype.Value() == k {
 
@@ -1468,6 +1652,13 @@ func validateAnnotationDictConcrete(xRefTable *pdf.XRefTable, d pdf.Dict, dictNa
 				return err
 			}
 
+			// Movie and sound annotations are deprecated since V2.0
+			if k == "Movie" || k == "Sound" {
+				if err = validateDeprecated(xRefTable, k, pdf.V20); err != nil {
+					return err
+				}
+			}
+
 			if v.markup {
 				err := validateMarkupAnnotation(xRefTable, d)
 				if err != nil {
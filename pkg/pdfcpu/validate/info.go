@@ -75,6 +75,13 @@ func validateDocumentInfoDict(xRefTable *pdf.XRefTable, obj pdf.Object) (hasModD
 
 	for k, v := range d {
 
+		// PDF 2.0 deprecates all entries except CreationDate and ModDate.
+		if k != "CreationDate" && k != "ModDate" {
+			if err = validateDeprecated(xRefTable, "dict=infoDict entry="+k, pdf.V20); err != nil {
+				return false, err
+			}
+		}
+
 		switch k {
 
 		// text string, opt, since V1.1
@@ -64,6 +64,31 @@ func validateEntry(xRefTable *pdf.XRefTable, d pdf.Dict, dictName, entryName str
 	return o, nil
 }
 
+// validateDeprecated reports the usage of element if deprecated in the xRefTable's version.
+// Deprecated elements are an error in strict mode only.
+func validateDeprecated(xRefTable *pdf.XRefTable, element string, deprecatedSince pdf.Version) error {
+
+	if xRefTable.Version() < deprecatedSince {
+		return nil
+	}
+
+	if xRefTable.ValidationMode == pdf.ValidationRelaxed {
+		log.Validate.Printf("%s: deprecated since version %s\n", element, deprecatedSince)
+		return nil
+	}
+
+	return errors.Errorf("pdfcpu: %s: deprecated since version %s", element, deprecatedSince)
+}
+
+func validateDeprecatedEntry(xRefTable *pdf.XRefTable, d pdf.Dict, dictName, entryName string, deprecatedSince pdf.Version) error {
+
+	if _, found := d.Find(entryName); !found {
+		return nil
+	}
+
+	return validateDeprecated(xRefTable, fmt.Sprintf("dict=%s entry=%s", dictName, entryName), deprecatedSince)
+}
+
 func validateArrayEntry(xRefTable *pdf.XRefTable, d pdf.Dict, dictName, entryName string, required bool, sinceVersion pdf.Version, validate func(pdf.Array) bool) (pdf.Array, error) {
 
 	log.Validate.Printf("validateArrayEntry begin: entry=%s\n", entryName)
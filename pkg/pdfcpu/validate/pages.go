@@ -55,6 +55,12 @@ func validateResourceDict(xRefTable *pdf.XRefTable, o pdf.Object) (hasResources
 	//	return false, nil
 	//}
 
+	// Deprecated since V2.0
+	err = validateDeprecatedEntry(xRefTable, d, "resourceDict", "ProcSet", pdf.V20)
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -689,6 +695,13 @@ func validateViewportDict(xRefTable *pdf.XRefTable, d pdf.Dict, sinceVersion pdf
 	return err
 }
 
+func validatePageEntryOutputIntents(xRefTable *pdf.XRefTable, d pdf.Dict, required bool, sinceVersion pdf.Version) error {
+
+	// see 14.11.5
+
+	return validateOutputIntentsEntry(xRefTable, d, "pageDict", required, sinceVersion)
+}
+
 func validatePageEntryVP(xRefTable *pdf.XRefTable, d pdf.Dict, required bool, sinceVersion pdf.Version) error {
 
 	// see table 260
@@ -803,6 +816,7 @@ func validatePageDict(xRefTable *pdf.XRefTable, d pdf.Dict, objNumber, genNumber
 		{validatePageEntryPresSteps, OPTIONAL, pdf.V15},
 		{validatePageEntryUserUnit, OPTIONAL, pdf.V16},
 		{validatePageEntryVP, OPTIONAL, pdf.V16},
+		{validatePageEntryOutputIntents, OPTIONAL, pdf.V20},
 	} {
 		err = f.validate(xRefTable, d, f.required, f.sinceVersion)
 		if err != nil {
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validate
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	pdf "github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+func readAndValidate(t *testing.T, b []byte) *pdf.Context {
+	t.Helper()
+
+	ctx, err := pdf.Read(bytes.NewReader(b), pdf.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := ctx.Version(); v != pdf.V20 {
+		t.Fatalf("got version %s, want 2.0", v)
+	}
+
+	if err = XRefTable(ctx.XRefTable); err != nil {
+		t.Fatal(err)
+	}
+
+	return ctx
+}
+
+func TestPDF20(t *testing.T) {
+
+	for _, fn := range []string{"annotTest.pdf", "testImage.pdf"} {
+
+		b, err := ioutil.ReadFile(filepath.Join("..", "..", "testdata", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Pretend this is a PDF 2.0 file.
+		b = append([]byte("%PDF-2.0"), b[len("%PDF-1.7"):]...)
+
+		ctx := readAndValidate(t, b)
+
+		var buf bytes.Buffer
+		ctx.Write.Writer = bufio.NewWriter(&buf)
+
+		if err = pdf.Write(ctx); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-2.0")) {
+			t.Fatalf("%s: missing PDF 2.0 header", fn)
+		}
+
+		readAndValidate(t, buf.Bytes())
+	}
+}
+
+func TestDeprecatedEntry(t *testing.T) {
+
+	ctx, err := pdf.CreateContextWithXRefTable(pdf.NewDefaultConfiguration(), pdf.PaperSize["A4"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := pdf.Dict{"ProcSet": pdf.Array{pdf.Name("PDF"), pdf.Name("Text")}}
+
+	for _, tt := range []struct {
+		version pdf.Version
+		mode    int
+		fail    bool
+	}{
+		{pdf.V17, pdf.ValidationStrict, false},
+		{pdf.V20, pdf.ValidationRelaxed, false},
+		{pdf.V20, pdf.ValidationStrict, true},
+	} {
+		v := tt.version
+		ctx.RootVersion = &v
+		ctx.XRefTable.ValidationMode = tt.mode
+
+		err = validateDeprecatedEntry(ctx.XRefTable, d, "resourceDict", "ProcSet", pdf.V20)
+		if (err != nil) != tt.fail {
+			t.Errorf("version %s mode %d: unexpected result: %v", tt.version, tt.mode, err)
+		}
+	}
+}
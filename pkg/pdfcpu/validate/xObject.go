@@ -550,12 +550,17 @@ func validateImageStreamDict(xRefTable *pdf.XRefTable, sd *pdf.StreamDict, isAlt
 	}
 
 	// Name, name, required for V10
-	// Shall no longer be used.
+	// Shall no longer be used, deprecated since V2.0
 	_, err = validateNameEntry(xRefTable, sd.Dict, dictName, "Name", xRefTable.Version() == pdf.V10, pdf.V10, nil)
 	if err != nil {
 		return err
 	}
 
+	err = validateDeprecatedEntry(xRefTable, sd.Dict, dictName, "Name", pdf.V20)
+	if err != nil {
+		return err
+	}
+
 	// StructParent, integer, optional
 	_, err = validateIntegerEntry(xRefTable, sd.Dict, dictName, "StructParent", OPTIONAL, pdf.V13, nil)
 	if err != nil {
@@ -581,7 +586,30 @@ func validateImageStreamDict(xRefTable *pdf.XRefTable, sd *pdf.StreamDict, isAlt
 	}
 
 	// OC, dict, optional since V1.5
-	return validateEntryOC(xRefTable, sd.Dict, dictName, "OC", OPTIONAL, pdf.V15)
+	err = validateEntryOC(xRefTable, sd.Dict, dictName, "OC", OPTIONAL, pdf.V15)
+	if err != nil {
+		return err
+	}
+
+	return validateJBIG2DecodeParms(xRefTable, sd)
+}
+
+func validateJBIG2DecodeParms(xRefTable *pdf.XRefTable, sd *pdf.StreamDict) error {
+
+	for _, f := range sd.FilterPipeline {
+
+		if f.Name != filter.JBIG2 || f.DecodeParms == nil {
+			continue
+		}
+
+		// JBIG2Globals, stream, optional, since V1.4
+		_, err := validateStreamDictEntry(xRefTable, f.DecodeParms, "JBIG2DecodeParms", "JBIG2Globals", OPTIONAL, pdf.V14, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func validateFormStreamDictPart1(xRefTable *pdf.XRefTable, sd *pdf.StreamDict, dictName string) error {
@@ -710,11 +738,14 @@ func validateFormStreamDictPart2(xRefTable *pdf.XRefTable, d pdf.Dict, dictName
 		return err
 	}
 
-	// Name, name, optional (required in 1.0)
+	// Name, name, optional (required in 1.0), deprecated since V2.0
 	required := xRefTable.Version() == pdf.V10
 	_, err = validateNameEntry(xRefTable, d, dictName, "Name", required, pdf.V10, nil)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return validateDeprecatedEntry(xRefTable, d, dictName, "Name", pdf.V20)
 }
 
 func validateFormStreamDict(xRefTable *pdf.XRefTable, sd *pdf.StreamDict) error {
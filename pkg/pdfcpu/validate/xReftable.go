@@ -474,19 +474,57 @@ func validateOutputIntentDict(xRefTable *pdf.XRefTable, d pdf.Dict) error {
 
 	// DestOutputProfile, optional, streamDict
 	_, err = validateStreamDictEntry(xRefTable, d, dictName, "DestOutputProfile", OPTIONAL, pdf.V10, nil)
+	if err != nil {
+		return err
+	}
+
+	// DestOutputProfileRef, optional, dict, since V2.0
+	_, err = validateDictEntry(xRefTable, d, dictName, "DestOutputProfileRef", OPTIONAL, pdf.V20, validateDestOutputProfileRefDict(xRefTable))
+	if err != nil {
+		return err
+	}
+
+	// MixingHints, optional, dict, since V2.0
+	_, err = validateDictEntry(xRefTable, d, dictName, "MixingHints", OPTIONAL, pdf.V20, nil)
+	if err != nil {
+		return err
+	}
+
+	// SpectralData, optional, dict, since V2.0
+	_, err = validateDictEntry(xRefTable, d, dictName, "SpectralData", OPTIONAL, pdf.V20, nil)
 
 	return err
 }
 
-func validateOutputIntents(xRefTable *pdf.XRefTable, rootDict pdf.Dict, required bool, sinceVersion pdf.Version) error {
+func validateDestOutputProfileRefDict(xRefTable *pdf.XRefTable) func(pdf.Dict) bool {
 
-	// => 14.11.5 Output Intents
+	// see 14.11.5.2
 
-	if xRefTable.ValidationMode == pdf.ValidationRelaxed {
-		sinceVersion = pdf.V13
+	return func(d pdf.Dict) bool {
+
+		dictName := "destOutputProfileRefDict"
+
+		for _, k := range []string{"CheckSum", "ICCVersion", "ProfileCS", "ProfileName"} {
+			if _, err := validateStringEntry(xRefTable, d, dictName, k, OPTIONAL, pdf.V20, nil); err != nil {
+				return false
+			}
+		}
+
+		// ColorantTable, optional, array of text strings
+		if _, err := validateStringArrayEntry(xRefTable, d, dictName, "ColorantTable", OPTIONAL, pdf.V20, nil); err != nil {
+			return false
+		}
+
+		// URLs, optional, array of URL file specifications
+		_, err := validateArrayEntry(xRefTable, d, dictName, "URLs", OPTIONAL, pdf.V20, nil)
+
+		return err == nil
 	}
+}
 
-	a, err := validateArrayEntry(xRefTable, rootDict, "rootDict", "OutputIntents", required, sinceVersion, nil)
+func validateOutputIntentsEntry(xRefTable *pdf.XRefTable, d pdf.Dict, dictName string, required bool, sinceVersion pdf.Version) error {
+
+	a, err := validateArrayEntry(xRefTable, d, dictName, "OutputIntents", required, sinceVersion, nil)
 	if err != nil || a == nil {
 		return err
 	}
@@ -511,6 +549,17 @@ func validateOutputIntents(xRefTable *pdf.XRefTable, rootDict pdf.Dict, required
 	return nil
 }
 
+func validateOutputIntents(xRefTable *pdf.XRefTable, rootDict pdf.Dict, required bool, sinceVersion pdf.Version) error {
+
+	// => 14.11.5 Output Intents
+
+	if xRefTable.ValidationMode == pdf.ValidationRelaxed {
+		sinceVersion = pdf.V13
+	}
+
+	return validateOutputIntentsEntry(xRefTable, rootDict, "rootDict", required, sinceVersion)
+}
+
 func validatePieceDict(xRefTable *pdf.XRefTable, d pdf.Dict) error {
 
 	dictName := "pieceDict"
@@ -799,8 +848,12 @@ func validateCollection(xRefTable *pdf.XRefTable, rootDict pdf.Dict, required bo
 func validateNeedsRendering(xRefTable *pdf.XRefTable, rootDict pdf.Dict, required bool, sinceVersion pdf.Version) error {
 
 	_, err := validateBooleanEntry(xRefTable, rootDict, "rootDict", "NeedsRendering", required, sinceVersion, nil)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// XFA forms are deprecated since V2.0
+	return validateDeprecatedEntry(xRefTable, rootDict, "rootDict", "NeedsRendering", pdf.V20)
 }
 
 func validateRootObject(xRefTable *pdf.XRefTable) error {
@@ -28,7 +28,7 @@ var VersionStr = "v0.2.5 dev"
 // Version is a type for the internal representation of PDF versions.
 type Version int
 
-// Constants for all PDF versions up to v1.7
+// Constants for all PDF versions up to v2.0
 const (
 	V10 Version = iota
 	V11
@@ -38,6 +38,7 @@ const (
 	V15
 	V16
 	V17
+	V20
 )
 
 // PDFVersion returns the PDFVersion for a version string.
@@ -60,6 +61,8 @@ func PDFVersion(versionStr string) (Version, error) {
 		return V16, nil
 	case "1.7":
 		return V17, nil
+	case "2.0":
+		return V20, nil
 	}
 
 	return -1, errors.New(versionStr)
@@ -67,5 +70,8 @@ func PDFVersion(versionStr string) (Version, error) {
 
 // String returns a string representation for a given PDFVersion.
 func (v Version) String() string {
+	if v == V20 {
+		return "2.0"
+	}
 	return "1." + fmt.Sprintf("%d", v)
 }
@@ -26,6 +26,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
 	"github.com/pdfcpu/pdfcpu/pkg/log"
 	"github.com/pkg/errors"
 )
@@ -36,6 +37,11 @@ func Write(ctx *Context) error {
 	var file *os.File
 	var err error
 
+	// Make sure all objects are loaded.
+	if err = ctx.LoadObjects(); err != nil {
+		return err
+	}
+
 	// Create a writer for dirname and filename if not already supplied.
 	if ctx.Write.Writer == nil {
 
@@ -66,14 +72,35 @@ func Write(ctx *Context) error {
 
 	}
 
+	if incrementalUpdate(ctx) {
+		err = writeUpdate(ctx)
+		if err != nil {
+			return err
+		}
+		return setFileSizeOfWrittenFile(ctx.Write, file)
+	}
+
+	if linearize(ctx) {
+		err = writeLinearized(ctx)
+		if err != nil {
+			return err
+		}
+		return setFileSizeOfWrittenFile(ctx.Write, file)
+	}
+
 	err = prepareContextForWriting(ctx)
 	if err != nil {
 		return err
 	}
 
 	// Since we support PDF Collections (since V1.7) for file attachments
-	// we need to always generate V1.7 PDF files.
-	err = writeHeader(ctx.Write, V17)
+	// we need to always generate V1.7 PDF files unless we are dealing with PDF 2.0.
+	v := V17
+	if ctx.Version() == V20 {
+		v = V20
+	}
+
+	err = writeHeader(ctx.Write, v)
 	if err != nil {
 		return err
 	}
@@ -184,7 +211,8 @@ func ensureFileID(ctx *Context) error {
 		return errors.New("pdfcpu: ID must be an array with 2 elements")
 	}
 
-	a[1] = fid
+	// ctx.ID may be shared with the trailer dict of an xref stream.
+	ctx.ID = Array{a[0], fid}
 
 	return nil
 }
@@ -399,6 +427,10 @@ func writeTrailerDict(ctx *Context) error {
 		d.Insert("ID", xRefTable.ID)
 	}
 
+	if w.PrevXRefOffset != nil {
+		d.Insert("Prev", Integer(*w.PrevXRefOffset))
+	}
+
 	_, err = w.WriteString(d.PDFString())
 	if err != nil {
 		return err
@@ -460,7 +492,7 @@ func writeXRefSubsection(ctx *Context, start int, size int) error {
 func deleteRedundantObject(ctx *Context, objNr int) {
 
 	if len(ctx.Write.SelectedPages) == 0 &&
-		(ctx.Optimize.IsDuplicateFontObject(objNr) || ctx.Optimize.IsDuplicateImageObject(objNr)) {
+		(ctx.Optimize.IsDuplicateFontObject(objNr) || ctx.Optimize.IsDuplicateImageObject(objNr) || ctx.Optimize.IsUnusedResourceObject(objNr)) {
 		ctx.DeleteObject(objNr)
 	}
 
@@ -502,6 +534,7 @@ func deleteRedundantObjects(ctx *Context) {
 			delete(ctx.Optimize.DuplicateFontObjs, i)
 			delete(ctx.Optimize.DuplicateImageObjs, i)
 			delete(ctx.Optimize.DuplicateInfoObjects, i)
+			delete(ctx.Optimize.UnusedResourceObjs, i)
 			continue
 		}
 
@@ -537,10 +570,13 @@ func deleteRedundantObjects(ctx *Context) {
 
 func sortedWritableKeys(ctx *Context) []int {
 
+	// An incremental update only covers the objects written or freed.
+	incremental := ctx.Write.PrevXRefOffset != nil
+
 	var keys []int
 
 	for i, e := range ctx.Table {
-		if e.Free || ctx.Write.HasWriteOffset(i) {
+		if e.Free && (!incremental || ctx.Write.FreedObjs[i]) || ctx.Write.HasWriteOffset(i) {
 			keys = append(keys, i)
 		}
 	}
@@ -553,9 +589,12 @@ func sortedWritableKeys(ctx *Context) []int {
 // After inserting the last object write the cross reference table to disk.
 func writeXRefTable(ctx *Context) error {
 
-	err := ctx.EnsureValidFreeList()
-	if err != nil {
-		return err
+	var err error
+
+	if ctx.Write.PrevXRefOffset == nil {
+		if err = ctx.EnsureValidFreeList(); err != nil {
+			return err
+		}
 	}
 
 	keys := sortedWritableKeys(ctx)
@@ -663,13 +702,7 @@ func createXRefStream(ctx *Context, i1, i2, i3 int) ([]byte, *Array, error) {
 		a   Array
 	)
 
-	var keys []int
-	for i, e := range xRefTable.Table {
-		if e.Free || ctx.Write.HasWriteOffset(i) {
-			keys = append(keys, i)
-		}
-	}
-	sort.Ints(keys)
+	keys := sortedWritableKeys(ctx)
 
 	objCount := len(keys)
 	log.Write.Printf("createXRefStream: xref has %d entries\n", objCount)
@@ -752,16 +785,31 @@ func writeXRefStream(ctx *Context) error {
 	xRefStreamDict := NewXRefStreamDict(ctx)
 	xRefTableEntry := NewXRefTableEntryGen0(*xRefStreamDict)
 
-	// Reuse free objects (including recycled objects from this run).
-	objNumber, err := xRefTable.InsertAndUseRecycled(*xRefTableEntry)
-	if err != nil {
-		return err
-	}
+	var (
+		objNumber int
+		err       error
+	)
+
+	if ctx.Write.PrevXRefOffset != nil {
+
+		// An incremental update leaves the free list of the original file alone.
+		objNumber = xRefTable.InsertNew(*xRefTableEntry)
+		xRefStreamDict.Insert("Prev", Integer(*ctx.Write.PrevXRefOffset))
+
+	} else {
+
+		// Reuse free objects (including recycled objects from this run).
+		objNumber, err = xRefTable.InsertAndUseRecycled(*xRefTableEntry)
+		if err != nil {
+			return err
+		}
+
+		// After the last insert of an object.
+		err = xRefTable.EnsureValidFreeList()
+		if err != nil {
+			return err
+		}
 
-	// After the last insert of an object.
-	err = xRefTable.EnsureValidFreeList()
-	if err != nil {
-		return err
 	}
 
 	xRefStreamDict.Insert("Size", Integer(*xRefTable.Size))
@@ -788,6 +836,16 @@ func writeXRefStream(ctx *Context) error {
 	wArr := Array{Integer(i1), Integer(i2), Integer(i3)}
 	xRefStreamDict.Insert("W", wArr)
 
+	// PNG Up prediction pays off since consecutive xref entries are very similar.
+	decodeParms := Dict(
+		map[string]Object{
+			"Columns":   Integer(i1 + i2 + i3),
+			"Predictor": Integer(filter.PredictorUp),
+		},
+	)
+	xRefStreamDict.Insert("DecodeParms", decodeParms)
+	xRefStreamDict.FilterPipeline[0].DecodeParms = decodeParms
+
 	// Generate xRefStreamDict data = xref entries -> xRefStreamDict.Content
 	content, indArr, err := createXRefStream(ctx, i1, i2, i3)
 	if err != nil {
@@ -869,6 +927,10 @@ func setupEncryption(ctx *Context) error {
 		return errors.New("pdfcpu: unsupported encryption algorithm")
 	}
 
+	if len(ctx.Recipients) > 0 {
+		return setupPubSecEncryption(ctx)
+	}
+
 	d := newEncryptDict(
 		ctx.EncryptUsingAES,
 		ctx.EncryptKeyLength,
@@ -922,6 +984,10 @@ func updateEncryption(ctx *Context) error {
 		return err
 	}
 
+	if pubSecEncryption(d) {
+		return errors.New("pdfcpu: passwords and permissions of documents encrypted for recipients can't be changed")
+	}
+
 	if ctx.Cmd == SETPERMISSIONS {
 		//fmt.Printf("updating permissions to: %v\n", ctx.UserAccessPermissions)
 		ctx.E.P = int(ctx.Permissions)
@@ -941,7 +1007,7 @@ func updateEncryption(ctx *Context) error {
 		ctx.OwnerPW = *ctx.OwnerPWNew
 	}
 
-	if ctx.E.R == 5 {
+	if ctx.E.R >= 5 {
 
 		err = calcOAndU(ctx, d)
 		if err != nil {
@@ -0,0 +1,347 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// writeFlatObject writes the indirect object objNr without following any references.
+func writeFlatObject(ctx *Context, objNr int) error {
+
+	entry, found := ctx.FindTableEntryLight(objNr)
+	if !found || entry.Free {
+		return errors.Errorf("pdfcpu: writeFlatObject: missing obj #%d", objNr)
+	}
+
+	genNr := *entry.Generation
+
+	switch o := entry.Object.(type) {
+
+	case nil:
+		return writePDFNullObject(ctx, objNr, genNr)
+
+	case Dict:
+		return writeDictObject(ctx, objNr, genNr, o)
+
+	case StreamDict:
+		if o.Raw == nil && o.source == nil {
+			return errors.Errorf("pdfcpu: writeFlatObject: obj #%d: missing stream data", objNr)
+		}
+		if ctx.EncKey != nil {
+			if _, err := encryptDeepObject(o.Dict, objNr, genNr, ctx.EncKey, ctx.AES4Strings, ctx.E.R); err != nil {
+				return err
+			}
+		}
+		return writeStreamDictObject(ctx, objNr, genNr, o)
+
+	case Array:
+		return writeArrayObject(ctx, objNr, genNr, o)
+
+	case Integer:
+		return writeIntegerObject(ctx, objNr, genNr, o)
+
+	case Float:
+		return writeFloatObject(ctx, objNr, genNr, o)
+
+	case StringLiteral:
+		return writeStringLiteralObject(ctx, objNr, genNr, o)
+
+	case HexLiteral:
+		return writeHexLiteralObject(ctx, objNr, genNr, o)
+
+	case Boolean:
+		return writeBooleanObject(ctx, objNr, genNr, o)
+
+	case Name:
+		return writeNameObject(ctx, objNr, genNr, o)
+
+	}
+
+	return errors.Errorf("pdfcpu: writeFlatObject: undefined PDF object #%d %T\n", objNr, entry.Object)
+}
+
+// lastByte returns the last byte of rs.
+func lastByte(rs io.ReadSeeker) (byte, error) {
+
+	if _, err := rs.Seek(-1, io.SeekEnd); err != nil {
+		return 0, err
+	}
+
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(rs, b); err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+// writeIncrement copies the file ctx has been read from to ctx.Write
+// and appends an incremental update (7.5.6) made up of the objects objNrs.
+// Earlier revisions of the file remain untouched, which keeps existing signatures valid.
+func writeIncrement(ctx *Context, objNrs []int) (err error) {
+
+	log.Write.Printf("writeIncrement begin: objs=%v\n", objNrs)
+
+	rs := ctx.Read.rs
+	if rs == nil {
+		return errors.New("pdfcpu: writeIncrement: missing input")
+	}
+
+	if len(objNrs) == 0 {
+		return errors.New("pdfcpu: writeIncrement: nothing to write")
+	}
+
+	prev, err := offsetLastXRefSection(ctx)
+	if err != nil {
+		return err
+	}
+
+	c, err := lastByte(rs)
+	if err != nil {
+		return err
+	}
+
+	if _, err = rs.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	w := ctx.Write
+
+	if w.Offset, err = io.Copy(w, rs); err != nil {
+		return err
+	}
+
+	// The update starts on a new line.
+	if c != 0x0A && c != 0x0D {
+		if err = w.WriteEol(); err != nil {
+			return err
+		}
+		w.Offset += int64(len(w.Eol))
+	}
+
+	w.PrevXRefOffset, w.FreedObjs = prev, IntSet{}
+	defer func() { w.PrevXRefOffset, w.FreedObjs = nil, nil }()
+
+	objNrs = append([]int(nil), objNrs...)
+	sort.Ints(objNrs)
+
+	for _, objNr := range objNrs {
+
+		entry, found := ctx.FindTableEntryLight(objNr)
+		if !found {
+			return errors.Errorf("pdfcpu: writeIncrement: missing obj #%d", objNr)
+		}
+
+		if entry.Free {
+			w.FreedObjs[objNr] = true
+			continue
+		}
+
+		// eg. indirect stream lengths
+		if w.HasWriteOffset(objNr) {
+			continue
+		}
+
+		if ctx.Encrypt != nil && objNr == ctx.Encrypt.ObjectNumber.Value() {
+			err = writeEncryptDict(ctx)
+		} else {
+			err = writeFlatObject(ctx, objNr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Stick to the kind of cross reference section used by the original file.
+	ctx.WriteXRefStream = ctx.Read.UsingXRefStreams
+
+	if err = writeXRef(ctx); err != nil {
+		return err
+	}
+
+	if _, err = writeTrailer(w); err != nil {
+		return err
+	}
+
+	// Terminate the update with an eol so the next one starts right behind this revision.
+	if err = w.WriteEol(); err != nil {
+		return err
+	}
+
+	log.Write.Println("writeIncrement end")
+
+	return w.Flush()
+}
+
+// incrementalUpdate returns true if ctx gets written as an incremental update of the file it has been read from.
+func incrementalUpdate(ctx *Context) bool {
+
+	if !ctx.Incremental || ctx.fingerprints == nil || ctx.Read == nil || ctx.Read.rs == nil {
+		return false
+	}
+
+	switch ctx.Cmd {
+	case OPTIMIZE, SPLIT, EXTRACTPAGES:
+		return false
+	}
+
+	return true
+}
+
+// removeUnselectedPages removes the pages not selected for writing from the page tree rooted at ir.
+// The page objects themselves stay in place.
+func removeUnselectedPages(ctx *Context, ir IndirectRef, pageNr *int) (int, error) {
+
+	d, err := ctx.DereferenceDict(ir)
+	if err != nil || d == nil {
+		return 0, errors.Errorf("pdfcpu: removeUnselectedPages: corrupt page tree node obj #%d", ir.ObjectNumber)
+	}
+
+	var kids Array
+	count := 0
+
+	for _, o := range d.ArrayEntry("Kids") {
+
+		kidRef, ok := o.(IndirectRef)
+		if !ok {
+			return 0, errors.New("pdfcpu: removeUnselectedPages: corrupt page tree node")
+		}
+
+		kid, err := ctx.DereferenceDict(kidRef)
+		if err != nil || kid == nil {
+			return 0, errors.Errorf("pdfcpu: removeUnselectedPages: corrupt page tree node obj #%d", kidRef.ObjectNumber)
+		}
+
+		if t := kid.Type(); t != nil && *t == "Pages" {
+			c, err := removeUnselectedPages(ctx, kidRef, pageNr)
+			if err != nil {
+				return 0, err
+			}
+			// Drop empty subtrees.
+			if c > 0 {
+				kids = append(kids, o)
+				count += c
+			}
+			continue
+		}
+
+		*pageNr++
+
+		keep := ctx.Write.SelectedPages[*pageNr]
+		if ctx.Cmd == REMOVEPAGES {
+			keep = !keep
+		}
+
+		if keep {
+			kids = append(kids, o)
+			count++
+		}
+	}
+
+	d.Update("Kids", kids)
+	d.Update("Count", Integer(count))
+
+	return count, nil
+}
+
+// ensureVersionForUpdate declares V1.7 like a full write does unless the original already complies.
+func ensureVersionForUpdate(ctx *Context) {
+
+	if *ctx.HeaderVersion >= V17 {
+		return
+	}
+
+	if v := ctx.RootDict.NameEntry("Version"); v != nil && (*v == V17.String() || *v == V20.String()) {
+		return
+	}
+
+	ctx.RootDict.Update("Version", Name(V17.String()))
+}
+
+// writeUpdate appends all changes made to ctx since reading as an incremental update to the original file.
+func writeUpdate(ctx *Context) error {
+
+	switch ctx.Cmd {
+	case ENCRYPT, DECRYPT, CHANGEUPW, CHANGEOPW:
+		// Earlier revisions would remain accessible without or using the old passwords.
+		return errors.New("pdfcpu: incremental updates don't support encrypting, decrypting or changing passwords")
+	}
+
+	encKey := ctx.EncKey
+
+	if err := prepareContextForWriting(ctx); err != nil {
+		return err
+	}
+
+	if len(ctx.Write.SelectedPages) > 0 {
+		root, err := ctx.Pages()
+		if err != nil {
+			return err
+		}
+		pageNr := 0
+		if ctx.PageCount, err = removeUnselectedPages(ctx, *root, &pageNr); err != nil {
+			return err
+		}
+	}
+
+	// Ensure corresponding and accurate name tree object graphs.
+	if !ctx.ReducedFeatureSet() {
+		if err := ctx.BindNameTrees(); err != nil {
+			return err
+		}
+	}
+
+	ensureVersionForUpdate(ctx)
+
+	// A new encryption key affects all objects.
+	// Object streams encrypted using the old key are dropped, their objects get written uncompressed.
+	rekeyed := !bytes.Equal(encKey, ctx.EncKey)
+	if rekeyed {
+		for objNr := range ctx.Read.ObjectStreams {
+			if err := ctx.DeleteObject(objNr); err != nil {
+				return err
+			}
+		}
+	}
+
+	objNrs := ctx.ChangedObjects()
+
+	if rekeyed {
+		m := IntSet{}
+		for _, objNr := range objNrs {
+			m[objNr] = true
+		}
+		for objNr, entry := range ctx.Table {
+			if !entry.Free && !ctx.Read.IsXRefStreamObject(objNr) {
+				m[objNr] = true
+			}
+		}
+		objNrs = objNrs[:0]
+		for objNr := range m {
+			objNrs = append(objNrs, objNr)
+		}
+		sort.Ints(objNrs)
+	}
+
+	return writeIncrement(ctx, objNrs)
+}
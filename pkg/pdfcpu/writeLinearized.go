@@ -0,0 +1,769 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// Annex F: Linearized PDF
+//
+// A linearized file is laid out as follows:
+//
+//	header
+//	linearization parameter dict
+//	first-page cross-reference section and trailer
+//	document catalog and document-level objects (part 4)
+//	primary hint stream
+//	first-page section (part 6)
+//	remaining pages, each page object followed by its private objects (part 7)
+//	objects shared by the remaining pages (part 8)
+//	all other objects (part 9)
+//	main cross-reference section and trailer
+//
+// The objects of the main cross-reference section are numbered 1..n-1 in file order,
+// those of the first-page cross-reference section n.. in file order.
+
+// linearizer organizes the objects of a document according to Annex F.
+type linearizer struct {
+	ctx        *Context
+	pages      []int      // page objects in page order
+	inherited  [][]Object // inherited page attributes per page
+	pageTree   IntSet     // intermediate page tree nodes
+	docObjs    []int      // part 4
+	pageObjs   [][]int    // part 6 for the first page, part 7 for all others
+	sharedRefs [][]int    // shared objects referenced by a page
+	sharedObjs []int      // part 8
+	otherObjs  []int      // part 9
+	lookup     map[int]int
+	linNr      int // linearization parameter dict
+	hintNr     int // primary hint stream
+	size       int
+}
+
+// linearize returns true if the document is going to be written as linearized PDF.
+func linearize(ctx *Context) bool {
+	return ctx.Linearize && len(ctx.Write.SelectedPages) == 0 && !ctx.ReducedFeatureSet()
+}
+
+func (l *linearizer) collectPages(ir IndirectRef, inherited []Object) error {
+
+	objNr := ir.ObjectNumber.Value()
+
+	d, err := l.ctx.DereferenceDict(ir)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return errors.Errorf("pdfcpu: linearize: missing page tree node #%d", objNr)
+	}
+
+	kids := d.ArrayEntry("Kids")
+	if kids == nil || (d.Type() != nil && *d.Type() == "Page") {
+		l.pages = append(l.pages, objNr)
+		l.inherited = append(l.inherited, inherited)
+		return nil
+	}
+
+	if l.pageTree[objNr] {
+		return errors.Errorf("pdfcpu: linearize: corrupt page tree at obj #%d", objNr)
+	}
+	l.pageTree[objNr] = true
+
+	inh := append([]Object{}, inherited...)
+	for _, k := range []string{"Resources", "MediaBox", "CropBox", "Rotate"} {
+		if o, found := d.Find(k); found {
+			inh = append(inh, o)
+		}
+	}
+
+	for _, o := range kids {
+		if ir, ok := o.(IndirectRef); ok {
+			if err := l.collectPages(ir, inh); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// collect appends all objects reachable from o to objs in depth first order
+// without descending into objects marked as stop or already seen.
+func (l *linearizer) collect(o Object, stop, seen IntSet, objs *[]int) {
+
+	switch o := o.(type) {
+
+	case IndirectRef:
+		objNr := o.ObjectNumber.Value()
+		if stop[objNr] || seen[objNr] {
+			return
+		}
+		entry, found := l.ctx.Find(objNr)
+		if !found || entry.Free {
+			return
+		}
+		seen[objNr] = true
+		*objs = append(*objs, objNr)
+		l.collect(entry.Object, stop, seen, objs)
+
+	case Dict:
+		for _, k := range o.sortedKeys() {
+			l.collect(o[k], stop, seen, objs)
+		}
+
+	case StreamDict:
+		l.collect(o.Dict, stop, seen, objs)
+
+	case Array:
+		for _, v := range o {
+			l.collect(v, stop, seen, objs)
+		}
+	}
+}
+
+func (l *linearizer) collectPage(i int, stop, docObjs IntSet) []int {
+
+	p := l.pages[i]
+	entry, _ := l.ctx.Find(p)
+
+	seen := IntSet{p: true}
+	for k := range docObjs {
+		seen[k] = true
+	}
+
+	objs := []int{p}
+	l.collect(entry.Object, stop, seen, &objs)
+	for _, o := range l.inherited[i] {
+		l.collect(o, stop, seen, &objs)
+	}
+
+	return objs
+}
+
+// classify assigns all objects reachable from the trailer to the parts of a linearized file.
+func (l *linearizer) classify() error {
+
+	ctx := l.ctx
+	root := ctx.Root.ObjectNumber.Value()
+
+	rootDict, err := ctx.DereferenceDict(*ctx.Root)
+	if err != nil {
+		return err
+	}
+	if rootDict == nil {
+		return errors.New("pdfcpu: linearize: missing root dict")
+	}
+
+	ir := rootDict.IndirectRefEntry("Pages")
+	if ir == nil {
+		return errors.New("pdfcpu: linearize: missing indirect obj for pages dict")
+	}
+
+	if err := l.collectPages(*ir, nil); err != nil {
+		return err
+	}
+
+	if len(l.pages) == 0 {
+		return errors.New("pdfcpu: linearize: no pages")
+	}
+
+	stop := IntSet{root: true}
+	for k := range l.pageTree {
+		stop[k] = true
+	}
+	for _, p := range l.pages {
+		if stop[p] {
+			return errors.Errorf("pdfcpu: linearize: corrupt page tree at obj #%d", p)
+		}
+		stop[p] = true
+	}
+
+	// Part 4: Objects needed for opening the document.
+	docSet := IntSet{root: true}
+	l.docObjs = []int{root}
+	for _, k := range []string{"ViewerPreferences", "PageMode", "Threads", "OpenAction", "AcroForm"} {
+		if o, found := rootDict.Find(k); found {
+			l.collect(o, stop, docSet, &l.docObjs)
+		}
+	}
+
+	// Part 6: The first page and all objects it references.
+	closures := make([][]int, len(l.pages))
+	for i := range l.pages {
+		closures[i] = l.collectPage(i, stop, docSet)
+	}
+
+	first := IntSet{}
+	for _, objNr := range closures[0] {
+		first[objNr] = true
+	}
+
+	users := map[int]int{}
+	for _, objs := range closures[1:] {
+		for _, objNr := range objs {
+			users[objNr]++
+		}
+	}
+
+	// Part 7 and 8: Objects used by exactly one page and objects shared by the remaining pages.
+	l.pageObjs = make([][]int, len(l.pages))
+	l.sharedRefs = make([][]int, len(l.pages))
+	l.pageObjs[0] = closures[0]
+
+	assigned := IntSet{}
+	for k := range docSet {
+		assigned[k] = true
+	}
+	for k := range first {
+		assigned[k] = true
+	}
+
+	shared := IntSet{}
+	for i := 1; i < len(l.pages); i++ {
+		for _, objNr := range closures[i] {
+			if first[objNr] || users[objNr] > 1 {
+				l.sharedRefs[i] = append(l.sharedRefs[i], objNr)
+				if !first[objNr] && !shared[objNr] {
+					shared[objNr] = true
+					l.sharedObjs = append(l.sharedObjs, objNr)
+				}
+				continue
+			}
+			l.pageObjs[i] = append(l.pageObjs[i], objNr)
+			assigned[objNr] = true
+		}
+	}
+
+	for k := range shared {
+		assigned[k] = true
+	}
+
+	// Part 9: Everything else like the page tree, outlines, name trees or the info dict.
+	l.collect(rootDict, nil, assigned, &l.otherObjs)
+	for _, p := range l.pages {
+		entry, _ := ctx.Find(p)
+		if d, ok := entry.Object.(Dict); ok {
+			if o, found := d.Find("Parent"); found {
+				l.collect(o, nil, assigned, &l.otherObjs)
+			}
+		}
+	}
+	if ctx.Info != nil {
+		l.collect(*ctx.Info, nil, assigned, &l.otherObjs)
+	}
+
+	return nil
+}
+
+// number assigns new object numbers in file order.
+func (l *linearizer) number() {
+
+	l.lookup = map[int]int{}
+
+	i := 1
+	assign := func(objs []int) {
+		for _, objNr := range objs {
+			l.lookup[objNr] = i
+			i++
+		}
+	}
+
+	for _, objs := range l.pageObjs[1:] {
+		assign(objs)
+	}
+	assign(l.sharedObjs)
+	assign(l.otherObjs)
+
+	l.linNr = i
+	i++
+	assign(l.docObjs)
+	l.hintNr = i
+	i++
+	assign(l.pageObjs[0])
+
+	l.size = i
+}
+
+func (l *linearizer) renumberedObject(o Object) Object {
+
+	switch o := o.(type) {
+
+	case IndirectRef:
+		objNr, ok := l.lookup[o.ObjectNumber.Value()]
+		if !ok {
+			// Dangling reference.
+			return nil
+		}
+		return *NewIndirectRef(objNr, o.GenerationNumber.Value())
+
+	case Dict:
+		d := NewDict()
+		for k, v := range o {
+			d[k] = l.renumberedObject(v)
+		}
+		return d
+
+	case StreamDict:
+		o.Dict = l.renumberedObject(o.Dict).(Dict)
+		if o.IndirectRefEntry("Length") != nil || o.IntEntry("Length") == nil {
+			// A stream length that can't be determined fails writing the stream.
+			if l, err := o.rawLength(); err == nil {
+				o.Update("Length", Integer(l))
+			}
+		}
+		return o
+
+	case Array:
+		a := make(Array, len(o))
+		for i, v := range o {
+			a[i] = l.renumberedObject(v)
+		}
+		return a
+
+	}
+
+	return o
+}
+
+// renumber rebuilds the xref table using the new object numbers.
+func (l *linearizer) renumber() error {
+
+	ctx := l.ctx
+
+	t := map[int]*XRefTableEntry{0: NewFreeHeadXRefTableEntry()}
+
+	for objNr, i := range l.lookup {
+		entry := ctx.Table[objNr]
+		entry.Object = l.renumberedObject(entry.Object)
+		t[i] = entry
+	}
+
+	ctx.Table = t
+	ctx.Size = &l.size
+
+	ctx.Root = NewIndirectRef(l.lookup[ctx.Root.ObjectNumber.Value()], ctx.Root.GenerationNumber.Value())
+	d, err := ctx.DereferenceDict(*ctx.Root)
+	if err != nil {
+		return err
+	}
+	ctx.RootDict = d
+
+	if ctx.Info != nil {
+		ctx.Info = NewIndirectRef(l.lookup[ctx.Info.ObjectNumber.Value()], ctx.Info.GenerationNumber.Value())
+	}
+
+	for _, objNrs := range [][]int{l.docObjs, l.sharedObjs, l.otherObjs} {
+		for i, objNr := range objNrs {
+			objNrs[i] = l.lookup[objNr]
+		}
+	}
+
+	for i := range l.pages {
+		l.pages[i] = l.lookup[l.pages[i]]
+		for j, objNr := range l.pageObjs[i] {
+			l.pageObjs[i][j] = l.lookup[objNr]
+		}
+		for j, objNr := range l.sharedRefs[i] {
+			l.sharedRefs[i][j] = l.lookup[objNr]
+		}
+	}
+
+	return nil
+}
+
+// bitWriter writes the bit packed values of hint tables.
+type bitWriter struct {
+	bytes.Buffer
+	b byte
+	n uint
+}
+
+func (w *bitWriter) writeBits(v int64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.b = w.b<<1 | byte(v>>uint(i)&1)
+		w.n++
+		if w.n == 8 {
+			w.WriteByte(w.b)
+			w.b, w.n = 0, 0
+		}
+	}
+}
+
+// flush pads the last byte with zero bits.
+func (w *bitWriter) flush() {
+	if w.n > 0 {
+		w.WriteByte(w.b << (8 - w.n))
+		w.b, w.n = 0, 0
+	}
+}
+
+func nbits(v int64) int {
+	return bits.Len64(uint64(v))
+}
+
+func minMax(vals []int64) (min, max int64) {
+	min, max = vals[0], vals[0]
+	for _, v := range vals[1:] {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return min, max
+}
+
+// hintTables returns the page offset hint table (F.4.1) followed by the shared object hint table (F.4.2)
+// and the offset of the latter.
+// offset and length return the location of an object as if the hint stream were not present.
+func (l *linearizer) hintTables(offset, length func(objNr int) int64) ([]byte, int) {
+
+	var w bitWriter
+
+	n := len(l.pages)
+	nObjs := make([]int64, n)
+	pageLen := make([]int64, n)
+	nShared := make([]int64, n)
+
+	for i, objs := range l.pageObjs {
+		nObjs[i] = int64(len(objs))
+		for _, objNr := range objs {
+			pageLen[i] += length(objNr)
+		}
+		nShared[i] = int64(len(l.sharedRefs[i]))
+	}
+
+	// Shared object identifiers index into the shared object hint table
+	// starting with the objects of the first-page section.
+	ids := map[int]int64{}
+	for i, objNr := range l.pageObjs[0] {
+		ids[objNr] = int64(i)
+	}
+	for i, objNr := range l.sharedObjs {
+		ids[objNr] = int64(len(l.pageObjs[0]) + i)
+	}
+	nSharedTotal := int64(len(ids))
+
+	minObjs, maxObjs := minMax(nObjs)
+	minLen, maxLen := minMax(pageLen)
+	_, maxShared := minMax(nShared)
+
+	// Like other writers we use 0 for the content stream offset
+	// and the page length for the content stream length.
+	w.writeBits(minObjs, 32)
+	w.writeBits(offset(l.pages[0]), 32)
+	w.writeBits(int64(nbits(maxObjs-minObjs)), 16)
+	w.writeBits(minLen, 32)
+	w.writeBits(int64(nbits(maxLen-minLen)), 16)
+	w.writeBits(0, 32)
+	w.writeBits(0, 16)
+	w.writeBits(minLen, 32)
+	w.writeBits(int64(nbits(maxLen-minLen)), 16)
+	w.writeBits(int64(nbits(maxShared)), 16)
+	w.writeBits(int64(nbits(nSharedTotal)), 16)
+	w.writeBits(0, 16)
+	w.writeBits(1, 16)
+
+	for i := range l.pages {
+		w.writeBits(nObjs[i]-minObjs, nbits(maxObjs-minObjs))
+	}
+	w.flush()
+
+	for i := range l.pages {
+		w.writeBits(pageLen[i]-minLen, nbits(maxLen-minLen))
+	}
+	w.flush()
+
+	for i := range l.pages {
+		w.writeBits(nShared[i], nbits(maxShared))
+	}
+	w.flush()
+
+	for i := range l.pages {
+		for _, objNr := range l.sharedRefs[i] {
+			w.writeBits(ids[objNr], nbits(nSharedTotal))
+		}
+	}
+	w.flush()
+
+	// Shared object numerators and content stream offsets take up 0 bits.
+
+	for i := range l.pages {
+		w.writeBits(pageLen[i]-minLen, nbits(maxLen-minLen))
+	}
+	w.flush()
+
+	s := w.Len()
+
+	// Every shared object group consists of a single object.
+	objs := append(append([]int{}, l.pageObjs[0]...), l.sharedObjs...)
+	groupLen := make([]int64, len(objs))
+	for i, objNr := range objs {
+		groupLen[i] = length(objNr)
+	}
+	minGroupLen, maxGroupLen := minMax(groupLen)
+
+	var firstShared, firstSharedOffset int64
+	if len(l.sharedObjs) > 0 {
+		firstShared = int64(l.sharedObjs[0])
+		firstSharedOffset = offset(l.sharedObjs[0])
+	}
+
+	w.writeBits(firstShared, 32)
+	w.writeBits(firstSharedOffset, 32)
+	w.writeBits(int64(len(l.pageObjs[0])), 32)
+	w.writeBits(int64(len(objs)), 32)
+	w.writeBits(0, 16)
+	w.writeBits(minGroupLen, 32)
+	w.writeBits(int64(nbits(maxGroupLen-minGroupLen)), 16)
+
+	for _, v := range groupLen {
+		w.writeBits(v-minGroupLen, nbits(maxGroupLen-minGroupLen))
+	}
+	w.flush()
+
+	// No MD5 signatures.
+	for range groupLen {
+		w.writeBits(0, 1)
+	}
+	w.flush()
+
+	return w.Bytes(), s
+}
+
+func linearizationDictString(l, hintOffset, hintLength int64, o int, e int64, n int, t int64) string {
+	return fmt.Sprintf("<</Linearized 1/L %d/H[%d %d]/O %d/E %d/N %d/T %d>>", l, hintOffset, hintLength, o, e, n, t)
+}
+
+func padded(s string, length int) string {
+	return s + strings.Repeat(" ", length-len(s))
+}
+
+// writeLinearized writes ctx as linearized PDF file suitable for Fast Web View.
+// No object streams are used and the cross-reference sections are classic xref tables.
+func writeLinearized(ctx *Context) error {
+
+	log.Write.Println("writeLinearized begin")
+
+	if ctx.Encrypt != nil || ctx.Cmd == ENCRYPT {
+		return errors.New("pdfcpu: linearization of encrypted files is not supported")
+	}
+
+	if err := ensureInfoDictAndFileID(ctx); err != nil {
+		return err
+	}
+
+	if err := ctx.BindNameTrees(); err != nil {
+		return err
+	}
+
+	if ctx.RootVersion != nil {
+		ctx.RootDict.Delete("Version")
+	}
+
+	l := &linearizer{ctx: ctx, pageTree: IntSet{}}
+
+	if err := l.classify(); err != nil {
+		return err
+	}
+
+	l.number()
+
+	if err := l.renumber(); err != nil {
+		return err
+	}
+
+	w := ctx.Write
+	out := w.Writer
+	eol := w.Eol
+
+	v := V17
+	if ctx.Version() == V20 {
+		v = V20
+	}
+
+	if err := writeHeader(w, v); err != nil {
+		return err
+	}
+
+	// The linearization dict and the first-page xref section have a fixed size
+	// so we can calculate all offsets before writing them.
+	const maxOffset = 9999999999
+	linDictLen := len(linearizationDictString(maxOffset, maxOffset, maxOffset, l.pages[0], maxOffset, len(l.pages), maxOffset))
+	linObjLen := len(fmt.Sprintf("%d 0 obj%s", l.linNr, eol)) + linDictLen + len(fmt.Sprintf("%sendobj%s", eol, eol))
+
+	info := ""
+	if ctx.Info != nil {
+		info = "/Info " + ctx.Info.PDFString()
+	}
+	firstTrailer := func(prev int64) string {
+		return fmt.Sprintf("<</Size %d/Root %s%s/ID %s/Prev %d>>", l.size, ctx.Root.PDFString(), info, ctx.ID.PDFString(), prev)
+	}
+	firstTrailerLen := len(firstTrailer(maxOffset))
+
+	firstXRefCount := l.size - l.linNr
+	firstXRefLen := len("xref"+eol) + len(fmt.Sprintf("%d %d%s", l.linNr, firstXRefCount, eol)) + 20*firstXRefCount +
+		len("trailer"+eol) + firstTrailerLen + len(eol+"startxref"+eol+"0"+eol+"%%EOF"+eol)
+
+	firstXRefOffset := w.Offset + int64(linObjLen)
+	base := firstXRefOffset + int64(firstXRefLen)
+
+	// Write all objects but the hint stream.
+	var body bytes.Buffer
+	w.Writer = bufio.NewWriter(&body)
+	w.Offset = base
+
+	writeObjs := func(objs []int) error {
+		for _, objNr := range objs {
+			if err := writeFlatObject(ctx, objNr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := writeObjs(l.docObjs); err != nil {
+		return err
+	}
+	hintOffset := w.Offset
+
+	parts := append(append([][]int{}, l.pageObjs...), l.sharedObjs, l.otherObjs)
+	for _, objs := range parts {
+		if err := writeObjs(objs); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	bodyEnd := w.Offset
+
+	// Hint table offsets disregard the hint stream.
+	fileOrder := append([]int{}, l.docObjs...)
+	for _, objs := range parts {
+		fileOrder = append(fileOrder, objs...)
+	}
+	ends := map[int]int64{}
+	for i, objNr := range fileOrder {
+		end := bodyEnd
+		if i < len(fileOrder)-1 {
+			end = w.Table[fileOrder[i+1]]
+		}
+		ends[objNr] = end
+	}
+	offset := func(objNr int) int64 { return w.Table[objNr] }
+	length := func(objNr int) int64 { return ends[objNr] - w.Table[objNr] }
+
+	b, s := l.hintTables(offset, length)
+
+	sd := StreamDict{
+		Dict:           Dict(map[string]Object{"S": Integer(s)}),
+		Content:        b,
+		FilterPipeline: []PDFFilter{{Name: filter.Flate, DecodeParms: nil}},
+	}
+	sd.InsertName("Filter", filter.Flate)
+	if err := encodeStream(&sd); err != nil {
+		return err
+	}
+	ctx.Table[l.hintNr] = NewXRefTableEntryGen0(sd)
+
+	var hint bytes.Buffer
+	w.Writer = bufio.NewWriter(&hint)
+	if err := writeFlatObject(ctx, l.hintNr); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	hintLength := int64(hint.Len())
+
+	for objNr, off := range w.Table {
+		if off >= hintOffset {
+			w.Table[objNr] = off + hintLength
+		}
+	}
+	w.Table[l.hintNr] = hintOffset
+
+	e := hintLength + ends[l.pageObjs[0][len(l.pageObjs[0])-1]]
+
+	// Main xref section.
+	mainXRefOffset := bodyEnd + hintLength
+
+	var mainXRef bytes.Buffer
+	fmt.Fprintf(&mainXRef, "xref%s0 %d", eol, l.linNr)
+	t := mainXRefOffset + int64(mainXRef.Len())
+	fmt.Fprintf(&mainXRef, "%s%010d %05d f%2s", eol, 0, FreeHeadGeneration, eol)
+	for i := 1; i < l.linNr; i++ {
+		fmt.Fprintf(&mainXRef, "%010d %05d n%2s", w.Table[i], *ctx.Table[i].Generation, eol)
+	}
+	fmt.Fprintf(&mainXRef, "trailer%s<</Size %d>>%sstartxref%s%d%s%%%%EOF", eol, l.size, eol, eol, firstXRefOffset, eol)
+
+	fileSize := mainXRefOffset + int64(mainXRef.Len())
+
+	linDict := NewDict()
+	linDict.Insert("Linearized", Integer(1))
+	linDict.Insert("L", Integer(fileSize))
+	linDict.Insert("H", NewIntegerArray(int(hintOffset), int(hintLength)))
+	linDict.Insert("O", Integer(l.pages[0]))
+	linDict.Insert("E", Integer(e))
+	linDict.Insert("N", Integer(len(l.pages)))
+	linDict.Insert("T", Integer(t))
+	ctx.Table[l.linNr] = NewXRefTableEntryGen0(linDict)
+
+	// Write the file.
+	w.Writer = out
+	w.Offset = firstXRefOffset - int64(linObjLen)
+
+	if err := writeObject(ctx, l.linNr, 0, padded(linearizationDictString(fileSize, hintOffset, hintLength, l.pages[0], e, len(l.pages), t), linDictLen)); err != nil {
+		return err
+	}
+
+	var firstXRef bytes.Buffer
+	fmt.Fprintf(&firstXRef, "xref%s%d %d%s", eol, l.linNr, firstXRefCount, eol)
+	for i := l.linNr; i < l.size; i++ {
+		fmt.Fprintf(&firstXRef, "%010d %05d n%2s", w.Table[i], *ctx.Table[i].Generation, eol)
+	}
+	fmt.Fprintf(&firstXRef, "trailer%s%s%sstartxref%s0%s%%%%EOF%s", eol, padded(firstTrailer(mainXRefOffset), firstTrailerLen), eol, eol, eol, eol)
+
+	split := hintOffset - base
+
+	for _, b := range [][]byte{firstXRef.Bytes(), body.Bytes()[:split], hint.Bytes(), body.Bytes()[split:], mainXRef.Bytes()} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		w.Offset += int64(len(b))
+	}
+
+	if w.Offset != fileSize {
+		return errors.Errorf("pdfcpu: writeLinearized: file size mismatch: %d != %d", w.Offset, fileSize)
+	}
+
+	log.Write.Println("writeLinearized end")
+
+	return nil
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2019 The pdfcpu Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pdfcpu
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func linearizeBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+
+	ctx, err := Read(bytes.NewReader(b), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx.Cmd = OPTIMIZE
+	ctx.Linearize = true
+
+	if err = OptimizeXRefTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	ctx.Write.Writer = bufio.NewWriter(&buf)
+
+	if err = Write(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+type bitReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *bitReader) read(n int64) int64 {
+	var v int64
+	for i := int64(0); i < n; i++ {
+		v = v<<1 | int64(r.b[r.pos/8]>>(7-uint(r.pos%8))&1)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) align() {
+	r.pos = (r.pos + 7) / 8 * 8
+}
+
+// checkLinearized verifies the linearization dict and the hint tables of b against the actual file layout.
+func checkLinearized(t *testing.T, b []byte, pageCount int) {
+	t.Helper()
+
+	ctx, err := Read(bytes.NewReader(b), NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ctx.Read.Linearized {
+		t.Fatal("linearization dict not recognized")
+	}
+
+	// Every xref entry points to its object.
+	offsets := map[int64]int{}
+	for objNr, entry := range ctx.Table {
+		if entry.Free {
+			continue
+		}
+		prefix := fmt.Sprintf("%d %d obj", objNr, *entry.Generation)
+		if !bytes.HasPrefix(b[*entry.Offset:], []byte(prefix)) {
+			t.Fatalf("obj #%d: bad offset %d", objNr, *entry.Offset)
+		}
+		offsets[*entry.Offset] = objNr
+	}
+
+	offset := func(objNr int) int64 {
+		return *ctx.Table[objNr].Offset
+	}
+
+	m := regexp.MustCompile(`^%PDF-\d\.\d\n%[^\n]*\n(\d+) 0 obj`).FindSubmatch(b)
+	if m == nil {
+		t.Fatal("linearization dict must be the first object")
+	}
+	linNr, _ := strconv.Atoi(string(m[1]))
+	d := ctx.Table[linNr].Object.(Dict)
+
+	intEntry := func(key string) int64 {
+		i := d.IntEntry(key)
+		if i == nil {
+			t.Fatalf("linearization dict: missing %s", key)
+		}
+		return int64(*i)
+	}
+
+	if l := intEntry("L"); l != int64(len(b)) {
+		t.Fatalf("L: want:%d got:%d", len(b), l)
+	}
+
+	if n := intEntry("N"); n != int64(pageCount) {
+		t.Fatalf("N: want:%d got:%d", pageCount, n)
+	}
+
+	ir, err := ctx.PageDictIndRef(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := int(intEntry("O"))
+	if o != ir.ObjectNumber.Value() {
+		t.Fatalf("O: want:%d got:%d", ir.ObjectNumber.Value(), o)
+	}
+
+	m = regexp.MustCompile(`endobj\nxref\n(\d+) (\d+)\n`).FindSubmatch(b)
+	first, _ := strconv.Atoi(string(m[1]))
+	count, _ := strconv.Atoi(string(m[2]))
+	if first != linNr || first+count != *ctx.Size {
+		t.Fatalf("first-page xref section: %d %d", first, count)
+	}
+
+	if tt := intEntry("T"); !bytes.HasPrefix(b[tt:], []byte("\n0000000000 65535 f")) {
+		t.Fatalf("T: %d does not point to the main xref section", tt)
+	}
+
+	a := d.ArrayEntry("H")
+	hintOffset, hintLength := int64(a[0].(Integer)), int64(a[1].(Integer))
+	hintNr, found := offsets[hintOffset]
+	if !found || !bytes.HasSuffix(b[:hintOffset+hintLength], []byte("endobj\n")) {
+		t.Fatalf("H: %v does not point to the hint stream", a)
+	}
+	adjust := func(off int64) int64 {
+		if off >= hintOffset {
+			off += hintLength
+		}
+		return off
+	}
+
+	sd := ctx.Table[hintNr].Object.(StreamDict)
+	if err = decodeStream(&sd); err != nil {
+		t.Fatal(err)
+	}
+
+	// Page offset hint table
+	r := &bitReader{b: sd.Content}
+	minObjs, firstPageOffset, bitsObjs := r.read(32), r.read(32), r.read(16)
+	minLen, bitsLen := r.read(32), r.read(16)
+	r.read(32)
+	bitsContentOffset := r.read(16)
+	r.read(32)
+	bitsContentLen, bitsShared, bitsSharedID, bitsNumerator := r.read(16), r.read(16), r.read(16), r.read(16)
+	r.read(16)
+
+	nObjs := make([]int64, pageCount)
+	pageLen := make([]int64, pageCount)
+	nShared := make([]int64, pageCount)
+	for i := range nObjs {
+		nObjs[i] = minObjs + r.read(bitsObjs)
+	}
+	r.align()
+	for i := range pageLen {
+		pageLen[i] = minLen + r.read(bitsLen)
+	}
+	r.align()
+	for i := range nShared {
+		nShared[i] = r.read(bitsShared)
+	}
+	r.align()
+	var ids []int64
+	for i := range nShared {
+		for j := int64(0); j < nShared[i]; j++ {
+			ids = append(ids, r.read(bitsSharedID))
+		}
+	}
+	r.align()
+	if bitsNumerator != 0 || bitsContentOffset != 0 || bitsContentLen != bitsLen {
+		t.Fatal("unexpected content stream hints")
+	}
+
+	off := firstPageOffset
+	for i := 0; i < pageCount; i++ {
+		ir, err := ctx.PageDictIndRef(i + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objNr := ir.ObjectNumber.Value()
+		start, end := adjust(off), adjust(off)+pageLen[i]
+		if offset(objNr) != start {
+			t.Fatalf("page %d: want offset:%d got:%d", i+1, offset(objNr), start)
+		}
+		for j := objNr; j < objNr+int(nObjs[i]); j++ {
+			if offset(j) < start || offset(j) >= end {
+				t.Fatalf("page %d: obj #%d outside of page", i+1, j)
+			}
+		}
+		if _, found := offsets[end]; !found {
+			t.Fatalf("page %d: bad page length %d", i+1, pageLen[i])
+		}
+		if i == 0 && end != intEntry("E") {
+			t.Fatalf("E: want:%d got:%d", end, intEntry("E"))
+		}
+		off += pageLen[i]
+	}
+
+	// Shared object hint table
+	r = &bitReader{b: sd.Content[*sd.IntEntry("S"):]}
+	firstShared, firstSharedOffset, nFirst, nTotal := r.read(32), r.read(32), r.read(32), r.read(32)
+	bitsGroupObjs, minGroupLen, bitsGroupLen := r.read(16), r.read(32), r.read(16)
+
+	if nFirst != nObjs[0] {
+		t.Fatalf("shared objects of first page: want:%d got:%d", nObjs[0], nFirst)
+	}
+	for _, id := range ids {
+		if id >= nTotal {
+			t.Fatalf("shared object identifier %d out of range", id)
+		}
+	}
+
+	groupLen := make([]int64, nTotal)
+	for i := range groupLen {
+		groupLen[i] = minGroupLen + r.read(bitsGroupLen)
+	}
+	r.align()
+	for range groupLen {
+		if r.read(1) != 0 {
+			t.Fatal("unexpected MD5 signature")
+		}
+	}
+	r.align()
+	if bitsGroupObjs != 0 {
+		t.Fatal("unexpected shared object groups")
+	}
+
+	off, objNr := firstPageOffset, o
+	for i, l := range groupLen {
+		if int64(i) == nFirst {
+			off, objNr = firstSharedOffset, int(firstShared)
+		}
+		if offset(objNr) != adjust(off) {
+			t.Fatalf("shared object #%d: want offset:%d got:%d", objNr, offset(objNr), adjust(off))
+		}
+		off += l
+		objNr++
+	}
+}
+
+func TestLinearize(t *testing.T) {
+
+	for _, tt := range []struct {
+		fileName  string
+		pageCount int
+	}{
+		{"testImage.pdf", 2},
+		{"Acroforms2.pdf", 3},
+		{"CenterOfWhy.pdf", 25},
+		{"go.pdf", 23},
+	} {
+
+		b, err := ioutil.ReadFile(filepath.Join("..", "testdata", tt.fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b = linearizeBytes(t, b)
+		checkLinearized(t, b, tt.pageCount)
+
+		// Linearize a linearized file.
+		checkLinearized(t, linearizeBytes(t, b), tt.pageCount)
+	}
+}
@@ -18,6 +18,7 @@ package pdfcpu
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/pdfcpu/pdfcpu/pkg/log"
 	"github.com/pkg/errors"
@@ -400,18 +401,56 @@ func writeArrayObject(ctx *Context, objNumber, genNumber int, a Array) error {
 	return writeObject(ctx, objNumber, genNumber, a.PDFString())
 }
 
-func writeStream(w *WriteContext, sd StreamDict) (int64, error) {
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// writeStreamContent writes the encoded stream content of sd to w, encrypting it using encrypt if not nil.
+// Stream content not loaded gets copied from file.
+func writeStreamContent(w io.Writer, sd StreamDict, encrypt func(io.Writer) (io.WriteCloser, error)) (int64, error) {
+
+	cw := &countingWriter{w: w}
+
+	var wc io.WriteCloser = nopWriteCloser{cw}
+
+	if encrypt != nil {
+		var err error
+		if wc, err = encrypt(cw); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := sd.copyRaw(wc); err != nil {
+		return 0, err
+	}
+
+	if err := wc.Close(); err != nil {
+		return 0, err
+	}
+
+	return cw.n, nil
+}
+
+func writeStream(w *WriteContext, sd StreamDict, encrypt func(io.Writer) (io.WriteCloser, error)) (int64, error) {
 
 	b, err := w.WriteString(fmt.Sprintf("%sstream%s", w.Eol, w.Eol))
 	if err != nil {
 		return 0, errors.Wrapf(err, "writeStream: failed to write raw content")
 	}
 
-	c, err := w.Write(sd.Raw)
+	c, err := writeStreamContent(w, sd, encrypt)
 	if err != nil {
 		return 0, errors.Wrapf(err, "writeStream: failed to write raw content")
 	}
-	if int64(c) != *sd.StreamLength {
+	if c != *sd.StreamLength {
 		return 0, errors.Errorf("writeStream: failed to write raw content: %d bytes written - streamlength:%d", c, *sd.StreamLength)
 	}
 
@@ -469,9 +508,33 @@ func writeStreamDictObject(ctx *Context, objNumber, genNumber int, sd StreamDict
 
 	// Unless the "Identity" crypt filter is used we have to encrypt.
 	isXRefStreamDict := sd.Type() != nil && *sd.Type() == "XRef"
-	if ctx.EncKey != nil &&
+	needEncryption := ctx.EncKey != nil &&
 		!isXRefStreamDict &&
-		!(len(sd.FilterPipeline) == 1 && sd.FilterPipeline[0].Name == "Crypt") {
+		!(len(sd.FilterPipeline) == 1 && sd.FilterPipeline[0].Name == "Crypt")
+
+	var encrypt func(io.Writer) (io.WriteCloser, error)
+
+	if sd.Raw == nil && sd.source != nil {
+
+		// Copy the stream content from file encrypting it on the fly.
+		l, err := sd.rawLength()
+		if err != nil {
+			return err
+		}
+
+		if needEncryption {
+			l = encryptedStreamLength(l, ctx.AES4Streams)
+			encrypt = func(w io.Writer) (io.WriteCloser, error) {
+				return encryptStreamWriter(w, objNumber, genNumber, ctx.EncKey, ctx.AES4Streams, ctx.E.R)
+			}
+		}
+
+		if sd.StreamLength == nil || l != *sd.StreamLength {
+			sd.StreamLength = &l
+			sd.Update("Length", Integer(l))
+		}
+
+	} else if needEncryption {
 
 		sd.Raw, err = encryptStream(sd.Raw, objNumber, genNumber, ctx.EncKey, ctx.AES4Streams, ctx.E.R)
 		if err != nil {
@@ -497,7 +560,7 @@ func writeStreamDictObject(ctx *Context, objNumber, genNumber int, sd StreamDict
 		return err
 	}
 
-	b, err := writeStream(ctx.Write, sd)
+	b, err := writeStream(ctx.Write, sd, encrypt)
 	if err != nil {
 		return err
 	}
@@ -526,11 +589,11 @@ func writeDirectObject(ctx *Context, o Object) error {
 	switch o := o.(type) {
 
 	case Dict:
-		for k, v := range o {
+		for _, k := range o.sortedKeys() {
 			if ctx.writingPages && (k == "Dest" || k == "D") {
 				ctx.dest = true
 			}
-			_, _, err := writeDeepObject(ctx, v)
+			_, _, err := writeDeepObject(ctx, o[k])
 			if err != nil {
 				return err
 			}
@@ -578,11 +641,11 @@ func writeDeepDict(ctx *Context, d Dict, objNr, genNr int) error {
 		return err
 	}
 
-	for k, v := range d {
+	for _, k := range d.sortedKeys() {
 		if ctx.writingPages && (k == "Dest" || k == "D") {
 			ctx.dest = true
 		}
-		_, _, err = writeDeepObject(ctx, v)
+		_, _, err = writeDeepObject(ctx, d[k])
 		if err != nil {
 			return err
 		}
@@ -606,8 +669,8 @@ func writeDeepStreamDict(ctx *Context, sd *StreamDict, objNr, genNr int) error {
 		return err
 	}
 
-	for _, v := range sd.Dict {
-		_, _, err = writeDeepObject(ctx, v)
+	for _, k := range sd.Dict.sortedKeys() {
+		_, _, err = writeDeepObject(ctx, sd.Dict[k])
 		if err != nil {
 			return err
 		}
@@ -76,11 +76,30 @@ func logWriteStats(ctx *Context) {
 	// Linearization objects
 	l, str = ctx.LinearizationObjsString()
 	log.Stats.Printf("%d original linearization entries: %s", l, str)
+
+	// Recompressed streams
+	if ctx.Recompress {
+		log.Stats.Printf("recompressed streams: %s\n", ctx.Optimize.RecompressedString())
+		log.Stats.Printf("%d pages with merged content streams\n", ctx.Optimize.MergedContentStreams)
+	}
+
+	// Optimized images
+	if ctx.OptimizeImages {
+		is := ctx.Optimize.ImageSavings
+		log.Stats.Printf("%d optimized images saving %d bytes\n", is.Streams, is.Saved)
+	}
+
+	// Unused resources
+	if ctx.RemoveUnusedResources {
+		l, str = ctx.Optimize.UnusedResourceObjectsString()
+		log.Stats.Printf("%d unused resources removed, %d original unused resource entries: %s", ctx.Optimize.UnusedResources, l, str)
+	}
 }
 
 func statsHeadLine() *string {
 
-	hl := "name;version;author;creator;producer;src_size (bin|text);src_bin:imgs|fonts|other;dest_size (bin|text);dest_bin:imgs|fonts|other;"
+	hl := "name;version;author;creator;producer;src_size (bin|text);src_bin:imgs|fonts|other;dest_size (bin|text);dest_bin:imgs|fonts|other;dest_bytes;"
+	hl += "recompressed:filter:streams(saved bytes);merged_contents;unused_resources;"
 	hl += "linearized;hybrid;xrefstr;objstr;pages;objs;missing;garbage;"
 	hl += "R_Version;R_Extensions;R_PageLabels;R_Names;R_Dests;R_ViewerPrefs;R_PageLayout;R_PageMode;"
 	hl += "R_Outlines;R_Threads;R_OpenAction;R_AA;R_URI;R_AcroForm;R_Metadata;R_StructTreeRoot;R_MarkInfo;"
@@ -153,7 +172,7 @@ func statsLine(ctx *Context) *string {
 		nonreferencedObjs = fmt.Sprintf("%d:%s", len(ctx.Optimize.NonReferencedObjs), strings.Join(s, ","))
 	}
 
-	line := fmt.Sprintf("%s;%s;%s;%s;%s;%s;%s;%s;%s;%v;%v;%v;%v;%d;%d;%s;%s;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v\n",
+	line := fmt.Sprintf("%s;%s;%s;%s;%s;%s;%s;%s;%s;%d;%s;%d;%d;%v;%v;%v;%v;%d;%d;%s;%s;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v;%v\n",
 		filepath.Base(ctx.Read.FileName),
 		version,
 		xRefTable.Author,
@@ -163,6 +182,10 @@ func statsLine(ctx *Context) *string {
 		sourceBinaryStats,
 		destSizeStats,
 		destBinaryStats,
+		destFileSize,
+		ctx.Optimize.RecompressedString(),
+		ctx.Optimize.MergedContentStreams,
+		ctx.Optimize.UnusedResources,
 		ctx.Read.Linearized,
 		ctx.Read.Hybrid,
 		ctx.Read.UsingXRefStreams,
@@ -17,6 +17,8 @@ limitations under the License.
 package pdfcpu
 
 import (
+	"bytes"
+	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
@@ -53,6 +55,41 @@ func NewXRefTableEntryGen0(obj Object) *XRefTableEntry {
 	return &XRefTableEntry{Generation: &zero, Object: obj}
 }
 
+// fingerprint returns a digest of the state of entry.
+func (entry *XRefTableEntry) fingerprint() [sha1.Size]byte {
+
+	h := sha1.New()
+
+	var gen int
+	if entry.Generation != nil {
+		gen = *entry.Generation
+	}
+
+	if entry.Free {
+		var next int64
+		if entry.Offset != nil {
+			next = *entry.Offset
+		}
+		fmt.Fprintf(h, "f %d %d", next, gen)
+	} else {
+		fmt.Fprintf(h, "n %d ", gen)
+		if entry.Object != nil {
+			h.Write([]byte(entry.Object.PDFString()))
+		}
+		if sd, ok := entry.Object.(StreamDict); ok {
+			// Stream content not loaded gets hashed while being read from file.
+			if _, err := sd.copyRaw(h); err != nil {
+				fmt.Fprintf(h, "%v", err)
+			}
+		}
+	}
+
+	var fp [sha1.Size]byte
+	copy(fp[:], h.Sum(nil))
+
+	return fp
+}
+
 // NewFreeHeadXRefTableEntry returns the xref table entry for object 0
 // which is per definition the head of the free list (list of free objects).
 func NewFreeHeadXRefTableEntry() *XRefTableEntry {
@@ -126,6 +163,12 @@ type XRefTable struct {
 	ValidationMode int  // see Configuration
 
 	Optimized bool
+
+	// Loads objects on first access (see Configuration.LazyLoad).
+	loader func(objNr int, entry *XRefTableEntry) error
+
+	// Digests of all entries as read, for detecting changes (see Configuration.Incremental).
+	fingerprints map[int][sha1.Size]byte
 }
 
 // NewXRefTable creates a new XRefTable.
@@ -174,17 +217,20 @@ func (xRefTable *XRefTable) ParseRootVersion() (v *string, err error) {
 func (xRefTable *XRefTable) ValidateVersion(element string, sinceVersion Version) error {
 
 	if xRefTable.Version() < sinceVersion {
-		return errors.Errorf("%s: unsupported in version %s\nThis file could be PDF/A compliant but pdfcpu only supports versions <= PDF V1.7\n", element, xRefTable.VersionString())
+		return errors.Errorf("%s: unsupported in version %s\nThis file could be PDF/A compliant but pdfcpu only supports versions <= PDF V2.0\n", element, xRefTable.VersionString())
 	}
 
 	return nil
 }
 
-// EnsureVersionForWriting sets the version to the highest supported PDF Version 1.7.
+// EnsureVersionForWriting sets the version to PDF Version 1.7 unless this is a PDF 2.0 file.
 // This is necessary to allow validation after adding features not supported
 // by the original version of a document as during watermarking.
 func (xRefTable *XRefTable) EnsureVersionForWriting() {
 	v := V17
+	if xRefTable.Version() == V20 {
+		v = V20
+	}
 	xRefTable.RootVersion = &v
 }
 
@@ -235,9 +281,130 @@ func (xRefTable *XRefTable) FindObject(objNr int) (Object, error) {
 		return nil, errors.Errorf("FindObject: obj#%d not registered in xRefTable", objNr)
 	}
 
+	if err := xRefTable.load(objNr, entry); err != nil {
+		return nil, err
+	}
+
 	return entry.Object, nil
 }
 
+// load resolves the object of entry on first access if loading lazily.
+func (xRefTable *XRefTable) load(objNr int, entry *XRefTableEntry) error {
+
+	if xRefTable.loader == nil || entry.Free || entry.Object != nil {
+		return nil
+	}
+
+	return xRefTable.loader(objNr, entry)
+}
+
+// LoadObjects loads all objects not accessed so far and turns off lazy loading.
+// This is a prerequisite for any processing of the whole cross reference table.
+func (xRefTable *XRefTable) LoadObjects() error {
+
+	if xRefTable.loader == nil {
+		return nil
+	}
+
+	log.Read.Println("LoadObjects: begin")
+
+	var keys []int
+	for k := range xRefTable.Table {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	for _, objNr := range keys {
+		if err := xRefTable.load(objNr, xRefTable.Table[objNr]); err != nil {
+			return err
+		}
+	}
+
+	xRefTable.loader = nil
+
+	for _, objNr := range keys {
+		entry := xRefTable.Table[objNr]
+		if entry.Free || entry.Compressed {
+			continue
+		}
+		processRefCounts(xRefTable, entry.Object)
+	}
+
+	log.Read.Println("LoadObjects: end")
+
+	return nil
+}
+
+// LoadStreams loads the encoded content of all streams into memory.
+// Stream content is read from file on demand, so this is a prerequisite
+// for using a context after closing the io.ReadSeeker it has been read from.
+func (xRefTable *XRefTable) LoadStreams() error {
+
+	for objNr, entry := range xRefTable.Table {
+
+		var err error
+
+		switch o := entry.Object.(type) {
+
+		case StreamDict:
+			err = o.loadRaw()
+			entry.Object = o
+
+		case ObjectStreamDict:
+			err = o.loadRaw()
+			entry.Object = o
+
+		case XRefStreamDict:
+			err = o.loadRaw()
+			entry.Object = o
+
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "LoadStreams: obj#%d", objNr)
+		}
+	}
+
+	return nil
+}
+
+// trackChanges loads all objects and remembers their state for ChangedObjects.
+func (xRefTable *XRefTable) trackChanges() error {
+
+	if err := xRefTable.LoadObjects(); err != nil {
+		return err
+	}
+
+	xRefTable.fingerprints = map[int][sha1.Size]byte{}
+
+	for objNr, entry := range xRefTable.Table {
+		xRefTable.fingerprints[objNr] = entry.fingerprint()
+	}
+
+	return nil
+}
+
+// ChangedObjects returns the sorted numbers of all objects added, modified or freed since reading.
+// Changes are tracked for Configuration.Incremental only.
+func (xRefTable *XRefTable) ChangedObjects() []int {
+
+	if xRefTable.fingerprints == nil {
+		return nil
+	}
+
+	var objNrs []int
+
+	for objNr, entry := range xRefTable.Table {
+		if fp, found := xRefTable.fingerprints[objNr]; !found || fp != entry.fingerprint() {
+			objNrs = append(objNrs, objNr)
+		}
+	}
+
+	sort.Ints(objNrs)
+
+	return objNrs
+}
+
 // Free returns the cross ref table entry for given number of a free object.
 func (xRefTable *XRefTable) Free(objNr int) (*XRefTableEntry, error) {
 
@@ -276,9 +443,19 @@ func (xRefTable *XRefTable) FindTableEntry(objNr int, genNr int) (*XRefTableEntr
 
 	//fmt.Printf("FindTableEntry: obj#:%d gen:%d \n", objNr, genNr)
 	entry, found := xRefTable.Find(objNr)
-	if !found || *entry.Generation != genNr {
+	if !found {
 		return nil, false
 	}
+
+	// Compressed objects have generation 0 and may not have been loaded yet.
+	g := 0
+	if entry.Generation != nil {
+		g = *entry.Generation
+	}
+	if g != genNr {
+		return nil, false
+	}
+
 	return entry, found
 }
 
@@ -322,7 +499,8 @@ func (xRefTable *XRefTable) InsertAndUseRecycled(xRefTableEntry XRefTableEntry)
 	}
 
 	// If none available, add new object & return.
-	if *freeListHeadEntry.Offset == 0 {
+	// Incremental updates leave the free objects of earlier revisions alone.
+	if *freeListHeadEntry.Offset == 0 || xRefTable.fingerprints != nil {
 		xRefTableEntry.RefCount = 1
 		objNr = xRefTable.InsertNew(xRefTableEntry)
 		log.Write.Printf("InsertAndUseRecycled: end, new objNr=%d\n", objNr)
@@ -533,10 +711,16 @@ func (xRefTable *XRefTable) EnsureValidFreeList() error {
 		return nil
 	}
 
+	var objNrs []int
+	for i := range m {
+		objNrs = append(objNrs, i)
+	}
+	sort.Ints(objNrs)
+
 	// insert remaining free objects into verified linked list
 	// unless they are forever deleted with generation 65535.
 	// In that case they have to point to obj 0.
-	for i := range m {
+	for _, i := range objNrs {
 
 		entry, found := xRefTable.FindTableEntryLight(i)
 		if !found {
@@ -645,6 +829,11 @@ func (xRefTable *XRefTable) DeleteObjectGraph(o Object) error {
 		return nil
 	}
 
+	// Shared objects are identified by their reference counts.
+	if err := xRefTable.LoadObjects(); err != nil {
+		return err
+	}
+
 	// Delete ObjectGraph for object indRef.ObjectNumber.Value() via recursion.
 	err := xRefTable.deleteObject(ir)
 	if err != nil {
@@ -742,6 +931,10 @@ func (xRefTable *XRefTable) indRefToObject(ir *IndirectRef) (Object, error) {
 		return nil, nil
 	}
 
+	if err := xRefTable.load(ir.ObjectNumber.Value(), entry); err != nil {
+		return nil, err
+	}
+
 	if entry.Object == nil { // if Object is nil, unnecessary to validate entry is free.
 		return nil, nil
 	}
@@ -1303,10 +1496,16 @@ func (xRefTable *XRefTable) BindNameTrees() error {
 
 	log.Write.Println("BindNameTrees..")
 
+	var names []string
+	for k := range xRefTable.Names {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
 	// Iterate over internal name tree rep.
-	for k, v := range xRefTable.Names {
+	for _, k := range names {
 		log.Write.Printf("bindNameTree: %s\n", k)
-		err := xRefTable.bindNameTreeNode(k, v, true)
+		err := xRefTable.bindNameTreeNode(k, xRefTable.Names[k], true)
 		if err != nil {
 			return err
 		}
@@ -1740,6 +1939,102 @@ func (xRefTable *XRefTable) PageDict(page int) (Dict, *InheritedPageAttrs, error
 	return pageDict, &inhPAttrs, nil
 }
 
+func (xRefTable *XRefTable) pageIndRef(root IndirectRef, p *int, page int) (*IndirectRef, error) {
+
+	d, err := xRefTable.DereferenceDict(root)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range d.ArrayEntry("Kids") {
+
+		ir, ok := o.(IndirectRef)
+		if !ok {
+			continue
+		}
+
+		d, err := xRefTable.DereferenceDict(ir)
+		if err != nil {
+			return nil, err
+		}
+
+		if d.Type() != nil && *d.Type() == "Pages" {
+			if c := d.IntEntry("Count"); c != nil && *p+*c < page {
+				// Skip sub page tree.
+				*p += *c
+				continue
+			}
+			pageRef, err := xRefTable.pageIndRef(ir, p, page)
+			if err != nil || pageRef != nil {
+				return pageRef, err
+			}
+			continue
+		}
+
+		*p++
+		if *p == page {
+			return &ir, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// PageDictIndRef returns an indirect reference to the page dict for page.
+func (xRefTable *XRefTable) PageDictIndRef(page int) (*IndirectRef, error) {
+
+	root, err := xRefTable.Pages()
+	if err != nil {
+		return nil, err
+	}
+
+	pageCount := 0
+
+	ir, err := xRefTable.pageIndRef(*root, &pageCount, page)
+	if err != nil {
+		return nil, err
+	}
+
+	if ir == nil {
+		return nil, errors.Errorf("pdfcpu: page %d not found", page)
+	}
+
+	return ir, nil
+}
+
+// PageContent returns the decoded content of a page dict, concatenating multiple content streams.
+func (xRefTable *XRefTable) PageContent(d Dict) ([]byte, error) {
+
+	o, err := xRefTable.Dereference(d["Contents"])
+	if err != nil || o == nil {
+		return nil, err
+	}
+
+	a, ok := o.(Array)
+	if !ok {
+		a = Array{d["Contents"]}
+	}
+
+	var buf bytes.Buffer
+
+	for _, o := range a {
+
+		sd, err := xRefTable.DereferenceStreamDict(o)
+		if err != nil || sd == nil {
+			return nil, err
+		}
+
+		if err = decodeStream(sd); err != nil {
+			return nil, err
+		}
+
+		buf.Write(sd.Content)
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
 // EnsurePageCount evaluates the page count for xRefTable if necessary.
 func (xRefTable *XRefTable) EnsurePageCount() error {
 